@@ -0,0 +1,77 @@
+// Command importroutes loads corridors from a zipped shapefile or CSV stop
+// list into a sacco's routes. It prints a preview and only writes draft
+// routes when -confirm is given.
+//
+//	go run ./cmd/importroutes -sacco 3 -file corridors.zip
+//	go run ./cmd/importroutes -sacco 3 -file stops.csv -confirm
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/importer"
+	"ma3_tracker/internal/models"
+)
+
+func main() {
+	saccoID := flag.Uint("sacco", 0, "ID of the sacco that will own the routes")
+	path := flag.String("file", "", "zipped shapefile (.zip) or stop list (.csv)")
+	confirm := flag.Bool("confirm", false, "create the routes instead of only previewing them")
+	flag.Parse()
+	if *saccoID == 0 || *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		log.Fatalf("read %s: %v", *path, err)
+	}
+	var result importer.Result
+	switch strings.ToLower(filepath.Ext(*path)) {
+	case ".zip":
+		result, err = importer.ParseShapefileZip(data)
+	case ".csv", ".txt":
+		name := strings.TrimSuffix(filepath.Base(*path), filepath.Ext(*path))
+		result, err = importer.ParseCSV(bytes.NewReader(data), name)
+	default:
+		log.Fatalf("unsupported file type %q; use .zip or .csv", filepath.Ext(*path))
+	}
+	for _, w := range result.Warnings {
+		fmt.Println("warning:", w)
+	}
+	if err != nil {
+		log.Fatalf("parse %s: %v", *path, err)
+	}
+	for i, r := range result.Routes {
+		fmt.Printf("[%d] %s: %.1f km, %d points, %d stages\n", i, r.Name, r.LengthM/1000, len(r.Line), len(r.Stages))
+	}
+	if !*confirm {
+		fmt.Println("preview only; re-run with -confirm to create these routes as drafts")
+		return
+	}
+
+	config.InitDB()
+	var sacco models.Sacco
+	if err := config.DB.First(&sacco, *saccoID).Error; err != nil {
+		log.Fatalf("sacco %d: %v", *saccoID, err)
+	}
+	var ids []uint
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		ids, err = importer.Commit(tx, sacco.ID, result.Routes)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+	fmt.Printf("created %d draft routes for %s: %v\n", len(ids), sacco.Name, ids)
+}
@@ -0,0 +1,742 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusCodes maps the net/http constants handlers respond with.
+var statusCodes = map[string]int{
+	"StatusOK":                    200,
+	"StatusCreated":               201,
+	"StatusAccepted":              202,
+	"StatusNoContent":             204,
+	"StatusMovedPermanently":      301,
+	"StatusFound":                 302,
+	"StatusNotModified":           304,
+	"StatusBadRequest":            400,
+	"StatusUnauthorized":          401,
+	"StatusForbidden":             403,
+	"StatusNotFound":              404,
+	"StatusConflict":              409,
+	"StatusGone":                  410,
+	"StatusRequestEntityTooLarge": 413,
+	"StatusUnsupportedMediaType":  415,
+	"StatusUnprocessableEntity":   422,
+	"StatusTooManyRequests":       429,
+	"StatusInternalServerError":   500,
+	"StatusBadGateway":            502,
+	"StatusServiceUnavailable":    503,
+}
+
+// scope is a function body being read: the types and values of its local
+// names, and for helpers the caller's arguments.
+type scope struct {
+	pkg    string
+	fn     *ast.FuncDecl
+	ctx    string              // Name of the *gin.Context
+	types  map[string]ast.Expr // Local name -> type expression
+	values map[string]ast.Expr // Local name -> value assigned
+	args   map[string]ast.Expr // Parameter -> argument in the caller
+	caller *scope
+}
+
+// response is one body a handler can respond with.
+type response struct {
+	contentType string
+	schema      schema
+}
+
+// opInfo collects what reading a handler and its helpers turns up.
+type opInfo struct {
+	query     map[string]schema
+	body      schema
+	form      map[string]schema
+	responses map[string][]response
+	seen      map[*ast.FuncDecl]bool
+	paginated bool // Takes the shared paging parameters
+}
+
+// pagingParameters are the parameters every paginated listing takes.
+var pagingParameters = schema{
+	"page": schema{"name": "page", "in": "query", "description": "1-based page number",
+		"schema": schema{"type": "integer", "minimum": 1, "default": 1}},
+	"per_page": schema{"name": "per_page", "in": "query", "description": "Results per page",
+		"schema": schema{"type": "integer", "minimum": 1, "maximum": 200, "default": 50}},
+	"limit": schema{"name": "limit", "in": "query", "description": "Alias of per_page",
+		"schema": schema{"type": "integer", "minimum": 1, "maximum": 200}},
+	"cursor": schema{"name": "cursor", "in": "query", "description": "next_cursor of the previous page, instead of page",
+		"schema": schema{"type": "string"}},
+}
+
+// operation describes the route's handler. Handlers outside the controllers
+// package are listed without details.
+func (g *generator) operation(info gin.RouteInfo) schema {
+	op := schema{}
+	params := []schema{}
+	for _, m := range pathParam.FindAllStringSubmatch(info.Path, -1) {
+		p := schema{"name": m[1], "in": "path", "required": true, "schema": schema{"type": "string"}}
+		if m[1] == "id" || strings.HasSuffix(m[1], "_id") {
+			p["schema"] = schema{"type": "integer", "minimum": 0}
+		}
+		params = append(params, p)
+	}
+
+	name := strings.TrimPrefix(info.Handler, handlerPrefix)
+	fd := g.pkgs["controllers"].funcs[name]
+	if name == info.Handler || fd == nil {
+		op["summary"] = info.Handler
+		op["responses"] = schema{"default": schema{"description": "Response"}}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		return op
+	}
+
+	op["summary"] = name
+	if fd.Doc != nil {
+		doc := strings.TrimSpace(fd.Doc.Text())
+		op["summary"] = summary(doc)
+		if op["summary"] != strings.Join(strings.Fields(doc), " ") {
+			op["description"] = doc
+		}
+	}
+	info2 := &opInfo{
+		query:     map[string]schema{},
+		form:      map[string]schema{},
+		responses: map[string][]response{},
+		seen:      map[*ast.FuncDecl]bool{},
+	}
+	g.scan(fd, &scope{pkg: "controllers", ctx: paramName(fd, 0)}, info2)
+
+	if info2.paginated {
+		for _, name := range sortedKeys(pagingParameters) {
+			params = append(params, schema{"$ref": "#/components/parameters/" + name})
+		}
+	}
+	for _, name := range sortedKeys(info2.query) {
+		params = append(params, schema{"name": name, "in": "query", "schema": info2.query[name]})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	switch {
+	case info2.body != nil:
+		op["requestBody"] = schema{
+			"required": true,
+			"content":  schema{"application/json": schema{"schema": info2.body}},
+		}
+	case len(info2.form) > 0:
+		op["requestBody"] = schema{
+			"required": true,
+			"content": schema{"multipart/form-data": schema{
+				"schema": schema{"type": "object", "properties": info2.form},
+			}},
+		}
+	}
+
+	responses := schema{}
+	for code, list := range info2.responses {
+		responses[code] = responseObject(code, list)
+	}
+	if len(responses) == 0 {
+		responses["default"] = schema{"description": "Response"}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// summary is the first sentence of a doc comment.
+func summary(doc string) string {
+	doc = strings.Join(strings.Fields(doc), " ")
+	if i := strings.Index(doc, ". "); i >= 0 {
+		return doc[:i+1]
+	}
+	return doc
+}
+
+func paramName(fd *ast.FuncDecl, i int) string {
+	n := 0
+	for _, f := range fd.Type.Params.List {
+		for _, name := range f.Names {
+			if n == i {
+				return name.Name
+			}
+			n++
+		}
+	}
+	return ""
+}
+
+// responseObject merges the bodies a handler responds with for one status.
+func responseObject(code string, list []response) schema {
+	desc := "Response"
+	if n, err := strconv.Atoi(code); err == nil {
+		desc = http.StatusText(n)
+	}
+	out := schema{"description": desc}
+	content := schema{}
+	byType := map[string][]schema{}
+	for _, r := range list {
+		if r.contentType == "" {
+			continue
+		}
+		byType[r.contentType] = appendUnique(byType[r.contentType], r.schema)
+	}
+	for ct, schemas := range byType {
+		if len(schemas) == 1 {
+			content[ct] = schema{"schema": schemas[0]}
+		} else {
+			content[ct] = schema{"schema": schema{"oneOf": schemas}}
+		}
+	}
+	if len(content) > 0 {
+		out["content"] = content
+	}
+	return out
+}
+
+func appendUnique(list []schema, s schema) []schema {
+	key, _ := json.Marshal(s)
+	for _, have := range list {
+		if k, _ := json.Marshal(have); string(k) == string(key) {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// scan reads fd's body, following calls to package functions the context
+// is passed to.
+func (g *generator) scan(fd *ast.FuncDecl, sc *scope, op *opInfo) {
+	if fd.Body == nil || op.seen[fd] {
+		return
+	}
+	op.seen[fd] = true
+	sc.fn = fd
+	sc.types, sc.values = map[string]ast.Expr{}, map[string]ast.Expr{}
+	for _, f := range fd.Type.Params.List {
+		for _, n := range f.Names {
+			sc.types[n.Name] = f.Type
+		}
+	}
+	g.collectLocals(fd.Body, sc)
+
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fn := call.Fun
+		// Instantiated generic helpers, e.g. loadOwned[models.Trip](c, ...)
+		switch v := fn.(type) {
+		case *ast.IndexExpr:
+			fn = v.X
+		case *ast.IndexListExpr:
+			fn = v.X
+		}
+		switch fun := fn.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := fun.X.(*ast.Ident); ok && x.Name == sc.ctx {
+				g.contextCall(fun.Sel.Name, call.Args, sc, op)
+			}
+			if x, ok := fun.X.(*ast.Ident); ok && x.Name == "apierror" {
+				g.errorCall(fun.Sel.Name, call.Args, sc, op)
+			}
+		case *ast.Ident:
+			if fun.Name == "paginate" && len(call.Args) >= 4 {
+				g.paginationParams(call.Args[3], sc, op)
+			}
+			callee := g.pkgs[sc.pkg].funcs[fun.Name]
+			if callee == nil {
+				break
+			}
+			for i, arg := range call.Args {
+				if id, ok := arg.(*ast.Ident); ok && id.Name == sc.ctx {
+					inner := &scope{pkg: sc.pkg, ctx: paramName(callee, i), args: map[string]ast.Expr{}, caller: sc}
+					for j, a := range call.Args {
+						inner.args[paramName(callee, j)] = a
+					}
+					g.scan(callee, inner, op)
+					break
+				}
+			}
+		}
+		return true
+	})
+}
+
+// collectLocals records the declared or inferable types of local names.
+func (g *generator) collectLocals(body *ast.BlockStmt, sc *scope) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.ValueSpec:
+			for i, name := range s.Names {
+				if s.Type != nil {
+					sc.types[name.Name] = s.Type
+				}
+				if i < len(s.Values) {
+					sc.values[name.Name] = s.Values[i]
+				}
+			}
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE {
+				return true
+			}
+			if len(s.Rhs) == 1 && len(s.Lhs) > 1 {
+				results := g.resultTypes(s.Rhs[0], sc)
+				for i, lhs := range s.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok && i < len(results) {
+						sc.types[id.Name] = results[i]
+					}
+				}
+				return true
+			}
+			for i, lhs := range s.Lhs {
+				id, ok := lhs.(*ast.Ident)
+				if !ok || i >= len(s.Rhs) {
+					continue
+				}
+				sc.values[id.Name] = s.Rhs[i]
+				if t := g.exprType(s.Rhs[i], sc); t != nil {
+					sc.types[id.Name] = t
+				}
+			}
+		}
+		return true
+	})
+}
+
+// exprType infers the type of simple expressions.
+func (g *generator) exprType(e ast.Expr, sc *scope) ast.Expr {
+	switch v := e.(type) {
+	case *ast.CompositeLit:
+		return v.Type
+	case *ast.UnaryExpr:
+		if v.Op == token.AND {
+			return g.exprType(v.X, sc)
+		}
+	case *ast.CallExpr:
+		if id, ok := v.Fun.(*ast.Ident); ok && id.Name == "make" && len(v.Args) > 0 {
+			return v.Args[0]
+		}
+		if results := g.resultTypes(v, sc); len(results) > 0 {
+			return results[0]
+		}
+	case *ast.Ident:
+		return sc.types[v.Name]
+	}
+	return nil
+}
+
+// resultTypes returns the result types of a call to a function declared in
+// the module, qualified for the calling package.
+func (g *generator) resultTypes(e ast.Expr, sc *scope) []ast.Expr {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+	var fd *ast.FuncDecl
+	pkg := sc.pkg
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		fd = g.pkgs[sc.pkg].funcs[fun.Name]
+	case *ast.SelectorExpr:
+		if q, ok := fun.X.(*ast.Ident); ok && g.pkgs[q.Name] != nil {
+			pkg = q.Name
+			fd = g.pkgs[q.Name].funcs[fun.Sel.Name]
+		}
+	}
+	if fd == nil || fd.Type.Results == nil {
+		return nil
+	}
+	var out []ast.Expr
+	for _, f := range fd.Type.Results.List {
+		t := qualify(f.Type, pkg, sc.pkg)
+		if len(f.Names) == 0 {
+			out = append(out, t)
+		}
+		for range f.Names {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// qualify rewrites a type written in package from for use in package to.
+func qualify(t ast.Expr, from, to string) ast.Expr {
+	if from == to {
+		return t
+	}
+	switch v := t.(type) {
+	case *ast.Ident:
+		if _, basic := basicSchemas[v.Name]; basic || !ast.IsExported(v.Name) {
+			return v
+		}
+		return &ast.SelectorExpr{X: ast.NewIdent(from), Sel: v}
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: qualify(v.X, from, to)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: v.Len, Elt: qualify(v.Elt, from, to)}
+	case *ast.MapType:
+		return &ast.MapType{Key: v.Key, Value: qualify(v.Value, from, to)}
+	}
+	return t
+}
+
+// contextCall records what a call on the *gin.Context tells about the
+// request or response.
+func (g *generator) contextCall(method string, args []ast.Expr, sc *scope, op *opInfo) {
+	switch method {
+	case "Query", "DefaultQuery", "GetQuery", "QueryArray":
+		if name, ok := stringLit(args, 0); ok {
+			op.query[name] = schema{"type": "string"}
+		}
+	case "ShouldBindJSON", "ShouldBind", "BindJSON", "ShouldBindBodyWithJSON":
+		if len(args) == 1 {
+			if t := g.exprType(args[0], sc); t != nil {
+				op.body = g.typeSchema(sc.pkg, t)
+			} else {
+				op.body = schema{"type": "object"}
+			}
+		}
+	case "FormFile":
+		if name, ok := stringLit(args, 0); ok {
+			op.form[name] = schema{"type": "string", "format": "binary"}
+		}
+	case "PostForm", "DefaultPostForm":
+		if name, ok := stringLit(args, 0); ok {
+			op.form[name] = schema{"type": "string"}
+		}
+	case "JSON", "AbortWithStatusJSON", "IndentedJSON":
+		if len(args) == 2 {
+			code := statusKey(args[0])
+			s := g.valueSchema(args[1], sc)
+			if props, ok := s["properties"].(schema); ok && len(props) == 1 && props["error"] != nil {
+				s = schema{"$ref": "#/components/schemas/Error"}
+			}
+			op.responses[code] = append(op.responses[code], response{"application/json", s})
+		}
+	case "Data":
+		if len(args) == 3 {
+			ct, ok := stringLit(args, 1)
+			if !ok {
+				ct = "application/octet-stream"
+			}
+			ct, _, _ = strings.Cut(ct, ";")
+			op.responses[statusKey(args[0])] = append(op.responses[statusKey(args[0])],
+				response{ct, schema{"type": "string", "format": "binary"}})
+		}
+	case "String":
+		if len(args) >= 1 {
+			op.responses[statusKey(args[0])] = append(op.responses[statusKey(args[0])],
+				response{"text/plain", schema{"type": "string"}})
+		}
+	case "Status", "AbortWithStatus", "Redirect":
+		if len(args) >= 1 {
+			op.responses[statusKey(args[0])] = append(op.responses[statusKey(args[0])], response{})
+		}
+	}
+}
+
+// errorCall records the error response of a call to package apierror.
+func (g *generator) errorCall(fn string, args []ast.Expr, sc *scope, op *opInfo) {
+	if len(args) < 2 {
+		return
+	}
+	if id, ok := args[0].(*ast.Ident); !ok || id.Name != sc.ctx {
+		return
+	}
+	var code string
+	switch fn {
+	case "Respond", "Abort":
+		code = statusKey(args[1])
+	case "Fail":
+		code = errorStatus(args[1], sc, 0)
+	default:
+		return
+	}
+	op.responses[code] = append(op.responses[code],
+		response{"application/json", schema{"$ref": "#/components/schemas/Error"}})
+}
+
+// errorStatus finds the status of an apierror value: the status given to
+// apierror.New at the root of a chain of With calls, or the fixed status of
+// Invalid and Internal.
+func errorStatus(e ast.Expr, sc *scope, depth int) string {
+	if depth > 5 {
+		return "default"
+	}
+	switch v := e.(type) {
+	case *ast.Ident:
+		if val, ok := sc.values[v.Name]; ok {
+			return errorStatus(val, sc, depth+1)
+		}
+	case *ast.CallExpr:
+		sel, ok := v.Fun.(*ast.SelectorExpr)
+		if !ok {
+			break
+		}
+		if q, ok := sel.X.(*ast.Ident); ok && q.Name == "apierror" {
+			switch sel.Sel.Name {
+			case "New":
+				if len(v.Args) > 0 {
+					return statusKey(v.Args[0])
+				}
+			case "Invalid":
+				return "400"
+			case "Internal":
+				return "500"
+			}
+			break
+		}
+		return errorStatus(sel.X, sc, depth+1)
+	}
+	return "default"
+}
+
+func stringLit(args []ast.Expr, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	lit, ok := args[i].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+func statusKey(e ast.Expr) string {
+	switch v := e.(type) {
+	case *ast.SelectorExpr:
+		if code, ok := statusCodes[v.Sel.Name]; ok {
+			return strconv.Itoa(code)
+		}
+	case *ast.BasicLit:
+		if v.Kind == token.INT {
+			return v.Value
+		}
+	}
+	return "default"
+}
+
+// valueSchema describes the JSON a response value encodes to.
+func (g *generator) valueSchema(e ast.Expr, sc *scope) schema {
+	switch v := e.(type) {
+	case *ast.BasicLit:
+		switch v.Kind {
+		case token.STRING:
+			return schema{"type": "string"}
+		case token.INT:
+			return schema{"type": "integer"}
+		case token.FLOAT:
+			return schema{"type": "number"}
+		}
+	case *ast.Ident:
+		switch v.Name {
+		case "true", "false":
+			return schema{"type": "boolean"}
+		case "nil":
+			return schema{"nullable": true}
+		}
+		if lit, ok := sc.values[v.Name].(*ast.CompositeLit); ok && isGinH(lit.Type) {
+			return g.valueSchema(lit, sc)
+		}
+		if t := sc.types[v.Name]; t != nil {
+			return g.typeSchema(sc.pkg, t)
+		}
+	case *ast.CompositeLit:
+		if isGinH(v.Type) {
+			props := schema{}
+			for _, elt := range v.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				if key, ok := stringLit([]ast.Expr{kv.Key}, 0); ok {
+					props[key] = g.valueSchema(kv.Value, sc)
+				}
+			}
+			return schema{"type": "object", "properties": props}
+		}
+		if v.Type != nil {
+			return g.typeSchema(sc.pkg, v.Type)
+		}
+	case *ast.UnaryExpr:
+		return g.valueSchema(v.X, sc)
+	case *ast.BinaryExpr:
+		if v.Op == token.ADD {
+			if l := g.valueSchema(v.X, sc); l["type"] == "string" {
+				return l
+			}
+			return g.valueSchema(v.Y, sc)
+		}
+	case *ast.CallExpr:
+		if sel, ok := v.Fun.(*ast.SelectorExpr); ok {
+			if sel.Sel.Name == "Error" || sel.Sel.Name == "Sprintf" || sel.Sel.Name == "String" {
+				return schema{"type": "string"}
+			}
+		}
+		if id, ok := v.Fun.(*ast.Ident); ok {
+			if s, basic := basicSchemas[id.Name]; basic {
+				return clone(s)
+			}
+		}
+		if t := g.exprType(v, sc); t != nil {
+			return g.typeSchema(sc.pkg, t)
+		}
+	}
+	return schema{}
+}
+
+func isGinH(t ast.Expr) bool {
+	sel, ok := t.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	q, ok := sel.X.(*ast.Ident)
+	return ok && q.Name == "gin" && sel.Sel.Name == "H"
+}
+
+// paginationParams adds the paging, sort and filter parameters of a
+// paginate call with the given options.
+func (g *generator) paginationParams(optsExpr ast.Expr, sc *scope, op *opInfo) {
+	op.paginated = true
+
+	sorts, filters := g.listOptions(optsExpr, sc)
+	sortDesc := "Comma-separated fields, \"-\" for descending"
+	if len(sorts) > 0 {
+		sortDesc += ": " + strings.Join(sorts, ", ")
+	}
+	op.query["sort"] = schema{"type": "string", "description": sortDesc}
+	for name, s := range filters {
+		op.query[name] = s
+	}
+}
+
+// listOptions reads the sortable fields and filters out of a
+// pagination.Options literal, following local variables, package variables,
+// helper arguments and later assignments to its Filters.
+func (g *generator) listOptions(e ast.Expr, sc *scope) ([]string, map[string]schema) {
+	lit, filtersOverride := g.resolveOptions(e, sc, 0)
+	var sorts []string
+	filters := map[string]schema{}
+	var filtersExpr ast.Expr
+	if lit != nil {
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			switch key := kv.Key.(*ast.Ident); {
+			case key == nil:
+			case key.Name == "Sorts":
+				if m, ok := kv.Value.(*ast.CompositeLit); ok {
+					for _, s := range m.Elts {
+						if pair, ok := s.(*ast.KeyValueExpr); ok {
+							if name, ok := stringLit([]ast.Expr{pair.Key}, 0); ok {
+								sorts = append(sorts, name)
+							}
+						}
+					}
+				}
+			case key.Name == "Filters":
+				filtersExpr = kv.Value
+			}
+		}
+	}
+	if filtersOverride != nil {
+		filtersExpr = filtersOverride
+	}
+	if m, ok := filtersExpr.(*ast.CompositeLit); ok {
+		for _, f := range m.Elts {
+			pair, ok := f.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			name, ok := stringLit([]ast.Expr{pair.Key}, 0)
+			if !ok {
+				continue
+			}
+			filters[name] = schema{"type": "string", "description": "Exact-match filter"}
+			if call, ok := pair.Value.(*ast.CallExpr); ok {
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+					switch sel.Sel.Name {
+					case "Uint":
+						filters[name] = schema{"type": "integer", "minimum": 0, "description": "Exact-match filter"}
+					case "Bool":
+						filters[name] = schema{"type": "boolean", "description": "Exact-match filter"}
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(sorts)
+	return sorts, filters
+}
+
+// resolveOptions finds the literal an options expression stands for, and
+// any map later assigned to its Filters.
+func (g *generator) resolveOptions(e ast.Expr, sc *scope, depth int) (*ast.CompositeLit, ast.Expr) {
+	if depth > 5 || sc == nil {
+		return nil, nil
+	}
+	switch v := e.(type) {
+	case *ast.CompositeLit:
+		return v, nil
+	case *ast.Ident:
+		var override ast.Expr
+		if sc.fn != nil {
+			override = filtersAssignment(sc.fn, v.Name)
+		}
+		if val, ok := sc.values[v.Name]; ok {
+			lit, inner := g.resolveOptions(val, sc, depth+1)
+			if override == nil {
+				override = inner
+			}
+			return lit, override
+		}
+		if arg, ok := sc.args[v.Name]; ok {
+			lit, inner := g.resolveOptions(arg, sc.caller, depth+1)
+			if override == nil {
+				override = inner
+			}
+			return lit, override
+		}
+		if val, ok := g.pkgs[sc.pkg].vars[v.Name]; ok {
+			lit, _ := val.(*ast.CompositeLit)
+			return lit, override
+		}
+	}
+	return nil, nil
+}
+
+// filtersAssignment finds `name.Filters = ...` in fd.
+func filtersAssignment(fd *ast.FuncDecl, name string) ast.Expr {
+	var out ast.Expr
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !ok || as.Tok != token.ASSIGN {
+			return true
+		}
+		for i, lhs := range as.Lhs {
+			sel, ok := lhs.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Filters" || i >= len(as.Rhs) {
+				continue
+			}
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == name {
+				out = as.Rhs[i]
+			}
+		}
+		return true
+	})
+	return out
+}
@@ -0,0 +1,257 @@
+// Command openapi writes the OpenAPI description of the HTTP API. It walks
+// the routes the server registers and reads each handler's source: its doc
+// comment, the struct it binds the request body to, the query parameters it
+// reads and the bodies it responds with, so request and response types stay
+// the single source of truth.
+//
+//	go generate ./internal/apidoc
+//	go run ./cmd/openapi -o internal/apidoc/openapi.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/routes"
+)
+
+// handlerPrefix is how gin names handlers declared in the controllers
+// package.
+const handlerPrefix = "ma3_tracker/internal/controllers."
+
+func main() {
+	out := flag.String("o", "openapi.json", "file to write the description to")
+	flag.Parse()
+
+	root, err := moduleRoot()
+	if err != nil {
+		log.Fatal(err)
+	}
+	g := newGenerator()
+	if err := g.load(filepath.Join(root, "internal")); err != nil {
+		log.Fatalf("parse sources: %v", err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	routes.RegisterRoutes(r)
+	doc := g.document(r.Routes())
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		log.Fatalf("encode: %v", err)
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("write %s: %v", *out, err)
+	}
+	fmt.Printf("wrote %d operations to %s\n", g.operations, *out)
+}
+
+// moduleRoot finds the directory holding go.mod, starting from the working
+// directory, so the command works both from go generate and the repo root.
+func moduleRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("go.mod not found above the working directory")
+		}
+		dir = parent
+	}
+}
+
+// pkgSource is what the generator needs from one package's source.
+type pkgSource struct {
+	funcs    map[string]*ast.FuncDecl
+	types    map[string]*ast.TypeSpec
+	typeDocs map[string]string
+	vars     map[string]ast.Expr // Package-level var initializers
+}
+
+type schema = map[string]interface{}
+
+type generator struct {
+	pkgs       map[string]*pkgSource // By package name
+	schemas    map[string]schema     // Components, by name
+	owners     map[string]string     // Component name -> "pkg.Type"
+	operations int
+}
+
+func newGenerator() *generator {
+	return &generator{
+		pkgs:    map[string]*pkgSource{},
+		schemas: map[string]schema{},
+		owners:  map[string]string{},
+	}
+}
+
+// load parses every package under dir.
+func (g *generator) load(dir string) error {
+	fset := token.NewFileSet()
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		parsed, err := parser.ParseDir(fset, path, func(fi fs.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for name, p := range parsed {
+			src := g.pkgs[name]
+			if src == nil {
+				src = &pkgSource{
+					funcs:    map[string]*ast.FuncDecl{},
+					types:    map[string]*ast.TypeSpec{},
+					typeDocs: map[string]string{},
+					vars:     map[string]ast.Expr{},
+				}
+				g.pkgs[name] = src
+			}
+			for _, f := range p.Files {
+				src.add(f)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *pkgSource) add(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				p.funcs[d.Name.Name] = d
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					p.types[s.Name.Name] = s
+					doc := s.Doc
+					if doc == nil && len(d.Specs) == 1 {
+						doc = d.Doc
+					}
+					if doc != nil {
+						p.typeDocs[s.Name.Name] = strings.TrimSpace(doc.Text())
+					}
+				case *ast.ValueSpec:
+					for i, name := range s.Names {
+						if i < len(s.Values) {
+							p.vars[name.Name] = s.Values[i]
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+var pathParam = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+
+// document builds the OpenAPI document for the registered routes.
+func (g *generator) document(infos gin.RoutesInfo) schema {
+	paths := map[string]schema{}
+	tags := map[string]bool{}
+	ids := map[string]int{}
+	for _, info := range infos {
+		path := pathParam.ReplaceAllString(info.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = schema{}
+		}
+		op := g.operation(info)
+		tag := strings.SplitN(strings.TrimPrefix(info.Path, "/"), "/", 2)[0]
+		if tag == "" {
+			tag = "root"
+		}
+		tags[tag] = true
+		op["tags"] = []string{tag}
+
+		id := strings.TrimPrefix(info.Handler, handlerPrefix)
+		if i := strings.LastIndex(id, "/"); i >= 0 {
+			id = id[i+1:]
+		}
+		id = strings.NewReplacer(".", "_", "-", "_").Replace(id)
+		if ids[id]++; ids[id] > 1 {
+			id = fmt.Sprintf("%s_%d", id, ids[id])
+		}
+		op["operationId"] = id
+		paths[path][strings.ToLower(info.Method)] = op
+		g.operations++
+	}
+
+	tagList := make([]schema, 0, len(tags))
+	for _, name := range sortedKeys(tags) {
+		tagList = append(tagList, schema{"name": name})
+	}
+	g.schemas["Error"] = schema{
+		"type": "object",
+		"properties": schema{"error": schema{
+			"type": "object",
+			"properties": schema{
+				"code":       schema{"type": "string", "description": "Stable, machine-readable code, e.g. not_found"},
+				"message":    schema{"type": "string"},
+				"details":    schema{"type": "object", "description": "Data specific to the error, e.g. the fields that failed validation"},
+				"request_id": schema{"type": "string", "description": "The X-Request-ID of the request"},
+			},
+			"required": []string{"code", "message"},
+		}},
+		"required": []string{"error"},
+	}
+	return schema{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":   "Ma3 Tracker API",
+			"version": "1.0",
+			"description": "Generated by cmd/openapi from the routes and handlers. Most endpoints need a bearer token from /auth/login.\n\n" +
+				"Speeds are in m/s, distances in meters and timestamps in RFC 3339 UTC. Every object of a successful JSON response " +
+				"(GraphQL aside) that has any of these also gets a `display` object with them rendered in the units and time zone " +
+				"asked for with the units, distance_units and tz query parameters or the X-Units, X-Distance-Units and X-Timezone " +
+				"headers, whatever the size of the response.",
+		},
+		"servers": []schema{{"url": "/"}},
+		"tags":    tagList,
+		"paths":   paths,
+		"components": schema{
+			"schemas":    g.schemas,
+			"parameters": pagingParameters,
+			"securitySchemes": schema{
+				"bearerAuth": schema{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []schema{{"bearerAuth": []string{}}, {}},
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var basicSchemas = map[string]schema{
+	"string":  {"type": "string"},
+	"bool":    {"type": "boolean"},
+	"int":     {"type": "integer"},
+	"int8":    {"type": "integer"},
+	"int16":   {"type": "integer"},
+	"int32":   {"type": "integer", "format": "int32"},
+	"int64":   {"type": "integer", "format": "int64"},
+	"uint":    {"type": "integer", "minimum": 0},
+	"uint8":   {"type": "integer", "minimum": 0},
+	"uint16":  {"type": "integer", "minimum": 0},
+	"uint32":  {"type": "integer", "minimum": 0},
+	"uint64":  {"type": "integer", "minimum": 0},
+	"byte":    {"type": "integer", "minimum": 0},
+	"rune":    {"type": "integer"},
+	"float32": {"type": "number", "format": "float"},
+	"float64": {"type": "number", "format": "double"},
+	"error":   {"type": "string"},
+	"any":     {},
+}
+
+// externalSchemas describes types from outside the module as they encode to
+// JSON.
+var externalSchemas = map[string]schema{
+	"time.Time":       {"type": "string", "format": "date-time"},
+	"time.Duration":   {"type": "integer", "description": "Nanoseconds"},
+	"gin.H":           {"type": "object"},
+	"gorm.DeletedAt":  {"type": "string", "format": "date-time", "nullable": true},
+	"json.RawMessage": {},
+}
+
+func clone(s schema) schema {
+	out := make(schema, len(s))
+	for k, v := range s {
+		out[k] = v
+	}
+	return out
+}
+
+// typeSchema describes how a value of the type expr, written in package pkg,
+// encodes to JSON. Named module types become components.
+func (g *generator) typeSchema(pkg string, expr ast.Expr) schema {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if s, ok := basicSchemas[e.Name]; ok {
+			return clone(s)
+		}
+		if src := g.pkgs[pkg]; src != nil && src.types[e.Name] != nil {
+			return g.ref(pkg, e.Name)
+		}
+	case *ast.SelectorExpr:
+		q, ok := e.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		if s, ok := externalSchemas[q.Name+"."+e.Sel.Name]; ok {
+			return clone(s)
+		}
+		if src := g.pkgs[q.Name]; src != nil && src.types[e.Sel.Name] != nil {
+			return g.ref(q.Name, e.Sel.Name)
+		}
+	case *ast.StarExpr:
+		s := g.typeSchema(pkg, e.X)
+		if _, isRef := s["$ref"]; !isRef && len(s) > 0 {
+			s["nullable"] = true
+		}
+		return s
+	case *ast.ArrayType:
+		if id, ok := e.Elt.(*ast.Ident); ok && id.Name == "byte" && e.Len == nil {
+			return schema{"type": "string", "format": "byte"}
+		}
+		return schema{"type": "array", "items": g.typeSchema(pkg, e.Elt)}
+	case *ast.MapType:
+		return schema{"type": "object", "additionalProperties": g.typeSchema(pkg, e.Value)}
+	case *ast.StructType:
+		return g.structSchema(pkg, e)
+	}
+	return schema{}
+}
+
+// ref returns a reference to the component for pkg.name, generating it the
+// first time. Names are qualified only when two packages share one.
+func (g *generator) ref(pkg, name string) schema {
+	owner := pkg + "." + name
+	key := name
+	if o, taken := g.owners[key]; taken && o != owner {
+		key = pkg + "." + name
+	}
+	if _, done := g.owners[key]; !done {
+		g.owners[key] = owner
+		g.schemas[key] = schema{} // Placeholder for recursive types
+		spec := g.pkgs[pkg].types[name]
+		s := g.typeSchema(pkg, spec.Type)
+		if doc := g.pkgs[pkg].typeDocs[name]; doc != "" {
+			s["description"] = doc
+		}
+		g.schemas[key] = s
+	}
+	return schema{"$ref": "#/components/schemas/" + key}
+}
+
+// structSchema describes a struct by its exported fields and json tags.
+// Fields tagged binding:"required" are required.
+func (g *generator) structSchema(pkg string, st *ast.StructType) schema {
+	props := schema{}
+	var required []string
+	for _, f := range st.Fields.List {
+		tag := reflect.StructTag("")
+		if f.Tag != nil {
+			if raw, err := strconv.Unquote(f.Tag.Value); err == nil {
+				tag = reflect.StructTag(raw)
+			}
+		}
+		jsonName, jsonOpts, _ := strings.Cut(tag.Get("json"), ",")
+		if jsonName == "-" && jsonOpts == "" {
+			continue
+		}
+		isRequired := strings.Contains(tag.Get("binding"), "required")
+
+		if len(f.Names) == 0 && jsonName == "" {
+			// Embedded: its fields are promoted.
+			for name, s := range g.embeddedFields(pkg, f.Type) {
+				props[name] = s
+			}
+			continue
+		}
+		names := []string{}
+		for _, n := range f.Names {
+			if ast.IsExported(n.Name) {
+				names = append(names, n.Name)
+			}
+		}
+		if len(f.Names) == 0 {
+			names = []string{jsonName}
+		}
+		for _, n := range names {
+			name := n
+			if jsonName != "" {
+				name = jsonName
+			}
+			s := g.typeSchema(pkg, f.Type)
+			if strings.Contains(jsonOpts, "string") {
+				s = schema{"type": "string"}
+			}
+			if _, isRef := s["$ref"]; !isRef {
+				if doc := fieldDoc(f); doc != "" {
+					s["description"] = doc
+				}
+			}
+			props[name] = s
+			if isRequired {
+				required = append(required, name)
+			}
+		}
+	}
+	s := schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// embeddedFields returns the properties an embedded type promotes.
+func (g *generator) embeddedFields(pkg string, expr ast.Expr) schema {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		if q, ok := sel.X.(*ast.Ident); ok && q.Name == "gorm" && sel.Sel.Name == "Model" {
+			return schema{
+				"ID":        schema{"type": "integer", "minimum": 0},
+				"CreatedAt": schema{"type": "string", "format": "date-time"},
+				"UpdatedAt": schema{"type": "string", "format": "date-time"},
+				"DeletedAt": schema{"type": "string", "format": "date-time", "nullable": true},
+			}
+		}
+	}
+	owner, name := pkg, ""
+	switch e := expr.(type) {
+	case *ast.Ident:
+		name = e.Name
+	case *ast.SelectorExpr:
+		if q, ok := e.X.(*ast.Ident); ok {
+			owner, name = q.Name, e.Sel.Name
+		}
+	}
+	if src := g.pkgs[owner]; src != nil && src.types[name] != nil {
+		if st, ok := src.types[name].Type.(*ast.StructType); ok {
+			if props, ok := g.structSchema(owner, st)["properties"].(schema); ok {
+				return props
+			}
+		}
+	}
+	return schema{}
+}
+
+func fieldDoc(f *ast.Field) string {
+	for _, cg := range []*ast.CommentGroup{f.Doc, f.Comment} {
+		if cg != nil {
+			return strings.TrimSpace(strings.Join(strings.Fields(cg.Text()), " "))
+		}
+	}
+	return ""
+}
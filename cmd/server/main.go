@@ -1,38 +1,197 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"ma3_tracker/internal/attribution"
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/compliance"
 	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/controllers"
+	"ma3_tracker/internal/downsample"
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/exports"
+	"ma3_tracker/internal/grpcapi"
+	"ma3_tracker/internal/grpcapi/locationsv1"
+	"ma3_tracker/internal/incidents"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/journeys"
 	"ma3_tracker/internal/logger"
 	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/payments"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/pseudonym"
+	"ma3_tracker/internal/relief"
+	"ma3_tracker/internal/routeinfer"
 	"ma3_tracker/internal/routes"
+	"ma3_tracker/internal/storage"
+	"ma3_tracker/internal/trips"
 
 	"github.com/gin-gonic/gin"
-//ginlog "github.com/gin-contrib/logger"
+	"google.golang.org/grpc"
 )
 
 func main() {
 	// Initialize structured logging to file
 	logger.Setup()
 
+	// Private media is only served through signed URLs
+	if err := storage.CheckSigningKey(); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+	// Journey receipts and QR tickets are signed
+	if err := journeys.CheckSigningKey(); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
 	// Connect to the database
 	config.InitDB()
 
+	// Delivery channels for bulk messages, alerts and notices. Registered
+	// before any worker or ticker starts, so none runs without them.
+	notify.Register(controllers.DriverWebSocketChannel{})
+	notify.RegisterSMSFromEnv()
+	notify.RegisterPushFromEnv()
+
+	// Share location broadcasts with other replicas when a bus is configured;
+	// the sweeps below publish through it too
+	if err := controllers.ConnectLocationHub(); err != nil {
+		log.Fatalf("Failed to connect location hub: %v", err)
+	}
+
+	// Run queued background jobs, such as exports, in this process too
+	jobs.Start(config.EnvInt("JOB_WORKERS", 2), config.EnvDuration("JOB_POLL_INTERVAL", 5*time.Second))
+
+	// Recover interrupted exports and purge expired results
+	exports.StartCleanup(config.EnvDuration("EXPORT_CLEANUP_INTERVAL", time.Hour))
+
+	// Build last week's coaching digests once the week closes
+	driving.StartWeeklyDigests(config.EnvDuration("COACHING_DIGEST_INTERVAL", time.Hour))
+
+	// Derive driving events from tracker uploads once attributed to a driver
+	driving.StartTelemetryAnalysis(config.EnvDuration("TELEMETRY_ANALYSIS_INTERVAL", 5*time.Minute))
+
+	// Close speed violations for vehicles that stopped reporting
+	driving.StartViolationSweep(time.Minute, controllers.PublishSpeedAlert)
+
+	// Close route deviations for vehicles that stopped reporting
+	driving.StartDeviationSweep(time.Minute, controllers.PublishDeviationAlert)
+
+	// Close trips whose vehicle stopped reporting
+	trips.StartIdleClosure(config.EnvDuration("TRIP_IDLE_CHECK_INTERVAL", time.Minute))
+
+	// Score route adherence for trips as they complete
+	trips.StartScoring(config.EnvDuration("ADHERENCE_SCORING_INTERVAL", 15*time.Minute))
+
+	// Detect trips in location history and store their summaries
+	trips.StartSummaries(config.EnvDuration("TRIP_SUMMARY_INTERVAL", 15*time.Minute))
+
+	// Propose geometry for routes that only have stages
+	routeinfer.StartInference(config.EnvDuration("ROUTE_INFERENCE_INTERVAL", 6*time.Hour))
+
+	// Return vehicles to their regular drivers when relief sessions expire
+	relief.StartExpiry(config.EnvDuration("RELIEF_EXPIRY_INTERVAL", time.Minute))
+
+	// Raise hazard and congestion incidents from the GPS stream for review
+	incidents.StartDetection(config.EnvDuration("INCIDENT_DETECTION_INTERVAL", 5*time.Minute))
+
+	// Flag or suspend vehicles whose compliance documents have expired
+	compliance.StartChecks(config.EnvDuration("COMPLIANCE_CHECK_INTERVAL", time.Hour))
+
+	// Drop expired principals from the authorization cache
+	principal.StartSweep(config.EnvDuration("PRINCIPAL_CACHE_SWEEP_INTERVAL", time.Minute))
+
+	// Destroy pseudonym keys once re-identification is no longer permitted
+	pseudonym.StartRetention(config.EnvDuration("PSEUDONYM_RETENTION_INTERVAL", 24*time.Hour))
+
+	// Attribute location points reported while a vehicle or driver was unassigned
+	attribution.StartReconciliation(config.EnvDuration("ATTRIBUTION_RECONCILE_INTERVAL", 15*time.Minute))
+
+	// Thin aged location history down to a lower resolution
+	downsample.StartDownsampling(config.EnvDuration("LOCATION_DOWNSAMPLE_INTERVAL", 6*time.Hour))
+
+	// M-Pesa fare payments, and settling those whose callback never arrived
+	payments.ConfigureFromEnv()
+	payments.StartReconciliation(config.EnvDuration("MPESA_RECONCILE_INTERVAL", time.Minute))
+
+	// Database pool and WebSocket hub statistics on /metrics
+	config.RegisterDBMetrics()
+	controllers.RegisterWebSocketMetrics()
+
 	// Setup Gin router
 	r := routes.SetupRouter()
 
 	// Recovery middleware
 	r.Use(gin.Recovery())
-	
-
-	    // Request logging middleware
-   // r.Use(ginlog.SetLogger())
 
     // Wrap with CORS
 	handler := middleware.EnableCORS(r)
 
-	log.Println("🚀 Server running at :8080")
-	log.Fatal(http.ListenAndServe("0.0.0.0:8080", handler))
+	srv := &http.Server{
+		Addr:    "0.0.0.0:8080",
+		Handler: handler,
+		// Bounds how long a client may take to send request headers
+		ReadHeaderTimeout: config.EnvDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+	}
+	go func() {
+		log.Println("🚀 Server running at :8080")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// gRPC API on its own port, e.g. location streams from fleet hardware;
+	// off unless GRPC_PORT is set, and served over TLS (see grpcapi.Credentials)
+	if port := config.EnvString("GRPC_PORT", ""); port != "" {
+		err := grpcapi.Start(":"+port, func(s *grpc.Server) {
+			locationsv1.RegisterLocationIngestionServer(s, controllers.LocationIngestion{})
+		})
+		if err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+		log.Println("🚀 gRPC server running at :" + port)
+	}
+
+	// Shut down gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop() // A second signal kills the process
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.EnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	// Stop accepting connections and finish in-flight requests
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown: %v", err)
+	}
+	// End location streams the same way, then stop the gRPC server
+	if err := grpcapi.Shutdown(shutdownCtx); err != nil {
+		log.Printf("gRPC shutdown: %v", err)
+	}
+	// Close WebSockets, letting location updates already received be saved
+	if err := controllers.ShutdownLocationHub(shutdownCtx); err != nil {
+		log.Printf("WebSocket shutdown: %v", err)
+	}
+	// Let running jobs finish; those cut short are queued again
+	if err := jobs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Job shutdown: %v", err)
+	}
+	// Stop periodic tasks, letting a run in progress finish
+	if err := background.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Background shutdown: %v", err)
+	}
+	// Write out deprecated endpoint calls counted since the last flush
+	middleware.FlushDeprecatedUsage()
+	if err := config.CloseDB(); err != nil {
+		log.Printf("Closing database: %v", err)
+	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,46 @@
+// Command worker runs queued background jobs without serving HTTP, so job
+// throughput can be scaled apart from the API. Servers started with
+// JOB_WORKERS=0 leave all jobs to it.
+//
+//	JOB_WORKERS=4 go run ./cmd/worker
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/logger"
+
+	// Packages registering job kinds
+	_ "ma3_tracker/internal/exports"
+	_ "ma3_tracker/internal/webhooks"
+)
+
+func main() {
+	logger.Setup()
+	config.InitDB()
+
+	jobs.Start(config.EnvInt("JOB_WORKERS", 4), config.EnvDuration("JOB_POLL_INTERVAL", 5*time.Second))
+	log.Println("Worker running")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop() // A second signal kills the process
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.EnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := jobs.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Job shutdown: %v", err)
+	}
+	if err := config.CloseDB(); err != nil {
+		log.Printf("Closing database: %v", err)
+	}
+	log.Println("Worker stopped")
+}
@@ -0,0 +1,17 @@
+// Package apidoc holds the OpenAPI description of the HTTP API.
+//
+// openapi.json is generated from the routes, the handlers' doc comments and
+// the request and response types they use, so those stay the single source
+// of truth. Regenerate it after changing any of them:
+//
+//	go generate ./internal/apidoc
+package apidoc
+
+import _ "embed"
+
+//go:generate go run ma3_tracker/cmd/openapi -o openapi.json
+
+// Spec is the OpenAPI 3 document describing the API.
+//
+//go:embed openapi.json
+var Spec []byte
@@ -0,0 +1,210 @@
+// Package apierror is the error envelope of the HTTP API. Every error
+// response has the same shape:
+//
+//	{"error": {"code": "vehicle_not_found", "message": "Vehicle not found",
+//	           "details": {...}, "request_id": "3f9c..."}}
+//
+// code is stable and machine-readable, for clients to branch on; message is
+// for people and is translated by middleware.Localize. details, when
+// present, carries data specific to the error, e.g. the fields that failed
+// validation. request_id matches the X-Request-ID header and the server's
+// logs.
+//
+// Handlers respond with Respond for a status and message, or Fail for an
+// error, which From maps to a status and code. The causes of server errors
+// are logged with the request, never sent to the client.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/i18n"
+	"ma3_tracker/internal/logger"
+)
+
+// Error is an error response.
+type Error struct {
+	Status    int                    `json:"-"`
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+
+	cause error // Logged, not sent
+}
+
+// Envelope is the body of error responses.
+type Envelope struct {
+	Error *Error `json:"error"`
+}
+
+// New returns an error responding status with message. Its code is the
+// message's code in the i18n catalog or, for messages missing from it, a
+// code for the status, e.g. "not_found".
+func New(status int, message string) *Error {
+	code, _, ok := i18n.Identify(message)
+	if !ok {
+		code = i18n.StatusCode(status)
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Internal returns a 500 error with message, and cause to be logged.
+func Internal(message string, cause error) *Error {
+	return New(http.StatusInternalServerError, message).Wrap(cause)
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.cause }
+
+// WithCode replaces the error's code.
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetail adds a detail to the error.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Wrap records the error that caused e, for the request log.
+func (e *Error) Wrap(cause error) *Error {
+	e.cause = cause
+	return e
+}
+
+// Field is a request field that failed validation.
+type Field struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// Invalid returns the 400 error for a request body or query that failed to
+// bind, naming the fields at fault.
+func Invalid(err error) *Error {
+	var fields validator.ValidationErrors
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &fields):
+		list := make([]Field, len(fields))
+		msgs := make([]string, len(fields))
+		for i, fe := range fields {
+			list[i] = Field{Field: fe.Field(), Rule: fe.Tag(), Param: fe.Param()}
+			msgs[i] = describe(fe)
+		}
+		return invalid(strings.Join(msgs, "; "), err).WithDetail("fields", list)
+	case errors.As(err, &typ):
+		return invalid(typ.Field+" must be "+typ.Type.String(), err).
+			WithDetail("fields", []Field{{Field: typ.Field, Rule: "type", Param: typ.Type.String()}})
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		return invalid("request body is not valid JSON", err)
+	case errors.Is(err, io.EOF):
+		return invalid("request body is empty", err)
+	}
+	return invalid(err.Error(), err)
+}
+
+func invalid(detail string, cause error) *Error {
+	return New(http.StatusBadRequest, "Invalid input: "+detail).WithCode("invalid_input").Wrap(cause)
+}
+
+// describe words a validation failure.
+func describe(fe validator.FieldError) string {
+	switch {
+	case fe.Tag() == "required":
+		return fe.Field() + " is required"
+	case fe.Param() != "":
+		return fmt.Sprintf("%s failed %s=%s", fe.Field(), fe.Tag(), fe.Param())
+	}
+	return fe.Field() + " failed " + fe.Tag()
+}
+
+// sqlState is implemented by the Postgres drivers' errors.
+type sqlState interface {
+	SQLState() string
+}
+
+// From maps err to the error responded with: *Error values as they are,
+// missing records to 404, unique violations to 409, binding failures to 400
+// and anything else to a 500 that does not reveal it.
+func From(err error) *Error {
+	var e *Error
+	var state sqlState
+	var fields validator.ValidationErrors
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return New(http.StatusNotFound, "Not found").Wrap(err)
+	case errors.As(err, &state) && state.SQLState() == "23505":
+		return New(http.StatusConflict, "Already exists").WithCode("already_exists").Wrap(err)
+	case errors.As(err, &fields), errors.As(err, &syntax), errors.As(err, &typ):
+		return Invalid(err)
+	}
+	return Internal("Internal server error", err)
+}
+
+// Respond ends a request with status and message; see New.
+func Respond(c *gin.Context, status int, message string) {
+	Fail(c, New(status, message))
+}
+
+// Fail ends a request with the error err maps to; see From.
+func Fail(c *gin.Context, err error) {
+	e := prepare(c, err)
+	c.JSON(e.Status, Envelope{e})
+}
+
+// Abort is Respond for middleware: later handlers do not run.
+func Abort(c *gin.Context, status int, message string) {
+	e := prepare(c, New(status, message))
+	c.AbortWithStatusJSON(e.Status, Envelope{e})
+}
+
+// NoRoute answers requests for paths no route matches.
+func NoRoute(c *gin.Context) {
+	Respond(c, http.StatusNotFound, "Not found")
+}
+
+// Recovered answers requests whose handler panicked, for gin.CustomRecovery,
+// which has logged the panic.
+func Recovered(c *gin.Context, recovered interface{}) {
+	e := prepare(c, Internal("Internal server error", fmt.Errorf("panic: %v", recovered)))
+	c.AbortWithStatusJSON(e.Status, Envelope{e})
+}
+
+// prepare maps err and stamps it with the request's ID. The cause is
+// attached to the request, for RequestLog to log.
+func prepare(c *gin.Context, err error) *Error {
+	mapped := From(err)
+	e := *mapped
+	e.RequestID = logger.RequestID(c)
+	if e.cause != nil {
+		c.Error(e.cause)
+	}
+	return &e
+}
@@ -0,0 +1,192 @@
+// Package attribution keeps a history of which driver held which vehicle and
+// uses it to attribute location points. Points from a driver's app are
+// credited to the vehicle they were assigned at the time, and points from a
+// vehicle's tracker to its driver. Points that arrive while nobody is
+// assigned are kept unattributed (0) and filled in by a periodic
+// reconciliation once the history covers them.
+package attribution
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Lookback bounds how far back each reconciliation pass looks for unattributed points.
+var Lookback = config.EnvDuration("ATTRIBUTION_LOOKBACK", 30*24*time.Hour)
+
+// ErrInvalidPeriod is returned for corrections that do not describe a past period.
+var ErrInvalidPeriod = errors.New("correction must end after it starts and not in the future")
+
+// Record starts a new assignment of driverID to the vehicle at at, ending
+// whatever the vehicle and the driver were assigned to before. A driverID of 0
+// only ends the vehicle's current assignment. Call it inside the transaction
+// that changes Vehicle.DriverID.
+func Record(tx *gorm.DB, vehicleID, saccoID, driverID uint, source string, at time.Time) error {
+	end := tx.Model(&models.VehicleAssignment{}).Where("ended_at IS NULL AND vehicle_id = ?", vehicleID)
+	if driverID != 0 {
+		end = tx.Model(&models.VehicleAssignment{}).Where("ended_at IS NULL AND (vehicle_id = ? OR driver_id = ?)", vehicleID, driverID)
+	}
+	if err := end.Update("ended_at", at).Error; err != nil {
+		return err
+	}
+	if driverID == 0 {
+		return nil
+	}
+	return tx.Create(&models.VehicleAssignment{
+		VehicleID: vehicleID,
+		SaccoID:   saccoID,
+		DriverID:  driverID,
+		StartedAt: at,
+		Source:    source,
+	}).Error
+}
+
+// Correct rewrites the vehicle's history so driverID (0 for nobody) held it
+// from from until to. Overlapping assignments of the vehicle, and of the
+// driver on other vehicles, are trimmed around the period. Points the change
+// touches are then re-attributed; the number changed is returned.
+func Correct(db *gorm.DB, vehicleID, saccoID, driverID uint, from, to, now time.Time) (int64, error) {
+	if !to.After(from) || to.After(now) {
+		return 0, ErrInvalidPeriod
+	}
+	vehicles, drivers := []uint{vehicleID}, []uint{}
+	if driverID != 0 {
+		drivers = append(drivers, driverID)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		overlapping := tx.Where("started_at < ? AND (ended_at IS NULL OR ended_at > ?)", to, from)
+		if driverID != 0 {
+			overlapping = overlapping.Where("vehicle_id = ? OR driver_id = ?", vehicleID, driverID)
+		} else {
+			overlapping = overlapping.Where("vehicle_id = ?", vehicleID)
+		}
+		var rows []models.VehicleAssignment
+		if err := overlapping.Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			vehicles, drivers = append(vehicles, row.VehicleID), append(drivers, row.DriverID)
+			if err := tx.Delete(&row).Error; err != nil {
+				return err
+			}
+			// Keep the parts of the row that fall outside the corrected period.
+			if row.StartedAt.Before(from) {
+				head := row
+				head.Model, head.EndedAt = gorm.Model{}, &from
+				if err := tx.Create(&head).Error; err != nil {
+					return err
+				}
+			}
+			if row.EndedAt == nil || row.EndedAt.After(to) {
+				tail := row
+				tail.Model, tail.StartedAt = gorm.Model{}, to
+				if err := tx.Create(&tail).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if driverID == 0 {
+			return nil
+		}
+		return tx.Create(&models.VehicleAssignment{
+			VehicleID: vehicleID,
+			SaccoID:   saccoID,
+			DriverID:  driverID,
+			StartedAt: from,
+			EndedAt:   &to,
+			Source:    models.AssignmentCorrection,
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	scope := db.Where("lh.vehicle_id IN ?", vehicles)
+	if len(drivers) > 0 {
+		scope = db.Where("(lh.vehicle_id IN ? OR lh.driver_id IN ?)", vehicles, drivers)
+	}
+	return reattribute(scope, from, to, false)
+}
+
+// reattribute resolves the derived side of points reported between from and
+// to against the assignment history, limited to the points matching scope's
+// conditions (on alias lh). With onlyMissing set, points that are already
+// attributed are left alone; otherwise they are rewritten to match the
+// history, clearing attributions it no longer supports.
+func reattribute(scope *gorm.DB, from, to time.Time, onlyMissing bool) (int64, error) {
+	var total int64
+	for _, q := range []struct{ source, known, derived string }{
+		{models.LocationSourceDriver, "driver_id", "vehicle_id"},
+		{models.LocationSourceTracker, "vehicle_id", "driver_id"},
+	} {
+		points := scope.Session(&gorm.Session{NewDB: false}).Table("location_histories AS lh").
+			Select("lh.id, COALESCE(va."+q.derived+", 0) AS attributed").
+			Joins(`LEFT JOIN LATERAL (
+				SELECT va.`+q.derived+`
+				FROM vehicle_assignments va
+				WHERE va.`+q.known+` = lh.`+q.known+` AND va.deleted_at IS NULL
+				  AND va.started_at <= lh.timestamp AND (va.ended_at IS NULL OR va.ended_at > lh.timestamp)
+				ORDER BY va.started_at DESC
+				LIMIT 1
+			) va ON true`).
+			Where("lh.source = ? AND lh."+q.known+" <> 0 AND lh.deleted_at IS NULL AND lh.timestamp >= ? AND lh.timestamp < ?", q.source, from, to)
+		if onlyMissing {
+			points = points.Where("lh." + q.derived + " = 0")
+		}
+		res := scope.Session(&gorm.Session{NewDB: true}).Exec(`
+			UPDATE location_histories
+			SET `+q.derived+` = resolved.attributed, updated_at = NOW()
+			FROM (?) AS resolved
+			WHERE location_histories.id = resolved.id AND location_histories.`+q.derived+` <> resolved.attributed`, points)
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+	return total, nil
+}
+
+// seedOpenAssignments opens an assignment for vehicles whose current driver
+// has none, such as vehicles assigned before history was recorded.
+func seedOpenAssignments(db *gorm.DB, now time.Time) (int64, error) {
+	res := db.Exec(`
+		INSERT INTO vehicle_assignments (created_at, updated_at, vehicle_id, sacco_id, driver_id, started_at, source)
+		SELECT $1, $1, v.id, v.sacco_id, v.driver_id, $1, $2
+		FROM vehicles v
+		WHERE v.driver_id <> 0 AND v.deleted_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM vehicle_assignments va
+			WHERE va.vehicle_id = v.id AND va.driver_id = v.driver_id AND va.ended_at IS NULL AND va.deleted_at IS NULL
+		  )`, now, models.AssignmentRegular)
+	return res.RowsAffected, res.Error
+}
+
+// Reconcile seeds missing open assignments and fills in the derived side of
+// unattributed points from the last Lookback.
+func Reconcile(db *gorm.DB, now time.Time) (int64, error) {
+	if seeded, err := seedOpenAssignments(db, now); err != nil {
+		return 0, err
+	} else if seeded > 0 {
+		logrus.Infof("attribution: Opened %d assignments for vehicles without history.", seeded)
+	}
+	return reattribute(db, now.Add(-Lookback), now, true)
+}
+
+// StartReconciliation periodically runs Reconcile against the live database.
+func StartReconciliation(interval time.Duration) {
+	background.Every(interval, func(context.Context) {
+		n, err := Reconcile(config.DB, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("attribution: Reconciliation failed.")
+		} else if n > 0 {
+			logrus.Infof("attribution: Attributed %d location points.", n)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+// Package background runs the server's periodic tasks, such as sweeps and
+// reconciliations, and stops them on shutdown before the database closes.
+package background
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	runCtx, cancelRun = context.WithCancel(context.Background())
+	active            sync.WaitGroup
+)
+
+// Every runs task straight away and then every interval until Shutdown. The
+// context passed to task is cancelled by Shutdown, for tasks that can stop
+// part way. Runs never overlap; a run that overruns the interval delays the
+// next.
+func Every(interval time.Duration, task func(ctx context.Context)) {
+	if runCtx.Err() != nil {
+		return
+	}
+	active.Add(1)
+	go func() {
+		defer active.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for runCtx.Err() == nil {
+			task(runCtx)
+			select {
+			case <-runCtx.Done():
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Shutdown stops the tasks and waits for the running ones to finish, or for
+// ctx to end, in which case ctx's error is returned.
+func Shutdown(ctx context.Context) error {
+	cancelRun()
+	done := make(chan struct{})
+	go func() {
+		active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		logrus.WithError(ctx.Err()).Warn("background: Tasks still running at shutdown.")
+		return ctx.Err()
+	}
+}
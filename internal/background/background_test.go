@@ -0,0 +1,38 @@
+package background
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForRun(t *testing.T) {
+	runCtx, cancelRun = context.WithCancel(context.Background())
+	started := make(chan struct{})
+	var runs, finished atomic.Int32
+	Every(time.Millisecond, func(ctx context.Context) {
+		if runs.Add(1) == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // Finishing up after cancellation
+		finished.Add(1)
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if finished.Load() != 1 {
+		t.Errorf("Shutdown returned with %d of 1 runs finished", finished.Load())
+	}
+
+	Every(time.Millisecond, func(context.Context) { runs.Add(1) })
+	time.Sleep(20 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("%d runs; want 1, none after Shutdown", n)
+	}
+}
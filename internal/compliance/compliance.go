@@ -0,0 +1,198 @@
+// Package compliance tracks vehicle documents (insurance, inspection, PSV
+// license) against their expiry dates, flagging or suspending vehicles whose
+// documents have lapsed and notifying the sacco.
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/webhooks"
+)
+
+// Actions taken when a vehicle's documents expire.
+const (
+	ActionFlag    = "flag"    // Mark the vehicle expired only
+	ActionSuspend = "suspend" // Also take it out of service until renewed
+)
+
+var (
+	// Action is what happens to vehicles with expired documents.
+	Action = config.EnvString("COMPLIANCE_ACTION", ActionFlag)
+	// ReminderWindow is how long before expiry a vehicle is marked expiring.
+	ReminderWindow = config.EnvDuration("COMPLIANCE_REMINDER_WINDOW", 14*24*time.Hour)
+	// NotifyChannels are the notify channels sacco owners are alerted on.
+	NotifyChannels = strings.Split(config.EnvString("COMPLIANCE_NOTIFY_CHANNELS", "sms,push"), ",")
+)
+
+// Types lists the document types that are tracked.
+var Types = []string{models.DocumentInsurance, models.DocumentInspection, models.DocumentPSVLicense}
+
+// ValidType reports whether t is a tracked document type.
+func ValidType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the compliance status of a vehicle holding docs, and the
+// types that are expired or about to expire. Only the latest expiry of each
+// type counts, so a renewal supersedes the lapsed document.
+func Evaluate(docs []models.VehicleDocument, now time.Time) (string, []string) {
+	latest := map[string]time.Time{}
+	for _, d := range docs {
+		if d.ExpiresAt.After(latest[d.Type]) {
+			latest[d.Type] = d.ExpiresAt
+		}
+	}
+	var expired, expiring []string
+	for t, exp := range latest {
+		switch {
+		case !exp.After(now):
+			expired = append(expired, t)
+		case exp.Before(now.Add(ReminderWindow)):
+			expiring = append(expiring, t)
+		}
+	}
+	sort.Strings(expired)
+	sort.Strings(expiring)
+	switch {
+	case len(expired) > 0:
+		return models.ComplianceExpired, expired
+	case len(expiring) > 0:
+		return models.ComplianceExpiring, expiring
+	default:
+		return models.ComplianceOK, nil
+	}
+}
+
+// Refresh re-evaluates the vehicle's documents and stores its compliance
+// status, suspending or restoring service according to Action, and calls the
+// sacco's document_expired webhooks when it becomes expired. It returns the
+// types behind a non-ok status and whether the status changed.
+func Refresh(db *gorm.DB, vehicle *models.Vehicle, now time.Time) ([]string, bool, error) {
+	var docs []models.VehicleDocument
+	if err := db.Where("vehicle_id = ?", vehicle.ID).Find(&docs).Error; err != nil {
+		return nil, false, err
+	}
+	status, types := Evaluate(docs, now)
+
+	updates := map[string]interface{}{}
+	if status != vehicle.ComplianceStatus {
+		updates["compliance_status"] = status
+	}
+	switch {
+	case status == models.ComplianceExpired && Action == ActionSuspend && vehicle.InService:
+		updates["in_service"] = false
+		updates["suspended_for_compliance"] = true
+	case status != models.ComplianceExpired && vehicle.SuspendedForCompliance:
+		// Vehicles that left active service meanwhile stay out of it.
+		updates["in_service"] = vehicle.Status == models.VehicleActive
+		updates["suspended_for_compliance"] = false
+	}
+	if len(updates) == 0 {
+		return types, false, nil
+	}
+	if err := db.Model(vehicle).Updates(updates).Error; err != nil {
+		return nil, false, err
+	}
+	changed := updates["compliance_status"] != nil
+	vehicle.ComplianceStatus = status
+	if changed && status == models.ComplianceExpired {
+		expired := documentExpired{
+			VehicleID:     vehicle.ID,
+			VehicleNo:     vehicle.VehicleNo,
+			Registration:  vehicle.VehicleRegistration,
+			DocumentTypes: types,
+			Suspended:     updates["suspended_for_compliance"] == true,
+		}
+		if err := webhooks.Publish(db, vehicle.SaccoID, models.WebhookDocumentExpired, expired); err != nil {
+			logrus.WithError(err).WithField("vehicle_id", vehicle.ID).Error("compliance: Failed to queue document_expired webhooks.")
+		}
+	}
+	return types, changed, nil
+}
+
+// documentExpired is the payload of document_expired webhooks.
+type documentExpired struct {
+	VehicleID     uint     `json:"vehicle_id"`
+	VehicleNo     string   `json:"vehicle_no"`
+	Registration  string   `json:"registration"`
+	DocumentTypes []string `json:"document_types"`
+	Suspended     bool     `json:"suspended"` // Taken out of service for it
+}
+
+// Check refreshes every vehicle that holds documents or is currently flagged,
+// and sends each sacco one notice listing vehicles that became expiring or
+// expired. Retired vehicles are skipped.
+func Check(db *gorm.DB, now time.Time) error {
+	var vehicles []models.Vehicle
+	err := db.Where("id IN (SELECT DISTINCT vehicle_id FROM vehicle_documents WHERE deleted_at IS NULL) OR compliance_status <> ? OR suspended_for_compliance", models.ComplianceOK).
+		Where("status <> ?", models.VehicleRetired).
+		Find(&vehicles).Error
+	if err != nil {
+		return err
+	}
+
+	notices := map[uint][]string{}
+	for i := range vehicles {
+		v := &vehicles[i]
+		types, changed, err := Refresh(db, v, now)
+		if err != nil {
+			logrus.WithError(err).WithField("vehicle_id", v.ID).Warn("compliance: Failed to refresh vehicle.")
+			continue
+		}
+		if !changed || v.ComplianceStatus == models.ComplianceOK {
+			continue
+		}
+		line := fmt.Sprintf("%s (%s): %s %s", v.VehicleNo, v.VehicleRegistration, strings.Join(types, ", "), v.ComplianceStatus)
+		if v.ComplianceStatus == models.ComplianceExpired && Action == ActionSuspend {
+			line += ", taken out of service"
+		}
+		notices[v.SaccoID] = append(notices[v.SaccoID], line)
+	}
+
+	for saccoID, lines := range notices {
+		if err := notifySacco(db, saccoID, lines); err != nil {
+			logrus.WithError(err).WithField("sacco_id", saccoID).Error("compliance: Failed to notify sacco.")
+		}
+	}
+	return nil
+}
+
+func notifySacco(db *gorm.DB, saccoID uint, lines []string) error {
+	var sacco models.Sacco
+	if err := db.Preload("User").First(&sacco, saccoID).Error; err != nil {
+		return err
+	}
+	phone := sacco.Phone
+	if phone == "" && sacco.User != nil {
+		phone = sacco.User.Phone
+	}
+	body := "Vehicle documents need attention:\n" + strings.Join(lines, "\n")
+	recipients := []notify.Recipient{{UserID: sacco.UserID, Phone: phone}}
+	_, err := notify.Notice(db, saccoID, "sacco_owners", "compliance", "Vehicle compliance alert", body, NotifyChannels, recipients)
+	return err
+}
+
+// StartChecks periodically runs Check against the live database.
+func StartChecks(interval time.Duration) {
+	background.Every(interval, func(context.Context) {
+		if err := Check(config.DB, time.Now()); err != nil {
+			logrus.WithError(err).Error("compliance: Document check failed.")
+		}
+	})
+}
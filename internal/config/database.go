@@ -8,6 +8,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/stops"
 )
 
 var (
@@ -33,10 +34,13 @@ func InitDB() {
 	timezone := getEnv("DB_TIMEZONE", "UTC")
 
 	// Build Data Source Name
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
-		host, user, password, dbname, port, sslmode, timezone,
-	)
+	dsnFor := func(host, port string) string {
+		return fmt.Sprintf(
+			"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
+			host, user, password, dbname, port, sslmode, timezone,
+		)
+	}
+	dsn := dsnFor(host, port)
 
 	// Open GORM connection
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
@@ -44,16 +48,49 @@ func InitDB() {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
 
+	// Route heavy reads to replicas, when there are any
+	if err := useReplicas(db, dsnFor, port); err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+
 	// Enable necessary extensions
 	db.Exec("CREATE EXTENSION IF NOT EXISTS postgis;")
 	db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE;")
 
 	// Auto-migrate your user model (optional but recommended)
-	err = db.AutoMigrate(&models.User{},&models.Driver{},&models.Sacco{},&models.Route{},&models.Vehicle{},&models.Stage{}, &models.LocationHistory{})
+	err = db.AutoMigrate(&models.User{},&models.Driver{},&models.Sacco{},&models.Route{},&models.Vehicle{},&models.Stage{}, &models.LocationHistory{},
+		&models.DeprecatedEndpointUsage{},
+		&models.GuestSession{},
+		&models.CommuterFavorite{},
+		&models.RouteElevationProfile{},
+		&models.ExportJob{},
+		&models.Stop{},
+		&models.StopCrowdingReport{},
+		&models.DrivingEvent{},
+		&models.CoachingDigest{},
+		&models.Tag{},
+		&models.RouteImport{},
+		&models.TripAdherence{},
+		&models.RouteGeometryProposal{},
+		&models.ReliefSession{},
+		&models.CommuterPreference{},
+		&models.BulkMessage{},
+		&models.BulkMessageDelivery{},
+		&models.Incident{},
+		&models.APIKey{},
+		&models.VehicleDocument{},
+		&models.PseudonymKey{},
+		&models.ReidentificationRequest{}, &models.VehicleAssignment{}, &models.Journey{}, &models.JourneySegment{}, &models.JourneyPayment{}, &models.UserInvite{}, &models.VehicleStatusChange{}, &models.SpeedViolation{}, &models.StageEvent{}, &models.CommuterWatch{}, &models.Trip{}, &models.SOSAlert{}, &models.RouteDeviation{}, &models.TripSummary{}, &models.LocationDownsampleRun{}, &models.RouteFare{}, &models.DeviceToken{}, &models.ServiceAlert{}, &models.Feedback{}, &models.VehicleCrowdingReport{}, &models.RouteReview{}, &models.MpesaPayment{}, &models.FareRule{}, &models.PaymentReceipt{}, &models.Ticket{}, &models.Job{}, &models.Webhook{}, &models.WebhookDelivery{},
+	)
 	if err != nil {
 		log.Fatalf("auto-migration failed: %v", err)
 	}
 
+	// Link stages created before shared stops existed
+	if err := stops.Backfill(db); err != nil {
+		log.Fatalf("stop backfill failed: %v", err)
+	}
+
 
 	// Assign to global
 	DB = db
@@ -71,3 +108,16 @@ func getEnv(key, defaultValue string) string {
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// CloseDB closes the connection pool once nothing else will query it, at
+// shutdown.
+func CloseDB() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterDBMetrics exports the database connection pool's statistics on
+// /metrics. Call it after InitDB.
+func RegisterDBMetrics() {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		log.Printf("RegisterDBMetrics: no connection pool to report on: %v", err)
+		return
+	}
+	gauge := func(name, help string, value func(sql.DBStats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help},
+			func() float64 { return value(sqlDB.Stats()) })
+	}
+	counter := func(name, help string, labels prometheus.Labels, value func(sql.DBStats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels},
+			func() float64 { return value(sqlDB.Stats()) })
+	}
+	const closedHelp = "Connections closed by the pool, by reason."
+	collectors := []prometheus.Collector{
+		gauge("db_connections_max_open", "Maximum open database connections, 0 for no limit.",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }),
+		gauge("db_connections_open", "Open database connections.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }),
+		gauge("db_connections_in_use", "Database connections in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }),
+		gauge("db_connections_idle", "Idle database connections.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }),
+		counter("db_connection_waits_total", "Times a query waited for a free connection.", nil,
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }),
+		counter("db_connection_wait_seconds_total", "Time spent waiting for a free connection.", nil,
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }),
+		counter("db_connections_closed_total", closedHelp, prometheus.Labels{"reason": "max_idle"},
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }),
+		counter("db_connections_closed_total", closedHelp, prometheus.Labels{"reason": "max_idle_time"},
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }),
+		counter("db_connections_closed_total", closedHelp, prometheus.Labels{"reason": "max_lifetime"},
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }),
+	}
+	for _, c := range collectors {
+		if err := prometheus.Register(c); err != nil {
+			log.Printf("RegisterDBMetrics: %v", err)
+		}
+	}
+}
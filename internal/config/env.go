@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvString reads a string setting, falling back to defaultValue when unset.
+func EnvString(key, defaultValue string) string {
+	return getEnv(key, defaultValue)
+}
+
+// EnvInt reads an integer setting, falling back to defaultValue when unset or invalid.
+func EnvInt(key string, defaultValue int) int {
+	if v, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return v
+	}
+	return defaultValue
+}
+
+// EnvFloat reads a float setting, falling back to defaultValue when unset or invalid.
+func EnvFloat(key string, defaultValue float64) float64 {
+	if v, err := strconv.ParseFloat(getEnv(key, ""), 64); err == nil {
+		return v
+	}
+	return defaultValue
+}
+
+// EnvBool reads a boolean setting, falling back to defaultValue when unset or invalid.
+func EnvBool(key string, defaultValue bool) bool {
+	if v, err := strconv.ParseBool(strings.TrimSpace(getEnv(key, ""))); err == nil {
+		return v
+	}
+	return defaultValue
+}
+
+// EnvDuration reads a Go duration string (e.g. "30s"), falling back to defaultValue when unset or invalid.
+func EnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if v, err := time.ParseDuration(getEnv(key, "")); err == nil {
+		return v
+	}
+	return defaultValue
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// replicaResolver names the resolver configuration holding the read replicas.
+const replicaResolver = "replicas"
+
+var replicasEnabled bool
+
+// useReplicas registers the read replicas listed in DB_REPLICA_HOSTS with
+// db: host or host:port entries, comma-separated, sharing the primary's
+// credentials, database and settings. Nothing goes to them unless asked for
+// with Replica; every other query stays on the primary.
+func useReplicas(db *gorm.DB, dsn func(host, port string) string, defaultPort string) error {
+	var replicas []gorm.Dialector
+	for _, entry := range strings.Split(getEnv("DB_REPLICA_HOSTS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			host, port = entry, defaultPort
+		}
+		replicas = append(replicas, postgres.Open(dsn(host, port)))
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+	err := db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RoundRobinPolicy(),
+	}, replicaResolver))
+	if err != nil {
+		return fmt.Errorf("read replicas: %w", err)
+	}
+	replicasEnabled = true
+	log.Printf("Reading reports, history and public listings from %d replica(s)", len(replicas))
+	return nil
+}
+
+// Replica returns a handle whose reads go to a read replica, for queries
+// that can stand a little replication lag and would otherwise compete with
+// location writes: reports, location history and public listings. Writes
+// through it still go to the primary, but transactions must not be started
+// on it. Without replicas it is DB.
+func Replica() *gorm.DB {
+	if !replicasEnabled {
+		return DB
+	}
+	return DB.Clauses(dbresolver.Use(replicaResolver)).Session(&gorm.Session{})
+}
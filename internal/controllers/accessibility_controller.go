@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// validAccessibility reports whether need is a supported accessibility need.
+// The empty string means no need.
+func validAccessibility(need string) bool {
+	switch need {
+	case "", models.AccessibilityWheelchair, models.AccessibilityLowStep:
+		return true
+	}
+	return false
+}
+
+// commuterAccessibility resolves the accessibility need for a request: an
+// explicit value ("none" clears it) wins, otherwise the signed-in commuter's
+// saved preference applies. It responds with 400 on unknown values.
+func commuterAccessibility(c *gin.Context, requested string) (string, bool) {
+	if requested == "none" {
+		return "", true
+	}
+	if requested != "" {
+		if !validAccessibility(requested) {
+			apierror.Respond(c, http.StatusBadRequest, "accessibility must be wheelchair, low_step or none")
+			return "", false
+		}
+		return requested, true
+	}
+	if role, _ := c.Get("role"); role == middleware.RoleGuest {
+		return "", true
+	}
+	var pref models.CommuterPreference
+	if err := config.DB.Where("user_id = ?", authenticatedUserID(c)).Limit(1).Find(&pref).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Warn("commuterAccessibility: Failed to load commuter preference.")
+	}
+	return pref.Accessibility, true
+}
+
+// routeAccessibilityFilterSQL restricts routes (aliased r) to those with at
+// least one in-service vehicle meeting the need bound to param.
+func routeAccessibilityFilterSQL(param string) string {
+	return `(` + param + `::text = '' OR EXISTS (
+				SELECT 1 FROM vehicles v
+				WHERE v.route_id = r.id AND v.in_service AND v.deleted_at IS NULL AND
+					CASE ` + param + `::text
+						WHEN 'wheelchair' THEN v.amenity_wheelchair
+						WHEN 'low_step' THEN v.amenity_low_step OR v.amenity_wheelchair
+						ELSE true
+					END))`
+}
+
+// accessibilityGap is a stage whose stop does not meet the need.
+type accessibilityGap struct {
+	RouteID uint   `json:"route_id"`
+	StageID uint   `json:"stage_id"`
+	StopID  uint   `json:"stop_id"`
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+}
+
+// accessibilityReport summarises how well a journey's routes meet a need.
+type accessibilityReport struct {
+	Need               string             `json:"need"`
+	AccessibleVehicles int                `json:"accessible_vehicles"`
+	TotalVehicles      int                `json:"total_vehicles"`
+	Gaps               []accessibilityGap `json:"gaps"`
+}
+
+// buildAccessibilityReport counts accessible in-service vehicles on the routes
+// and lists stages whose stops lack the required access.
+func buildAccessibilityReport(routeIDs []uint, need string) *accessibilityReport {
+	report := &accessibilityReport{Need: need, Gaps: []accessibilityGap{}}
+	var vehicles []models.Vehicle
+	config.DB.Where("route_id IN ? AND in_service = ?", routeIDs, true).Find(&vehicles)
+	for _, v := range vehicles {
+		report.TotalVehicles++
+		if v.Amenities.Serves(need) {
+			report.AccessibleVehicles++
+		}
+	}
+
+	var stages []models.Stage
+	config.DB.Preload("Stop").Where("route_id IN ?", routeIDs).Order("route_id, seq").Find(&stages)
+	for _, s := range stages {
+		if s.Stop != nil && s.Stop.Amenities.Serves(need) {
+			continue
+		}
+		reason := "Stop is not step-free"
+		if s.Stop == nil {
+			reason = "Stop accessibility is unknown"
+		}
+		report.Gaps = append(report.Gaps, accessibilityGap{RouteID: s.RouteID, StageID: s.ID, StopID: s.StopID, Name: s.Name, Reason: reason})
+	}
+	return report
+}
+
+// filterAccessibleVehicles keeps the vehicles that meet the need.
+func filterAccessibleVehicles(vehicles []models.Vehicle, need string) []models.Vehicle {
+	if need == "" {
+		return vehicles
+	}
+	out := vehicles[:0]
+	for _, v := range vehicles {
+		if v.Amenities.Serves(need) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// GetCommuterPreferences returns the authenticated commuter's preferences.
+func GetCommuterPreferences(c *gin.Context) {
+	userID := authenticatedUserID(c)
+	pref := models.CommuterPreference{UserID: userID}
+	if err := config.DB.Where("user_id = ?", userID).Limit(1).Find(&pref).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("GetCommuterPreferences: Failed to load preferences.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load preferences")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": pref})
+}
+
+// UpdateCommuterPreferences saves the authenticated commuter's preferences.
+func UpdateCommuterPreferences(c *gin.Context) {
+	var input struct {
+		Accessibility *string `json:"accessibility"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	userID := authenticatedUserID(c)
+	pref := models.CommuterPreference{UserID: userID}
+	if err := config.DB.Where("user_id = ?", userID).Limit(1).Find(&pref).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("UpdateCommuterPreferences: Failed to load preferences.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load preferences")
+		return
+	}
+	if input.Accessibility != nil {
+		need := *input.Accessibility
+		if need == "none" {
+			need = ""
+		}
+		if !validAccessibility(need) {
+			apierror.Respond(c, http.StatusBadRequest, "accessibility must be wheelchair, low_step or none")
+			return
+		}
+		pref.Accessibility = need
+	}
+	if err := config.DB.Save(&pref).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("UpdateCommuterPreferences: Failed to save preferences.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save preferences")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": pref})
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// adherenceRanking is one vehicle's or driver's aggregate adherence.
+type adherenceRanking struct {
+	ID              uint    `json:"id"`
+	Label           string  `json:"label"`
+	Trips           int     `json:"trips"`
+	AvgAdherencePct float64 `json:"avg_adherence_pct"`
+	StagesSkipped   int     `json:"stages_skipped"`
+	Excursions      int     `json:"excursions"`
+	WorstDeviationM float64 `json:"worst_deviation_m"`
+}
+
+// GetAdherenceReport ranks the sacco's vehicles (default) or drivers
+// (?group_by=driver) by mean route adherence over ?from/?to (default 7 days).
+func GetAdherenceReport(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetAdherenceReport")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+
+	var groupCol, labelJoin, labelCol string
+	switch c.DefaultQuery("group_by", "vehicle") {
+	case "vehicle":
+		groupCol, labelJoin, labelCol = "trip_adherences.vehicle_id", "LEFT JOIN vehicles l ON l.id = trip_adherences.vehicle_id", "l.vehicle_registration"
+	case "driver":
+		groupCol, labelJoin, labelCol = "trip_adherences.driver_id", "LEFT JOIN drivers l ON l.id = trip_adherences.driver_id", "l.name"
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "group_by must be vehicle or driver")
+		return
+	}
+
+	var rows []adherenceRanking
+	err := config.Replica().Model(&models.TripAdherence{}).
+		Select(groupCol+" AS id, COALESCE(MAX("+labelCol+"), '') AS label, COUNT(*) AS trips, "+
+			"AVG(trip_adherences.adherence_pct) AS avg_adherence_pct, SUM(trip_adherences.stages_skipped) AS stages_skipped, "+
+			"SUM(trip_adherences.excursions) AS excursions, MAX(trip_adherences.max_deviation_m) AS worst_deviation_m").
+		Joins(labelJoin).
+		Scopes(tenant.SaccoScopeOn("trip_adherences.sacco_id")).Where("trip_adherences.started_at >= ? AND trip_adherences.started_at < ?", from, to).
+		Group(groupCol).
+		Order("avg_adherence_pct DESC").
+		Scan(&rows).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetAdherenceReport: Failed to aggregate adherence.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build adherence report")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows, "from": from, "to": to})
+}
+
+// ListTripAdherence lists scored trips, optionally filtered by ?vehicle_id,
+// ?driver_id or ?route_id, newest first.
+func ListTripAdherence(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListTripAdherence")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	query := config.Replica().Scopes(tenant.SaccoScope).Where("started_at >= ? AND started_at < ?", from, to)
+	for _, f := range []string{"vehicle_id", "driver_id", "route_id"} {
+		if v := c.Query(f); v != "" {
+			query = query.Where(f+" = ?", v)
+		}
+	}
+	var trips []models.TripAdherence
+	if err := query.Order("started_at DESC").Limit(500).Find(&trips).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ListTripAdherence: Failed to list trips.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list trips")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": trips})
+}
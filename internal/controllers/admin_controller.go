@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// ListDeprecatedEndpointUsage reports which clients are still calling deprecated
+// endpoints, grouped by endpoint, so they can be contacted before the sunset date.
+func ListDeprecatedEndpointUsage(c *gin.Context) {
+	var usages []models.DeprecatedEndpointUsage
+	query := config.DB.Order("path ASC, last_seen_at DESC")
+	if path := c.Query("path"); path != "" {
+		query = query.Where("path = ?", path)
+	}
+	if err := query.Find(&usages).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListDeprecatedEndpointUsage: database error fetching usage.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch deprecated endpoint usage")
+		return
+	}
+
+	type endpointReport struct {
+		Method     string                           `json:"method"`
+		Path       string                           `json:"path"`
+		TotalCalls int64                            `json:"total_calls"`
+		Clients    []models.DeprecatedEndpointUsage `json:"clients"`
+	}
+
+	var reports []*endpointReport
+	byEndpoint := make(map[string]*endpointReport)
+	for _, u := range usages {
+		key := u.Method + " " + u.Path
+		report, ok := byEndpoint[key]
+		if !ok {
+			report = &endpointReport{Method: u.Method, Path: u.Path}
+			byEndpoint[key] = report
+			reports = append(reports, report)
+		}
+		report.TotalCalls += u.CallCount
+		report.Clients = append(report.Clients, u)
+	}
+
+	logrus.WithContext(c).Infof("ListDeprecatedEndpointUsage: %d deprecated endpoints still in use.", len(reports))
+	c.JSON(http.StatusOK, gin.H{"data": reports})
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+)
+
+// adminStatsDay is the platform's activity on one day of the stats window.
+type adminStatsDay struct {
+	Date           string `json:"date"`
+	LocationPoints int64  `json:"location_points"`
+	ActiveVehicles int64  `json:"active_vehicles"` // Vehicles that reported a position
+	Trips          int64  `json:"trips"`
+	NewUsers       int64  `json:"new_users"`
+}
+
+// adminStatsRoute is one of the busiest routes in the stats window.
+type adminStatsRoute struct {
+	RouteID    uint    `json:"route_id"`
+	RouteName  string  `json:"route_name"`
+	SaccoID    uint    `json:"sacco_id"`
+	SaccoName  string  `json:"sacco_name"`
+	Trips      int64   `json:"trips"`
+	Vehicles   int64   `json:"vehicles"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// GetAdminStats gathers platform-wide totals and trends for the operations
+// dashboard in one response: users by role, saccos, vehicles by state,
+// location points, active vehicles, trips and sign-ups per day over ?date= or
+// ?range= (as for GetVehicleDistanceReport, default the last 7 days), this
+// replica's WebSocket connections, and the routes with the most trips
+// (?limit=, default 10).
+//
+// Vehicles are reporting when they sent a position within
+// POSITION_STALE_AFTER. Trips are those detected in location history (see
+// trips.Summarize).
+func GetAdminStats(c *gin.Context) {
+	loc := format.FromRequest(c.Request).Location
+	from, to, ok := parseReportDays(c, loc)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 50 {
+		apierror.Respond(c, http.StatusBadRequest, "limit must be between 1 and 50")
+		return
+	}
+	fail := func(err error, what string) {
+		logrus.WithContext(c).WithError(err).Error("GetAdminStats: Failed to load " + what + ".")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build platform statistics")
+	}
+
+	var roles []struct {
+		Role  string
+		Count int64
+	}
+	if err := config.Replica().Model(&models.User{}).Select("role, COUNT(*) AS count").Group("role").Scan(&roles).Error; err != nil {
+		fail(err, "users")
+		return
+	}
+	usersByRole := make(map[string]int64, len(roles))
+	var totalUsers int64
+	for _, r := range roles {
+		usersByRole[r.Role] = r.Count
+		totalUsers += r.Count
+	}
+
+	var saccos int64
+	if err := config.Replica().Model(&models.Sacco{}).Count(&saccos).Error; err != nil {
+		fail(err, "saccos")
+		return
+	}
+
+	var vehicles struct {
+		Total     int64 `json:"total"`
+		Active    int64 `json:"active"`     // Status active
+		InService int64 `json:"in_service"` // Active and operating
+		Reporting int64 `json:"reporting"`  // Sent a position recently
+	}
+	if err := config.Replica().Model(&models.Vehicle{}).
+		Select("COUNT(*) AS total, "+
+			"COUNT(*) FILTER (WHERE status = ?) AS active, "+
+			"COUNT(*) FILTER (WHERE status = ? AND in_service) AS in_service", models.VehicleActive, models.VehicleActive).
+		Scan(&vehicles).Error; err != nil {
+		fail(err, "vehicles")
+		return
+	}
+	if err := config.Replica().Model(&models.LocationHistory{}).
+		Where("vehicle_id <> 0 AND timestamp >= ?", time.Now().Add(-positionStaleAfter)).
+		Distinct("vehicle_id").Count(&vehicles.Reporting).Error; err != nil {
+		fail(err, "reporting vehicles")
+		return
+	}
+
+	// Daily figures, each counted per day in the caller's time zone.
+	type dayCount struct {
+		Day      string
+		Count    int64
+		Vehicles int64
+	}
+	var points, trips, signups []dayCount
+	if err := config.Replica().Raw(`SELECT to_char(timestamp AT TIME ZONE ?, 'YYYY-MM-DD') AS day, COUNT(*) AS count,
+			COUNT(DISTINCT vehicle_id) FILTER (WHERE vehicle_id <> 0) AS vehicles
+		FROM location_histories
+		WHERE timestamp >= ? AND timestamp < ? AND deleted_at IS NULL
+		GROUP BY 1`, loc.String(), from, to).
+		Scan(&points).Error; err != nil {
+		fail(err, "location points")
+		return
+	}
+	if err := config.Replica().Model(&models.TripSummary{}).
+		Select("to_char(started_at AT TIME ZONE ?, 'YYYY-MM-DD') AS day, COUNT(*) AS count", loc.String()).
+		Where("started_at >= ? AND started_at < ?", from, to).
+		Group("1").Scan(&trips).Error; err != nil {
+		fail(err, "trips")
+		return
+	}
+	if err := config.Replica().Model(&models.User{}).
+		Select("to_char(created_at AT TIME ZONE ?, 'YYYY-MM-DD') AS day, COUNT(*) AS count", loc.String()).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("1").Scan(&signups).Error; err != nil {
+		fail(err, "sign-ups")
+		return
+	}
+	var days []adminStatsDay
+	byDay := map[string]*adminStatsDay{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, adminStatsDay{Date: day.Format("2006-01-02")})
+	}
+	for i := range days {
+		byDay[days[i].Date] = &days[i]
+	}
+	var totalPoints, totalTrips int64
+	for _, p := range points {
+		if d := byDay[p.Day]; d != nil {
+			d.LocationPoints, d.ActiveVehicles = p.Count, p.Vehicles
+		}
+		totalPoints += p.Count
+	}
+	for _, t := range trips {
+		if d := byDay[t.Day]; d != nil {
+			d.Trips = t.Count
+		}
+		totalTrips += t.Count
+	}
+	for _, u := range signups {
+		if d := byDay[u.Day]; d != nil {
+			d.NewUsers = u.Count
+		}
+	}
+
+	var topRoutes []adminStatsRoute
+	if err := config.Replica().Model(&models.TripSummary{}).
+		Select("trip_summaries.route_id, routes.name AS route_name, routes.sacco_id, saccos.name AS sacco_name, "+
+			"COUNT(*) AS trips, COUNT(DISTINCT trip_summaries.vehicle_id) AS vehicles, "+
+			"SUM(trip_summaries.distance_m) / 1000 AS distance_km").
+		Joins("JOIN routes ON routes.id = trip_summaries.route_id").
+		Joins("LEFT JOIN saccos ON saccos.id = routes.sacco_id").
+		Where("trip_summaries.started_at >= ? AND trip_summaries.started_at < ?", from, to).
+		Group("trip_summaries.route_id, routes.name, routes.sacco_id, saccos.name").
+		Order("trips DESC, trip_summaries.route_id").
+		Limit(limit).
+		Scan(&topRoutes).Error; err != nil {
+		fail(err, "top routes")
+		return
+	}
+
+	ws := hubMetrics.read(locationHub)
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"users":           gin.H{"total": totalUsers, "by_role": usersByRole},
+			"saccos":          saccos,
+			"vehicles":        vehicles,
+			"location_points": totalPoints,
+			"trips":           totalTrips,
+			"days":            days,
+			"top_routes":      topRoutes,
+			"websocket": gin.H{
+				"connections":         ws.totalConnections,
+				"connections_by_role": ws.connections,
+				"driver_sessions":     ws.drivers,
+				"subscriptions": gin.H{
+					"sacco":    ws.saccoClients,
+					"follower": ws.followers,
+					"area":     ws.areaClients,
+				},
+			},
+		},
+		"from":     from,
+		"to":       to,
+		"timezone": loc.String(),
+	})
+}
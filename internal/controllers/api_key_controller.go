@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// CreateAPIKey issues a key for an external consumer of the public feeds.
+// The key itself is only returned in this response.
+func CreateAPIKey(c *gin.Context) {
+	var input struct {
+		Name         string `json:"name" binding:"required"`
+		Organization string `json:"organization" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+
+	key, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateAPIKey: Failed to generate key.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to generate API key")
+		return
+	}
+	apiKey := models.APIKey{
+		Name:         input.Name,
+		Organization: input.Organization,
+		Prefix:       key[:12],
+		KeyHash:      hash,
+	}
+	if err := config.DB.Create(&apiKey).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateAPIKey: Failed to save key.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"api_key_id": apiKey.ID, "organization": apiKey.Organization}).Info("CreateAPIKey: API key issued.")
+	c.JSON(http.StatusCreated, gin.H{"data": apiKey, "key": key})
+}
+
+// ListAPIKeys returns all issued API keys without their secrets.
+func ListAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := config.DB.Order("created_at DESC").Find(&keys).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListAPIKeys: Failed to load keys.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load API keys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// RevokeAPIKey permanently disables an API key.
+func RevokeAPIKey(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "RevokeAPIKey")
+	if !ok {
+		return
+	}
+	var apiKey models.APIKey
+	if err := config.DB.First(&apiKey, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "API key not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("api_key_id", id).Error("RevokeAPIKey: Failed to load key.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load API key")
+		}
+		return
+	}
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("api_key_id", id).Error("RevokeAPIKey: Failed to revoke key.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to revoke API key")
+			return
+		}
+		apiKey.RevokedAt = &now
+	}
+	logrus.WithContext(c).WithField("api_key_id", id).Info("RevokeAPIKey: API key revoked.")
+	c.JSON(http.StatusOK, gin.H{"data": apiKey})
+}
@@ -10,9 +10,13 @@ import (
     "golang.org/x/crypto/bcrypt"
     "gorm.io/gorm"
 
+    "ma3_tracker/internal/apierror"
     "ma3_tracker/internal/config"
     "ma3_tracker/internal/middleware" // Make sure this import is correct
     "ma3_tracker/internal/models"
+    "ma3_tracker/internal/pagination"
+    "ma3_tracker/internal/principal"
+    "ma3_tracker/internal/storage"
 )
 
 type signupInput struct {
@@ -26,6 +30,10 @@ type signupInput struct {
     DriverPhone   string `json:"driver_phone"`
     LicenseNumber string `json:"license_number"`
     SaccoID       uint   `json:"sacco_id"`
+
+    // Guest conversion: the guest token being upgraded and favorites saved locally on the device
+    GuestToken    string          `json:"guest_token"`
+    Favorites     []favoriteInput `json:"favorites"`
 }
 
 type changePasswordInput struct {
@@ -55,26 +63,26 @@ type updateUserInput struct {
 func SignupUser(c *gin.Context) {
     var input signupInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        apierror.Fail(c, apierror.Invalid(err))
         return
     }
 
     role, err := validateAndNormalizeRole(input.Role)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        apierror.Respond(c, http.StatusBadRequest, err.Error())
         return
     }
     input.Role = role
 
     hashedPassword, err := hashPassword(input.Password)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+        apierror.Respond(c, http.StatusInternalServerError, "could not hash password")
         return
     }
 
     tx := config.DB.Begin()
     if tx.Error != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start transaction"})
+        apierror.Respond(c, http.StatusInternalServerError, "could not start transaction")
         return
     }
 
@@ -82,10 +90,10 @@ func SignupUser(c *gin.Context) {
     if err != nil {
         tx.Rollback()
         if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
-            c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+            apierror.Respond(c, http.StatusConflict, "email already in use")
             return
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create user: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("could not create user", err))
         return
     }
 
@@ -96,21 +104,33 @@ func SignupUser(c *gin.Context) {
             strings.Contains(err.Error(), "sacco with the provided sacco_id does not exist") ||
             strings.Contains(err.Error(), "required for driver role") ||
             strings.Contains(err.Error(), "required for sacco role") {
-            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            apierror.Respond(c, http.StatusBadRequest, err.Error())
         } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create actor record: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("could not create actor record", err))
         }
         return
     }
 
+    if user.Role == "commuter" && (input.GuestToken != "" || len(input.Favorites) > 0) {
+        if err := convertGuestSession(tx, &user, input.GuestToken, input.Favorites); err != nil {
+            tx.Rollback()
+            if errors.Is(err, errInvalidGuestToken) {
+                apierror.Respond(c, http.StatusBadRequest, err.Error())
+            } else {
+                apierror.Fail(c, apierror.Internal("could not convert guest session", err))
+            }
+            return
+        }
+    }
+
     if err := tx.Commit().Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not commit transaction: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("could not commit transaction", err))
         return
     }
 
     token, err := middleware.GenerateToken(user.ID, user.Role)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+        apierror.Respond(c, http.StatusInternalServerError, "could not generate token")
         return
     }
 
@@ -128,7 +148,7 @@ func LoginUser(c *gin.Context) {
         Password string `json:"password" binding:"required"`
     }
     if err := c.ShouldBindJSON(&body); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        apierror.Fail(c, apierror.Invalid(err))
         return
     }
 
@@ -140,21 +160,21 @@ func LoginUser(c *gin.Context) {
 
     if err := query.First(&user).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found or invalid credentials"})
+            apierror.Respond(c, http.StatusUnauthorized, "user not found or invalid credentials")
         } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "database error: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("database error", err))
         }
         return
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)); err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "incorrect password"})
+        apierror.Respond(c, http.StatusUnauthorized, "incorrect password")
         return
     }
 
     token, err := middleware.GenerateToken(user.ID, user.Role)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+        apierror.Respond(c, http.StatusInternalServerError, "could not generate token")
         return
     }
 
@@ -164,7 +184,7 @@ func LoginUser(c *gin.Context) {
         Preload("Driver").
         Preload("Driver.Sacco").
         First(&responseUserWithAssociations).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load user associations for response: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("could not load user associations for response", err))
         return
     }
 
@@ -176,21 +196,37 @@ func LoginUser(c *gin.Context) {
     })
 }
 
+// commuterListOptions are the sorts ListCommuters accepts.
+var commuterListOptions = pagination.Options{
+    Sorts: map[string]string{
+        "id":         "id",
+        "created_at": "created_at",
+        "name":       "name",
+        "email":      "email",
+    },
+    DefaultSort: "id",
+}
+
+// ListCommuters lists users with the role 'commuter' a page at a time.
 func ListCommuters(c *gin.Context) {
     var commuters []models.User
-    if err := config.DB.Where("role = ?", "commuter").Find(&commuters).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing commuters: " + err.Error()})
+    query, ok := includeDeleted(c, "ListCommuters", config.DB.Model(&models.User{}).Where("role = ?", "commuter"), 0)
+    if !ok {
+        return
+    }
+    meta, ok := paginate(c, "ListCommuters", query, commuterListOptions, &commuters)
+    if !ok {
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"data": commuters})
+    c.JSON(http.StatusOK, gin.H{"data": commuters, "pagination": meta})
 }
 
 func GetMyProfile(c *gin.Context) {
     // Retrieve user_id from context, set by the AuthMiddleware
     userIDFloat, ok := c.Get("user_id")
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+        apierror.Respond(c, http.StatusInternalServerError, "User ID not found in context")
         return
     }
     userID := uint(userIDFloat.(float64)) // Assert as float64 then convert to uint
@@ -203,9 +239,9 @@ func GetMyProfile(c *gin.Context) {
         Preload("Driver.Sacco"). // Preload Sacco associated with the Driver
         First(&user).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"}) // This should ideally not happen if token is valid
+            apierror.Respond(c, http.StatusNotFound, "User not found") // This should ideally not happen if token is valid
         } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("Database error", err))
         }
         return
     }
@@ -227,46 +263,47 @@ func ChangePassword(c *gin.Context) {
     // Correctly retrieve user_id from context as float64, then convert to uint
     userIDFloat, ok := c.Get("user_id")
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+        apierror.Respond(c, http.StatusInternalServerError, "User ID not found in context")
         return
     }
     userID := uint(userIDFloat.(float64)) // Assert as float64 then convert to uint
     
     var input changePasswordInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        apierror.Fail(c, apierror.Invalid(err))
         return
     }
 
     var user models.User
     if err := config.DB.First(&user, userID).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            apierror.Respond(c, http.StatusNotFound, "User not found")
         } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("Database error", err))
         }
         return
     }
 
     // Verify old password
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.OldPassword)); err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect old password"})
+        apierror.Respond(c, http.StatusUnauthorized, "Incorrect old password")
         return
     }
 
     // Hash new password
     hashedNewPassword, err := hashPassword(input.NewPassword)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash new password"})
+        apierror.Respond(c, http.StatusInternalServerError, "Could not hash new password")
         return
     }
 
     // Update password in the database
     // FIX: Use hashedNewPassword here
-    if err := config.DB.Model(&user).Update("Password", hashedNewPassword).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update password: " + err.Error()})
+    if err := config.DB.Model(&user).Updates(map[string]interface{}{"password": hashedNewPassword, "must_change_password": false}).Error; err != nil {
+        apierror.Fail(c, apierror.Internal("Could not update password", err))
         return
     }
+    principal.Invalidate(user.ID) // Lifts the password change requirement
 
     c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
@@ -276,7 +313,7 @@ func UpdateUserDetails(c *gin.Context) {
     // Correctly retrieve user_id from context as float64, then convert to uint
     userIDFloat, ok := c.Get("user_id")
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+        apierror.Respond(c, http.StatusInternalServerError, "User ID not found in context")
         return
     }
     userID := uint(userIDFloat.(float64)) // Assert as float64 then convert to uint
@@ -284,20 +321,20 @@ func UpdateUserDetails(c *gin.Context) {
     // Role is already correctly retrieved as string
     role, ok := c.Get("role")
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Role not found in context"})
+        apierror.Respond(c, http.StatusInternalServerError, "Role not found in context")
         return
     }
     userRole := role.(string)
 
     var input updateUserInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        apierror.Fail(c, apierror.Invalid(err))
         return
     }
 
     tx := config.DB.Begin() // Start a transaction for atomicity
     if tx.Error != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+        apierror.Respond(c, http.StatusInternalServerError, "Could not start transaction")
         return
     }
 
@@ -305,9 +342,9 @@ func UpdateUserDetails(c *gin.Context) {
     if err := tx.First(&user, userID).Error; err != nil {
         tx.Rollback()
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            apierror.Respond(c, http.StatusNotFound, "User not found")
         } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("Database error", err))
         }
         return
     }
@@ -324,11 +361,11 @@ func UpdateUserDetails(c *gin.Context) {
         var existingUser models.User
         if err := tx.Where("email = ?", *input.Email).First(&existingUser).Error; err == nil {
             tx.Rollback()
-            c.JSON(http.StatusConflict, gin.H{"error": "New email already in use by another account"})
+            apierror.Respond(c, http.StatusConflict, "New email already in use by another account")
             return
         } else if !errors.Is(err, gorm.ErrRecordNotFound) {
             tx.Rollback()
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking email: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("Database error checking email", err))
             return
         }
         user.Email = *input.Email
@@ -337,10 +374,10 @@ func UpdateUserDetails(c *gin.Context) {
     if err := tx.Save(&user).Error; err != nil {
         tx.Rollback()
         if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" { // Unique constraint violation
-            c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+            apierror.Respond(c, http.StatusConflict, "Email already in use")
             return
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user details: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("Could not update user details", err))
         return
     }
 
@@ -351,9 +388,9 @@ func UpdateUserDetails(c *gin.Context) {
         if err := tx.Where("user_id = ?", userID).First(&sacco).Error; err != nil {
             tx.Rollback()
             if errors.Is(err, gorm.ErrRecordNotFound) {
-                c.JSON(http.StatusNotFound, gin.H{"error": "Sacco record not found for user"})
+                apierror.Respond(c, http.StatusNotFound, "Sacco record not found for user")
             } else {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching sacco: " + err.Error()})
+                apierror.Fail(c, apierror.Internal("Database error fetching sacco", err))
             }
             return
         }
@@ -372,7 +409,7 @@ func UpdateUserDetails(c *gin.Context) {
 
         if err := tx.Save(&sacco).Error; err != nil {
             tx.Rollback()
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update sacco details: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("Could not update sacco details", err))
             return
         }
 
@@ -381,9 +418,9 @@ func UpdateUserDetails(c *gin.Context) {
         if err := tx.Where("user_id = ?", userID).First(&driver).Error; err != nil {
             tx.Rollback()
             if errors.Is(err, gorm.ErrRecordNotFound) {
-                c.JSON(http.StatusNotFound, gin.H{"error": "Driver record not found for user"})
+                apierror.Respond(c, http.StatusNotFound, "Driver record not found for user")
             } else {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching driver: " + err.Error()})
+                apierror.Fail(c, apierror.Internal("Database error fetching driver", err))
             }
             return
         }
@@ -399,9 +436,9 @@ func UpdateUserDetails(c *gin.Context) {
             if result := tx.First(&existingSacco, *input.SaccoID); result.Error != nil {
                 tx.Rollback()
                 if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-                    c.JSON(http.StatusBadRequest, gin.H{"error": "Sacco with the provided sacco_id does not exist"})
+                    apierror.Respond(c, http.StatusBadRequest, "Sacco with the provided sacco_id does not exist")
                 } else {
-                    c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error validating sacco ID: " + result.Error.Error()})
+                    apierror.Fail(c, apierror.Internal("Database error validating sacco ID", result.Error))
                 }
                 return
             }
@@ -410,7 +447,7 @@ func UpdateUserDetails(c *gin.Context) {
 
         if err := tx.Save(&driver).Error; err != nil {
             tx.Rollback()
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update driver details: " + err.Error()})
+            apierror.Fail(c, apierror.Internal("Could not update driver details", err))
             return
         }
     case "commuter":
@@ -418,9 +455,10 @@ func UpdateUserDetails(c *gin.Context) {
     }
 
     if err := tx.Commit().Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not commit transaction: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("Could not commit transaction", err))
         return
     }
+    principal.Invalidate(userID)
 
     // Fetch the updated user with associations for the response
     var updatedUser models.User
@@ -429,7 +467,7 @@ func UpdateUserDetails(c *gin.Context) {
         Preload("Driver").
         Preload("Driver.Sacco").
         First(&updatedUser).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load updated user associations for response: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("Could not load updated user associations for response", err))
         return
     }
 
@@ -540,6 +578,7 @@ func prepareUserResponse(user models.User) gin.H {
         "email":     user.Email,
         "phone":     user.Phone,
         "role":      user.Role,
+        "must_change_password": user.MustChangePassword,
     }
 
     if user.Sacco != nil {
@@ -551,6 +590,7 @@ func prepareUserResponse(user models.User) gin.H {
             "owner":     user.Sacco.Owner,
             "email":     user.Sacco.Email,
             "phone":     user.Sacco.Phone,
+            "photo_url": storage.Default().URL(user.Sacco.PhotoKey),
         }
         responseUser["sacco_id"] = user.Sacco.ID
     }
@@ -563,6 +603,7 @@ func prepareUserResponse(user models.User) gin.H {
             "phone":          user.Driver.Phone,
             "license_number": user.Driver.LicenseNumber,
             "sacco_id":       user.Driver.SaccoID,
+            "photo_url":      storage.Default().URL(user.Driver.PhotoKey),
         }
         // Ensure Driver.Sacco is preloaded correctly before accessing
         // FIX: Change `user.Driver.Sacco != nil` to `user.Driver.Sacco.ID != 0`
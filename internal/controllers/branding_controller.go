@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/storage"
+)
+
+var brandColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// GetSaccoBranding returns the authenticated sacco's branding.
+func GetSaccoBranding(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "GetSaccoBranding")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": publicBranding(*sacco)})
+}
+
+// UpdateSaccoBranding sets the sacco's display name and brand colour.
+func UpdateSaccoBranding(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "UpdateSaccoBranding")
+	if !ok {
+		return
+	}
+	var input struct {
+		DisplayName *string `json:"display_name"`
+		Color       *string `json:"color"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	updates := map[string]interface{}{}
+	if input.DisplayName != nil {
+		updates["brand_display_name"] = strings.TrimSpace(*input.DisplayName)
+	}
+	if input.Color != nil {
+		if *input.Color != "" && !brandColorPattern.MatchString(*input.Color) {
+			apierror.Respond(c, http.StatusBadRequest, "color must be a hex value like #E4002B")
+			return
+		}
+		updates["brand_color"] = strings.ToUpper(*input.Color)
+	}
+	if len(updates) > 0 {
+		if err := config.DB.Model(sacco).Updates(updates).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("UpdateSaccoBranding: Failed to save branding.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to update branding")
+			return
+		}
+		principal.Invalidate(sacco.UserID)
+	}
+	config.DB.First(sacco, sacco.ID)
+	c.JSON(http.StatusOK, gin.H{"data": publicBranding(*sacco)})
+}
+
+// UploadSaccoLogo stores a PNG, JPEG or WebP logo (max 2 MiB) from the "logo" form field.
+func UploadSaccoLogo(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "UploadSaccoLogo")
+	if !ok {
+		return
+	}
+	data, contentType, ext, ok := readUpload(c, logoUpload)
+	if !ok {
+		return
+	}
+	key := fmt.Sprintf("saccos/%d/logo-%d%s", sacco.ID, time.Now().Unix(), ext)
+	if !replaceStoredFile(c, "UploadSaccoLogo", sacco, "brand_logo_key", sacco.Branding.LogoKey, key, data, contentType) {
+		return
+	}
+	principal.Invalidate(sacco.UserID)
+	sacco.Branding.LogoKey = key
+	c.JSON(http.StatusOK, gin.H{"data": publicBranding(*sacco)})
+}
+
+// ServeMedia streams a stored media object. Private keys (exports) require a
+// signature produced by storage.SignedURL.
+func ServeMedia(c *gin.Context) {
+	key, err := storage.CleanKey(c.Param("key"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "Invalid media key")
+		return
+	}
+	if storage.IsPrivate(key) && !storage.VerifySignature(key, c.Query("expires"), c.Query("sig")) {
+		apierror.Respond(c, http.StatusForbidden, "Link is invalid or has expired")
+		return
+	}
+	rc, contentType, err := storage.Default().Open(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Media not found")
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("key", key).Warn("ServeMedia: Failed to open media.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid media key")
+		return
+	}
+	defer rc.Close()
+	if storage.IsPrivate(key) {
+		c.Header("Cache-Control", "private, no-store")
+		c.Header("Content-Disposition", "attachment; filename=\""+path.Base(key)+"\"")
+	} else {
+		c.Header("Cache-Control", "public, max-age=86400")
+	}
+	c.DataFromReader(http.StatusOK, -1, contentType, rc, nil)
+}
+
+// publicBranding fills in fallbacks and the logo URL for API responses.
+func publicBranding(s models.Sacco) models.SaccoBranding {
+	b := s.Branding
+	if b.DisplayName == "" {
+		b.DisplayName = s.Name
+	}
+	b.LogoURL = storage.Default().URL(b.LogoKey)
+	return b
+}
+
+// loadSaccoBranding fetches the public branding of the given saccos keyed by ID.
+func loadSaccoBranding(saccoIDs []uint) map[uint]models.SaccoBranding {
+	out := make(map[uint]models.SaccoBranding)
+	if len(saccoIDs) == 0 {
+		return out
+	}
+	var saccos []models.Sacco
+	if err := config.DB.Select("id", "name", "brand_display_name", "brand_color", "brand_logo_key").
+		Where("id IN ?", saccoIDs).Find(&saccos).Error; err != nil {
+		logrus.WithError(err).Warn("loadSaccoBranding: Failed to load sacco branding.")
+		return out
+	}
+	for _, s := range saccos {
+		out[s.ID] = publicBranding(s)
+	}
+	return out
+}
+
+// attachRouteBranding adds sacco branding to route responses.
+func attachRouteBranding(routes []RouteResponse) {
+	ids := make([]uint, 0, len(routes))
+	for _, r := range routes {
+		ids = append(ids, r.SaccoID)
+	}
+	branding := loadSaccoBranding(ids)
+	for i := range routes {
+		if b, ok := branding[routes[i].SaccoID]; ok {
+			routes[i].Branding = &b
+		}
+	}
+}
+
+// attachVehicleBranding adds sacco branding to vehicles for branded map
+// markers, along with each vehicle's photo.
+func attachVehicleBranding(vehicles []models.Vehicle) {
+	attachVehiclePhotos(vehicles)
+	ids := make([]uint, 0, len(vehicles))
+	for _, v := range vehicles {
+		ids = append(ids, v.SaccoID)
+	}
+	branding := loadSaccoBranding(ids)
+	for i := range vehicles {
+		if b, ok := branding[vehicles[i].SaccoID]; ok {
+			vehicles[i].Branding = &b
+		}
+	}
+}
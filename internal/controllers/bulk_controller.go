@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// errBulkItemsFailed rolls back a bulk transaction when any item failed.
+var errBulkItemsFailed = errors.New("bulk items failed")
+
+// bulkItemResult is the outcome for one row of a bulk request, which may
+// list up to 500 IDs.
+type bulkItemResult struct {
+	ID     uint     `json:"id"`
+	Status string   `json:"status"` // e.g. "updated", "error", or "rolled_back" when another item failed
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (r *bulkItemResult) fail(msg string) {
+	r.Status = "error"
+	r.Errors = append(r.Errors, msg)
+}
+
+// newBulkResults starts a result per ID, failing repeated IDs.
+func newBulkResults(ids []uint) ([]bulkItemResult, map[uint]*bulkItemResult) {
+	results := make([]bulkItemResult, len(ids))
+	byID := make(map[uint]*bulkItemResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		if _, seen := byID[id]; seen {
+			results[i].fail("Listed more than once.")
+			continue
+		}
+		byID[id] = &results[i]
+	}
+	return results, byID
+}
+
+// respondBulk answers a bulk request whose transaction ended with err: the
+// per-item report when it committed or failed on items, 500 otherwise. done
+// is the status of items that went through, e.g. "updated".
+func respondBulk(c *gin.Context, fn, done string, results []bulkItemResult, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"total": len(results), done: len(results), "failed": 0, "items": results})
+	case errors.Is(err, errBulkItemsFailed):
+		failed := 0
+		for i := range results {
+			if results[i].Status == "error" {
+				failed++
+			} else {
+				results[i].Status = "rolled_back"
+			}
+		}
+		apierror.Fail(c, apierror.New(http.StatusUnprocessableEntity,
+			fmt.Sprintf("%d of %d items failed; no changes were made", failed, len(results))).
+			WithCode("bulk_items_failed").
+			WithDetail("total", len(results)).
+			WithDetail(done, 0).
+			WithDetail("failed", failed).
+			WithDetail("items", results))
+	default:
+		logrus.WithContext(c).WithError(err).Error(fn + ": Bulk transaction failed.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to apply bulk changes")
+	}
+}
+
+// BulkUpdateVehicles applies one change to many of the sacco's vehicles in a
+// single transaction. Body: {"ids": [1, 2], "route_id": 3, "in_service":
+// false, "status": "maintenance", "reason": "..."}; at least one of route_id,
+// in_service and status is required. A status change is recorded as with
+// SetVehicleStatus and applied before in_service.
+//
+// Either every vehicle is updated or none is: when any fails, 422 lists the
+// errors per vehicle and the rest are reported "rolled_back".
+func BulkUpdateVehicles(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "BulkUpdateVehicles")
+	if !ok {
+		return
+	}
+	var input struct {
+		IDs       []uint  `json:"ids" binding:"required,min=1,max=500,dive,min=1"`
+		RouteID   *uint   `json:"route_id"`
+		InService *bool   `json:"in_service"`
+		Status    *string `json:"status"`
+		Reason    string  `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.RouteID == nil && input.InService == nil && input.Status == nil {
+		apierror.Respond(c, http.StatusBadRequest, "Nothing to update: set route_id, in_service or status")
+		return
+	}
+	var to string
+	if input.Status != nil {
+		to = strings.ToLower(strings.TrimSpace(*input.Status))
+		if !models.ValidVehicleStatus(to) {
+			apierror.Respond(c, http.StatusBadRequest, "status must be one of active, maintenance, impounded, retired")
+			return
+		}
+	}
+	if input.RouteID != nil {
+		var route models.Route
+		err := config.DB.Select("id").Scopes(tenant.SaccoScope).Where("id = ?", *input.RouteID).First(&route).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusBadRequest, "Assigned route not found or does not belong to this Sacco.")
+			return
+		}
+		if err != nil {
+			logrus.WithContext(c).WithError(err).Error("BulkUpdateVehicles: Failed to load route.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load route")
+			return
+		}
+	}
+
+	results, byID := newBulkResults(input.IDs)
+	changedBy := authenticatedUserID(c)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var vehicles []models.Vehicle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(tenant.SaccoScope).Where("id IN ?", input.IDs).
+			Order("id").Find(&vehicles).Error; err != nil {
+			return err
+		}
+		for i := range vehicles {
+			vehicle := &vehicles[i]
+			result := byID[vehicle.ID]
+			delete(byID, vehicle.ID)
+			if to != "" {
+				change, err := changeVehicleStatus(tx, vehicle, to, input.Reason, changedBy)
+				var conflict *driverConflictError
+				switch {
+				case errors.Is(err, errInvalidTransition):
+					result.fail("Vehicle cannot move from " + vehicle.Status + " to " + to + ".")
+					continue
+				case errors.Is(err, errReliefActive), errors.Is(err, errVehicleRetired), errors.As(err, &conflict):
+					result.fail(err.Error())
+					continue
+				case err != nil:
+					return err
+				}
+				vehicle.Status = change.ToStatus
+				vehicle.InService = to == models.VehicleActive && !vehicle.SuspendedForCompliance
+			}
+			updates := map[string]interface{}{}
+			if input.RouteID != nil {
+				updates["route_id"] = *input.RouteID
+			}
+			if input.InService != nil {
+				if *input.InService {
+					if msg, _ := serviceBlock(*vehicle); msg != "" {
+						result.fail(msg)
+						continue
+					}
+				}
+				updates["in_service"] = *input.InService
+			}
+			if len(updates) > 0 {
+				if err := tx.Model(vehicle).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			result.Status = "updated"
+		}
+		for _, result := range byID {
+			result.fail("Vehicle not found or not assigned to your Sacco.")
+		}
+		for _, r := range results {
+			if r.Status == "error" {
+				return errBulkItemsFailed
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		logrus.WithContext(c).WithField("vehicles", len(results)).Info("BulkUpdateVehicles: Vehicles updated.")
+	}
+	respondBulk(c, "BulkUpdateVehicles", "updated", results, err)
+}
+
+// BulkDeleteRoutes deletes many of the sacco's routes, with their stages, in
+// a single transaction. Body: {"ids": [1, 2]}. As with DeleteRoute the rows
+// are soft-deleted and can be brought back with /sacco/routes/:id/restore.
+//
+// Either every route is deleted or none is: when any is not found, 422 lists
+// the errors per route and the rest are reported "rolled_back".
+func BulkDeleteRoutes(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "BulkDeleteRoutes")
+	if !ok {
+		return
+	}
+	var input struct {
+		IDs []uint `json:"ids" binding:"required,min=1,max=500,dive,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+
+	results, byID := newBulkResults(input.IDs)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var found []uint
+		if err := tx.Model(&models.Route{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(tenant.SaccoScope).Where("id IN ?", input.IDs).
+			Pluck("id", &found).Error; err != nil {
+			return err
+		}
+		for _, id := range found {
+			byID[id].Status = "deleted"
+			delete(byID, id)
+		}
+		for _, result := range byID {
+			result.fail("Route not found or not owned by your Sacco.")
+		}
+		for _, r := range results {
+			if r.Status == "error" {
+				return errBulkItemsFailed
+			}
+		}
+		// Stages go first, as in DeleteRoute, so RestoreRoute finds them
+		// deleted just before their route.
+		if err := tx.Where("route_id IN ?", found).Delete(&models.Stage{}).Error; err != nil {
+			return err
+		}
+		return tx.Scopes(tenant.SaccoScope).Where("id IN ?", found).Delete(&models.Route{}).Error
+	})
+	if err == nil {
+		logrus.WithContext(c).WithField("routes", len(results)).Info("BulkDeleteRoutes: Routes deleted.")
+	}
+	respondBulk(c, "BulkDeleteRoutes", "deleted", results, err)
+}
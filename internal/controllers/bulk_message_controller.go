@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/tenancy"
+	"ma3_tracker/internal/wsproto"
+)
+
+// Cohorts a bulk message can target.
+const (
+	cohortRouteDrivers = "route_drivers"
+	cohortSaccoDrivers = "sacco_drivers"
+	cohortAllDrivers   = "all_drivers"
+	cohortSaccoOwners  = "sacco_owners"
+)
+
+// DriverWebSocketChannel delivers messages to drivers over their live
+// location WebSocket. Offline drivers are reported as unreachable.
+type DriverWebSocketChannel struct{}
+
+// Name identifies the channel.
+func (DriverWebSocketChannel) Name() string { return "websocket" }
+
+// Send writes a "message" event to the driver's connection.
+func (DriverWebSocketChannel) Send(ctx context.Context, r notify.Recipient, m notify.Message) error {
+	if r.DriverID == 0 {
+		return notify.ErrUnreachable
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	online, err := sendToDriver(r.DriverID, wsproto.TypeMessage, gin.H{"type": "message", "message_id": m.ID, "title": m.Title, "body": m.Body})
+	if err != nil {
+		return err
+	}
+	if !online {
+		return notify.ErrUnreachable
+	}
+	return nil
+}
+
+// bulkMessageInput is the body of a bulk send request.
+type bulkMessageInput struct {
+	Cohort struct {
+		Type    string `json:"type" binding:"required"`
+		RouteID uint   `json:"route_id"`
+		SaccoID uint   `json:"sacco_id"`
+		Region  string `json:"region"`
+	} `json:"cohort" binding:"required"`
+	Title    string   `json:"title"`
+	Body     string   `json:"body" binding:"required"`
+	Channels []string `json:"channels" binding:"required,min=1"`
+}
+
+// driverRecipients loads the drivers matched by query as recipients.
+func driverRecipients(query *gorm.DB) ([]notify.Recipient, error) {
+	var drivers []models.Driver
+	if err := query.Preload("User").Find(&drivers).Error; err != nil {
+		return nil, err
+	}
+	out := make([]notify.Recipient, 0, len(drivers))
+	for _, d := range drivers {
+		phone := d.Phone
+		if phone == "" {
+			phone = d.User.Phone
+		}
+		out = append(out, notify.Recipient{UserID: d.UserID, DriverID: d.ID, Phone: phone})
+	}
+	return out, nil
+}
+
+// resolveCohort returns the recipients of a cohort and the filter value it was
+// narrowed by. Saccos can only reach their own drivers; admins anyone.
+func resolveCohort(in bulkMessageInput, tenant *tenancy.Tenant) ([]notify.Recipient, string, error) {
+	switch in.Cohort.Type {
+	case cohortRouteDrivers:
+		var route models.Route
+		if err := tenant.Scoped(config.DB).First(&route, in.Cohort.RouteID).Error; err != nil {
+			return nil, "", errors.New("route not found")
+		}
+		sub := config.DB.Model(&models.Vehicle{}).Select("driver_id").Where("route_id = ? AND driver_id <> 0", route.ID)
+		recipients, err := driverRecipients(config.DB.Where("id IN (?)", sub))
+		return recipients, strconv.FormatUint(uint64(route.ID), 10), err
+	case cohortSaccoDrivers:
+		target := in.Cohort.SaccoID
+		if !tenant.Admin() {
+			target = tenant.SaccoID()
+		}
+		if target == 0 {
+			return nil, "", errors.New("cohort.sacco_id is required")
+		}
+		recipients, err := driverRecipients(tenant.Scoped(config.DB.Where("sacco_id = ?", target)))
+		return recipients, strconv.FormatUint(uint64(target), 10), err
+	case cohortAllDrivers, cohortSaccoOwners:
+		if !tenant.Admin() {
+			return nil, "", errors.New("saccos can only message their own drivers")
+		}
+		if in.Cohort.Type == cohortAllDrivers {
+			recipients, err := driverRecipients(config.DB)
+			return recipients, "", err
+		}
+		query := config.DB.Preload("User")
+		if in.Cohort.Region != "" {
+			query = query.Where("LOWER(region) = LOWER(?)", in.Cohort.Region)
+		}
+		var saccos []models.Sacco
+		if err := query.Find(&saccos).Error; err != nil {
+			return nil, "", err
+		}
+		out := make([]notify.Recipient, 0, len(saccos))
+		for _, s := range saccos {
+			phone := s.Phone
+			if phone == "" && s.User != nil {
+				phone = s.User.Phone
+			}
+			out = append(out, notify.Recipient{UserID: s.UserID, Phone: phone})
+		}
+		return out, in.Cohort.Region, nil
+	default:
+		return nil, "", errors.New("cohort.type must be route_drivers, sacco_drivers, all_drivers or sacco_owners")
+	}
+}
+
+// sendBulkMessage validates the request, records the message and starts
+// delivery in the background, responding 202 with the message.
+func sendBulkMessage(c *gin.Context, fn string, tenant *tenancy.Tenant) {
+	var in bulkMessageInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	seen := map[string]bool{}
+	var channels []string
+	for _, name := range in.Channels {
+		if _, ok := notify.Lookup(name); !ok {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "Unknown or unconfigured channel "+name).WithDetail("available_channels", notify.Names()))
+			return
+		}
+		if !seen[name] {
+			seen[name] = true
+			channels = append(channels, name)
+		}
+	}
+	recipients, filter, err := resolveCohort(in, tenant)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(recipients) == 0 {
+		apierror.Respond(c, http.StatusUnprocessableEntity, "The cohort has no recipients")
+		return
+	}
+
+	bulk := models.BulkMessage{
+		SenderUserID: authenticatedUserID(c),
+		SaccoID:      tenant.SaccoID(),
+		Cohort:       in.Cohort.Type,
+		CohortFilter: filter,
+		Title:        strings.TrimSpace(in.Title),
+		Body:         strings.TrimSpace(in.Body),
+		Channels:     strings.Join(channels, ","),
+		Recipients:   len(recipients),
+		Status:       models.BulkMessageSending,
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&bulk).Error; err != nil {
+			return err
+		}
+		return notify.Queue(tx, bulk, channels, recipients)
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error(fn + ": Failed to save bulk message.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to send message")
+		return
+	}
+	jobs.Wake(config.DB)
+
+	logrus.WithContext(c).WithFields(logrus.Fields{"bulk_message_id": bulk.ID, "cohort": bulk.Cohort, "recipients": bulk.Recipients}).Info(fn + ": Bulk message queued.")
+	c.JSON(http.StatusAccepted, gin.H{"data": bulk})
+}
+
+// deliveryStat is the number of deliveries on a channel with a given outcome.
+type deliveryStat struct {
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	Count   int    `json:"count"`
+}
+
+// respondBulkMessage writes the message with its delivery statistics.
+func respondBulkMessage(c *gin.Context, query *gorm.DB) {
+	var bulk models.BulkMessage
+	if err := query.First(&bulk).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Message not found")
+		} else {
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load message")
+		}
+		return
+	}
+	var stats []deliveryStat
+	config.DB.Model(&models.BulkMessageDelivery{}).
+		Select("channel, status, COUNT(*) AS count").
+		Where("bulk_message_id = ?", bulk.ID).
+		Group("channel, status").Order("channel, status").
+		Scan(&stats)
+	c.JSON(http.StatusOK, gin.H{"data": bulk, "delivery_stats": stats})
+}
+
+// SendAdminBulkMessage lets an admin message any driver or sacco owner cohort.
+func SendAdminBulkMessage(c *gin.Context) {
+	tenant, ok := authenticatedTenant(c, "SendAdminBulkMessage")
+	if !ok {
+		return
+	}
+	sendBulkMessage(c, "SendAdminBulkMessage", tenant)
+}
+
+// ListAdminBulkMessages lists every bulk message, newest first.
+func ListAdminBulkMessages(c *gin.Context) {
+	var messages []models.BulkMessage
+	if err := config.DB.Order("created_at DESC").Limit(200).Find(&messages).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list messages")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": messages})
+}
+
+// GetAdminBulkMessage returns a bulk message with its delivery statistics.
+func GetAdminBulkMessage(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "GetAdminBulkMessage")
+	if !ok {
+		return
+	}
+	respondBulkMessage(c, config.DB.Where("id = ?", id))
+}
+
+// SendSaccoBulkMessage lets a sacco message its own drivers, either all of
+// them or those on one of its routes.
+func SendSaccoBulkMessage(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "SendSaccoBulkMessage")
+	if !ok {
+		return
+	}
+	sendBulkMessage(c, "SendSaccoBulkMessage", tenant)
+}
+
+// ListSaccoBulkMessages lists the sacco's bulk messages, newest first.
+func ListSaccoBulkMessages(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoBulkMessages")
+	if !ok {
+		return
+	}
+	var messages []models.BulkMessage
+	if err := config.DB.Scopes(tenant.SaccoScope).Order("created_at DESC").Limit(200).Find(&messages).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list messages")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": messages})
+}
+
+// GetSaccoBulkMessage returns one of the sacco's bulk messages with delivery statistics.
+func GetSaccoBulkMessage(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "GetSaccoBulkMessage")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "GetSaccoBulkMessage")
+	if !ok {
+		return
+	}
+	respondBulkMessage(c, config.DB.Scopes(tenant.SaccoScope).Where("id = ?", id))
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/wsproto"
+)
+
+// eventMapWindow is how much of the track either side of an event is drawn on its map.
+const eventMapWindow = time.Minute
+
+// drivingShards is how many goroutines look for driving events in incoming
+// fixes. A driver's fixes always go to the same one, in order.
+const drivingShards = 8
+
+// drivingQueueSize bounds the fixes waiting on each shard.
+const drivingQueueSize = 256
+
+// drivingFix is a fix waiting for recordDrivingEvents.
+type drivingFix struct {
+	prev, curr       models.LocationHistory
+	saccoID, routeID uint
+}
+
+var drivingQueues = startDrivingWorkers()
+
+func startDrivingWorkers() []chan drivingFix {
+	queues := make([]chan drivingFix, drivingShards)
+	for i := range queues {
+		queues[i] = make(chan drivingFix, drivingQueueSize)
+		go func(q <-chan drivingFix) {
+			for f := range q {
+				recordDrivingEvents(f.prev, f.curr, f.saccoID, f.routeID)
+			}
+		}(queues[i])
+	}
+	return queues
+}
+
+// queueDrivingEvents hands a fix to recordDrivingEvents on a background
+// goroutine, so saving and broadcasting the location does not wait for it.
+// Fixes are skipped while the driver's shard is backed up.
+func queueDrivingEvents(prev, curr models.LocationHistory, vehicle *models.Vehicle, saccoID uint) {
+	select {
+	case drivingQueues[curr.DriverID%drivingShards] <- drivingFix{prev, curr, saccoID, vehicle.RouteID}:
+	default:
+		logrus.WithField("driver_id", curr.DriverID).Warn("queueDrivingEvents: Queue full, skipping driving analysis of a fix.")
+	}
+}
+
+// recordDrivingEvents stores harsh-driving events between two fixes and
+// notifies the driver over their live WebSocket straight away. The fix also
+// feeds speed-violation tracking against the limit for the route.
+func recordDrivingEvents(prev, curr models.LocationHistory, saccoID, routeID uint) {
+	limit := driving.LimitFor(config.DB, saccoID, routeID)
+	trackSpeeding(curr, saccoID, routeID, limit)
+	events := driving.Detect(prev, curr, limit)
+	if len(events) == 0 {
+		return
+	}
+	for i := range events {
+		events[i].SaccoID = saccoID
+	}
+	if err := config.DB.Create(&events).Error; err != nil {
+		logrus.WithError(err).WithField("driver_id", curr.DriverID).Error("recordDrivingEvents: Failed to save driving events.")
+		return
+	}
+	for _, e := range events {
+		sendToDriver(curr.DriverID, wsproto.TypeCoaching, gin.H{
+			"type":    "coaching_event",
+			"event":   e,
+			"message": coachingMessage(e),
+		})
+	}
+}
+
+func coachingMessage(e models.DrivingEvent) string {
+	switch e.Kind {
+	case models.DrivingEventSpeeding:
+		return fmt.Sprintf("You are doing %.0f km/h. Please slow down below %.0f km/h.", e.Value*3.6, e.Threshold*3.6)
+	case models.DrivingEventHarshBraking:
+		return "Harsh braking detected. Keep a safe distance so you can brake gently."
+	default:
+		return "Harsh acceleration detected. Pull away smoothly for passenger comfort."
+	}
+}
+
+// ListCoachingDigests returns the authenticated driver's weekly digests, with
+// the current and previous week computed afresh. Digests are saved by the
+// weekly job once a week closes, not here.
+func ListCoachingDigests(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "ListCoachingDigests")
+	if !ok {
+		return
+	}
+	var digests []models.CoachingDigest
+	if err := config.DB.Where("driver_id = ?", driver.ID).Order("week_start DESC").Limit(12).Find(&digests).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("ListCoachingDigests: Failed to list digests.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list coaching digests")
+		return
+	}
+	thisWeek := driving.WeekStart(time.Now())
+	for _, week := range []time.Time{thisWeek.AddDate(0, 0, -7), thisWeek} {
+		live, err := driving.ComputeDigest(config.DB, *driver, week)
+		if err != nil {
+			logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("ListCoachingDigests: Failed to build digest.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to build coaching digest")
+			return
+		}
+		digests = mergeLiveDigest(digests, live)
+	}
+
+	unacknowledged := 0
+	for _, d := range digests {
+		if d.ID != 0 && d.AcknowledgedAt == nil && d.WeekStart.Before(thisWeek) {
+			unacknowledged++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": digests, "unacknowledged": unacknowledged})
+}
+
+// mergeLiveDigest puts freshly computed counts over the saved digest for the
+// same week, keeping its ID and acknowledgment, or adds the unsaved digest in
+// order when there is none. The listing stays newest first, at most 12 weeks.
+func mergeLiveDigest(digests []models.CoachingDigest, live models.CoachingDigest) []models.CoachingDigest {
+	for i := range digests {
+		if digests[i].WeekStart.Equal(live.WeekStart) {
+			d := &digests[i]
+			d.SpeedingCount, d.HarshBrakingCount, d.HarshAccelerationCount = live.SpeedingCount, live.HarshBrakingCount, live.HarshAccelerationCount
+			d.MaxSpeed, d.Summary = live.MaxSpeed, live.Summary
+			return digests
+		}
+	}
+	i := sort.Search(len(digests), func(i int) bool { return digests[i].WeekStart.Before(live.WeekStart) })
+	digests = append(digests[:i], append([]models.CoachingDigest{live}, digests[i:]...)...)
+	if len(digests) > 12 {
+		digests = digests[:12]
+	}
+	return digests
+}
+
+// GetCoachingDigest returns one digest with its events, each with a small map
+// of the track around it.
+func GetCoachingDigest(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "GetCoachingDigest")
+	if !ok {
+		return
+	}
+	digest, ok := loadCoachingDigest(c, "GetCoachingDigest", "driver_id = ?", driver.ID)
+	if !ok {
+		return
+	}
+	events, err := coachingEventsWithMaps(digest)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("digest_id", digest.ID).Error("GetCoachingDigest: Failed to load events.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load events")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"digest": digest, "events": events}})
+}
+
+// AcknowledgeCoachingDigest records that the driver reviewed a digest.
+func AcknowledgeCoachingDigest(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "AcknowledgeCoachingDigest")
+	if !ok {
+		return
+	}
+	digest, ok := loadCoachingDigest(c, "AcknowledgeCoachingDigest", "driver_id = ?", driver.ID)
+	if !ok {
+		return
+	}
+	var input struct {
+		Comment string `json:"comment"`
+	}
+	c.ShouldBindJSON(&input) // Body is optional
+
+	if digest.AcknowledgedAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(&digest).Updates(map[string]interface{}{"acknowledged_at": now, "driver_comment": input.Comment}).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("digest_id", digest.ID).Error("AcknowledgeCoachingDigest: Failed to save acknowledgment.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to acknowledge digest")
+			return
+		}
+		digest.AcknowledgedAt, digest.DriverComment = &now, input.Comment
+		logrus.WithContext(c).WithFields(logrus.Fields{"driver_id": driver.ID, "digest_id": digest.ID}).Info("AcknowledgeCoachingDigest: Digest acknowledged.")
+	}
+	c.JSON(http.StatusOK, gin.H{"data": digest})
+}
+
+// ListSaccoCoachingDigests lets a sacco check which drivers reviewed their
+// digest for ?week=YYYY-MM-DD (default: last week).
+func ListSaccoCoachingDigests(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoCoachingDigests")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	week := driving.WeekStart(time.Now()).AddDate(0, 0, -7)
+	if w := c.Query("week"); w != "" {
+		t, err := time.Parse("2006-01-02", w)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "week must be YYYY-MM-DD")
+			return
+		}
+		week = driving.WeekStart(t.Add(12 * time.Hour)) // Midday avoids timezone edge cases
+	}
+
+	var digests []models.CoachingDigest
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("week_start = ?", week).Order("acknowledged_at NULLS FIRST").Find(&digests).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ListSaccoCoachingDigests: Failed to list digests.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list coaching digests")
+		return
+	}
+	acknowledged := 0
+	for _, d := range digests {
+		if d.AcknowledgedAt != nil {
+			acknowledged++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": digests, "week_start": week, "acknowledged": acknowledged, "total": len(digests)})
+}
+
+func loadCoachingDigest(c *gin.Context, fn string, scope string, scopeArg uint) (models.CoachingDigest, bool) {
+	var digest models.CoachingDigest
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return digest, false
+	}
+	if err := config.DB.Where(scope, scopeArg).First(&digest, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Coaching digest not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("digest_id", id).Error(fn + ": Failed to fetch digest.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch coaching digest")
+		}
+		return digest, false
+	}
+	return digest, true
+}
+
+// coachingEventsWithMaps loads the digest's events and attaches a GeoJSON
+// track of the surrounding minute plus a link to view the spot on a map.
+func coachingEventsWithMaps(digest models.CoachingDigest) ([]gin.H, error) {
+	var events []models.DrivingEvent
+	if err := config.DB.Where("driver_id = ? AND occurred_at >= ? AND occurred_at < ?",
+		digest.DriverID, digest.WeekStart, digest.WeekStart.AddDate(0, 0, 7)).
+		Order("occurred_at").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	out := make([]gin.H, 0, len(events))
+	for _, e := range events {
+		var track []models.LocationHistory
+		config.DB.Select("latitude", "longitude").
+			Where("driver_id = ? AND timestamp BETWEEN ? AND ?", e.DriverID, e.OccurredAt.Add(-eventMapWindow), e.OccurredAt.Add(eventMapWindow)).
+			Order("timestamp").Find(&track)
+		coords := make([][2]float64, 0, len(track))
+		for _, p := range track {
+			coords = append(coords, [2]float64{p.Longitude, p.Latitude})
+		}
+		out = append(out, gin.H{
+			"event":   e,
+			"message": coachingMessage(e),
+			"map": gin.H{
+				"center": gin.H{"lat": e.Latitude, "lng": e.Longitude},
+				"track":  gin.H{"type": "LineString", "coordinates": coords},
+				"url":    fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=17/%.6f/%.6f", e.Latitude, e.Longitude, e.Latitude, e.Longitude),
+			},
+		})
+	}
+	return out, nil
+}
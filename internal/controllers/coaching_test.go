@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/testdb"
+)
+
+func TestListCoachingDigestsReadOnly(t *testing.T) {
+	db := testdb.Use(t, &models.User{}, &models.Sacco{}, &models.Driver{}, &models.DrivingEvent{}, &models.CoachingDigest{})
+	principal.InvalidateAll()
+	t.Cleanup(principal.InvalidateAll)
+	for _, r := range []interface{}{
+		&models.User{Model: gorm.Model{ID: 1}, Email: "driver@example.com", Role: "driver"},
+		&models.Driver{Model: gorm.Model{ID: 1}, UserID: 1, SaccoID: 1},
+		&models.DrivingEvent{DriverID: 1, Kind: models.DrivingEventSpeeding, OccurredAt: time.Now(), Speed: 25},
+	} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("create %T: %v", r, err)
+		}
+	}
+	lastWeek := models.CoachingDigest{DriverID: 1, SaccoID: 1, WeekStart: driving.WeekStart(time.Now()).AddDate(0, 0, -7)}
+	if err := db.Create(&lastWeek).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", float64(1))
+		c.Set("role", "driver")
+	})
+	r.GET("/coaching/digests", ListCoachingDigests)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/coaching/digests", nil))
+	var body struct {
+		Data           []models.CoachingDigest `json:"data"`
+		Unacknowledged int                     `json:"unacknowledged"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || len(body.Data) != 2 {
+		t.Fatalf("got %d %s; want this week's and last week's digests", w.Code, w.Body)
+	}
+	if body.Data[0].ID != 0 || body.Data[0].SpeedingCount != 1 || body.Data[1].ID != lastWeek.ID {
+		t.Errorf("digests %+v; want this week's computed ahead of last week's saved one", body.Data)
+	}
+	if body.Unacknowledged != 1 {
+		t.Errorf("unacknowledged = %d; want 1", body.Unacknowledged)
+	}
+	var saved int64
+	db.Model(&models.CoachingDigest{}).Count(&saved)
+	if saved != 1 {
+		t.Errorf("%d digests saved after a GET; want the 1 there was", saved)
+	}
+}
+
+func TestMergeLiveDigestLimit(t *testing.T) {
+	week := driving.WeekStart(time.Now())
+	var digests []models.CoachingDigest
+	for i := 1; i <= 12; i++ {
+		digests = append(digests, models.CoachingDigest{Model: gorm.Model{ID: uint(i)}, WeekStart: week.AddDate(0, 0, -7*i)})
+	}
+	digests = mergeLiveDigest(digests, models.CoachingDigest{WeekStart: week, SpeedingCount: 3})
+	if len(digests) != 12 || digests[0].SpeedingCount != 3 || digests[11].ID != 11 {
+		t.Errorf("merged %d digests, first %+v; want this week first and the oldest dropped", len(digests), digests[0])
+	}
+}
+
+// Messages to a driver may come from any goroutine while the read loop is
+// busy; writeWS must serialise them.
+func TestWriteWSConcurrent(t *testing.T) {
+	const writers, each = 8, 50
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWS(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer useProtocol(conn, encodingJSON)()
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < each; j++ {
+					writeWS(conn, "ack", gin.H{"status": "ok"})
+				}
+			}()
+		}
+		wg.Wait()
+		conn.ReadMessage() // Wait for the client to finish
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for n := 0; n < writers*each; n++ {
+		var env map[string]interface{}
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatalf("message %d: %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/journeys"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+// frequentTripWindow is how far back GetFrequentTrips looks, and
+// frequentTripJourneys how many of the latest journeys in it at most.
+const (
+	frequentTripWindow   = 90 * 24 * time.Hour
+	frequentTripJourneys = 200
+)
+
+// tripHistoryListOptions are the sorts and filters the commuter trip history
+// accepts.
+var tripHistoryListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"completed_at": "completed_at",
+		"started_at":   "created_at",
+	},
+	DefaultSort: "-completed_at",
+	Filters: map[string]pagination.Filter{
+		"route_id": pagination.Uint("id IN (SELECT journey_id FROM journey_segments WHERE route_id = ? AND deleted_at IS NULL)"),
+	},
+}
+
+// ListTrips returns the authenticated commuter's completed journeys, most
+// recent first: the route, stages, vehicle and fare of each ride and what
+// was paid. ?route_id= keeps trips with a ride on that route. The receipt of
+// each is at /commuter/journeys/:journey_id/receipt.
+func ListTrips(c *gin.Context) {
+	userID := authenticatedUserID(c)
+	var list []models.Journey
+	query := config.DB.Model(&models.Journey{}).Where("user_id = ? AND status = ?", userID, models.JourneyCompleted)
+	meta, ok := paginate(c, "ListTrips", query, tripHistoryListOptions, &list, "Segments", "Payments")
+	if !ok {
+		return
+	}
+	trips, err := journeys.History(config.DB, list)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("ListTrips: Failed to describe trips.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load journeys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": trips, "pagination": meta})
+}
+
+// GetFrequentTrips returns the trips the authenticated commuter has made
+// more than once in the last 90 days, most often made first, up to ?limit=
+// (5 by default, at most 20). Each can be booked again with RepeatTrip.
+func GetFrequentTrips(c *gin.Context) {
+	limit := 5
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 20 {
+			apierror.Respond(c, http.StatusBadRequest, "limit must be between 1 and 20")
+			return
+		}
+		limit = n
+	}
+	userID := authenticatedUserID(c)
+	var list []models.Journey
+	err := config.DB.Where("user_id = ? AND status = ? AND created_at > ?", userID, models.JourneyCompleted, time.Now().Add(-frequentTripWindow)).
+		Preload("Segments").
+		Order("created_at DESC").Limit(frequentTripJourneys).Find(&list).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("GetFrequentTrips: Failed to load journeys.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load journeys")
+		return
+	}
+	trips, err := journeys.History(config.DB, list)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("GetFrequentTrips: Failed to describe trips.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load journeys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": journeys.Frequent(trips, limit)})
+}
+
+// RepeatTrip starts a new journey with the same rides as one of the
+// authenticated commuter's earlier journeys. Fares are priced afresh, as
+// they may have changed since.
+func RepeatTrip(c *gin.Context) {
+	previous, ok := loadCommuterJourney(c, "RepeatTrip")
+	if !ok {
+		return
+	}
+	inputs := make([]journeySegmentInput, 0, len(previous.Segments))
+	for _, s := range previous.Segments {
+		inputs = append(inputs, journeySegmentInput{RouteID: s.RouteID, BoardStageID: s.BoardStageID, AlightStageID: s.AlightStageID})
+	}
+	journey, ok := createJourney(c, "RepeatTrip", inputs)
+	if !ok {
+		return
+	}
+	journey.Payments = []models.JourneyPayment{}
+	c.JSON(http.StatusCreated, gin.H{"data": journey})
+}
@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/crowding"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// maxCrowdingReportDistance is how far from the stop a reporter may be.
+var maxCrowdingReportDistance = config.EnvFloat("CROWDING_MAX_REPORT_DISTANCE", 500)
+
+// maxVehicleCrowdingDistance is how far from a vehicle's last position a
+// commuter may be to report on it: about as far as they can see it.
+var maxVehicleCrowdingDistance = config.EnvFloat("CROWDING_VEHICLE_MAX_REPORT_DISTANCE", 200)
+
+// ReportStopCrowding records a commuter's crowding observation for a stop.
+// Body: {"level": 0-4, "lat": -1.28, "lng": 36.82}; the commuter must be near
+// the stop.
+func ReportStopCrowding(c *gin.Context) {
+	stop, ok := loadStop(c, "ReportStopCrowding", "id")
+	if !ok {
+		return
+	}
+	var input struct {
+		Level *int     `json:"level" binding:"required"`
+		Lat   *float64 `json:"lat" binding:"required"`
+		Lng   *float64 `json:"lng" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if *input.Level < models.CrowdingEmpty || *input.Level > models.CrowdingPacked {
+		apierror.Respond(c, http.StatusBadRequest, "level must be between 0 (empty) and 4 (packed)")
+		return
+	}
+	d := geo.Haversine(geo.Point{Lat: *input.Lat, Lng: *input.Lng}, geo.Point{Lat: stop.Lat, Lng: stop.Lng})
+	if d > maxCrowdingReportDistance {
+		apierror.Fail(c, apierror.New(http.StatusUnprocessableEntity, "You must be near the stop to report crowding").WithDetail("distance_m", d))
+		return
+	}
+
+	userID := authenticatedUserID(c)
+	report, err := crowding.Submit(config.DB, userID, stop.ID, *input.Level, time.Now())
+	if errors.Is(err, crowding.ErrCooldown) || errors.Is(err, crowding.ErrHourlyLimit) {
+		logrus.WithContext(c).WithFields(logrus.Fields{"user_id": userID, "stop_id": stop.ID}).Info("ReportStopCrowding: Report refused by limits.")
+		apierror.Respond(c, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("stop_id", stop.ID).Error("ReportStopCrowding: Failed to save report.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save report")
+		return
+	}
+
+	index, _ := crowding.ForStops(config.DB, []uint{stop.ID}, time.Now())
+	resp := gin.H{"report": report}
+	if idx, ok := index[stop.ID]; ok {
+		resp["crowding"] = idx
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": resp})
+}
+
+// attachStopCrowding adds the current crowding index to stop responses.
+func attachStopCrowding(out []stopResponse) {
+	ids := make([]uint, 0, len(out))
+	for _, s := range out {
+		ids = append(ids, s.ID)
+	}
+	index, err := crowding.ForStops(config.DB, ids, time.Now())
+	if err != nil {
+		logrus.WithError(err).Warn("attachStopCrowding: Failed to compute crowding.")
+		return
+	}
+	for i := range out {
+		if idx, ok := index[out[i].ID]; ok {
+			out[i].Crowding = &idx
+		}
+	}
+}
+
+// ReportVehicleCrowding records a commuter's view of how full a vehicle they
+// can see is. Body: {"level": "full" | "standing_room" | "seats_available",
+// "lat": -1.28, "lng": 36.82}; the commuter must be near the vehicle's live
+// position. The vehicle's aggregated crowding is saved and broadcast.
+func ReportVehicleCrowding(c *gin.Context) {
+	vehicleID, ok := parseUintParam(c, "id", "ReportVehicleCrowding")
+	if !ok {
+		return
+	}
+	var input struct {
+		Level string   `json:"level" binding:"required"`
+		Lat   *float64 `json:"lat" binding:"required"`
+		Lng   *float64 `json:"lng" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	level, ok := crowding.VehicleLevel(input.Level)
+	if !ok {
+		apierror.Respond(c, http.StatusBadRequest, "level must be full, standing_room or seats_available")
+		return
+	}
+
+	positions, err := latestPositions("id", vehicleID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicleID).Error("ReportVehicleCrowding: Failed to load position.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save report")
+		return
+	}
+	if len(positions) == 0 || positions[0].Stale {
+		apierror.Respond(c, http.StatusUnprocessableEntity, "This vehicle is not reporting its position right now")
+		return
+	}
+	d := geo.Haversine(geo.Point{Lat: *input.Lat, Lng: *input.Lng}, geo.Point{Lat: positions[0].Latitude, Lng: positions[0].Longitude})
+	if d > maxVehicleCrowdingDistance {
+		apierror.Fail(c, apierror.New(http.StatusUnprocessableEntity, "You must be near the vehicle to report crowding").WithDetail("distance_m", d))
+		return
+	}
+
+	userID := authenticatedUserID(c)
+	now := time.Now()
+	report, err := crowding.SubmitVehicle(config.DB, userID, vehicleID, level, *input.Lat, *input.Lng, now)
+	if errors.Is(err, crowding.ErrVehicleCooldown) || errors.Is(err, crowding.ErrHourlyLimit) {
+		logrus.WithContext(c).WithFields(logrus.Fields{"user_id": userID, "vehicle_id": vehicleID}).Info("ReportVehicleCrowding: Report refused by limits.")
+		apierror.Respond(c, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicleID).Error("ReportVehicleCrowding: Failed to save report.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save report")
+		return
+	}
+
+	vehicle := models.Vehicle{SaccoID: positions[0].SaccoID}
+	vehicle.ID = vehicleID
+	if err := refreshVehicleCrowding(&vehicle, now); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicleID).Error("ReportVehicleCrowding: Failed to update crowding.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update crowding")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{"report": report, "crowding": vehicle.Crowding}})
+}
+
+// refreshVehicleCrowding aggregates the vehicle's recent reports, saves the
+// result on it and broadcasts it to listeners of the vehicle's sacco.
+func refreshVehicleCrowding(vehicle *models.Vehicle, now time.Time) error {
+	index, err := crowding.ForVehicles(config.DB, []uint{vehicle.ID}, now)
+	if err != nil {
+		return err
+	}
+	vehicle.Crowding = index[vehicle.ID]
+	err = config.DB.Model(vehicle).Updates(map[string]interface{}{
+		"crowding_level":      vehicle.Crowding.Level,
+		"crowding_score":      vehicle.Crowding.Score,
+		"crowding_reports":    vehicle.Crowding.Reports,
+		"crowding_updated_at": vehicle.Crowding.UpdatedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	locationHub.PublishLocation(map[string]interface{}{
+		"type":       "crowding",
+		"vehicle_id": vehicle.ID,
+		"sacco_id":   float64(vehicle.SaccoID),
+		"crowding":   vehicle.Crowding,
+		"timestamp":  now.Format(time.RFC3339Nano),
+	})
+	return nil
+}
+
+// currentCrowding marks a vehicle's crowding unknown once its last report
+// is older than crowding.VehicleWindow.
+func currentCrowding(vehicle *models.Vehicle, now time.Time) {
+	if vehicle.Crowding.UpdatedAt == nil || now.Sub(*vehicle.Crowding.UpdatedAt) > crowding.VehicleWindow {
+		vehicle.Crowding = models.VehicleCrowding{Level: models.CrowdingUnknown}
+	}
+}
+
+// routeAllocation is the demand picture for one route used to suggest moves.
+type routeAllocation struct {
+	RouteID       uint    `json:"route_id"`
+	RouteName     string  `json:"route_name"`
+	Vehicles      int     `json:"vehicles_in_service"`
+	CrowdingScore float64 `json:"crowding_score"` // Mean index over reported stops
+	ReportedStops int     `json:"reported_stops"`
+	PressureScore float64 `json:"pressure"` // Crowding per vehicle
+}
+
+type allocationMove struct {
+	FromRouteID uint   `json:"from_route_id"`
+	ToRouteID   uint   `json:"to_route_id"`
+	Vehicles    int    `json:"vehicles"`
+	Reason      string `json:"reason"`
+}
+
+// GetAllocationRecommendations compares stop crowding across the sacco's
+// published routes and suggests moving vehicles from quiet routes to busy ones.
+func GetAllocationRecommendations(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetAllocationRecommendations")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var routes []models.Route
+	if err := config.DB.Preload("Stages").Preload("Vehicles", "in_service = ?", true).
+		Scopes(tenant.SaccoScope).Where("status = ?", models.RouteStatusPublished).
+		Find(&routes).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetAllocationRecommendations: Failed to load routes.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load routes")
+		return
+	}
+
+	var stopIDs []uint
+	for _, r := range routes {
+		for _, s := range r.Stages {
+			stopIDs = append(stopIDs, s.StopID)
+		}
+	}
+	index, err := crowding.ForStops(config.DB, stopIDs, time.Now())
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("GetAllocationRecommendations: Failed to compute crowding.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to compute crowding")
+		return
+	}
+
+	allocations := make([]routeAllocation, 0, len(routes))
+	for _, r := range routes {
+		a := routeAllocation{RouteID: r.ID, RouteName: r.Name, Vehicles: len(r.Vehicles)}
+		var total float64
+		for _, s := range r.Stages {
+			if idx, ok := index[s.StopID]; ok {
+				total += idx.Score
+				a.ReportedStops++
+			}
+		}
+		if a.ReportedStops > 0 {
+			a.CrowdingScore = total / float64(a.ReportedStops)
+		}
+		a.PressureScore = a.CrowdingScore / float64(max(a.Vehicles, 1))
+		allocations = append(allocations, a)
+	}
+	sort.Slice(allocations, func(i, j int) bool { return allocations[i].PressureScore > allocations[j].PressureScore })
+
+	// Pair the busiest routes with the quietest ones that can spare a vehicle.
+	var moves []allocationMove
+	for i, j := 0, len(allocations)-1; i < j; {
+		busy, quiet := allocations[i], allocations[j]
+		if busy.CrowdingScore < 50 || busy.ReportedStops == 0 {
+			break
+		}
+		if quiet.Vehicles <= 1 || quiet.CrowdingScore >= busy.CrowdingScore {
+			j--
+			continue
+		}
+		moves = append(moves, allocationMove{
+			FromRouteID: quiet.RouteID,
+			ToRouteID:   busy.RouteID,
+			Vehicles:    1,
+			Reason:      "Stops on " + busy.RouteName + " are reported crowded while " + quiet.RouteName + " is quiet",
+		})
+		i++
+		j--
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"routes": allocations, "recommendations": moves}})
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+)
+
+// dashboardRoute is one route's activity in the dashboard summary.
+type dashboardRoute struct {
+	RouteID         uint    `json:"route_id"`
+	RouteName       string  `json:"route_name"`
+	Vehicles        int     `json:"vehicles"` // Distinct vehicles active on it
+	Trips           int64   `json:"trips"`
+	TripsPerVehicle float64 `json:"trips_per_vehicle"`
+	DistanceKm      float64 `json:"distance_km"`
+}
+
+// GetDashboardSummary gathers the sacco's fleet utilization over ?date= or
+// ?range= (as for GetVehicleDistanceReport, default the last 7 days) in one
+// response: how many vehicles were active against the fleet size, distance
+// covered, hours in service, trips per vehicle, and the routes with the
+// most and fewest trips (?limit= of each, default 5).
+//
+// Vehicles are active on a day they report a position. Hours in service run
+// from a vehicle's first report of the day to its last. Trips are those
+// detected in location history (see trips.Summarize), credited to the route
+// the vehicle was on; distance is credited to the vehicle's current route.
+func GetDashboardSummary(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetDashboardSummary")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	loc := format.FromRequest(c.Request).Location
+	from, to, ok := parseReportDays(c, loc)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if err != nil || limit < 1 || limit > 50 {
+		apierror.Respond(c, http.StatusBadRequest, "limit must be between 1 and 50")
+		return
+	}
+	fail := func(err error, what string) {
+		logrus.WithError(err).WithField("sacco_id", sacco.ID).Error("GetDashboardSummary: Failed to load " + what + ".")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build dashboard summary")
+	}
+
+	// Vehicles since removed still count towards what was done in the period.
+	var vehicles []models.Vehicle
+	if err := config.Replica().Unscoped().Select("id", "vehicle_no", "route_id", "status", "deleted_at").Scopes(tenant.SaccoScope).Find(&vehicles).Error; err != nil {
+		fail(err, "vehicles")
+		return
+	}
+	fleetSize := 0
+	for _, v := range vehicles {
+		if !v.DeletedAt.Valid && v.Status != models.VehicleRetired {
+			fleetSize++
+		}
+	}
+
+	rows, err := vehicleDistanceRows(vehicles, from, to, loc, "distance_from_last")
+	if err != nil {
+		fail(err, "distance")
+		return
+	}
+	days := vehicleDays(rows, vehicles, loc, time.Now())
+
+	var tripCounts []struct {
+		RouteID   uint
+		VehicleID uint
+		Trips     int64
+	}
+	if err := config.Replica().Model(&models.TripSummary{}).
+		Select("route_id, vehicle_id, COUNT(*) AS trips").
+		Scopes(tenant.SaccoScope).Where("started_at >= ? AND started_at < ?", from, to).
+		Group("route_id, vehicle_id").
+		Scan(&tripCounts).Error; err != nil {
+		fail(err, "trips")
+		return
+	}
+
+	var routes []models.Route
+	if err := config.Replica().Select("id", "name").Scopes(tenant.SaccoScope).Where("status <> ?", models.RouteStatusArchived).Find(&routes).Error; err != nil {
+		fail(err, "routes")
+		return
+	}
+	byRoute := make(map[uint]*dashboardRoute, len(routes))
+	for _, r := range routes {
+		byRoute[r.ID] = &dashboardRoute{RouteID: r.ID, RouteName: r.Name}
+	}
+	routeVehicles := map[uint]map[uint]bool{}
+	markActive := func(routeID, vehicleID uint) *dashboardRoute {
+		r, ok := byRoute[routeID]
+		if !ok {
+			// Archived routes only show up when they were active.
+			r = &dashboardRoute{RouteID: routeID}
+			byRoute[routeID] = r
+		}
+		if routeVehicles[routeID] == nil {
+			routeVehicles[routeID] = map[uint]bool{}
+		}
+		routeVehicles[routeID][vehicleID] = true
+		return r
+	}
+
+	var distanceM, activeS, movingS float64
+	active := map[uint]bool{}
+	for _, d := range days {
+		distanceM += d.DistanceM
+		activeS += d.ActiveS
+		movingS += d.MovingS
+		active[d.VehicleID] = true
+		markActive(d.RouteID, d.VehicleID).DistanceKm += d.DistanceM / 1000
+	}
+	var totalTrips int64
+	for _, t := range tripCounts {
+		totalTrips += t.Trips
+		markActive(t.RouteID, t.VehicleID).Trips += t.Trips
+	}
+
+	ranked := make([]dashboardRoute, 0, len(byRoute))
+	var unnamed []uint
+	for id, r := range byRoute {
+		if id == 0 {
+			continue // Vehicles without a route
+		}
+		r.Vehicles = len(routeVehicles[id])
+		if r.Vehicles > 0 {
+			r.TripsPerVehicle = float64(r.Trips) / float64(r.Vehicles)
+		}
+		if r.RouteName == "" {
+			unnamed = append(unnamed, id)
+		}
+		ranked = append(ranked, *r)
+	}
+	if len(unnamed) > 0 {
+		var archived []models.Route
+		if err := config.Replica().Unscoped().Select("id", "name").Where("id IN ?", unnamed).Find(&archived).Error; err != nil {
+			fail(err, "routes")
+			return
+		}
+		names := make(map[uint]string, len(archived))
+		for _, r := range archived {
+			names[r.ID] = r.Name
+		}
+		for i := range ranked {
+			if name, ok := names[ranked[i].RouteID]; ok {
+				ranked[i].RouteName = name
+			}
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Trips != ranked[j].Trips {
+			return ranked[i].Trips > ranked[j].Trips
+		}
+		if ranked[i].DistanceKm != ranked[j].DistanceKm {
+			return ranked[i].DistanceKm > ranked[j].DistanceKm
+		}
+		return ranked[i].RouteID < ranked[j].RouteID
+	})
+	top := ranked[:min(limit, len(ranked))]
+	bottom := make([]dashboardRoute, 0, limit)
+	for i := len(ranked) - 1; i >= 0 && len(bottom) < limit; i-- {
+		bottom = append(bottom, ranked[i])
+	}
+
+	periodDays := int(to.Sub(from).Hours()/24 + 0.5)
+	var activePct, hoursInService, movingHours, tripsPerVehicle float64
+	if fleetSize > 0 {
+		activePct = 100 * float64(len(active)) / float64(fleetSize)
+	}
+	if len(days) > 0 {
+		// Averaged per vehicle-day, i.e. over the days each vehicle was out.
+		hoursInService = activeS / 3600 / float64(len(days))
+		movingHours = movingS / 3600 / float64(len(days))
+	}
+	if len(active) > 0 {
+		tripsPerVehicle = float64(totalTrips) / float64(len(active))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"fleet": gin.H{
+				"size":               fleetSize,
+				"active_vehicles":    len(active),
+				"active_pct":         activePct,
+				"avg_active_per_day": float64(len(days)) / float64(periodDays),
+			},
+			"distance_km":          distanceM / 1000,
+			"avg_hours_in_service": hoursInService,
+			"avg_moving_hours":     movingHours,
+			"trips":                totalTrips,
+			"trips_per_vehicle":    tripsPerVehicle,
+			"top_routes":           top,
+			"bottom_routes":        bottom,
+		},
+		"from":     from,
+		"to":       to,
+		"days":     periodDays,
+		"timezone": loc.String(),
+	})
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// RegisterDevice records the push notification token of the app install the
+// authenticated user is on. Body: {"token": "...", "platform": "android"}.
+// Apps should register on every launch, as tokens rotate; a token already
+// registered by another account moves to this one.
+func RegisterDevice(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Platform string `json:"platform" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	switch input.Platform {
+	case models.DevicePlatformAndroid, models.DevicePlatformIOS, models.DevicePlatformWeb:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "platform must be android, ios or web")
+		return
+	}
+	token := strings.TrimSpace(input.Token)
+	if token == "" || len(token) > 4096 {
+		apierror.Respond(c, http.StatusBadRequest, "Invalid token")
+		return
+	}
+
+	device := models.DeviceToken{
+		UserID:     authenticatedUserID(c),
+		Token:      token,
+		Platform:   input.Platform,
+		LastSeenAt: time.Now(),
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "last_seen_at", "updated_at"}),
+	}).Create(&device).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", device.UserID).Error("RegisterDevice: Failed to save device token.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to register device")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": device})
+}
+
+// ListDevices returns the devices the authenticated user receives push
+// notifications on.
+func ListDevices(c *gin.Context) {
+	userID := authenticatedUserID(c)
+	var devices []models.DeviceToken
+	if err := config.DB.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("ListDevices: Failed to list devices.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list devices")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": devices})
+}
+
+// UnregisterDevice stops push notifications to one of the authenticated
+// user's devices, e.g. on logout.
+func UnregisterDevice(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "UnregisterDevice")
+	if !ok {
+		return
+	}
+	userID := authenticatedUserID(c)
+	res := config.DB.Unscoped().Where("id = ? AND user_id = ?", id, userID).Delete(&models.DeviceToken{})
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).WithField("device_id", id).Error("UnregisterDevice: Failed to delete device token.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to unregister device")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "Device not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Device unregistered"})
+}
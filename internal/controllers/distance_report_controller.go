@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/trips"
+)
+
+// maxDistanceReportDays bounds ?range= on the distance report.
+const maxDistanceReportDays = 92
+
+// vehicleDay is one vehicle's distance and time on the road on one day.
+type vehicleDay struct {
+	Date           string    `json:"date"`
+	VehicleID      uint      `json:"vehicle_id"`
+	VehicleNo      string    `json:"vehicle_no"`
+	RouteID        uint      `json:"route_id"`
+	Source         string    `json:"source"` // Points the figures come from; see distanceRow
+	Points         int64     `json:"points"`
+	DistanceM      float64   `json:"distance_m"`
+	MovingS        float64   `json:"moving_s"`
+	ActiveS        float64   `json:"active_s"` // First to last report of the day
+	UtilizationPct float64   `json:"utilization_pct"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// routeDay totals a route's vehicles on one day.
+type routeDay struct {
+	Date      string  `json:"date"`
+	RouteID   uint    `json:"route_id"`
+	RouteName string  `json:"route_name"`
+	Vehicles  int     `json:"vehicles"`
+	DistanceM float64 `json:"distance_m"`
+	MovingS   float64 `json:"moving_s"`
+}
+
+// distanceRow is the SQL aggregate for one vehicle, source and day.
+type distanceRow struct {
+	VehicleID uint
+	Source    string
+	Day       string
+	Points    int64
+	DistanceM float64
+	MovingS   float64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// GetVehicleDistanceReport reports how far each of the sacco's vehicles
+// travelled per day, and how long it spent moving, for fuel budgeting.
+//
+// The period is ?date=YYYY-MM-DD or ?range=Nd (the last N days including
+// today, default 7d, at most 92), in the ?tz= time zone (default
+// Africa/Nairobi). ?route_id= and ?vehicle_id= narrow it down. Distance sums
+// each point's recorded distance_from_last; ?distance=geodesic recomputes it
+// from consecutive points instead. A vehicle reporting from both a tracker and
+// drivers' phones is measured from its tracker alone so trips are not counted
+// twice. Routes are the vehicles' current ones.
+//
+// ?format=csv downloads the per-vehicle rows, or the per-route ones with
+// ?group_by=route.
+func GetVehicleDistanceReport(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetVehicleDistanceReport")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	loc := format.FromRequest(c.Request).Location
+	from, to, ok := parseReportDays(c, loc)
+	if !ok {
+		return
+	}
+	distanceExpr := "distance_from_last"
+	switch c.DefaultQuery("distance", "recorded") {
+	case "recorded":
+	case "geodesic":
+		distanceExpr = "COALESCE(ST_DistanceSphere(ST_MakePoint(prev_lng, prev_lat), ST_MakePoint(longitude, latitude)), 0)"
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "distance must be recorded or geodesic")
+		return
+	}
+	groupBy := c.DefaultQuery("group_by", "vehicle")
+	if groupBy != "vehicle" && groupBy != "route" {
+		apierror.Respond(c, http.StatusBadRequest, "group_by must be vehicle or route")
+		return
+	}
+	output := strings.ToLower(c.DefaultQuery("format", "json"))
+	if output != "json" && output != "csv" {
+		apierror.Respond(c, http.StatusBadRequest, "Unsupported format. Use json or csv.")
+		return
+	}
+
+	vehicleQuery := config.Replica().Unscoped().Model(&models.Vehicle{}).Select("id", "vehicle_no", "route_id").Scopes(tenant.SaccoScope)
+	for param, column := range map[string]string{"vehicle_id": "id", "route_id": "route_id"} {
+		if raw := c.Query(param); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				apierror.Respond(c, http.StatusBadRequest, "Invalid "+param)
+				return
+			}
+			vehicleQuery = vehicleQuery.Where(column+" = ?", id)
+		}
+	}
+	var vehicles []models.Vehicle
+	if err := vehicleQuery.Find(&vehicles).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetVehicleDistanceReport: Failed to load vehicles.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build distance report")
+		return
+	}
+
+	rows, err := vehicleDistanceRows(vehicles, from, to, loc, distanceExpr)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetVehicleDistanceReport: Failed to aggregate distance.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build distance report")
+		return
+	}
+
+	days := vehicleDays(rows, vehicles, loc, time.Now())
+	routes, err := routeDays(days)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetVehicleDistanceReport: Failed to load routes.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build distance report")
+		return
+	}
+
+	if output == "csv" {
+		filename := fmt.Sprintf("vehicle-distance-%s-%s.csv", from.In(loc).Format("2006-01-02"), to.In(loc).AddDate(0, 0, -1).Format("2006-01-02"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		cw := csv.NewWriter(c.Writer)
+		if groupBy == "route" {
+			cw.Write([]string{"date", "route_id", "route_name", "vehicles", "distance_km", "moving_hours"})
+			for _, r := range routes {
+				cw.Write([]string{r.Date, strconv.FormatUint(uint64(r.RouteID), 10), r.RouteName, strconv.Itoa(r.Vehicles),
+					formatFloat(r.DistanceM / 1000), formatFloat(r.MovingS / 3600)})
+			}
+		} else {
+			cw.Write([]string{"date", "vehicle_id", "vehicle_no", "route_id", "source", "points", "distance_km", "moving_hours", "active_hours", "utilization_pct"})
+			for _, d := range days {
+				cw.Write([]string{d.Date, strconv.FormatUint(uint64(d.VehicleID), 10), d.VehicleNo, strconv.FormatUint(uint64(d.RouteID), 10), d.Source,
+					strconv.FormatInt(d.Points, 10), formatFloat(d.DistanceM / 1000), formatFloat(d.MovingS / 3600), formatFloat(d.ActiveS / 3600), formatFloat(d.UtilizationPct)})
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Warn("GetVehicleDistanceReport: Failed to write CSV.")
+		}
+		return
+	}
+
+	var totalDistance, totalMoving float64
+	for _, d := range days {
+		totalDistance += d.DistanceM
+		totalMoving += d.MovingS
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":     days,
+		"routes":   routes,
+		"totals":   gin.H{"distance_m": totalDistance, "moving_s": totalMoving},
+		"from":     from,
+		"to":       to,
+		"timezone": loc.String(),
+	})
+}
+
+// vehicleDistanceRows aggregates the vehicles' points between from and to
+// per vehicle, source and day in loc, measuring distance with distanceExpr.
+// Moving time counts the interval before each moving point, unless the
+// vehicle stopped reporting for longer than a trip gap.
+func vehicleDistanceRows(vehicles []models.Vehicle, from, to time.Time, loc *time.Location, distanceExpr string) ([]distanceRow, error) {
+	var rows []distanceRow
+	if len(vehicles) == 0 {
+		return rows, nil
+	}
+	ids := make([]uint, len(vehicles))
+	for i, v := range vehicles {
+		ids[i] = v.ID
+	}
+	err := config.Replica().Raw(`WITH pts AS (
+			SELECT vehicle_id, source, timestamp, is_moving, distance_from_last, latitude, longitude,
+				LAG(timestamp) OVER w AS prev_ts, LAG(latitude) OVER w AS prev_lat, LAG(longitude) OVER w AS prev_lng
+			FROM location_histories
+			WHERE vehicle_id IN ? AND timestamp >= ? AND timestamp < ? AND deleted_at IS NULL
+			WINDOW w AS (PARTITION BY vehicle_id, source ORDER BY timestamp, id))
+		SELECT vehicle_id, source, to_char(timestamp AT TIME ZONE ?, 'YYYY-MM-DD') AS day, COUNT(*) AS points,
+			SUM(`+distanceExpr+`) AS distance_m,
+			SUM(CASE WHEN is_moving AND EXTRACT(EPOCH FROM timestamp - prev_ts) <= ? THEN EXTRACT(EPOCH FROM timestamp - prev_ts) ELSE 0 END) AS moving_s,
+			MIN(timestamp) AS first_seen, MAX(timestamp) AS last_seen
+		FROM pts
+		GROUP BY 1, 2, 3`, ids, from, to, loc.String(), trips.Gap.Seconds()).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// parseReportDays reads ?date= or ?range= as whole days in loc.
+func parseReportDays(c *gin.Context, loc *time.Location) (time.Time, time.Time, bool) {
+	date, span := c.Query("date"), c.Query("range")
+	if date != "" && span != "" {
+		apierror.Respond(c, http.StatusBadRequest, "Use either date or range, not both")
+		return time.Time{}, time.Time{}, false
+	}
+	if date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, loc)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "date must be YYYY-MM-DD")
+			return time.Time{}, time.Time{}, false
+		}
+		return day, day.AddDate(0, 0, 1), true
+	}
+	if span == "" {
+		span = "7d"
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(span, "d"))
+	if err != nil || !strings.HasSuffix(span, "d") || n < 1 || n > maxDistanceReportDays {
+		apierror.Respond(c, http.StatusBadRequest, fmt.Sprintf("range must be a number of days between 1d and %dd", maxDistanceReportDays))
+		return time.Time{}, time.Time{}, false
+	}
+	now := time.Now().In(loc)
+	end := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	return end.AddDate(0, 0, -n), end, true
+}
+
+// vehicleDays picks each vehicle-day's figures from its tracker when it has
+// any, otherwise from its drivers' phones, and works out utilization: moving
+// time over the part of the day that has passed at now.
+func vehicleDays(rows []distanceRow, vehicles []models.Vehicle, loc *time.Location, now time.Time) []vehicleDay {
+	byID := make(map[uint]models.Vehicle, len(vehicles))
+	for _, v := range vehicles {
+		byID[v.ID] = v
+	}
+	type key struct {
+		vehicleID uint
+		day       string
+	}
+	picked := map[key]distanceRow{}
+	for _, r := range rows {
+		k := key{r.VehicleID, r.Day}
+		if prev, ok := picked[k]; ok && prev.Source == models.LocationSourceTracker {
+			continue
+		}
+		picked[k] = r
+	}
+
+	days := make([]vehicleDay, 0, len(picked))
+	for _, r := range picked {
+		v := byID[r.VehicleID]
+		d := vehicleDay{
+			Date:      r.Day,
+			VehicleID: r.VehicleID,
+			VehicleNo: v.VehicleNo,
+			RouteID:   v.RouteID,
+			Source:    r.Source,
+			Points:    r.Points,
+			DistanceM: r.DistanceM,
+			MovingS:   r.MovingS,
+			ActiveS:   r.LastSeen.Sub(r.FirstSeen).Seconds(),
+			FirstSeen: r.FirstSeen,
+			LastSeen:  r.LastSeen,
+		}
+		if start, err := time.ParseInLocation("2006-01-02", r.Day, loc); err == nil {
+			end := start.AddDate(0, 0, 1)
+			if now.Before(end) {
+				end = now
+			}
+			if elapsed := end.Sub(start).Seconds(); elapsed > 0 {
+				d.UtilizationPct = 100 * d.MovingS / elapsed
+			}
+		}
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Date != days[j].Date {
+			return days[i].Date < days[j].Date
+		}
+		return days[i].VehicleID < days[j].VehicleID
+	})
+	return days
+}
+
+// routeDays totals vehicle-days by route and day, in the order of days.
+func routeDays(days []vehicleDay) ([]routeDay, error) {
+	index := map[string]int{}
+	var out []routeDay
+	var routeIDs []uint
+	for _, d := range days {
+		k := d.Date + "/" + strconv.FormatUint(uint64(d.RouteID), 10)
+		i, ok := index[k]
+		if !ok {
+			i = len(out)
+			index[k] = i
+			out = append(out, routeDay{Date: d.Date, RouteID: d.RouteID})
+			routeIDs = append(routeIDs, d.RouteID)
+		}
+		out[i].Vehicles++
+		out[i].DistanceM += d.DistanceM
+		out[i].MovingS += d.MovingS
+	}
+	if len(routeIDs) == 0 {
+		return out, nil
+	}
+	var routes []models.Route
+	if err := config.Replica().Unscoped().Select("id", "name").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(routes))
+	for _, r := range routes {
+		names[r.ID] = r.Name
+	}
+	for i := range out {
+		out[i].RouteName = names[out[i].RouteID]
+	}
+	return out, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
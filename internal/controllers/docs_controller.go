@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apidoc"
+)
+
+// swaggerUIPage renders /docs/openapi.json with Swagger UI, loaded from a
+// CDN so the server doesn't have to ship its assets.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Ma3 Tracker API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "/docs/openapi.json", dom_id: "#swagger-ui", persistAuthorization: true});
+</script>
+</body>
+</html>
+`
+
+// APIDocs serves Swagger UI for browsing and trying out the API.
+func APIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+// OpenAPISpec serves the OpenAPI 3 description of the API.
+func OpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", apidoc.Spec)
+}
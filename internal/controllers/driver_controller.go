@@ -4,6 +4,7 @@ import (
 	"errors" // Import errors for gorm.ErrRecordNotFound
 	"net/http"
 	"strconv" // For parsing IDs
+	"time"
 	"gorm.io/gorm"
 
 	 logrus "github.com/sirupsen/logrus"
@@ -11,8 +12,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt" // Used for password hashing
 
+	"ma3_tracker/internal/apierror"
 	"ma3_tracker/internal/config"
 	"ma3_tracker/internal/models" // Your models package
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/principal"
 )
 
 // --- Helper Structs for Request Bodies ---
@@ -47,7 +51,7 @@ func SetServiceStatus(c *gin.Context) {
 	vehIDStr := c.Param("id")
 	vehID, err := strconv.ParseUint(vehIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Vehicle ID format."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid Vehicle ID format.")
 		return
 	}
 
@@ -61,9 +65,9 @@ func SetServiceStatus(c *gin.Context) {
 		Where("Driver.user_id = ?", userID).
 		First(&vehicle).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found or not assigned to you."})
+			apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to you.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error while fetching vehicle: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error while fetching vehicle", err))
 		}
 		return
 	}
@@ -71,14 +75,17 @@ func SetServiceStatus(c *gin.Context) {
 	// 4) Bind JSON payload for the service status.
 	var payload serviceStatusPayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body format: " + err.Error()})
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
 
 	// 5) Update the in_service flag and save the vehicle.
+	if payload.InService && respondServiceBlocked(c, vehicle) {
+		return
+	}
 	vehicle.InService = payload.InService
 	if err := config.DB.Save(&vehicle).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service status: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Failed to update service status", err))
 		return
 	}
 
@@ -88,24 +95,29 @@ func SetServiceStatus(c *gin.Context) {
 		"vehicle": vehicle,
 	})
 }
-// This endpoint might be used by a driver to fetch their own vehicle.
+// GetVehicleByDriverID returns the vehicle of the driver in :driverId. Drivers
+// only see their own; other drivers' vehicles are not found.
 func GetVehicleByDriverID(c *gin.Context) {
     driverIDStr := c.Param("driverId")
     driverID, err := strconv.ParseUint(driverIDStr, 10, 64)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver ID format"})
+        apierror.Respond(c, http.StatusBadRequest, "Invalid driver ID format")
+        return
+    }
+    tenant, ok := authenticatedTenant(c, "GetVehicleByDriverID")
+    if !ok {
         return
     }
 
     var vehicle models.Vehicle
     // Preload Driver to ensure the relation is established if needed in response
-    if err := config.DB.Preload("Driver").Where("driver_id = ?", uint(driverID)).First(&vehicle).Error; err != nil {
+    if err := config.DB.Scopes(tenant.DriverScope).Preload("Driver").Where("driver_id = ?", uint(driverID)).First(&vehicle).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found for this driver ID."})
+            apierror.Respond(c, http.StatusNotFound, "Vehicle not found for this driver ID.")
             return
         }
-        logrus.WithError(err).Error("Error fetching vehicle by driver ID from database")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vehicle data."})
+        logrus.WithContext(c).WithError(err).Error("Error fetching vehicle by driver ID from database")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch vehicle data.")
         return
     }
 
@@ -117,15 +129,18 @@ func GetVehicleByDriverID(c *gin.Context) {
 
 // GetAuthenticatedDriverVehicle fetches the vehicle assigned to the authenticated driver.
 func GetAuthenticatedDriverVehicle(c *gin.Context) {
-    driverID := uint(c.MustGet("user_id").(float64)) // Assuming user_id in JWT is the driver's ID
+    driver, ok := authenticatedDriver(c, "GetAuthenticatedDriverVehicle")
+    if !ok {
+        return
+    }
     var vehicle models.Vehicle
-    if err := config.DB.Where("driver_id = ?", driverID).First(&vehicle).Error; err != nil {
+    if err := config.DB.Where("driver_id = ?", driver.ID).First(&vehicle).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "No vehicle assigned to this driver."})
+            apierror.Respond(c, http.StatusNotFound, "No vehicle assigned to this driver.")
             return
         }
-        logrus.WithError(err).Error("Error fetching vehicle for authenticated driver")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vehicle data."})
+        logrus.WithContext(c).WithError(err).Error("Error fetching vehicle for authenticated driver")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch vehicle data.")
         return
     }
     c.JSON(http.StatusOK, gin.H{"vehicle": vehicle})
@@ -138,7 +153,7 @@ func GetDriver(c *gin.Context) {
 	userIDStr := c.Param("id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID format."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid User ID format.")
 		return
 	}
 
@@ -149,9 +164,9 @@ func GetDriver(c *gin.Context) {
 		Preload("Driver.Sacco").
 		First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Driver user not found."})
+			apierror.Respond(c, http.StatusNotFound, "Driver user not found.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error", err))
 		}
 		return
 	}
@@ -162,26 +177,52 @@ func GetDriver(c *gin.Context) {
 }
 
 
-// ListDrivers fetches all users with the role 'driver' and preloads their driver profiles.
+// driverListOptions are the sorts and filters ListDrivers accepts. Driver
+// fields live on the drivers table, so they filter through a subquery.
+var driverListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"id":         "id",
+		"created_at": "created_at",
+		"name":       "name",
+		"email":      "email",
+	},
+	DefaultSort: "id",
+	Filters: map[string]pagination.Filter{
+		"sacco_id":   pagination.Uint("id IN (SELECT user_id FROM drivers WHERE sacco_id = ? AND deleted_at IS NULL)"),
+		"vehicle_id": pagination.Uint("id IN (SELECT d.user_id FROM drivers d JOIN vehicles v ON v.driver_id = d.id WHERE v.id = ? AND d.deleted_at IS NULL)"),
+	},
+}
+
+// ListDrivers lists users with the role 'driver' a page at a time, with their
+// driver profiles: every driver for admins, otherwise the caller's sacco's.
 func ListDrivers(c *gin.Context) {
+	tenant, ok := authenticatedTenant(c, "ListDrivers")
+	if !ok {
+		return
+	}
 	var users []models.User // Fetching User records with role 'driver'
+	drivers := config.DB.Model(&models.User{}).Where("role = ?", "driver")
+	if !tenant.Admin() {
+		drivers = drivers.Where("id IN (?)", config.DB.Model(&models.Driver{}).Select("user_id").Scopes(tenant.SaccoScope))
+	}
 	// Preload Driver and its Sacco association for each user.
-	if err := config.DB.Where("role = ?", "driver").
-		Preload("Driver").
-		Preload("Driver.Sacco").
-		Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing drivers: " + err.Error()})
+	query, ok := includeDeleted(c, "ListDrivers", drivers, tenant.SaccoID())
+	if !ok {
+		return
+	}
+	meta, ok := paginate(c, "ListDrivers", query, driverListOptions, &users, "Driver", "Driver.Sacco")
+	if !ok {
 		return
 	}
 
 	// Prepare a list of driver profiles for the response.
-	var driverProfiles []gin.H
+	driverProfiles := make([]gin.H, 0, len(users))
 	for _, user := range users {
 		// Use the helper to prepare the response for each user.
 		driverProfiles = append(driverProfiles, prepareUserResponse(user))
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": driverProfiles})
+	c.JSON(http.StatusOK, gin.H{"data": driverProfiles, "pagination": meta})
 }
 
 // UpdateDriver allows modifying driver details (both user-level and driver-specific).
@@ -190,7 +231,7 @@ func UpdateDriver(c *gin.Context) {
 	userIDStr := c.Param("id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID format."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid User ID format.")
 		return
 	}
 
@@ -200,23 +241,23 @@ func UpdateDriver(c *gin.Context) {
 		Preload("Driver").
 		First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Driver user not found."})
+			apierror.Respond(c, http.StatusNotFound, "Driver user not found.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching user: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error fetching user", err))
 		}
 		return
 	}
 
 	var input updateDriverInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
 
 	// Start a transaction for atomicity
 	tx := config.DB.Begin()
 	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction."})
+		apierror.Respond(c, http.StatusInternalServerError, "Could not start transaction.")
 		return
 	}
 
@@ -234,7 +275,7 @@ func UpdateDriver(c *gin.Context) {
 		hashedPassword, hashErr := bcrypt.GenerateFromPassword([]byte(*input.UserPassword), bcrypt.DefaultCost)
 		if hashErr != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password."})
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to hash password.")
 			return
 		}
 		user.Password = string(hashedPassword)
@@ -242,7 +283,7 @@ func UpdateDriver(c *gin.Context) {
 
 	if err := tx.Save(&user).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user details: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Failed to update user details", err))
 		return
 	}
 
@@ -260,9 +301,9 @@ func UpdateDriver(c *gin.Context) {
 			if err := tx.First(&newSacco, *input.SaccoID).Error; err != nil {
 				tx.Rollback()
 				if errors.Is(err, gorm.ErrRecordNotFound) {
-					c.JSON(http.StatusBadRequest, gin.H{"error": "New Sacco ID provided does not exist."})
+					apierror.Respond(c, http.StatusBadRequest, "New Sacco ID provided does not exist.")
 				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error validating Sacco ID: " + err.Error()})
+					apierror.Fail(c, apierror.Internal("Database error validating Sacco ID", err))
 				}
 				return
 			}
@@ -271,7 +312,7 @@ func UpdateDriver(c *gin.Context) {
 
 		if err := tx.Save(user.Driver).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update driver specific details: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Failed to update driver specific details", err))
 			return
 		}
 	} else {
@@ -280,9 +321,10 @@ func UpdateDriver(c *gin.Context) {
 	}
 
 	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not commit transaction: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Could not commit transaction", err))
 		return
 	}
+	principal.Invalidate(user.ID)
 
 	// Re-fetch the user with all associations to send an accurate response
 	var updatedUser models.User
@@ -303,26 +345,28 @@ func UpdateDriver(c *gin.Context) {
 func UpdateVehicleStatus(c *gin.Context) {
     vehicleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vehicle ID"})
+        apierror.Respond(c, http.StatusBadRequest, "Invalid vehicle ID")
         return
     }
 
     var input struct {
         InService *bool `json:"in_service"` // Use pointer to differentiate between missing and false
+        OccupancyStatus *string `json:"occupancy_status"` // seats_available, few_seats or full
+        Occupancy       *int    `json:"occupancy"`        // Passengers on board
     }
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+        apierror.Fail(c, apierror.Invalid(err))
         return
     }
 
     var vehicle models.Vehicle
     if err := config.DB.First(&vehicle, vehicleID).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+            apierror.Respond(c, http.StatusNotFound, "Vehicle not found")
             return
         }
-        logrus.WithError(err).Error("Database error fetching vehicle for update")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vehicle"})
+        logrus.WithContext(c).WithError(err).Error("Database error fetching vehicle for update")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch vehicle")
         return
     }
 
@@ -337,31 +381,48 @@ func UpdateVehicleStatus(c *gin.Context) {
         if errors.Is(err, gorm.ErrRecordNotFound) {
             // This user is authenticated, but no driver profile is linked to them.
             // Or the driver profile lookup failed.
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Driver profile not found for the authenticated user."})
+            apierror.Respond(c, http.StatusUnauthorized, "Driver profile not found for the authenticated user.")
             return
         }
-        logrus.WithError(err).Error("Database error fetching driver profile for authorization")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authorization."})
+        logrus.WithContext(c).WithError(err).Error("Database error fetching driver profile for authorization")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to verify authorization.")
         return
     }
 
     // 3. Now, compare the vehicle's DriverID with the ID of the found driver profile
     // This compares Driver.ID (e.g., 10) with Vehicle.DriverID (which should be 10)
     if vehicle.DriverID != driverProfile.ID {
-        c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to update this vehicle. It is assigned to a different driver."})
+        apierror.Respond(c, http.StatusForbidden, "You are not authorized to update this vehicle. It is assigned to a different driver.")
         return
     }
 
     // If authorization passes, proceed with update
     if input.InService != nil {
+        if *input.InService && respondServiceBlocked(c, vehicle) {
+            return
+        }
         vehicle.InService = *input.InService
     }
+    occupancyReported := input.OccupancyStatus != nil || input.Occupancy != nil
+    if occupancyReported {
+        report := occupancyInput{Count: input.Occupancy}
+        if input.OccupancyStatus != nil {
+            report.Status = *input.OccupancyStatus
+        }
+        if err := applyOccupancy(&vehicle, report, time.Now()); err != nil {
+            apierror.Respond(c, http.StatusBadRequest, err.Error())
+            return
+        }
+    }
 
     if err := config.DB.Save(&vehicle).Error; err != nil {
-        logrus.WithError(err).Error("Failed to save vehicle status update")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vehicle status"})
+        logrus.WithContext(c).WithError(err).Error("Failed to save vehicle status update")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to update vehicle status")
         return
     }
+    if occupancyReported {
+        publishOccupancy(&vehicle)
+    }
     c.JSON(http.StatusOK, gin.H{"message": "Vehicle status updated successfully", "vehicle": vehicle})
 }
 
@@ -372,7 +433,7 @@ func DeleteDriver(c *gin.Context) {
 	userIDStr := c.Param("id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID format."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid User ID format.")
 		return
 	}
 
@@ -380,9 +441,9 @@ func DeleteDriver(c *gin.Context) {
 	var user models.User
 	if err := config.DB.Where("id = ? AND role = ?", uint(userID), "driver").First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Driver user not found."})
+			apierror.Respond(c, http.StatusNotFound, "Driver user not found.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching user for deletion: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error fetching user for deletion", err))
 		}
 		return
 	}
@@ -393,9 +454,10 @@ func DeleteDriver(c *gin.Context) {
 	// For a complete "driver removal", CASCADE delete is usually desired.
 	// Ensure your model definitions have `OnDelete:CASCADE` for Driver's UserID.
 	if err := config.DB.Delete(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete driver user: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Failed to delete driver user", err))
 		return
 	}
+	principal.Invalidate(user.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Driver and associated user account deleted successfully."})
 }
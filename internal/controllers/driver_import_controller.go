@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Recognised header names for each driver import column.
+var driverImportColumns = map[string][]string{
+	"name":           {"name", "driver_name", "full_name"},
+	"email":          {"email", "email_address"},
+	"phone":          {"phone", "phone_number", "mobile"},
+	"driver_phone":   {"driver_phone"},
+	"license_number": {"license_number", "license", "driver_license", "licence_number", "licence"},
+}
+
+// ImportDrivers onboards drivers in bulk from a CSV or XLSX sheet (multipart
+// field "file") with columns name, email, license_number and optionally
+// phone and driver_phone. Each row creates a driver account in its own
+// transaction. With ?credentials=invite (the default) each driver gets a
+// one-time invite to set their password; with ?credentials=password they get
+// a temporary password they must change. Credentials are only shown in this
+// response. ?dry_run=true only validates.
+func ImportDrivers(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "ImportDrivers")
+	if !ok {
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	mode := c.DefaultQuery("credentials", "invite")
+	if mode != "invite" && mode != "password" {
+		apierror.Respond(c, http.StatusBadRequest, "credentials must be invite or password")
+		return
+	}
+	sheet, ok := readBulkUpload(c, "ImportDrivers")
+	if !ok {
+		return
+	}
+	cols := sheet.Columns(driverImportColumns)
+	for _, key := range []string{"name", "email", "license_number"} {
+		if !cols.Has(key) {
+			apierror.Respond(c, http.StatusUnprocessableEntity, "file must have a "+key+" column")
+			return
+		}
+	}
+
+	var emails, licenses []string
+	for _, row := range sheet.Rows {
+		if e := strings.ToLower(cols.Get(row, "email")); e != "" {
+			emails = append(emails, e)
+		}
+		if l := strings.ToUpper(cols.Get(row, "license_number")); l != "" {
+			licenses = append(licenses, l)
+		}
+	}
+	takenEmails, takenLicenses := map[string]bool{}, map[string]bool{}
+	if len(emails) > 0 {
+		var existing []string
+		// Deleted accounts still hold their email under the unique index.
+		if err := config.DB.Unscoped().Model(&models.User{}).Where("LOWER(email) IN ?", emails).Pluck("email", &existing).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ImportDrivers: Failed to check emails.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to check emails")
+			return
+		}
+		for _, e := range existing {
+			takenEmails[strings.ToLower(e)] = true
+		}
+	}
+	if len(licenses) > 0 {
+		var existing []string
+		if err := config.DB.Model(&models.Driver{}).Where("UPPER(license_number) IN ?", licenses).Pluck("license_number", &existing).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ImportDrivers: Failed to check licenses.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to check licenses")
+			return
+		}
+		for _, l := range existing {
+			takenLicenses[strings.ToUpper(strings.TrimSpace(l))] = true
+		}
+	}
+
+	seenEmails, seenLicenses := map[string]int{}, map[string]int{}
+	results := make([]importRowResult, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		res := importRowResult{Row: row.Line, Status: "error"}
+		name := cols.Get(row, "name")
+		email := strings.ToLower(cols.Get(row, "email"))
+		license := strings.ToUpper(cols.Get(row, "license_number"))
+		res.Key = email
+
+		if name == "" {
+			res.fail("name is required")
+		}
+		if addr, err := mail.ParseAddress(email); email == "" {
+			res.fail("email is required")
+		} else if err != nil || addr.Address != email {
+			res.fail("email is not a valid address")
+		} else if takenEmails[email] {
+			res.fail("an account with this email already exists")
+		} else if first := seenEmails[email]; first != 0 {
+			res.fail("email repeats row " + strconv.Itoa(first))
+		}
+		switch {
+		case license == "":
+			res.fail("license_number is required")
+		case takenLicenses[license]:
+			res.fail("a driver with this license number already exists")
+		case seenLicenses[license] != 0:
+			res.fail("license_number repeats row " + strconv.Itoa(seenLicenses[license]))
+		}
+		if email != "" && seenEmails[email] == 0 {
+			seenEmails[email] = row.Line
+		}
+		if license != "" && seenLicenses[license] == 0 {
+			seenLicenses[license] = row.Line
+		}
+		if len(res.Errors) > 0 {
+			results = append(results, res)
+			continue
+		}
+		if dryRun {
+			res.Status = "valid"
+			results = append(results, res)
+			continue
+		}
+
+		var driver models.Driver
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			// Invited drivers cannot sign in until they set a password, so
+			// their account starts with an unusable random one.
+			secret, err := temporaryPassword()
+			if err != nil {
+				return err
+			}
+			hashed, err := hashPassword(secret)
+			if err != nil {
+				return err
+			}
+			user := models.User{
+				Name:               name,
+				Email:              email,
+				Password:           hashed,
+				Phone:              cols.Get(row, "phone"),
+				Role:               "driver",
+				MustChangePassword: mode == "password",
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			driver = models.Driver{
+				UserID:        user.ID,
+				Name:          name,
+				Phone:         cols.Get(row, "driver_phone"),
+				LicenseNumber: license,
+				SaccoID:       sacco.ID,
+			}
+			if err := tx.Create(&driver).Error; err != nil {
+				return err
+			}
+			if mode == "password" {
+				res.Credentials = gin.H{"email": email, "temporary_password": secret}
+				return nil
+			}
+			res.Credentials, err = createInvite(tx, user.ID, sacco.ID, time.Now())
+			return err
+		})
+		if err != nil {
+			res.Credentials = nil
+			logrus.WithContext(c).WithError(err).WithFields(logrus.Fields{"sacco_id": sacco.ID, "row": row.Line}).Error("ImportDrivers: Failed to create driver.")
+			res.fail("failed to create driver")
+			results = append(results, res)
+			continue
+		}
+		res.Status, res.ID = "created", driver.ID
+		results = append(results, res)
+	}
+
+	report := importReport(dryRun, results)
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"sacco_id":    sacco.ID,
+		"dry_run":     dryRun,
+		"credentials": mode,
+		"rows":        len(results),
+		"failed":      report["failed"],
+	}).Info("ImportDrivers: Import processed.")
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
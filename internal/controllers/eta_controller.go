@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/eta"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// etaBroadcastStages caps how many upcoming stages a location broadcast
+// carries ETAs for.
+var etaBroadcastStages = config.EnvInt("ETA_BROADCAST_STAGES", 5)
+
+// observeETAs feeds a saved point into the ETA engine and returns the ETAs to
+// every stage ahead of the vehicle, nil when there are none.
+func observeETAs(record models.LocationHistory, routeID uint) []eta.StageETA {
+	if record.VehicleID == 0 || routeID == 0 {
+		return nil
+	}
+	p, err := eta.Observe(config.DB, record, routeID)
+	if err != nil {
+		if !errors.Is(err, eta.ErrNoGeometry) && !errors.Is(err, eta.ErrOffRoute) {
+			logrus.WithError(err).WithFields(logrus.Fields{"vehicle_id": record.VehicleID, "route_id": routeID}).Warn("observeETAs: Failed to estimate ETAs.")
+		}
+		return nil
+	}
+	return p.Upcoming
+}
+
+// stageArrival is a vehicle expected at a stage.
+type stageArrival struct {
+	VehicleID  uint      `json:"vehicle_id"`
+	VehicleNo  string    `json:"vehicle_no"`
+	DistanceM  float64   `json:"distance_m"`
+	Seconds    float64   `json:"eta_seconds"` // From now
+	ArrivalAt  time.Time `json:"arrival_at"`
+	Measured   bool      `json:"measured"` // Based on the vehicle's recent progress rather than a typical speed
+	AgeSeconds float64   `json:"position_age_seconds"`
+}
+
+// GetRouteETAs returns, for each stage of a published route (or only
+// ?stage_id=), the in-service vehicles heading towards it and when they are
+// expected, soonest first. Vehicles whose position is stale or off the
+// route are left out.
+func GetRouteETAs(c *gin.Context) {
+	routeID, ok := parseUintParam(c, "id", "GetRouteETAs")
+	if !ok {
+		return
+	}
+	var route models.Route
+	if err := config.DB.Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("seq") }).
+		Where("id = ? AND status = ?", routeID, models.RouteStatusPublished).First(&route).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("route_id", routeID).Error("GetRouteETAs: Failed to load route.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load route")
+		}
+		return
+	}
+	var stageFilter uint64
+	if raw := c.Query("stage_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid stage_id")
+			return
+		}
+		stageFilter = id
+	}
+
+	positions, err := latestPositions("route_id", route.ID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("GetRouteETAs: Failed to load positions.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load vehicle positions")
+		return
+	}
+	now := time.Now()
+	arrivals := map[uint][]stageArrival{}
+	for _, pos := range positions {
+		if pos.Stale {
+			continue
+		}
+		p, err := eta.Project(config.DB, pos.VehicleID, route.ID, geo.Point{Lat: pos.Latitude, Lng: pos.Longitude}, pos.Timestamp)
+		if errors.Is(err, eta.ErrNoGeometry) {
+			apierror.Respond(c, http.StatusConflict, "Route has no geometry to estimate arrivals on")
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, eta.ErrOffRoute) {
+				logrus.WithContext(c).WithError(err).WithField("vehicle_id", pos.VehicleID).Warn("GetRouteETAs: Failed to estimate ETAs.")
+			}
+			continue
+		}
+		for _, s := range p.Upcoming {
+			arrivals[s.StageID] = append(arrivals[s.StageID], stageArrival{
+				VehicleID:  pos.VehicleID,
+				VehicleNo:  pos.VehicleNo,
+				DistanceM:  s.DistanceM,
+				Seconds:    math.Max(s.ArrivalAt.Sub(now).Seconds(), 0),
+				ArrivalAt:  s.ArrivalAt,
+				Measured:   p.Measured,
+				AgeSeconds: pos.AgeSeconds,
+			})
+		}
+	}
+
+	stages := make([]gin.H, 0, len(route.Stages))
+	for _, s := range route.Stages {
+		if stageFilter != 0 && uint64(s.ID) != stageFilter {
+			continue
+		}
+		vehicles := arrivals[s.ID]
+		if vehicles == nil {
+			vehicles = []stageArrival{}
+		}
+		sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].Seconds < vehicles[j].Seconds })
+		stages = append(stages, gin.H{"stage_id": s.ID, "name": s.Name, "seq": s.Seq, "vehicles": vehicles})
+	}
+	if stageFilter != 0 && len(stages) == 0 {
+		apierror.Respond(c, http.StatusNotFound, "Stage not found on this route")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"route_id": route.ID, "stages": stages}, "generated_at": now.UTC()})
+}
+
+// stageArrivalsLimit is how many vehicles GetStageArrivals returns unless
+// ?limit= asks for a different number, up to maxStageArrivals.
+const (
+	stageArrivalsLimit = 5
+	maxStageArrivals   = 20
+)
+
+// stopArrival is a vehicle expected at a stop, on one of the routes serving
+// it.
+type stopArrival struct {
+	stageArrival
+	RouteID         uint                   `json:"route_id"`
+	RouteName       string                 `json:"route_name"`
+	StageID         uint                   `json:"stage_id"`
+	OccupancyStatus string                 `json:"occupancy_status"`
+	Crowding        models.VehicleCrowding `json:"crowding"`
+}
+
+// GetStageArrivals returns the next vehicles (?limit=, 5 by default)
+// expected at a stage of a published route, soonest first, with their ETAs
+// and route names. When the stage is at a shared stop, vehicles on every
+// published route serving that stop are included, so a commuter waiting
+// there sees all the matatus they could board. The service alerts in effect
+// on those routes come along.
+func GetStageArrivals(c *gin.Context) {
+	stageID, ok := parseUintParam(c, "id", "GetStageArrivals")
+	if !ok {
+		return
+	}
+	limit := stageArrivalsLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxStageArrivals {
+			apierror.Respond(c, http.StatusBadRequest, "limit must be between 1 and 20")
+			return
+		}
+		limit = n
+	}
+
+	published := config.DB.Model(&models.Route{}).Select("id").Where("status = ?", models.RouteStatusPublished)
+	var stage models.Stage
+	if err := config.DB.Where("id = ? AND route_id IN (?)", stageID, published).First(&stage).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Stage not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("stage_id", stageID).Error("GetStageArrivals: Failed to load stage.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load stage")
+		}
+		return
+	}
+	stages := []models.Stage{stage}
+	if stage.StopID != 0 {
+		if err := config.DB.Where("stop_id = ? AND route_id IN (?)", stage.StopID, published).Order("route_id").Find(&stages).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("stop_id", stage.StopID).Error("GetStageArrivals: Failed to load the stop's stages.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load stage")
+			return
+		}
+	}
+
+	routeIDs := make([]uint, 0, len(stages))
+	stageOn := make(map[uint]uint, len(stages)) // route ID -> stage ID at this stop
+	for _, s := range stages {
+		if _, seen := stageOn[s.RouteID]; !seen {
+			routeIDs = append(routeIDs, s.RouteID)
+			stageOn[s.RouteID] = s.ID
+		}
+	}
+	var routes []models.Route
+	if err := config.DB.Select("id", "name").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("stage_id", stage.ID).Error("GetStageArrivals: Failed to load routes.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load routes")
+		return
+	}
+	routeNames := make(map[uint]string, len(routes))
+	for _, r := range routes {
+		routeNames[r.ID] = r.Name
+	}
+
+	now := time.Now()
+	arrivals := []stopArrival{}
+	for _, routeID := range routeIDs {
+		positions, err := latestPositions("route_id", routeID)
+		if err != nil {
+			logrus.WithContext(c).WithError(err).WithField("route_id", routeID).Error("GetStageArrivals: Failed to load positions.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load vehicle positions")
+			return
+		}
+		for _, pos := range positions {
+			if pos.Stale {
+				continue
+			}
+			p, err := eta.Project(config.DB, pos.VehicleID, routeID, geo.Point{Lat: pos.Latitude, Lng: pos.Longitude}, pos.Timestamp)
+			if errors.Is(err, eta.ErrNoGeometry) {
+				break // No arrivals to estimate on this route; the others may have some
+			}
+			if err != nil {
+				if !errors.Is(err, eta.ErrOffRoute) {
+					logrus.WithContext(c).WithError(err).WithField("vehicle_id", pos.VehicleID).Warn("GetStageArrivals: Failed to estimate ETAs.")
+				}
+				continue
+			}
+			for _, s := range p.Upcoming {
+				if s.StageID != stageOn[routeID] {
+					continue
+				}
+				arrivals = append(arrivals, stopArrival{
+					stageArrival: stageArrival{
+						VehicleID:  pos.VehicleID,
+						VehicleNo:  pos.VehicleNo,
+						DistanceM:  s.DistanceM,
+						Seconds:    math.Max(s.ArrivalAt.Sub(now).Seconds(), 0),
+						ArrivalAt:  s.ArrivalAt,
+						Measured:   p.Measured,
+						AgeSeconds: pos.AgeSeconds,
+					},
+					RouteID:         routeID,
+					RouteName:       routeNames[routeID],
+					StageID:         s.StageID,
+					OccupancyStatus: models.OccupancyUnknown,
+					Crowding:        models.VehicleCrowding{Level: models.CrowdingUnknown},
+				})
+				break
+			}
+		}
+	}
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Seconds < arrivals[j].Seconds })
+	if len(arrivals) > limit {
+		arrivals = arrivals[:limit]
+	}
+	attachArrivalLoads(arrivals, now)
+
+	alerts := []models.ServiceAlert{}
+	for _, a := range uniqueServiceAlerts(routeIDs) {
+		if a.StageID == 0 || a.StageID == stageOn[a.RouteID] {
+			alerts = append(alerts, a)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"stage_id": stage.ID,
+		"stop_id":  stage.StopID,
+		"name":     stage.Name,
+		"vehicles": arrivals,
+		"alerts":   alerts,
+	}, "generated_at": now.UTC()})
+}
+
+// attachArrivalLoads adds how full each arriving vehicle is, as its driver
+// and the commuters on the street last reported.
+func attachArrivalLoads(arrivals []stopArrival, now time.Time) {
+	if len(arrivals) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(arrivals))
+	for _, a := range arrivals {
+		ids = append(ids, a.VehicleID)
+	}
+	var vehicles []models.Vehicle
+	if err := config.DB.Where("id IN ?", ids).Find(&vehicles).Error; err != nil {
+		logrus.WithError(err).Warn("attachArrivalLoads: Failed to load vehicles.")
+		return
+	}
+	byID := make(map[uint]*models.Vehicle, len(vehicles))
+	for i := range vehicles {
+		currentOccupancy(&vehicles[i], now)
+		currentCrowding(&vehicles[i], now)
+		byID[vehicles[i].ID] = &vehicles[i]
+	}
+	for i := range arrivals {
+		if v, ok := byID[arrivals[i].VehicleID]; ok {
+			arrivals[i].OccupancyStatus = v.OccupancyStatus
+			arrivals[i].Crowding = v.Crowding
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/exports"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pseudonym"
+	"ma3_tracker/internal/storage"
+)
+
+// exportLinkTTL is how long a download link handed to the client stays valid.
+var exportLinkTTL = config.EnvDuration("EXPORT_LINK_TTL", 15*time.Minute)
+
+// maxDirectExportPoints is the most points ExportLocationHistory returns in
+// the response; larger exports are queued as a job instead.
+var maxDirectExportPoints = config.EnvInt("EXPORT_DIRECT_MAX_POINTS", 20000)
+
+type createExportInput struct {
+	Kind         string     `json:"kind" binding:"required"` // location_history, adherence_rollup or gtfs
+	Format       string     `json:"format"`                  // csv, geojson or gpx for location_history; the kind's default when empty
+	From         *time.Time `json:"from"`
+	To           *time.Time `json:"to"`
+	DriverID     *uint      `json:"driver_id"`    // location_history only
+	VehicleID    *uint      `json:"vehicle_id"`   // location_history only
+	Pseudonymize bool       `json:"pseudonymize"` // Replace driver IDs with rotating pseudonyms
+}
+
+// CreateExportJob queues an export for the authenticated sacco and returns 202
+// with the job so the client can poll its progress.
+func CreateExportJob(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "CreateExportJob")
+	if !ok {
+		return
+	}
+	var input createExportInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.Kind != models.ExportKindLocationHistory && (input.DriverID != nil || input.VehicleID != nil) {
+		apierror.Respond(c, http.StatusBadRequest, "driver_id and vehicle_id only apply to location_history exports")
+		return
+	}
+	if input.From != nil && input.To != nil && !input.To.After(*input.From) {
+		apierror.Respond(c, http.StatusBadRequest, "to must be after from")
+		return
+	}
+
+	job := models.ExportJob{
+		UserID:    authenticatedUserID(c),
+		SaccoID:   sacco.ID,
+		Kind:      input.Kind,
+		Format:    input.Format,
+		From:      input.From,
+		To:        input.To,
+		DriverID:  input.DriverID,
+		VehicleID: input.VehicleID,
+
+		Pseudonymize: input.Pseudonymize,
+	}
+	if !checkExportJob(c, "CreateExportJob", &job) {
+		return
+	}
+	queueExportJob(c, "CreateExportJob", job)
+}
+
+// ExportLocationHistory exports the location history of the sacco's drivers
+// and vehicles between ?from= and ?to= (default the last 24 hours) as
+// ?format=csv (default), geojson or gpx, narrowed with ?driver_id= and
+// ?vehicle_id=. Up to EXPORT_DIRECT_MAX_POINTS points are returned as a file
+// straight away; beyond that the export is queued like CreateExportJob and
+// 202 is returned with the job to poll for its signed download link.
+// ?pseudonymize=true replaces driver IDs with pseudonyms.
+func ExportLocationHistory(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "ExportLocationHistory")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	job := models.ExportJob{
+		UserID:  authenticatedUserID(c),
+		SaccoID: sacco.ID,
+		Kind:    models.ExportKindLocationHistory,
+		Format:  strings.ToLower(c.Query("format")),
+		From:    &from,
+		To:      &to,
+
+		Pseudonymize: c.Query("pseudonymize") == "true",
+	}
+	for name, dst := range map[string]**uint{"driver_id": &job.DriverID, "vehicle_id": &job.VehicleID} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		v := uint(id)
+		*dst = &v
+	}
+	if !checkExportJob(c, "ExportLocationHistory", &job) {
+		return
+	}
+
+	points, err := exports.CountLocationHistory(c.Request.Context(), &job)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ExportLocationHistory: Failed to count points.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to export location history")
+		return
+	}
+	if points > int64(maxDirectExportPoints) {
+		queueExportJob(c, "ExportLocationHistory", job)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exports.FileName(&job, time.Now())))
+	c.Header("Content-Type", exports.ContentType(&job))
+	c.Status(http.StatusOK)
+	if err := exports.Write(c.Request.Context(), &job, c.Writer); err != nil {
+		// The headers are gone by now; all that's left is to cut the file short.
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ExportLocationHistory: Failed to write export.")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"sacco_id": sacco.ID, "format": job.Format, "points": points}).Info("ExportLocationHistory: Location history exported.")
+}
+
+// checkExportJob validates a new job's kind, format and options, filling in
+// the default format, and responds with an error when they don't hold up.
+func checkExportJob(c *gin.Context, fn string, job *models.ExportJob) bool {
+	tenant, ok := saccoTenant(c, fn)
+	if !ok {
+		return false
+	}
+	if !exports.Supported(job.Kind, job.Format) {
+		if exports.Supported(job.Kind, "") {
+			apierror.Respond(c, http.StatusBadRequest, "Unsupported format for "+job.Kind+" exports")
+		} else {
+			apierror.Respond(c, http.StatusBadRequest, "kind must be location_history, adherence_rollup or gtfs")
+		}
+		return false
+	}
+	if job.Format == "" {
+		job.Format = exports.DefaultFormat(job.Kind)
+	}
+	if job.Pseudonymize && !pseudonym.Enabled() {
+		apierror.Respond(c, http.StatusServiceUnavailable, "Pseudonymized exports are not available on this server")
+		return false
+	}
+	if job.DriverID != nil {
+		var count int64
+		if err := config.DB.Unscoped().Model(&models.Driver{}).Scopes(tenant.SaccoScope).Where("id = ?", *job.DriverID).Count(&count).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("driver_id", *job.DriverID).Error(fn + ": Failed to check driver.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to create export")
+			return false
+		}
+		if count == 0 {
+			apierror.Respond(c, http.StatusNotFound, "Driver not found or not assigned to your Sacco.")
+			return false
+		}
+	}
+	if job.VehicleID != nil {
+		var count int64
+		if err := config.DB.Unscoped().Model(&models.Vehicle{}).Scopes(tenant.SaccoScope).Where("id = ?", *job.VehicleID).Count(&count).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("vehicle_id", *job.VehicleID).Error(fn + ": Failed to check vehicle.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to create export")
+			return false
+		}
+		if count == 0 {
+			apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
+			return false
+		}
+	}
+	return true
+}
+
+// queueExportJob saves the job, queues it to run in the background and
+// responds with 202 and the job so the client can poll its progress.
+func queueExportJob(c *gin.Context, fn string, job models.ExportJob) {
+	job.Status = models.ExportStatusQueued
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		return exports.Queue(tx, &job)
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", job.SaccoID).Error(fn + ": Failed to create export job.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create export")
+		return
+	}
+	jobs.Wake(config.DB)
+
+	logrus.WithContext(c).WithFields(logrus.Fields{"export_id": job.ID, "kind": job.Kind, "format": job.Format}).Info(fn + ": Export queued.")
+	c.Header("Location", fmt.Sprintf("/sacco/exports/%d", job.ID))
+	c.JSON(http.StatusAccepted, gin.H{"data": exportJobResponse(job)})
+}
+
+// ListExportJobs returns the sacco's recent exports, newest first.
+func ListExportJobs(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListExportJobs")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var jobs []models.ExportJob
+	if err := config.DB.Scopes(tenant.SaccoScope).Order("created_at DESC").Limit(50).Find(&jobs).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ListExportJobs: Failed to list exports.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list exports")
+		return
+	}
+	out := make([]gin.H, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, exportJobResponse(j))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// GetExportJob returns the job's progress and, once finished, a short-lived download link.
+func GetExportJob(c *gin.Context) {
+	job, ok := loadSaccoExportJob(c, "GetExportJob")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": exportJobResponse(job)})
+}
+
+// DownloadExportJob redirects to a fresh signed URL for the export result.
+func DownloadExportJob(c *gin.Context) {
+	job, ok := loadSaccoExportJob(c, "DownloadExportJob")
+	if !ok {
+		return
+	}
+	if job.Status != models.ExportStatusCompleted || job.ResultKey == "" {
+		apierror.Fail(c, apierror.New(http.StatusConflict, "Export is not ready").WithDetail("status", job.Status))
+		return
+	}
+	link, _ := storage.SignedURL(job.ResultKey, exportLinkTTL)
+	c.Redirect(http.StatusFound, link)
+}
+
+func loadSaccoExportJob(c *gin.Context, fn string) (models.ExportJob, bool) {
+	return loadOwned[models.ExportJob](c, fn, "Export", config.DB)
+}
+
+func exportJobResponse(job models.ExportJob) gin.H {
+	out := gin.H{"job": job}
+	if job.Status == models.ExportStatusCompleted && job.ResultKey != "" {
+		link, expires := storage.SignedURL(job.ResultKey, exportLinkTTL)
+		out["download_url"] = link
+		out["download_url_expires_at"] = expires
+	}
+	return out
+}
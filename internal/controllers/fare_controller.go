@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/fares"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// fareLegInput is one matatu ride of a journey to price.
+type fareLegInput struct {
+	RouteID       uint `json:"route_id" binding:"required"`
+	BoardStageID  uint `json:"board_stage_id" binding:"required"`
+	AlightStageID uint `json:"alight_stage_id" binding:"required"`
+}
+
+// fareLegEstimate is the estimated fare of one ride.
+type fareLegEstimate struct {
+	fares.Estimate
+	RouteName    string       `json:"route_name"`
+	FareEstimate format.Money `json:"fare_estimate"`
+}
+
+// EstimateFare prices a planned journey of one or more matatu rides, as
+// returned by FindOptimalRoute or about to be passed to CreateJourney. Body:
+// {"legs": [{"route_id": 1, "board_stage_id": 4, "alight_stage_id": 9}, ...],
+// "at": "2024-05-01T07:30:00+03:00"}; at, when the journey starts, defaults
+// to now. Each ride is priced from its route's fare matrix, or by distance
+// when the sacco hasn't priced the pair of stages, then adjusted by the
+// time-of-day window and the route's fare rule in force.
+func EstimateFare(c *gin.Context) {
+	var input struct {
+		Legs []fareLegInput `json:"legs" binding:"required,dive"`
+		At   *time.Time     `json:"at"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if len(input.Legs) == 0 || len(input.Legs) > maxJourneySegments {
+		apierror.Respond(c, http.StatusBadRequest, "legs must hold between 1 and 6 rides")
+		return
+	}
+	at := time.Now()
+	if input.At != nil {
+		at = *input.At
+	}
+
+	prefs := middleware.FormatPreferences(c)
+	legs := make([]fareLegEstimate, 0, len(input.Legs))
+	total := 0.0
+	for i, l := range input.Legs {
+		var route models.Route
+		if err := config.DB.Preload("Stages").Where("id = ? AND status = ?", l.RouteID, models.RouteStatusPublished).First(&route).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				apierror.Fail(c, apierror.New(http.StatusBadRequest, "Route not found").WithDetail("leg", i+1))
+			} else {
+				logrus.WithContext(c).WithError(err).WithField("route_id", l.RouteID).Error("EstimateFare: Failed to load route.")
+				apierror.Respond(c, http.StatusInternalServerError, "Failed to estimate fare")
+			}
+			return
+		}
+		estimate, err := fares.For(config.DB, route, l.BoardStageID, l.AlightStageID, at)
+		if errors.Is(err, fares.ErrStageNotOnRoute) || errors.Is(err, fares.ErrSameStage) {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "Boarding and alighting stages must be two different stages on the route").WithDetail("leg", i+1))
+			return
+		}
+		if err != nil {
+			logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("EstimateFare: Failed to estimate fare.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to estimate fare")
+			return
+		}
+		total += estimate.Fare
+		legs = append(legs, fareLegEstimate{Estimate: estimate, RouteName: route.Name, FareEstimate: prefs.Money(estimate.Fare)})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"legs":  legs,
+		"total": prefs.Money(total),
+		"at":    at,
+	}})
+}
+
+// ListRouteFares returns the fare matrix of one of the sacco's routes.
+func ListRouteFares(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "ListRouteFares")
+	if !ok {
+		return
+	}
+	var entries []models.RouteFare
+	if err := config.DB.Where("route_id = ?", route.ID).Order("from_stage_id, to_stage_id").Find(&entries).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ListRouteFares: Failed to list fares.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list fares")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+// SetRouteFares replaces the fare matrix of one of the sacco's routes. Body:
+// {"fares": [{"from_stage_id": 4, "to_stage_id": 9, "fare": 80}, ...]}; each
+// fare applies in both directions between the two stages.
+func SetRouteFares(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "SetRouteFares", "Stages")
+	if !ok {
+		return
+	}
+	var input struct {
+		Fares []struct {
+			FromStageID uint    `json:"from_stage_id" binding:"required"`
+			ToStageID   uint    `json:"to_stage_id" binding:"required"`
+			Fare        float64 `json:"fare"`
+		} `json:"fares" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+
+	onRoute := make(map[uint]bool, len(route.Stages))
+	for _, s := range route.Stages {
+		onRoute[s.ID] = true
+	}
+	entries := make([]models.RouteFare, 0, len(input.Fares))
+	seen := map[[2]uint]bool{}
+	for i, f := range input.Fares {
+		if f.FromStageID == f.ToStageID || !onRoute[f.FromStageID] || !onRoute[f.ToStageID] {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "Fares must be between two different stages on the route").WithDetail("entry", i+1))
+			return
+		}
+		if f.Fare <= 0 {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "fare must be positive").WithDetail("entry", i+1))
+			return
+		}
+		from, to := fares.Pair(f.FromStageID, f.ToStageID)
+		if seen[[2]uint{from, to}] {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "The same pair of stages is priced twice").WithDetail("entry", i+1))
+			return
+		}
+		seen[[2]uint{from, to}] = true
+		entries = append(entries, models.RouteFare{RouteID: route.ID, FromStageID: from, ToStageID: to, Fare: f.Fare})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Hard delete, so the unique index on the pair doesn't clash with
+		// the entries replacing them.
+		if err := tx.Unscoped().Where("route_id = ?", route.ID).Delete(&models.RouteFare{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("SetRouteFares: Failed to save fares.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save fares")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "fares": len(entries)}).Info("SetRouteFares: Route fares updated.")
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
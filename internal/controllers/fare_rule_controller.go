@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/fares"
+	"ma3_tracker/internal/models"
+)
+
+// fareRuleInput is the body accepted when creating or replacing a fare rule.
+type fareRuleInput struct {
+	Name             string     `json:"name" binding:"required"`
+	EffectiveFrom    *time.Time `json:"effective_from"`
+	EffectiveUntil   *time.Time `json:"effective_until"`
+	BaseFare         *float64   `json:"base_fare"`
+	PerKm            *float64   `json:"per_km"`
+	PeakWindows      string     `json:"peak_windows"`
+	Multiplier       *float64   `json:"multiplier"`
+	DemandMultiplier float64    `json:"demand_multiplier"`
+	DemandThreshold  float64    `json:"demand_threshold"`
+}
+
+// apply copies the input onto rule, defaulting effective_from to now and
+// multiplier to 1, and responds when the result isn't a valid rule.
+func (input fareRuleInput) apply(c *gin.Context, rule *models.FareRule) bool {
+	rule.Name = strings.TrimSpace(input.Name)
+	rule.EffectiveFrom = time.Now()
+	if input.EffectiveFrom != nil {
+		rule.EffectiveFrom = *input.EffectiveFrom
+	}
+	rule.EffectiveUntil = input.EffectiveUntil
+	rule.BaseFare, rule.PerKm = input.BaseFare, input.PerKm
+	rule.PeakWindows = strings.TrimSpace(input.PeakWindows)
+	rule.Multiplier = 1
+	if input.Multiplier != nil {
+		rule.Multiplier = *input.Multiplier
+	}
+	rule.DemandMultiplier, rule.DemandThreshold = input.DemandMultiplier, input.DemandThreshold
+	if err := fares.CheckRule(*rule); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return false
+	}
+	return true
+}
+
+// loadSaccoFareRule loads the fare rule named by :id if it belongs to the
+// authenticated sacco.
+func loadSaccoFareRule(c *gin.Context, fn string) (models.FareRule, bool) {
+	return loadOwned[models.FareRule](c, fn, "Fare rule", config.DB)
+}
+
+// ListFareRules returns the fare rules of one of the sacco's routes, latest
+// to take effect first, with the ID of the one in force now as
+// "in_force_id" (0 when the defaults apply). ?current=true leaves out rules
+// whose schedule has ended.
+func ListFareRules(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "ListFareRules")
+	if !ok {
+		return
+	}
+	now := time.Now()
+	query, ok := includeDeleted(c, "ListFareRules", config.DB.Where("route_id = ?", route.ID), route.SaccoID)
+	if !ok {
+		return
+	}
+	if c.Query("current") == "true" {
+		query = query.Where("effective_until IS NULL OR effective_until > ?", now)
+	}
+	var rules []models.FareRule
+	if err := query.Order("effective_from DESC, id DESC").Find(&rules).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ListFareRules: Failed to list fare rules.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list fare rules")
+		return
+	}
+	inForce, err := fares.RuleAt(config.DB, route.ID, now)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ListFareRules: Failed to find the rule in force.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list fare rules")
+		return
+	}
+	inForceID := uint(0)
+	if inForce != nil {
+		inForceID = inForce.ID
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules, "in_force_id": inForceID})
+}
+
+// CreateFareRule schedules a fare rule on one of the sacco's routes. Body:
+// {"name": "Evening peak", "effective_from": "2024-06-01T00:00:00+03:00",
+// "effective_until": null, "base_fare": 60, "per_km": 6, "peak_windows":
+// "06:00-09:00*1.2,17:00-20:00*1.3", "multiplier": 1, "demand_multiplier":
+// 1.2, "demand_threshold": 75}. Only name is required; effective_from
+// defaults to now, and fields left out keep the defaults.
+func CreateFareRule(c *gin.Context) {
+	route, sacco, ok := loadSaccoRoute(c, "CreateFareRule")
+	if !ok {
+		return
+	}
+	var input fareRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	rule := models.FareRule{RouteID: route.ID, SaccoID: sacco.ID}
+	if !input.apply(c, &rule) {
+		return
+	}
+	if err := config.DB.Create(&rule).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("CreateFareRule: Failed to save fare rule.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save fare rule")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "fare_rule_id": rule.ID}).Info("CreateFareRule: Fare rule scheduled.")
+	c.JSON(http.StatusCreated, gin.H{"data": rule})
+}
+
+// GetFareRule returns one of the sacco's fare rules.
+func GetFareRule(c *gin.Context) {
+	rule, ok := loadSaccoFareRule(c, "GetFareRule")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rule})
+}
+
+// UpdateFareRule replaces one of the sacco's fare rules, e.g. to set
+// effective_until and end it. Takes the same body as CreateFareRule.
+func UpdateFareRule(c *gin.Context) {
+	rule, ok := loadSaccoFareRule(c, "UpdateFareRule")
+	if !ok {
+		return
+	}
+	var input fareRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.EffectiveFrom == nil {
+		input.EffectiveFrom = &rule.EffectiveFrom
+	}
+	if !input.apply(c, &rule) {
+		return
+	}
+	if err := config.DB.Save(&rule).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("fare_rule_id", rule.ID).Error("UpdateFareRule: Failed to save fare rule.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save fare rule")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rule})
+}
+
+// DeleteFareRule removes one of the sacco's fare rules, e.g. one scheduled by
+// mistake. Rules that have been in force should be ended instead, so past
+// fares can still be explained.
+func DeleteFareRule(c *gin.Context) {
+	rule, ok := loadSaccoFareRule(c, "DeleteFareRule")
+	if !ok {
+		return
+	}
+	if err := config.DB.Delete(&rule).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("fare_rule_id", rule.ID).Error("DeleteFareRule: Failed to delete fare rule.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete fare rule")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Fare rule deleted successfully"})
+}
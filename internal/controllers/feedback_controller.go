@@ -0,0 +1,419 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/storage"
+)
+
+// maxDailyFeedback bounds how much feedback one commuter can file a day.
+var maxDailyFeedback = config.EnvInt("FEEDBACK_DAILY_LIMIT", 10)
+
+// feedbackListOptions are the sorts and filters the feedback listings accept.
+var feedbackListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]pagination.Filter{
+		"kind":       pagination.String("kind = ?"),
+		"category":   pagination.String("category = ?"),
+		"status":     pagination.String("status = ?"),
+		"vehicle_id": pagination.Uint("vehicle_id = ?"),
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"route_id":   pagination.Uint("route_id = ?"),
+	},
+}
+
+// attachFeedbackPhotos fills in a short-lived link to each photo.
+func attachFeedbackPhotos(list []models.Feedback) {
+	for i := range list {
+		if list[i].PhotoKey != "" {
+			list[i].PhotoURL, _ = storage.SignedURL(list[i].PhotoKey, mediaLinkTTL)
+		}
+	}
+}
+
+// feedbackSacco resolves the sacco the feedback is about from its vehicle,
+// driver and route, which must all belong to the same one. It responds and
+// returns false when one doesn't exist or they disagree.
+func feedbackSacco(c *gin.Context, vehicleID, driverID, routeID uint) (uint, bool) {
+	var saccoID uint
+	check := func(model interface{}, id uint, what string) bool {
+		if id == 0 {
+			return true
+		}
+		var owner uint
+		if err := config.DB.Model(model).Where("id = ?", id).Limit(1).Pluck("sacco_id", &owner).Error; err != nil {
+			logrus.WithError(err).WithField(what+"_id", id).Error("SubmitFeedback: Failed to load " + what + ".")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to submit feedback")
+			return false
+		}
+		if owner == 0 {
+			apierror.Respond(c, http.StatusBadRequest, strings.ToUpper(what[:1])+what[1:]+" not found")
+			return false
+		}
+		if saccoID != 0 && saccoID != owner {
+			apierror.Respond(c, http.StatusBadRequest, "The vehicle, driver and route must belong to the same sacco")
+			return false
+		}
+		saccoID = owner
+		return true
+	}
+	ok := check(&models.Vehicle{}, vehicleID, "vehicle") &&
+		check(&models.Driver{}, driverID, "driver") &&
+		check(&models.Route{}, routeID, "route")
+	return saccoID, ok
+}
+
+// SubmitFeedback files a complaint or compliment about a vehicle, driver or
+// route (at least one of them). Body: {"kind": "complaint", "category":
+// "overcharging", "vehicle_id": 3, "message": "...", "occurred_at": "..."}.
+// A photo can be added afterwards with UploadFeedbackPhoto.
+func SubmitFeedback(c *gin.Context) {
+	var input struct {
+		Kind       string     `json:"kind" binding:"required"`
+		Category   string     `json:"category"`
+		VehicleID  uint       `json:"vehicle_id"`
+		DriverID   uint       `json:"driver_id"`
+		RouteID    uint       `json:"route_id"`
+		Message    string     `json:"message" binding:"required"`
+		OccurredAt *time.Time `json:"occurred_at"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.Kind != models.FeedbackComplaint && input.Kind != models.FeedbackCompliment {
+		apierror.Respond(c, http.StatusBadRequest, "kind must be complaint or compliment")
+		return
+	}
+	if input.Category == "" {
+		input.Category = models.FeedbackOther
+	}
+	switch input.Category {
+	case models.FeedbackRecklessDriving, models.FeedbackOvercharging, models.FeedbackHarassment,
+		models.FeedbackOverloading, models.FeedbackCleanliness, models.FeedbackService, models.FeedbackOther:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "category must be reckless_driving, overcharging, harassment, overloading, cleanliness, service or other")
+		return
+	}
+	message := strings.TrimSpace(input.Message)
+	if message == "" || len(message) > 2000 {
+		apierror.Respond(c, http.StatusBadRequest, "message must be between 1 and 2000 characters")
+		return
+	}
+	if input.VehicleID == 0 && input.DriverID == 0 && input.RouteID == 0 {
+		apierror.Respond(c, http.StatusBadRequest, "Feedback must be about a vehicle, driver or route")
+		return
+	}
+	if input.OccurredAt != nil && input.OccurredAt.After(time.Now()) {
+		apierror.Respond(c, http.StatusBadRequest, "occurred_at cannot be in the future")
+		return
+	}
+
+	userID := authenticatedUserID(c)
+	var today int64
+	if err := config.DB.Model(&models.Feedback{}).Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-24*time.Hour)).Count(&today).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("SubmitFeedback: Failed to count recent feedback.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to submit feedback")
+		return
+	}
+	if today >= int64(maxDailyFeedback) {
+		apierror.Respond(c, http.StatusTooManyRequests, "You have sent too much feedback today; please try again tomorrow")
+		return
+	}
+	saccoID, ok := feedbackSacco(c, input.VehicleID, input.DriverID, input.RouteID)
+	if !ok {
+		return
+	}
+
+	feedback := models.Feedback{
+		UserID:     userID,
+		SaccoID:    saccoID,
+		VehicleID:  input.VehicleID,
+		DriverID:   input.DriverID,
+		RouteID:    input.RouteID,
+		Kind:       input.Kind,
+		Category:   input.Category,
+		Message:    message,
+		OccurredAt: input.OccurredAt,
+		Status:     models.FeedbackOpen,
+	}
+	if err := config.DB.Create(&feedback).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("SubmitFeedback: Failed to save feedback.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to submit feedback")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"feedback_id": feedback.ID, "sacco_id": saccoID, "kind": feedback.Kind}).Info("SubmitFeedback: Feedback submitted.")
+	c.JSON(http.StatusCreated, gin.H{"data": feedback})
+}
+
+// loadCommuterFeedback loads the :id feedback if the authenticated commuter filed it.
+func loadCommuterFeedback(c *gin.Context, fn string) (models.Feedback, bool) {
+	return loadFeedback(c, fn, config.DB.Where("user_id = ?", authenticatedUserID(c)))
+}
+
+// loadFeedback loads the :id feedback within query.
+func loadFeedback(c *gin.Context, fn string, query *gorm.DB) (models.Feedback, bool) {
+	var feedback models.Feedback
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return feedback, false
+	}
+	if err := query.Where("id = ?", id).First(&feedback).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Feedback not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("feedback_id", id).Error(fn + ": Failed to load feedback.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load feedback")
+		}
+		return feedback, false
+	}
+	return feedback, true
+}
+
+// UploadFeedbackPhoto attaches a photo from the "photo" form field to the
+// commuter's own feedback while it is still open, replacing any earlier one.
+func UploadFeedbackPhoto(c *gin.Context) {
+	feedback, ok := loadCommuterFeedback(c, "UploadFeedbackPhoto")
+	if !ok {
+		return
+	}
+	if feedback.Status != models.FeedbackOpen {
+		apierror.Respond(c, http.StatusConflict, "Photos can only be added while the feedback is open")
+		return
+	}
+	data, contentType, ext, ok := readUpload(c, photoUpload)
+	if !ok {
+		return
+	}
+	key := fmt.Sprintf("feedback/%d/photo-%s%s", feedback.ID, storage.RandomName(), ext)
+	if !replaceStoredFile(c, "UploadFeedbackPhoto", &feedback, "photo_key", feedback.PhotoKey, key, data, contentType) {
+		return
+	}
+	feedback.PhotoKey = key
+	list := []models.Feedback{feedback}
+	attachFeedbackPhotos(list)
+	c.JSON(http.StatusOK, gin.H{"data": list[0]})
+}
+
+// listFeedback responds with a page of the feedback matching query.
+func listFeedback(c *gin.Context, fn string, query *gorm.DB, opts pagination.Options) {
+	var list []models.Feedback
+	meta, ok := paginate(c, fn, query.Model(&models.Feedback{}), opts, &list)
+	if !ok {
+		return
+	}
+	attachFeedbackPhotos(list)
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// ListMyFeedback returns the feedback the authenticated commuter has filed,
+// with where the sacco has got to with it.
+func ListMyFeedback(c *gin.Context) {
+	listFeedback(c, "ListMyFeedback", config.DB.Where("user_id = ?", authenticatedUserID(c)), feedbackListOptions)
+}
+
+// GetMyFeedback returns one piece of the commuter's feedback.
+func GetMyFeedback(c *gin.Context) {
+	feedback, ok := loadCommuterFeedback(c, "GetMyFeedback")
+	if !ok {
+		return
+	}
+	list := []models.Feedback{feedback}
+	attachFeedbackPhotos(list)
+	c.JSON(http.StatusOK, gin.H{"data": list[0]})
+}
+
+// ListSaccoFeedback returns the feedback about the sacco's vehicles, drivers
+// and routes, filtered by ?status=, ?kind=, ?category= and the like.
+func ListSaccoFeedback(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoFeedback")
+	if !ok {
+		return
+	}
+	listFeedback(c, "ListSaccoFeedback", config.DB.Scopes(tenant.SaccoScope), feedbackListOptions)
+}
+
+// loadSaccoFeedback loads the :id feedback if it is about the authenticated sacco.
+func loadSaccoFeedback(c *gin.Context, fn string) (models.Feedback, bool) {
+	tenant, ok := saccoTenant(c, fn)
+	if !ok {
+		return models.Feedback{}, false
+	}
+	return loadFeedback(c, fn, config.DB.Scopes(tenant.SaccoScope))
+}
+
+// GetSaccoFeedback returns one piece of feedback about the sacco.
+func GetSaccoFeedback(c *gin.Context) {
+	feedback, ok := loadSaccoFeedback(c, "GetSaccoFeedback")
+	if !ok {
+		return
+	}
+	list := []models.Feedback{feedback}
+	attachFeedbackPhotos(list)
+	c.JSON(http.StatusOK, gin.H{"data": list[0]})
+}
+
+// UpdateFeedbackStatus moves feedback about the sacco through triage. Body:
+// {"status": "in_progress" | "resolved" | "open", "resolution": "..."}; a
+// resolution note is required to resolve a complaint. The commuter is sent a
+// push notification when a push channel is registered.
+func UpdateFeedbackStatus(c *gin.Context) {
+	feedback, ok := loadSaccoFeedback(c, "UpdateFeedbackStatus")
+	if !ok {
+		return
+	}
+	var input struct {
+		Status     string `json:"status" binding:"required"`
+		Resolution string `json:"resolution"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	switch input.Status {
+	case models.FeedbackOpen, models.FeedbackInProgress, models.FeedbackResolved:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "status must be open, in_progress or resolved")
+		return
+	}
+	resolution := strings.TrimSpace(input.Resolution)
+	if len(resolution) > 2000 {
+		apierror.Respond(c, http.StatusBadRequest, "resolution can be at most 2000 characters")
+		return
+	}
+	if input.Status == models.FeedbackResolved && feedback.Kind == models.FeedbackComplaint && resolution == "" && feedback.Resolution == "" {
+		apierror.Respond(c, http.StatusBadRequest, "A resolution note is required to resolve a complaint")
+		return
+	}
+
+	updates := map[string]interface{}{
+		"status":     input.Status,
+		"handled_by": authenticatedUserID(c),
+	}
+	if resolution != "" {
+		updates["resolution"] = resolution
+	}
+	if input.Status == models.FeedbackResolved {
+		if feedback.ResolvedAt == nil {
+			updates["resolved_at"] = time.Now()
+		}
+	} else {
+		updates["resolved_at"] = nil
+	}
+	if err := config.DB.Model(&feedback).Updates(updates).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("feedback_id", feedback.ID).Error("UpdateFeedbackStatus: Failed to save status.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update feedback")
+		return
+	}
+	if err := config.DB.First(&feedback, feedback.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("feedback_id", feedback.ID).Error("UpdateFeedbackStatus: Failed to reload feedback.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load feedback")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"feedback_id": feedback.ID, "status": feedback.Status}).Info("UpdateFeedbackStatus: Feedback status updated.")
+	notifyFeedbackStatus(feedback)
+	list := []models.Feedback{feedback}
+	attachFeedbackPhotos(list)
+	c.JSON(http.StatusOK, gin.H{"data": list[0]})
+}
+
+// notifyFeedbackStatus tells the commuter their feedback was taken on or
+// resolved.
+func notifyFeedbackStatus(f models.Feedback) {
+	ch, ok := notify.Lookup(notify.PushChannel)
+	if !ok || f.Status == models.FeedbackOpen {
+		return
+	}
+	body := "The sacco is looking into your " + f.Kind + "."
+	if f.Status == models.FeedbackResolved {
+		body = "The sacco has resolved your " + f.Kind + "."
+		if f.Resolution != "" {
+			body += " " + f.Resolution
+		}
+	}
+	msg := notify.Message{ID: f.ID, Title: "Feedback update", Body: body, Data: map[string]string{
+		"type":        "feedback_status",
+		"feedback_id": strconv.FormatUint(uint64(f.ID), 10),
+		"status":      f.Status,
+	}}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := ch.Send(ctx, notify.Recipient{UserID: f.UserID}, msg); err != nil && !errors.Is(err, notify.ErrUnreachable) {
+			logrus.WithError(err).WithField("feedback_id", f.ID).Warn("notifyFeedbackStatus: Failed to push feedback update.")
+		}
+	}()
+}
+
+// ListUnresolvedComplaints lets admins oversee complaints saccos have not
+// resolved, oldest first by default. ?sacco_id= limits it to one sacco and
+// ?older_than= (e.g. 72h) to complaints filed longer ago than that.
+func ListUnresolvedComplaints(c *gin.Context) {
+	query := config.DB.Where("kind = ? AND status <> ?", models.FeedbackComplaint, models.FeedbackResolved)
+	if raw := c.Query("sacco_id"); raw != "" {
+		id, err := pagination.ParseUint(raw)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid sacco_id")
+			return
+		}
+		query = query.Where("sacco_id = ?", id)
+	}
+	if raw := c.Query("older_than"); raw != "" {
+		age, err := time.ParseDuration(raw)
+		if err != nil || age < 0 {
+			apierror.Respond(c, http.StatusBadRequest, "older_than must be a duration, e.g. 72h")
+			return
+		}
+		query = query.Where("created_at < ?", time.Now().Add(-age))
+	}
+	opts := feedbackListOptions
+	opts.DefaultSort = "created_at"
+	listFeedback(c, "ListUnresolvedComplaints", query, opts)
+}
+
+// GetComplaintSummary gives admins each sacco's unresolved complaints: how
+// many are open and in progress and when the oldest was filed, worst first.
+func GetComplaintSummary(c *gin.Context) {
+	var rows []struct {
+		SaccoID    uint      `json:"sacco_id"`
+		SaccoName  string    `json:"sacco_name"`
+		Open       int64     `json:"open"`
+		InProgress int64     `json:"in_progress"`
+		OldestAt   time.Time `json:"oldest_at"`
+	}
+	err := config.DB.Model(&models.Feedback{}).
+		Select("feedbacks.sacco_id, saccos.name AS sacco_name, "+
+			"COUNT(*) FILTER (WHERE feedbacks.status = ?) AS open, "+
+			"COUNT(*) FILTER (WHERE feedbacks.status = ?) AS in_progress, "+
+			"MIN(feedbacks.created_at) AS oldest_at", models.FeedbackOpen, models.FeedbackInProgress).
+		Joins("LEFT JOIN saccos ON saccos.id = feedbacks.sacco_id").
+		Where("feedbacks.kind = ? AND feedbacks.status <> ?", models.FeedbackComplaint, models.FeedbackResolved).
+		Group("feedbacks.sacco_id, saccos.name").
+		Order("oldest_at").
+		Scan(&rows).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("GetComplaintSummary: Failed to summarize complaints.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to summarize complaints")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/mapmatch"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/routeinfer"
+)
+
+// geometryProposalResponse is a proposal with its line rendered as GeoJSON.
+type geometryProposalResponse struct {
+	models.RouteGeometryProposal
+	GeoJSON string `json:"geometry"`
+}
+
+func toGeometryProposalResponse(p models.RouteGeometryProposal) geometryProposalResponse {
+	geoJSON, _ := convertWKBToGeoJSON(p.Geometry)
+	return geometryProposalResponse{RouteGeometryProposal: p, GeoJSON: geoJSON}
+}
+
+// InferRouteGeometry runs geometry inference for a route immediately instead of
+// waiting for the background job, storing the result as a pending proposal.
+func InferRouteGeometry(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "InferRouteGeometry", "Stages")
+	if !ok {
+		return
+	}
+	if len(route.Stages) < 2 {
+		apierror.Respond(c, http.StatusUnprocessableEntity, "Route needs at least two stages to infer its geometry")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+	proposal, err := routeinfer.Infer(ctx, config.DB, route, mapmatch.FromEnv(), time.Now())
+	if errors.Is(err, routeinfer.ErrNotEnoughTraces) {
+		apierror.Respond(c, http.StatusUnprocessableEntity, "Not enough recent GPS traces cover this route end to end")
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("InferRouteGeometry: Failed to infer geometry.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to infer route geometry")
+		return
+	}
+
+	// A fresh proposal supersedes any still awaiting review.
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RouteGeometryProposal{}).
+			Where("route_id = ? AND status = ?", route.ID, models.GeometryProposalPending).
+			Update("status", models.GeometryProposalRejected).Error; err != nil {
+			return err
+		}
+		return tx.Create(proposal).Error
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("InferRouteGeometry: Failed to save proposal.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save geometry proposal")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "proposal_id": proposal.ID}).Info("InferRouteGeometry: Geometry proposal created.")
+	c.JSON(http.StatusCreated, gin.H{"data": toGeometryProposalResponse(*proposal)})
+}
+
+// ListRouteGeometryProposals lists a route's geometry proposals, newest first.
+// ?status= filters by review state.
+func ListRouteGeometryProposals(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "ListRouteGeometryProposals")
+	if !ok {
+		return
+	}
+	query := config.DB.Where("route_id = ?", route.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var proposals []models.RouteGeometryProposal
+	if err := query.Order("created_at DESC").Find(&proposals).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ListRouteGeometryProposals: Failed to list proposals.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list geometry proposals")
+		return
+	}
+	out := make([]geometryProposalResponse, 0, len(proposals))
+	for _, p := range proposals {
+		out = append(out, toGeometryProposalResponse(p))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// loadPendingProposal loads the :id proposal, checking it belongs to the
+// authenticated sacco and is still awaiting review.
+func loadPendingProposal(c *gin.Context, fn string) (models.RouteGeometryProposal, bool) {
+	proposal, ok := loadOwned[models.RouteGeometryProposal](c, fn, "Geometry proposal", config.DB)
+	if !ok {
+		return proposal, false
+	}
+	if proposal.Status != models.GeometryProposalPending {
+		apierror.Respond(c, http.StatusConflict, "Geometry proposal has already been "+proposal.Status)
+		return proposal, false
+	}
+	return proposal, true
+}
+
+// AcceptGeometryProposal copies a pending proposal onto its route. Stages must
+// lie on the proposed line unless ?snap=true moves them onto it.
+func AcceptGeometryProposal(c *gin.Context) {
+	proposal, ok := loadPendingProposal(c, "AcceptGeometryProposal")
+	if !ok {
+		return
+	}
+	var route models.Route
+	if err := config.DB.First(&route, proposal.RouteID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", proposal.RouteID).Error("AcceptGeometryProposal: Failed to load route.")
+		apierror.Respond(c, http.StatusNotFound, "Route not found")
+		return
+	}
+
+	var stages []models.Stage
+	if err := config.DB.Where("route_id = ?", route.ID).Order("seq").Find(&stages).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("AcceptGeometryProposal: Failed to load stages.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load stages")
+		return
+	}
+	violations, err := checkStagesOnRoute(proposal.Geometry, stages, snapRequested(c))
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("proposal_id", proposal.ID).Error("AcceptGeometryProposal: Failed to decode proposal geometry.")
+		apierror.Respond(c, http.StatusInternalServerError, "Stored proposal geometry is invalid")
+		return
+	}
+	if len(violations) > 0 {
+		respondStageViolations(c, violations)
+		return
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&route).Update("geometry", proposal.Geometry).Error; err != nil {
+			return err
+		}
+		for _, stage := range stages {
+			if err := tx.Model(&stage).Updates(map[string]interface{}{"lat": stage.Lat, "lng": stage.Lng}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&proposal).Updates(map[string]interface{}{"status": models.GeometryProposalAccepted, "reviewed_at": now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RouteGeometryProposal{}).
+			Where("route_id = ? AND status = ? AND id <> ?", route.ID, models.GeometryProposalPending, proposal.ID).
+			Updates(map[string]interface{}{"status": models.GeometryProposalRejected, "reviewed_at": now}).Error
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("proposal_id", proposal.ID).Error("AcceptGeometryProposal: Failed to apply proposal.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to apply geometry proposal")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "proposal_id": proposal.ID}).Info("AcceptGeometryProposal: Route geometry updated from proposal.")
+
+	config.DB.Preload("Stages").Preload("Vehicles").Preload("Tags").First(&route, route.ID)
+	c.JSON(http.StatusOK, gin.H{"data": toRouteResponse(route)})
+}
+
+// RejectGeometryProposal discards a pending proposal. The background job waits
+// routeinfer.RetryAfter before proposing again for the route.
+func RejectGeometryProposal(c *gin.Context) {
+	proposal, ok := loadPendingProposal(c, "RejectGeometryProposal")
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if err := config.DB.Model(&proposal).Updates(map[string]interface{}{"status": models.GeometryProposalRejected, "reviewed_at": now}).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("proposal_id", proposal.ID).Error("RejectGeometryProposal: Failed to reject proposal.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to reject geometry proposal")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": toGeometryProposalResponse(proposal)})
+}
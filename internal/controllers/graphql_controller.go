@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+	graphqllog "github.com/graph-gophers/graphql-go/log"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/graph"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/tenancy"
+)
+
+// Limits on the queries /graphql accepts.
+var (
+	graphMaxDepth       = config.EnvInt("GRAPHQL_MAX_DEPTH", 8)
+	graphMaxQueryLength = config.EnvInt("GRAPHQL_MAX_QUERY_LENGTH", 10000)
+	graphParallelism    = config.EnvInt("GRAPHQL_PARALLELISM", 32) // Resolvers run at once per request
+	graphMaxNodes       = config.EnvInt("GRAPHQL_MAX_NODES", 5000) // Objects one response may hold
+	graphGuestMaxNodes  = config.EnvInt("GRAPHQL_GUEST_MAX_NODES", 500)
+)
+
+const (
+	graphMaxPage      = 100
+	graphGuestMaxPage = 20 // Largest page and nested list guests get
+)
+
+// errGraphBudget fails the fields past a query's node budget.
+var errGraphBudget = errors.New("query returns too many objects; narrow it or page through the results")
+
+// errGraphInternal is what clients see when a resolver fails on the
+// database; the cause is logged.
+var errGraphInternal = errors.New("internal error")
+
+var graphSchema = graphql.MustParseSchema(graph.Schema, &graphQuery{},
+	graphql.MaxDepth(graphMaxDepth),
+	graphql.MaxQueryLength(graphMaxQueryLength),
+	graphql.MaxParallelism(graphParallelism),
+	graphql.Logger(graphqllog.LoggerFunc(func(ctx context.Context, value any) {
+		logrus.WithContext(ctx).WithField("stack", string(debug.Stack())).Errorf("GraphQL: Resolver panicked: %v", value)
+	})),
+)
+
+// graphViewer is who is asking, which decides the routes and driver details
+// resolvers return.
+type graphViewer struct {
+	role     string
+	saccoID  uint // Sacco owned by the caller, for sacco accounts
+	driverID uint // The caller's driver profile, for drivers
+}
+
+// routeScope limits a routes query to what the viewer may see: every route
+// for admins, published routes plus their own for saccos, and published
+// routes for everyone else.
+func (v graphViewer) routeScope(db *gorm.DB) *gorm.DB {
+	switch {
+	case v.role == "admin":
+		return db
+	case v.saccoID != 0:
+		return db.Where("routes.status = ? OR routes.sacco_id = ?", models.RouteStatusPublished, v.saccoID)
+	default:
+		return db.Where("routes.status = ?", models.RouteStatusPublished)
+	}
+}
+
+// seesContacts reports whether the viewer may see a driver's phone and
+// licence number.
+func (v graphViewer) seesContacts(d *models.Driver) bool {
+	return v.role == "admin" || (v.saccoID != 0 && v.saccoID == d.SaccoID) || (v.driverID != 0 && v.driverID == d.ID)
+}
+
+// vehicleScope limits a vehicles query to what the viewer may see: every
+// vehicle for admins, a sacco's own fleet, and otherwise only vehicles
+// assigned to routes the viewer sees, as Route.vehicles returns them.
+func (v graphViewer) vehicleScope(db *gorm.DB) *gorm.DB {
+	if v.role == "admin" {
+		return db
+	}
+	visible := config.Replica().Model(&models.Route{}).Select("routes.id").Scopes(v.routeScope)
+	if v.saccoID != 0 {
+		return db.Where("vehicles.sacco_id = ? OR vehicles.route_id IN (?)", v.saccoID, visible)
+	}
+	return db.Where("vehicles.route_id IN (?)", visible)
+}
+
+// maxList is the most items a list field returns to the viewer, 0 for no
+// limit.
+func (v graphViewer) maxList() int {
+	if v.role == middleware.RoleGuest {
+		return graphGuestMaxPage
+	}
+	return 0
+}
+
+// graphRouteTag is a tag attached to a route.
+type graphRouteTag struct {
+	RouteID uint
+	Name    string
+	Slug    string
+}
+
+// graphState is what the resolvers of one request share: the viewer and
+// loaders that batch lookups across the objects of a list.
+type graphState struct {
+	viewer graphViewer
+	nodes  atomic.Int64 // Objects resolved so far
+	budget int64        // Most objects the response may hold
+
+	routes        *graph.Loader[uint, *models.Route] // Only routes the viewer sees
+	saccos        *graph.Loader[uint, *models.Sacco]
+	drivers       *graph.Loader[uint, *models.Driver]
+	positions     *graph.Loader[uint, *vehiclePosition]
+	stages        *graph.Loader[uint, []models.Stage]  // By route
+	tags          *graph.Loader[uint, []graphRouteTag] // By route
+	routeVehicles *graph.Loader[uint, []models.Vehicle]
+	saccoVehicles *graph.Loader[uint, []models.Vehicle]
+	saccoRoutes   *graph.Loader[uint, []models.Route] // Only routes the viewer sees
+}
+
+type graphStateKey struct{}
+
+func graphStateFrom(ctx context.Context) *graphState {
+	return ctx.Value(graphStateKey{}).(*graphState)
+}
+
+// spend counts n objects about to be resolved against the query's budget,
+// failing once it is used up so a deeply nested query stops fetching rather
+// than fanning out over the whole database.
+func (st *graphState) spend(n int) error {
+	if st.nodes.Add(int64(n)) > st.budget {
+		return errGraphBudget
+	}
+	return nil
+}
+
+// trim cuts a list field to what the viewer may get at once.
+func trim[T any](st *graphState, items []T) []T {
+	if n := st.viewer.maxList(); n > 0 && len(items) > n {
+		return items[:n]
+	}
+	return items
+}
+
+// graphFetchFailed logs a loader's database error and returns the error
+// clients see.
+func graphFetchFailed(ctx context.Context, err error, what string) error {
+	logrus.WithContext(ctx).WithError(err).Error("GraphQL: Failed to load " + what + ".")
+	return errGraphInternal
+}
+
+// byID loads the what rows of T with the given IDs, passing them to loaded
+// when it is set.
+func byID[T any](what string, id func(*T) uint, loaded func([]T), scopes ...func(*gorm.DB) *gorm.DB) func(context.Context, []uint) (map[uint]*T, error) {
+	return func(ctx context.Context, keys []uint) (map[uint]*T, error) {
+		var rows []T
+		if err := config.Replica().WithContext(ctx).Scopes(scopes...).Where("id IN ?", keys).Find(&rows).Error; err != nil {
+			return nil, graphFetchFailed(ctx, err, what)
+		}
+		if loaded != nil {
+			loaded(rows)
+		}
+		out := make(map[uint]*T, len(rows))
+		for i := range rows {
+			out[id(&rows[i])] = &rows[i]
+		}
+		return out, nil
+	}
+}
+
+// groupedBy loads the what rows of T whose column is one of the keys,
+// grouped by it, passing them to loaded when it is set.
+func groupedBy[T any](what, column string, key func(*T) uint, loaded func([]T), scopes ...func(*gorm.DB) *gorm.DB) func(context.Context, []uint) (map[uint][]T, error) {
+	return func(ctx context.Context, keys []uint) (map[uint][]T, error) {
+		var rows []T
+		if err := config.Replica().WithContext(ctx).Scopes(scopes...).Where(column+" IN ?", keys).Find(&rows).Error; err != nil {
+			return nil, graphFetchFailed(ctx, err, what)
+		}
+		if loaded != nil {
+			loaded(rows)
+		}
+		out := make(map[uint][]T)
+		for _, row := range rows {
+			k := key(&row)
+			out[k] = append(out[k], row)
+		}
+		return out, nil
+	}
+}
+
+func orderBy(order string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB { return db.Order(order) }
+}
+
+// The prime methods queue what the fields of freshly loaded objects look up.
+// Priming on load rather than when a list is resolved batches the lookups of
+// nested lists too: the vehicles of every route in a page are fetched
+// together, then the drivers of all those vehicles.
+
+func (st *graphState) primeRoutes(routes []models.Route) {
+	for _, r := range routes {
+		st.saccos.Prime(r.SaccoID)
+		st.stages.Prime(r.ID)
+		st.tags.Prime(r.ID)
+		st.routeVehicles.Prime(r.ID)
+	}
+}
+
+func (st *graphState) primeVehicles(vehicles []models.Vehicle) {
+	for _, v := range vehicles {
+		st.saccos.Prime(v.SaccoID)
+		st.positions.Prime(v.ID)
+		if v.RouteID != 0 {
+			st.routes.Prime(v.RouteID)
+		}
+		if v.DriverID != 0 {
+			st.drivers.Prime(v.DriverID)
+		}
+	}
+}
+
+func (st *graphState) primeSaccos(saccos []models.Sacco) {
+	for _, s := range saccos {
+		st.saccoRoutes.Prime(s.ID)
+		st.saccoVehicles.Prime(s.ID)
+	}
+}
+
+func newGraphState(viewer graphViewer) *graphState {
+	st := &graphState{viewer: viewer, budget: int64(graphMaxNodes)}
+	if viewer.role == middleware.RoleGuest {
+		st.budget = int64(graphGuestMaxNodes)
+	}
+	routeID := func(r *models.Route) uint { return r.ID }
+	vehicleRoute := func(v *models.Vehicle) uint { return v.RouteID }
+	vehicleSacco := func(v *models.Vehicle) uint { return v.SaccoID }
+	st.routes = graph.NewLoader(byID("routes", routeID, st.primeRoutes, viewer.routeScope))
+	st.saccos = graph.NewLoader(byID("saccos", func(s *models.Sacco) uint { return s.ID }, st.primeSaccos))
+	st.drivers = graph.NewLoader(byID("drivers", func(d *models.Driver) uint { return d.ID }, nil))
+	st.stages = graph.NewLoader(groupedBy("stages", "route_id", func(s *models.Stage) uint { return s.RouteID }, nil, orderBy("seq, id")))
+	st.routeVehicles = graph.NewLoader(groupedBy("route vehicles", "route_id", vehicleRoute, st.primeVehicles, orderBy("id")))
+	st.saccoVehicles = graph.NewLoader(groupedBy("sacco vehicles", "sacco_id", vehicleSacco, st.primeVehicles, viewer.vehicleScope, orderBy("id")))
+	st.saccoRoutes = graph.NewLoader(groupedBy("sacco routes", "sacco_id", func(r *models.Route) uint { return r.SaccoID }, st.primeRoutes, viewer.routeScope, orderBy("id")))
+	st.positions = graph.NewLoader(func(ctx context.Context, keys []uint) (map[uint]*vehiclePosition, error) {
+		positions, err := positionsWhere(config.Replica().Where("v.id IN ?", keys))
+		if err != nil {
+			return nil, graphFetchFailed(ctx, err, "positions")
+		}
+		out := make(map[uint]*vehiclePosition, len(positions))
+		for i := range positions {
+			out[positions[i].VehicleID] = &positions[i]
+		}
+		return out, nil
+	})
+	st.tags = graph.NewLoader(func(ctx context.Context, keys []uint) (map[uint][]graphRouteTag, error) {
+		var rows []graphRouteTag
+		if err := config.Replica().WithContext(ctx).Table("route_tags").
+			Select("route_tags.route_id, tags.name, tags.slug").
+			Joins("JOIN tags ON tags.id = route_tags.tag_id AND tags.deleted_at IS NULL").
+			Where("route_tags.route_id IN ?", keys).
+			Order("tags.name").Scan(&rows).Error; err != nil {
+			return nil, graphFetchFailed(ctx, err, "route tags")
+		}
+		out := make(map[uint][]graphRouteTag)
+		for _, row := range rows {
+			out[row.RouteID] = append(out[row.RouteID], row)
+		}
+		return out, nil
+	})
+	return st
+}
+
+// graphViewerOf works out who the caller is.
+func graphViewerOf(c *gin.Context) (graphViewer, error) {
+	t, err := tenancy.Resolve(c)
+	if err != nil {
+		return graphViewer{}, err
+	}
+	viewer := graphViewer{role: t.Role, driverID: t.DriverID()}
+	if t.Sacco != nil {
+		viewer.saccoID = t.Sacco.ID
+	}
+	return viewer, nil
+}
+
+// GraphQL answers a GraphQL query over the route graph: routes with their
+// stages, tags and vehicles, vehicles with their driver and last position,
+// and saccos, so an app can fetch what a screen needs in one request.
+// Body: {"query": "...", "operationName": "...", "variables": {...}}. The
+// response is {"data": ..., "errors": [...]}, as usual for GraphQL. Lookups
+// across a list are batched, so a query costs a few database round trips
+// however many objects it returns. A response holds at most
+// GRAPHQL_MAX_NODES objects (GRAPHQL_GUEST_MAX_NODES for guests, whose lists
+// also stop at 20 items); fields past that fail. The schema is at
+// /graphql/schema.
+func GraphQL(c *gin.Context) {
+	var input struct {
+		Query         string                 `json:"query" binding:"required"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	viewer, err := graphViewerOf(c)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("GraphQL: User not found or unauthorized.")
+		apierror.Respond(c, http.StatusUnauthorized, "User not authorized")
+		return
+	}
+	ctx := context.WithValue(c.Request.Context(), graphStateKey{}, newGraphState(viewer))
+	resp := graphSchema.Exec(ctx, input.Query, input.OperationName, input.Variables)
+	if len(resp.Errors) > 0 {
+		logrus.WithContext(c).WithFields(logrus.Fields{"operation": input.OperationName, "errors": len(resp.Errors)}).
+			Warnf("GraphQL: Query answered with errors: %v", resp.Errors[0])
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GraphQLSchema returns the GraphQL schema, for client code generators.
+func GraphQLSchema(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.String(http.StatusOK, graph.Schema)
+}
+
+func graphID(id uint) graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(id), 10))
+}
+
+func parseGraphID(id graphql.ID) (uint, error) {
+	n, err := strconv.ParseUint(string(id), 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid id %q", string(id))
+	}
+	return uint(n), nil
+}
@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// graphQuery resolves the root Query type of internal/graph's schema.
+type graphQuery struct{}
+
+func (graphQuery) Routes(ctx context.Context, args struct {
+	SaccoID *graphql.ID
+	Tags    *[]string
+	First   int32 // Defaults to 20 in the schema
+	After   *graphql.ID
+}) ([]*graphRoute, error) {
+	st := graphStateFrom(ctx)
+	maxPage := graphMaxPage
+	if n := st.viewer.maxList(); n > 0 {
+		maxPage = n
+	}
+	if args.First < 1 || int(args.First) > maxPage {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxPage)
+	}
+	query := config.Replica().WithContext(ctx).Model(&models.Route{}).Scopes(st.viewer.routeScope)
+	if args.SaccoID != nil {
+		id, err := parseGraphID(*args.SaccoID)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("routes.sacco_id = ?", id)
+	}
+	if args.After != nil {
+		id, err := parseGraphID(*args.After)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("routes.id > ?", id)
+	}
+	if args.Tags != nil {
+		query = withAllTags(query, *args.Tags)
+	}
+	var routes []models.Route
+	if err := query.Order("routes.id").Limit(int(args.First)).Find(&routes).Error; err != nil {
+		return nil, graphFetchFailed(ctx, err, "routes")
+	}
+	if err := st.spend(len(routes)); err != nil {
+		return nil, err
+	}
+	return newGraphRoutes(st, routes), nil
+}
+
+func (graphQuery) Route(ctx context.Context, args struct{ ID graphql.ID }) (*graphRoute, error) {
+	id, err := parseGraphID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	route, err := st.routes.Load(ctx, id)
+	if err != nil || route == nil {
+		return nil, err
+	}
+	return &graphRoute{route}, nil
+}
+
+func (graphQuery) Sacco(ctx context.Context, args struct{ ID graphql.ID }) (*graphSacco, error) {
+	id, err := parseGraphID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	sacco, err := st.saccos.Load(ctx, id)
+	if err != nil || sacco == nil {
+		return nil, err
+	}
+	return &graphSacco{sacco}, nil
+}
+
+func (graphQuery) Vehicle(ctx context.Context, args struct{ ID graphql.ID }) (*graphVehicle, error) {
+	id, err := parseGraphID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	var vehicles []models.Vehicle
+	if err := config.Replica().WithContext(ctx).Scopes(st.viewer.vehicleScope).Where("vehicles.id = ?", id).Limit(1).Find(&vehicles).Error; err != nil {
+		return nil, graphFetchFailed(ctx, err, "vehicle")
+	}
+	if len(vehicles) == 0 {
+		return nil, nil
+	}
+	return newGraphVehicles(st, vehicles)[0], nil
+}
+
+// graphRoute resolves a Route.
+type graphRoute struct {
+	r *models.Route
+}
+
+// newGraphRoutes wraps routes queried directly rather than through a
+// loader, priming the loaders for their fields.
+func newGraphRoutes(st *graphState, routes []models.Route) []*graphRoute {
+	st.primeRoutes(routes)
+	return wrapGraphRoutes(routes)
+}
+
+func wrapGraphRoutes(routes []models.Route) []*graphRoute {
+	out := make([]*graphRoute, len(routes))
+	for i := range routes {
+		out[i] = &graphRoute{&routes[i]}
+	}
+	return out
+}
+
+func (r *graphRoute) ID() graphql.ID      { return graphID(r.r.ID) }
+func (r *graphRoute) Name() string        { return r.r.Name }
+func (r *graphRoute) Description() string { return r.r.Description }
+func (r *graphRoute) Status() string      { return r.r.Status }
+
+func (r *graphRoute) Sacco(ctx context.Context) (*graphSacco, error) {
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	sacco, err := st.saccos.Load(ctx, r.r.SaccoID)
+	if err != nil {
+		return nil, err
+	}
+	if sacco == nil {
+		return nil, errors.New("sacco not found")
+	}
+	return &graphSacco{sacco}, nil
+}
+
+func (r *graphRoute) Stages(ctx context.Context) ([]*graphStage, error) {
+	st := graphStateFrom(ctx)
+	stages, err := st.stages.Load(ctx, r.r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.spend(len(stages)); err != nil {
+		return nil, err
+	}
+	out := make([]*graphStage, len(stages))
+	for i := range stages {
+		out[i] = &graphStage{&stages[i]}
+	}
+	return out, nil
+}
+
+func (r *graphRoute) Vehicles(ctx context.Context, args struct{ InService *bool }) ([]*graphVehicle, error) {
+	st := graphStateFrom(ctx)
+	vehicles, err := st.routeVehicles.Load(ctx, r.r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if args.InService != nil {
+		matching := make([]models.Vehicle, 0, len(vehicles))
+		for _, v := range vehicles {
+			if v.InService == *args.InService {
+				matching = append(matching, v)
+			}
+		}
+		vehicles = matching
+	}
+	vehicles = trim(st, vehicles)
+	if err := st.spend(len(vehicles)); err != nil {
+		return nil, err
+	}
+	return wrapGraphVehicles(vehicles), nil
+}
+
+func (r *graphRoute) Tags(ctx context.Context) ([]*graphTag, error) {
+	st := graphStateFrom(ctx)
+	tags, err := st.tags.Load(ctx, r.r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.spend(len(tags)); err != nil {
+		return nil, err
+	}
+	out := make([]*graphTag, len(tags))
+	for i := range tags {
+		out[i] = &graphTag{&tags[i]}
+	}
+	return out, nil
+}
+
+// graphStage resolves a Stage.
+type graphStage struct {
+	s *models.Stage
+}
+
+func (s *graphStage) ID() graphql.ID { return graphID(s.s.ID) }
+func (s *graphStage) Name() string   { return s.s.Name }
+func (s *graphStage) Seq() int32     { return int32(s.s.Seq) }
+func (s *graphStage) Lat() float64   { return s.s.Lat }
+func (s *graphStage) Lng() float64   { return s.s.Lng }
+
+func (s *graphStage) StopID() *graphql.ID {
+	if s.s.StopID == 0 {
+		return nil
+	}
+	id := graphID(s.s.StopID)
+	return &id
+}
+
+// graphTag resolves a Tag.
+type graphTag struct {
+	t *graphRouteTag
+}
+
+func (t *graphTag) Name() string { return t.t.Name }
+func (t *graphTag) Slug() string { return t.t.Slug }
+
+// graphSacco resolves a Sacco.
+type graphSacco struct {
+	s *models.Sacco
+}
+
+func (s *graphSacco) ID() graphql.ID { return graphID(s.s.ID) }
+func (s *graphSacco) Name() string   { return s.s.Name }
+func (s *graphSacco) Region() string { return s.s.Region }
+
+func (s *graphSacco) Branding() *graphBranding {
+	return &graphBranding{publicBranding(*s.s)}
+}
+
+func (s *graphSacco) Routes(ctx context.Context) ([]*graphRoute, error) {
+	st := graphStateFrom(ctx)
+	routes, err := st.saccoRoutes.Load(ctx, s.s.ID)
+	if err != nil {
+		return nil, err
+	}
+	routes = trim(st, routes)
+	if err := st.spend(len(routes)); err != nil {
+		return nil, err
+	}
+	return wrapGraphRoutes(routes), nil
+}
+
+func (s *graphSacco) Vehicles(ctx context.Context) ([]*graphVehicle, error) {
+	st := graphStateFrom(ctx)
+	vehicles, err := st.saccoVehicles.Load(ctx, s.s.ID)
+	if err != nil {
+		return nil, err
+	}
+	vehicles = trim(st, vehicles)
+	if err := st.spend(len(vehicles)); err != nil {
+		return nil, err
+	}
+	return wrapGraphVehicles(vehicles), nil
+}
+
+// graphBranding resolves a Branding.
+type graphBranding struct {
+	b models.SaccoBranding
+}
+
+func (b *graphBranding) DisplayName() string { return b.b.DisplayName }
+func (b *graphBranding) Color() string       { return b.b.Color }
+
+func (b *graphBranding) LogoURL() *string {
+	if b.b.LogoURL == "" {
+		return nil
+	}
+	return &b.b.LogoURL
+}
+
+// graphVehicle resolves a Vehicle.
+type graphVehicle struct {
+	v *models.Vehicle
+}
+
+// newGraphVehicles wraps vehicles as newGraphRoutes does routes.
+func newGraphVehicles(st *graphState, vehicles []models.Vehicle) []*graphVehicle {
+	st.primeVehicles(vehicles)
+	return wrapGraphVehicles(vehicles)
+}
+
+func wrapGraphVehicles(vehicles []models.Vehicle) []*graphVehicle {
+	out := make([]*graphVehicle, len(vehicles))
+	for i := range vehicles {
+		out[i] = &graphVehicle{&vehicles[i]}
+	}
+	return out
+}
+
+func (v *graphVehicle) ID() graphql.ID          { return graphID(v.v.ID) }
+func (v *graphVehicle) VehicleNo() string       { return v.v.VehicleNo }
+func (v *graphVehicle) Registration() string    { return v.v.VehicleRegistration }
+func (v *graphVehicle) Capacity() int32         { return int32(v.v.Capacity) }
+func (v *graphVehicle) InService() bool         { return v.v.InService }
+func (v *graphVehicle) Status() string          { return v.v.Status }
+func (v *graphVehicle) OccupancyStatus() string { return v.v.OccupancyStatus }
+
+func (v *graphVehicle) Sacco(ctx context.Context) (*graphSacco, error) {
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	sacco, err := st.saccos.Load(ctx, v.v.SaccoID)
+	if err != nil {
+		return nil, err
+	}
+	if sacco == nil {
+		return nil, errors.New("sacco not found")
+	}
+	return &graphSacco{sacco}, nil
+}
+
+func (v *graphVehicle) Route(ctx context.Context) (*graphRoute, error) {
+	if v.v.RouteID == 0 {
+		return nil, nil
+	}
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	route, err := st.routes.Load(ctx, v.v.RouteID)
+	if err != nil || route == nil {
+		return nil, err
+	}
+	return &graphRoute{route}, nil
+}
+
+func (v *graphVehicle) Driver(ctx context.Context) (*graphDriver, error) {
+	st := graphStateFrom(ctx)
+	if v.v.DriverID == 0 || st.viewer.role == middleware.RoleGuest {
+		return nil, nil
+	}
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	driver, err := st.drivers.Load(ctx, v.v.DriverID)
+	if err != nil || driver == nil {
+		return nil, err
+	}
+	return &graphDriver{driver, st.viewer.seesContacts(driver)}, nil
+}
+
+func (v *graphVehicle) Position(ctx context.Context) (*graphPosition, error) {
+	st := graphStateFrom(ctx)
+	if err := st.spend(1); err != nil {
+		return nil, err
+	}
+	p, err := st.positions.Load(ctx, v.v.ID)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return &graphPosition{p}, nil
+}
+
+// graphDriver resolves a Driver.
+type graphDriver struct {
+	d        *models.Driver
+	contacts bool // Whether the viewer may see the phone and licence number
+}
+
+func (d *graphDriver) ID() graphql.ID { return graphID(d.d.ID) }
+func (d *graphDriver) Name() string   { return d.d.Name }
+
+func (d *graphDriver) Phone() *string {
+	if !d.contacts {
+		return nil
+	}
+	return &d.d.Phone
+}
+
+func (d *graphDriver) LicenseNumber() *string {
+	if !d.contacts {
+		return nil
+	}
+	return &d.d.LicenseNumber
+}
+
+// graphPosition resolves a Position.
+type graphPosition struct {
+	p *vehiclePosition
+}
+
+func (p *graphPosition) Latitude() float64       { return p.p.Latitude }
+func (p *graphPosition) Longitude() float64      { return p.p.Longitude }
+func (p *graphPosition) Accuracy() float64       { return p.p.Accuracy }
+func (p *graphPosition) Speed() float64          { return p.p.Speed }
+func (p *graphPosition) Bearing() float64        { return p.p.Bearing }
+func (p *graphPosition) Source() string          { return p.p.Source }
+func (p *graphPosition) Timestamp() graphql.Time { return graphql.Time{Time: p.p.Timestamp} }
+func (p *graphPosition) AgeSeconds() float64     { return p.p.AgeSeconds }
+func (p *graphPosition) Stale() bool             { return p.p.Stale }
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// graphRouter seeds twoSaccos plus a published route of sacco 2 served by
+// its vehicle 3 and four stages, and serves /graphql to the given user.
+func graphRouter(t *testing.T, userID uint, role string) *gin.Engine {
+	t.Helper()
+	r := twoSaccos(t, userID, role)
+	rows := []interface{}{
+		&models.Route{Model: gorm.Model{ID: 1}, SaccoID: 2, Name: "CBD - Rongai", Status: models.RouteStatusPublished},
+		&models.Vehicle{Model: gorm.Model{ID: 3}, SaccoID: 2, RouteID: 1, VehicleNo: "KBB 003B"},
+	}
+	for i := 1; i <= 4; i++ {
+		rows = append(rows, &models.Stage{RouteID: 1, Seq: i, Name: "Stage"})
+	}
+	for _, row := range rows {
+		if err := config.DB.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+	r.POST("/graphql", GraphQL)
+	return r
+}
+
+func graphExec(t *testing.T, r *gin.Engine, query string) (data map[string]interface{}, errs []string) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range resp.Errors {
+		errs = append(errs, e.Message)
+	}
+	return resp.Data, errs
+}
+
+func TestGraphQLSaccoVehiclesScoped(t *testing.T) {
+	r := graphRouter(t, 1, "sacco")
+	data, errs := graphExec(t, r, `{ sacco(id: 2) { vehicles { id } } other: vehicle(id: 2) { id } own: vehicle(id: 1) { id } }`)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	vehicles := data["sacco"].(map[string]interface{})["vehicles"].([]interface{})
+	if len(vehicles) != 1 || vehicles[0].(map[string]interface{})["id"] != "3" {
+		t.Errorf("sacco 2's vehicles = %v; want only vehicle 3, on its published route", vehicles)
+	}
+	if data["other"] != nil {
+		t.Errorf("vehicle 2 = %v; want null for another sacco's unassigned vehicle", data["other"])
+	}
+	if data["own"] == nil {
+		t.Error("vehicle 1 = null; want the sacco's own vehicle")
+	}
+}
+
+func TestGraphQLGuestLimits(t *testing.T) {
+	r := graphRouter(t, 0, middleware.RoleGuest)
+	if _, errs := graphExec(t, r, `{ routes(first: 50) { id } }`); len(errs) == 0 {
+		t.Error("guest asked for 50 routes without an error")
+	}
+	if _, errs := graphExec(t, r, `{ routes(first: 20) { id } }`); len(errs) != 0 {
+		t.Errorf("guest page of 20: %v", errs)
+	}
+}
+
+func TestGraphQLNodeBudget(t *testing.T) {
+	graphRouter(t, 3, "admin")
+	run := func(budget int64) []string {
+		st := newGraphState(graphViewer{role: "admin"})
+		st.budget = budget
+		ctx := context.WithValue(context.Background(), graphStateKey{}, st)
+		resp := graphSchema.Exec(ctx, `{ routes { id stages { id } } }`, "", nil)
+		var errs []string
+		for _, e := range resp.Errors {
+			errs = append(errs, e.Message)
+		}
+		return errs
+	}
+	if errs := run(5); len(errs) != 0 { // The route and its four stages
+		t.Errorf("within budget: %v", errs)
+	}
+	if errs := run(4); len(errs) == 0 || errs[0] != errGraphBudget.Error() {
+		t.Errorf("over budget: errors %v; want %q", errs, errGraphBudget)
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"ma3_tracker/internal/grpcapi"
+	"ma3_tracker/internal/grpcapi/locationsv1"
+)
+
+var grpcLocationUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_location_updates_total",
+	Help: "Location updates streamed over gRPC, by outcome.",
+}, []string{"outcome"})
+
+// LocationIngestion serves the gRPC LocationIngestion service of
+// proto/locations/v1, for fleet hardware that streams a driver's locations
+// over gRPC instead of the WebSocket.
+type LocationIngestion struct {
+	locationsv1.UnimplementedLocationIngestionServer
+}
+
+// StreamLocations feeds a driver's updates through the same pipeline as
+// their WebSocket location messages, acknowledging each in turn. The stream
+// ends with Unavailable when the server shuts down, for the device to
+// reconnect.
+func (LocationIngestion) StreamLocations(stream locationsv1.LocationIngestion_StreamLocationsServer) error {
+	ctx := stream.Context()
+	caller, ok := grpcapi.CallerFrom(ctx)
+	if !ok || caller.Role != "driver" {
+		return status.Error(codes.PermissionDenied, "only drivers can stream locations")
+	}
+	log := logrus.WithContext(ctx).WithFields(logrus.Fields{"driver_id": caller.DriverID, "sacco_id": caller.SaccoID})
+	log.Info("StreamLocations: Driver stream opened.")
+
+	updates := make(chan *locationsv1.LocationUpdate)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			update, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case updates <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-grpcapi.Stopping():
+			log.Info("StreamLocations: Ending stream for shutdown.")
+			return status.Error(codes.Unavailable, "server is shutting down; reconnect")
+		case <-ctx.Done():
+			// The client left, or its token expired
+			return status.FromContextError(ctx.Err()).Err()
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				log.Info("StreamLocations: Driver stream closed.")
+				return nil
+			}
+			return err
+		case update := <-updates:
+			if err := stream.Send(ingestStreamedLocation(caller, update)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ingestStreamedLocation processes one update from a driver's stream.
+func ingestStreamedLocation(caller grpcapi.Caller, u *locationsv1.LocationUpdate) *locationsv1.LocationAck {
+	ack := &locationsv1.LocationAck{Seq: u.GetSeq()}
+	reject := func(msg string) *locationsv1.LocationAck {
+		grpcLocationUpdates.WithLabelValues(locationRejected).Inc()
+		ack.Status, ack.Error = locationRejected, msg
+		return ack
+	}
+	if u.GetDriverId() != 0 && uint(u.GetDriverId()) != caller.DriverID {
+		logrus.WithFields(logrus.Fields{
+			"authenticated_driver_id": caller.DriverID,
+			"payload_driver_id":       u.GetDriverId(),
+		}).Warn("StreamLocations: Driver attempted to send location for a different driver ID. Denying.")
+		return reject("Unauthorized location update.")
+	}
+	if u.GetLatitude() < -90 || u.GetLatitude() > 90 || u.GetLongitude() < -180 || u.GetLongitude() > 180 {
+		return reject("Latitude or longitude out of range.")
+	}
+	if u.GetTimestampMs() <= 0 {
+		return reject("timestamp_ms is required.")
+	}
+
+	outcome := ingestDriverLocation(nil, LocationData{
+		DriverID:  caller.DriverID,
+		Latitude:  u.GetLatitude(),
+		Longitude: u.GetLongitude(),
+		Accuracy:  u.GetAccuracy(),
+		Speed:     u.GetSpeed(),
+		Bearing:   u.GetBearing(),
+		Altitude:  u.GetAltitude(),
+		Timestamp: time.UnixMilli(u.GetTimestampMs()).UTC(),
+	}, caller.SaccoID)
+	grpcLocationUpdates.WithLabelValues(outcome.Status).Inc()
+	ack.Status = outcome.Status
+	ack.EventType = outcome.EventType
+	ack.Distance = outcome.Distance
+	ack.IsMoving = outcome.IsMoving
+	ack.SequenceId = uint64(outcome.SequenceID)
+	ack.TripId = uint64(outcome.TripID)
+	ack.Error = outcome.Error
+	return ack
+}
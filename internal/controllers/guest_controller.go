@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// errInvalidGuestToken is returned when a signup presents a guest token that can't be converted.
+var errInvalidGuestToken = errors.New("invalid guest_token")
+
+// favoriteInput is a favorite the client saved locally (guest) or is adding now.
+type favoriteInput struct {
+	RouteID uint   `json:"route_id" binding:"required"`
+	StageID uint   `json:"stage_id"`
+	Label   string `json:"label"`
+}
+
+// CreateGuestSession issues a rate-limited, read-only guest token so visitors can
+// browse routes and the live map before signing up.
+func CreateGuestSession(c *gin.Context) {
+	guestID, err := middleware.NewGuestID()
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateGuestSession: Failed to generate guest ID.")
+		apierror.Respond(c, http.StatusInternalServerError, "could not create guest session")
+		return
+	}
+
+	token, expiresAt, err := middleware.GenerateGuestToken(guestID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateGuestSession: Failed to sign guest token.")
+		apierror.Respond(c, http.StatusInternalServerError, "could not generate token")
+		return
+	}
+
+	session := models.GuestSession{
+		GuestID:   guestID,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: expiresAt,
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateGuestSession: Failed to persist guest session.")
+		apierror.Respond(c, http.StatusInternalServerError, "could not create guest session")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"role":       middleware.RoleGuest,
+		"guest_id":   guestID,
+		"expires_at": expiresAt,
+	})
+}
+
+// convertGuestSession links a guest session to the new commuter account and
+// imports the favorites the guest saved locally. It runs inside the signup transaction.
+func convertGuestSession(tx *gorm.DB, user *models.User, guestToken string, favorites []favoriteInput) error {
+	if guestToken != "" {
+		claims, err := middleware.ValidateToken(guestToken)
+		if err != nil || claims.Role != middleware.RoleGuest || claims.GuestID == "" {
+			return errInvalidGuestToken
+		}
+		now := time.Now()
+		res := tx.Model(&models.GuestSession{}).
+			Where("guest_id = ? AND converted_user_id IS NULL", claims.GuestID).
+			Updates(map[string]interface{}{"converted_user_id": user.ID, "converted_at": &now})
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+	return saveFavorites(tx, user.ID, favorites)
+}
+
+// saveFavorites stores favorites for a user, skipping duplicates and unknown routes.
+func saveFavorites(tx *gorm.DB, userID uint, favorites []favoriteInput) error {
+	for _, f := range favorites {
+		var count int64
+		if err := tx.Model(&models.Route{}).Where("id = ?", f.RouteID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			logrus.WithField("route_id", f.RouteID).Warn("saveFavorites: Skipping favorite for unknown route.")
+			continue
+		}
+		fav := models.CommuterFavorite{UserID: userID, RouteID: f.RouteID, StageID: f.StageID, Label: f.Label}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fav).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListFavorites returns the authenticated commuter's saved routes and stages.
+func ListFavorites(c *gin.Context) {
+	userID := authenticatedUserID(c)
+	var favorites []models.CommuterFavorite
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&favorites).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("ListFavorites: Database error fetching favorites.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch favorites")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": favorites})
+}
+
+// AddFavorites saves one or more favorites for the authenticated commuter.
+func AddFavorites(c *gin.Context) {
+	var input struct {
+		Favorites []favoriteInput `json:"favorites" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	userID := authenticatedUserID(c)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return saveFavorites(tx, userID, input.Favorites)
+	}); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("AddFavorites: Failed to save favorites.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save favorites")
+		return
+	}
+	ListFavorites(c)
+}
+
+// DeleteFavorite removes one of the authenticated commuter's favorites.
+func DeleteFavorite(c *gin.Context) {
+	favID, ok := parseUintParam(c, "id", "DeleteFavorite")
+	if !ok {
+		return
+	}
+	res := config.DB.Where("id = ? AND user_id = ?", favID, authenticatedUserID(c)).Delete(&models.CommuterFavorite{})
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).Error("DeleteFavorite: Failed to delete favorite.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete favorite")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "Favorite not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Favorite deleted successfully"})
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/headway"
+	"ma3_tracker/internal/models"
+)
+
+// routeHeadway is a route's overall headway regularity.
+type routeHeadway struct {
+	headway.Stats
+	RouteName string `json:"route_name"`
+}
+
+// stageHeadway is the headway regularity at one stage of a route.
+type stageHeadway struct {
+	headway.Stats
+	StageName string `json:"stage_name"`
+	Seq       int    `json:"seq"`
+}
+
+// GetHeadwayReport compares how evenly spaced the vehicles on each of the
+// sacco's routes were between ?from= and ?to= (default the last 7 days),
+// least regular (highest cv) first. See GetRouteHeadways for one route's
+// stages.
+func GetHeadwayReport(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetHeadwayReport")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	stats, err := headway.Report(config.Replica(), config.Replica().Scopes(tenant.SaccoScope), from, to)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetHeadwayReport: Failed to compute headways.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build headway report")
+		return
+	}
+	var out []routeHeadway
+	var routeIDs []uint
+	for _, s := range stats {
+		if s.StageID == nil {
+			out = append(out, routeHeadway{Stats: s})
+			routeIDs = append(routeIDs, s.RouteID)
+		}
+	}
+	if len(routeIDs) > 0 {
+		var routes []models.Route
+		if err := config.Replica().Unscoped().Select("id", "name").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetHeadwayReport: Failed to load routes.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to build headway report")
+			return
+		}
+		names := make(map[uint]string, len(routes))
+		for _, r := range routes {
+			names[r.ID] = r.Name
+		}
+		for i := range out {
+			out[i].RouteName = names[out[i].RouteID]
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return cvOf(out[i].Stats) > cvOf(out[j].Stats) })
+	c.JSON(http.StatusOK, gin.H{"data": out, "from": from, "to": to})
+}
+
+// GetRouteHeadways reports the headway regularity of one of the sacco's
+// routes between ?from= and ?to= (default the last 7 days), overall and at
+// each stage.
+func GetRouteHeadways(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "GetRouteHeadways")
+	if !ok {
+		return
+	}
+	routeHeadways(c, "GetRouteHeadways", route)
+}
+
+// GetPublicRouteHeadways is GetRouteHeadways for API-key holders such as
+// county transport authorities. Only published routes are available.
+func GetPublicRouteHeadways(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "GetPublicRouteHeadways")
+	if !ok {
+		return
+	}
+	var route models.Route
+	if err := config.Replica().Where("id = ? AND status = ?", id, models.RouteStatusPublished).First(&route).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("route_id", id).Error("GetPublicRouteHeadways: Failed to load route.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch route")
+		}
+		return
+	}
+	routeHeadways(c, "GetPublicRouteHeadways", route)
+}
+
+// routeHeadways responds with the route's headways over the requested period.
+func routeHeadways(c *gin.Context, fn string, route models.Route) {
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	stats, err := headway.Report(config.Replica(), config.Replica().Where("route_id = ?", route.ID), from, to)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error(fn + ": Failed to compute headways.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to compute headways")
+		return
+	}
+	var stages []models.Stage
+	if err := config.Replica().Unscoped().Select("id", "name", "seq").Where("route_id = ?", route.ID).Find(&stages).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error(fn + ": Failed to load stages.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to compute headways")
+		return
+	}
+	byID := make(map[uint]models.Stage, len(stages))
+	for _, s := range stages {
+		byID[s.ID] = s
+	}
+
+	overall := routeHeadway{Stats: headway.Stats{RouteID: route.ID}, RouteName: route.Name}
+	perStage := []stageHeadway{}
+	for _, s := range stats {
+		if s.StageID == nil {
+			overall.Stats = s
+			continue
+		}
+		stage := byID[*s.StageID]
+		perStage = append(perStage, stageHeadway{Stats: s, StageName: stage.Name, Seq: stage.Seq})
+	}
+	sort.Slice(perStage, func(i, j int) bool { return perStage[i].Seq < perStage[j].Seq })
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"overall": overall, "stages": perStage}, "from": from, "to": to})
+}
+
+// cvOf orders stats without a coefficient of variation last.
+func cvOf(s headway.Stats) float64 {
+	if s.CV == nil {
+		return -1
+	}
+	return *s.CV
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/heatmap"
+)
+
+// maxHeatmapSpan bounds the time window a heatmap tile covers.
+const maxHeatmapSpan = 31 * 24 * time.Hour
+
+// GetHeatmapTile renders the density of vehicle positions reported between
+// ?from= and ?to= (default the last 24 hours, at most 31 days) as the
+// z/x/y map tile. The tile format comes from the extension on y (.png,
+// .mvt or .pbf) or ?format=, PNG by default. Sacco users see their own
+// vehicles; admins see all of them, or one sacco's with ?sacco_id=.
+// ?route_id= and ?vehicle_id= narrow it down, ?weight=vehicles counts
+// distinct vehicles instead of points, and ?max= fixes the PNG color
+// scale so neighbouring tiles match.
+func GetHeatmapTile(c *gin.Context) {
+	yParam, ext, _ := strings.Cut(c.Param("y"), ".")
+	var tile heatmap.Tile
+	var err1, err2, err3 error
+	tile.Z, err1 = strconv.Atoi(c.Param("z"))
+	tile.X, err2 = strconv.Atoi(c.Param("x"))
+	tile.Y, err3 = strconv.Atoi(yParam)
+	if err := errors.Join(err1, err2, err3); err != nil || tile.Validate() != nil {
+		apierror.Respond(c, http.StatusBadRequest, "Invalid tile coordinates")
+		return
+	}
+	if ext == "" {
+		ext = strings.ToLower(c.DefaultQuery("format", "png"))
+	}
+	if ext != "png" && ext != "mvt" && ext != "pbf" {
+		apierror.Respond(c, http.StatusBadRequest, "Unsupported format. Use png or mvt.")
+		return
+	}
+	from, to, ok := parseTimeRange(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	if to.Sub(from) > maxHeatmapSpan {
+		apierror.Respond(c, http.StatusBadRequest, "The time window can be at most 31 days")
+		return
+	}
+	weight := "COUNT(*)"
+	switch c.DefaultQuery("weight", "points") {
+	case "points":
+	case "vehicles":
+		weight = "COUNT(DISTINCT vehicle_id)"
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "weight must be points or vehicles")
+		return
+	}
+	var max float64
+	if raw := c.Query("max"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, "max must be a positive number")
+			return
+		}
+		max = v
+	}
+
+	scope := config.Replica().Where("v.deleted_at IS NULL")
+	if role, _ := c.Get("role"); role == "sacco" {
+		tenant, ok := saccoTenant(c, "GetHeatmapTile")
+		if !ok {
+			return
+		}
+		scope = scope.Scopes(tenant.SaccoScopeOn("v.sacco_id"))
+	}
+	for _, name := range []string{"sacco_id", "route_id", "vehicle_id"} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		column := "v." + name
+		if name == "vehicle_id" {
+			column = "v.id"
+		}
+		scope = scope.Where(column+" = ?", id)
+	}
+
+	// Cells are counted in the tile's pixel space: Web Mercator x and y
+	// scaled to the zoom level, relative to the tile's corner.
+	west, south, east, north := tile.Bounds()
+	n := float64(int(1) << tile.Z)
+	var cells []heatmap.Cell
+	err := config.Replica().Table("(?) AS p", config.Replica().Table("location_histories AS lh").
+		Select(`COALESCE(lh.matched_latitude, lh.latitude) AS lat, COALESCE(lh.matched_longitude, lh.longitude) AS lng, lh.vehicle_id`).
+		Joins("JOIN vehicles v ON v.id = lh.vehicle_id").
+		Where("lh.timestamp >= ? AND lh.timestamp < ? AND lh.deleted_at IS NULL", from, to).
+		Where(scope)).
+		Select(`FLOOR(((lng + 180) / 360 * ? - ?) * ?) AS x,
+			FLOOR(((1 - LN(TAN(RADIANS(lat)) + 1 / COS(RADIANS(lat))) / PI()) / 2 * ? - ?) * ?) AS y,
+			`+weight+` AS weight`, n, tile.X, heatmap.Cells, n, tile.Y, heatmap.Cells).
+		Where("lat BETWEEN ? AND ? AND lng BETWEEN ? AND ?", south, north, west, east).
+		Group("1, 2").
+		Scan(&cells).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("tile", c.Param("z")+"/"+c.Param("x")+"/"+c.Param("y")).Error("GetHeatmapTile: Failed to count positions.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build heatmap tile")
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=60")
+	if ext == "png" {
+		var buf bytes.Buffer
+		if err := heatmap.PNG(&buf, cells, max); err != nil {
+			logrus.WithContext(c).WithError(err).Error("GetHeatmapTile: Failed to encode PNG.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to build heatmap tile")
+			return
+		}
+		c.Data(http.StatusOK, "image/png", buf.Bytes())
+		return
+	}
+	c.Data(http.StatusOK, "application/vnd.mapbox-vector-tile", heatmap.MVT(cells, "heatmap"))
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/tenancy"
+)
+
+// authenticatedUserID returns the user ID placed in the context by the JWT middleware.
+func authenticatedUserID(c *gin.Context) uint {
+	return uint(c.MustGet("user_id").(float64))
+}
+
+// parseUintParam parses a numeric path parameter, responding with 400 on failure.
+func parseUintParam(c *gin.Context, name, fn string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Warnf("%s: Invalid %s in parameter.", fn, name)
+		apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// authenticatedTenant returns the request's tenant, resolved once per
+// request, responding with 401/403 when the caller cannot be resolved.
+func authenticatedTenant(c *gin.Context, fn string) (*tenancy.Tenant, bool) {
+	t, err := tenancy.Resolve(c)
+	if err != nil {
+		if errors.Is(err, tenancy.ErrNoProfile) {
+			logrus.WithContext(c).WithField("user_id", authenticatedUserID(c)).Warn(fn + ": User has no profile for their role.")
+			apierror.Respond(c, http.StatusForbidden, "Access denied")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("user_id", authenticatedUserID(c)).Error(fn + ": User not found or unauthorized.")
+			apierror.Respond(c, http.StatusUnauthorized, "User not authorized")
+		}
+		return nil, false
+	}
+	return t, true
+}
+
+// saccoTenant returns the tenant of the authenticated sacco owner, whose
+// scopes limit queries to the sacco's rows, responding with 401/403 when
+// the caller is not a sacco owner.
+func saccoTenant(c *gin.Context, fn string) (*tenancy.Tenant, bool) {
+	t, ok := authenticatedTenant(c, fn)
+	if !ok {
+		return nil, false
+	}
+	if t.Sacco == nil {
+		logrus.WithContext(c).WithField("user_id", t.UserID).Warn(fn + ": User is not a sacco owner or has no associated sacco.")
+		apierror.Respond(c, http.StatusForbidden, "Access denied")
+		return nil, false
+	}
+	return t, true
+}
+
+// pathSaccoTenant returns the tenant of the caller when it may read the sacco
+// with saccoID, named in the path: admins any sacco, sacco owners only their
+// own. Otherwise it responds with 401/403.
+func pathSaccoTenant(c *gin.Context, fn string, saccoID uint) (*tenancy.Tenant, bool) {
+	t, ok := authenticatedTenant(c, fn)
+	if !ok {
+		return nil, false
+	}
+	if !t.Admin() && (t.Sacco == nil || t.Sacco.ID != saccoID) {
+		logrus.WithContext(c).WithFields(logrus.Fields{"user_id": t.UserID, "sacco_id": saccoID}).Warn(fn + ": Sacco does not belong to the caller.")
+		apierror.Respond(c, http.StatusForbidden, "Access denied")
+		return nil, false
+	}
+	return t, true
+}
+
+// authenticatedSacco loads the sacco owned by the authenticated user, responding
+// with 401/403 when the caller is not a sacco owner.
+func authenticatedSacco(c *gin.Context, fn string) (*models.Sacco, bool) {
+	t, ok := saccoTenant(c, fn)
+	if !ok {
+		return nil, false
+	}
+	return t.Sacco, true
+}
+
+// authenticatedDriver loads the driver profile of the authenticated user.
+func authenticatedDriver(c *gin.Context, fn string) (*models.Driver, bool) {
+	t, ok := authenticatedTenant(c, fn)
+	if !ok {
+		return nil, false
+	}
+	if t.Driver == nil {
+		logrus.WithContext(c).WithField("user_id", t.UserID).Warn(fn + ": User has no driver profile.")
+		apierror.Respond(c, http.StatusForbidden, "Access denied")
+		return nil, false
+	}
+	return t.Driver, true
+}
+
+// loadOwned loads the T named by the :id path parameter through query,
+// scoped to the authenticated sacco's rows. A row of another sacco is
+// answered like a missing one, 404 "<what> not found", so handlers cannot
+// forget the ownership check.
+func loadOwned[T any](c *gin.Context, fn, what string, query *gorm.DB) (T, bool) {
+	var row T
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return row, false
+	}
+	t, ok := saccoTenant(c, fn)
+	if !ok {
+		return row, false
+	}
+	if err := t.Scoped(query).First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, what+" not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("id", id).Errorf("%s: Failed to load %s.", fn, strings.ToLower(what))
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load "+strings.ToLower(what))
+		}
+		return row, false
+	}
+	return row, true
+}
+
+// loadSaccoRoute loads the route named by the :id path parameter, scoped to
+// the authenticated sacco's routes; another sacco's route is not found.
+func loadSaccoRoute(c *gin.Context, fn string, preloads ...string) (models.Route, *models.Sacco, bool) {
+	var route models.Route
+	rID, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return route, nil, false
+	}
+	t, ok := saccoTenant(c, fn)
+	if !ok {
+		return route, nil, false
+	}
+
+	query := t.Scoped(config.DB)
+	for _, p := range preloads {
+		query = query.Preload(p)
+	}
+	if err := query.Where("id = ?", rID).First(&route).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.WithContext(c).WithField("route_id", rID).Warn(fn + ": Route not found.")
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("route_id", rID).Error(fn + ": Database error fetching route.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch route")
+		}
+		return route, nil, false
+	}
+	return route, t.Sacco, true
+}
+
+// parseTimeRange reads ?from= and ?to= as RFC 3339 timestamps or YYYY-MM-DD
+// dates, defaulting to the defaultSpan before now. It responds with 400 on
+// invalid input.
+func parseTimeRange(c *gin.Context, defaultSpan time.Duration) (time.Time, time.Time, bool) {
+	to := time.Now()
+	from := to.Add(-defaultSpan)
+	parse := func(name string, dst *time.Time) bool {
+		raw := c.Query(name)
+		if raw == "" {
+			return true
+		}
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, raw); err == nil {
+				*dst = t
+				return true
+			}
+		}
+		apierror.Respond(c, http.StatusBadRequest, name+" must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		return false
+	}
+	if !parse("from", &from) || !parse("to", &to) {
+		return from, to, false
+	}
+	if !to.After(from) {
+		apierror.Respond(c, http.StatusBadRequest, "to must be after from")
+		return from, to, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/incidents"
+	"ma3_tracker/internal/models"
+)
+
+// severityRank orders severities for ?min_severity= filtering.
+var severityRank = map[string]int{
+	models.SeverityLow:    1,
+	models.SeverityMedium: 2,
+	models.SeverityHigh:   3,
+}
+
+// feedCoordinatePrecision rounds published coordinates to roughly 100 m.
+const feedCoordinatePrecision = 1000
+
+// ListIncidents returns incidents for admin review, newest first.
+// Optional filters: ?status=, ?kind= and ?active=true.
+func ListIncidents(c *gin.Context) {
+	query := config.DB.Preload("Routes", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }).Order("last_seen_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if c.Query("active") == "true" {
+		query = query.Where("resolved_at IS NULL")
+	}
+
+	var list []models.Incident
+	if err := query.Limit(500).Find(&list).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListIncidents: Failed to load incidents.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load incidents")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// CreateIncident records a closure or service disruption reported outside the
+// platform. Admin-created incidents are verified immediately.
+func CreateIncident(c *gin.Context) {
+	var input struct {
+		Kind        string     `json:"kind" binding:"required"`
+		Severity    string     `json:"severity" binding:"required"`
+		Title       string     `json:"title" binding:"required"`
+		Description string     `json:"description"`
+		Latitude    *float64   `json:"latitude"`
+		Longitude   *float64   `json:"longitude"`
+		RadiusM     float64    `json:"radius_m"`
+		RouteIDs    []uint     `json:"route_ids"`
+		StartedAt   *time.Time `json:"started_at"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.Kind != models.IncidentClosure && input.Kind != models.IncidentServiceDisruption {
+		apierror.Respond(c, http.StatusBadRequest, "kind must be closure or service_disruption; hazards and congestion are detected automatically")
+		return
+	}
+	if _, ok := severityRank[input.Severity]; !ok {
+		apierror.Respond(c, http.StatusBadRequest, "severity must be low, medium or high")
+		return
+	}
+	hasLocation := input.Latitude != nil && input.Longitude != nil
+	if !hasLocation && len(input.RouteIDs) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, "Provide a location (latitude, longitude) or route_ids")
+		return
+	}
+
+	now := time.Now()
+	incident := models.Incident{
+		Kind:        input.Kind,
+		Severity:    input.Severity,
+		Status:      models.IncidentVerified,
+		Title:       input.Title,
+		Description: input.Description,
+		StartedAt:   now,
+		LastSeenAt:  now,
+		VerifiedAt:  &now,
+	}
+	if input.StartedAt != nil {
+		incident.StartedAt = *input.StartedAt
+	}
+	if hasLocation {
+		incident.Latitude, incident.Longitude = *input.Latitude, *input.Longitude
+		incident.RadiusM = input.RadiusM
+		if incident.RadiusM <= 0 {
+			incident.RadiusM = incidents.CellSize
+		}
+	}
+
+	var routes []models.Route
+	if len(input.RouteIDs) > 0 {
+		if err := config.DB.Select("id", "name").Where("id IN ?", input.RouteIDs).Find(&routes).Error; err != nil {
+			logrus.WithContext(c).WithError(err).Error("CreateIncident: Failed to load routes.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load routes")
+			return
+		}
+		if len(routes) != len(input.RouteIDs) {
+			apierror.Respond(c, http.StatusBadRequest, "One or more route_ids do not exist")
+			return
+		}
+	} else {
+		var err error
+		routes, err = incidents.AffectedRoutes(config.DB, geo.Point{Lat: incident.Latitude, Lng: incident.Longitude}, incident.RadiusM)
+		if err != nil {
+			logrus.WithContext(c).WithError(err).Error("CreateIncident: Failed to find affected routes.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to find affected routes")
+			return
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&incident).Error; err != nil {
+			return err
+		}
+		if len(routes) == 0 {
+			return nil
+		}
+		return tx.Model(&incident).Association("Routes").Replace(routes)
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateIncident: Failed to create incident.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create incident")
+		return
+	}
+	logrus.WithContext(c).WithField("incident_id", incident.ID).Info("CreateIncident: Incident recorded.")
+	c.JSON(http.StatusCreated, gin.H{"data": incident})
+}
+
+// loadIncident loads the incident named by the :id path parameter.
+func loadIncident(c *gin.Context, fn string) (models.Incident, bool) {
+	var incident models.Incident
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return incident, false
+	}
+	if err := config.DB.First(&incident, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Incident not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("incident_id", id).Error(fn + ": Failed to load incident.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load incident")
+		}
+		return incident, false
+	}
+	return incident, true
+}
+
+// updateIncident applies updates to the incident and returns it.
+func updateIncident(c *gin.Context, fn string, incident models.Incident, updates map[string]interface{}) {
+	err := config.DB.Model(&incident).Updates(updates).Error
+	if err == nil {
+		err = config.DB.First(&incident, incident.ID).Error
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("incident_id", incident.ID).Error(fn + ": Failed to update incident.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update incident")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"incident_id": incident.ID, "status": incident.Status}).Info(fn + ": Incident updated.")
+	c.JSON(http.StatusOK, gin.H{"data": incident})
+}
+
+// VerifyIncident publishes a detected incident to the public feed.
+func VerifyIncident(c *gin.Context) {
+	incident, ok := loadIncident(c, "VerifyIncident")
+	if !ok {
+		return
+	}
+	updateIncident(c, "VerifyIncident", incident, map[string]interface{}{"status": models.IncidentVerified, "verified_at": time.Now()})
+}
+
+// DismissIncident marks a detected incident as a false positive and withdraws
+// it from the feed. It is kept open until it goes quiet so the detector does
+// not raise it again.
+func DismissIncident(c *gin.Context) {
+	incident, ok := loadIncident(c, "DismissIncident")
+	if !ok {
+		return
+	}
+	updateIncident(c, "DismissIncident", incident, map[string]interface{}{"status": models.IncidentDismissed, "verified_at": nil})
+}
+
+// ResolveIncident closes an incident, typically a closure that has reopened.
+func ResolveIncident(c *gin.Context) {
+	incident, ok := loadIncident(c, "ResolveIncident")
+	if !ok {
+		return
+	}
+	if !incident.Active() {
+		apierror.Respond(c, http.StatusConflict, "Incident is already resolved")
+		return
+	}
+	updateIncident(c, "ResolveIncident", incident, map[string]interface{}{"resolved_at": time.Now()})
+}
+
+// roundCoordinate coarsens a coordinate for publication.
+func roundCoordinate(v float64) float64 {
+	return math.Round(v*feedCoordinatePrecision) / feedCoordinatePrecision
+}
+
+// GetIncidentFeed is the API-key feed of verified incidents for external
+// consumers. It covers incidents active at any time in ?from=..?to= (default
+// the last 24 hours) and can be narrowed by ?route_id= and ?min_severity=.
+// Coordinates are coarsened and no operator, vehicle or driver data is included.
+func GetIncidentFeed(c *gin.Context) {
+	from, to, ok := parseTimeRange(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	query := config.Replica().Preload("Routes", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }).
+		Where("status = ? AND started_at <= ? AND (resolved_at IS NULL OR resolved_at >= ?)", models.IncidentVerified, to, from).
+		Order("started_at DESC")
+	if routeID := c.Query("route_id"); routeID != "" {
+		query = query.Where("id IN (SELECT incident_id FROM incident_routes WHERE route_id = ?)", routeID)
+	}
+	if minSeverity := c.Query("min_severity"); minSeverity != "" {
+		rank, ok := severityRank[minSeverity]
+		if !ok {
+			apierror.Respond(c, http.StatusBadRequest, "min_severity must be low, medium or high")
+			return
+		}
+		var allowed []string
+		for s, r := range severityRank {
+			if r >= rank {
+				allowed = append(allowed, s)
+			}
+		}
+		query = query.Where("severity IN ?", allowed)
+	}
+
+	var list []models.Incident
+	if err := query.Limit(1000).Find(&list).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("GetIncidentFeed: Failed to load incidents.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load incidents")
+		return
+	}
+
+	out := make([]gin.H, 0, len(list))
+	for _, i := range list {
+		routes := make([]gin.H, 0, len(i.Routes))
+		for _, r := range i.Routes {
+			routes = append(routes, gin.H{"id": r.ID, "name": r.Name})
+		}
+		item := gin.H{
+			"id":              i.ID,
+			"kind":            i.Kind,
+			"severity":        i.Severity,
+			"title":           i.Title,
+			"description":     i.Description,
+			"active":          i.Active(),
+			"started_at":      i.StartedAt,
+			"last_seen_at":    i.LastSeenAt,
+			"resolved_at":     i.ResolvedAt,
+			"affected_routes": routes,
+			"location":        nil,
+		}
+		if i.RadiusM > 0 {
+			item["location"] = gin.H{
+				"latitude":  roundCoordinate(i.Latitude),
+				"longitude": roundCoordinate(i.Longitude),
+				"radius_m":  math.Max(i.RadiusM, 100),
+			}
+		}
+		if incidents.Detected(i.Kind) {
+			item["reporting_vehicles"] = i.VehicleCount
+		}
+		out = append(out, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out, "from": from, "to": to})
+}
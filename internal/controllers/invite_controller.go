@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+)
+
+var (
+	// inviteTTL is how long an invite link stays valid.
+	inviteTTL = config.EnvDuration("USER_INVITE_TTL", 7*24*time.Hour)
+	// inviteURLBase is the app page that accepts invites; the token is
+	// appended as ?token=. Without it only the raw token is returned.
+	inviteURLBase = config.EnvString("USER_INVITE_URL", "")
+)
+
+// temporaryPasswordAlphabet leaves out characters that are easily misread.
+const temporaryPasswordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"
+
+// temporaryPassword returns a random password to hand to a new user.
+func temporaryPassword() (string, error) {
+	b := make([]byte, 12)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(temporaryPasswordAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = temporaryPasswordAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// createInvite issues an invite for the user and returns the credentials to
+// pass on to them.
+func createInvite(tx *gorm.DB, userID, saccoID uint, now time.Time) (gin.H, error) {
+	token, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	invite := models.UserInvite{UserID: userID, SaccoID: saccoID, TokenHash: hash, ExpiresAt: now.Add(inviteTTL)}
+	if err := tx.Create(&invite).Error; err != nil {
+		return nil, err
+	}
+	out := gin.H{"invite_token": token, "expires_at": invite.ExpiresAt}
+	if inviteURLBase != "" {
+		out["invite_url"] = inviteURLBase + "?token=" + url.QueryEscape(token)
+	}
+	return out, nil
+}
+
+// AcceptInvite sets the password of an account created for someone else and
+// signs them in. Body: {"token": "...", "password": "..."}.
+func AcceptInvite(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	hashed, err := hashPassword(input.Password)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "could not hash password")
+		return
+	}
+
+	var user models.User
+	errInvalidInvite := errors.New("invite is invalid, expired or already used")
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.UserInvite{}).
+			Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", middleware.HashAPIKey(input.Token), now).
+			Update("accepted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidInvite
+		}
+		var invite models.UserInvite
+		if err := tx.Where("token_hash = ?", middleware.HashAPIKey(input.Token)).First(&invite).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&user, invite.UserID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{"password": hashed, "must_change_password": false}).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidInvite) || errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusBadRequest, errInvalidInvite.Error())
+			return
+		}
+		logrus.WithContext(c).WithError(err).Error("AcceptInvite: Failed to accept invite.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to accept invite")
+		return
+	}
+	principal.Invalidate(user.ID)
+
+	token, err := middleware.GenerateToken(user.ID, user.Role)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, "could not generate token")
+		return
+	}
+	if err := config.DB.Preload("Sacco").Preload("Driver").Preload("Driver.Sacco").First(&user, user.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", user.ID).Warn("AcceptInvite: Failed to load user associations.")
+	}
+	logrus.WithContext(c).WithField("user_id", user.ID).Info("AcceptInvite: Invite accepted.")
+	c.JSON(http.StatusOK, gin.H{"token": token, "user": prepareUserResponse(user)})
+}
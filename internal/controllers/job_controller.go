@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+var jobListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"run_at":     "run_at",
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]pagination.Filter{
+		"kind":     pagination.String("kind = ?"),
+		"status":   pagination.String("status = ?"),
+		"user_id":  pagination.Uint("user_id = ?"),
+		"sacco_id": pagination.Uint("sacco_id = ?"),
+	},
+}
+
+// jobResponse is a job with its payload.
+func jobResponse(job models.Job) gin.H {
+	return gin.H{"job": job, "payload": json.RawMessage(job.Payload)}
+}
+
+// loadJob loads the job with the :id path parameter, responding 404 when
+// there is none.
+func loadJob(c *gin.Context, fn string) (models.Job, bool) {
+	var job models.Job
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return job, false
+	}
+	if err := config.DB.First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Job not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("job_id", id).Error(fn + ": Failed to load job.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load job")
+		}
+		return job, false
+	}
+	return job, true
+}
+
+// GetJob returns the status of a background job: its state, attempts and
+// last error. Users see the jobs they queued, such as the one behind an
+// export (its job_id); admins see every job. Platform jobs, queued with no
+// user, are for admins only.
+func GetJob(c *gin.Context) {
+	job, ok := loadJob(c, "GetJob")
+	if !ok {
+		return
+	}
+	if c.GetString("role") != "admin" && (job.UserID == 0 || job.UserID != authenticatedUserID(c)) {
+		apierror.Respond(c, http.StatusNotFound, "Job not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": jobResponse(job)})
+}
+
+// ListJobs returns background jobs for oversight, e.g. ?status=failed or
+// ?kind=export, newest first.
+func ListJobs(c *gin.Context) {
+	var list []models.Job
+	meta, ok := paginate(c, "ListJobs", config.DB.Model(&models.Job{}), jobListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta, "kinds": jobs.Kinds()})
+}
+
+// RetryJob queues a failed job again with a fresh set of attempts.
+func RetryJob(c *gin.Context) {
+	job, ok := loadJob(c, "RetryJob")
+	if !ok {
+		return
+	}
+	if job.Status != models.JobFailed {
+		apierror.Fail(c, apierror.New(http.StatusConflict, "Only failed jobs can be retried").WithDetail("status", job.Status))
+		return
+	}
+	res := config.DB.Model(&job).Where("status = ?", models.JobFailed).Updates(map[string]interface{}{
+		"status":      models.JobQueued,
+		"attempts":    0,
+		"run_at":      time.Now(),
+		"finished_at": nil,
+	})
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).WithField("job_id", job.ID).Error("RetryJob: Failed to queue job.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to retry job")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusConflict, "Job was retried already")
+		return
+	}
+	if err := config.DB.First(&job, job.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("job_id", job.ID).Warn("RetryJob: Failed to reload job.")
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"job_id": job.ID, "kind": job.Kind}).Info("RetryJob: Job queued again.")
+	c.JSON(http.StatusOK, gin.H{"message": "Job queued", "data": jobResponse(job)})
+}
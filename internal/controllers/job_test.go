@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// A guest token carries user_id 0, the owner of every platform job.
+func TestGetJobRefusesGuestsPlatformJobs(t *testing.T) {
+	db := testdb.Use(t, &models.Job{})
+	if err := db.Create(&models.Job{Model: gorm.Model{ID: 1}, Kind: "webhook_delivery", SaccoID: 2, Payload: []byte(`{}`)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := middleware.GenerateGuestToken("guest-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", middleware.RequireAuth())
+	api.GET("/jobs/:id", middleware.DenyGuests(), GetJob)
+	api.GET("/unguarded/jobs/:id", GetJob) // The handler's own check
+	for path, want := range map[string]int{"/api/jobs/1": http.StatusForbidden, "/api/unguarded/jobs/1": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("GET %s as a guest: status %d; want %d", path, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/fares"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/journeys"
+	"ma3_tracker/internal/models"
+)
+
+// maxJourneySegments bounds how many matatu rides one journey may combine.
+const maxJourneySegments = 6
+
+// journeySegmentInput is one matatu ride in a new journey.
+type journeySegmentInput struct {
+	RouteID       uint    `json:"route_id" binding:"required"`
+	BoardStageID  uint    `json:"board_stage_id" binding:"required"`
+	AlightStageID uint    `json:"alight_stage_id" binding:"required"`
+	Fare          float64 `json:"fare"`
+}
+
+// loadCommuterJourney loads the journey named by :id if it belongs to the authenticated commuter.
+func loadCommuterJourney(c *gin.Context, fn string) (models.Journey, bool) {
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return models.Journey{}, false
+	}
+	journey, err := journeys.Load(config.DB.Where("user_id = ?", authenticatedUserID(c)), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Journey not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("journey_id", id).Error(fn + ": Failed to load journey.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load journey")
+		}
+		return journey, false
+	}
+	return journey, true
+}
+
+// CreateJourney starts a journey made of one or more matatu segments, in the
+// order they will be ridden. Body: {"segments": [{"route_id": 1,
+// "board_stage_id": 4, "alight_stage_id": 9, "fare": 80}, ...]}. A fare left
+// out is what the route's fare rules charge for a ride starting now.
+func CreateJourney(c *gin.Context) {
+	var input struct {
+		Segments []journeySegmentInput `json:"segments" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	journey, ok := createJourney(c, "CreateJourney", input.Segments)
+	if !ok {
+		return
+	}
+	journey.Payments = []models.JourneyPayment{}
+	c.JSON(http.StatusCreated, gin.H{"data": journey})
+}
+
+// createJourney validates the rides of a new journey for the authenticated
+// commuter and saves it, responding and returning false when it can't.
+func createJourney(c *gin.Context, fn string, inputs []journeySegmentInput) (models.Journey, bool) {
+	if len(inputs) == 0 || len(inputs) > maxJourneySegments {
+		apierror.Respond(c, http.StatusBadRequest, "segments must hold between 1 and 6 rides")
+		return models.Journey{}, false
+	}
+
+	segments := make([]models.JourneySegment, 0, len(inputs))
+	for i, s := range inputs {
+		var route models.Route
+		if err := config.DB.Preload("Stages").Where("id = ? AND status = ?", s.RouteID, models.RouteStatusPublished).First(&route).Error; err != nil {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "Route not found").WithDetail("segment", i+1))
+			return models.Journey{}, false
+		}
+		var onRoute int64
+		if err := config.DB.Model(&models.Stage{}).Where("route_id = ? AND id IN ?", route.ID, []uint{s.BoardStageID, s.AlightStageID}).Count(&onRoute).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error(fn + ": Failed to check stages.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to check stages")
+			return models.Journey{}, false
+		}
+		if s.BoardStageID == s.AlightStageID || onRoute != 2 {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "Boarding and alighting stages must be two different stages on the route").WithDetail("segment", i+1))
+			return models.Journey{}, false
+		}
+		if s.Fare < 0 {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "fare cannot be negative").WithDetail("segment", i+1))
+			return models.Journey{}, false
+		}
+		fare := s.Fare
+		if fare == 0 {
+			// Charge what the route's fare rules set for a ride starting now.
+			estimate, err := fares.For(config.DB, route, s.BoardStageID, s.AlightStageID, time.Now())
+			if err != nil {
+				logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error(fn + ": Failed to price segment.")
+				apierror.Respond(c, http.StatusInternalServerError, "Failed to create journey")
+				return models.Journey{}, false
+			}
+			fare = estimate.Fare
+		}
+		segments = append(segments, models.JourneySegment{
+			Sequence:      i + 1,
+			RouteID:       route.ID,
+			SaccoID:       route.SaccoID,
+			BoardStageID:  s.BoardStageID,
+			AlightStageID: s.AlightStageID,
+			Fare:          fare,
+		})
+	}
+
+	reference, err := journeys.NewReference()
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error(fn + ": Failed to generate reference.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create journey")
+		return models.Journey{}, false
+	}
+	journey := models.Journey{
+		UserID:    authenticatedUserID(c),
+		Reference: reference,
+		Status:    models.JourneyOpen,
+		Currency:  format.DefaultCurrency,
+		Segments:  segments,
+	}
+	if err := config.DB.Create(&journey).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", journey.UserID).Error(fn + ": Failed to save journey.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create journey")
+		return models.Journey{}, false
+	}
+	return journey, true
+}
+
+// ListJourneys returns the authenticated commuter's journeys, newest first.
+func ListJourneys(c *gin.Context) {
+	userID := authenticatedUserID(c)
+	var list []models.Journey
+	err := config.DB.Where("user_id = ?", userID).
+		Preload("Segments", func(tx *gorm.DB) *gorm.DB { return tx.Order("sequence") }).
+		Preload("Payments").
+		Order("created_at DESC").Limit(100).Find(&list).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("ListJourneys: Failed to load journeys.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load journeys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// GetJourney returns one of the authenticated commuter's journeys.
+func GetJourney(c *gin.Context) {
+	journey, ok := loadCommuterJourney(c, "GetJourney")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": journey})
+}
+
+// RecordJourneyPayment records a payment the commuter reports towards an
+// open journey, either for one segment or for the journey as a whole. It
+// gets a receipt and buys tickets once a crew confirms it with
+// ConfirmJourneyPayment. Body: {"segment_id": 3, "amount": 80,
+// "method": "cash", "reference": "QWE123"}.
+func RecordJourneyPayment(c *gin.Context) {
+	journey, ok := loadCommuterJourney(c, "RecordJourneyPayment")
+	if !ok {
+		return
+	}
+	var input struct {
+		SegmentID uint    `json:"segment_id"`
+		Amount    float64 `json:"amount" binding:"required,gt=0"`
+		Method    string  `json:"method" binding:"required,oneof=cash mobile_money card"`
+		Reference string  `json:"reference"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if journey.Status != models.JourneyOpen {
+		apierror.Respond(c, http.StatusConflict, journeys.ErrNotOpen.Error())
+		return
+	}
+	if input.SegmentID != 0 {
+		found := false
+		for _, s := range journey.Segments {
+			found = found || s.ID == input.SegmentID
+		}
+		if !found {
+			apierror.Respond(c, http.StatusBadRequest, "segment_id is not part of this journey")
+			return
+		}
+	}
+	payment := models.JourneyPayment{
+		JourneyID: journey.ID,
+		SegmentID: input.SegmentID,
+		Amount:    input.Amount,
+		Method:    input.Method,
+		Reference: strings.TrimSpace(input.Reference),
+		PaidAt:    time.Now(),
+	}
+	if err := config.DB.Create(&payment).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("journey_id", journey.ID).Error("RecordJourneyPayment: Failed to save payment.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save payment")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": payment})
+}
+
+// ConfirmJourneyPayment lets a driver confirm a payment a commuter reported,
+// e.g. cash handed over on board, and returns its receipt and the tickets it
+// pays for. The
+// payment must be for a ride on the driver's route. Body:
+// {"reference": "JABCD1234", "payment_id": 7}.
+func ConfirmJourneyPayment(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "ConfirmJourneyPayment")
+	if !ok {
+		return
+	}
+	var input struct {
+		Reference string `json:"reference" binding:"required"`
+		PaymentID uint   `json:"payment_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Where("driver_id = ?", driver.ID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusConflict, "You are not assigned to a vehicle")
+		return
+	}
+
+	confirmation, err := journeys.ConfirmPayment(config.DB, input.Reference, input.PaymentID, vehicle, time.Now())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apierror.Respond(c, http.StatusNotFound, "Payment not found")
+	case errors.Is(err, journeys.ErrNotOpen), errors.Is(err, journeys.ErrPaymentConfirmed), errors.Is(err, journeys.ErrPaymentWrongRoute):
+		apierror.Respond(c, http.StatusConflict, err.Error())
+	case err != nil:
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("ConfirmJourneyPayment: Failed to confirm payment.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to confirm payment")
+	default:
+		logrus.WithContext(c).WithFields(logrus.Fields{
+			"journey_id": confirmation.Payment.JourneyID,
+			"payment_id": confirmation.Payment.ID,
+			"vehicle_id": vehicle.ID,
+		}).Info("ConfirmJourneyPayment: Journey payment confirmed.")
+		c.JSON(http.StatusOK, gin.H{"data": confirmation.Payment, "receipt": confirmation.Receipt, "tickets": confirmation.Tickets})
+	}
+}
+
+// CompleteJourney closes one of the authenticated commuter's journeys and
+// returns its final receipt.
+func CompleteJourney(c *gin.Context) {
+	journey, ok := loadCommuterJourney(c, "CompleteJourney")
+	if !ok {
+		return
+	}
+	if err := journeys.Complete(config.DB, &journey, time.Now()); err != nil {
+		if errors.Is(err, journeys.ErrNotOpen) {
+			apierror.Respond(c, http.StatusConflict, err.Error())
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("journey_id", journey.ID).Error("CompleteJourney: Failed to complete journey.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to complete journey")
+		return
+	}
+	respondJourneyReceipt(c, "CompleteJourney", journey.ID)
+}
+
+// GetJourneyReceipt returns the consolidated receipt of one of the
+// authenticated commuter's journeys; ?format=text returns it as plain text.
+func GetJourneyReceipt(c *gin.Context) {
+	journey, ok := loadCommuterJourney(c, "GetJourneyReceipt")
+	if !ok {
+		return
+	}
+	respondJourneyReceipt(c, "GetJourneyReceipt", journey.ID)
+}
+
+// respondJourneyReceipt reloads the journey and responds with its receipt,
+// checking ?code= against its verification code when given.
+func respondJourneyReceipt(c *gin.Context, fn string, journeyID uint) {
+	journey, err := journeys.Load(config.DB, journeyID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("journey_id", journeyID).Error(fn + ": Failed to load journey.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load journey")
+		return
+	}
+	receipt, err := journeys.BuildReceipt(config.DB, journey, time.Now())
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("journey_id", journeyID).Error(fn + ": Failed to build receipt.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build receipt")
+		return
+	}
+	if c.Query("format") == "text" {
+		c.Header("Content-Disposition", `attachment; filename="receipt-`+receipt.Reference+`.txt"`)
+		c.String(http.StatusOK, receipt.Text())
+		return
+	}
+	out := gin.H{"data": receipt}
+	if code := c.Query("code"); code != "" {
+		out["code_valid"] = journeys.Verify(receipt, code)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// ValidateJourneySegment lets a driver check a commuter's journey on board.
+// The first pending segment on the driver's route is marked validated on
+// their vehicle. Body: {"reference": "JABCD1234", "fare": 80}; fare is
+// optional and records what was charged for the leg.
+func ValidateJourneySegment(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "ValidateJourneySegment")
+	if !ok {
+		return
+	}
+	var input struct {
+		Reference string  `json:"reference" binding:"required"`
+		Fare      float64 `json:"fare" binding:"gte=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Where("driver_id = ?", driver.ID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusConflict, "You are not assigned to a vehicle")
+		return
+	}
+
+	segment, err := journeys.Validate(config.DB, input.Reference, vehicle, input.Fare, time.Now())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apierror.Respond(c, http.StatusNotFound, "Journey not found")
+	case errors.Is(err, journeys.ErrNotOpen), errors.Is(err, journeys.ErrNoPendingSegment):
+		apierror.Respond(c, http.StatusConflict, err.Error())
+	case err != nil:
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("ValidateJourneySegment: Failed to validate segment.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to validate journey")
+	default:
+		logrus.WithContext(c).WithFields(logrus.Fields{
+			"journey_id": segment.JourneyID,
+			"segment_id": segment.ID,
+			"vehicle_id": vehicle.ID,
+		}).Info("ValidateJourneySegment: Journey segment validated.")
+		c.JSON(http.StatusOK, gin.H{"data": segment})
+	}
+}
+
+// VerifyJourneyReceipt lets a sacco look up the receipt of a journey that
+// used one of its routes, e.g. to settle a dispute. ?code= checks the
+// verification code printed on the commuter's copy.
+func VerifyJourneyReceipt(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "VerifyJourneyReceipt")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var journey models.Journey
+	err := config.DB.Where("reference = ? AND id IN (?)", strings.ToUpper(c.Param("reference")),
+		config.DB.Model(&models.JourneySegment{}).Select("journey_id").Scopes(tenant.SaccoScope)).
+		First(&journey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Journey not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("VerifyJourneyReceipt: Failed to load journey.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load journey")
+		}
+		return
+	}
+	respondJourneyReceipt(c, "VerifyJourneyReceipt", journey.ID)
+}
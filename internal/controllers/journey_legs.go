@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/fares"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// Journey leg types returned by the planner.
+const (
+	LegTypeMatatu = "matatu"
+	LegTypeWalk   = "walk"
+	LegTypeBoda   = "boda"
+)
+
+// Last-mile settings. Destinations closer than lastMileMinMeters to the alighting
+// stage get no extra leg; walks are offered up to lastMileWalkMaxMeters and
+// boda-boda rides up to lastMileBodaMaxMeters.
+var (
+	lastMileMinMeters     = config.EnvFloat("LAST_MILE_MIN_METERS", 400)
+	lastMileWalkMaxMeters = config.EnvFloat("LAST_MILE_WALK_MAX_METERS", 1200)
+	lastMileBodaMaxMeters = config.EnvFloat("LAST_MILE_BODA_MAX_METERS", 10000)
+	// Straight-line distances are stretched by this factor to approximate streets.
+	lastMileDetourFactor = config.EnvFloat("LAST_MILE_DETOUR_FACTOR", 1.3)
+	walkSpeedMPS         = config.EnvFloat("WALK_SPEED_MPS", 1.3)
+	matatuSpeedMPS       = config.EnvFloat("MATATU_AVG_SPEED_KMH", 18) / 3.6
+	bodaSpeedMPS         = config.EnvFloat("BODA_SPEED_KMH", 25) / 3.6
+	bodaBaseFare         = config.EnvFloat("BODA_BASE_FARE", 50)
+	bodaFarePerKm        = config.EnvFloat("BODA_FARE_PER_KM", 30)
+)
+
+// LegPlace is where a journey leg starts or ends.
+type LegPlace struct {
+	StageID uint    `json:"stage_id,omitempty"`
+	Name    string  `json:"name,omitempty"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+}
+
+// JourneyLeg is one part of a planned journey. Walk and boda legs are
+// estimates from straight-line distance, not routed paths.
+type JourneyLeg struct {
+	Type      string          `json:"type"`
+	RouteID   uint            `json:"route_id,omitempty"`
+	RouteName string          `json:"route_name,omitempty"`
+	From      LegPlace        `json:"from"`
+	To        LegPlace        `json:"to"`
+	DistanceM float64         `json:"distance_m"`
+	Distance  format.Quantity `json:"distance"`
+	DurationS int             `json:"duration_s"`
+	Duration  string          `json:"duration"`
+	Fare      *format.Money   `json:"fare_estimate,omitempty"`
+	FareBasis string          `json:"fare_basis,omitempty"` // For matatu legs: fares.BasisMatrix or fares.BasisDistance
+	Estimated bool            `json:"estimated"`
+}
+
+func newJourneyLeg(prefs format.Preferences, legType string, from, to LegPlace, meters, speedMPS float64) JourneyLeg {
+	d := time.Duration(meters / speedMPS * float64(time.Second))
+	return JourneyLeg{
+		Type:      legType,
+		From:      from,
+		To:        to,
+		DistanceM: math.Round(meters),
+		Distance:  prefs.Distance(meters),
+		DurationS: int(d.Seconds()),
+		Duration:  prefs.Duration(d),
+	}
+}
+
+// nearestStage returns the stage closest to p and its distance in meters.
+func nearestStage(stages []models.Stage, p geo.Point) (models.Stage, float64) {
+	var best models.Stage
+	bestDist := math.Inf(1)
+	for _, s := range stages {
+		if d := geo.Haversine(p, geo.Point{Lat: s.Lat, Lng: s.Lng}); d < bestDist {
+			best, bestDist = s, d
+		}
+	}
+	return best, bestDist
+}
+
+func stagePlace(s models.Stage) LegPlace {
+	return LegPlace{StageID: s.ID, Name: s.Name, Lat: s.Lat, Lng: s.Lng}
+}
+
+// doorToDoorMinMeters is the shortest walk a door-to-door itinerary includes.
+const doorToDoorMinMeters = 1
+
+// JourneyItinerary totals the legs of a door-to-door journey.
+type JourneyItinerary struct {
+	DistanceM     float64         `json:"distance_m"`
+	Distance      format.Quantity `json:"distance"`
+	DurationS     int             `json:"duration_s"`
+	Duration      string          `json:"duration"`
+	WalkDistanceM float64         `json:"walk_distance_m"`
+	WalkDurationS int             `json:"walk_duration_s"`
+}
+
+func newJourneyItinerary(prefs format.Preferences, legs []JourneyLeg) *JourneyItinerary {
+	it := &JourneyItinerary{}
+	for _, l := range legs {
+		it.DistanceM += l.DistanceM
+		it.DurationS += l.DurationS
+		if l.Type == LegTypeWalk {
+			it.WalkDistanceM += l.DistanceM
+			it.WalkDurationS += l.DurationS
+		}
+	}
+	it.Distance = prefs.Distance(it.DistanceM)
+	it.Duration = prefs.Duration(time.Duration(it.DurationS) * time.Second)
+	return it
+}
+
+// legsFare totals the fares of the legs that have one, or returns nil when
+// none do.
+func legsFare(prefs format.Preferences, legs []JourneyLeg) *format.Money {
+	total, priced := 0.0, false
+	for _, l := range legs {
+		if l.Fare != nil {
+			total += l.Fare.Amount
+			priced = true
+		}
+	}
+	if !priced {
+		return nil
+	}
+	m := prefs.Money(total)
+	return &m
+}
+
+// accessLeg returns a walk or boda leg between a stage and the journey's
+// origin or destination, or nil when they are less than minMeters apart or
+// too far for either mode.
+func accessLeg(prefs format.Preferences, from, to LegPlace, minMeters float64) *JourneyLeg {
+	straight := geo.Haversine(geo.Point{Lat: from.Lat, Lng: from.Lng}, geo.Point{Lat: to.Lat, Lng: to.Lng})
+	if straight < minMeters {
+		return nil
+	}
+	meters := straight * lastMileDetourFactor
+	var leg JourneyLeg
+	switch {
+	case meters <= lastMileWalkMaxMeters:
+		leg = newJourneyLeg(prefs, LegTypeWalk, from, to, meters, walkSpeedMPS)
+	case meters <= lastMileBodaMaxMeters:
+		leg = newJourneyLeg(prefs, LegTypeBoda, from, to, meters, bodaSpeedMPS)
+		fare := prefs.Money(math.Ceil((bodaBaseFare+bodaFarePerKm*meters/1000)/10) * 10)
+		leg.Fare = &fare
+	default:
+		return nil
+	}
+	leg.Estimated = true
+	return &leg
+}
+
+// journeyLegs builds the legs of a planned journey over the given routes. A
+// direct journey gets a matatu leg between the stages nearest the start and
+// destination; composite journeys only get the legs to and from the matatus
+// because their transfer points are not known. The last-mile leg is left out
+// when the destination is close to the alighting stage, unless doorToDoor
+// asks for the legs to cover the whole way, in which case the journey also
+// starts with the way from start to the boarding stage. The boolean results
+// report whether start and dest are further from every stage than any of
+// these modes covers.
+func journeyLegs(prefs format.Preferences, routeIDs []uint, start, dest geo.Point, direct, doorToDoor bool) ([]JourneyLeg, bool, bool) {
+	var routes []models.Route
+	if err := config.DB.Preload("Stages").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil || len(routes) == 0 {
+		return nil, false, false
+	}
+
+	var all []models.Stage
+	owner := map[uint]models.Route{}
+	for _, r := range routes {
+		for _, s := range r.Stages {
+			all = append(all, s)
+			owner[s.ID] = r
+		}
+	}
+	if len(all) == 0 {
+		return nil, false, false
+	}
+	alight, alightDist := nearestStage(all, dest)
+	board, boardDist := nearestStage(all, start)
+	if direct {
+		board, boardDist = nearestStage(owner[alight.ID].Stages, start)
+	}
+
+	var legs []JourneyLeg
+	firstUnavailable := false
+	if doorToDoor {
+		origin := LegPlace{Name: "Origin", Lat: start.Lat, Lng: start.Lng}
+		if leg := accessLeg(prefs, origin, stagePlace(board), doorToDoorMinMeters); leg != nil {
+			legs = append(legs, *leg)
+		}
+		firstUnavailable = boardDist*lastMileDetourFactor > lastMileBodaMaxMeters
+	}
+	if direct && board.ID != alight.ID {
+		route := owner[alight.ID]
+		a, b := geo.Point{Lat: board.Lat, Lng: board.Lng}, geo.Point{Lat: alight.Lat, Lng: alight.Lng}
+		meters := geo.Haversine(a, b)
+		if line, err := geo.LineFromWKB(route.Geometry); err == nil && len(line) > 1 {
+			fromAlong, _ := geo.LocateOnLine(a, line)
+			toAlong, _ := geo.LocateOnLine(b, line)
+			meters = math.Abs(toAlong - fromAlong)
+		}
+		leg := newJourneyLeg(prefs, LegTypeMatatu, stagePlace(board), stagePlace(alight), meters, matatuSpeedMPS)
+		leg.RouteID, leg.RouteName = route.ID, route.Name
+		if estimate, err := fares.For(config.DB, route, board.ID, alight.ID, time.Now()); err == nil {
+			fare := prefs.Money(estimate.Fare)
+			leg.Fare, leg.FareBasis = &fare, estimate.Basis
+		} else {
+			logrus.WithError(err).WithField("route_id", route.ID).Warn("journeyLegs: Failed to estimate fare.")
+		}
+		legs = append(legs, leg)
+	}
+	minLastMile := lastMileMinMeters
+	if doorToDoor {
+		minLastMile = doorToDoorMinMeters
+	}
+	destination := LegPlace{Name: "Destination", Lat: dest.Lat, Lng: dest.Lng}
+	if leg := accessLeg(prefs, stagePlace(alight), destination, minLastMile); leg != nil {
+		legs = append(legs, *leg)
+	}
+	lastUnavailable := alightDist*lastMileDetourFactor > lastMileBodaMaxMeters
+	return legs, firstUnavailable, lastUnavailable
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/pagination"
+)
+
+// paginate pages query (which must have its model set) by the request's
+// filters, sort and page or cursor, as described in package pagination,
+// loading the page into dest with the given preloads. Responses carry the
+// page under "data" and the returned metadata under "pagination". On bad
+// parameters it responds 400, and on database errors 500, and returns false.
+func paginate(c *gin.Context, fn string, query *gorm.DB, opts pagination.Options, dest interface{}, preloads ...string) (pagination.Meta, bool) {
+	meta, err := pagination.Find(query, c.Request.URL.Query(), opts, dest, preloads...)
+	if err != nil {
+		var bad *pagination.Error
+		if errors.As(err, &bad) {
+			e := apierror.New(http.StatusBadRequest, bad.Message)
+			if bad.Sortable != nil {
+				e.WithDetail("sortable", bad.Sortable)
+			}
+			apierror.Fail(c, e)
+			return meta, false
+		}
+		logrus.WithContext(c).WithError(err).Error(fn + ": Failed to load results.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load results")
+		return meta, false
+	}
+	return meta, true
+}
+
+// includeDeleted applies ?include_deleted=true, which lists soft-deleted rows
+// too, with their DeletedAt set. Admins may use it on any listing and sacco
+// owners on listings of their own sacco, ownerSaccoID; pass 0 for listings
+// that span saccos. Otherwise it responds 400 or 403 and returns false.
+func includeDeleted(c *gin.Context, fn string, query *gorm.DB, ownerSaccoID uint) (*gorm.DB, bool) {
+	raw := c.Query("include_deleted")
+	if raw == "" {
+		return query, true
+	}
+	include, err := strconv.ParseBool(raw)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "Invalid include_deleted")
+		return nil, false
+	}
+	if !include {
+		return query, true
+	}
+	switch c.GetString("role") {
+	case "admin":
+		return query.Unscoped(), true
+	case "sacco":
+		if ownerSaccoID == 0 {
+			break
+		}
+		sacco, ok := authenticatedSacco(c, fn)
+		if !ok {
+			return nil, false
+		}
+		if sacco.ID == ownerSaccoID {
+			return query.Unscoped(), true
+		}
+	}
+	logrus.WithContext(c).WithField("sacco_id", ownerSaccoID).Warn(fn + ": Deleted items requested without access.")
+	apierror.Respond(c, http.StatusForbidden, "Only admins and the owning sacco can list deleted items")
+	return nil, false
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+const (
+	defaultHistoryLimit = 500
+	maxHistoryLimit     = 5000
+	// maxHistoryScan bounds the raw points read for one page with ?every=.
+	maxHistoryScan  = 50000
+	maxHistoryEvery = 1000
+)
+
+// historyPoint is one location point as returned by the history endpoints.
+type historyPoint struct {
+	ID               uint      `json:"id"`
+	DriverID         uint      `json:"driver_id,omitempty"`
+	VehicleID        uint      `json:"vehicle_id,omitempty"`
+	TripID           uint      `json:"trip_id,omitempty"`
+	Source           string    `json:"source"`
+	Latitude         float64   `json:"latitude"`
+	Longitude        float64   `json:"longitude"`
+	MatchedLatitude  *float64  `json:"matched_latitude,omitempty"`
+	MatchedLongitude *float64  `json:"matched_longitude,omitempty"`
+	Accuracy         float64   `json:"accuracy"`
+	Speed            float64   `json:"speed"`
+	Bearing          float64   `json:"bearing"`
+	Altitude         float64   `json:"altitude"`
+	IsMoving         bool      `json:"is_moving"`
+	EventType        string    `json:"event_type"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// historyCursor is the keyset position a page ends at: the next page starts
+// after (Timestamp, ID).
+type historyCursor struct {
+	Timestamp time.Time `json:"t"`
+	ID        uint      `json:"i"`
+}
+
+// ListDriverLocations returns the location history of one of the sacco's
+// drivers, limited to the periods they drove the sacco's vehicles so points
+// from their time with another sacco are not shown. See locationHistory for
+// the parameters.
+func ListDriverLocations(c *gin.Context) {
+	driver, ok := saccoDriver(c, "ListDriverLocations")
+	if !ok {
+		return
+	}
+	locationHistory(c, "ListDriverLocations", "driver_id", driver.ID, assignedWithin(driver.SaccoID))
+}
+
+// assignedWithin keeps the points reported while their driver held an
+// assignment with the sacco.
+func assignedWithin(saccoID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`EXISTS (
+			SELECT 1 FROM vehicle_assignments va
+			WHERE va.driver_id = location_histories.driver_id AND va.sacco_id = ? AND va.deleted_at IS NULL
+			  AND va.started_at <= location_histories.timestamp
+			  AND (va.ended_at IS NULL OR va.ended_at > location_histories.timestamp)
+		)`, saccoID)
+	}
+}
+
+// ListVehicleLocations returns the location history of one of the sacco's
+// vehicles, whether reported by drivers' phones or its tracker. A vehicle
+// stays with the sacco that registered it, so all of its points are shown.
+// See locationHistory for the parameters.
+func ListVehicleLocations(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "ListVehicleLocations")
+	if !ok {
+		return
+	}
+	locationHistory(c, "ListVehicleLocations", "vehicle_id", vehicle.ID)
+}
+
+// locationHistory responds with the points whose column field equals id,
+// reported between ?from= and ?to= (default the last 24 hours), oldest
+// first. Pages hold up to ?limit= points (default 500, at most 5000); pass
+// the response's next_cursor as ?cursor= for the next one. The pagination
+// metadata counts the points in the range before any thinning. Long ranges can
+// be thinned with ?every=N (every Nth point) or ?bucket=30s (the first point
+// of each time bucket). ?format=geojson returns a FeatureCollection of points.
+// scopes further narrow the points returned.
+func locationHistory(c *gin.Context, fn, field string, id uint, scopes ...func(*gorm.DB) *gorm.DB) {
+	from, to, ok := parseTimeRange(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	limit, err := pagination.Limit(c.Request.URL.Query(), defaultHistoryLimit, maxHistoryLimit)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	every := 1
+	if raw := c.Query("every"); raw != "" {
+		if every, err = strconv.Atoi(raw); err != nil || every < 1 || every > maxHistoryEvery {
+			apierror.Respond(c, http.StatusBadRequest, "every must be between 1 and "+strconv.Itoa(maxHistoryEvery))
+			return
+		}
+	}
+	var bucket time.Duration
+	if raw := c.Query("bucket"); raw != "" {
+		if bucket, err = time.ParseDuration(raw); err != nil || bucket < time.Second || bucket > 24*time.Hour {
+			apierror.Respond(c, http.StatusBadRequest, "bucket must be a duration between 1s and 24h, e.g. 30s or 5m")
+			return
+		}
+		if every > 1 {
+			apierror.Respond(c, http.StatusBadRequest, "Use either every or bucket, not both")
+			return
+		}
+	}
+	if limit*every > maxHistoryScan {
+		apierror.Respond(c, http.StatusBadRequest, fmt.Sprintf("limit × every must be at most %d", maxHistoryScan))
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "geojson" {
+		apierror.Respond(c, http.StatusBadRequest, "Unsupported format. Use json or geojson.")
+		return
+	}
+
+	query := config.Replica().Model(&models.LocationHistory{}).
+		Where(field+" = ? AND timestamp >= ? AND timestamp < ?", id, from, to).
+		Scopes(scopes...)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField(field, id).Error(fn + ": Failed to count location history.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load location history")
+		return
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		var cursor historyCursor
+		if err := pagination.DecodeCursor(raw, &cursor); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		query = query.Where("(timestamp, id) > (?, ?)", cursor.Timestamp, cursor.ID)
+	}
+
+	var rows []historyPoint
+	var next *historyCursor
+	if bucket > 0 {
+		// Whole seconds, formatted in: ORDER BY must repeat the DISTINCT ON expression.
+		secs := int64(bucket / time.Second)
+		expr := fmt.Sprintf("FLOOR(EXTRACT(EPOCH FROM timestamp) / %d)", secs)
+		err = query.Select("DISTINCT ON (" + expr + ") *").Order(expr + ", timestamp, id").Limit(limit).Find(&rows).Error
+		if err == nil && len(rows) == limit {
+			// Resume at the next bucket so this one is not sampled twice.
+			last := rows[len(rows)-1].Timestamp.Unix()
+			next = &historyCursor{Timestamp: time.Unix((last/secs+1)*secs, 0).UTC()}
+		}
+	} else {
+		err = query.Order("timestamp, id").Limit(limit * every).Find(&rows).Error
+		if err == nil && len(rows) == limit*every {
+			last := rows[len(rows)-1]
+			next = &historyCursor{Timestamp: last.Timestamp, ID: last.ID}
+		}
+		if every > 1 {
+			thinned := rows[:0]
+			for i := 0; i < len(rows); i += every {
+				thinned = append(thinned, rows[i])
+			}
+			rows = thinned
+		}
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField(field, id).Error(fn + ": Failed to load location history.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load location history")
+		return
+	}
+
+	meta := pagination.Meta{PerPage: limit, Total: total, TotalPages: (total + int64(limit*every) - 1) / int64(limit*every)}
+	if next != nil {
+		encoded := pagination.EncodeCursor(next)
+		meta.NextCursor = &encoded
+	}
+	if format == "geojson" {
+		c.Header("Content-Type", "application/geo+json")
+		c.JSON(http.StatusOK, historyGeoJSON(rows, meta))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows, "next_cursor": meta.NextCursor, "pagination": meta, "from": from, "to": to})
+}
+
+// historyGeoJSON renders points as a FeatureCollection of Point features,
+// with next_cursor and pagination as foreign members.
+func historyGeoJSON(points []historyPoint, meta pagination.Meta) gin.H {
+	features := make([]gin.H, 0, len(points))
+	for _, p := range points {
+		properties := gin.H{
+			"id":         p.ID,
+			"source":     p.Source,
+			"accuracy":   p.Accuracy,
+			"speed":      p.Speed,
+			"bearing":    p.Bearing,
+			"altitude":   p.Altitude,
+			"is_moving":  p.IsMoving,
+			"event_type": p.EventType,
+			"timestamp":  p.Timestamp,
+		}
+		if p.DriverID != 0 {
+			properties["driver_id"] = p.DriverID
+		}
+		if p.VehicleID != 0 {
+			properties["vehicle_id"] = p.VehicleID
+		}
+		if p.TripID != 0 {
+			properties["trip_id"] = p.TripID
+		}
+		if p.MatchedLatitude != nil && p.MatchedLongitude != nil {
+			properties["matched_coordinates"] = []float64{*p.MatchedLongitude, *p.MatchedLatitude}
+		}
+		features = append(features, gin.H{
+			"type":       "Feature",
+			"geometry":   gin.H{"type": "Point", "coordinates": []float64{p.Longitude, p.Latitude}},
+			"properties": properties,
+		})
+	}
+	return gin.H{"type": "FeatureCollection", "features": features, "next_cursor": meta.NextCursor, "pagination": meta}
+}
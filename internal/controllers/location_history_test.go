@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Driver 1 drove for sacco 2 before joining sacco 1; sacco 1 only sees the
+// points from its own assignment.
+func TestDriverLocationsLimitedToSaccoAssignments(t *testing.T) {
+	r := twoSaccos(t, 1, "sacco")
+	if err := config.DB.AutoMigrate(&models.VehicleAssignment{}, &models.LocationHistory{}); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/sacco/drivers/:id/locations", ListDriverLocations)
+
+	now := time.Now().UTC()
+	joined := now.Add(-3 * time.Hour)
+	rows := []interface{}{
+		&models.VehicleAssignment{VehicleID: 2, SaccoID: 2, DriverID: 1, StartedAt: now.Add(-6 * time.Hour), EndedAt: &joined},
+		&models.VehicleAssignment{VehicleID: 1, SaccoID: 1, DriverID: 1, StartedAt: joined},
+		&models.LocationHistory{DriverID: 1, VehicleID: 2, Source: models.LocationSourceDriver, Timestamp: now.Add(-4 * time.Hour)},
+		&models.LocationHistory{DriverID: 1, VehicleID: 1, Source: models.LocationSourceDriver, Timestamp: now.Add(-time.Hour)},
+	}
+	for _, row := range rows {
+		if err := config.DB.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+
+	code, points := get(t, r, "/sacco/drivers/1/locations")
+	if code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(points) != 1 || points[0]["vehicle_id"] != float64(1) {
+		t.Errorf("points = %v; want only the one on sacco 1's vehicle", points)
+	}
+}
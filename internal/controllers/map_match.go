@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/eta"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/mapmatch"
+	"ma3_tracker/internal/models"
+)
+
+// matchToRoute snaps a point onto the line of the route its vehicle serves,
+// setting its matched coordinates and its distance from the route. Points
+// stay unmatched when the route has no geometry or the vehicle is off it;
+// lookup errors are logged, never fatal to saving the point.
+func matchToRoute(record *models.LocationHistory, routeID uint) {
+	if routeID == 0 {
+		return
+	}
+	line, err := eta.RouteLine(config.DB, routeID)
+	if err != nil {
+		if !errors.Is(err, eta.ErrNoGeometry) {
+			logrus.WithError(err).WithField("route_id", routeID).Warn("matchToRoute: Failed to load route line.")
+		}
+		return
+	}
+	snapped, offset, ok := mapmatch.Snap(geo.Point{Lat: record.Latitude, Lng: record.Longitude}, line, mapmatch.SnapTolerance)
+	record.RouteOffsetM = &offset
+	if !ok {
+		return
+	}
+	record.MatchedLatitude, record.MatchedLongitude = &snapped.Lat, &snapped.Lng
+}
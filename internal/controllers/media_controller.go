@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/storage"
+)
+
+// uploadRule limits what an upload endpoint accepts.
+type uploadRule struct {
+	field    string            // Multipart form field carrying the file
+	maxBytes int               // Largest accepted file
+	types    map[string]string // Sniffed content type to stored file extension
+	label    string            // Human-readable list of accepted types
+}
+
+var (
+	logoUpload  = uploadRule{"logo", 2 << 20, map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/webp": ".webp"}, "PNG, JPEG or WebP"}
+	photoUpload = uploadRule{"photo", 5 << 20, map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/webp": ".webp"}, "PNG, JPEG or WebP"}
+	scanUpload  = uploadRule{"file", 5 << 20, map[string]string{"application/pdf": ".pdf", "image/png": ".png", "image/jpeg": ".jpg"}, "PDF, PNG or JPEG"}
+)
+
+// Driver media kinds. Photos are public; license and badge scans are private.
+const (
+	driverMediaPhoto   = "photo"
+	driverMediaLicense = "license"
+	driverMediaBadge   = "badge"
+)
+
+// driverMediaColumns maps each driver media kind to the column holding its key.
+var driverMediaColumns = map[string]string{
+	driverMediaPhoto:   "photo_key",
+	driverMediaLicense: "license_scan_key",
+	driverMediaBadge:   "badge_scan_key",
+}
+
+// mediaLinkTTL bounds how long a signed link to a private scan stays valid.
+var mediaLinkTTL = config.EnvDuration("MEDIA_LINK_TTL", 15*time.Minute)
+
+// readUpload reads and validates the file in rule.field, responding on failure.
+// It returns the data, its content type and the extension to store it under.
+func readUpload(c *gin.Context, rule uploadRule) ([]byte, string, string, bool) {
+	fileHeader, err := c.FormFile(rule.field)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, rule.field+" file is required")
+		return nil, "", "", false
+	}
+	tooLarge := fmt.Sprintf("%s must be %d MiB or smaller", rule.field, rule.maxBytes>>20)
+	if fileHeader.Size > int64(rule.maxBytes) {
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, tooLarge)
+		return nil, "", "", false
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "could not read "+rule.field)
+		return nil, "", "", false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(rule.maxBytes)+1))
+	if err != nil || len(data) > rule.maxBytes {
+		apierror.Respond(c, http.StatusBadRequest, "could not read "+rule.field)
+		return nil, "", "", false
+	}
+	contentType := http.DetectContentType(data)
+	ext, allowed := rule.types[contentType]
+	if !allowed {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, rule.field+" must be "+rule.label)
+		return nil, "", "", false
+	}
+	return data, contentType, ext, true
+}
+
+// replaceStoredFile stores data under key, points column of model at it and
+// deletes the previous object. It responds and returns false on failure.
+func replaceStoredFile(c *gin.Context, fn string, model interface{}, column, previous, key string, data []byte, contentType string) bool {
+	store := storage.Default()
+	if err := store.Put(c.Request.Context(), key, bytes.NewReader(data), contentType); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("key", key).Error(fn + ": Failed to store file.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to store file")
+		return false
+	}
+	if err := config.DB.Model(model).Update(column, key).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("key", key).Error(fn + ": Failed to save file reference.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save file reference")
+		store.Delete(c.Request.Context(), key)
+		return false
+	}
+	if previous != "" && previous != key {
+		if err := store.Delete(c.Request.Context(), previous); err != nil {
+			logrus.WithContext(c).WithError(err).WithField("key", previous).Warn(fn + ": Failed to delete previous file.")
+		}
+	}
+	return true
+}
+
+// attachVehiclePhotos fills in the public photo URL of each vehicle.
+func attachVehiclePhotos(vehicles []models.Vehicle) {
+	store := storage.Default()
+	for i := range vehicles {
+		vehicles[i].PhotoURL = store.URL(vehicles[i].PhotoKey)
+	}
+}
+
+// UploadSaccoPhoto stores the sacco's office or fleet photo from the "photo" form field.
+func UploadSaccoPhoto(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "UploadSaccoPhoto")
+	if !ok {
+		return
+	}
+	data, contentType, ext, ok := readUpload(c, photoUpload)
+	if !ok {
+		return
+	}
+	key := fmt.Sprintf("saccos/%d/photo-%d%s", sacco.ID, time.Now().Unix(), ext)
+	if !replaceStoredFile(c, "UploadSaccoPhoto", sacco, "photo_key", sacco.PhotoKey, key, data, contentType) {
+		return
+	}
+	principal.Invalidate(sacco.UserID)
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"photo_url": storage.Default().URL(key)}})
+}
+
+// UploadVehiclePhoto stores a photo of one of the sacco's vehicles from the "photo" form field.
+func UploadVehiclePhoto(c *gin.Context) {
+	vehicleID, ok := parseUintParam(c, "id", "UploadVehiclePhoto")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "UploadVehiclePhoto")
+	if !ok {
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", vehicleID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
+		return
+	}
+	data, contentType, ext, ok := readUpload(c, photoUpload)
+	if !ok {
+		return
+	}
+	key := fmt.Sprintf("vehicles/%d/photo-%d%s", vehicle.ID, time.Now().Unix(), ext)
+	if !replaceStoredFile(c, "UploadVehiclePhoto", &vehicle, "photo_key", vehicle.PhotoKey, key, data, contentType) {
+		return
+	}
+	vehicle.PhotoKey = key
+	vehicle.PhotoURL = storage.Default().URL(key)
+	c.JSON(http.StatusOK, gin.H{"data": vehicle})
+}
+
+// saccoDriver loads the driver named by :id if they belong to the authenticated sacco.
+func saccoDriver(c *gin.Context, fn string) (models.Driver, bool) {
+	var driver models.Driver
+	driverID, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return driver, false
+	}
+	tenant, ok := saccoTenant(c, fn)
+	if !ok {
+		return driver, false
+	}
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", driverID).First(&driver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Driver not found or does not belong to this Sacco.")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("driver_id", driverID).Error(fn + ": Failed to load driver.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load driver")
+		}
+		return driver, false
+	}
+	return driver, true
+}
+
+// driverMediaKey returns the stored key of the given media kind.
+func driverMediaKey(d models.Driver, kind string) string {
+	switch kind {
+	case driverMediaPhoto:
+		return d.PhotoKey
+	case driverMediaLicense:
+		return d.LicenseScanKey
+	default:
+		return d.BadgeScanKey
+	}
+}
+
+// uploadDriverMedia stores the :kind file for driver. Photos accept images
+// from the "photo" field; license and badge scans accept PDFs or images from
+// the "file" field and are kept private.
+func uploadDriverMedia(c *gin.Context, fn string, driver models.Driver) {
+	kind := c.Param("kind")
+	column, known := driverMediaColumns[kind]
+	if !known {
+		apierror.Respond(c, http.StatusBadRequest, "kind must be photo, license or badge")
+		return
+	}
+	rule, prefix := scanUpload, fmt.Sprintf("driver-documents/%d/%s", driver.ID, kind)
+	if kind == driverMediaPhoto {
+		rule, prefix = photoUpload, fmt.Sprintf("drivers/%d/photo", driver.ID)
+	}
+	data, contentType, ext, ok := readUpload(c, rule)
+	if !ok {
+		return
+	}
+	key := fmt.Sprintf("%s-%s%s", prefix, storage.RandomName(), ext)
+	if !replaceStoredFile(c, fn, &driver, column, driverMediaKey(driver, kind), key, data, contentType) {
+		return
+	}
+	principal.Invalidate(driver.UserID)
+	logrus.WithContext(c).WithFields(logrus.Fields{"driver_id": driver.ID, "kind": kind}).Info(fn + ": Driver media uploaded.")
+	c.JSON(http.StatusOK, gin.H{"data": driverMediaLink(key)})
+}
+
+// driverMediaLink describes where a stored driver file can be fetched from.
+func driverMediaLink(key string) gin.H {
+	if storage.IsPrivate(key) {
+		link, expires := storage.SignedURL(key, mediaLinkTTL)
+		return gin.H{"url": link, "expires_at": expires}
+	}
+	return gin.H{"url": storage.Default().URL(key)}
+}
+
+// downloadDriverMedia redirects to the :kind file of driver.
+func downloadDriverMedia(c *gin.Context, driver models.Driver) {
+	kind := c.Param("kind")
+	if _, known := driverMediaColumns[kind]; !known {
+		apierror.Respond(c, http.StatusBadRequest, "kind must be photo, license or badge")
+		return
+	}
+	key := driverMediaKey(driver, kind)
+	if key == "" {
+		apierror.Respond(c, http.StatusNotFound, "No "+kind+" has been uploaded")
+		return
+	}
+	c.Redirect(http.StatusFound, driverMediaLink(key)["url"].(string))
+}
+
+// UploadSaccoDriverMedia stores a photo, license scan or badge scan for one of the sacco's drivers.
+func UploadSaccoDriverMedia(c *gin.Context) {
+	driver, ok := saccoDriver(c, "UploadSaccoDriverMedia")
+	if !ok {
+		return
+	}
+	uploadDriverMedia(c, "UploadSaccoDriverMedia", driver)
+}
+
+// DownloadSaccoDriverMedia redirects to a driver's photo or to a short-lived link to a scan.
+func DownloadSaccoDriverMedia(c *gin.Context) {
+	driver, ok := saccoDriver(c, "DownloadSaccoDriverMedia")
+	if !ok {
+		return
+	}
+	downloadDriverMedia(c, driver)
+}
+
+// UploadOwnDriverMedia lets drivers upload their own photo, license scan or badge scan.
+func UploadOwnDriverMedia(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "UploadOwnDriverMedia")
+	if !ok {
+		return
+	}
+	uploadDriverMedia(c, "UploadOwnDriverMedia", *driver)
+}
+
+// DownloadOwnDriverMedia redirects drivers to their own uploaded files.
+func DownloadOwnDriverMedia(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "DownloadOwnDriverMedia")
+	if !ok {
+		return
+	}
+	downloadDriverMedia(c, *driver)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+)
+
+// metricsToken must be presented as a bearer token to scrape /metrics. The
+// endpoint is off while it is unset.
+var metricsToken = config.EnvString("METRICS_TOKEN", "")
+
+// Metrics serves the server's metrics in the Prometheus text format: HTTP
+// requests and latency by route, database pool statistics, WebSocket gauges
+// and broadcast drops.
+func Metrics(c *gin.Context) {
+	if metricsToken == "" {
+		apierror.Respond(c, http.StatusNotFound, "Metrics are disabled")
+		return
+	}
+	got := c.GetHeader("Authorization")
+	if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+metricsToken)) != 1 {
+		apierror.Respond(c, http.StatusUnauthorized, "Invalid metrics token")
+		return
+	}
+	promhttp.Handler().ServeHTTP(c.Writer, c.Request)
+}
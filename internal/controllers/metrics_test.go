@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsNeedsToken(t *testing.T) {
+	prev := metricsToken
+	t.Cleanup(func() { metricsToken = prev })
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", Metrics)
+	call := func(auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	metricsToken = ""
+	if code := call(""); code != http.StatusNotFound {
+		t.Errorf("without METRICS_TOKEN: status %d; want 404", code)
+	}
+	metricsToken = "scrape"
+	for auth, want := range map[string]int{"": http.StatusUnauthorized, "Bearer nope": http.StatusUnauthorized, "Bearer scrape": http.StatusOK} {
+		if code := call(auth); code != want {
+			t.Errorf("Authorization %q: status %d; want %d", auth, code, want)
+		}
+	}
+}
+
+func TestWebSocketMetricsScraped(t *testing.T) {
+	RegisterWebSocketMetrics()
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`ws_broadcast_drops_total{reason="bus_queue"} 0`,
+		`ws_subscriptions{kind="area"} 0`,
+		"ws_broadcast_queue_capacity 100",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/journeys"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/payments"
+)
+
+// mpesaPaymentListOptions are the sorts and filters M-Pesa payment listings
+// accept.
+var mpesaPaymentListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"amount":     "amount",
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]pagination.Filter{
+		"journey_id": pagination.Uint("journey_id = ?"),
+		"status":     pagination.String("status = ?"),
+	},
+}
+
+// outstandingFare is what remains to pay for a journey, or for one of its
+// segments when segmentID is set.
+func outstandingFare(journey models.Journey, segmentID uint) float64 {
+	due := 0.0
+	for _, s := range journey.Segments {
+		if segmentID == 0 || s.ID == segmentID {
+			due += s.Fare
+		}
+	}
+	for _, p := range journey.Payments {
+		if segmentID == 0 || p.SegmentID == segmentID {
+			due -= p.Amount
+		}
+	}
+	return due
+}
+
+// PayJourneyWithMpesa prompts the authenticated commuter to pay towards one
+// of their open journeys on their phone through M-Pesa. Body, all optional:
+// {"segment_id": 3, "amount": 80}. The amount defaults to what remains to
+// pay and may not exceed it. The prompt goes to the phone number on the
+// commuter's account only; "phone", when given, must be that number. The
+// payment is pending until the commuter answers the prompt; poll
+// /commuter/payments/:id for the outcome.
+func PayJourneyWithMpesa(c *gin.Context) {
+	if !payments.Enabled() {
+		apierror.Respond(c, http.StatusServiceUnavailable, payments.ErrNotConfigured.Error())
+		return
+	}
+	journey, ok := loadCommuterJourney(c, "PayJourneyWithMpesa")
+	if !ok {
+		return
+	}
+	var input struct {
+		SegmentID uint    `json:"segment_id"`
+		Amount    float64 `json:"amount" binding:"omitempty,gt=0"`
+		Phone     string  `json:"phone"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if journey.Status != models.JourneyOpen {
+		apierror.Respond(c, http.StatusConflict, journeys.ErrNotOpen.Error())
+		return
+	}
+	if input.SegmentID != 0 {
+		found := false
+		for _, s := range journey.Segments {
+			found = found || s.ID == input.SegmentID
+		}
+		if !found {
+			apierror.Respond(c, http.StatusBadRequest, "segment_id is not part of this journey")
+			return
+		}
+	}
+	due := outstandingFare(journey, input.SegmentID)
+	if due <= 0 {
+		apierror.Respond(c, http.StatusBadRequest, "Nothing to pay on this journey")
+		return
+	}
+	amount := input.Amount
+	if amount == 0 {
+		amount = due
+	}
+	if amount > due {
+		apierror.Fail(c, apierror.New(http.StatusBadRequest, "Amount exceeds what remains to pay").WithDetail("due", due))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Select("phone").First(&user, journey.UserID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", journey.UserID).Error("PayJourneyWithMpesa: Failed to load user.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to request payment")
+		return
+	}
+	phone, ok := payments.NormalizePhone(user.Phone)
+	if !ok {
+		apierror.Respond(c, http.StatusBadRequest, "Add a Kenyan mobile number to your account to pay with M-Pesa")
+		return
+	}
+	if input.Phone != "" {
+		if given, _ := payments.NormalizePhone(input.Phone); given != phone {
+			apierror.Respond(c, http.StatusBadRequest, "M-Pesa prompts go to the phone number on your account")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	payment, err := payments.Request(ctx, config.DB, journey, input.SegmentID, amount, phone)
+	if errors.Is(err, payments.ErrPaymentPending) {
+		apierror.Respond(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("journey_id", journey.ID).Error("PayJourneyWithMpesa: Failed to request M-Pesa payment.")
+		apierror.Respond(c, http.StatusBadGateway, "M-Pesa did not accept the payment request; try again")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": payment, "message": "Check your phone to complete the payment"})
+}
+
+// ListMpesaPayments returns the authenticated commuter's M-Pesa payments,
+// newest first. ?journey_id= and ?status= narrow the list.
+func ListMpesaPayments(c *gin.Context) {
+	var list []models.MpesaPayment
+	query := config.DB.Model(&models.MpesaPayment{}).Where("user_id = ?", authenticatedUserID(c))
+	meta, ok := paginate(c, "ListMpesaPayments", query, mpesaPaymentListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// GetMpesaPayment returns one of the authenticated commuter's M-Pesa
+// payments, to follow it from pending to its outcome.
+func GetMpesaPayment(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "GetMpesaPayment")
+	if !ok {
+		return
+	}
+	var payment models.MpesaPayment
+	err := config.DB.Where("user_id = ?", authenticatedUserID(c)).First(&payment, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Payment not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("payment_id", id).Error("GetMpesaPayment: Failed to load payment.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load payment")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": payment})
+}
+
+// MpesaCallback receives the outcome of STK pushes from Safaricom. It is
+// reachable only through the secret token in the callback URL and always
+// acknowledges, as Safaricom doesn't retry; payments whose result is lost
+// are settled by reconciliation instead.
+func MpesaCallback(c *gin.Context) {
+	ack := gin.H{"ResultCode": 0, "ResultDesc": "Accepted"}
+	if !payments.CallbackTokenValid(c.Param("token")) {
+		apierror.Respond(c, http.StatusNotFound, "Not found")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Warn("MpesaCallback: Failed to read callback.")
+		c.JSON(http.StatusOK, ack)
+		return
+	}
+	result, err := payments.ParseCallback(body)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Warn("MpesaCallback: Failed to parse callback.")
+		c.JSON(http.StatusOK, ack)
+		return
+	}
+	payment, err := payments.Settle(config.DB, result, time.Now())
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("checkout_request_id", result.CheckoutRequestID).Error("MpesaCallback: Failed to settle payment.")
+		c.JSON(http.StatusOK, ack)
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"payment_id": payment.ID,
+		"status":     payment.Status,
+	}).Info("MpesaCallback: Payment settled.")
+	c.JSON(http.StatusOK, ack)
+}
+
+// ListAdminMpesaPayments returns M-Pesa payments across all commuters for
+// oversight, e.g. ?status=pending for those still unanswered.
+func ListAdminMpesaPayments(c *gin.Context) {
+	opts := mpesaPaymentListOptions
+	opts.Filters = map[string]pagination.Filter{
+		"journey_id": pagination.Uint("journey_id = ?"),
+		"user_id":    pagination.Uint("user_id = ?"),
+		"status":     pagination.String("status = ?"),
+		"receipt":    pagination.String("receipt_number = ?"),
+	}
+	var list []models.MpesaPayment
+	meta, ok := paginate(c, "ListAdminMpesaPayments", config.DB.Model(&models.MpesaPayment{}), opts, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
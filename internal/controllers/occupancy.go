@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/wsproto"
+)
+
+// occupancyTTL is how long a driver's occupancy report stays valid before the
+// vehicle is shown as unknown again.
+var occupancyTTL = config.EnvDuration("OCCUPANCY_TTL", 30*time.Minute)
+
+// fewSeatsRatio is the share of capacity at which a counted vehicle is "few seats".
+const fewSeatsRatio = 0.8
+
+var errInvalidOccupancy = errors.New("occupancy status must be seats_available, few_seats or full, and count must not be negative")
+
+// occupancyInput is an occupancy report from a driver. Status may be omitted
+// when a passenger count is given; it is then derived from the capacity.
+type occupancyInput struct {
+	Status string `json:"status"`
+	Count  *int   `json:"count"`
+}
+
+// applyOccupancy validates a report and sets it on the vehicle without saving.
+func applyOccupancy(vehicle *models.Vehicle, in occupancyInput, now time.Time) error {
+	if in.Count != nil && *in.Count < 0 {
+		return errInvalidOccupancy
+	}
+	status := in.Status
+	if status == "" && in.Count != nil && vehicle.Capacity > 0 {
+		switch {
+		case *in.Count >= vehicle.Capacity:
+			status = models.OccupancyFull
+		case float64(*in.Count) >= float64(vehicle.Capacity)*fewSeatsRatio:
+			status = models.OccupancyFewSeats
+		default:
+			status = models.OccupancySeatsAvailable
+		}
+	}
+	switch status {
+	case models.OccupancySeatsAvailable, models.OccupancyFewSeats, models.OccupancyFull:
+	default:
+		return errInvalidOccupancy
+	}
+	vehicle.OccupancyStatus = status
+	vehicle.Occupancy = in.Count
+	vehicle.OccupancyUpdatedAt = &now
+	return nil
+}
+
+// saveOccupancy persists the vehicle's occupancy fields and broadcasts them.
+func saveOccupancy(vehicle *models.Vehicle) error {
+	err := config.DB.Model(vehicle).Updates(map[string]interface{}{
+		"occupancy_status":     vehicle.OccupancyStatus,
+		"occupancy":            vehicle.Occupancy,
+		"occupancy_updated_at": vehicle.OccupancyUpdatedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	publishOccupancy(vehicle)
+	return nil
+}
+
+// publishOccupancy broadcasts a vehicle's occupancy to its sacco's listeners.
+func publishOccupancy(vehicle *models.Vehicle) {
+	msg := map[string]interface{}{
+		"type":             "occupancy",
+		"vehicle_id":       vehicle.ID,
+		"driver_id":        vehicle.DriverID,
+		"sacco_id":         float64(vehicle.SaccoID),
+		"capacity":         vehicle.Capacity,
+		"occupancy_status": vehicle.OccupancyStatus,
+		"timestamp":        vehicle.OccupancyUpdatedAt.Format(time.RFC3339Nano),
+	}
+	if vehicle.Occupancy != nil {
+		msg["occupancy"] = *vehicle.Occupancy
+	}
+	locationHub.PublishLocation(msg)
+}
+
+// currentOccupancy clears an occupancy report that is older than occupancyTTL.
+func currentOccupancy(vehicle *models.Vehicle, now time.Time) {
+	if vehicle.OccupancyUpdatedAt == nil || now.Sub(*vehicle.OccupancyUpdatedAt) > occupancyTTL {
+		vehicle.OccupancyStatus = models.OccupancyUnknown
+		vehicle.Occupancy = nil
+	}
+}
+
+// expireStaleOccupancy applies currentOccupancy and currentCrowding to every
+// vehicle in a listing.
+func expireStaleOccupancy(vehicles []models.Vehicle) {
+	now := time.Now()
+	for i := range vehicles {
+		currentOccupancy(&vehicles[i], now)
+		currentCrowding(&vehicles[i], now)
+	}
+}
+
+// processDriverOccupancy handles an {"type":"occupancy"} message on the driver
+// WebSocket, updating the vehicle currently assigned to the driver.
+func processDriverOccupancy(driverConn *websocket.Conn, p []byte, driverID uint) {
+	var in occupancyInput
+	if err := json.Unmarshal(p, &in); err != nil {
+		writeWSError(driverConn, "Invalid occupancy message.")
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Where("driver_id = ?", driverID).First(&vehicle).Error; err != nil {
+		logrus.WithError(err).WithField("driver_id", driverID).Warn("processDriverOccupancy: No vehicle assigned to driver.")
+		writeWSError(driverConn, "No vehicle is assigned to you.")
+		return
+	}
+	if err := applyOccupancy(&vehicle, in, time.Now()); err != nil {
+		writeWSError(driverConn, err.Error())
+		return
+	}
+	if err := saveOccupancy(&vehicle); err != nil {
+		logrus.WithError(err).WithField("vehicle_id", vehicle.ID).Error("processDriverOccupancy: Failed to save occupancy.")
+		writeWSError(driverConn, "Failed to save occupancy.")
+		return
+	}
+	writeWS(driverConn, wsproto.TypeAck, gin.H{
+		"type":             "occupancy_saved",
+		"status":           "saved",
+		"vehicle_id":       vehicle.ID,
+		"occupancy_status": vehicle.OccupancyStatus,
+		"occupancy":        vehicle.Occupancy,
+	})
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/journeys"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/pdf"
+	"ma3_tracker/internal/tenancy"
+)
+
+// paymentReceiptListOptions are the sorts and filters payment receipt
+// listings accept.
+var paymentReceiptListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"paid_at": "paid_at",
+		"amount":  "amount",
+	},
+	DefaultSort: "-paid_at",
+	Filters: map[string]pagination.Filter{
+		"journey_id":        pagination.Uint("journey_id = ?"),
+		"method":            pagination.String("method = ?"),
+		"payment_reference": pagination.String("payment_reference = ?"),
+	},
+}
+
+// respondPaymentReceipt responds with the receipt and the legs it covers, as
+// a PDF with ?format=pdf, checking ?code= against its verification code when
+// given.
+func respondPaymentReceipt(c *gin.Context, fn string, receipt models.PaymentReceipt) {
+	detail, err := journeys.DescribePaymentReceipt(config.DB, receipt)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("receipt_id", receipt.ID).Error(fn + ": Failed to describe receipt.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build receipt")
+		return
+	}
+	if c.Query("format") == "pdf" {
+		c.Header("Content-Disposition", `attachment; filename="receipt-`+receipt.Reference+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", pdf.FromText("Receipt "+receipt.Reference, detail.Text()))
+		return
+	}
+	out := gin.H{"data": detail}
+	if code := c.Query("code"); code != "" {
+		out["code_valid"] = journeys.VerifyPaymentReceipt(receipt, code)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// ListPaymentReceipts returns the receipts of the authenticated commuter's
+// payments, newest first.
+func ListPaymentReceipts(c *gin.Context) {
+	var list []models.PaymentReceipt
+	query := config.DB.Model(&models.PaymentReceipt{}).Where("user_id = ?", authenticatedUserID(c))
+	meta, ok := paginate(c, "ListPaymentReceipts", query, paymentReceiptListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// GetPaymentReceipt returns the receipt of one of the authenticated
+// commuter's payments; ?format=pdf returns it as a printable PDF.
+func GetPaymentReceipt(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "GetPaymentReceipt")
+	if !ok {
+		return
+	}
+	var receipt models.PaymentReceipt
+	err := config.DB.Where("user_id = ?", authenticatedUserID(c)).First(&receipt, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Receipt not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("receipt_id", id).Error("GetPaymentReceipt: Failed to load receipt.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load receipt")
+		}
+		return
+	}
+	respondPaymentReceipt(c, "GetPaymentReceipt", receipt)
+}
+
+// saccoReceipts limits a query to receipts for payments towards rides with
+// the sacco: the leg paid for, or any leg of a journey paid as a whole.
+func saccoReceipts(query *gorm.DB, tenant *tenancy.Tenant) *gorm.DB {
+	legs := tenant.Scoped(config.DB.Model(&models.JourneySegment{}))
+	return query.Where("(segment_id = 0 AND journey_id IN (?)) OR segment_id IN (?)",
+		legs.Session(&gorm.Session{}).Select("journey_id"), legs.Session(&gorm.Session{}).Select("id"))
+}
+
+// ListSaccoPaymentReceipts lets a sacco search the receipts of payments for
+// rides with it, e.g. ?payment_reference= for the M-Pesa code a commuter
+// quotes in a dispute.
+func ListSaccoPaymentReceipts(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoPaymentReceipts")
+	if !ok {
+		return
+	}
+	var list []models.PaymentReceipt
+	query := saccoReceipts(config.DB.Model(&models.PaymentReceipt{}), tenant)
+	meta, ok := paginate(c, "ListSaccoPaymentReceipts", query, paymentReceiptListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// GetSaccoPaymentReceipt lets a sacco look up a receipt by its reference,
+// e.g. to settle a dispute. ?code= checks the verification code printed on
+// the commuter's copy and ?format=pdf returns it as a PDF.
+func GetSaccoPaymentReceipt(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetSaccoPaymentReceipt")
+	if !ok {
+		return
+	}
+	var receipt models.PaymentReceipt
+	err := saccoReceipts(config.DB.Where("reference = ?", strings.ToUpper(c.Param("reference"))), tenant).
+		First(&receipt).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Receipt not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", tenant.SaccoID()).Error("GetSaccoPaymentReceipt: Failed to load receipt.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load receipt")
+		}
+		return
+	}
+	respondPaymentReceipt(c, "GetSaccoPaymentReceipt", receipt)
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/playback"
+	"ma3_tracker/internal/trips"
+)
+
+// maxPlaybackSpan bounds the period a playback covers.
+const maxPlaybackSpan = 48 * time.Hour
+
+// Playback event types besides stops.
+const (
+	playbackStageArrival   = "stage_arrival"
+	playbackStageDeparture = "stage_departure"
+	playbackSpeeding       = "speed_violation"
+	playbackDeviation      = "route_deviation"
+	playbackDriving        = "driving_event"
+	playbackSOS            = "sos_alert"
+)
+
+// GetVehiclePlayback replays one of the sacco's vehicles between ?from= and
+// ?to= (default the last 24 hours, at most 48): its track as frames ordered
+// by time, and its stops, stage arrivals and departures, speeding, route
+// deviations, harsh driving and SOS alerts on the same timeline. The
+// vehicle's tracker points are used when it has any in the period, otherwise
+// its drivers' phones'; ?source= picks one. ?interval= (e.g. 5s) resamples
+// the track to fixed steps for smooth animation.
+func GetVehiclePlayback(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "GetVehiclePlayback")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	if to.Sub(from) > maxPlaybackSpan {
+		apierror.Respond(c, http.StatusBadRequest, "The period can be at most 48 hours")
+		return
+	}
+	var interval time.Duration
+	if raw := c.Query("interval"); raw != "" {
+		var err error
+		if interval, err = time.ParseDuration(raw); err != nil || interval < time.Second || interval > 10*time.Minute {
+			apierror.Respond(c, http.StatusBadRequest, "interval must be a duration between 1s and 10m, e.g. 5s")
+			return
+		}
+	}
+	source := c.Query("source")
+	switch source {
+	case "", models.LocationSourceTracker, models.LocationSourceDriver:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "source must be tracker or driver")
+		return
+	}
+
+	fail := func(err error, what string) {
+		logrus.WithError(err).WithField("vehicle_id", vehicle.ID).Error("GetVehiclePlayback: Failed to load " + what + ".")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build playback")
+	}
+	if source == "" {
+		source = models.LocationSourceDriver
+		var probe models.LocationHistory
+		if err := config.Replica().Select("id").
+			Where("vehicle_id = ? AND source = ? AND timestamp >= ? AND timestamp < ?", vehicle.ID, models.LocationSourceTracker, from, to).
+			Limit(1).Find(&probe).Error; err != nil {
+			fail(err, "points")
+			return
+		}
+		if probe.ID != 0 {
+			source = models.LocationSourceTracker
+		}
+	}
+	var points []models.LocationHistory
+	if err := config.Replica().Where("vehicle_id = ? AND source = ? AND timestamp >= ? AND timestamp < ?", vehicle.ID, source, from, to).
+		Order("timestamp, id").Find(&points).Error; err != nil {
+		fail(err, "points")
+		return
+	}
+
+	var frames []playback.Frame
+	if interval > 0 {
+		frames = playback.Resample(points, interval, trips.Gap)
+	} else {
+		frames = playback.Track(points)
+	}
+	events := playback.Stops(points, trips.MinStop)
+
+	var stageEvents []models.StageEvent
+	if err := config.Replica().Preload("Stage").Where("vehicle_id = ? AND at >= ? AND at < ?", vehicle.ID, from, to).Find(&stageEvents).Error; err != nil {
+		fail(err, "stage events")
+		return
+	}
+	for _, e := range stageEvents {
+		kind := playbackStageArrival
+		details := map[string]interface{}{"stage_id": e.StageID, "route_id": e.RouteID}
+		if e.Stage != nil {
+			details["stage_name"] = e.Stage.Name
+		}
+		if e.Kind == models.StageDeparture {
+			kind = playbackStageDeparture
+			details["dwell_seconds"] = e.DwellSeconds
+		}
+		events = append(events, playback.Event{Type: kind, At: e.At, Latitude: e.Latitude, Longitude: e.Longitude, Details: details})
+	}
+
+	// Speeding and deviation episodes overlapping the period are included
+	// even when they started before it.
+	overlapping := "vehicle_id = ? AND started_at < ? AND (ended_at IS NULL OR ended_at >= ?)"
+	var violations []models.SpeedViolation
+	if err := config.Replica().Where(overlapping, vehicle.ID, to, from).Find(&violations).Error; err != nil {
+		fail(err, "speed violations")
+		return
+	}
+	for _, v := range violations {
+		events = append(events, playback.Event{
+			Type: playbackSpeeding, At: v.StartedAt, EndedAt: v.EndedAt, Latitude: v.Latitude, Longitude: v.Longitude,
+			Details: map[string]interface{}{"limit": v.Limit, "max_speed": v.MaxSpeed, "driver_id": v.DriverID},
+		})
+	}
+
+	var deviations []models.RouteDeviation
+	if err := config.Replica().Where(overlapping, vehicle.ID, to, from).Find(&deviations).Error; err != nil {
+		fail(err, "route deviations")
+		return
+	}
+	for _, d := range deviations {
+		events = append(events, playback.Event{
+			Type: playbackDeviation, At: d.StartedAt, EndedAt: d.EndedAt, Latitude: d.Latitude, Longitude: d.Longitude,
+			Details: map[string]interface{}{"route_id": d.RouteID, "max_distance_m": d.MaxDistanceM, "driver_id": d.DriverID},
+		})
+	}
+
+	// Driving events are recorded per driver; those of the drivers seen in
+	// the track while they were in it belong to this vehicle.
+	driverSpans := map[uint][2]time.Time{}
+	for _, p := range points {
+		if p.DriverID == 0 {
+			continue
+		}
+		span, seen := driverSpans[p.DriverID]
+		if !seen {
+			span[0] = p.Timestamp
+		}
+		span[1] = p.Timestamp
+		driverSpans[p.DriverID] = span
+	}
+	for driverID, span := range driverSpans {
+		var drivingEvents []models.DrivingEvent
+		if err := config.Replica().Where("driver_id = ? AND occurred_at >= ? AND occurred_at <= ?", driverID, span[0], span[1]).
+			Find(&drivingEvents).Error; err != nil {
+			fail(err, "driving events")
+			return
+		}
+		for _, e := range drivingEvents {
+			events = append(events, playback.Event{
+				Type: playbackDriving, At: e.OccurredAt, Latitude: e.Latitude, Longitude: e.Longitude,
+				Details: map[string]interface{}{"kind": e.Kind, "value": e.Value, "threshold": e.Threshold, "driver_id": e.DriverID},
+			})
+		}
+	}
+
+	var alerts []models.SOSAlert
+	if err := config.Replica().Where("vehicle_id = ? AND raised_at >= ? AND raised_at < ?", vehicle.ID, from, to).Find(&alerts).Error; err != nil {
+		fail(err, "SOS alerts")
+		return
+	}
+	for _, a := range alerts {
+		events = append(events, playback.Event{
+			Type: playbackSOS, At: a.RaisedAt, EndedAt: a.ResolvedAt, Latitude: a.Latitude, Longitude: a.Longitude,
+			Details: map[string]interface{}{"kind": a.Kind, "status": a.Status, "driver_id": a.DriverID},
+		})
+	}
+
+	out := gin.H{
+		"vehicle_id": vehicle.ID,
+		"vehicle_no": vehicle.VehicleNo,
+		"source":     source,
+		"from":       from,
+		"to":         to,
+		"frames":     frames,
+		"events":     playback.Timeline(frames, events),
+	}
+	if interval > 0 {
+		out["interval_s"] = interval.Seconds()
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// positionStaleAfter is the age at which a vehicle's last position is flagged
+// stale: the vehicle has probably stopped reporting.
+var positionStaleAfter = config.EnvDuration("POSITION_STALE_AFTER", 5*time.Minute)
+
+// vehiclePosition is the most recent location point of an in-service vehicle,
+// at its position matched to the route when it has one.
+type vehiclePosition struct {
+	VehicleID  uint      `json:"vehicle_id"`
+	VehicleNo  string    `json:"vehicle_no"`
+	SaccoID    uint      `json:"sacco_id"`
+	RouteID    uint      `json:"route_id"`
+	DriverID   uint      `json:"driver_id"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Accuracy   float64   `json:"accuracy"`
+	Speed      float64   `json:"speed"`
+	Bearing    float64   `json:"bearing"`
+	Source     string    `json:"source"`
+	Timestamp  time.Time `json:"timestamp"`
+	AgeSeconds float64   `json:"age_seconds" gorm:"-"`
+	Stale      bool      `json:"stale" gorm:"-"`
+}
+
+// latestPositions returns the last reported position of every active,
+// in-service vehicle whose column field ("sacco_id", "route_id" or "id")
+// equals id. Vehicles that never reported are left out.
+func latestPositions(field string, id uint) ([]vehiclePosition, error) {
+	return positionsWhere(config.DB.Where("v."+field+" = ?", id))
+}
+
+// positionsInView returns the latest positions inside area, of the vehicles
+// matching field = id or, when field is empty, of every sacco's vehicles.
+func positionsInView(field string, id uint, area *wsArea) ([]vehiclePosition, error) {
+	scope := config.DB.Where("l.latitude BETWEEN ? AND ? AND l.longitude BETWEEN ? AND ?", area.MinLat, area.MaxLat, area.MinLng, area.MaxLng)
+	if field != "" {
+		scope = scope.Where("v."+field+" = ?", id)
+	}
+	positions, err := positionsWhere(scope)
+	if err != nil {
+		return nil, err
+	}
+	inView := positions[:0]
+	for _, p := range positions {
+		if area.contains(geo.Point{Lat: p.Latitude, Lng: p.Longitude}) {
+			inView = append(inView, p)
+		}
+	}
+	return inView, nil
+}
+
+// positionsWhere runs the latest-position query narrowed by scope's
+// conditions.
+func positionsWhere(scope *gorm.DB) ([]vehiclePosition, error) {
+	var positions []vehiclePosition
+	err := config.DB.Table("vehicles AS v").
+		Select(`v.id AS vehicle_id, v.vehicle_no, v.sacco_id, v.route_id, v.driver_id,
+			l.latitude, l.longitude, l.accuracy, l.speed, l.bearing, l.source, l.timestamp`).
+		Joins(`JOIN LATERAL (
+			SELECT COALESCE(lh.matched_latitude, lh.latitude) AS latitude, COALESCE(lh.matched_longitude, lh.longitude) AS longitude,
+				lh.accuracy, lh.speed, lh.bearing, lh.source, lh.timestamp
+			FROM location_histories lh
+			WHERE lh.vehicle_id = v.id AND lh.deleted_at IS NULL
+			ORDER BY lh.timestamp DESC
+			LIMIT 1
+		) l ON true`).
+		Where("v.deleted_at IS NULL AND v.in_service AND v.status = ?", models.VehicleActive).
+		Where(scope).
+		Order("v.id").
+		Scan(&positions).Error
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range positions {
+		age := now.Sub(positions[i].Timestamp)
+		positions[i].AgeSeconds = age.Seconds()
+		positions[i].Stale = age > positionStaleAfter
+	}
+	return positions, nil
+}
+
+// ListVehiclePositions returns the last known position of each in-service
+// vehicle of a sacco (?sacco_id=) or on a route (?route_id=), with how old
+// each position is, so a map can be drawn before live updates arrive.
+func ListVehiclePositions(c *gin.Context) {
+	var field string
+	var id uint64
+	for _, name := range []string{"route_id", "sacco_id"} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || parsed == 0 {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		field, id = name, parsed
+		break
+	}
+	if field == "" {
+		apierror.Respond(c, http.StatusBadRequest, "sacco_id or route_id is required")
+		return
+	}
+	positions, err := latestPositions(field, uint(id))
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField(field, id).Error("ListVehiclePositions: Failed to load positions.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load vehicle positions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":                positions,
+		"stale_after_seconds": positionStaleAfter.Seconds(),
+		"generated_at":        time.Now().UTC(),
+	})
+}
+
+// positionMessage renders a position like a live location broadcast.
+func positionMessage(p vehiclePosition) map[string]interface{} {
+	msg := map[string]interface{}{
+		"vehicle_id":  p.VehicleID,
+		"vehicle_no":  p.VehicleNo,
+		"sacco_id":    float64(p.SaccoID),
+		"latitude":    p.Latitude,
+		"longitude":   p.Longitude,
+		"accuracy":    p.Accuracy,
+		"speed":       p.Speed,
+		"bearing":     p.Bearing,
+		"source":      p.Source,
+		"timestamp":   p.Timestamp.Format(time.RFC3339Nano),
+		"age_seconds": p.AgeSeconds,
+		"stale":       p.Stale,
+	}
+	if p.RouteID != 0 {
+		msg["route_id"] = p.RouteID
+	}
+	if p.DriverID != 0 {
+		msg["driver_id"] = p.DriverID
+	}
+	return msg
+}
+
+// snapshotMessage builds a {"type":"snapshot"} message with the last known
+// position of each vehicle matching field = id (see latestPositions), so a
+// newly connected map is populated before vehicles next report. With an area
+// only the vehicles inside it are included, and an empty field takes every
+// sacco's. It returns nil when the positions cannot be loaded.
+func snapshotMessage(field string, id uint, area *wsArea, prefs format.Preferences) map[string]interface{} {
+	if field == "vehicle_id" {
+		field = "id"
+	}
+	var positions []vehiclePosition
+	var err error
+	if area != nil {
+		positions, err = positionsInView(field, id, area)
+	} else {
+		positions, err = latestPositions(field, id)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField(field, id).Error("snapshotMessage: Failed to load positions.")
+		return nil
+	}
+	vehicles := make([]map[string]interface{}, 0, len(positions))
+	for _, p := range positions {
+		vehicles = append(vehicles, localizeBroadcast(positionMessage(p), prefs))
+	}
+	return map[string]interface{}{
+		"type":                "snapshot",
+		"vehicles":            vehicles,
+		"stale_after_seconds": positionStaleAfter.Seconds(),
+		"timestamp":           time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
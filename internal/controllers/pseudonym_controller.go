@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pseudonym"
+)
+
+// Re-identification outcomes recorded in the audit log.
+const (
+	reidentifyResolved     = "resolved"
+	reidentifyNotFound     = "not_found"
+	reidentifyKeyDestroyed = "key_destroyed"
+)
+
+// ReidentifyPseudonym resolves a pseudonym from an analytics export back to
+// the driver or user it stands for. Every request is audited with its reason,
+// whether or not it succeeds.
+func ReidentifyPseudonym(c *gin.Context) {
+	var input struct {
+		Pseudonym string `json:"pseudonym" binding:"required"`
+		Reason    string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	input.Pseudonym = strings.TrimSpace(input.Pseudonym)
+	kind, epoch, err := pseudonym.Parse(input.Pseudonym)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "Not a valid pseudonym")
+		return
+	}
+	if !pseudonym.Enabled() {
+		apierror.Respond(c, http.StatusServiceUnavailable, pseudonym.ErrNotConfigured.Error())
+		return
+	}
+
+	audit := models.ReidentificationRequest{
+		RequestedBy: authenticatedUserID(c),
+		Pseudonym:   input.Pseudonym,
+		Epoch:       epoch,
+		Reason:      strings.TrimSpace(input.Reason),
+		SubjectKind: kind,
+	}
+	_, id, err := pseudonym.Reidentify(config.DB, input.Pseudonym)
+	switch {
+	case err == nil:
+		audit.SubjectID, audit.Outcome = id, reidentifyResolved
+	case errors.Is(err, pseudonym.ErrNotFound):
+		audit.Outcome = reidentifyNotFound
+	case errors.Is(err, pseudonym.ErrKeyDestroyed):
+		audit.Outcome = reidentifyKeyDestroyed
+	default:
+		logrus.WithContext(c).WithError(err).Error("ReidentifyPseudonym: Failed to resolve pseudonym.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to resolve pseudonym")
+		return
+	}
+	if err := config.DB.Create(&audit).Error; err != nil {
+		// The audit trail is the condition for re-identification; without it nothing is disclosed.
+		logrus.WithContext(c).WithError(err).Error("ReidentifyPseudonym: Failed to record audit entry.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to record request")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"request_id": audit.ID, "requested_by": audit.RequestedBy, "outcome": audit.Outcome}).
+		Warn("ReidentifyPseudonym: Pseudonym re-identification requested.")
+
+	switch audit.Outcome {
+	case reidentifyNotFound:
+		apierror.Fail(c, apierror.New(http.StatusNotFound, "No subject matches this pseudonym").WithDetail("request_id", audit.ID))
+	case reidentifyKeyDestroyed:
+		apierror.Fail(c, apierror.New(http.StatusGone, "The key for this pseudonym has been destroyed; it can no longer be re-identified").WithDetail("request_id", audit.ID))
+	default:
+		c.JSON(http.StatusOK, gin.H{"data": audit})
+	}
+}
+
+// ListReidentificationRequests returns the re-identification audit log, newest first.
+func ListReidentificationRequests(c *gin.Context) {
+	var requests []models.ReidentificationRequest
+	if err := config.DB.Order("created_at DESC").Limit(500).Find(&requests).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListReidentificationRequests: Failed to load audit log.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load re-identification requests")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": requests})
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/relief"
+)
+
+// reliefInput starts a relief session for DurationMinutes.
+type reliefInput struct {
+	ReliefDriverID  uint   `json:"relief_driver_id" binding:"required"`
+	DurationMinutes int    `json:"duration_minutes" binding:"required,gt=0"`
+	Note            string `json:"note"`
+}
+
+// startRelief validates the input against the caller's sacco and starts the
+// session, writing the response in every case.
+func startRelief(c *gin.Context, fn string, vehicleID uint, in reliefInput) {
+	tenant, ok := authenticatedTenant(c, fn)
+	if !ok {
+		return
+	}
+	duration := time.Duration(in.DurationMinutes) * time.Minute
+	if duration > relief.MaxDuration {
+		apierror.Respond(c, http.StatusBadRequest, "duration_minutes exceeds the maximum of "+relief.MaxDuration.String())
+		return
+	}
+	var reliefDriver models.Driver
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", in.ReliefDriverID).First(&reliefDriver).Error; err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "Relief driver not found or does not belong to this sacco")
+		return
+	}
+
+	session, err := relief.Start(config.DB, vehicleID, reliefDriver.ID, duration, in.Note, time.Now())
+	switch {
+	case errors.Is(err, relief.ErrSessionActive), errors.Is(err, relief.ErrDriverBusy):
+		apierror.Respond(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, relief.ErrNoDriver), errors.Is(err, relief.ErrSameDriver):
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicleID).Error(fn + ": Failed to start relief session.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to start relief session")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"vehicle_id":        vehicleID,
+		"primary_driver_id": session.PrimaryDriverID,
+		"relief_driver_id":  session.ReliefDriverID,
+		"expires_at":        session.ExpiresAt,
+	}).Info(fn + ": Relief session started.")
+	c.JSON(http.StatusCreated, gin.H{"data": session})
+}
+
+// endRelief ends the session and writes the response.
+func endRelief(c *gin.Context, fn string, sessionID uint, reason string) {
+	session, err := relief.End(config.DB, sessionID, reason, time.Now())
+	if errors.Is(err, relief.ErrEnded) {
+		apierror.Respond(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("session_id", sessionID).Error(fn + ": Failed to end relief session.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to end relief session")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"session_id": session.ID, "reason": reason}).Info(fn + ": Relief session ended.")
+	c.JSON(http.StatusOK, gin.H{"data": session})
+}
+
+// StartVehicleRelief lets a sacco hand one of its vehicles to a relief driver.
+func StartVehicleRelief(c *gin.Context) {
+	vehicleID, ok := parseUintParam(c, "id", "StartVehicleRelief")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "StartVehicleRelief")
+	if !ok {
+		return
+	}
+	var in reliefInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", vehicleID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
+		return
+	}
+	startRelief(c, "StartVehicleRelief", vehicle.ID, in)
+}
+
+// ListReliefSessions lists the sacco's relief sessions, newest first.
+// ?active=true limits the list to sessions still running; ?vehicle_id= filters by vehicle.
+func ListReliefSessions(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListReliefSessions")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	query := config.DB.Scopes(tenant.SaccoScope)
+	if c.Query("active") == "true" {
+		query = query.Where("ended_at IS NULL")
+	}
+	if v := c.Query("vehicle_id"); v != "" {
+		query = query.Where("vehicle_id = ?", v)
+	}
+	var sessions []models.ReliefSession
+	if err := query.Order("started_at DESC").Limit(200).Find(&sessions).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ListReliefSessions: Failed to list sessions.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list relief sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": sessions})
+}
+
+// EndSaccoReliefSession lets the sacco end a relief session early.
+func EndSaccoReliefSession(c *gin.Context) {
+	session, ok := loadOwned[models.ReliefSession](c, "EndSaccoReliefSession", "Relief session", config.DB)
+	if !ok {
+		return
+	}
+	endRelief(c, "EndSaccoReliefSession", session.ID, models.ReliefEndCancelled)
+}
+
+// HandOverVehicle lets a driver hand their assigned vehicle to a relief driver
+// from the same sacco.
+func HandOverVehicle(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "HandOverVehicle")
+	if !ok {
+		return
+	}
+	var in reliefInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Where("driver_id = ?", driver.ID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "No vehicle assigned to this driver.")
+		return
+	}
+	startRelief(c, "HandOverVehicle", vehicle.ID, in)
+}
+
+// GetDriverReliefSession returns the active relief session the driver is part
+// of, either as the regular or the relief driver.
+func GetDriverReliefSession(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "GetDriverReliefSession")
+	if !ok {
+		return
+	}
+	session, err := relief.ForDriver(config.DB, driver.ID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("GetDriverReliefSession: Failed to load session.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load relief session")
+		return
+	}
+	if session == nil {
+		apierror.Respond(c, http.StatusNotFound, "No active relief session")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": session})
+}
+
+// HandBackVehicle ends the driver's active relief session, returning the
+// vehicle to its regular driver.
+func HandBackVehicle(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "HandBackVehicle")
+	if !ok {
+		return
+	}
+	session, err := relief.ForDriver(config.DB, driver.ID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("HandBackVehicle: Failed to load session.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load relief session")
+		return
+	}
+	if session == nil {
+		apierror.Respond(c, http.StatusNotFound, "No active relief session")
+		return
+	}
+	endRelief(c, "HandBackVehicle", session.ID, models.ReliefEndHandback)
+}
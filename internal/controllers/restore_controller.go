@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// stageRestoreWindow is how long before its route a stage may have been
+// deleted and still be taken to have gone with it: DeleteRoute deletes the
+// stages first. Stages replaced earlier stay deleted.
+const stageRestoreWindow = time.Minute
+
+// loadDeletedSaccoRow loads into dest the sacco's soft-deleted row with the
+// :id path parameter, responding 404 when the sacco has no such deleted row.
+// name is what the row is, e.g. "route".
+func loadDeletedSaccoRow(c *gin.Context, fn, name string, dest interface{}) bool {
+	tenant, ok := saccoTenant(c, fn)
+	if !ok {
+		return false
+	}
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return false
+	}
+	err := config.DB.Unscoped().Scopes(tenant.SaccoScope).Where("id = ? AND deleted_at IS NOT NULL", id).First(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Respond(c, http.StatusNotFound, "Deleted "+name+" not found")
+		return false
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("id", id).Error(fn + ": Failed to load deleted row.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load deleted "+name)
+		return false
+	}
+	return true
+}
+
+// undelete clears the deleted_at of row.
+func undelete(tx *gorm.DB, row interface{}) error {
+	return tx.Unscoped().Model(row).Update("deleted_at", nil).Error
+}
+
+// RestoreRoute brings back one of the sacco's deleted routes with the stages
+// deleted along with it. The route keeps the status it had.
+func RestoreRoute(c *gin.Context) {
+	var route models.Route
+	if !loadDeletedSaccoRow(c, "RestoreRoute", "route", &route) {
+		return
+	}
+	deletedAt := route.DeletedAt.Time
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := undelete(tx, &route); err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Stage{}).
+			Where("route_id = ? AND deleted_at BETWEEN ? AND ?", route.ID, deletedAt.Add(-stageRestoreWindow), deletedAt).
+			Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("RestoreRoute: Failed to restore route.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to restore route")
+		return
+	}
+	if err := config.DB.Preload("Stages").Preload("Vehicles").Preload("Tags").First(&route, route.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("RestoreRoute: Failed to reload route.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load restored route")
+		return
+	}
+	logrus.WithContext(c).WithField("route_id", route.ID).Info("RestoreRoute: Route restored.")
+	c.JSON(http.StatusOK, gin.H{"message": "Route restored successfully", "data": toRouteResponse(route)})
+}
+
+// RestoreVehicle brings back one of the sacco's deleted vehicles. It comes
+// back without a driver, as deleting it ended their assignment; assign one
+// again with /sacco/vehicles/:id/assign-driver.
+func RestoreVehicle(c *gin.Context) {
+	var vehicle models.Vehicle
+	if !loadDeletedSaccoRow(c, "RestoreVehicle", "vehicle", &vehicle) {
+		return
+	}
+	if err := config.DB.Unscoped().Model(&vehicle).Updates(map[string]interface{}{"deleted_at": nil, "driver_id": 0}).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("RestoreVehicle: Failed to restore vehicle.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to restore vehicle")
+		return
+	}
+	vehicle.DeletedAt, vehicle.DriverID = gorm.DeletedAt{}, 0
+	logrus.WithContext(c).WithField("vehicle_id", vehicle.ID).Info("RestoreVehicle: Vehicle restored.")
+	c.JSON(http.StatusOK, gin.H{"message": "Vehicle restored successfully", "data": vehicle})
+}
+
+// RestoreServiceAlert brings back one of the sacco's deleted service alerts.
+func RestoreServiceAlert(c *gin.Context) {
+	var alert models.ServiceAlert
+	if !loadDeletedSaccoRow(c, "RestoreServiceAlert", "service alert", &alert) {
+		return
+	}
+	if err := undelete(config.DB, &alert); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("alert_id", alert.ID).Error("RestoreServiceAlert: Failed to restore alert.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to restore service alert")
+		return
+	}
+	alert.DeletedAt = gorm.DeletedAt{}
+	c.JSON(http.StatusOK, gin.H{"message": "Service alert restored successfully", "data": alert})
+}
+
+// RestoreFareRule brings back one of the sacco's deleted fare rules, which
+// applies again over its schedule.
+func RestoreFareRule(c *gin.Context) {
+	var rule models.FareRule
+	if !loadDeletedSaccoRow(c, "RestoreFareRule", "fare rule", &rule) {
+		return
+	}
+	if err := undelete(config.DB, &rule); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("fare_rule_id", rule.ID).Error("RestoreFareRule: Failed to restore fare rule.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to restore fare rule")
+		return
+	}
+	rule.DeletedAt = gorm.DeletedAt{}
+	c.JSON(http.StatusOK, gin.H{"message": "Fare rule restored successfully", "data": rule})
+}
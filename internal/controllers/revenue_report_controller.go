@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/tenancy"
+)
+
+// revenueRow is the money taken for rides with one vehicle and driver on one
+// route on one day. Cash is held by the crew until handed over to the sacco,
+// so it counts as pending alongside M-Pesa prompts not yet answered; mobile
+// money and card payments reach the sacco directly and are settled.
+type revenueRow struct {
+	Date          string  `json:"date"`
+	RouteID       uint    `json:"route_id"`
+	RouteName     string  `json:"route_name"`
+	VehicleID     uint    `json:"vehicle_id"` // 0 for rides not yet validated on board
+	VehicleNo     string  `json:"vehicle_no"`
+	DriverID      uint    `json:"driver_id"`
+	DriverName    string  `json:"driver_name"`
+	Rides         int     `json:"rides"` // Validated on board that day
+	Fares         float64 `json:"fares"` // Charged for those rides
+	Payments      int     `json:"payments"`
+	Settled       float64 `json:"settled"`
+	PendingCash   float64 `json:"pending_cash"`
+	PendingMobile float64 `json:"pending_mobile"`
+	Pending       float64 `json:"pending"`
+}
+
+func (r *revenueRow) add(o revenueRow) {
+	r.Rides += o.Rides
+	r.Fares += o.Fares
+	r.Payments += o.Payments
+	r.Settled += o.Settled
+	r.PendingCash += o.PendingCash
+	r.PendingMobile += o.PendingMobile
+	r.Pending += o.Pending
+}
+
+// revenueKey identifies a revenueRow.
+type revenueKey struct {
+	date                         string
+	routeID, vehicleID, driverID uint
+}
+
+// revenueGroups are the dimensions the report can be summarised by.
+var revenueGroups = []string{"day", "route", "vehicle", "driver"}
+
+// GetRevenueReport reports the fares the sacco's crews charged and the money
+// paid for rides with the sacco, per day, route, vehicle and driver, so
+// owners can reconcile what conductors hand over.
+//
+// The period is ?date=YYYY-MM-DD or ?range=Nd (the last N days including
+// today, default 7d, at most 92) in the ?tz= time zone. ?route_id=,
+// ?vehicle_id= and ?driver_id= narrow it down. A payment towards a whole
+// journey is shared among its rides in proportion to their fares, and counts
+// on the day it was made; rides count on the day they were validated.
+//
+// The response holds the rows, totals, and summaries by day, route, vehicle
+// and driver. ?format=csv downloads the rows, or one summary with
+// ?group_by=day, route, vehicle or driver.
+func GetRevenueReport(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetRevenueReport")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	loc := format.FromRequest(c.Request).Location
+	from, to, ok := parseReportDays(c, loc)
+	if !ok {
+		return
+	}
+	groupBy := c.Query("group_by")
+	if groupBy != "" && !slices.Contains(revenueGroups, groupBy) {
+		apierror.Respond(c, http.StatusBadRequest, "group_by must be day, route, vehicle or driver")
+		return
+	}
+	output := strings.ToLower(c.DefaultQuery("format", "json"))
+	if output != "json" && output != "csv" {
+		apierror.Respond(c, http.StatusBadRequest, "Unsupported format. Use json or csv.")
+		return
+	}
+	filters := map[string]uint{}
+	for _, param := range []string{"route_id", "vehicle_id", "driver_id"} {
+		if raw := c.Query(param); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				apierror.Respond(c, http.StatusBadRequest, "Invalid "+param)
+				return
+			}
+			filters[param] = uint(id)
+		}
+	}
+
+	rows, err := revenueRows(tenant, from, to, loc)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetRevenueReport: Failed to aggregate revenue.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build revenue report")
+		return
+	}
+	kept := rows[:0]
+	for _, r := range rows {
+		if id, ok := filters["route_id"]; ok && r.RouteID != id {
+			continue
+		}
+		if id, ok := filters["vehicle_id"]; ok && r.VehicleID != id {
+			continue
+		}
+		if id, ok := filters["driver_id"]; ok && r.DriverID != id {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	rows = kept
+	if err := nameRevenueRows(rows); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetRevenueReport: Failed to load names.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build revenue report")
+		return
+	}
+
+	if output == "csv" {
+		filename := fmt.Sprintf("revenue-%s-%s.csv", from.In(loc).Format("2006-01-02"), to.In(loc).AddDate(0, 0, -1).Format("2006-01-02"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		cw := csv.NewWriter(c.Writer)
+		out := rows
+		if groupBy != "" {
+			out = summarizeRevenue(rows, groupBy)
+		}
+		cw.Write([]string{"date", "route_id", "route_name", "vehicle_id", "vehicle_no", "driver_id", "driver_name",
+			"rides", "fares", "payments", "settled", "pending_cash", "pending_mobile", "pending"})
+		for _, r := range out {
+			cw.Write([]string{r.Date, formatID(r.RouteID), r.RouteName, formatID(r.VehicleID), r.VehicleNo, formatID(r.DriverID), r.DriverName,
+				strconv.Itoa(r.Rides), formatFloat(r.Fares), strconv.Itoa(r.Payments), formatFloat(r.Settled),
+				formatFloat(r.PendingCash), formatFloat(r.PendingMobile), formatFloat(r.Pending)})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Warn("GetRevenueReport: Failed to write CSV.")
+		}
+		return
+	}
+
+	var totals revenueRow
+	for _, r := range rows {
+		totals.add(r)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":       rows,
+		"by_day":     summarizeRevenue(rows, "day"),
+		"by_route":   summarizeRevenue(rows, "route"),
+		"by_vehicle": summarizeRevenue(rows, "vehicle"),
+		"by_driver":  summarizeRevenue(rows, "driver"),
+		"totals": gin.H{
+			"rides":          totals.Rides,
+			"fares":          totals.Fares,
+			"payments":       totals.Payments,
+			"settled":        totals.Settled,
+			"pending_cash":   totals.PendingCash,
+			"pending_mobile": totals.PendingMobile,
+			"pending":        totals.Pending,
+		},
+		"currency": format.DefaultCurrency,
+		"from":     from,
+		"to":       to,
+		"timezone": loc.String(),
+	})
+}
+
+// revenueRows aggregates, per day in loc and ride dimensions, the sacco's
+// rides validated between from and to and the payments made then.
+func revenueRows(tenant *tenancy.Tenant, from, to time.Time, loc *time.Location) ([]revenueRow, error) {
+	saccoID := tenant.SaccoID()
+	byKey := map[revenueKey]*revenueRow{}
+	row := func(day time.Time, s models.JourneySegment) *revenueRow {
+		k := revenueKey{day.In(loc).Format("2006-01-02"), s.RouteID, s.VehicleID, s.DriverID}
+		r, ok := byKey[k]
+		if !ok {
+			r = &revenueRow{Date: k.date, RouteID: s.RouteID, VehicleID: s.VehicleID, DriverID: s.DriverID}
+			byKey[k] = r
+		}
+		return r
+	}
+
+	var rides []models.JourneySegment
+	if err := config.Replica().Scopes(tenant.SaccoScope).Where("validated_at >= ? AND validated_at < ?", from, to).Find(&rides).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range rides {
+		r := row(*s.ValidatedAt, s)
+		r.Rides++
+		r.Fares += s.Fare
+	}
+
+	saccoJourneys := config.Replica().Model(&models.JourneySegment{}).Select("journey_id").Scopes(tenant.SaccoScope)
+	var payments []models.JourneyPayment
+	if err := config.Replica().Where("paid_at >= ? AND paid_at < ? AND journey_id IN (?)", from, to, saccoJourneys).Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	var pending []models.MpesaPayment
+	if err := config.Replica().Where("status = ? AND created_at >= ? AND created_at < ? AND journey_id IN (?)", models.MpesaPending, from, to, saccoJourneys).Find(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	journeyIDs := map[uint]bool{}
+	for _, p := range payments {
+		journeyIDs[p.JourneyID] = true
+	}
+	for _, p := range pending {
+		journeyIDs[p.JourneyID] = true
+	}
+	segmentsOf := map[uint][]models.JourneySegment{}
+	if len(journeyIDs) > 0 {
+		ids := make([]uint, 0, len(journeyIDs))
+		for id := range journeyIDs {
+			ids = append(ids, id)
+		}
+		var segments []models.JourneySegment
+		if err := config.Replica().Unscoped().Where("journey_id IN ?", ids).Find(&segments).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range segments {
+			segmentsOf[s.JourneyID] = append(segmentsOf[s.JourneyID], s)
+		}
+	}
+
+	for _, p := range payments {
+		for _, share := range revenueShares(segmentsOf[p.JourneyID], p.SegmentID, saccoID) {
+			r := row(p.PaidAt, share.segment)
+			r.Payments++
+			amount := p.Amount * share.fraction
+			if p.Method == models.PaymentCash {
+				r.PendingCash += amount
+				r.Pending += amount
+			} else {
+				r.Settled += amount
+			}
+		}
+	}
+	for _, p := range pending {
+		for _, share := range revenueShares(segmentsOf[p.JourneyID], p.SegmentID, saccoID) {
+			r := row(p.CreatedAt, share.segment)
+			amount := p.Amount * share.fraction
+			r.PendingMobile += amount
+			r.Pending += amount
+		}
+	}
+
+	rows := make([]revenueRow, 0, len(byKey))
+	for _, r := range byKey {
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.RouteID != b.RouteID {
+			return a.RouteID < b.RouteID
+		}
+		if a.VehicleID != b.VehicleID {
+			return a.VehicleID < b.VehicleID
+		}
+		return a.DriverID < b.DriverID
+	})
+	return rows, nil
+}
+
+// revenueShare is the part of a payment owed to one ride.
+type revenueShare struct {
+	segment  models.JourneySegment
+	fraction float64
+}
+
+// revenueShares splits a payment among the sacco's rides it was for: the one
+// segment named, or all of the journey's in proportion to their fares
+// (equally while none is priced). Shares of other saccos' rides are left
+// out.
+func revenueShares(segments []models.JourneySegment, segmentID, saccoID uint) []revenueShare {
+	var shares []revenueShare
+	if segmentID != 0 {
+		for _, s := range segments {
+			if s.ID == segmentID && s.SaccoID == saccoID {
+				shares = append(shares, revenueShare{s, 1})
+			}
+		}
+		return shares
+	}
+	total := 0.0
+	for _, s := range segments {
+		total += s.Fare
+	}
+	for _, s := range segments {
+		if s.SaccoID != saccoID {
+			continue
+		}
+		fraction := 1 / float64(len(segments))
+		if total > 0 {
+			fraction = s.Fare / total
+		}
+		if fraction > 0 {
+			shares = append(shares, revenueShare{s, fraction})
+		}
+	}
+	return shares
+}
+
+// nameRevenueRows fills in route names, vehicle numbers and driver names.
+func nameRevenueRows(rows []revenueRow) error {
+	var routeIDs, vehicleIDs, driverIDs []uint
+	for _, r := range rows {
+		routeIDs = append(routeIDs, r.RouteID)
+		vehicleIDs = append(vehicleIDs, r.VehicleID)
+		driverIDs = append(driverIDs, r.DriverID)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	var routes []models.Route
+	var vehicles []models.Vehicle
+	var drivers []models.Driver
+	if err := config.Replica().Unscoped().Select("id", "name").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil {
+		return err
+	}
+	if err := config.Replica().Unscoped().Select("id", "vehicle_no").Where("id IN ?", vehicleIDs).Find(&vehicles).Error; err != nil {
+		return err
+	}
+	if err := config.Replica().Unscoped().Select("id", "name").Where("id IN ?", driverIDs).Find(&drivers).Error; err != nil {
+		return err
+	}
+	routeNames, vehicleNos, driverNames := map[uint]string{}, map[uint]string{}, map[uint]string{}
+	for _, r := range routes {
+		routeNames[r.ID] = r.Name
+	}
+	for _, v := range vehicles {
+		vehicleNos[v.ID] = v.VehicleNo
+	}
+	for _, d := range drivers {
+		driverNames[d.ID] = d.Name
+	}
+	for i := range rows {
+		rows[i].RouteName = routeNames[rows[i].RouteID]
+		rows[i].VehicleNo = vehicleNos[rows[i].VehicleID]
+		rows[i].DriverName = driverNames[rows[i].DriverID]
+	}
+	return nil
+}
+
+// summarizeRevenue totals rows by one of revenueGroups, keeping the order in
+// which each group first appears. Fields of the other dimensions are left
+// empty.
+func summarizeRevenue(rows []revenueRow, by string) []revenueRow {
+	index := map[string]int{}
+	out := []revenueRow{}
+	for _, r := range rows {
+		var k string
+		var s revenueRow
+		switch by {
+		case "day":
+			k, s = r.Date, revenueRow{Date: r.Date}
+		case "route":
+			k, s = formatID(r.RouteID), revenueRow{RouteID: r.RouteID, RouteName: r.RouteName}
+		case "vehicle":
+			k, s = formatID(r.VehicleID), revenueRow{VehicleID: r.VehicleID, VehicleNo: r.VehicleNo}
+		case "driver":
+			k, s = formatID(r.DriverID), revenueRow{DriverID: r.DriverID, DriverName: r.DriverName}
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(out)
+			index[k] = i
+			out = append(out, s)
+		}
+		out[i].add(r)
+	}
+	if by != "day" {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Settled+out[i].Pending > out[j].Settled+out[j].Pending })
+	}
+	return out
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -13,8 +13,16 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"ma3_tracker/internal/apierror"
 	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/eta"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/geofence"
+	"ma3_tracker/internal/middleware"
 	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/stops"
 
 	"database/sql"
 
@@ -32,9 +40,16 @@ type RouteResponse struct {
 	Name        string         `json:"name"`
 	Description string         `json:"description"`
 	SaccoID     uint           `json:"sacco_id"`
+	Status      string         `json:"status"`
+	PublishedAt *time.Time     `json:"published_at,omitempty"`
+	ReviewNote  string         `json:"review_note,omitempty"`
 	Geometry    string         `json:"geometry"`
 	Stages      []models.Stage `json:"stages"`
 	Vehicles    []models.Vehicle `json:"vehicles"`
+	Branding    *models.SaccoBranding `json:"branding,omitempty"`
+	Tags        []models.Tag   `json:"tags"`
+	Alerts      []models.ServiceAlert `json:"alerts,omitempty"` // Service alerts in effect; commuter listings only
+	Rating      *routeRating   `json:"rating,omitempty"` // Commuter reviews; commuter listings only
 }
 
 // CommuterRouteResponse is the structure sent back to the Flutter app for an optimal route
@@ -42,9 +57,19 @@ type CommuterRouteResponse struct {
 	ID          uint                 `json:"id"`
 	Name        string               `json:"name"`
 	Description string               `json:"description"`
+	SaccoID     uint                 `json:"sacco_id,omitempty"`
+	Branding    *models.SaccoBranding `json:"branding,omitempty"`
 	Geometry    json.RawMessage      `json:"geometry"`
 	Stages      []RouteStageResponse `json:"stages,omitempty"`
 	IsComposite bool                 `json:"is_composite"`
+	Legs        []JourneyLeg         `json:"legs,omitempty"` // Only when last-mile or door-to-door legs are requested
+	Itinerary   *JourneyItinerary    `json:"itinerary,omitempty"` // Totals of door-to-door legs; direct routes only
+	FareEstimate *format.Money       `json:"fare_estimate,omitempty"` // Sum of the legs' fares
+	FirstMileUnavailable bool        `json:"first_mile_unavailable,omitempty"` // Origin beyond walking and boda range
+	LastMileUnavailable bool         `json:"last_mile_unavailable,omitempty"` // Destination beyond walking and boda range
+	Accessibility *accessibilityReport `json:"accessibility,omitempty"` // Only when an accessibility need applies
+	Alerts      []models.ServiceAlert `json:"alerts,omitempty"` // Service alerts in effect on the route(s)
+	Rating      *routeRating         `json:"rating,omitempty"` // Commuter reviews; direct routes only
 }
 
 // RouteStageResponse represents a segment of a composite route returned to the commuter
@@ -53,6 +78,7 @@ type RouteStageResponse struct {
 	RouteName   string          `json:"route_name"`
 	Description string          `json:"description"`
 	Geometry    json.RawMessage `json:"geometry"`
+	Rating      *routeRating    `json:"rating,omitempty"` // Commuter reviews of the segment's route
 }
 
 // FindRouteRequest includes details for route search
@@ -62,6 +88,10 @@ type FindRouteRequest struct {
 	EndLat                float64 `json:"end_lat" binding:"required"`
 	EndLon                float64 `json:"end_lon" binding:"required"`
 	OptimalGeometryGeoJSON string  `json:"optimal_geometry_geojson" binding:"required"`
+	Tags                  []string `json:"tags"` // Only match routes carrying all of these tag slugs
+	LastMile              bool     `json:"last_mile"` // Append walking or boda-boda legs when the destination is far from a stage
+	DoorToDoor            bool     `json:"door_to_door"` // Legs from the origin through to the destination, with their totals
+	Accessibility         string   `json:"accessibility"` // wheelchair, low_step or none; defaults to the commuter's saved preference
 }
 
 // toRouteResponse converts a models.Route to a RouteResponse
@@ -75,9 +105,51 @@ func toRouteResponse(route models.Route) RouteResponse {
 		Name:        route.Name,
 		Description: route.Description,
 		SaccoID:     route.SaccoID,
+		Status:      route.Status,
+		PublishedAt: route.PublishedAt,
+		ReviewNote:  route.ReviewNote,
 		Geometry:    jsonGeom,
 		Stages:      route.Stages,
 		Vehicles:    route.Vehicles,
+		Tags:        route.Tags,
+	}
+}
+
+// maxSimplifyTolerance caps ?tolerance= so clients can't collapse routes to a single segment.
+const maxSimplifyTolerance = 1000.0
+
+// parseToleranceQuery reads the optional ?tolerance= (meters) used to simplify
+// geometries for map overviews. It responds with 400 on invalid input.
+func parseToleranceQuery(c *gin.Context) (float64, bool) {
+	raw := c.Query("tolerance")
+	if raw == "" {
+		return 0, true
+	}
+	tolerance, err := strconv.ParseFloat(raw, 64)
+	if err != nil || tolerance < 0 || tolerance > maxSimplifyTolerance {
+		apierror.Respond(c, http.StatusBadRequest, fmt.Sprintf("tolerance must be a number of meters between 0 and %.0f", maxSimplifyTolerance))
+		return 0, false
+	}
+	return tolerance, true
+}
+
+// simplifyRouteGeometries applies Douglas-Peucker simplification to each route's
+// geometry in place. Routes whose geometry can't be decoded are left untouched.
+func simplifyRouteGeometries(routes []models.Route, toleranceMeters float64) {
+	if toleranceMeters <= 0 {
+		return
+	}
+	for i := range routes {
+		line, err := geo.LineFromWKB(routes[i].Geometry)
+		if err != nil {
+			continue
+		}
+		simplified, err := geo.LineToWKB(geo.Simplify(line, toleranceMeters))
+		if err != nil {
+			logrus.WithError(err).WithField("route_id", routes[i].ID).Warn("simplifyRouteGeometries: Failed to encode simplified geometry.")
+			continue
+		}
+		routes[i].Geometry = simplified
 	}
 }
 
@@ -123,34 +195,38 @@ func convertWKBToGeoJSON(wkbBytes []byte) (string, error) {
 
 // findDirectMatchingRoute attempts to find a single existing route closely matching the ORS path.
 // findDirectMatchingRoute attempts to find a single existing route closely matching the ORS path.
-func findDirectMatchingRoute(orsWKBGeometry []byte) (*CommuterRouteResponse, error) {
+func findDirectMatchingRoute(orsWKBGeometry []byte, tagSlugs []string, accessibility string) (*CommuterRouteResponse, error) {
 	logrus.Info("findDirectMatchingRoute: Attempting to find a direct matching route.")
 
 	const endpointTolerance = 0.0005 // Approx 50 meters
 	query := `
 		SELECT
-			r.id, r.name, r.description, ST_AsGeoJSON(r.geometry::geometry) AS geometry_geojson
+			r.id, r.name, r.description, r.sacco_id, ST_AsGeoJSON(r.geometry::geometry) AS geometry_geojson
 		FROM
 			routes r, ST_GeomFromWKB($1, 4326) AS ors_geom
 		WHERE
 			ST_Intersects(ST_SetSRID(r.geometry::geometry, 4326), ors_geom) AND -- Explicitly set SRID for r.geometry
 			ST_DWithin(ST_SetSRID(ST_StartPoint(r.geometry), 4326), ST_StartPoint(ors_geom), $2) AND -- Explicitly set SRID
-			ST_DWithin(ST_SetSRID(ST_EndPoint(r.geometry), 4326), ST_EndPoint(ors_geom), $2) -- Explicitly set SRID
+			ST_DWithin(ST_SetSRID(ST_EndPoint(r.geometry), 4326), ST_EndPoint(ors_geom), $2) AND -- Explicitly set SRID
+			r.status = 'published' AND r.deleted_at IS NULL AND
+			` + routeTagFilterSQL("$3") + ` AND
+			` + routeAccessibilityFilterSQL("$4") + `
 		ORDER BY
 			ST_Length(ST_Intersection(ST_SetSRID(r.geometry::geometry, 4326), ors_geom)) DESC, -- Explicitly set SRID
 			ST_HausdorffDistance(ST_SetSRID(r.geometry::geometry, 4326), ors_geom) ASC -- Explicitly set SRID
 		LIMIT 1;
 	`
-	row := config.DB.Raw(query, orsWKBGeometry, endpointTolerance).Row()
+	row := config.DB.Raw(query, orsWKBGeometry, endpointTolerance, tagSlugs, accessibility).Row()
 
 	var (
 		id          uint
 		name        string
 		description sql.NullString
+		saccoID     uint
 		geometryGeoJSON []byte
 	)
 
-	err := row.Scan(&id, &name, &description, &geometryGeoJSON)
+	err := row.Scan(&id, &name, &description, &saccoID, &geometryGeoJSON)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			logrus.Info("findDirectMatchingRoute: No direct matching route found.")
@@ -161,17 +237,23 @@ func findDirectMatchingRoute(orsWKBGeometry []byte) (*CommuterRouteResponse, err
 	}
 
 	logrus.Infof("findDirectMatchingRoute: Found a direct matching route (ID: %d).", id)
+	var branding *models.SaccoBranding
+	if b, ok := loadSaccoBranding([]uint{saccoID})[saccoID]; ok {
+		branding = &b
+	}
 	return &CommuterRouteResponse{
 		ID:          id,
 		Name:        name,
 		Description: description.String,
+		SaccoID:     saccoID,
+		Branding:    branding,
 		Geometry:    json.RawMessage(geometryGeoJSON),
 		IsComposite: false,
 	}, nil
 }
 
 // findCompositeRouteCandidates finds existing routes that significantly intersect the ORS path.
-func findCompositeRouteCandidates(orsWKBGeometry []byte) ([]RouteStageResponse, error) {
+func findCompositeRouteCandidates(orsWKBGeometry []byte, tagSlugs []string, accessibility string) ([]RouteStageResponse, error) {
 	logrus.Info("findCompositeRouteCandidates: Attempting to find relevant routes for composite search.")
 
 	const intersectionLengthThreshold = 0.001 // Minimum intersection length to consider a segment relevant
@@ -182,12 +264,15 @@ func findCompositeRouteCandidates(orsWKBGeometry []byte) ([]RouteStageResponse,
 		FROM
 			routes r
 		WHERE
-			ST_Intersects(ST_SetSRID(r.geometry::geometry, 4326), ST_GeomFromWKB($1, 4326)) -- Explicitly set SRID
+			ST_Intersects(ST_SetSRID(r.geometry::geometry, 4326), ST_GeomFromWKB($1, 4326)) AND -- Explicitly set SRID
+			r.status = 'published' AND r.deleted_at IS NULL AND
+			` + routeTagFilterSQL("$2") + ` AND
+			` + routeAccessibilityFilterSQL("$3") + `
 		ORDER BY
 			intersection_length DESC
 		LIMIT 5;
 	`
-	rows, err := config.DB.Raw(query, orsWKBGeometry).Rows()
+	rows, err := config.DB.Raw(query, orsWKBGeometry, tagSlugs, accessibility).Rows()
 	if err != nil {
 		logrus.WithError(err).Error("findCompositeRouteCandidates: Database error executing segment match query.")
 		return nil, fmt.Errorf("database error executing segment match query: %w", err)
@@ -230,15 +315,15 @@ func findCompositeRouteCandidates(orsWKBGeometry []byte) ([]RouteStageResponse,
 // FindOptimalRoute handles finding the best route between two points for commuters,
 // leveraging the frontend-provided optimal_geometry_geojson.
 func FindOptimalRoute(c *gin.Context) {
-	logrus.Info("FindOptimalRoute: Starting route optimization process.")
+	logrus.WithContext(c).Info("FindOptimalRoute: Starting route optimization process.")
 	var req FindRouteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logrus.WithError(err).Warn("FindOptimalRoute: Invalid request body or missing optimal_geometry_geojson.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body or missing optimal_geometry_geojson: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Warn("FindOptimalRoute: Invalid request body or missing optimal_geometry_geojson.")
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(c).WithFields(logrus.Fields{
 		"start_lat": req.StartLat,
 		"start_lon": req.StartLon,
 		"end_lat":   req.EndLat,
@@ -248,131 +333,209 @@ func FindOptimalRoute(c *gin.Context) {
 
 	orsWKBGeometry, err := parseAndConvertGeometry(req.OptimalGeometryGeoJSON)
 	if err != nil {
-		logrus.WithError(err).Error("FindOptimalRoute: Failed to parse optimal_geometry_geojson.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid optimal_geometry_geojson: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("FindOptimalRoute: Failed to parse optimal_geometry_geojson.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid optimal_geometry_geojson: "+err.Error())
 		return
 	}
 
 	// Step 1: Attempt to find a direct single route match
-	directRoute, err := findDirectMatchingRoute(orsWKBGeometry)
+	tagSlugs := []string{}
+	for _, t := range req.Tags {
+		if slug := tagSlug(t); slug != "" {
+			tagSlugs = append(tagSlugs, slug)
+		}
+	}
+
+	accessibility, ok := commuterAccessibility(c, req.Accessibility)
+	if !ok {
+		return
+	}
+
+	directRoute, err := findDirectMatchingRoute(orsWKBGeometry, tagSlugs, accessibility)
 	if err != nil {
-		logrus.WithError(err).Error("FindOptimalRoute: Error searching for direct route.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find any route due to backend error: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("FindOptimalRoute: Error searching for direct route.")
+		apierror.Fail(c, apierror.Internal("Failed to find any route due to backend error", err))
 		return
 	}
+	start, dest := geo.Point{Lat: req.StartLat, Lng: req.StartLon}, geo.Point{Lat: req.EndLat, Lng: req.EndLon}
+	prefs := middleware.FormatPreferences(c)
 	if directRoute != nil {
+		if req.LastMile || req.DoorToDoor {
+			directRoute.Legs, directRoute.FirstMileUnavailable, directRoute.LastMileUnavailable = journeyLegs(prefs, []uint{directRoute.ID}, start, dest, true, req.DoorToDoor)
+			if req.DoorToDoor && len(directRoute.Legs) > 0 {
+				directRoute.Itinerary = newJourneyItinerary(prefs, directRoute.Legs)
+			}
+			directRoute.FareEstimate = legsFare(prefs, directRoute.Legs)
+		}
+		if accessibility != "" {
+			directRoute.Accessibility = buildAccessibilityReport([]uint{directRoute.ID}, accessibility)
+		}
+		directRoute.Alerts = activeServiceAlerts([]uint{directRoute.ID})[directRoute.ID]
+		directRoute.Rating = routeRatings([]uint{directRoute.ID})[directRoute.ID]
 		c.JSON(http.StatusOK, gin.H{"data": []CommuterRouteResponse{*directRoute}})
 		return
 	}
 
 	// Step 2: If no direct match, attempt to find composite route candidates
-	compositeCandidates, err := findCompositeRouteCandidates(orsWKBGeometry)
+	compositeCandidates, err := findCompositeRouteCandidates(orsWKBGeometry, tagSlugs, accessibility)
 	if err != nil {
-		logrus.WithError(err).Error("FindOptimalRoute: Error searching for composite candidates.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find any route due to backend error: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("FindOptimalRoute: Error searching for composite candidates.")
+		apierror.Fail(c, apierror.Internal("Failed to find any route due to backend error", err))
 		return
 	}
 
 	if len(compositeCandidates) > 0 {
-		logrus.Infof("FindOptimalRoute: Found %d composite route candidates. Responding.", len(compositeCandidates))
-		c.JSON(http.StatusOK, gin.H{"data": []CommuterRouteResponse{
-			{
-				ID:          0, // No single ID for composite
-				Name:        "Composite Route",
-				Description: "Generated from multiple segments matching optimal path",
-				Geometry:    json.RawMessage(req.OptimalGeometryGeoJSON), // Use ORS geometry as the overall composite path
-				Stages:      compositeCandidates,
-				IsComposite: true,
-			},
-		}})
-		return
-	}
-
-	logrus.Info("FindOptimalRoute: No direct or significant composite routes found.")
-	c.JSON(http.StatusNotFound, gin.H{"error": "No existing routes found that closely match the requested path."})
+		logrus.WithContext(c).Infof("FindOptimalRoute: Found %d composite route candidates. Responding.", len(compositeCandidates))
+		composite := CommuterRouteResponse{
+			ID:          0, // No single ID for composite
+			Name:        "Composite Route",
+			Description: "Generated from multiple segments matching optimal path",
+			Geometry:    json.RawMessage(req.OptimalGeometryGeoJSON), // Use ORS geometry as the overall composite path
+			Stages:      compositeCandidates,
+			IsComposite: true,
+		}
+		ids := make([]uint, 0, len(compositeCandidates))
+		for _, cand := range compositeCandidates {
+			ids = append(ids, cand.RouteID)
+		}
+		if req.LastMile || req.DoorToDoor {
+			composite.Legs, composite.FirstMileUnavailable, composite.LastMileUnavailable = journeyLegs(prefs, ids, start, dest, false, req.DoorToDoor)
+		}
+		if accessibility != "" {
+			composite.Accessibility = buildAccessibilityReport(ids, accessibility)
+		}
+		composite.Alerts = uniqueServiceAlerts(ids)
+		ratings := routeRatings(ids)
+		for i := range composite.Stages {
+			composite.Stages[i].Rating = ratings[composite.Stages[i].RouteID]
+		}
+		c.JSON(http.StatusOK, gin.H{"data": []CommuterRouteResponse{composite}})
+		return
+	}
+
+	logrus.WithContext(c).Info("FindOptimalRoute: No direct or significant composite routes found.")
+	apierror.Respond(c, http.StatusNotFound, "No existing routes found that closely match the requested path.")
 }
 
 // CreateRoute allows a sacco to create a new route with GeoJSON LineString and stages.
 func CreateRoute(c *gin.Context) {
-	logrus.Info("CreateRoute: Handling new route creation request.")
+	logrus.WithContext(c).Info("CreateRoute: Handling new route creation request.")
 	var input struct {
 		Name        string `json:"name" binding:"required"`
 		Description string `json:"description"`
 		Geometry    string `json:"geometry"` // Input is still a GeoJSON string
 		Stages      []struct {
-			Name string  `json:"name"`
-			Seq  int     `json:"seq"`
-			Lat  float64 `json:"lat"`
-			Lng  float64 `json:"lng"`
+			Name   string  `json:"name"`
+			Seq    int     `json:"seq"`
+			Lat    float64 `json:"lat"`
+			Lng    float64 `json:"lng"`
+			StopID uint    `json:"stop_id"` // Optional: reuse an existing shared stop
 		} `json:"stages"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		logrus.WithError(err).Warn("CreateRoute: Invalid input payload.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Warn("CreateRoute: Invalid input payload.")
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
-	logrus.Debugf("CreateRoute: Input received for route '%s'.", input.Name)
+	logrus.WithContext(c).Debugf("CreateRoute: Input received for route '%s'.", input.Name)
 
-	authenticatedUserID := uint(c.MustGet("user_id").(float64))
-	var saccoUser models.User
-	if err := config.DB.Preload("Sacco").First(&saccoUser, authenticatedUserID).Error; err != nil {
-		logrus.WithError(err).WithField("user_id", authenticatedUserID).Error("CreateRoute: User not found or unauthorized.")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
+	tenant, ok := saccoTenant(c, "CreateRoute")
+	if !ok {
 		return
 	}
-	if saccoUser.Role != "sacco" || saccoUser.Sacco == nil {
-		logrus.WithField("user_id", authenticatedUserID).Warn("CreateRoute: User is not a sacco owner or has no associated sacco.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only sacco owners can create routes"})
-		return
-	}
-	saccoID := saccoUser.Sacco.ID
-	logrus.Debugf("CreateRoute: Authenticated sacco user '%s' (ID: %d) found.", saccoID)
+	saccoID := tenant.SaccoID()
+	logrus.WithContext(c).Debugf("CreateRoute: Authenticated sacco user (Sacco ID: %d) found.", saccoID)
 
 	tx := config.DB.Begin()
 	if tx.Error != nil {
-		logrus.WithError(tx.Error).Error("CreateRoute: Failed to start database transaction.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		logrus.WithContext(c).WithError(tx.Error).Error("CreateRoute: Failed to start database transaction.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to start transaction")
 		return
 	}
-	logrus.Debug("CreateRoute: Database transaction started.")
+	logrus.WithContext(c).Debug("CreateRoute: Database transaction started.")
 
 	wkbGeom, err := parseAndConvertGeometry(input.Geometry)
 	if err != nil {
 		tx.Rollback()
-		logrus.WithError(err).Error("CreateRoute: Invalid geometry provided.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid geometry: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("CreateRoute: Invalid geometry provided.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid geometry: "+err.Error())
+		return
+	}
+	logrus.WithContext(c).Debug("CreateRoute: Geometry parsed and converted to WKB.")
+
+	stages := make([]models.Stage, 0, len(input.Stages))
+	for _, s := range input.Stages {
+		stages = append(stages, models.Stage{Name: s.Name, Seq: s.Seq, Lat: s.Lat, Lng: s.Lng, StopID: s.StopID})
+	}
+	if err := stops.Fill(tx, stages); err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).Warn("CreateRoute: Unknown stop referenced by stage.")
+		apierror.Respond(c, http.StatusBadRequest, "Unknown stop_id in stages")
+		return
+	}
+	violations, err := checkStagesOnRoute(wkbGeom, stages, snapRequested(c))
+	if err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).Error("CreateRoute: Failed to decode geometry for stage validation.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid geometry: "+err.Error())
+		return
+	}
+	if len(violations) > 0 {
+		tx.Rollback()
+		logrus.WithContext(c).WithField("violations", len(violations)).Warn("CreateRoute: Stages too far from route geometry.")
+		respondStageViolations(c, violations)
+		return
+	}
+	if !allowDuplicateRequested(c) {
+		duplicates, err := findDuplicateRoutes(wkbGeom, saccoID, duplicateScope(c))
+		if err != nil {
+			tx.Rollback()
+			logrus.WithContext(c).WithError(err).Error("CreateRoute: Failed to check for duplicate routes.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to check for duplicate routes")
+			return
+		}
+		if len(duplicates) > 0 {
+			tx.Rollback()
+			logrus.WithContext(c).WithFields(logrus.Fields{"sacco_id": saccoID, "duplicates": len(duplicates)}).Warn("CreateRoute: Route looks like a duplicate.")
+			respondDuplicateRoutes(c, duplicates)
+			return
+		}
+	}
+	if err := stops.Link(tx, stages); err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).Error("CreateRoute: Failed to link stages to shared stops.")
+		apierror.Fail(c, apierror.Internal("Failed to link stops", err))
 		return
 	}
-	logrus.Debug("CreateRoute: Geometry parsed and converted to WKB.")
 
-	route := models.Route{Name: input.Name, Description: input.Description, SaccoID: saccoID, Geometry: wkbGeom}
+	route := models.Route{Name: input.Name, Description: input.Description, SaccoID: saccoID, Geometry: wkbGeom, Status: models.RouteStatusDraft}
 	if err := tx.Create(&route).Error; err != nil {
 		tx.Rollback()
-		logrus.WithError(err).Error("CreateRoute: Failed to create route record.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create route failed: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("CreateRoute: Failed to create route record.")
+		apierror.Fail(c, apierror.Internal("Create route failed", err))
 		return
 	}
-	logrus.Debugf("CreateRoute: Route '%s' (ID: %d) created.", route.Name, route.ID)
+	logrus.WithContext(c).Debugf("CreateRoute: Route '%s' (ID: %d) created.", route.Name, route.ID)
 
 
-	for _, s := range input.Stages {
-		stage := models.Stage{Name: s.Name, Seq: s.Seq, Lat: s.Lat, Lng: s.Lng, RouteID: route.ID}
+	for _, stage := range stages {
+		stage.RouteID = route.ID
 		if err := tx.Create(&stage).Error; err != nil {
 			tx.Rollback()
-			logrus.WithError(err).WithField("stage_name", s.Name).Error("CreateRoute: Failed to create stage record.")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Create stage failed: " + err.Error()})
+			logrus.WithContext(c).WithError(err).WithField("stage_name", stage.Name).Error("CreateRoute: Failed to create stage record.")
+			apierror.Fail(c, apierror.Internal("Create stage failed", err))
 			return
 		}
-		logrus.Debugf("CreateRoute: Stage '%s' for route %d created.", stage.Name, route.ID)
+		logrus.WithContext(c).Debugf("CreateRoute: Stage '%s' for route %d created.", stage.Name, route.ID)
 	}
 
 	if err := tx.Commit().Error; err != nil {
-		logrus.WithError(err).Error("CreateRoute: Database transaction commit failed.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("CreateRoute: Database transaction commit failed.")
+		apierror.Fail(c, apierror.Internal("Transaction commit failed", err))
 		return
 	}
-	logrus.Info("CreateRoute: Route and stages created successfully.")
+	logrus.WithContext(c).Info("CreateRoute: Route and stages created successfully.")
 
 	config.DB.Preload("Stages").Preload("Vehicles").First(&route, route.ID)
 	c.JSON(http.StatusCreated, gin.H{"data": toRouteResponse(route)})
@@ -380,70 +543,86 @@ func CreateRoute(c *gin.Context) {
 
 // AddStagesToRoute allows adding or replacing stages for an existing route.
 func AddStagesToRoute(c *gin.Context) {
-	logrus.Info("AddStagesToRoute: Handling add/replace stages request.")
-	authID := uint(c.MustGet("user_id").(float64))
+	logrus.WithContext(c).Info("AddStagesToRoute: Handling add/replace stages request.")
 	rID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		logrus.WithError(err).Warn("AddStagesToRoute: Invalid route ID in parameter.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		logrus.WithContext(c).WithError(err).Warn("AddStagesToRoute: Invalid route ID in parameter.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid route ID")
+		return
+	}
+	logrus.WithContext(c).WithField("route_id", rID).Debug("AddStagesToRoute: Processing request for route.")
+
+	tenant, ok := saccoTenant(c, "AddStagesToRoute")
+	if !ok {
 		return
 	}
-	logrus.WithField("route_id", rID).Debug("AddStagesToRoute: Processing request for route.")
 
 	var route models.Route
-	if err := config.DB.Where("id=?", rID).First(&route).Error; err != nil {
+	if err := tenant.Scoped(config.DB).First(&route, rID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logrus.WithField("route_id", rID).Warn("AddStagesToRoute: Route not found.")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			logrus.WithContext(c).WithField("route_id", rID).Warn("AddStagesToRoute: Route not found.")
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
 		} else {
-			logrus.WithError(err).WithField("route_id", rID).Error("AddStagesToRoute: Database error fetching route.")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			logrus.WithContext(c).WithError(err).WithField("route_id", rID).Error("AddStagesToRoute: Database error fetching route.")
+			apierror.Fail(c, apierror.Internal("Failed to load route", err))
 		}
 		return
 	}
-	logrus.Debugf("AddStagesToRoute: Route '%s' (ID: %d) found.", route.Name, route.ID)
+	logrus.WithContext(c).Debugf("AddStagesToRoute: Route '%s' (ID: %d) found.", route.Name, route.ID)
 
-	var saccoUser models.User
-	if err := config.DB.Preload("Sacco").First(&saccoUser, authID).Error; err != nil {
-		logrus.WithError(err).WithField("user_id", authID).Error("AddStagesToRoute: User not found or unauthorized.")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
-		return
-	}
-	if saccoUser.Role != "sacco" || saccoUser.Sacco == nil || saccoUser.Sacco.ID != route.SaccoID {
-		logrus.WithFields(logrus.Fields{
-			"user_id": authID,
-			"route_sacco_id": route.SaccoID,
-			"user_sacco_id": saccoUser.Sacco.ID,
-		}).Warn("AddStagesToRoute: User not authorized to modify this route.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only sacco owner can modify this route"})
-		return
-	}
-	logrus.Debug("AddStagesToRoute: User authorized to modify route.")
+	logrus.WithContext(c).Debug("AddStagesToRoute: User authorized to modify route.")
 
 	var input struct{ Stages []models.Stage `json:"stages" binding:"required"` }
 	if err := c.ShouldBindJSON(&input); err != nil {
-		logrus.WithError(err).Warn("AddStagesToRoute: Invalid input payload for stages.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logrus.WithContext(c).WithError(err).Warn("AddStagesToRoute: Invalid input payload for stages.")
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
-	logrus.Debugf("AddStagesToRoute: Received %d stages in input.", len(input.Stages))
+	logrus.WithContext(c).Debugf("AddStagesToRoute: Received %d stages in input.", len(input.Stages))
+
 
 
 	tx := config.DB.Begin()
 	if tx.Error != nil {
-		logrus.WithError(tx.Error).Error("AddStagesToRoute: Failed to start database transaction.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		logrus.WithContext(c).WithError(tx.Error).Error("AddStagesToRoute: Failed to start database transaction.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to start transaction")
+		return
+	}
+	logrus.WithContext(c).Debug("AddStagesToRoute: Database transaction started.")
+
+	if err := stops.Fill(tx, input.Stages); err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).Warn("AddStagesToRoute: Unknown stop referenced by stage.")
+		apierror.Respond(c, http.StatusBadRequest, "Unknown stop_id in stages")
+		return
+	}
+	violations, err := checkStagesOnRoute(route.Geometry, input.Stages, snapRequested(c))
+	if err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("AddStagesToRoute: Failed to decode route geometry.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to validate stages")
+		return
+	}
+	if len(violations) > 0 {
+		tx.Rollback()
+		logrus.WithContext(c).WithField("violations", len(violations)).Warn("AddStagesToRoute: Stages too far from route geometry.")
+		respondStageViolations(c, violations)
+		return
+	}
+	if err := stops.Link(tx, input.Stages); err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("AddStagesToRoute: Failed to link stages to shared stops.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to link stops")
 		return
 	}
-	logrus.Debug("AddStagesToRoute: Database transaction started.")
 
 	if err := tx.Where("route_id=?", route.ID).Delete(&models.Stage{}).Error; err != nil {
 		tx.Rollback()
-		logrus.WithError(err).WithField("route_id", route.ID).Error("AddStagesToRoute: Failed to delete existing stages.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete existing stages"})
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("AddStagesToRoute: Failed to delete existing stages.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete existing stages")
 		return
 	}
-	logrus.Debugf("AddStagesToRoute: Existing stages for route %d deleted.", route.ID)
+	logrus.WithContext(c).Debugf("AddStagesToRoute: Existing stages for route %d deleted.", route.ID)
 
 
 	for i := range input.Stages {
@@ -451,76 +630,102 @@ func AddStagesToRoute(c *gin.Context) {
 	}
 	if err := tx.Create(&input.Stages).Error; err != nil {
 		tx.Rollback()
-		logrus.WithError(err).WithField("route_id", route.ID).Error("AddStagesToRoute: Failed to add new stages.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add new stages"})
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("AddStagesToRoute: Failed to add new stages.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to add new stages")
 		return
 	}
-	logrus.Debugf("AddStagesToRoute: New stages for route %d added.", route.ID)
+	logrus.WithContext(c).Debugf("AddStagesToRoute: New stages for route %d added.", route.ID)
 
 	if err := tx.Commit().Error; err != nil {
-		logrus.WithError(err).Error("AddStagesToRoute: Database transaction commit failed.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("AddStagesToRoute: Database transaction commit failed.")
+		apierror.Fail(c, apierror.Internal("Transaction commit failed", err))
 		return
 	}
-	logrus.Info("AddStagesToRoute: Stages added/replaced successfully.")
+	logrus.WithContext(c).Info("AddStagesToRoute: Stages added/replaced successfully.")
+	geofence.Forget(route.ID)
+	eta.Forget(route.ID)
 
 	config.DB.Preload("Stages").Preload("Vehicles").First(&route, route.ID)
 	c.JSON(http.StatusOK, gin.H{"data": toRouteResponse(route)})
 }
 
-// ListRoutes returns all routes + stages + vehicles for the authenticated sacco
+// routeListOptions are the sorts and filters the route listings accept.
+var routeListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"id":         "id",
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "id",
+	Filters: map[string]pagination.Filter{
+		"status": pagination.String("status = ?"),
+	},
+}
+
+// ListRoutes returns the authenticated sacco's routes + stages + vehicles a page at a time.
 // This method is specifically for sacco users to view THEIR routes.
 func ListRoutes(c *gin.Context) {
-	logrus.Info("ListRoutes: Handling list routes request for authenticated sacco.")
-	authID := uint(c.MustGet("user_id").(float64))
-	var user models.User
-	if err := config.DB.Preload("Sacco").First(&user, authID).Error; err != nil {
-		logrus.WithError(err).WithField("user_id", authID).Error("ListRoutes: User not found or failed to preload sacco.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User data error"}) // Or Unauthorized if it means the user isn't authenticated properly
+	logrus.WithContext(c).Info("ListRoutes: Handling list routes request for authenticated sacco.")
+	tenant, ok := saccoTenant(c, "ListRoutes")
+	if !ok {
 		return
 	}
 
-	if user.Role != "sacco" || user.Sacco == nil {
-		logrus.WithField("user_id", authID).Warn("ListRoutes: User is not a sacco or has no associated sacco.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	tolerance, ok := parseToleranceQuery(c)
+	if !ok {
 		return
 	}
 
-	sID := user.Sacco.ID
-	logrus.Debugf("ListRoutes: Fetching routes for Sacco ID: %d", sID)
+	sID := tenant.SaccoID()
+	logrus.WithContext(c).Debugf("ListRoutes: Fetching routes for Sacco ID: %d", sID)
 	var routes []models.Route
-	if err := config.DB.Preload("Stages").Preload("Vehicles").Where("sacco_id=?", sID).Find(&routes).Error; err != nil {
-		logrus.WithError(err).WithField("sacco_id", sID).Error("ListRoutes: Database error fetching routes for sacco.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch routes"})
+	query, ok := includeDeleted(c, "ListRoutes", tenant.Scoped(config.DB.Model(&models.Route{})), sID)
+	if !ok {
 		return
 	}
+	meta, ok := paginate(c, "ListRoutes", query, routeListOptions, &routes, "Stages", "Vehicles", "Tags")
+	if !ok {
+		return
+	}
+	simplifyRouteGeometries(routes, tolerance)
 
 	var routeResponses []RouteResponse
 	for _, r := range routes {
 		routeResponses = append(routeResponses, toRouteResponse(r))
 	}
-	logrus.Infof("ListRoutes: Found %d routes for Sacco ID %d.", len(routeResponses), sID)
-	c.JSON(http.StatusOK, gin.H{"data": routeResponses})
+	attachRouteBranding(routeResponses)
+	logrus.WithContext(c).Infof("ListRoutes: Found %d routes for Sacco ID %d.", len(routeResponses), sID)
+	c.JSON(http.StatusOK, gin.H{"data": routeResponses, "pagination": meta})
 }
 
-// ListAllCommuterRoutes returns all routes + stages + vehicles for the commuter.
+// ListAllCommuterRoutes returns published routes + stages + vehicles for the commuter a page at a time.
 // This method does NOT filter by sacco_id and does NOT check for 'sacco' role.
 // It is intended for public/commuter-facing route data.
 func ListAllCommuterRoutes(c *gin.Context) {
-	logrus.Info("ListAllCommuterRoutes: Handling list all commuter routes request.")
+	logrus.WithContext(c).Info("ListAllCommuterRoutes: Handling list all commuter routes request.")
+	tolerance, ok := parseToleranceQuery(c)
+	if !ok {
+		return
+	}
 	var routes []models.Route
-	if err := config.DB.Preload("Stages").Preload("Vehicles").Find(&routes).Error; err != nil {
-		logrus.WithError(err).Error("ListAllCommuterRoutes: Database error fetching all routes.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch routes"})
+	query := config.Replica().Model(&models.Route{}).Where("status = ?", models.RouteStatusPublished)
+	opts := routeListOptions
+	opts.Filters = map[string]pagination.Filter{"sacco_id": pagination.Uint("sacco_id = ?")}
+	meta, ok := paginate(c, "ListAllCommuterRoutes", withAllTags(query, parseTagsQuery(c)), opts, &routes, "Stages", "Vehicles", "Tags")
+	if !ok {
 		return
 	}
+	simplifyRouteGeometries(routes, tolerance)
 
 	var routeResponses []RouteResponse
 	for _, r := range routes {
 		routeResponses = append(routeResponses, toRouteResponse(r))
 	}
-	logrus.Infof("ListAllCommuterRoutes: Found %d routes for commuters.", len(routeResponses))
-	c.JSON(http.StatusOK, gin.H{"data": routeResponses})
+	attachRouteBranding(routeResponses)
+	attachRouteAlerts(routeResponses)
+	attachRouteRatings(routeResponses)
+	logrus.WithContext(c).Infof("ListAllCommuterRoutes: Found %d routes for commuters.", len(routeResponses))
+	c.JSON(http.StatusOK, gin.H{"data": routeResponses, "pagination": meta})
 }
 
 
@@ -528,116 +733,110 @@ func ListAllCommuterRoutes(c *gin.Context) {
 // This method might be redundant if ListAllCommuterRoutes covers the public need
 // and ListRoutes covers sacco-specific need. Review usage.
 func ListRoutesBySacco(c *gin.Context) {
-	logrus.Info("ListRoutesBySacco: Handling list routes by specific sacco ID request.")
+	logrus.WithContext(c).Info("ListRoutesBySacco: Handling list routes by specific sacco ID request.")
 	sID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		logrus.WithError(err).WithField("sacco_id_param", c.Param("id")).Warn("ListRoutesBySacco: Invalid Sacco ID parameter.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Sacco ID"})
+		logrus.WithContext(c).WithError(err).WithField("sacco_id_param", c.Param("id")).Warn("ListRoutesBySacco: Invalid Sacco ID parameter.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid Sacco ID")
+		return
+	}
+	logrus.WithContext(c).Debugf("ListRoutesBySacco: Fetching routes for Sacco ID: %d.", sID)
+	tolerance, ok := parseToleranceQuery(c)
+	if !ok {
+		return
+	}
+
+	tenant, ok := pathSaccoTenant(c, "ListRoutesBySacco", uint(sID))
+	if !ok {
 		return
 	}
-	logrus.Debugf("ListRoutesBySacco: Fetching routes for Sacco ID: %d.", sID)
 
 	var routes []models.Route
-	if err := config.DB.Preload("Stages").Preload("Vehicles").Where("sacco_id=?", uint(sID)).Find(&routes).Error; err != nil {
-		logrus.WithError(err).WithField("sacco_id", sID).Error("ListRoutesBySacco: Database error fetching routes for specific sacco.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch routes"})
+	query, ok := includeDeleted(c, "ListRoutesBySacco", tenant.Scoped(config.DB.Model(&models.Route{}).Where("sacco_id=?", uint(sID))), uint(sID))
+	if !ok {
 		return
 	}
+	meta, ok := paginate(c, "ListRoutesBySacco", query, routeListOptions, &routes, "Stages", "Vehicles", "Tags")
+	if !ok {
+		return
+	}
+	simplifyRouteGeometries(routes, tolerance)
 
 	var routeResponses []RouteResponse
 	for _, r := range routes {
 		routeResponses = append(routeResponses, toRouteResponse(r))
 	}
-	logrus.Infof("ListRoutesBySacco: Found %d routes for Sacco ID %d.", len(routeResponses), sID)
-	c.JSON(http.StatusOK, gin.H{"data": routeResponses})
+	attachRouteBranding(routeResponses)
+	logrus.WithContext(c).Infof("ListRoutesBySacco: Found %d routes for Sacco ID %d.", len(routeResponses), sID)
+	c.JSON(http.StatusOK, gin.H{"data": routeResponses, "pagination": meta})
 }
 
 // GetRoute returns a single route + stages + vehicles for the sacco owner
 func GetRoute(c *gin.Context) {
-	logrus.Info("GetRoute: Handling get single route request for sacco owner.")
+	logrus.WithContext(c).Info("GetRoute: Handling get single route request for sacco owner.")
 	authID := uint(c.MustGet("user_id").(float64))
 	rID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		logrus.WithError(err).Warn("GetRoute: Invalid route ID in parameter.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		logrus.WithContext(c).WithError(err).Warn("GetRoute: Invalid route ID in parameter.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid route ID")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"user_id": authID, "route_id": rID}).Debug("GetRoute: Processing request.")
+
+	tenant, ok := saccoTenant(c, "GetRoute")
+	if !ok {
 		return
 	}
-	logrus.WithFields(logrus.Fields{"user_id": authID, "route_id": rID}).Debug("GetRoute: Processing request.")
 
 	var route models.Route
-	if err := config.DB.Preload("Stages").Preload("Vehicles").Where("id=?", rID).First(&route).Error; err != nil {
+	if err := tenant.Scoped(config.DB).Preload("Stages").Preload("Vehicles").Preload("Tags").First(&route, rID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logrus.WithField("route_id", rID).Warn("GetRoute: Route not found in database.")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			logrus.WithContext(c).WithField("route_id", rID).Warn("GetRoute: Route not found in database.")
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
 		} else {
-			logrus.WithError(err).WithField("route_id", rID).Error("GetRoute: Database error fetching route.")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			logrus.WithContext(c).WithError(err).WithField("route_id", rID).Error("GetRoute: Database error fetching route.")
+			apierror.Fail(c, apierror.Internal("Failed to load route", err))
 		}
 		return
 	}
-	logrus.Debugf("GetRoute: Route '%s' (ID: %d) found.", route.Name, route.ID)
+	logrus.WithContext(c).Debugf("GetRoute: Route '%s' (ID: %d) found.", route.Name, route.ID)
 
 
-	var saccoUser models.User
-	if err := config.DB.Preload("Sacco").First(&saccoUser, authID).Error; err != nil {
-		logrus.WithError(err).WithField("user_id", authID).Error("GetRoute: User not found or unauthorized.")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
-		return
-	}
-	if saccoUser.Role != "sacco" || saccoUser.Sacco == nil || saccoUser.Sacco.ID != route.SaccoID {
-		logrus.WithFields(logrus.Fields{
-			"user_id": authID,
-			"route_sacco_id": route.SaccoID,
-			"user_sacco_id": saccoUser.Sacco.ID,
-		}).Warn("GetRoute: User not authorized to view this route.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: Route does not belong to this sacco"})
-		return
-	}
-	logrus.Info("GetRoute: Route successfully retrieved and authorized.")
+	logrus.WithContext(c).Info("GetRoute: Route successfully retrieved and authorized.")
 	c.JSON(http.StatusOK, gin.H{"data": toRouteResponse(route)})
 }
 
 // UpdateRoute handles updating an existing route.
 func UpdateRoute(c *gin.Context) {
-	logrus.Info("UpdateRoute: Handling route update request.")
+	logrus.WithContext(c).Info("UpdateRoute: Handling route update request.")
 	authID := uint(c.MustGet("user_id").(float64))
 	rID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		logrus.WithError(err).Warn("UpdateRoute: Invalid route ID in parameter.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		logrus.WithContext(c).WithError(err).Warn("UpdateRoute: Invalid route ID in parameter.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid route ID")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"user_id": authID, "route_id": rID}).Debug("UpdateRoute: Processing request.")
+
+	tenant, ok := saccoTenant(c, "UpdateRoute")
+	if !ok {
 		return
 	}
-	logrus.WithFields(logrus.Fields{"user_id": authID, "route_id": rID}).Debug("UpdateRoute: Processing request.")
 
 	var existingRoute models.Route
-	if err := config.DB.First(&existingRoute, rID).Error; err != nil {
+	if err := tenant.Scoped(config.DB).First(&existingRoute, rID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logrus.WithField("route_id", rID).Warn("UpdateRoute: Route not found in database.")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			logrus.WithContext(c).WithField("route_id", rID).Warn("UpdateRoute: Route not found in database.")
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
 		} else {
-			logrus.WithError(err).WithField("route_id", rID).Error("UpdateRoute: Database error fetching route for update.")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			logrus.WithContext(c).WithError(err).WithField("route_id", rID).Error("UpdateRoute: Database error fetching route for update.")
+			apierror.Fail(c, apierror.Internal("Failed to load route", err))
 		}
 		return
 	}
-	logrus.Debugf("UpdateRoute: Existing route '%s' (ID: %d) found.", existingRoute.Name, existingRoute.ID)
+	logrus.WithContext(c).Debugf("UpdateRoute: Existing route '%s' (ID: %d) found.", existingRoute.Name, existingRoute.ID)
 
-	var saccoUser models.User
-	if err := config.DB.Preload("Sacco").First(&saccoUser, authID).Error; err != nil {
-		logrus.WithError(err).WithField("user_id", authID).Warn("UpdateRoute: User not found or unauthorized.")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
-		return
-	}
-	if saccoUser.Role != "sacco" || saccoUser.Sacco == nil || saccoUser.Sacco.ID != existingRoute.SaccoID {
-		logrus.WithFields(logrus.Fields{
-			"user_id": authID,
-			"route_sacco_id": existingRoute.SaccoID,
-			"user_sacco_id": saccoUser.Sacco.ID,
-		}).Warn("UpdateRoute: User not authorized to update this route.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only sacco owner can update this route"})
-		return
-	}
-	logrus.Debug("UpdateRoute: User authorized to update route.")
+	logrus.WithContext(c).Debug("UpdateRoute: User authorized to update route.")
 
 	var input struct {
 		Name        *string `json:"name"`
@@ -645,121 +844,149 @@ func UpdateRoute(c *gin.Context) {
 		Geometry    *string `json:"geometry"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
-		logrus.WithError(err).Warn("UpdateRoute: Invalid input payload for update.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		logrus.WithContext(c).WithError(err).Warn("UpdateRoute: Invalid input payload for update.")
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
-	logrus.Debug("UpdateRoute: Input payload for update parsed.")
+	logrus.WithContext(c).Debug("UpdateRoute: Input payload for update parsed.")
 
 	if input.Name != nil {
 		existingRoute.Name = *input.Name
-		logrus.Debugf("UpdateRoute: Updating name to '%s'.", *input.Name)
+		logrus.WithContext(c).Debugf("UpdateRoute: Updating name to '%s'.", *input.Name)
 	}
 	if input.Description != nil {
 		existingRoute.Description = *input.Description
-		logrus.Debugf("UpdateRoute: Updating description to '%s'.", *input.Description)
+		logrus.WithContext(c).Debugf("UpdateRoute: Updating description to '%s'.", *input.Description)
 	}
 	if input.Geometry != nil {
 		if *input.Geometry == "" {
 			existingRoute.Geometry = nil
-			logrus.Debug("UpdateRoute: Setting geometry to nil (empty string input).")
+			logrus.WithContext(c).Debug("UpdateRoute: Setting geometry to nil (empty string input).")
 		} else {
 			wkbGeom, err := parseAndConvertGeometry(*input.Geometry)
 			if err != nil {
-				logrus.WithError(err).Error("UpdateRoute: Invalid geometry provided for update.")
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid geometry: " + err.Error()})
+				logrus.WithContext(c).WithError(err).Error("UpdateRoute: Invalid geometry provided for update.")
+				apierror.Respond(c, http.StatusBadRequest, "Invalid geometry: "+err.Error())
 				return
 			}
 			existingRoute.Geometry = wkbGeom
-			logrus.Debug("UpdateRoute: Geometry updated and converted to WKB.")
+			logrus.WithContext(c).Debug("UpdateRoute: Geometry updated and converted to WKB.")
+		}
+	}
+
+	// A new geometry must still pass through the route's existing stages.
+	var stages []models.Stage
+	if input.Geometry != nil {
+		if err := config.DB.Where("route_id = ?", existingRoute.ID).Order("seq").Find(&stages).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("route_id", existingRoute.ID).Error("UpdateRoute: Failed to load stages.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load stages")
+			return
+		}
+		violations, err := checkStagesOnRoute(existingRoute.Geometry, stages, snapRequested(c))
+		if err != nil {
+			logrus.WithContext(c).WithError(err).Error("UpdateRoute: Failed to decode geometry for stage validation.")
+			apierror.Respond(c, http.StatusBadRequest, "Invalid geometry: "+err.Error())
+			return
+		}
+		if len(violations) > 0 {
+			logrus.WithContext(c).WithField("violations", len(violations)).Warn("UpdateRoute: Existing stages too far from new geometry.")
+			respondStageViolations(c, violations)
+			return
 		}
 	}
 
-	if err := config.DB.Save(&existingRoute).Error; err != nil {
-		logrus.WithError(err).Error("UpdateRoute: Failed to save updated route to database.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Update failed: " + err.Error()})
+	tx := config.DB.Begin()
+	if err := tx.Save(&existingRoute).Error; err != nil {
+		tx.Rollback()
+		logrus.WithContext(c).WithError(err).Error("UpdateRoute: Failed to save updated route to database.")
+		apierror.Fail(c, apierror.Internal("Update failed", err))
 		return
 	}
-	logrus.Info("UpdateRoute: Route updated successfully.")
+	for _, stage := range stages {
+		if err := tx.Model(&stage).Updates(map[string]interface{}{"lat": stage.Lat, "lng": stage.Lng}).Error; err != nil {
+			tx.Rollback()
+			logrus.WithContext(c).WithError(err).WithField("stage_id", stage.ID).Error("UpdateRoute: Failed to save snapped stage.")
+			apierror.Fail(c, apierror.Internal("Update failed", err))
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("UpdateRoute: Database transaction commit failed.")
+		apierror.Fail(c, apierror.Internal("Transaction commit failed", err))
+		return
+	}
+	logrus.WithContext(c).Info("UpdateRoute: Route updated successfully.")
+	geofence.Forget(existingRoute.ID)
+	eta.Forget(existingRoute.ID)
 
-	config.DB.Preload("Stages").Preload("Vehicles").First(&existingRoute, existingRoute.ID)
+	config.DB.Preload("Stages").Preload("Vehicles").Preload("Tags").First(&existingRoute, existingRoute.ID)
 	c.JSON(http.StatusOK, gin.H{"data": toRouteResponse(existingRoute)})
 }
 
 // DeleteRoute removes a route and its stages.
 func DeleteRoute(c *gin.Context) {
-	logrus.Info("DeleteRoute: Handling route deletion request.")
+	logrus.WithContext(c).Info("DeleteRoute: Handling route deletion request.")
 	authID := uint(c.MustGet("user_id").(float64))
 	rID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		logrus.WithError(err).Warn("DeleteRoute: Invalid route ID in parameter.")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		logrus.WithContext(c).WithError(err).Warn("DeleteRoute: Invalid route ID in parameter.")
+		apierror.Respond(c, http.StatusBadRequest, "Invalid route ID")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"user_id": authID, "route_id": rID}).Debug("DeleteRoute: Processing request.")
+
+	tenant, ok := saccoTenant(c, "DeleteRoute")
+	if !ok {
 		return
 	}
-	logrus.WithFields(logrus.Fields{"user_id": authID, "route_id": rID}).Debug("DeleteRoute: Processing request.")
 
 	var route models.Route
-	if err := config.DB.First(&route, rID).Error; err != nil {
+	if err := tenant.Scoped(config.DB).First(&route, rID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logrus.WithField("route_id", rID).Warn("DeleteRoute: Route not found in database.")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+			logrus.WithContext(c).WithField("route_id", rID).Warn("DeleteRoute: Route not found in database.")
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
 		} else {
-			logrus.WithError(err).WithField("route_id", rID).Error("DeleteRoute: Database error fetching route for deletion.")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			logrus.WithContext(c).WithError(err).WithField("route_id", rID).Error("DeleteRoute: Database error fetching route for deletion.")
+			apierror.Fail(c, apierror.Internal("Failed to load route", err))
 		}
 		return
 	}
-	logrus.Debugf("DeleteRoute: Route '%s' (ID: %d) found.", route.Name, route.ID)
+	logrus.WithContext(c).Debugf("DeleteRoute: Route '%s' (ID: %d) found.", route.Name, route.ID)
 
 
-	var saccoUser models.User
-	if err := config.DB.Preload("Sacco").First(&saccoUser, authID).Error; err != nil {
-		logrus.WithError(err).WithField("user_id", authID).Error("DeleteRoute: User not found or unauthorized.")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
-		return
-	}
-	if saccoUser.Role != "sacco" || saccoUser.Sacco.ID != route.SaccoID {
-		logrus.WithFields(logrus.Fields{
-			"user_id": authID,
-			"route_sacco_id": route.SaccoID,
-			"user_sacco_id": saccoUser.Sacco.ID,
-		}).Warn("DeleteRoute: User not authorized to delete this route.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only sacco owner can delete this route"})
-		return
-	}
-	logrus.Debug("DeleteRoute: User authorized to delete route.")
+	logrus.WithContext(c).Debug("DeleteRoute: User authorized to delete route.")
 
 	tx := config.DB.Begin()
 	if tx.Error != nil {
-		logrus.WithError(tx.Error).Error("DeleteRoute: Failed to start database transaction for deletion.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		logrus.WithContext(c).WithError(tx.Error).Error("DeleteRoute: Failed to start database transaction for deletion.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to start transaction")
 		return
 	}
-	logrus.Debug("DeleteRoute: Database transaction started.")
+	logrus.WithContext(c).Debug("DeleteRoute: Database transaction started.")
 
 	if err := tx.Where("route_id = ?", route.ID).Delete(&models.Stage{}).Error; err != nil {
 		tx.Rollback()
-		logrus.WithError(err).WithField("route_id", route.ID).Error("DeleteRoute: Failed to delete associated stages.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete stages: " + err.Error()})
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("DeleteRoute: Failed to delete associated stages.")
+		apierror.Fail(c, apierror.Internal("Failed to delete stages", err))
 		return
 	}
-	logrus.Debugf("DeleteRoute: Associated stages for route %d deleted.", route.ID)
+	logrus.WithContext(c).Debugf("DeleteRoute: Associated stages for route %d deleted.", route.ID)
 
 
-	if err := tx.Where("id = ? AND sacco_id = ?", route.ID, saccoUser.Sacco.ID).Delete(&models.Route{}).Error; err != nil {
+	if err := tx.Scopes(tenant.SaccoScope).Where("id = ?", route.ID).Delete(&models.Route{}).Error; err != nil {
 		tx.Rollback()
-		logrus.WithError(err).WithField("route_id", route.ID).Error("DeleteRoute: Failed to delete route record.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete route: " + err.Error()})
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("DeleteRoute: Failed to delete route record.")
+		apierror.Fail(c, apierror.Internal("Failed to delete route", err))
 		return
 	}
-	logrus.Debugf("DeleteRoute: Route %d record deleted.", route.ID)
+	logrus.WithContext(c).Debugf("DeleteRoute: Route %d record deleted.", route.ID)
 
 	if err := tx.Commit().Error; err != nil {
-		logrus.WithError(err).Error("DeleteRoute: Database transaction commit failed.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction commit failed: " + err.Error()})
+		logrus.WithContext(c).WithError(err).Error("DeleteRoute: Database transaction commit failed.")
+		apierror.Fail(c, apierror.Internal("Transaction commit failed", err))
 		return
 	}
-	logrus.Info("DeleteRoute: Route and its stages deleted successfully.")
+	logrus.WithContext(c).Info("DeleteRoute: Route and its stages deleted successfully.")
 
 	c.JSON(http.StatusOK, gin.H{"message": "Route deleted successfully"})
 }
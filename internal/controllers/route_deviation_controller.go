@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/wsproto"
+)
+
+// trackDeviation feeds a saved, route-matched fix into off-route detection
+// and alerts the sacco when a deviation starts or ends.
+func trackDeviation(fix models.LocationHistory, saccoID, routeID uint) {
+	alerts, err := driving.TrackDeviation(config.DB, fix, saccoID, routeID)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"vehicle_id": fix.VehicleID, "route_id": routeID}).Error("trackDeviation: Failed to record route deviation.")
+	}
+	for _, a := range alerts {
+		PublishDeviationAlert(a)
+	}
+}
+
+// PublishDeviationAlert broadcasts an off-route alert to the sacco's
+// monitoring clients.
+func PublishDeviationAlert(a driving.DeviationAlert) {
+	d := a.Deviation
+	at := d.LastSeenAt
+	if d.EndedAt != nil {
+		at = *d.EndedAt
+	}
+	msg := map[string]interface{}{
+		"type":         wsproto.AlertOffRoute,
+		"state":        a.State,
+		"sacco_id":     float64(d.SaccoID),
+		"deviation_id": d.ID,
+		"route_id":     d.RouteID,
+		"distance_m":   d.MaxDistanceM,
+		"latitude":     d.Latitude,
+		"longitude":    d.Longitude,
+		"timestamp":    at.Format(time.RFC3339Nano),
+		"started_at":   d.StartedAt.Format(time.RFC3339Nano),
+	}
+	if d.DriverID != 0 {
+		msg["driver_id"] = d.DriverID
+	}
+	if d.VehicleID != 0 {
+		msg["vehicle_id"] = d.VehicleID
+	}
+	locationHub.PublishLocation(msg)
+}
+
+// routeDeviationListOptions are the sorts and filters the deviation listing
+// accepts.
+var routeDeviationListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"started_at":   "started_at",
+		"max_distance": "max_distance_m",
+	},
+	DefaultSort: "-started_at",
+	Filters: map[string]pagination.Filter{
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"vehicle_id": pagination.Uint("vehicle_id = ?"),
+		"route_id":   pagination.Uint("route_id = ?"),
+		"trip_id":    pagination.Uint("trip_id = ?"),
+		"open":       pagination.Bool("(ended_at IS NULL) = ?"),
+	},
+}
+
+// ListRouteDeviations returns the sacco's off-route episodes that started
+// between ?from= and ?to= (default the last 7 days).
+func ListRouteDeviations(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListRouteDeviations")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	query := config.DB.Model(&models.RouteDeviation{}).Scopes(tenant.SaccoScope).Where("started_at >= ? AND started_at < ?", from, to)
+	var list []models.RouteDeviation
+	meta, ok := paginate(c, "ListRouteDeviations", query, routeDeviationListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta, "from": from, "to": to})
+}
+
+// deviationSummary is one vehicle's off-route episodes over a period.
+type deviationSummary struct {
+	VehicleID    uint    `json:"vehicle_id"`
+	VehicleNo    string  `json:"vehicle_no"`
+	Deviations   int64   `json:"deviations"`
+	OffRouteSecs float64 `json:"off_route_seconds"`
+	MaxDistanceM float64 `json:"max_distance_m"`
+}
+
+// SummarizeRouteDeviations reports, per vehicle, how often and how long the
+// sacco's vehicles were off route between ?from= and ?to= (default the last
+// 7 days), most time off route first. Open episodes count up to their latest
+// fix.
+func SummarizeRouteDeviations(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "SummarizeRouteDeviations")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	var rows []deviationSummary
+	err := config.DB.Table("route_deviations AS d").
+		Select(`d.vehicle_id, v.vehicle_no, COUNT(*) AS deviations,
+			SUM(EXTRACT(EPOCH FROM COALESCE(d.ended_at, d.last_seen_at) - d.started_at)) AS off_route_secs,
+			MAX(d.max_distance_m) AS max_distance_m`).
+		Joins("LEFT JOIN vehicles v ON v.id = d.vehicle_id").
+		Scopes(tenant.SaccoScopeOn("d.sacco_id")).Where("d.started_at >= ? AND d.started_at < ? AND d.deleted_at IS NULL", from, to).
+		Group("d.vehicle_id, v.vehicle_no").
+		Order("off_route_secs DESC").
+		Scan(&rows).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("SummarizeRouteDeviations: Failed to summarize deviations.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to summarize route deviations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows, "from": from, "to": to})
+}
+
+// GetRouteDeviation returns one of the sacco's off-route episodes.
+func GetRouteDeviation(c *gin.Context) {
+	d, ok := loadOwned[models.RouteDeviation](c, "GetRouteDeviation", "Route deviation", config.DB)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": d})
+}
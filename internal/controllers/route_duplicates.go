@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// Duplicate-route guard settings. A new route is a duplicate of an existing one
+// when at least duplicateRouteOverlap of each line lies within
+// duplicateRouteToleranceMeters of the other. DUPLICATE_ROUTE_SCOPE is "sacco"
+// (only the caller's routes), "all" (every sacco's routes) or "off".
+var (
+	duplicateRouteScope           = config.EnvString("DUPLICATE_ROUTE_SCOPE", "sacco")
+	duplicateRouteToleranceMeters = config.EnvFloat("DUPLICATE_ROUTE_TOLERANCE_METERS", 50)
+	duplicateRouteOverlap         = config.EnvFloat("DUPLICATE_ROUTE_OVERLAP", 0.9)
+)
+
+// duplicateRoute describes an existing route that closely matches a new one.
+type duplicateRoute struct {
+	ID         uint    `json:"id"`
+	Name       string  `json:"name"`
+	SaccoID    uint    `json:"sacco_id"`
+	OwnRoute   bool    `json:"own_route"`
+	Similarity float64 `json:"similarity"` // Smaller of the two coverage ratios, 0-1
+}
+
+// findDuplicateRoutes compares the geometry against existing routes in scope
+// and returns those similar enough to count as duplicates, most similar first.
+func findDuplicateRoutes(geometry []byte, saccoID uint, scope string) ([]duplicateRoute, error) {
+	if scope == "off" || len(geometry) == 0 {
+		return nil, nil
+	}
+	line, err := geo.LineFromWKB(geometry)
+	if err != nil || len(line) < 2 {
+		return nil, err
+	}
+
+	// Degrees of padding for the bounding-box prefilter; generous near the equator.
+	pad := duplicateRouteToleranceMeters / 111000 * 2
+	query := config.DB.Model(&models.Route{}).
+		Select("id, name, sacco_id, geometry").
+		Where("geometry IS NOT NULL AND octet_length(geometry) > 0 AND status <> ?", models.RouteStatusArchived).
+		Where("ST_Intersects(ST_SetSRID(geometry::geometry, 4326), ST_Expand(ST_GeomFromWKB(?, 4326), ?))", geometry, pad)
+	if scope != "all" {
+		query = query.Where("sacco_id = ?", saccoID)
+	}
+	var candidates []models.Route
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	interval := duplicateRouteToleranceMeters / 2
+	var out []duplicateRoute
+	for _, r := range candidates {
+		other, err := geo.LineFromWKB(r.Geometry)
+		if err != nil || len(other) < 2 {
+			continue
+		}
+		similarity := math.Min(
+			geo.Coverage(line, other, duplicateRouteToleranceMeters, interval),
+			geo.Coverage(other, line, duplicateRouteToleranceMeters, interval),
+		)
+		if similarity < duplicateRouteOverlap {
+			continue
+		}
+		out = append(out, duplicateRoute{
+			ID:         r.ID,
+			Name:       r.Name,
+			SaccoID:    r.SaccoID,
+			OwnRoute:   r.SaccoID == saccoID,
+			Similarity: math.Round(similarity*1000) / 1000,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Similarity > out[j].Similarity })
+	return out, nil
+}
+
+// duplicateScope returns the configured scope, widened to every sacco when the
+// client passes ?check_all_saccos=true.
+func duplicateScope(c *gin.Context) string {
+	if duplicateRouteScope != "off" && c.Query("check_all_saccos") == "true" {
+		return "all"
+	}
+	return duplicateRouteScope
+}
+
+// allowDuplicateRequested reports whether the client chose to create the route anyway.
+func allowDuplicateRequested(c *gin.Context) bool {
+	return c.Query("allow_duplicate") == "true" || c.Query("allow_duplicate") == "1"
+}
+
+// respondDuplicateRoutes writes the 409 returned when a route looks like a duplicate.
+func respondDuplicateRoutes(c *gin.Context, duplicates []duplicateRoute) {
+	apierror.Fail(c, apierror.New(http.StatusConflict,
+		"A very similar route already exists. Retry with ?allow_duplicate=true to create it anyway.").
+		WithCode("duplicate_route").
+		WithDetail("duplicates", duplicates))
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/elevation"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+const (
+	defaultElevationInterval = 100.0
+	minElevationInterval     = 25.0
+	maxElevationSamples      = 2000
+)
+
+var (
+	elevationProvider     elevation.Provider
+	elevationProviderOnce sync.Once
+)
+
+// GetRouteElevation returns an elevation profile sampled along the route geometry.
+// Profiles are cached per geometry version and sampling interval.
+func GetRouteElevation(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "GetRouteElevation")
+	if !ok {
+		return
+	}
+
+	interval := defaultElevationInterval
+	if raw := c.Query("interval"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < minElevationInterval {
+			apierror.Respond(c, http.StatusBadRequest, "interval must be a number of meters >= 25")
+			return
+		}
+		// Whole meters, so near-identical intervals share a cached profile.
+		interval = math.Round(v)
+	}
+
+	line, err := geo.LineFromWKB(route.Geometry)
+	if err != nil {
+		if errors.Is(err, geo.ErrNoGeometry) {
+			apierror.Respond(c, http.StatusUnprocessableEntity, "Route has no geometry")
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("GetRouteElevation: Failed to decode route geometry.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to decode route geometry")
+		return
+	}
+	// Widen the interval on very long routes to keep provider calls bounded.
+	if length := geo.Length(line); length/interval > maxElevationSamples {
+		interval = math.Ceil(length / maxElevationSamples)
+	}
+
+	geometryHash := elevationGeometryHash(line)
+
+	var profile models.RouteElevationProfile
+	err = config.DB.Where("route_id = ? AND geometry_hash = ? AND sample_interval = ?", route.ID, geometryHash, interval).First(&profile).Error
+	if err == nil {
+		respondElevationProfile(c, profile, true)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("GetRouteElevation: Database error reading cached profile.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load elevation profile")
+		return
+	}
+
+	samples := geo.Resample(line, interval)
+	points := make([]geo.Point, len(samples))
+	for i, s := range samples {
+		points[i] = s.Point
+	}
+	elevationProviderOnce.Do(func() { elevationProvider = elevation.FromEnv(config.DB) })
+	heights, err := elevationProvider.Lookup(c.Request.Context(), points)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("GetRouteElevation: Elevation provider lookup failed.")
+		apierror.Respond(c, http.StatusBadGateway, "Elevation provider unavailable")
+		return
+	}
+
+	profile = buildElevationProfile(route.ID, geometryHash, interval, elevationProvider.Name(), samples, heights)
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&profile).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Warn("GetRouteElevation: Failed to cache elevation profile.")
+	}
+	respondElevationProfile(c, profile, false)
+}
+
+// elevationGeometryHash identifies a version of a route's geometry by its
+// coordinates rounded to 1e-6° (about 10 cm), so the same line encoded with
+// slightly different floats still hits the cache.
+func elevationGeometryHash(line []geo.Point) string {
+	h := sha256.New()
+	var buf [16]byte
+	for _, p := range line {
+		binary.LittleEndian.PutUint64(buf[:8], uint64(int64(math.Round(p.Lat*1e6))))
+		binary.LittleEndian.PutUint64(buf[8:], uint64(int64(math.Round(p.Lng*1e6))))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildElevationProfile pairs samples with their heights. Samples without
+// data keep a nil elevation and are left out of the totals; ascent and
+// descent are measured between the samples either side of a gap.
+func buildElevationProfile(routeID uint, hash string, interval float64, provider string, samples []geo.Sample, heights []*float64) models.RouteElevationProfile {
+	profile := models.RouteElevationProfile{
+		RouteID:        routeID,
+		GeometryHash:   hash,
+		SampleInterval: interval,
+		Provider:       provider,
+	}
+	out := make([]models.ElevationSample, len(samples))
+	var prev *float64
+	for i, s := range samples {
+		h := heights[i]
+		out[i] = models.ElevationSample{Lat: s.Lat, Lng: s.Lng, Distance: s.Distance, Elevation: h}
+		if h == nil {
+			continue
+		}
+		if profile.MinElevation == nil || *h < *profile.MinElevation {
+			profile.MinElevation = h
+		}
+		if profile.MaxElevation == nil || *h > *profile.MaxElevation {
+			profile.MaxElevation = h
+		}
+		if prev != nil {
+			if delta := *h - *prev; delta > 0 {
+				profile.TotalAscent += delta
+			} else {
+				profile.TotalDescent -= delta
+			}
+		}
+		prev = h
+	}
+	profile.Samples, _ = json.Marshal(out)
+	return profile
+}
+
+func respondElevationProfile(c *gin.Context, profile models.RouteElevationProfile, cached bool) {
+	var samples []models.ElevationSample
+	if err := json.Unmarshal(profile.Samples, &samples); err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", profile.RouteID).Error("respondElevationProfile: Corrupt cached samples.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load elevation profile")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"route_id":        profile.RouteID,
+		"geometry_hash":   profile.GeometryHash,
+		"sample_interval": profile.SampleInterval,
+		"provider":        profile.Provider,
+		"total_ascent":    profile.TotalAscent,
+		"total_descent":   profile.TotalDescent,
+		"min_elevation":   profile.MinElevation,
+		"max_elevation":   profile.MaxElevation,
+		"samples":         samples,
+		"cached":          cached,
+	}})
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+
+	"ma3_tracker/internal/geo"
+)
+
+func TestElevationProfileSkipsNoData(t *testing.T) {
+	height := func(v float64) *float64 { return &v }
+	samples := []geo.Sample{{Distance: 0}, {Distance: 100}, {Distance: 200}, {Distance: 300}}
+	profile := buildElevationProfile(1, "h", 100, "http", samples, []*float64{height(1600), nil, height(1650), height(1620)})
+	if profile.MinElevation == nil || *profile.MinElevation != 1600 || profile.MaxElevation == nil || *profile.MaxElevation != 1650 {
+		t.Errorf("min, max = %v, %v; want 1600, 1650", profile.MinElevation, profile.MaxElevation)
+	}
+	if profile.TotalAscent != 50 || profile.TotalDescent != 30 {
+		t.Errorf("ascent, descent = %g, %g; want 50, 30 measured across the gap", profile.TotalAscent, profile.TotalDescent)
+	}
+
+	empty := buildElevationProfile(1, "h", 100, "http", samples[:1], []*float64{nil})
+	if empty.MinElevation != nil || empty.MaxElevation != nil {
+		t.Errorf("min, max = %v, %v; want nil without data", empty.MinElevation, empty.MaxElevation)
+	}
+}
+
+func TestElevationGeometryHashRounds(t *testing.T) {
+	a := []geo.Point{{Lat: -1.2921, Lng: 36.8219}, {Lat: -1.3, Lng: 36.83}}
+	b := []geo.Point{{Lat: -1.29210000001, Lng: 36.82189999999}, {Lat: -1.3, Lng: 36.83}}
+	c := []geo.Point{{Lat: -1.2922, Lng: 36.8219}, {Lat: -1.3, Lng: 36.83}}
+	if elevationGeometryHash(a) != elevationGeometryHash(b) {
+		t.Error("float noise changed the hash")
+	}
+	if elevationGeometryHash(a) == elevationGeometryHash(c) {
+		t.Error("an edited point kept the hash")
+	}
+}
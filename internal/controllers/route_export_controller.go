@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// ExportRoute converts a route's geometry and stages into KML, GPX or GeoJSON
+// and returns it as a downloadable file.
+func ExportRoute(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "ExportRoute", "Stages")
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "geojson"))
+	line, err := geo.LineFromWKB(route.Geometry)
+	if err != nil && err != geo.ErrNoGeometry {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ExportRoute: Failed to decode route geometry.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to decode route geometry")
+		return
+	}
+
+	stages := append([]models.Stage(nil), route.Stages...)
+	sort.Slice(stages, func(i, j int) bool { return stages[i].Seq < stages[j].Seq })
+
+	var (
+		body        []byte
+		contentType string
+	)
+	switch format {
+	case "kml":
+		body, err = routeToKML(route, line, stages)
+		contentType = "application/vnd.google-earth.kml+xml"
+	case "gpx":
+		body, err = routeToGPX(route, line, stages)
+		contentType = "application/gpx+xml"
+	case "geojson":
+		body, err = routeToGeoJSON(route, line, stages)
+		contentType = "application/geo+json"
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "Unsupported format. Use kml, gpx or geojson.")
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ExportRoute: Failed to encode export.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to export route")
+		return
+	}
+
+	filename := fmt.Sprintf("route-%d-%s.%s", route.ID, slugify(route.Name), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "format": format}).Info("ExportRoute: Route exported.")
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// slugify produces a filesystem-friendly version of a route name.
+func slugify(name string) string {
+	var b strings.Builder
+	lastDash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			lastDash = false
+		case !lastDash && b.Len() > 0:
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+	s := strings.TrimSuffix(b.String(), "-")
+	if s == "" {
+		return "route"
+	}
+	return s
+}
+
+type kmlDocument struct {
+	XMLName  xml.Name        `xml:"kml"`
+	Xmlns    string          `xml:"xmlns,attr"`
+	Document kmlDocumentBody `xml:"Document"`
+}
+
+type kmlDocumentBody struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Placemarks  []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name       string          `xml:"name"`
+	LineString *kmlCoordinates `xml:"LineString,omitempty"`
+	Point      *kmlCoordinates `xml:"Point,omitempty"`
+}
+
+type kmlCoordinates struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+func routeToKML(route models.Route, line []geo.Point, stages []models.Stage) ([]byte, error) {
+	doc := kmlDocument{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocumentBody{
+			Name:        route.Name,
+			Description: route.Description,
+		},
+	}
+	if len(line) > 0 {
+		coords := make([]string, 0, len(line))
+		for _, p := range line {
+			coords = append(coords, fmt.Sprintf("%f,%f,0", p.Lng, p.Lat))
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:       route.Name,
+			LineString: &kmlCoordinates{Coordinates: strings.Join(coords, " ")},
+		})
+	}
+	for _, s := range stages {
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:  s.Name,
+			Point: &kmlCoordinates{Coordinates: fmt.Sprintf("%f,%f,0", s.Lng, s.Lat)},
+		})
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+type gpxDocument struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Metadata  gpxMetadata   `xml:"metadata"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Routes    []gpxRoute    `xml:"rte"`
+}
+
+type gpxMetadata struct {
+	Name string    `xml:"name"`
+	Desc string    `xml:"desc,omitempty"`
+	Time time.Time `xml:"time"`
+}
+
+type gpxWaypoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name,omitempty"`
+}
+
+type gpxRoute struct {
+	Name   string        `xml:"name"`
+	Points []gpxWaypoint `xml:"rtept"`
+}
+
+func routeToGPX(route models.Route, line []geo.Point, stages []models.Stage) ([]byte, error) {
+	doc := gpxDocument{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "ma3_tracker",
+		Metadata: gpxMetadata{
+			Name: route.Name,
+			Desc: route.Description,
+			Time: time.Now().UTC(),
+		},
+	}
+	for _, s := range stages {
+		doc.Waypoints = append(doc.Waypoints, gpxWaypoint{Lat: s.Lat, Lon: s.Lng, Name: s.Name})
+	}
+	if len(line) > 0 {
+		rte := gpxRoute{Name: route.Name}
+		for _, p := range line {
+			rte.Points = append(rte.Points, gpxWaypoint{Lat: p.Lat, Lon: p.Lng})
+		}
+		doc.Routes = append(doc.Routes, rte)
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func routeToGeoJSON(route models.Route, line []geo.Point, stages []models.Stage) ([]byte, error) {
+	features := make([]gin.H, 0, len(stages)+1)
+	if len(line) > 0 {
+		coords := make([][2]float64, 0, len(line))
+		for _, p := range line {
+			coords = append(coords, [2]float64{p.Lng, p.Lat})
+		}
+		features = append(features, gin.H{
+			"type":     "Feature",
+			"geometry": gin.H{"type": "LineString", "coordinates": coords},
+			"properties": gin.H{
+				"route_id":    route.ID,
+				"name":        route.Name,
+				"description": route.Description,
+			},
+		})
+	}
+	for _, s := range stages {
+		features = append(features, gin.H{
+			"type":     "Feature",
+			"geometry": gin.H{"type": "Point", "coordinates": [2]float64{s.Lng, s.Lat}},
+			"properties": gin.H{
+				"stage_id": s.ID,
+				"name":     s.Name,
+				"seq":      s.Seq,
+			},
+		})
+	}
+	return json.Marshal(gin.H{"type": "FeatureCollection", "features": features})
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/importer"
+	"ma3_tracker/internal/models"
+)
+
+const (
+	maxImportBytes   = 20 << 20 // 20 MiB
+	routeImportTTL   = 24 * time.Hour
+	previewTolerance = 10.0 // meters; keeps preview payloads small
+)
+
+// CreateRouteImport parses an uploaded zipped shapefile or CSV stop list
+// (multipart field "file") and returns a preview to confirm.
+func CreateRouteImport(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "CreateRouteImport")
+	if !ok {
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "file is required")
+		return
+	}
+	if fileHeader.Size > maxImportBytes {
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, "file must be 20 MiB or smaller")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "could not read file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImportBytes+1))
+	if err != nil || len(data) > maxImportBytes {
+		apierror.Respond(c, http.StatusBadRequest, "could not read file")
+		return
+	}
+
+	var result importer.Result
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".zip":
+		result, err = importer.ParseShapefileZip(data)
+	case ".csv", ".txt":
+		defaultName := strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename))
+		result, err = importer.ParseCSV(strings.NewReader(string(data)), defaultName)
+	default:
+		apierror.Respond(c, http.StatusUnsupportedMediaType, "upload a .zip shapefile or a .csv stop list")
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Warn("CreateRouteImport: Failed to parse upload.")
+		apierror.Fail(c, apierror.New(http.StatusUnprocessableEntity, err.Error()).WithDetail("warnings", result.Warnings))
+		return
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateRouteImport: Failed to encode preview.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to store preview")
+		return
+	}
+	imp := models.RouteImport{
+		SaccoID:   sacco.ID,
+		UserID:    authenticatedUserID(c),
+		Source:    result.Source,
+		FileName:  fileHeader.Filename,
+		Status:    models.RouteImportPreview,
+		Preview:   string(encoded),
+		ExpiresAt: time.Now().Add(routeImportTTL),
+	}
+	if err := config.DB.Create(&imp).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateRouteImport: Failed to save import.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to store preview")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"import_id": imp.ID, "routes": len(result.Routes)}).Info("CreateRouteImport: Preview created.")
+	c.JSON(http.StatusCreated, gin.H{"data": routeImportResponse(imp, result)})
+}
+
+// GetRouteImport returns a stored preview.
+func GetRouteImport(c *gin.Context) {
+	imp, result, ok := loadRouteImport(c, "GetRouteImport")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": routeImportResponse(imp, result)})
+}
+
+// ConfirmRouteImport creates draft routes from a preview. An optional body
+// {"routes": [0, 2]} selects which previewed routes to create.
+func ConfirmRouteImport(c *gin.Context) {
+	imp, result, ok := loadRouteImport(c, "ConfirmRouteImport")
+	if !ok {
+		return
+	}
+	if imp.Status != models.RouteImportPreview || time.Now().After(imp.ExpiresAt) {
+		apierror.Fail(c, apierror.New(http.StatusConflict, "Import is no longer pending confirmation").WithDetail("status", imp.Status))
+		return
+	}
+	var input struct {
+		Routes []int `json:"routes"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			apierror.Fail(c, apierror.Invalid(err))
+			return
+		}
+	}
+	selected := result.Routes
+	if len(input.Routes) > 0 {
+		selected = make([]importer.Route, 0, len(input.Routes))
+		for _, i := range input.Routes {
+			if i < 0 || i >= len(result.Routes) {
+				apierror.Respond(c, http.StatusBadRequest, "routes contains an index outside the preview")
+				return
+			}
+			selected = append(selected, result.Routes[i])
+		}
+	}
+
+	var ids []uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ids, err = importer.Commit(tx, imp.SaccoID, selected); err != nil {
+			return err
+		}
+		idStrings := make([]string, 0, len(ids))
+		for _, id := range ids {
+			idStrings = append(idStrings, strconv.FormatUint(uint64(id), 10))
+		}
+		now := time.Now()
+		res := tx.Model(&imp).Where("status = ?", models.RouteImportPreview).Updates(map[string]interface{}{
+			"status":            models.RouteImportConfirmed,
+			"created_route_ids": strings.Join(idStrings, ","),
+			"confirmed_at":      now,
+		})
+		if res.Error == nil && res.RowsAffected == 0 {
+			return errors.New("import was confirmed concurrently")
+		}
+		return res.Error
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("import_id", imp.ID).Error("ConfirmRouteImport: Failed to create routes.")
+		apierror.Fail(c, apierror.Internal("Failed to create routes", err))
+		return
+	}
+
+	var routes []models.Route
+	config.DB.Preload("Stages").Where("id IN ?", ids).Find(&routes)
+	out := make([]RouteResponse, 0, len(routes))
+	for _, r := range routes {
+		out = append(out, toRouteResponse(r))
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"import_id": imp.ID, "routes": len(ids)}).Info("ConfirmRouteImport: Routes created as drafts.")
+	c.JSON(http.StatusCreated, gin.H{"data": out})
+}
+
+// DiscardRouteImport drops a preview without creating anything.
+func DiscardRouteImport(c *gin.Context) {
+	imp, _, ok := loadRouteImport(c, "DiscardRouteImport")
+	if !ok {
+		return
+	}
+	if imp.Status != models.RouteImportPreview {
+		apierror.Fail(c, apierror.New(http.StatusConflict, "Import is no longer pending confirmation").WithDetail("status", imp.Status))
+		return
+	}
+	config.DB.Model(&imp).Updates(map[string]interface{}{"status": models.RouteImportDiscarded, "preview": ""})
+	c.JSON(http.StatusOK, gin.H{"message": "Import discarded"})
+}
+
+func loadRouteImport(c *gin.Context, fn string) (models.RouteImport, importer.Result, bool) {
+	var result importer.Result
+	imp, ok := loadOwned[models.RouteImport](c, fn, "Import", config.DB)
+	if !ok {
+		return imp, result, false
+	}
+	if imp.Preview != "" {
+		if err := json.Unmarshal([]byte(imp.Preview), &result); err != nil {
+			logrus.WithContext(c).WithError(err).WithField("import_id", imp.ID).Error(fn + ": Stored preview is corrupt.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to read import preview")
+			return imp, result, false
+		}
+	}
+	return imp, result, true
+}
+
+// routeImportResponse renders the preview with GeoJSON geometries, simplified
+// so large corridors stay cheap to draw.
+func routeImportResponse(imp models.RouteImport, result importer.Result) gin.H {
+	routes := make([]gin.H, 0, len(result.Routes))
+	for i, r := range result.Routes {
+		line := geo.Simplify(r.Line, previewTolerance)
+		coords := make([][2]float64, 0, len(line))
+		for _, p := range line {
+			coords = append(coords, [2]float64{p.Lng, p.Lat})
+		}
+		routes = append(routes, gin.H{
+			"index":       i,
+			"name":        r.Name,
+			"description": r.Description,
+			"length_m":    r.LengthM,
+			"geometry":    gin.H{"type": "LineString", "coordinates": coords},
+			"stages":      r.Stages,
+		})
+	}
+	return gin.H{"import": imp, "routes": routes, "warnings": result.Warnings}
+}
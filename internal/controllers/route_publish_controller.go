@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/webhooks"
+)
+
+// routePublishRequiresApproval routes sacco publish requests through admin review when enabled.
+var routePublishRequiresApproval = config.EnvBool("ROUTE_PUBLISH_REQUIRES_APPROVAL", false)
+
+// PublishRoute makes a draft route visible to commuters, or submits it for
+// admin review when ROUTE_PUBLISH_REQUIRES_APPROVAL is enabled.
+func PublishRoute(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "PublishRoute")
+	if !ok {
+		return
+	}
+	if !models.CanTransitionRoute(route.Status, models.RouteStatusPublished) {
+		respondRouteTransition(c, route, models.RouteStatusPublished)
+		return
+	}
+	if len(route.Geometry) == 0 {
+		apierror.Respond(c, http.StatusUnprocessableEntity, "Route must have a geometry before it can be published")
+		return
+	}
+	var stageCount int64
+	if err := config.DB.Model(&models.Stage{}).Where("route_id = ?", route.ID).Count(&stageCount).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("PublishRoute: Database error counting stages.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to publish route")
+		return
+	}
+	if stageCount < 2 {
+		apierror.Respond(c, http.StatusUnprocessableEntity, "Route must have at least two stages before it can be published")
+		return
+	}
+
+	if routePublishRequiresApproval {
+		setRouteStatus(c, route, models.RouteStatusPendingReview, "", "PublishRoute")
+		return
+	}
+	setRouteStatus(c, route, models.RouteStatusPublished, "", "PublishRoute")
+}
+
+// UnpublishRoute hides a route from commuters by returning it to draft.
+func UnpublishRoute(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "UnpublishRoute")
+	if !ok {
+		return
+	}
+	setRouteStatus(c, route, models.RouteStatusDraft, "", "UnpublishRoute")
+}
+
+// ArchiveRoute retires a route without deleting its history.
+func ArchiveRoute(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "ArchiveRoute")
+	if !ok {
+		return
+	}
+	setRouteStatus(c, route, models.RouteStatusArchived, "", "ArchiveRoute")
+}
+
+// ListPendingRoutes lists routes awaiting admin approval.
+func ListPendingRoutes(c *gin.Context) {
+	var routes []models.Route
+	if err := config.DB.Preload("Stages").Where("status = ?", models.RouteStatusPendingReview).Order("updated_at ASC").Find(&routes).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListPendingRoutes: Database error fetching pending routes.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch routes")
+		return
+	}
+	routeResponses := make([]RouteResponse, 0, len(routes))
+	for _, r := range routes {
+		routeResponses = append(routeResponses, toRouteResponse(r))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": routeResponses})
+}
+
+// ApproveRoute publishes a route that is pending review.
+func ApproveRoute(c *gin.Context) {
+	route, ok := loadPendingRoute(c, "ApproveRoute")
+	if !ok {
+		return
+	}
+	setRouteStatus(c, route, models.RouteStatusPublished, "", "ApproveRoute")
+}
+
+// RejectRoute sends a pending route back to draft with a note for the sacco.
+func RejectRoute(c *gin.Context) {
+	var input struct {
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	route, ok := loadPendingRoute(c, "RejectRoute")
+	if !ok {
+		return
+	}
+	setRouteStatus(c, route, models.RouteStatusDraft, input.Note, "RejectRoute")
+}
+
+// respondRouteTransition refuses moving route to status, listing the states
+// it may move to.
+func respondRouteTransition(c *gin.Context, route models.Route, status string) {
+	apierror.Fail(c, apierror.New(http.StatusConflict, "Route cannot move from "+route.Status+" to "+status+".").
+		WithCode("invalid_transition").
+		WithDetail("allowed", models.RouteTransitions(route.Status)))
+}
+
+func loadPendingRoute(c *gin.Context, fn string) (models.Route, bool) {
+	var route models.Route
+	rID, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return route, false
+	}
+	if err := config.DB.First(&route, rID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("route_id", rID).Error(fn + ": Database error fetching route.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch route")
+		}
+		return route, false
+	}
+	if route.Status != models.RouteStatusPendingReview {
+		apierror.Respond(c, http.StatusConflict, "Route is not pending review")
+		return route, false
+	}
+	return route, true
+}
+
+// setRouteStatus persists a status transition and responds with the updated
+// route, or with 409 invalid_transition when the route's lifecycle does not
+// allow it. The update only applies while the route is still in the status it
+// was loaded with, so two concurrent changes cannot both succeed. Publishing
+// calls the sacco's route_published webhooks.
+func setRouteStatus(c *gin.Context, route models.Route, status, note, fn string) {
+	if !models.CanTransitionRoute(route.Status, status) {
+		respondRouteTransition(c, route, status)
+		return
+	}
+	updates := map[string]interface{}{"status": status, "review_note": note}
+	if status == models.RouteStatusPublished {
+		now := time.Now()
+		updates["published_at"] = &now
+	}
+	res := config.DB.Model(&models.Route{}).Where("id = ? AND status = ?", route.ID, route.Status).Updates(updates)
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).WithField("route_id", route.ID).Error(fn + ": Failed to update route status.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update route status")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusConflict, "Route status changed meanwhile; reload it and try again")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "status": status}).Info(fn + ": Route status updated.")
+
+	config.DB.Preload("Stages").Preload("Vehicles").First(&route, route.ID)
+	if status == models.RouteStatusPublished {
+		if err := webhooks.Publish(config.DB, route.SaccoID, models.WebhookRoutePublished, toRouteResponse(route)); err != nil {
+			logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error(fn + ": Failed to queue webhooks.")
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": toRouteResponse(route)})
+}
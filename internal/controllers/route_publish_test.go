@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+func TestRouteStatusTransitions(t *testing.T) {
+	r := twoSaccos(t, 1, "sacco")
+	line, _ := geo.LineToWKB([]geo.Point{{Lat: -1.28, Lng: 36.82}, {Lat: -1.28, Lng: 36.83}})
+	route := models.Route{Model: gorm.Model{ID: 1}, SaccoID: 1, Name: "CBD - Westlands", Status: models.RouteStatusArchived, Geometry: line}
+	if err := config.DB.Create(&route).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		config.DB.Create(&models.Stage{RouteID: 1, Seq: i, Name: "Stage", Lat: -1.28, Lng: 36.82 + float64(i)/200})
+	}
+	r.POST("/sacco/routes/:id/publish", PublishRoute)
+	r.POST("/sacco/routes/:id/unpublish", UnpublishRoute)
+	r.POST("/sacco/routes/:id/archive", ArchiveRoute)
+	call := func(action string) (int, string, []string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sacco/routes/1/"+action, nil))
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Details struct {
+					Allowed []string `json:"allowed"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Error.Code, body.Error.Details.Allowed
+	}
+
+	code, errCode, allowed := call("publish")
+	if code != http.StatusConflict || errCode != "invalid_transition" || len(allowed) != 1 || allowed[0] != models.RouteStatusDraft {
+		t.Errorf("publish archived: %d %q %v; want 409 invalid_transition allowing draft", code, errCode, allowed)
+	}
+	if code, errCode, _ := call("archive"); code != http.StatusConflict || errCode != "invalid_transition" {
+		t.Errorf("archive archived: %d %q; want 409", code, errCode)
+	}
+	for _, step := range []string{"unpublish", "publish"} {
+		if code, _, _ := call(step); code != http.StatusOK {
+			t.Fatalf("%s: %d; want 200", step, code)
+		}
+	}
+	if code, _, _ := call("publish"); code != http.StatusConflict {
+		t.Errorf("publish published: %d; want 409", code)
+	}
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+// routeReviewListOptions are the sorts and filters the review listings accept.
+var routeReviewListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"score":      "(reliability + safety + comfort)",
+	},
+	DefaultSort: "-updated_at",
+	Filters: map[string]pagination.Filter{
+		"route_id": pagination.Uint("route_id = ?"),
+		"status":   pagination.String("status = ?"),
+	},
+}
+
+// routeRating is the average of a route's public reviews, each aspect and
+// overall, to one decimal place.
+type routeRating struct {
+	Reviews     int64   `json:"reviews"`
+	Reliability float64 `json:"reliability"`
+	Safety      float64 `json:"safety"`
+	Comfort     float64 `json:"comfort"`
+	Overall     float64 `json:"overall"`
+}
+
+// routeRatings returns the rating of each of the routes that has public
+// reviews.
+func routeRatings(routeIDs []uint) map[uint]*routeRating {
+	out := map[uint]*routeRating{}
+	if len(routeIDs) == 0 {
+		return out
+	}
+	var rows []struct {
+		RouteID                      uint
+		Reviews                      int64
+		Reliability, Safety, Comfort float64
+	}
+	err := config.DB.Model(&models.RouteReview{}).
+		Select("route_id, COUNT(*) AS reviews, AVG(reliability) AS reliability, AVG(safety) AS safety, AVG(comfort) AS comfort").
+		Where("route_id IN ? AND status <> ?", routeIDs, models.ReviewHidden).
+		Group("route_id").
+		Scan(&rows).Error
+	if err != nil {
+		logrus.WithError(err).Error("routeRatings: Failed to aggregate reviews.")
+		return out
+	}
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	for _, r := range rows {
+		out[r.RouteID] = &routeRating{
+			Reviews:     r.Reviews,
+			Reliability: round(r.Reliability),
+			Safety:      round(r.Safety),
+			Comfort:     round(r.Comfort),
+			Overall:     round((r.Reliability + r.Safety + r.Comfort) / 3),
+		}
+	}
+	return out
+}
+
+// attachRouteRatings adds each route's rating; routes nobody has reviewed
+// are left without one.
+func attachRouteRatings(routes []RouteResponse) {
+	ids := make([]uint, 0, len(routes))
+	for _, r := range routes {
+		ids = append(ids, r.ID)
+	}
+	ratings := routeRatings(ids)
+	for i := range routes {
+		routes[i].Rating = ratings[routes[i].ID]
+	}
+}
+
+// loadReviewableRoute loads the published route named by :id.
+func loadReviewableRoute(c *gin.Context, fn string) (models.Route, bool) {
+	var route models.Route
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return route, false
+	}
+	if err := config.DB.Where("id = ? AND status = ?", id, models.RouteStatusPublished).First(&route).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Route not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("route_id", id).Error(fn + ": Failed to load route.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load route")
+		}
+		return route, false
+	}
+	return route, true
+}
+
+// ReviewRoute rates a published route or updates the commuter's earlier
+// review of it. Body: {"reliability": 4, "safety": 5, "comfort": 3,
+// "comment": "..."}; each score is 1 to 5. Editing keeps the review's
+// moderation state, so a hidden review stays hidden.
+func ReviewRoute(c *gin.Context) {
+	route, ok := loadReviewableRoute(c, "ReviewRoute")
+	if !ok {
+		return
+	}
+	var input struct {
+		Reliability int    `json:"reliability" binding:"required"`
+		Safety      int    `json:"safety" binding:"required"`
+		Comfort     int    `json:"comfort" binding:"required"`
+		Comment     string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	for _, score := range []int{input.Reliability, input.Safety, input.Comfort} {
+		if score < 1 || score > 5 {
+			apierror.Respond(c, http.StatusBadRequest, "reliability, safety and comfort must each be between 1 and 5")
+			return
+		}
+	}
+	comment := strings.TrimSpace(input.Comment)
+	if len(comment) > 2000 {
+		apierror.Respond(c, http.StatusBadRequest, "comment can be at most 2000 characters")
+		return
+	}
+
+	userID := authenticatedUserID(c)
+	review := models.RouteReview{UserID: userID, RouteID: route.ID, Status: models.ReviewVisible}
+	status := http.StatusOK
+	err := config.DB.Where("route_id = ? AND user_id = ?", route.ID, userID).First(&review).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status, err = http.StatusCreated, nil
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ReviewRoute: Failed to load review.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save review")
+		return
+	}
+	review.SaccoID = route.SaccoID
+	review.Reliability, review.Safety, review.Comfort = input.Reliability, input.Safety, input.Comfort
+	review.Comment = comment
+	if err := config.DB.Save(&review).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("ReviewRoute: Failed to save review.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save review")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"review_id": review.ID, "route_id": route.ID}).Info("ReviewRoute: Route reviewed.")
+	c.JSON(status, gin.H{"data": review})
+}
+
+// DeleteRouteReview removes the commuter's review of a route.
+func DeleteRouteReview(c *gin.Context) {
+	routeID, ok := parseUintParam(c, "id", "DeleteRouteReview")
+	if !ok {
+		return
+	}
+	res := config.DB.Unscoped().Where("route_id = ? AND user_id = ?", routeID, authenticatedUserID(c)).Delete(&models.RouteReview{})
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).WithField("route_id", routeID).Error("DeleteRouteReview: Failed to delete review.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete review")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "Review not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Review deleted"})
+}
+
+// ListRouteReviews returns a published route's public reviews, most recently
+// updated first, with its rating. Reviewers are not identified; the
+// commuter's own review is marked as theirs.
+func ListRouteReviews(c *gin.Context) {
+	route, ok := loadReviewableRoute(c, "ListRouteReviews")
+	if !ok {
+		return
+	}
+	opts := routeReviewListOptions
+	opts.Filters = nil
+	var reviews []models.RouteReview
+	query := config.Replica().Model(&models.RouteReview{}).Where("route_id = ? AND status <> ?", route.ID, models.ReviewHidden)
+	meta, ok := paginate(c, "ListRouteReviews", query, opts, &reviews)
+	if !ok {
+		return
+	}
+	userID := authenticatedUserID(c)
+	for i := range reviews {
+		reviews[i].Mine = userID != 0 && reviews[i].UserID == userID
+		reviews[i].UserID = 0
+		reviews[i].Status, reviews[i].FlagReason, reviews[i].ModeratedBy, reviews[i].ModeratedAt = models.ReviewVisible, "", 0, nil
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reviews, "pagination": meta, "rating": routeRatings([]uint{route.ID})[route.ID]})
+}
+
+// ListSaccoRouteReviews returns the reviews of the sacco's routes, hidden
+// ones included, filtered by ?route_id= and ?status=.
+func ListSaccoRouteReviews(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoRouteReviews")
+	if !ok {
+		return
+	}
+	var reviews []models.RouteReview
+	query := config.DB.Model(&models.RouteReview{}).Scopes(tenant.SaccoScope)
+	meta, ok := paginate(c, "ListSaccoRouteReviews", query, routeReviewListOptions, &reviews)
+	if !ok {
+		return
+	}
+	for i := range reviews {
+		reviews[i].UserID = 0
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reviews, "pagination": meta})
+}
+
+// loadRouteReview loads the :id review within query.
+func loadRouteReview(c *gin.Context, fn string, query *gorm.DB) (models.RouteReview, bool) {
+	var review models.RouteReview
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return review, false
+	}
+	if err := query.Where("id = ?", id).First(&review).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Review not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("review_id", id).Error(fn + ": Failed to load review.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load review")
+		}
+		return review, false
+	}
+	return review, true
+}
+
+// moderateRouteReview applies a moderation decision to a review, recording
+// who made it, and responds with the updated review.
+func moderateRouteReview(c *gin.Context, fn string, review models.RouteReview, updates map[string]interface{}) {
+	updates["moderated_by"] = authenticatedUserID(c)
+	updates["moderated_at"] = time.Now()
+	if err := config.DB.Model(&review).Updates(updates).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("review_id", review.ID).Error(fn + ": Failed to save review.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update review")
+		return
+	}
+	if err := config.DB.First(&review, review.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("review_id", review.ID).Error(fn + ": Failed to reload review.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load review")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"review_id": review.ID, "status": review.Status}).Info(fn + ": Review moderated.")
+	c.JSON(http.StatusOK, gin.H{"data": review})
+}
+
+// FlagRouteReview lets a sacco ask admins to look at a review of one of its
+// routes. Body: {"reason": "..."}. The review stays public until an admin
+// hides it.
+func FlagRouteReview(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "FlagRouteReview")
+	if !ok {
+		return
+	}
+	review, ok := loadRouteReview(c, "FlagRouteReview", config.DB.Scopes(tenant.SaccoScope))
+	if !ok {
+		return
+	}
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" || len(reason) > 1000 {
+		apierror.Respond(c, http.StatusBadRequest, "reason must be between 1 and 1000 characters")
+		return
+	}
+	if review.Status == models.ReviewHidden {
+		apierror.Respond(c, http.StatusConflict, "Review is already hidden")
+		return
+	}
+	moderateRouteReview(c, "FlagRouteReview", review, map[string]interface{}{"status": models.ReviewFlagged, "flag_reason": reason})
+}
+
+// ListReviewsForModeration lets admins go through route reviews, by default
+// the flagged ones oldest first. ?status=, ?route_id= and ?sacco_id= narrow
+// the list.
+func ListReviewsForModeration(c *gin.Context) {
+	opts := routeReviewListOptions
+	opts.DefaultSort = "updated_at"
+	opts.Filters = map[string]pagination.Filter{
+		"route_id": pagination.Uint("route_id = ?"),
+		"sacco_id": pagination.Uint("sacco_id = ?"),
+		"status":   pagination.String("status = ?"),
+	}
+	query := config.DB.Model(&models.RouteReview{})
+	if _, present := c.GetQuery("status"); !present {
+		query = query.Where("status = ?", models.ReviewFlagged)
+	}
+	var reviews []models.RouteReview
+	meta, ok := paginate(c, "ListReviewsForModeration", query, opts, &reviews)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reviews, "pagination": meta})
+}
+
+// HideRouteReview takes a review out of public listings and ratings. Body:
+// {"note": "..."}, the reason, is required.
+func HideRouteReview(c *gin.Context) {
+	review, ok := loadRouteReview(c, "HideRouteReview", config.DB)
+	if !ok {
+		return
+	}
+	var input struct {
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	note := strings.TrimSpace(input.Note)
+	if note == "" || len(note) > 1000 {
+		apierror.Respond(c, http.StatusBadRequest, "note must be between 1 and 1000 characters")
+		return
+	}
+	moderateRouteReview(c, "HideRouteReview", review, map[string]interface{}{"status": models.ReviewHidden, "moderation_note": note})
+}
+
+// RestoreRouteReview makes a hidden or flagged review public again and
+// clears the flag.
+func RestoreRouteReview(c *gin.Context) {
+	review, ok := loadRouteReview(c, "RestoreRouteReview", config.DB)
+	if !ok {
+		return
+	}
+	if review.Status == models.ReviewVisible {
+		apierror.Respond(c, http.StatusConflict, "Review is already visible")
+		return
+	}
+	moderateRouteReview(c, "RestoreRouteReview", review, map[string]interface{}{"status": models.ReviewVisible, "flag_reason": "", "moderation_note": ""})
+}
@@ -4,13 +4,18 @@ import (
 	"errors" // Import errors for gorm.ErrRecordNotFound
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"ma3_tracker/internal/apierror"
 	"ma3_tracker/internal/config"
 	"ma3_tracker/internal/models" // Your models package
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/storage"
 )
 
 // updateSaccoInput defines the fields a client can send to update a Sacco's profile.
@@ -20,6 +25,7 @@ type updateSaccoInput struct {
     Email   *string `json:"email"`
     Phone   *string `json:"phone"`
     Address *string `json:"address"` // Assuming Sacco model has an Address field
+    Region  *string `json:"region"`
 }
 
 // --- Sacco Controller Functions ---
@@ -35,12 +41,12 @@ type updateSaccoInput struct {
 func CreateSacco(c *gin.Context) {
     var input models.Sacco
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        apierror.Fail(c, apierror.Invalid(err))
         return
     }
 
     if err := config.DB.Create(&input).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create sacco: " + err.Error()})
+        apierror.Fail(c, apierror.Internal("Could not create sacco", err))
         return
     }
 
@@ -53,19 +59,19 @@ func GetSacco(c *gin.Context) {
     saccoIDStr := c.Param("id")
     saccoID, err := strconv.ParseUint(saccoIDStr, 10, 32)
     if err != nil {
-        logrus.WithError(err).Warnf("GetSacco: invalid sacco ID '%s'", saccoIDStr)
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Sacco ID format."})
+        logrus.WithContext(c).WithError(err).Warnf("GetSacco: invalid sacco ID '%s'", saccoIDStr)
+        apierror.Respond(c, http.StatusBadRequest, "Invalid Sacco ID format.")
         return
     }
 
     var sacco models.Sacco
     if err := config.DB.Preload("Vehicles").Preload("User").First(&sacco, uint(saccoID)).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            logrus.WithField("sacco_id", saccoID).Info("GetSacco: sacco not found")
-            c.JSON(http.StatusNotFound, gin.H{"error": "Sacco not found."})
+            logrus.WithContext(c).WithField("sacco_id", saccoID).Info("GetSacco: sacco not found")
+            apierror.Respond(c, http.StatusNotFound, "Sacco not found.")
         } else {
-            logrus.WithError(err).WithField("sacco_id", saccoID).Error("GetSacco: database error fetching Sacco")
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching Sacco."})
+            logrus.WithContext(c).WithError(err).WithField("sacco_id", saccoID).Error("GetSacco: database error fetching Sacco")
+            apierror.Respond(c, http.StatusInternalServerError, "Database error fetching Sacco.")
         }
         return
     }
@@ -78,7 +84,10 @@ func GetSacco(c *gin.Context) {
         "owner":     sacco.Owner,
         "email":     sacco.Email,
         "phone":     sacco.Phone,
+        "region":    sacco.Region,
+        "photo_url": storage.Default().URL(sacco.PhotoKey),
         "vehicles":  sacco.Vehicles,
+        "branding":  publicBranding(sacco),
     }
     if sacco.User != nil && sacco.User.ID != 0 {
         response["owner_user_details"] = gin.H{
@@ -89,33 +98,52 @@ func GetSacco(c *gin.Context) {
         }
     }
 
-    logrus.WithField("sacco_id", saccoID).Info("GetSacco: retrieved sacco successfully")
+    logrus.WithContext(c).WithField("sacco_id", saccoID).Info("GetSacco: retrieved sacco successfully")
     c.JSON(http.StatusOK, gin.H{"sacco": response})
 }
 
-// ListDriversBySacco fetches drivers for a given sacco_id query param.
+// driverProfileListOptions are the sorts ListDriversBySacco accepts.
+var driverProfileListOptions = pagination.Options{
+    Sorts: map[string]string{
+        "id":             "id",
+        "created_at":     "created_at",
+        "name":           "name",
+        "license_number": "license_number",
+    },
+    DefaultSort: "id",
+}
+
+// ListDriversBySacco fetches the drivers of the sacco in the path a page at a time.
 func ListDriversBySacco(c *gin.Context) {
     saccoIDStr := c.Param("id")
     if saccoIDStr == "" {
-        logrus.Warn("ListDriversBySacco: missing sacco_id query param")
-        c.JSON(http.StatusBadRequest, gin.H{"error": "sacco_id query parameter is required."})
+        logrus.WithContext(c).Warn("ListDriversBySacco: missing sacco_id query param")
+        apierror.Respond(c, http.StatusBadRequest, "sacco_id query parameter is required.")
         return
     }
     saccoID, err := strconv.ParseUint(saccoIDStr, 10, 32)
     if err != nil {
-        logrus.WithError(err).Warnf("ListDriversBySacco: invalid sacco_id '%s'", saccoIDStr)
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Sacco ID format."})
+        logrus.WithContext(c).WithError(err).Warnf("ListDriversBySacco: invalid sacco_id '%s'", saccoIDStr)
+        apierror.Respond(c, http.StatusBadRequest, "Invalid Sacco ID format.")
+        return
+    }
+
+    tenant, ok := pathSaccoTenant(c, "ListDriversBySacco", uint(saccoID))
+    if !ok {
         return
     }
 
     var drivers []models.Driver
-    if err := config.DB.Where("sacco_id = ?", uint(saccoID)).Preload("User").Find(&drivers).Error; err != nil {
-        logrus.WithError(err).WithField("sacco_id", saccoID).Error("ListDriversBySacco: error listing drivers")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing drivers for sacco."})
+    query, ok := includeDeleted(c, "ListDriversBySacco", tenant.Scoped(config.DB.Model(&models.Driver{}).Where("sacco_id = ?", uint(saccoID))), uint(saccoID))
+    if !ok {
+        return
+    }
+    meta, ok := paginate(c, "ListDriversBySacco", query, driverProfileListOptions, &drivers, "User")
+    if !ok {
         return
     }
 
-    var profiles []gin.H
+    profiles := make([]gin.H, 0, len(drivers))
     for _, d := range drivers {
         profile := gin.H{
             "ID":             d.ID,
@@ -123,6 +151,7 @@ func ListDriversBySacco(c *gin.Context) {
             "phone":          d.Phone,
             "license_number": d.LicenseNumber,
             "sacco_id":       d.SaccoID,
+            "photo_url":      storage.Default().URL(d.PhotoKey),
         }
         if d.User.ID != 0 {
             profile["user_details"] = gin.H{
@@ -136,20 +165,38 @@ func ListDriversBySacco(c *gin.Context) {
         profiles = append(profiles, profile)
     }
 
-    logrus.WithField("sacco_id", saccoID).Infof("ListDriversBySacco: found %d drivers", len(profiles))
-    c.JSON(http.StatusOK, gin.H{"data": profiles})
+    logrus.WithContext(c).WithField("sacco_id", saccoID).Infof("ListDriversBySacco: found %d drivers", len(profiles))
+    c.JSON(http.StatusOK, gin.H{"data": profiles, "pagination": meta})
+}
+
+// saccoListOptions are the sorts and filters ListSaccos accepts.
+var saccoListOptions = pagination.Options{
+    Sorts: map[string]string{
+        "id":         "id",
+        "created_at": "created_at",
+        "name":       "name",
+        "region":     "region",
+    },
+    DefaultSort: "id",
+    Filters: map[string]pagination.Filter{
+        "region":  pagination.String("region = ?"),
+        "user_id": pagination.Uint("user_id = ?"),
+    },
 }
 
-// ListSaccos returns all saccos with associated user and vehicles.
+// ListSaccos returns saccos a page at a time with associated user and vehicles.
 func ListSaccos(c *gin.Context) {
+    query, ok := includeDeleted(c, "ListSaccos", config.DB.Model(&models.Sacco{}), 0)
+    if !ok {
+        return
+    }
     var saccos []models.Sacco
-    if err := config.DB.Preload("User").Preload("Vehicles").Find(&saccos).Error; err != nil {
-        logrus.WithError(err).Error("ListSaccos: could not fetch saccos")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch saccos."})
+    meta, ok := paginate(c, "ListSaccos", query, saccoListOptions, &saccos, "User", "Vehicles")
+    if !ok {
         return
     }
 
-    var out []gin.H
+    out := make([]gin.H, 0, len(saccos))
     for _, s := range saccos {
         item := gin.H{
             "ID":        s.ID,
@@ -159,7 +206,10 @@ func ListSaccos(c *gin.Context) {
             "owner":     s.Owner,
             "email":     s.Email,
             "phone":     s.Phone,
+            "region":    s.Region,
+        "photo_url": storage.Default().URL(s.PhotoKey),
             "vehicles":  s.Vehicles,
+            "branding":  publicBranding(s),
         }
         if s.User != nil && s.User.ID != 0 {
             item["owner_user_details"] = gin.H{
@@ -172,8 +222,8 @@ func ListSaccos(c *gin.Context) {
         out = append(out, item)
     }
 
-    logrus.Infof("ListSaccos: returned %d saccos", len(out))
-    c.JSON(http.StatusOK, gin.H{"data": out})
+    logrus.WithContext(c).Infof("ListSaccos: returned %d of %d saccos", len(out), meta.Total)
+    c.JSON(http.StatusOK, gin.H{"data": out, "pagination": meta})
 }
 
 // UpdateSacco modifies an existing Sacco's details.
@@ -181,27 +231,27 @@ func UpdateSacco(c *gin.Context) {
     saccoIDStr := c.Param("id")
     saccoID, err := strconv.ParseUint(saccoIDStr, 10, 32)
     if err != nil {
-        logrus.WithError(err).Warnf("UpdateSacco: invalid sacco_id '%s'", saccoIDStr)
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Sacco ID format."})
+        logrus.WithContext(c).WithError(err).Warnf("UpdateSacco: invalid sacco_id '%s'", saccoIDStr)
+        apierror.Respond(c, http.StatusBadRequest, "Invalid Sacco ID format.")
         return
     }
 
     var sacco models.Sacco
     if err := config.DB.First(&sacco, uint(saccoID)).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            logrus.WithField("sacco_id", saccoID).Info("UpdateSacco: sacco not found")
-            c.JSON(http.StatusNotFound, gin.H{"error": "Sacco not found."})
+            logrus.WithContext(c).WithField("sacco_id", saccoID).Info("UpdateSacco: sacco not found")
+            apierror.Respond(c, http.StatusNotFound, "Sacco not found.")
         } else {
-            logrus.WithError(err).WithField("sacco_id", saccoID).Error("UpdateSacco: database error")
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error updating Sacco."})
+            logrus.WithContext(c).WithError(err).WithField("sacco_id", saccoID).Error("UpdateSacco: database error")
+            apierror.Respond(c, http.StatusInternalServerError, "Database error updating Sacco.")
         }
         return
     }
 
     var input updateSaccoInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        logrus.WithError(err).Warn("UpdateSacco: invalid request body")
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body."})
+        logrus.WithContext(c).WithError(err).Warn("UpdateSacco: invalid request body")
+        apierror.Respond(c, http.StatusBadRequest, "Invalid request body.")
         return
     }
 
@@ -217,14 +267,18 @@ func UpdateSacco(c *gin.Context) {
     if input.Phone != nil {
         sacco.Phone = *input.Phone
     }
+    if input.Region != nil {
+        sacco.Region = strings.TrimSpace(*input.Region)
+    }
 
     if err := config.DB.Save(&sacco).Error; err != nil {
-        logrus.WithError(err).WithField("sacco_id", saccoID).Error("UpdateSacco: save failed")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sacco."})
+        logrus.WithContext(c).WithError(err).WithField("sacco_id", saccoID).Error("UpdateSacco: save failed")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to update sacco.")
         return
     }
+    principal.Invalidate(sacco.UserID)
 
-    logrus.WithField("sacco_id", saccoID).Info("UpdateSacco: sacco updated successfully")
+    logrus.WithContext(c).WithField("sacco_id", saccoID).Info("UpdateSacco: sacco updated successfully")
     c.JSON(http.StatusOK, gin.H{"message": "Sacco updated successfully", "sacco": sacco})
 }
 
@@ -233,29 +287,30 @@ func DeleteSacco(c *gin.Context) {
     saccoIDStr := c.Param("id")
     saccoID, err := strconv.ParseUint(saccoIDStr, 10, 32)
     if err != nil {
-        logrus.WithError(err).Warnf("DeleteSacco: invalid sacco_id '%s'", saccoIDStr)
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Sacco ID format."})
+        logrus.WithContext(c).WithError(err).Warnf("DeleteSacco: invalid sacco_id '%s'", saccoIDStr)
+        apierror.Respond(c, http.StatusBadRequest, "Invalid Sacco ID format.")
         return
     }
 
     var sacco models.Sacco
     if err := config.DB.First(&sacco, uint(saccoID)).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            logrus.WithField("sacco_id", saccoID).Info("DeleteSacco: sacco not found")
-            c.JSON(http.StatusNotFound, gin.H{"error": "Sacco not found."})
+            logrus.WithContext(c).WithField("sacco_id", saccoID).Info("DeleteSacco: sacco not found")
+            apierror.Respond(c, http.StatusNotFound, "Sacco not found.")
         } else {
-            logrus.WithError(err).WithField("sacco_id", saccoID).Error("DeleteSacco: database error fetching Sacco for deletion")
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching Sacco for deletion."})
+            logrus.WithContext(c).WithError(err).WithField("sacco_id", saccoID).Error("DeleteSacco: database error fetching Sacco for deletion")
+            apierror.Respond(c, http.StatusInternalServerError, "Database error fetching Sacco for deletion.")
         }
         return
     }
 
     if err := config.DB.Delete(&sacco).Error; err != nil {
-        logrus.WithError(err).WithField("sacco_id", saccoID).Error("DeleteSacco: delete failed")
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sacco."})
+        logrus.WithContext(c).WithError(err).WithField("sacco_id", saccoID).Error("DeleteSacco: delete failed")
+        apierror.Respond(c, http.StatusInternalServerError, "Failed to delete sacco.")
         return
     }
+    principal.Invalidate(sacco.UserID)
 
-    logrus.WithField("sacco_id", saccoID).Info("DeleteSacco: sacco deleted successfully")
+    logrus.WithContext(c).WithField("sacco_id", saccoID).Info("DeleteSacco: sacco deleted successfully")
     c.JSON(http.StatusOK, gin.H{"message": "Sacco deleted successfully."})
 }
\ No newline at end of file
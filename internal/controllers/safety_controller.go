@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/models"
+)
+
+// GetSafetyReport ranks the sacco's drivers by safety score over ?from= to
+// ?to= (default the last 30 days). ?driver_id= limits it to one driver.
+func GetSafetyReport(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetSafetyReport")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+	query := config.Replica().Select("id", "name").Scopes(tenant.SaccoScope)
+	if raw := c.Query("driver_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid driver_id")
+			return
+		}
+		query = query.Where("id = ?", id)
+	}
+	var drivers []models.Driver
+	if err := query.Find(&drivers).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetSafetyReport: Failed to load drivers.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build safety report")
+		return
+	}
+	scores, err := driving.Scores(config.Replica(), drivers, from, to)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetSafetyReport: Failed to compute scores.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build safety report")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": scores, "from": from, "to": to, "min_scored_km": driving.MinScoredKm})
+}
+
+// GetOwnSafetyScore returns the authenticated driver's safety score over
+// ?from= to ?to= (default the last 30 days).
+func GetOwnSafetyScore(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "GetOwnSafetyScore")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+	scores, err := driving.Scores(config.Replica(), []models.Driver{*driver}, from, to)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("GetOwnSafetyScore: Failed to compute score.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to compute safety score")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": scores[0], "from": from, "to": to})
+}
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/tenancy"
+)
+
+// serviceAlertInput is the body of a service alert create or update.
+type serviceAlertInput struct {
+	RouteID  uint       `json:"route_id"` // Omit for a sacco-wide alert
+	StageID  uint       `json:"stage_id"` // Requires route_id
+	Cause    string     `json:"cause" binding:"required"`
+	Severity string     `json:"severity"` // Defaults to medium
+	Title    string     `json:"title" binding:"required"`
+	Body     string     `json:"body"`
+	StartsAt *time.Time `json:"starts_at"` // Defaults to now
+	EndsAt   *time.Time `json:"ends_at"`   // Omit until further notice
+	// Notify pushes the alert to commuters following the route; on by
+	// default when creating, ignored on update.
+	Notify *bool `json:"notify"`
+}
+
+// serviceAlertListOptions are the sorts and filters the service alert
+// listings accept.
+var serviceAlertListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"starts_at":  "starts_at",
+		"created_at": "created_at",
+	},
+	DefaultSort: "-starts_at",
+	Filters: map[string]pagination.Filter{
+		"cause":    pagination.String("cause = ?"),
+		"severity": pagination.String("severity = ?"),
+	},
+}
+
+// inEffect limits a service alert query to alerts in effect at the given
+// time, passed twice.
+const inEffect = "starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)"
+
+// applyServiceAlertInput validates input against the sacco's routes and
+// copies it onto alert, responding 400 and returning false when invalid.
+func applyServiceAlertInput(c *gin.Context, fn string, tenant *tenancy.Tenant, input serviceAlertInput, alert *models.ServiceAlert) bool {
+	switch input.Cause {
+	case models.AlertStrike, models.AlertDiversion, models.AlertFareChange, models.AlertDelay, models.AlertOther:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "cause must be strike, diversion, fare_change, delay or other")
+		return false
+	}
+	if input.Severity == "" {
+		input.Severity = models.SeverityMedium
+	}
+	switch input.Severity {
+	case models.SeverityLow, models.SeverityMedium, models.SeverityHigh:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "severity must be low, medium or high")
+		return false
+	}
+	title := strings.TrimSpace(input.Title)
+	if title == "" || len(title) > 120 {
+		apierror.Respond(c, http.StatusBadRequest, "title must be between 1 and 120 characters")
+		return false
+	}
+	if len(input.Body) > 2000 {
+		apierror.Respond(c, http.StatusBadRequest, "body can be at most 2000 characters")
+		return false
+	}
+	startsAt := time.Now()
+	if input.StartsAt != nil {
+		startsAt = *input.StartsAt
+	} else if alert.ID != 0 {
+		startsAt = alert.StartsAt
+	}
+	if input.EndsAt != nil && !input.EndsAt.After(startsAt) {
+		apierror.Respond(c, http.StatusBadRequest, "ends_at must be after starts_at")
+		return false
+	}
+
+	if input.StageID != 0 && input.RouteID == 0 {
+		apierror.Respond(c, http.StatusBadRequest, "stage_id requires route_id")
+		return false
+	}
+	if input.RouteID != 0 {
+		var route models.Route
+		if err := tenant.Scoped(config.DB).Select("id").First(&route, input.RouteID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				apierror.Respond(c, http.StatusBadRequest, "Route not found")
+			} else {
+				logrus.WithContext(c).WithError(err).WithField("route_id", input.RouteID).Error(fn + ": Failed to load route.")
+				apierror.Respond(c, http.StatusInternalServerError, "Failed to check route")
+			}
+			return false
+		}
+	}
+	if input.StageID != 0 {
+		var onRoute int64
+		if err := config.DB.Model(&models.Stage{}).Where("id = ? AND route_id = ?", input.StageID, input.RouteID).Count(&onRoute).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("stage_id", input.StageID).Error(fn + ": Failed to check stage.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to check stage")
+			return false
+		}
+		if onRoute == 0 {
+			apierror.Respond(c, http.StatusBadRequest, "Stage is not on the route")
+			return false
+		}
+	}
+
+	alert.SaccoID = tenant.SaccoID()
+	alert.RouteID, alert.StageID = input.RouteID, input.StageID
+	alert.Cause, alert.Severity = input.Cause, input.Severity
+	alert.Title, alert.Body = title, strings.TrimSpace(input.Body)
+	alert.StartsAt, alert.EndsAt = startsAt, input.EndsAt
+	return true
+}
+
+// CreateServiceAlert announces a strike, diversion, fare change or other
+// disruption to the sacco's service, sacco-wide or on one route or stage.
+// Unless "notify" is false, commuters who saved the route or are watching
+// it get a push notification.
+func CreateServiceAlert(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "CreateServiceAlert")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var input serviceAlertInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	alert := models.ServiceAlert{CreatedByUserID: authenticatedUserID(c)}
+	if !applyServiceAlertInput(c, "CreateServiceAlert", tenant, input, &alert) {
+		return
+	}
+	if err := config.DB.Create(&alert).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("CreateServiceAlert: Failed to save alert.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create service alert")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"alert_id": alert.ID, "sacco_id": sacco.ID, "route_id": alert.RouteID}).Info("CreateServiceAlert: Service alert created.")
+	if input.Notify == nil || *input.Notify {
+		notifyServiceAlert(alert)
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": alert})
+}
+
+// ListSaccoServiceAlerts returns the sacco's service alerts. ?route_id=
+// limits them to one route, ?active=true to those in effect now.
+func ListSaccoServiceAlerts(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoServiceAlerts")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	query, ok := includeDeleted(c, "ListSaccoServiceAlerts", config.DB.Model(&models.ServiceAlert{}).Scopes(tenant.SaccoScope), sacco.ID)
+	if !ok {
+		return
+	}
+	if raw := c.Query("route_id"); raw != "" {
+		id, err := pagination.ParseUint(raw)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid route_id")
+			return
+		}
+		query = query.Where("route_id = ?", id)
+	}
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where(inEffect, now, now)
+	}
+	var list []models.ServiceAlert
+	meta, ok := paginate(c, "ListSaccoServiceAlerts", query, serviceAlertListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// loadSaccoServiceAlert loads the :id alert if it belongs to the
+// authenticated sacco.
+func loadSaccoServiceAlert(c *gin.Context, fn string) (models.ServiceAlert, *tenancy.Tenant, bool) {
+	alert, ok := loadOwned[models.ServiceAlert](c, fn, "Service alert", config.DB)
+	if !ok {
+		return alert, nil, false
+	}
+	tenant, ok := saccoTenant(c, fn)
+	return alert, tenant, ok
+}
+
+// GetServiceAlert returns one of the sacco's service alerts.
+func GetServiceAlert(c *gin.Context) {
+	alert, _, ok := loadSaccoServiceAlert(c, "GetServiceAlert")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": alert})
+}
+
+// UpdateServiceAlert replaces one of the sacco's service alerts, e.g. to
+// extend it or set ends_at once the disruption is over. starts_at is kept
+// when omitted.
+func UpdateServiceAlert(c *gin.Context) {
+	alert, tenant, ok := loadSaccoServiceAlert(c, "UpdateServiceAlert")
+	if !ok {
+		return
+	}
+	var input serviceAlertInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if !applyServiceAlertInput(c, "UpdateServiceAlert", tenant, input, &alert) {
+		return
+	}
+	if err := config.DB.Save(&alert).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("alert_id", alert.ID).Error("UpdateServiceAlert: Failed to save alert.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update service alert")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": alert})
+}
+
+// DeleteServiceAlert withdraws one of the sacco's service alerts, e.g. one
+// posted by mistake. Alerts that are over should be ended instead.
+func DeleteServiceAlert(c *gin.Context) {
+	alert, _, ok := loadSaccoServiceAlert(c, "DeleteServiceAlert")
+	if !ok {
+		return
+	}
+	if err := config.DB.Delete(&alert).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("alert_id", alert.ID).Error("DeleteServiceAlert: Failed to delete alert.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete service alert")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Service alert deleted successfully"})
+}
+
+// ListServiceAlerts is the commuter disruption feed: service alerts in
+// effect now on published routes, and with ?upcoming=true those announced
+// for later too. ?route_id= limits it to alerts affecting one route,
+// including sacco-wide ones, and ?stage_id= further to one stage of it;
+// ?sacco_id= to one sacco.
+func ListServiceAlerts(c *gin.Context) {
+	now := time.Now()
+	query := config.Replica().Model(&models.ServiceAlert{}).
+		Where("route_id = 0 OR route_id IN (?)", config.Replica().Model(&models.Route{}).Select("id").Where("status = ?", models.RouteStatusPublished))
+	if c.Query("upcoming") == "true" {
+		query = query.Where("ends_at IS NULL OR ends_at > ?", now)
+	} else {
+		query = query.Where(inEffect, now, now)
+	}
+
+	var routeID uint
+	if raw := c.Query("route_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid route_id")
+			return
+		}
+		routeID = uint(id)
+	}
+	if raw := c.Query("stage_id"); raw != "" {
+		id, err := pagination.ParseUint(raw)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid stage_id")
+			return
+		}
+		var stage models.Stage
+		if err := config.DB.Select("id", "route_id").Where("id = ?", id).First(&stage).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				apierror.Respond(c, http.StatusNotFound, "Stage not found")
+			} else {
+				logrus.WithContext(c).WithError(err).WithField("stage_id", id).Error("ListServiceAlerts: Failed to load stage.")
+				apierror.Respond(c, http.StatusInternalServerError, "Failed to list service alerts")
+			}
+			return
+		}
+		if routeID != 0 && routeID != stage.RouteID {
+			apierror.Respond(c, http.StatusBadRequest, "Stage is not on the route")
+			return
+		}
+		routeID = stage.RouteID
+		query = query.Where("stage_id = 0 OR stage_id = ?", stage.ID)
+	}
+	if routeID != 0 {
+		query = query.Where("route_id = ? OR (route_id = 0 AND sacco_id IN (?))", routeID, config.DB.Model(&models.Route{}).Select("sacco_id").Where("id = ?", routeID))
+	}
+	if raw := c.Query("sacco_id"); raw != "" {
+		id, err := pagination.ParseUint(raw)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid sacco_id")
+			return
+		}
+		query = query.Where("sacco_id = ?", id)
+	}
+
+	var list []models.ServiceAlert
+	meta, ok := paginate(c, "ListServiceAlerts", query, serviceAlertListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// activeServiceAlerts returns the service alerts in effect now for each of
+// the routes, sacco-wide alerts of the route's sacco included.
+func activeServiceAlerts(routeIDs []uint) map[uint][]models.ServiceAlert {
+	out := map[uint][]models.ServiceAlert{}
+	if len(routeIDs) == 0 {
+		return out
+	}
+	var routes []models.Route
+	if err := config.DB.Select("id", "sacco_id").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil {
+		logrus.WithError(err).Error("activeServiceAlerts: Failed to load routes.")
+		return out
+	}
+	saccoRoutes := map[uint][]uint{}
+	saccoIDs := make([]uint, 0, len(routes))
+	for _, r := range routes {
+		if len(saccoRoutes[r.SaccoID]) == 0 {
+			saccoIDs = append(saccoIDs, r.SaccoID)
+		}
+		saccoRoutes[r.SaccoID] = append(saccoRoutes[r.SaccoID], r.ID)
+	}
+	now := time.Now()
+	var alerts []models.ServiceAlert
+	if err := config.DB.Where(inEffect, now, now).
+		Where("route_id IN ? OR (route_id = 0 AND sacco_id IN ?)", routeIDs, saccoIDs).
+		Order("starts_at DESC").Find(&alerts).Error; err != nil {
+		logrus.WithError(err).Error("activeServiceAlerts: Failed to load alerts.")
+		return out
+	}
+	for _, a := range alerts {
+		if a.RouteID != 0 {
+			out[a.RouteID] = append(out[a.RouteID], a)
+			continue
+		}
+		for _, id := range saccoRoutes[a.SaccoID] {
+			out[id] = append(out[id], a)
+		}
+	}
+	return out
+}
+
+// attachRouteAlerts adds the service alerts in effect to each route.
+func attachRouteAlerts(routes []RouteResponse) {
+	ids := make([]uint, 0, len(routes))
+	for _, r := range routes {
+		ids = append(ids, r.ID)
+	}
+	alerts := activeServiceAlerts(ids)
+	for i := range routes {
+		routes[i].Alerts = alerts[routes[i].ID]
+	}
+}
+
+// uniqueServiceAlerts returns the service alerts in effect on any of the
+// routes, each once.
+func uniqueServiceAlerts(routeIDs []uint) []models.ServiceAlert {
+	var out []models.ServiceAlert
+	seen := map[uint]bool{}
+	byRoute := activeServiceAlerts(routeIDs)
+	for _, id := range routeIDs {
+		for _, a := range byRoute[id] {
+			if !seen[a.ID] {
+				seen[a.ID] = true
+				out = append(out, a)
+			}
+		}
+	}
+	return out
+}
+
+// notifyServiceAlert pushes a new alert to the commuters who saved an
+// affected route (or the stage, for stage alerts) or have a live watch on
+// one, when a push channel is registered and the alert isn't already over.
+func notifyServiceAlert(alert models.ServiceAlert) {
+	ch, ok := notify.Lookup(notify.PushChannel)
+	if !ok || (alert.EndsAt != nil && !alert.EndsAt.After(time.Now())) {
+		return
+	}
+	go func() {
+		routes := config.DB.Model(&models.Route{}).Select("id").Where("sacco_id = ? AND status = ?", alert.SaccoID, models.RouteStatusPublished)
+		if alert.RouteID != 0 {
+			routes = routes.Where("id = ?", alert.RouteID)
+		}
+		favorites := config.DB.Model(&models.CommuterFavorite{}).Select("user_id").Where("route_id IN (?)", routes)
+		if alert.StageID != 0 {
+			favorites = favorites.Where("stage_id = 0 OR stage_id = ?", alert.StageID)
+		}
+		watches := config.DB.Model(&models.CommuterWatch{}).Select("user_id").
+			Where("route_id IN (?) AND triggered_at IS NULL AND expires_at > ?", routes, time.Now())
+		var userIDs []uint
+		if err := config.DB.Raw("? UNION ?", favorites, watches).Scan(&userIDs).Error; err != nil {
+			logrus.WithError(err).WithField("alert_id", alert.ID).Error("notifyServiceAlert: Failed to load recipients.")
+			return
+		}
+
+		msg := notify.Message{ID: alert.ID, Title: alert.Title, Body: alert.Body, Data: map[string]string{
+			"type":     "service_alert",
+			"alert_id": strconv.FormatUint(uint64(alert.ID), 10),
+			"cause":    alert.Cause,
+		}}
+		if alert.RouteID != 0 {
+			msg.Data["route_id"] = strconv.FormatUint(uint64(alert.RouteID), 10)
+		}
+		for _, id := range userIDs {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			err := ch.Send(ctx, notify.Recipient{UserID: id}, msg)
+			cancel()
+			if err != nil && !errors.Is(err, notify.ErrUnreachable) {
+				logrus.WithError(err).WithFields(logrus.Fields{"alert_id": alert.ID, "user_id": id}).Warn("notifyServiceAlert: Failed to push service alert.")
+			}
+		}
+		if err := config.DB.Model(&alert).Update("notified_at", time.Now()).Error; err != nil {
+			logrus.WithError(err).WithField("alert_id", alert.ID).Warn("notifyServiceAlert: Failed to record notification.")
+		}
+		logrus.WithFields(logrus.Fields{"alert_id": alert.ID, "recipients": len(userIDs)}).Info("notifyServiceAlert: Service alert pushed.")
+	}()
+}
@@ -0,0 +1,509 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/trips"
+	"ma3_tracker/internal/webhooks"
+	"ma3_tracker/internal/wsproto"
+)
+
+var (
+	// sosNotifyChannels are the notify channels (comma-separated) an SOS is
+	// sent on besides the sacco's monitoring WebSockets. Unregistered ones
+	// are skipped.
+	sosNotifyChannels = config.EnvString("SOS_NOTIFY_CHANNELS", "sms,push")
+	// sosNotifyAdmins also sends new SOS alerts to every admin.
+	sosNotifyAdmins = config.EnvBool("SOS_NOTIFY_ADMINS", false)
+	// sosRepeatWindow is how long repeated presses of the panic button fold
+	// into the driver's open alert instead of raising new ones.
+	sosRepeatWindow = config.EnvDuration("SOS_REPEAT_WINDOW", 5*time.Minute)
+)
+
+// sosKinds are the kinds a driver may raise.
+var sosKinds = map[string]bool{
+	models.SOSAccident: true,
+	models.SOSSecurity: true,
+	models.SOSMedical:  true,
+	models.SOSOther:    true,
+}
+
+// sosInput is an SOS raised over REST or as a WebSocket "sos" message. The
+// location is optional; without it the driver's last saved position is used.
+type sosInput struct {
+	Kind      string   `json:"kind"` // Defaults to "other"
+	Note      string   `json:"note" binding:"max=500"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Accuracy  float64  `json:"accuracy"`
+}
+
+// errInvalidSOS wraps input errors that are reported back to the driver.
+var errInvalidSOS = errors.New("invalid SOS")
+
+// raiseSOS records a driver's SOS, or returns their open alert when the
+// button is pressed again within sosRepeatWindow. created is false in the
+// latter case.
+func raiseSOS(driverID uint, in sosInput, now time.Time) (alert models.SOSAlert, created bool, err error) {
+	if in.Kind == "" {
+		in.Kind = models.SOSOther
+	}
+	if !sosKinds[in.Kind] {
+		return alert, false, fmt.Errorf("%w: kind must be accident, security, medical or other", errInvalidSOS)
+	}
+	if len(in.Note) > 500 {
+		return alert, false, fmt.Errorf("%w: note is too long", errInvalidSOS)
+	}
+	if (in.Latitude == nil) != (in.Longitude == nil) {
+		return alert, false, fmt.Errorf("%w: send both latitude and longitude, or neither", errInvalidSOS)
+	}
+	if in.Latitude != nil && (*in.Latitude < -90 || *in.Latitude > 90 || *in.Longitude < -180 || *in.Longitude > 180) {
+		return alert, false, fmt.Errorf("%w: coordinates are out of range", errInvalidSOS)
+	}
+
+	var driver models.Driver
+	if err := config.DB.Select("id", "sacco_id").First(&driver, driverID).Error; err != nil {
+		return alert, false, err
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// Alerts past the window no longer take repeats.
+		if err := tx.Model(&models.SOSAlert{}).Where("repeat_key = ? AND raised_at <= ?", driverID, now.Add(-sosRepeatWindow)).
+			Update("repeat_key", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("repeat_key = ?", driverID).Limit(1).Find(&alert).Error; err != nil || alert.ID != 0 {
+			return err
+		}
+
+		alert = models.SOSAlert{
+			SaccoID:   driver.SaccoID,
+			DriverID:  driverID,
+			Kind:      in.Kind,
+			Note:      strings.TrimSpace(in.Note),
+			Status:    models.SOSRaised,
+			RaisedAt:  now,
+			Accuracy:  in.Accuracy,
+			RepeatKey: &driverID,
+		}
+		var vehicle models.Vehicle
+		if err := tx.Select("id", "route_id").Where("driver_id = ?", driverID).Limit(1).Find(&vehicle).Error; err != nil {
+			return err
+		}
+		alert.VehicleID, alert.RouteID = vehicle.ID, vehicle.RouteID
+		if trip, err := trips.ForDriver(tx, driverID); err != nil {
+			return err
+		} else if trip != nil {
+			alert.TripID, alert.RouteID = trip.ID, trip.RouteID
+		}
+		if in.Latitude != nil {
+			alert.Latitude, alert.Longitude, alert.LocationAt = *in.Latitude, *in.Longitude, &now
+		} else {
+			var last models.LocationHistory
+			if err := tx.Select("latitude", "longitude", "accuracy", "timestamp").Where("driver_id = ?", driverID).
+				Order("timestamp DESC").Limit(1).Find(&last).Error; err != nil {
+				return err
+			}
+			if !last.Timestamp.IsZero() {
+				at := last.Timestamp
+				alert.Latitude, alert.Longitude, alert.Accuracy, alert.LocationAt = last.Latitude, last.Longitude, last.Accuracy, &at
+			}
+		}
+		if err := tx.Create(&alert).Error; err != nil {
+			return err
+		}
+		if err := queueSOSNotifications(tx, alert); err != nil {
+			return err
+		}
+		created = true
+		return webhooks.Publish(tx, alert.SaccoID, models.WebhookSOS, alert)
+	})
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "23505" {
+		// A concurrent press raised the alert first.
+		alert, created = models.SOSAlert{}, false
+		err = config.DB.Where("repeat_key = ?", driverID).First(&alert).Error
+	}
+	if err != nil {
+		return alert, false, err
+	}
+	jobs.Wake(config.DB)
+	return alert, created, nil
+}
+
+// processDriverSOS raises an SOS sent over the driver's WebSocket and
+// acknowledges it on the connection.
+func processDriverSOS(driverConn *websocket.Conn, p []byte, driverID uint) {
+	var in sosInput
+	if err := json.Unmarshal(p, &in); err != nil {
+		writeWSError(driverConn, "Invalid SOS message.")
+		return
+	}
+	alert, created, err := raiseSOS(driverID, in, time.Now())
+	if err != nil {
+		if errors.Is(err, errInvalidSOS) {
+			writeWSError(driverConn, err.Error())
+			return
+		}
+		logrus.WithError(err).WithField("driver_id", driverID).Error("processDriverSOS: Failed to raise SOS.")
+		writeWSError(driverConn, "Failed to raise SOS. Call for help directly.")
+		return
+	}
+	sosRaised(alert, created)
+	writeWS(driverConn, wsproto.TypeAck, gin.H{
+		"type":      "sos",
+		"status":    "sos_raised",
+		"sos_id":    alert.ID,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// RaiseSOS raises an SOS for the authenticated driver.
+// Body: {"kind": "security", "note": "...", "latitude": -1.28, "longitude": 36.82}, all optional.
+func RaiseSOS(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "RaiseSOS")
+	if !ok {
+		return
+	}
+	var in sosInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			apierror.Fail(c, apierror.Invalid(err))
+			return
+		}
+	}
+	alert, created, err := raiseSOS(driver.ID, in, time.Now())
+	if err != nil {
+		if errors.Is(err, errInvalidSOS) {
+			apierror.Respond(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("RaiseSOS: Failed to raise SOS.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to raise SOS. Call for help directly.")
+		return
+	}
+	sosRaised(alert, created)
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"data": alert})
+}
+
+// sosRaised broadcasts a raised alert. Notifications and webhooks for a
+// new one were queued along with it. Repeats are re-broadcast so a
+// monitoring client that missed the first one still sees it.
+func sosRaised(alert models.SOSAlert, created bool) {
+	if created {
+		logrus.WithFields(logrus.Fields{"sos_id": alert.ID, "driver_id": alert.DriverID, "sacco_id": alert.SaccoID, "kind": alert.Kind}).Warn("sosRaised: Driver raised SOS.")
+	}
+	publishSOS(alert)
+}
+
+// publishSOS sends the alert's current state to the sacco's monitoring
+// clients as a high-priority message. Unlike location updates it is never
+// dropped for a full queue.
+func publishSOS(alert models.SOSAlert) {
+	var driver models.Driver
+	config.DB.Select("id", "name", "phone").Limit(1).Find(&driver, alert.DriverID)
+	var vehicleNo string
+	if alert.VehicleID != 0 {
+		config.DB.Model(&models.Vehicle{}).Where("id = ?", alert.VehicleID).Limit(1).Pluck("vehicle_no", &vehicleNo)
+	}
+	msg := map[string]interface{}{
+		"type":         wsproto.TypeSOS,
+		"priority":     wsproto.PriorityHigh,
+		"sacco_id":     float64(alert.SaccoID),
+		"sos_id":       alert.ID,
+		"state":        alert.Status,
+		"kind":         alert.Kind,
+		"note":         alert.Note,
+		"driver_id":    alert.DriverID,
+		"driver_name":  driver.Name,
+		"driver_phone": driver.Phone,
+		"vehicle_id":   alert.VehicleID,
+		"vehicle_no":   vehicleNo,
+		"route_id":     alert.RouteID,
+		"trip_id":      alert.TripID,
+		"raised_at":    alert.RaisedAt.Format(time.RFC3339Nano),
+		"timestamp":    time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if alert.LocationAt != nil {
+		msg["latitude"] = alert.Latitude
+		msg["longitude"] = alert.Longitude
+		msg["accuracy"] = alert.Accuracy
+		msg["location_at"] = alert.LocationAt.Format(time.RFC3339Nano)
+	}
+	if alert.Resolution != "" {
+		msg["resolution"] = alert.Resolution
+	}
+	locationHub.PublishUrgent(msg)
+}
+
+// sosNotifyJob is the job kind that sends one SOS notification.
+const sosNotifyJob = "sos_notify"
+
+// sosNotifyAttempts bounds retries of an SOS notification.
+const sosNotifyAttempts = 8
+
+func init() {
+	jobs.Register(sosNotifyJob, sosNotifyAttempts, runSOSNotify)
+}
+
+// sosNotifyPayload is one notification of an alert: to one user on one
+// channel, so a failed send is retried without repeating the others.
+type sosNotifyPayload struct {
+	SOSID   uint   `json:"sos_id"`
+	Channel string `json:"channel"`
+	UserID  uint   `json:"user_id"`
+}
+
+// queueSOSNotifications queues, with tx, a notification of a new alert on
+// each of sosNotifyChannels to the sacco owner and, with SOS_NOTIFY_ADMINS,
+// to every admin.
+func queueSOSNotifications(tx *gorm.DB, alert models.SOSAlert) error {
+	var channels []string
+	for _, name := range strings.Split(sosNotifyChannels, ",") {
+		if _, ok := notify.Lookup(strings.TrimSpace(name)); ok {
+			channels = append(channels, strings.TrimSpace(name))
+		}
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	var userIDs []uint
+	query := tx.Model(&models.User{}).Where("id IN (?)", tx.Model(&models.Sacco{}).Select("user_id").Where("id = ?", alert.SaccoID))
+	if sosNotifyAdmins {
+		query = query.Or("role = ?", "admin")
+	}
+	if err := query.Pluck("id", &userIDs).Error; err != nil {
+		return err
+	}
+	for _, name := range channels {
+		for _, userID := range userIDs {
+			payload := sosNotifyPayload{SOSID: alert.ID, Channel: name, UserID: userID}
+			if _, err := jobs.Enqueue(tx, sosNotifyJob, payload, jobs.Options{UserID: userID, SaccoID: alert.SaccoID}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runSOSNotify sends one SOS notification. Alerts resolved in the meantime
+// are not sent.
+func runSOSNotify(ctx context.Context, job *models.Job) error {
+	var p sosNotifyPayload
+	if err := jobs.Decode(job, &p); err != nil {
+		return jobs.Permanent(err)
+	}
+	ch, ok := notify.Lookup(p.Channel)
+	if !ok {
+		return jobs.Permanent(fmt.Errorf("notify channel %q is not registered", p.Channel))
+	}
+	var alert models.SOSAlert
+	if err := config.DB.WithContext(ctx).Limit(1).Find(&alert, p.SOSID).Error; err != nil {
+		return err
+	}
+	var user models.User
+	if err := config.DB.WithContext(ctx).Select("id", "phone").Limit(1).Find(&user, p.UserID).Error; err != nil {
+		return err
+	}
+	if alert.ID == 0 || !alert.Open() || user.ID == 0 {
+		return nil
+	}
+
+	var driver models.Driver
+	if err := config.DB.WithContext(ctx).Select("id", "name", "phone").Limit(1).Find(&driver, alert.DriverID).Error; err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Driver %s (%s) raised a %s SOS", driver.Name, driver.Phone, alert.Kind)
+	if alert.LocationAt != nil {
+		body += fmt.Sprintf(" at https://maps.google.com/?q=%.6f,%.6f", alert.Latitude, alert.Longitude)
+	}
+	body += "."
+	if alert.Note != "" {
+		body += " " + alert.Note
+	}
+	msg := notify.Message{ID: alert.ID, Title: "SOS", Body: body, Data: map[string]string{
+		"type":   "sos_alert",
+		"sos_id": strconv.FormatUint(uint64(alert.ID), 10),
+	}}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	err := ch.Send(ctx, notify.Recipient{UserID: user.ID, Phone: user.Phone}, msg)
+	if errors.Is(err, notify.ErrUnreachable) {
+		return nil
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"sos_id": alert.ID, "channel": p.Channel, "user_id": user.ID}).Warn("runSOSNotify: Failed to send SOS notification.")
+	}
+	return err
+}
+
+// sosListOptions are the sorts and filters the SOS listings accept.
+var sosListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"raised_at": "raised_at",
+	},
+	DefaultSort: "-raised_at",
+	Filters: map[string]pagination.Filter{
+		"status":     pagination.String("status = ?"),
+		"kind":       pagination.String("kind = ?"),
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"vehicle_id": pagination.Uint("vehicle_id = ?"),
+	},
+}
+
+// listSOSAlerts responds with a page of the alerts matching query raised
+// between ?from= and ?to= (default the last 30 days). ?open=true limits it
+// to unresolved ones.
+func listSOSAlerts(c *gin.Context, fn string, query *gorm.DB) {
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+	query = query.Model(&models.SOSAlert{}).Where("raised_at >= ? AND raised_at < ?", from, to)
+	if c.Query("open") == "true" {
+		query = query.Where("status <> ?", models.SOSResolved)
+	}
+	var list []models.SOSAlert
+	meta, ok := paginate(c, fn, query, sosListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta, "from": from, "to": to})
+}
+
+// ListSaccoSOSAlerts returns the SOS alerts raised by the sacco's drivers.
+func ListSaccoSOSAlerts(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoSOSAlerts")
+	if !ok {
+		return
+	}
+	listSOSAlerts(c, "ListSaccoSOSAlerts", config.DB.Scopes(tenant.SaccoScope))
+}
+
+// ListSOSAlerts returns SOS alerts across all saccos for admins.
+// Optional filter: ?sacco_id=.
+func ListSOSAlerts(c *gin.Context) {
+	query := config.DB
+	if raw := c.Query("sacco_id"); raw != "" {
+		id, err := pagination.ParseUint(raw)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid sacco_id")
+			return
+		}
+		query = query.Where("sacco_id = ?", id)
+	}
+	listSOSAlerts(c, "ListSOSAlerts", query)
+}
+
+// loadSOSAlert loads the alert named by :id. Sacco users only see their own
+// drivers' alerts; admins see all of them.
+func loadSOSAlert(c *gin.Context, fn string) (models.SOSAlert, bool) {
+	var alert models.SOSAlert
+	id, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return alert, false
+	}
+	tenant, ok := authenticatedTenant(c, fn)
+	if !ok {
+		return alert, false
+	}
+	if err := tenant.Scoped(config.DB).First(&alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "SOS alert not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("sos_id", id).Error(fn + ": Failed to load SOS alert.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load SOS alert")
+		}
+		return alert, false
+	}
+	return alert, true
+}
+
+// AcknowledgeSOS records that someone is responding to a raised alert and
+// lets the sacco's other monitoring clients know.
+func AcknowledgeSOS(c *gin.Context) {
+	alert, ok := loadSOSAlert(c, "AcknowledgeSOS")
+	if !ok {
+		return
+	}
+	now := time.Now()
+	updateSOS(c, "AcknowledgeSOS", alert, []string{models.SOSRaised}, map[string]interface{}{
+		"status":          models.SOSAcknowledged,
+		"acknowledged_at": now,
+		"acknowledged_by": authenticatedUserID(c),
+	})
+}
+
+// ResolveSOS closes an alert. Body: {"resolution": "..."}, optional.
+func ResolveSOS(c *gin.Context) {
+	alert, ok := loadSOSAlert(c, "ResolveSOS")
+	if !ok {
+		return
+	}
+	var input struct {
+		Resolution string `json:"resolution" binding:"max=1000"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			apierror.Fail(c, apierror.Invalid(err))
+			return
+		}
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      models.SOSResolved,
+		"resolved_at": now,
+		"resolved_by": authenticatedUserID(c),
+		"resolution":  strings.TrimSpace(input.Resolution),
+		"repeat_key":  nil,
+	}
+	if alert.AcknowledgedAt == nil {
+		updates["acknowledged_at"] = now
+		updates["acknowledged_by"] = authenticatedUserID(c)
+	}
+	updateSOS(c, "ResolveSOS", alert, []string{models.SOSRaised, models.SOSAcknowledged}, updates)
+}
+
+// updateSOS moves the alert to a new state if it is still in one of from,
+// so two responders cannot both claim it, then broadcasts the change.
+func updateSOS(c *gin.Context, fn string, alert models.SOSAlert, from []string, updates map[string]interface{}) {
+	res := config.DB.Model(&models.SOSAlert{}).Where("id = ? AND status IN ?", alert.ID, from).Updates(updates)
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).WithField("sos_id", alert.ID).Error(fn + ": Failed to update SOS alert.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update SOS alert")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusConflict, "SOS alert is already "+alert.Status)
+		return
+	}
+	if err := config.DB.First(&alert, alert.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sos_id", alert.ID).Error(fn + ": Failed to reload SOS alert.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load SOS alert")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"sos_id": alert.ID, "status": alert.Status, "user_id": authenticatedUserID(c)}).Info(fn + ": SOS alert updated.")
+	publishSOS(alert)
+	c.JSON(http.StatusOK, gin.H{"data": alert})
+}
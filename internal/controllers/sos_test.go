@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+	"ma3_tracker/internal/testdb"
+	"ma3_tracker/internal/wsproto"
+)
+
+// recordingChannel is a notify channel that records what it sends.
+type recordingChannel struct {
+	mu   sync.Mutex
+	sent []notify.Recipient
+}
+
+func (r *recordingChannel) Name() string { return "sos-test" }
+
+func (r *recordingChannel) Send(ctx context.Context, to notify.Recipient, m notify.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, to)
+	return nil
+}
+
+// sosFixture seeds sacco 1, owned by user 1, with driver 1, and sends SOS
+// notifications to a recordingChannel.
+func sosFixture(t *testing.T) (*gorm.DB, *recordingChannel) {
+	t.Helper()
+	db := testdb.Use(t, &models.User{}, &models.Sacco{}, &models.Driver{}, &models.Vehicle{}, &models.Trip{},
+		&models.LocationHistory{}, &models.SOSAlert{}, &models.Job{}, &models.Webhook{}, &models.WebhookDelivery{})
+	for _, r := range []interface{}{
+		&models.User{Model: gorm.Model{ID: 1}, Email: "owner@example.com", Role: "sacco", Phone: "254700000001"},
+		&models.User{Model: gorm.Model{ID: 2}, Email: "driver@example.com", Role: "driver"},
+		&models.Sacco{Model: gorm.Model{ID: 1}, UserID: 1, Name: "A"},
+		&models.Driver{Model: gorm.Model{ID: 1}, UserID: 2, SaccoID: 1, Name: "Driver A"},
+	} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("create %T: %v", r, err)
+		}
+	}
+	ch := &recordingChannel{}
+	notify.Register(ch)
+	prev := sosNotifyChannels
+	sosNotifyChannels = ch.Name()
+	t.Cleanup(func() { sosNotifyChannels = prev })
+	return db, ch
+}
+
+func TestRaiseSOSRepeatsFold(t *testing.T) {
+	db, _ := sosFixture(t)
+	now := time.Now()
+	first, created, err := raiseSOS(1, sosInput{Kind: models.SOSSecurity}, now)
+	if err != nil || !created {
+		t.Fatalf("first press: created %v, err %v", created, err)
+	}
+	again, created, err := raiseSOS(1, sosInput{}, now.Add(time.Minute))
+	if err != nil || created || again.ID != first.ID {
+		t.Fatalf("second press: alert %d, created %v, err %v; want alert %d", again.ID, created, err, first.ID)
+	}
+
+	// The database refuses a second alert taking repeats, whatever the
+	// caller checked.
+	driverID := uint(1)
+	dup := models.SOSAlert{SaccoID: 1, DriverID: 1, Status: models.SOSRaised, RaisedAt: now, RepeatKey: &driverID}
+	if err := db.Create(&dup).Error; err == nil {
+		t.Error("saved a second alert taking the driver's repeats")
+	}
+
+	later, created, err := raiseSOS(1, sosInput{}, now.Add(sosRepeatWindow+time.Second))
+	if err != nil || !created || later.ID == first.ID {
+		t.Fatalf("press after the window: alert %d, created %v, err %v; want a new alert", later.ID, created, err)
+	}
+	var saved models.SOSAlert
+	db.First(&saved, first.ID)
+	if saved.RepeatKey != nil {
+		t.Errorf("alert past the window still takes repeats")
+	}
+}
+
+func TestRaiseSOSQueuesNotifications(t *testing.T) {
+	db, ch := sosFixture(t)
+	alert, _, err := raiseSOS(1, sosInput{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raiseSOS(1, sosInput{}, time.Now())
+
+	var queued []models.Job
+	db.Where("kind = ?", sosNotifyJob).Find(&queued)
+	if len(queued) != 1 || queued[0].UserID != 1 {
+		t.Fatalf("queued %+v; want one notification to the sacco owner", queued)
+	}
+	if err := runSOSNotify(context.Background(), &queued[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.sent) != 1 || ch.sent[0].Phone != "254700000001" {
+		t.Errorf("sent to %+v; want the owner", ch.sent)
+	}
+
+	// Alerts resolved before the job runs are not sent.
+	db.Model(&alert).Update("status", models.SOSResolved)
+	if err := runSOSNotify(context.Background(), &queued[0]); err != nil || len(ch.sent) != 1 {
+		t.Errorf("sent %d notifications for a resolved alert (err %v)", len(ch.sent)-1, err)
+	}
+}
+
+func TestPublishUrgentWaitsForRoom(t *testing.T) {
+	h := &LocationHub{broadcast: make(chan map[string]interface{}, 1)}
+	h.PublishLocation(map[string]interface{}{"type": "location"})
+	h.PublishLocation(map[string]interface{}{"type": "location"}) // Dropped
+
+	done := make(chan struct{})
+	go func() {
+		h.PublishUrgent(map[string]interface{}{"type": wsproto.TypeSOS})
+		close(done)
+	}()
+	if msg := <-h.broadcast; msg["type"] != "location" {
+		t.Fatalf("got %v first, want the location update", msg)
+	}
+	select {
+	case msg := <-h.broadcast:
+		if msg["type"] != wsproto.TypeSOS {
+			t.Fatalf("got %v, want the SOS", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("urgent message was dropped")
+	}
+	<-done
+}
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/mapmatch"
+)
+
+const (
+	defaultProfileSegment = 200.0
+	minProfileSegment     = 50.0
+	maxProfileSegment     = 5000.0
+	maxProfileSegments    = 1000
+	defaultProfileSamples = 5
+)
+
+// Speed levels for coloring a profile, by median moving speed.
+const (
+	speedLevelCrawl    = "crawl"    // Under 10 km/h
+	speedLevelSlow     = "slow"     // Under 20 km/h
+	speedLevelModerate = "moderate" // Under 35 km/h
+	speedLevelFree     = "free"
+)
+
+// speedStats aggregates the points on one stretch of route, overall or in
+// one time-of-day bucket. Speeds are in m/s over moving points only;
+// StoppedPct is the share of points reported standing still.
+type speedStats struct {
+	Hour          *int     `json:"hour,omitempty"` // First hour of the bucket; omitted for the whole day
+	Samples       int64    `json:"samples"`
+	MovingSamples int64    `json:"moving_samples"`
+	AvgSpeed      *float64 `json:"avg_speed"`
+	MedianSpeed   *float64 `json:"median_speed"`
+	P15Speed      *float64 `json:"p15_speed"` // Slowest 15% of moving points are below this
+	StoppedPct    float64  `json:"stopped_pct"`
+	Level         string   `json:"level,omitempty"` // Empty below ?min_samples= moving points
+}
+
+// profileSegment is one stretch of the route with its speeds.
+type profileSegment struct {
+	Index       int          `json:"index"`
+	StartM      float64      `json:"start_m"`
+	EndM        float64      `json:"end_m"`
+	Coordinates [][]float64  `json:"coordinates"` // [lng, lat] pairs
+	Overall     speedStats   `json:"overall"`
+	Buckets     []speedStats `json:"buckets"`
+}
+
+// speedProfileRow is the SQL aggregate for one segment and hour bucket, or
+// for the whole segment when Bucket is nil.
+type speedProfileRow struct {
+	Segment       int
+	Bucket        *int
+	Samples       int64
+	MovingSamples int64
+	AvgSpeed      *float64
+	MedianSpeed   *float64
+	P15Speed      *float64
+}
+
+// GetRouteSpeedProfile shows where a route crawls: the speeds its vehicles
+// reported between ?from= and ?to= (default the last 30 days), binned into
+// ?segment= meter stretches of the route (default 200) and ?bucket_hours=
+// slices of the day (default 1, must divide 24) in the ?tz= time zone.
+// ?days=weekday or weekend limits the days counted. Points within the snap
+// tolerance of the route from vehicles currently assigned to it are used.
+// ?format=geojson returns the segments as LineString features.
+func GetRouteSpeedProfile(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "GetRouteSpeedProfile")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+	segmentM := defaultProfileSegment
+	if raw := c.Query("segment"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < minProfileSegment || v > maxProfileSegment {
+			apierror.Respond(c, http.StatusBadRequest, fmt.Sprintf("segment must be between %.0f and %.0f meters", minProfileSegment, maxProfileSegment))
+			return
+		}
+		segmentM = v
+	}
+	bucketHours, err := strconv.Atoi(c.DefaultQuery("bucket_hours", "1"))
+	if err != nil || bucketHours < 1 || bucketHours > 24 || 24%bucketHours != 0 {
+		apierror.Respond(c, http.StatusBadRequest, "bucket_hours must divide 24, e.g. 1, 2, 3 or 6")
+		return
+	}
+	minSamples, err := strconv.Atoi(c.DefaultQuery("min_samples", strconv.Itoa(defaultProfileSamples)))
+	if err != nil || minSamples < 1 {
+		apierror.Respond(c, http.StatusBadRequest, "min_samples must be a positive number")
+		return
+	}
+	var dayFilter string
+	switch c.DefaultQuery("days", "all") {
+	case "all":
+	case "weekday":
+		dayFilter = " AND EXTRACT(ISODOW FROM lh.timestamp AT TIME ZONE @tz) <= 5"
+	case "weekend":
+		dayFilter = " AND EXTRACT(ISODOW FROM lh.timestamp AT TIME ZONE @tz) > 5"
+	default:
+		apierror.Respond(c, http.StatusBadRequest, "days must be all, weekday or weekend")
+		return
+	}
+	output := strings.ToLower(c.DefaultQuery("format", "json"))
+	if output != "json" && output != "geojson" {
+		apierror.Respond(c, http.StatusBadRequest, "Unsupported format. Use json or geojson.")
+		return
+	}
+
+	line, err := geo.LineFromWKB(route.Geometry)
+	if err != nil {
+		if errors.Is(err, geo.ErrNoGeometry) {
+			apierror.Respond(c, http.StatusUnprocessableEntity, "Route has no geometry")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("GetRouteSpeedProfile: Failed to decode route geometry.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to decode route geometry")
+		}
+		return
+	}
+	length := geo.Length(line)
+	count := int(math.Ceil(length / segmentM))
+	if count > maxProfileSegments {
+		apierror.Respond(c, http.StatusBadRequest, fmt.Sprintf("segment is too short for this route; use at least %.0f meters", math.Ceil(length/maxProfileSegments)))
+		return
+	}
+
+	segments := make([]profileSegment, count)
+	starts := make([]float64, count)
+	for i := range segments {
+		start, end := float64(i)*segmentM, math.Min(float64(i+1)*segmentM, length)
+		starts[i] = start
+		coords := [][]float64{}
+		for _, p := range geo.Cut(line, start, end) {
+			coords = append(coords, []float64{p.Lng, p.Lat})
+		}
+		segments[i] = profileSegment{Index: i, StartM: start, EndM: end, Coordinates: coords, Buckets: []speedStats{}}
+	}
+
+	// Segment boundaries are handed to width_bucket as fractions of the line,
+	// as ST_LineLocatePoint reports them.
+	thresholds := make([]string, count)
+	for i, f := range geo.PlanarFractions(line, starts) {
+		thresholds[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	var rows []speedProfileRow
+	if count > 0 {
+		loc := format.FromRequest(c.Request).Location
+		err = config.DB.Raw(`WITH r AS (SELECT ST_SetSRID(ST_GeomFromWKB(@line), 4326) AS line),
+			pts AS (
+				SELECT lh.speed, lh.is_moving, lh.timestamp,
+					ST_SetSRID(ST_MakePoint(COALESCE(lh.matched_longitude, lh.longitude), COALESCE(lh.matched_latitude, lh.latitude)), 4326) AS pt
+				FROM location_histories lh
+				JOIN vehicles v ON v.id = lh.vehicle_id
+				WHERE v.route_id = @route AND lh.timestamp >= @from AND lh.timestamp < @to
+					AND lh.deleted_at IS NULL AND lh.speed >= 0`+dayFilter+`)
+			SELECT segment, bucket,
+				COUNT(*) AS samples,
+				COUNT(*) FILTER (WHERE is_moving) AS moving_samples,
+				AVG(speed) FILTER (WHERE is_moving) AS avg_speed,
+				percentile_cont(0.5) WITHIN GROUP (ORDER BY speed) FILTER (WHERE is_moving) AS median_speed,
+				percentile_cont(0.15) WITHIN GROUP (ORDER BY speed) FILTER (WHERE is_moving) AS p15_speed
+			FROM (
+				SELECT pts.speed, pts.is_moving,
+					width_bucket(ST_LineLocatePoint(r.line, pts.pt), CAST(@thresholds AS float8[])) - 1 AS segment,
+					FLOOR(EXTRACT(HOUR FROM pts.timestamp AT TIME ZONE @tz) / @hours)::int * @hours AS bucket
+				FROM pts, r
+				WHERE ST_DWithin(pts.pt::geography, r.line::geography, @tolerance)
+			) located
+			GROUP BY GROUPING SETS ((segment, bucket), (segment))`,
+			map[string]interface{}{
+				"line":       route.Geometry,
+				"route":      route.ID,
+				"from":       from,
+				"to":         to,
+				"tz":         loc.String(),
+				"thresholds": "{" + strings.Join(thresholds, ",") + "}",
+				"hours":      bucketHours,
+				"tolerance":  mapmatch.SnapTolerance,
+			}).Scan(&rows).Error
+		if err != nil {
+			logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("GetRouteSpeedProfile: Failed to aggregate speeds.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to build speed profile")
+			return
+		}
+	}
+
+	for _, r := range rows {
+		if r.Segment < 0 || r.Segment >= count {
+			continue
+		}
+		stats := speedStats{
+			Hour:          r.Bucket,
+			Samples:       r.Samples,
+			MovingSamples: r.MovingSamples,
+			AvgSpeed:      r.AvgSpeed,
+			MedianSpeed:   r.MedianSpeed,
+			P15Speed:      r.P15Speed,
+		}
+		if r.Samples > 0 {
+			stats.StoppedPct = 100 * float64(r.Samples-r.MovingSamples) / float64(r.Samples)
+		}
+		if r.MovingSamples >= int64(minSamples) && r.MedianSpeed != nil {
+			stats.Level = speedLevel(*r.MedianSpeed)
+		}
+		s := &segments[r.Segment]
+		if r.Bucket == nil {
+			s.Overall = stats
+		} else {
+			s.Buckets = append(s.Buckets, stats)
+		}
+	}
+	for _, s := range segments {
+		sort.Slice(s.Buckets, func(i, j int) bool { return *s.Buckets[i].Hour < *s.Buckets[j].Hour })
+	}
+
+	if output == "geojson" {
+		features := make([]gin.H, 0, len(segments))
+		for _, s := range segments {
+			features = append(features, gin.H{
+				"type":     "Feature",
+				"geometry": gin.H{"type": "LineString", "coordinates": s.Coordinates},
+				"properties": gin.H{
+					"index":   s.Index,
+					"start_m": s.StartM,
+					"end_m":   s.EndM,
+					"overall": s.Overall,
+					"buckets": s.Buckets,
+				},
+			})
+		}
+		c.Header("Content-Type", "application/geo+json")
+		c.JSON(http.StatusOK, gin.H{"type": "FeatureCollection", "features": features})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"route_id":     route.ID,
+		"length_m":     length,
+		"segment_m":    segmentM,
+		"bucket_hours": bucketHours,
+		"segments":     segments,
+	}, "from": from, "to": to})
+}
+
+// speedLevel classifies a median moving speed in m/s.
+func speedLevel(mps float64) string {
+	switch kmh := mps * 3.6; {
+	case kmh < 10:
+		return speedLevelCrawl
+	case kmh < 20:
+		return speedLevelSlow
+	case kmh < 35:
+		return speedLevelModerate
+	default:
+		return speedLevelFree
+	}
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/models"
+)
+
+// trackSpeeding feeds a fix into speed-violation tracking and alerts the
+// sacco's monitoring clients when a violation starts or ends.
+func trackSpeeding(fix models.LocationHistory, saccoID, routeID uint, limit float64) {
+	alerts, err := driving.TrackSpeed(config.DB, fix, saccoID, routeID, limit)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"driver_id": fix.DriverID, "vehicle_id": fix.VehicleID}).Error("trackSpeeding: Failed to record speed violation.")
+	}
+	for _, a := range alerts {
+		PublishSpeedAlert(a)
+	}
+}
+
+// PublishSpeedAlert broadcasts a speed violation alert to the sacco's monitoring clients.
+func PublishSpeedAlert(a driving.ViolationAlert) {
+	v := a.Violation
+	at := v.StartedAt
+	if v.EndedAt != nil {
+		at = *v.EndedAt
+	}
+	msg := map[string]interface{}{
+		"type":         "speed_violation",
+		"state":        a.State,
+		"sacco_id":     float64(v.SaccoID),
+		"violation_id": v.ID,
+		"speed":        v.MaxSpeed,
+		"limit":        v.Limit,
+		"latitude":     v.Latitude,
+		"longitude":    v.Longitude,
+		"timestamp":    at.Format(time.RFC3339Nano),
+		"started_at":   v.StartedAt.Format(time.RFC3339Nano),
+	}
+	if v.DriverID != 0 {
+		msg["driver_id"] = v.DriverID
+	}
+	if v.VehicleID != 0 {
+		msg["vehicle_id"] = v.VehicleID
+	}
+	locationHub.PublishLocation(msg)
+}
+
+// speedLimitInput sets or clears (null) a speed limit in km/h.
+type speedLimitInput struct {
+	SpeedLimitKmh *float64 `json:"speed_limit_kmh" binding:"omitempty,gt=0,lte=200"`
+}
+
+// GetSpeedLimits returns the general limit, the sacco's limit and the
+// per-route overrides, all in km/h.
+func GetSpeedLimits(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetSpeedLimits")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var routes []models.Route
+	if err := tenant.Scoped(config.DB).Select("id", "name", "speed_limit_kmh").Where("speed_limit_kmh IS NOT NULL").
+		Order("name").Find(&routes).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetSpeedLimits: Failed to load routes.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load speed limits")
+		return
+	}
+	overrides := make([]gin.H, 0, len(routes))
+	for _, r := range routes {
+		overrides = append(overrides, gin.H{"route_id": r.ID, "name": r.Name, "speed_limit_kmh": *r.SpeedLimitKmh})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"default_kmh":     driving.SpeedLimit * 3.6,
+		"speed_limit_kmh": sacco.SpeedLimitKmh,
+		"routes":          overrides,
+	}})
+}
+
+// SetSaccoSpeedLimit sets the speed limit for all of the sacco's vehicles.
+// Body: {"speed_limit_kmh": 80}; null reverts to the general limit.
+func SetSaccoSpeedLimit(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "SetSaccoSpeedLimit")
+	if !ok {
+		return
+	}
+	var input speedLimitInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if err := config.DB.Model(sacco).Update("speed_limit_kmh", input.SpeedLimitKmh).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("SetSaccoSpeedLimit: Failed to save limit.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save speed limit")
+		return
+	}
+	driving.ForgetLimits()
+	c.JSON(http.StatusOK, gin.H{"message": "Speed limit updated", "speed_limit_kmh": input.SpeedLimitKmh})
+}
+
+// SetRouteSpeedLimit sets the speed limit on one of the sacco's routes,
+// overriding the sacco's. Body: {"speed_limit_kmh": 50}; null removes it.
+func SetRouteSpeedLimit(c *gin.Context) {
+	route, _, ok := loadSaccoRoute(c, "SetRouteSpeedLimit")
+	if !ok {
+		return
+	}
+	var input speedLimitInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if err := config.DB.Model(&route).Update("speed_limit_kmh", input.SpeedLimitKmh).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("SetRouteSpeedLimit: Failed to save limit.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save speed limit")
+		return
+	}
+	driving.ForgetLimits()
+	c.JSON(http.StatusOK, gin.H{"message": "Route speed limit updated", "route_id": route.ID, "speed_limit_kmh": input.SpeedLimitKmh})
+}
+
+// listSpeedViolations responds with the violations matching query that
+// started between ?from= and ?to= (default the last 7 days), newest first.
+func listSpeedViolations(c *gin.Context, fn string, query *gorm.DB) {
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	var violations []models.SpeedViolation
+	if err := query.Where("started_at >= ? AND started_at < ?", from, to).Order("started_at DESC").Find(&violations).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error(fn + ": Failed to load speed violations.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load speed violations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": violations, "from": from, "to": to})
+}
+
+// ListSpeedViolations returns the sacco's speed violations. ?driver_id= and
+// ?vehicle_id= narrow it down.
+func ListSpeedViolations(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSpeedViolations")
+	if !ok {
+		return
+	}
+	query := config.DB.Scopes(tenant.SaccoScope)
+	for _, name := range []string{"driver_id", "vehicle_id"} {
+		if raw := c.Query(name); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+				return
+			}
+			query = query.Where(name+" = ?", id)
+		}
+	}
+	listSpeedViolations(c, "ListSpeedViolations", query)
+}
+
+// ListOwnSpeedViolations returns the authenticated driver's speed violations.
+func ListOwnSpeedViolations(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "ListOwnSpeedViolations")
+	if !ok {
+		return
+	}
+	listSpeedViolations(c, "ListOwnSpeedViolations", config.DB.Where("driver_id = ?", driver.ID))
+}
+
+// GetSpeedViolation returns one of the sacco's speed violations.
+func GetSpeedViolation(c *gin.Context) {
+	v, ok := loadOwned[models.SpeedViolation](c, "GetSpeedViolation", "Speed violation", config.DB)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": v})
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/dwell"
+	"ma3_tracker/internal/middleware"
+)
+
+// stageDwell is one stage's dwell times, with hourly breakdown on request.
+type stageDwell struct {
+	dwell.Stats
+	StageName string        `json:"stage_name"`
+	Seq       int           `json:"seq"`
+	RouteID   uint          `json:"route_id"`
+	RouteName string        `json:"route_name"`
+	Hours     []dwell.Stats `json:"hours,omitempty"`
+}
+
+// GetStageDwellReport ranks the stages of the sacco's routes by how long
+// vehicles stand there, longest 90th percentile first, to find bottleneck
+// termini. It covers departures between ?from= and ?to= (default the last
+// 30 days), optionally for one ?route_id= or ?stage_id=; ?by_hour=true adds
+// each stage's figures per hour of the day in the ?tz= time zone.
+func GetStageDwellReport(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "GetStageDwellReport")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+	byHour := c.Query("by_hour") == "true"
+	scope := config.Replica().Scopes(tenant.SaccoScope)
+	for _, name := range []string{"route_id", "stage_id"} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		scope = scope.Where(name+" = ?", id)
+	}
+
+	loc := middleware.FormatPreferences(c).Location
+	stats, err := dwell.Report(config.Replica(), scope, from, to, loc, byHour)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetStageDwellReport: Failed to aggregate dwell times.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to build dwell report")
+		return
+	}
+
+	byStage := map[uint]*stageDwell{}
+	var stageIDs []uint
+	for _, s := range stats {
+		if s.Hour != nil {
+			continue
+		}
+		byStage[s.StageID] = &stageDwell{Stats: s}
+		stageIDs = append(stageIDs, s.StageID)
+	}
+	for _, s := range stats {
+		if d := byStage[s.StageID]; d != nil && s.Hour != nil {
+			d.Hours = append(d.Hours, s)
+		}
+	}
+	if len(stageIDs) > 0 {
+		var names []struct {
+			ID        uint
+			Name      string
+			Seq       int
+			RouteID   uint
+			RouteName string
+		}
+		err := config.Replica().Table("stages").
+			Select("stages.id, stages.name, stages.seq, stages.route_id, routes.name AS route_name").
+			Joins("LEFT JOIN routes ON routes.id = stages.route_id").
+			Where("stages.id IN ?", stageIDs).
+			Scan(&names).Error
+		if err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("GetStageDwellReport: Failed to load stages.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to build dwell report")
+			return
+		}
+		for _, n := range names {
+			d := byStage[n.ID]
+			d.StageName, d.Seq, d.RouteID, d.RouteName = n.Name, n.Seq, n.RouteID, n.RouteName
+		}
+	}
+
+	out := make([]*stageDwell, 0, len(stageIDs))
+	for _, id := range stageIDs {
+		d := byStage[id]
+		sort.Slice(d.Hours, func(i, j int) bool { return *d.Hours[i].Hour < *d.Hours[j].Hour })
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].P90S > out[j].P90S })
+	c.JSON(http.StatusOK, gin.H{"data": out, "from": from, "to": to, "max_dwell_s": dwell.MaxDwell.Seconds()})
+}
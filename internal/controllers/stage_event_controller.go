@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geofence"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+// trackStages feeds a fix into stage geofencing and broadcasts the arrivals
+// and departures it caused.
+func trackStages(fix models.LocationHistory, saccoID, routeID uint) {
+	events, err := geofence.Track(config.DB, fix, saccoID, routeID)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"vehicle_id": fix.VehicleID, "route_id": routeID}).Error("trackStages: Failed to record stage events.")
+	}
+	for _, e := range events {
+		publishStageEvent(e)
+	}
+}
+
+// publishStageEvent broadcasts a stage arrival or departure to the sacco's
+// monitoring clients and to the vehicle's and route's followers.
+func publishStageEvent(e models.StageEvent) {
+	msg := map[string]interface{}{
+		"type":       "stage_" + e.Kind,
+		"sacco_id":   float64(e.SaccoID),
+		"vehicle_id": e.VehicleID,
+		"route_id":   e.RouteID,
+		"stage_id":   e.StageID,
+		"event_id":   e.ID,
+		"latitude":   e.Latitude,
+		"longitude":  e.Longitude,
+		"distance":   e.DistanceM,
+		"timestamp":  e.At.Format(time.RFC3339Nano),
+	}
+	if e.Stage != nil {
+		msg["stage_name"] = e.Stage.Name
+		msg["stage_seq"] = e.Stage.Seq
+	}
+	if e.DriverID != 0 {
+		msg["driver_id"] = e.DriverID
+	}
+	if e.Kind == models.StageDeparture {
+		msg["dwell_seconds"] = e.DwellSeconds
+	}
+	locationHub.PublishLocation(msg)
+}
+
+// stageEventListOptions are the sorts and filters ListStageEvents accepts.
+var stageEventListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"at":    "at",
+		"dwell": "dwell_seconds",
+	},
+	DefaultSort: "-at",
+	Filters: map[string]pagination.Filter{
+		"route_id":   pagination.Uint("route_id = ?"),
+		"stage_id":   pagination.Uint("stage_id = ?"),
+		"vehicle_id": pagination.Uint("vehicle_id = ?"),
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"kind":       pagination.String("kind = ?"),
+	},
+}
+
+// ListStageEvents returns the sacco's stage arrivals and departures between
+// ?from= and ?to= (default the last 24 hours), newest first, for punctuality
+// analysis. See stageEventListOptions for filters.
+func ListStageEvents(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListStageEvents")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	query := config.DB.Model(&models.StageEvent{}).Scopes(tenant.SaccoScope).Where("at >= ? AND at < ?", from, to)
+	var events []models.StageEvent
+	meta, ok := paginate(c, "ListStageEvents", query, stageEventListOptions, &events, "Stage")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": events, "pagination": meta, "from": from, "to": to})
+}
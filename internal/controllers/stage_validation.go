@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// maxStageOffsetMeters is how far a stage may sit from its route's line.
+var maxStageOffsetMeters = config.EnvFloat("STAGE_MAX_OFFSET_METERS", 150)
+
+// stageViolation describes a stage that is too far from the route geometry.
+type stageViolation struct {
+	Index        int       `json:"index"`
+	Name         string    `json:"name"`
+	DistanceM    float64   `json:"distance_m"`
+	MaxDistanceM float64   `json:"max_distance_m"`
+	Nearest      geo.Point `json:"nearest"`
+	RouteID      uint      `json:"route_id,omitempty"` // Set when a stop move is checked
+	StageID      uint      `json:"stage_id,omitempty"`
+}
+
+// checkStagesOnRoute validates stages against the route geometry. When snap is
+// true, offending stages are moved onto the nearest point of the line instead
+// of being reported. Routes without geometry are not checked.
+func checkStagesOnRoute(geometry []byte, stages []models.Stage, snap bool) ([]stageViolation, error) {
+	if len(geometry) == 0 || len(stages) == 0 {
+		return nil, nil
+	}
+	line, err := geo.LineFromWKB(geometry)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	var violations []stageViolation
+	for i := range stages {
+		nearest, dist := geo.NearestOnLine(geo.Point{Lat: stages[i].Lat, Lng: stages[i].Lng}, line)
+		if dist <= maxStageOffsetMeters {
+			continue
+		}
+		if snap {
+			stages[i].Lat, stages[i].Lng = nearest.Lat, nearest.Lng
+			continue
+		}
+		violations = append(violations, stageViolation{
+			Index:        i,
+			Name:         stages[i].Name,
+			DistanceM:    dist,
+			MaxDistanceM: maxStageOffsetMeters,
+			Nearest:      nearest,
+		})
+	}
+	return violations, nil
+}
+
+// respondStageViolations writes the structured 422 returned for off-route stages.
+func respondStageViolations(c *gin.Context, violations []stageViolation) {
+	apierror.Fail(c, apierror.New(http.StatusUnprocessableEntity,
+		"One or more stages are too far from the route geometry. Move them or retry with ?snap=true.").
+		WithCode("stage_off_route").
+		WithDetail("violations", violations))
+}
+
+// snapRequested reports whether the client asked for stages to be snapped onto the line.
+func snapRequested(c *gin.Context) bool {
+	return c.Query("snap") == "true" || c.Query("snap") == "1"
+}
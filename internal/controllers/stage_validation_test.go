@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// A failure to load the stages must not pass for a route without any, which
+// would let a new geometry skip validation.
+func TestUpdateRouteGeometryStageLoadFailure(t *testing.T) {
+	r := twoSaccos(t, 1, "sacco")
+	line, _ := geo.LineToWKB([]geo.Point{{Lat: -1.28, Lng: 36.82}, {Lat: -1.28, Lng: 36.83}})
+	if err := config.DB.Create(&models.Route{Model: gorm.Model{ID: 1}, SaccoID: 1, Name: "CBD - Westlands", Geometry: line}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := config.DB.Migrator().DropTable(&models.Stage{}); err != nil {
+		t.Fatal(err)
+	}
+	r.PUT("/sacco/routes/:id", UpdateRoute)
+
+	body := `{"geometry": "{\"type\":\"LineString\",\"coordinates\":[[36.9,-1.2],[36.91,-1.2]]}"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/sacco/routes/1", bytes.NewBufferString(body)))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d; want 500", w.Code)
+	}
+	var route models.Route
+	config.DB.First(&route, 1)
+	if !bytes.Equal(route.Geometry, line) {
+		t.Error("geometry was replaced without validating the stages")
+	}
+}
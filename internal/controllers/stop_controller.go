@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/crowding"
+	"ma3_tracker/internal/dwell"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/stops"
+)
+
+const (
+	defaultStopSearchRadius = 500.0
+	maxStopSearchRadius     = 5000.0
+)
+
+// stopResponse is a shared stop with the published routes that serve it.
+type stopResponse struct {
+	ID        uint             `json:"id"`
+	Name      string           `json:"name"`
+	Lat       float64          `json:"lat"`
+	Lng       float64          `json:"lng"`
+	DistanceM *float64         `json:"distance_m,omitempty"`
+	Routes    []stopRouteEntry `json:"routes"`
+	Crowding  *crowding.Index  `json:"crowding,omitempty"`
+}
+
+type stopRouteEntry struct {
+	RouteID   uint   `json:"route_id"`
+	RouteName string `json:"route_name"`
+	SaccoID   uint   `json:"sacco_id"`
+	StageID   uint   `json:"stage_id"`
+	Seq       int    `json:"seq"`
+	// TypicalWait is how long vehicles on this route usually stand here.
+	TypicalWait *dwell.Typical `json:"typical_wait,omitempty"`
+}
+
+// ListStops returns shared stops near ?lat=&lng= (within ?radius= meters) or
+// matching ?q= by name.
+func ListStops(c *gin.Context) {
+	query := config.Replica().Model(&models.Stop{})
+	var origin *geo.Point
+	radius := defaultStopSearchRadius
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+		if errLat != nil || errLng != nil {
+			apierror.Respond(c, http.StatusBadRequest, "lat and lng must both be numbers")
+			return
+		}
+		if r, err := strconv.ParseFloat(c.Query("radius"), 64); err == nil && r > 0 {
+			radius = math.Min(r, maxStopSearchRadius)
+		}
+		dLat := radius / geo.EarthRadius * 180 / math.Pi
+		dLng := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+		query = query.Where("lat BETWEEN ? AND ? AND lng BETWEEN ? AND ?", lat-dLat, lat+dLat, lng-dLng, lng+dLng)
+		origin = &geo.Point{Lat: lat, Lng: lng}
+	} else if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where("name ILIKE ?", "%"+q+"%").Limit(50)
+	} else {
+		apierror.Respond(c, http.StatusBadRequest, "Provide lat and lng, or q")
+		return
+	}
+
+	var found []models.Stop
+	if err := query.Find(&found).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListStops: Failed to query stops.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch stops")
+		return
+	}
+
+	out := make([]stopResponse, 0, len(found))
+	for _, s := range found {
+		resp := stopResponse{ID: s.ID, Name: s.Name, Lat: s.Lat, Lng: s.Lng}
+		if origin != nil {
+			d := geo.Haversine(*origin, geo.Point{Lat: s.Lat, Lng: s.Lng})
+			if d > radius {
+				continue
+			}
+			resp.DistanceM = &d
+		}
+		out = append(out, resp)
+	}
+	if origin != nil {
+		sort.Slice(out, func(i, j int) bool { return *out[i].DistanceM < *out[j].DistanceM })
+	}
+	attachStopRoutes(out)
+	attachStopCrowding(out)
+	attachStopDwell(out, middleware.FormatPreferences(c).Location)
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// GetStop returns one shared stop with the published routes serving it.
+func GetStop(c *gin.Context) {
+	stop, ok := loadStop(c, "GetStop", "id")
+	if !ok {
+		return
+	}
+	out := []stopResponse{{ID: stop.ID, Name: stop.Name, Lat: stop.Lat, Lng: stop.Lng}}
+	attachStopRoutes(out)
+	attachStopCrowding(out)
+	attachStopDwell(out, middleware.FormatPreferences(c).Location)
+	c.JSON(http.StatusOK, gin.H{"data": out[0]})
+}
+
+// UpdateStop lets an admin rename or move a shared stop; every route stage
+// referencing it follows. A move that takes a stage further than
+// STAGE_MAX_OFFSET_METERS from its route's line is refused with the 422 the
+// route endpoints return; a shared stop cannot be snapped onto every line.
+func UpdateStop(c *gin.Context) {
+	stop, ok := loadStop(c, "UpdateStop", "id")
+	if !ok {
+		return
+	}
+	var input struct {
+		Name      *string               `json:"name"`
+		Lat       *float64              `json:"lat"`
+		Lng       *float64              `json:"lng"`
+		Amenities *models.StopAmenities `json:"amenities"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+
+	var violations []stageViolation
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Name != nil {
+			stop.Name = strings.TrimSpace(*input.Name)
+		}
+		if input.Amenities != nil {
+			stop.Amenities = *input.Amenities
+		}
+		lat, lng := stop.Lat, stop.Lng
+		if input.Lat != nil {
+			lat = *input.Lat
+		}
+		if input.Lng != nil {
+			lng = *input.Lng
+		}
+		if lat != stop.Lat || lng != stop.Lng {
+			var err error
+			if violations, err = checkStopOnRoutes(tx, stop.ID, lat, lng); err != nil || len(violations) > 0 {
+				return err
+			}
+		}
+		return stops.Move(tx, &stop, lat, lng)
+	})
+	if len(violations) > 0 {
+		respondStageViolations(c, violations)
+		return
+	}
+	if errors.Is(err, stops.ErrDuplicate) {
+		apierror.Respond(c, http.StatusConflict, "Another stop with this name is already there; merge them instead")
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("stop_id", stop.ID).Error("UpdateStop: Failed to update stop.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update stop")
+		return
+	}
+	logrus.WithContext(c).WithField("stop_id", stop.ID).Info("UpdateStop: Stop updated.")
+	c.JSON(http.StatusOK, gin.H{"data": stop})
+}
+
+// MergeStop folds the stop named by :id into {"into_stop_id"} and deletes it.
+// Its stages move to the target, so the merge is refused with a 422 when that
+// takes one too far from its route's line.
+func MergeStop(c *gin.Context) {
+	duplicate, ok := loadStop(c, "MergeStop", "id")
+	if !ok {
+		return
+	}
+	var input struct {
+		IntoStopID uint `json:"into_stop_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.IntoStopID == duplicate.ID {
+		apierror.Respond(c, http.StatusBadRequest, "Cannot merge a stop into itself")
+		return
+	}
+	var target models.Stop
+	if err := config.DB.First(&target, input.IntoStopID).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "Target stop not found")
+		return
+	}
+	var violations []stageViolation
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if violations, err = checkStopOnRoutes(tx, duplicate.ID, target.Lat, target.Lng); err != nil || len(violations) > 0 {
+			return err
+		}
+		return stops.Merge(tx, target, duplicate)
+	})
+	if len(violations) > 0 {
+		respondStageViolations(c, violations)
+		return
+	}
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithFields(logrus.Fields{"stop_id": duplicate.ID, "into": target.ID}).Error("MergeStop: Failed to merge stops.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to merge stops")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"stop_id": duplicate.ID, "into": target.ID}).Info("MergeStop: Stops merged.")
+	c.JSON(http.StatusOK, gin.H{"data": target})
+}
+
+// checkStopOnRoutes checks the stages referencing a stop against their
+// routes' lines as if the stop were at (lat, lng). Violations carry the route
+// and stage, with the stage's seq as the index.
+func checkStopOnRoutes(tx *gorm.DB, stopID uint, lat, lng float64) ([]stageViolation, error) {
+	var rows []struct {
+		StageID  uint
+		RouteID  uint
+		Seq      int
+		Name     string
+		Geometry []byte
+	}
+	if err := tx.Table("stages").
+		Select("stages.id AS stage_id, stages.route_id, stages.seq, stages.name, routes.geometry").
+		Joins("JOIN routes ON routes.id = stages.route_id AND routes.deleted_at IS NULL").
+		Where("stages.stop_id = ? AND stages.deleted_at IS NULL", stopID).
+		Order("stages.route_id, stages.seq").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	var out []stageViolation
+	for _, row := range rows {
+		violations, err := checkStagesOnRoute(row.Geometry, []models.Stage{{Name: row.Name, Lat: lat, Lng: lng}}, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range violations {
+			v.Index, v.RouteID, v.StageID = row.Seq, row.RouteID, row.StageID
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func loadStop(c *gin.Context, fn, param string) (models.Stop, bool) {
+	var stop models.Stop
+	id, ok := parseUintParam(c, param, fn)
+	if !ok {
+		return stop, false
+	}
+	if err := config.DB.First(&stop, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Stop not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("stop_id", id).Error(fn + ": Failed to fetch stop.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch stop")
+		}
+		return stop, false
+	}
+	return stop, true
+}
+
+// attachStopRoutes fills in the published routes serving each stop.
+func attachStopRoutes(out []stopResponse) {
+	if len(out) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(out))
+	index := make(map[uint]int, len(out))
+	for i := range out {
+		ids = append(ids, out[i].ID)
+		index[out[i].ID] = i
+		out[i].Routes = []stopRouteEntry{}
+	}
+	var rows []struct {
+		StopID    uint
+		RouteID   uint
+		RouteName string
+		SaccoID   uint
+		StageID   uint
+		Seq       int
+	}
+	err := config.Replica().Table("stages").
+		Select("stages.stop_id, stages.route_id, routes.name AS route_name, routes.sacco_id, stages.id AS stage_id, stages.seq").
+		Joins("JOIN routes ON routes.id = stages.route_id AND routes.deleted_at IS NULL").
+		Where("stages.stop_id IN ? AND stages.deleted_at IS NULL AND routes.status = ?", ids, models.RouteStatusPublished).
+		Order("routes.name").Scan(&rows).Error
+	if err != nil {
+		logrus.WithError(err).Warn("attachStopRoutes: Failed to load routes for stops.")
+		return
+	}
+	for _, r := range rows {
+		i := index[r.StopID]
+		out[i].Routes = append(out[i].Routes, stopRouteEntry{RouteID: r.RouteID, RouteName: r.RouteName, SaccoID: r.SaccoID, StageID: r.StageID, Seq: r.Seq})
+	}
+}
+
+// attachStopDwell adds the typical wait at each route's stage, for stops
+// whose routes were attached by attachStopRoutes.
+func attachStopDwell(out []stopResponse, loc *time.Location) {
+	var stageIDs []uint
+	for _, s := range out {
+		for _, r := range s.Routes {
+			stageIDs = append(stageIDs, r.StageID)
+		}
+	}
+	typical, err := dwell.ForStages(config.Replica(), stageIDs, time.Now(), loc)
+	if err != nil {
+		logrus.WithError(err).Warn("attachStopDwell: Failed to compute dwell times.")
+		return
+	}
+	for i := range out {
+		for j := range out[i].Routes {
+			if t, ok := typical[out[i].Routes[j].StageID]; ok {
+				out[i].Routes[j].TypicalWait = &t
+			}
+		}
+	}
+}
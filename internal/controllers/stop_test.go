@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// A shared stop moved off a route's line would drag the route's stage with
+// it; UpdateStop and MergeStop check it as the route endpoints do.
+func TestStopMovesCheckedAgainstRoutes(t *testing.T) {
+	db := testdb.Use(t, &models.Route{}, &models.Stage{}, &models.Stop{})
+	line, _ := geo.LineToWKB([]geo.Point{{Lat: -1.28, Lng: 36.82}, {Lat: -1.28, Lng: 36.83}})
+	rows := []interface{}{
+		&models.Route{Model: gorm.Model{ID: 1}, SaccoID: 1, Name: "CBD - Westlands", Geometry: line},
+		&models.Stop{Model: gorm.Model{ID: 1}, Name: "Kencom", Lat: -1.28, Lng: 36.825},
+		&models.Stop{Model: gorm.Model{ID: 2}, Name: "Far", Lat: -1.29, Lng: 36.825},
+		&models.Stage{Model: gorm.Model{ID: 1}, RouteID: 1, StopID: 1, Seq: 1, Name: "Kencom", Lat: -1.28, Lng: 36.825},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/stops/:id", UpdateStop)
+	r.POST("/stops/:id/merge", MergeStop)
+	call := func(method, path, body string) (int, string, []stageViolation) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Details struct {
+					Violations []stageViolation `json:"violations"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Error.Code, resp.Error.Details.Violations
+	}
+
+	code, errCode, violations := call(http.MethodPut, "/stops/1", `{"lat": -1.29}`)
+	if code != http.StatusUnprocessableEntity || errCode != "stage_off_route" || len(violations) != 1 || violations[0].RouteID != 1 || violations[0].StageID != 1 {
+		t.Errorf("move off the line: %d %q %+v; want 422 naming route 1's stage 1", code, errCode, violations)
+	}
+	var stage models.Stage
+	db.First(&stage, 1)
+	if stage.Lat != -1.28 {
+		t.Errorf("stage moved to %v after a refused move", stage.Lat)
+	}
+	if code, _, _ := call(http.MethodPut, "/stops/1", `{"lat": -1.2801}`); code != http.StatusOK {
+		t.Errorf("move along the line: %d; want 200", code)
+	}
+
+	if code, errCode, _ := call(http.MethodPost, "/stops/1/merge", `{"into_stop_id": 2}`); code != http.StatusUnprocessableEntity || errCode != "stage_off_route" {
+		t.Errorf("merge off the line: %d %q; want 422", code, errCode)
+	}
+}
+
+func TestReportStopCrowdingNeedsLocation(t *testing.T) {
+	db := testdb.Use(t, &models.User{}, &models.Stop{}, &models.StopCrowdingReport{})
+	db.Create(&models.User{Model: gorm.Model{ID: 1}, Email: "c@example.com", Role: "commuter"})
+	db.Create(&models.Stop{Model: gorm.Model{ID: 1}, Name: "Kencom", Lat: -1.28, Lng: 36.825})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", float64(1)) })
+	r.POST("/stops/:id/crowding", ReportStopCrowding)
+	for body, want := range map[string]int{
+		`{"level": 3}`: http.StatusBadRequest,
+		`{"level": 3, "lat": -1.30, "lng": 36.825}`:  http.StatusUnprocessableEntity,
+		`{"level": 3, "lat": -1.28, "lng": 36.8251}`: http.StatusCreated,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/stops/1/crowding", strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("%s: status %d; want %d", body, w.Code, want)
+		}
+	}
+}
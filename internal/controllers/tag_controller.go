@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// maxTagsPerRoute keeps tag lists short enough to show on a route card.
+const maxTagsPerRoute = 10
+
+// tagSlug normalises a tag name ("Night Service" -> "night-service"). It
+// returns "" for names without any letters or digits.
+func tagSlug(name string) string {
+	if strings.IndexFunc(name, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+	}) < 0 {
+		return ""
+	}
+	return slugify(name)
+}
+
+// parseTagsQuery reads ?tags=express,cbd into slugs.
+func parseTagsQuery(c *gin.Context) []string {
+	slugs := []string{}
+	for _, t := range strings.Split(c.Query("tags"), ",") {
+		if s := tagSlug(t); s != "" {
+			slugs = append(slugs, s)
+		}
+	}
+	return slugs
+}
+
+// withAllTags restricts a routes query to routes carrying every slug.
+func withAllTags(query *gorm.DB, slugs []string) *gorm.DB {
+	if len(slugs) == 0 {
+		return query
+	}
+	return query.Where("routes.id IN (?)", config.DB.Table("route_tags").
+		Select("route_tags.route_id").
+		Joins("JOIN tags ON tags.id = route_tags.tag_id").
+		Where("tags.slug IN ?", slugs).
+		Group("route_tags.route_id").
+		Having("COUNT(DISTINCT tags.slug) = ?", len(slugs)))
+}
+
+// routeTagFilterSQL is the raw-SQL equivalent of withAllTags for queries that
+// alias routes as r. param is the placeholder bound to a text[] of slugs; an
+// empty array matches every route.
+func routeTagFilterSQL(param string) string {
+	return `(cardinality(` + param + `::text[]) = 0 OR r.id IN (
+				SELECT rt.route_id FROM route_tags rt JOIN tags t ON t.id = rt.tag_id
+				WHERE t.slug = ANY(` + param + `::text[])
+				GROUP BY rt.route_id
+				HAVING COUNT(DISTINCT t.slug) = cardinality(` + param + `::text[])))`
+}
+
+// findOrCreateTags resolves names to tags, creating sacco-owned tags for
+// unknown slugs.
+func findOrCreateTags(tx *gorm.DB, names []string, saccoID uint) ([]models.Tag, error) {
+	seen := make(map[string]bool)
+	var tags []models.Tag
+	for _, name := range names {
+		slug := tagSlug(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tag := models.Tag{Name: strings.TrimSpace(name), Slug: slug, CreatedBySaccoID: &saccoID}
+		if err := tx.Where(models.Tag{Slug: slug}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// SetRouteTags replaces the tags on one of the sacco's routes.
+func SetRouteTags(c *gin.Context) {
+	route, sacco, ok := loadSaccoRoute(c, "SetRouteTags")
+	if !ok {
+		return
+	}
+	var input struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if len(input.Tags) > maxTagsPerRoute {
+		apierror.Respond(c, http.StatusBadRequest, "A route can have at most 10 tags")
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		tags, err := findOrCreateTags(tx, input.Tags, sacco.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&route).Association("Tags").Replace(tags)
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("route_id", route.ID).Error("SetRouteTags: Failed to save tags.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save tags")
+		return
+	}
+	config.DB.Preload("Tags").First(&route, route.ID)
+	logrus.WithContext(c).WithFields(logrus.Fields{"route_id": route.ID, "tags": len(route.Tags)}).Info("SetRouteTags: Route tags updated.")
+	c.JSON(http.StatusOK, gin.H{"data": route.Tags})
+}
+
+// ListTags returns canonical tags plus any tag used by a published route,
+// with the number of published routes carrying each.
+func ListTags(c *gin.Context) {
+	var rows []struct {
+		models.Tag
+		RouteCount int `json:"route_count"`
+	}
+	err := config.DB.Model(&models.Tag{}).
+		Select("tags.*, COUNT(routes.id) AS route_count").
+		Joins("LEFT JOIN route_tags ON route_tags.tag_id = tags.id").
+		Joins("LEFT JOIN routes ON routes.id = route_tags.route_id AND routes.status = ? AND routes.deleted_at IS NULL", models.RouteStatusPublished).
+		Group("tags.id").
+		Having("tags.canonical OR COUNT(routes.id) > 0").
+		Order("tags.canonical DESC, route_count DESC, tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListTags: Failed to list tags.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to list tags")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+// CreateCanonicalTag lets an admin add a curated tag, or promote an existing
+// sacco tag with the same slug.
+func CreateCanonicalTag(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	slug := tagSlug(input.Name)
+	if slug == "" {
+		apierror.Respond(c, http.StatusBadRequest, "Tag name must contain letters or digits")
+		return
+	}
+	tag := models.Tag{Name: strings.TrimSpace(input.Name), Slug: slug}
+	if err := config.DB.Where(models.Tag{Slug: slug}).FirstOrCreate(&tag).Error; err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateCanonicalTag: Failed to create tag.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create tag")
+		return
+	}
+	if err := config.DB.Model(&tag).Updates(map[string]interface{}{"name": strings.TrimSpace(input.Name), "canonical": true}).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("tag_id", tag.ID).Error("CreateCanonicalTag: Failed to mark tag canonical.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create tag")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": tag})
+}
+
+// MergeTag folds the tag named by :id into {"into_tag_id"}, moving its routes.
+func MergeTag(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "MergeTag")
+	if !ok {
+		return
+	}
+	var input struct {
+		IntoTagID uint `json:"into_tag_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if input.IntoTagID == id {
+		apierror.Respond(c, http.StatusBadRequest, "Cannot merge a tag into itself")
+		return
+	}
+	var source, target models.Tag
+	if err := config.DB.First(&source, id).Error; err != nil {
+		respondTagLookupError(c, err)
+		return
+	}
+	if err := config.DB.First(&target, input.IntoTagID).Error; err != nil {
+		respondTagLookupError(c, err)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Skip routes that already carry the target to respect the join table's key.
+		if err := tx.Exec(`INSERT INTO route_tags (route_id, tag_id)
+			SELECT route_id, ? FROM route_tags WHERE tag_id = ?
+			ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM route_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&source).Error
+	})
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithFields(logrus.Fields{"tag_id": source.ID, "into": target.ID}).Error("MergeTag: Failed to merge tags.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to merge tags")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": target})
+}
+
+func respondTagLookupError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Respond(c, http.StatusNotFound, "Tag not found")
+		return
+	}
+	logrus.WithContext(c).WithError(err).Error("respondTagLookupError: Failed to fetch tag.")
+	apierror.Respond(c, http.StatusInternalServerError, "Failed to fetch tag")
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/testdb"
+)
+
+// twoSaccos seeds saccos 1 and 2, owned by users 1 and 2, with a driver and
+// a vehicle each, and admin user 3. It returns a router serving the sacco
+// listings to the user with the given ID and role.
+func twoSaccos(t *testing.T, userID uint, role string) *gin.Engine {
+	t.Helper()
+	db := testdb.Use(t, &models.User{}, &models.Sacco{}, &models.Driver{}, &models.Vehicle{}, &models.Route{}, &models.Stage{})
+	principal.InvalidateAll()
+	t.Cleanup(principal.InvalidateAll)
+	rows := []interface{}{
+		&models.User{Model: gorm.Model{ID: 1}, Email: "a@example.com", Role: "sacco"},
+		&models.User{Model: gorm.Model{ID: 2}, Email: "b@example.com", Role: "sacco"},
+		&models.User{Model: gorm.Model{ID: 3}, Email: "admin@example.com", Role: "admin"},
+		&models.User{Model: gorm.Model{ID: 4}, Email: "da@example.com", Role: "driver"},
+		&models.User{Model: gorm.Model{ID: 5}, Email: "db@example.com", Role: "driver"},
+		&models.Sacco{Model: gorm.Model{ID: 1}, UserID: 1, Name: "A"},
+		&models.Sacco{Model: gorm.Model{ID: 2}, UserID: 2, Name: "B"},
+		&models.Driver{Model: gorm.Model{ID: 1}, UserID: 4, SaccoID: 1, Name: "Driver A"},
+		&models.Driver{Model: gorm.Model{ID: 2}, UserID: 5, SaccoID: 2, Name: "Driver B"},
+		&models.Vehicle{Model: gorm.Model{ID: 1}, SaccoID: 1, VehicleNo: "KAA 001A"},
+		&models.Vehicle{Model: gorm.Model{ID: 2}, SaccoID: 2, VehicleNo: "KBB 002B"},
+	}
+	for _, r := range rows {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("create %T: %v", r, err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", float64(userID))
+		c.Set("role", role)
+	})
+	r.GET("/sacco/drivers", ListDrivers)
+	r.GET("/sacco/vehicles", ListVehicles)
+	r.GET("/sacco/drivers/:id", ListDriversBySacco)
+	r.GET("/sacco/vehicles/:id", ListVehiclesBySacco)
+	r.GET("/sacco/routes/:id", ListRoutesBySacco)
+	return r
+}
+
+func get(t *testing.T, r *gin.Engine, path string) (int, []map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var body struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body.Data
+}
+
+func TestBySaccoListingsOwnSacco(t *testing.T) {
+	r := twoSaccos(t, 1, "sacco")
+	for _, path := range []string{"/sacco/drivers/1", "/sacco/vehicles/1"} {
+		code, data := get(t, r, path)
+		if code != http.StatusOK || len(data) != 1 || data[0]["sacco_id"] != float64(1) {
+			t.Errorf("%s: got %d %v, want the sacco's one row", path, code, data)
+		}
+	}
+}
+
+func TestBySaccoListingsOtherSacco(t *testing.T) {
+	r := twoSaccos(t, 1, "sacco")
+	for _, path := range []string{"/sacco/drivers/2", "/sacco/vehicles/2", "/sacco/routes/2"} {
+		if code, data := get(t, r, path); code != http.StatusForbidden || len(data) != 0 {
+			t.Errorf("%s: got %d %v, want 403", path, code, data)
+		}
+	}
+}
+
+func TestBySaccoListingsAdmin(t *testing.T) {
+	r := twoSaccos(t, 3, "admin")
+	if code, data := get(t, r, "/sacco/vehicles/2"); code != http.StatusOK || len(data) != 1 {
+		t.Errorf("got %d %v, want sacco 2's vehicle", code, data)
+	}
+}
+
+func TestListingsScopedToCallersSacco(t *testing.T) {
+	r := twoSaccos(t, 2, "sacco")
+	if code, data := get(t, r, "/sacco/vehicles"); code != http.StatusOK || len(data) != 1 || data[0]["sacco_id"] != float64(2) {
+		t.Errorf("vehicles: got %d %v, want sacco 2's one vehicle", code, data)
+	}
+	if code, data := get(t, r, "/sacco/drivers"); code != http.StatusOK || len(data) != 1 || data[0]["ID"] != float64(5) {
+		t.Errorf("drivers: got %d %v, want sacco 2's driver user", code, data)
+	}
+}
+
+func TestListingsUnscopedForAdmin(t *testing.T) {
+	r := twoSaccos(t, 3, "admin")
+	for _, path := range []string{"/sacco/vehicles", "/sacco/drivers"} {
+		if code, data := get(t, r, path); code != http.StatusOK || len(data) != 2 {
+			t.Errorf("%s: got %d %v, want both saccos' rows", path, code, data)
+		}
+	}
+}
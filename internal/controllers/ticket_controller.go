@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/journeys"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+// ticketListOptions are the sorts and filters commuter ticket listings
+// accept.
+var ticketListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"expires_at": "expires_at",
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]pagination.Filter{
+		"journey_id": pagination.Uint("journey_id = ?"),
+		"route_id":   pagination.Uint("route_id = ?"),
+		"status":     pagination.String("status = ?"),
+	},
+}
+
+// presentTicket fills in the QR payload of an unused ticket and reports a
+// valid ticket past its expiry as expired.
+func presentTicket(t *models.Ticket, now time.Time) {
+	if t.Status != models.TicketValid {
+		return
+	}
+	if !now.Before(t.ExpiresAt) {
+		t.Status = models.TicketExpired
+		return
+	}
+	t.QR = journeys.TicketPayload(*t)
+}
+
+// ListTickets returns the authenticated commuter's ride tickets, newest
+// first, each unused one with the payload to show as its QR code.
+// ?journey_id=, ?route_id= and ?status=valid or used narrow the list.
+func ListTickets(c *gin.Context) {
+	var list []models.Ticket
+	query := config.DB.Model(&models.Ticket{}).Where("user_id = ?", authenticatedUserID(c))
+	meta, ok := paginate(c, "ListTickets", query, ticketListOptions, &list)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for i := range list {
+		presentTicket(&list[i], now)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
+
+// GetTicket returns one of the authenticated commuter's ride tickets.
+func GetTicket(c *gin.Context) {
+	id, ok := parseUintParam(c, "id", "GetTicket")
+	if !ok {
+		return
+	}
+	var ticket models.Ticket
+	if err := config.DB.Where("user_id = ?", authenticatedUserID(c)).First(&ticket, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Ticket not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("ticket_id", id).Error("GetTicket: Failed to load ticket.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load ticket")
+		}
+		return
+	}
+	presentTicket(&ticket, time.Now())
+	c.JSON(http.StatusOK, gin.H{"data": ticket})
+}
+
+// ValidateTicket lets a driver or conductor scan a commuter's QR ticket on
+// board. Body: {"code": "<scanned text>"}. The ticket must be signed, unused,
+// unexpired and for the route of the driver's vehicle; it is then used up
+// and the ride validated on the vehicle.
+func ValidateTicket(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "ValidateTicket")
+	if !ok {
+		return
+	}
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Where("driver_id = ?", driver.ID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusConflict, "You are not assigned to a vehicle")
+		return
+	}
+
+	ticket, err := journeys.UseTicket(config.DB, input.Code, vehicle, time.Now())
+	switch {
+	case errors.Is(err, journeys.ErrTicketInvalid):
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, journeys.ErrTicketUsed):
+		apierror.Fail(c, apierror.New(http.StatusConflict, err.Error()).WithDetail("used_at", ticket.UsedAt))
+	case errors.Is(err, journeys.ErrTicketExpired), errors.Is(err, journeys.ErrTicketWrongRoute):
+		apierror.Respond(c, http.StatusConflict, err.Error())
+	case err != nil:
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("ValidateTicket: Failed to validate ticket.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to validate ticket")
+	default:
+		logrus.WithContext(c).WithFields(logrus.Fields{
+			"ticket_id":  ticket.ID,
+			"segment_id": ticket.SegmentID,
+			"vehicle_id": vehicle.ID,
+		}).Info("ValidateTicket: Ticket used.")
+		c.JSON(http.StatusOK, gin.H{"data": ticket})
+	}
+}
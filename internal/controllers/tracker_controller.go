@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/attribution"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/driving"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+)
+
+// maxTrackerBatch caps the points accepted in one tracker upload, so a device
+// can flush what it buffered while offline without unbounded requests.
+const maxTrackerBatch = 500
+
+// saccoVehicle loads the vehicle named by :id if it belongs to the authenticated sacco.
+func saccoVehicle(c *gin.Context, fn string) (models.Vehicle, bool) {
+	var vehicle models.Vehicle
+	vehicleID, ok := parseUintParam(c, "id", fn)
+	if !ok {
+		return vehicle, false
+	}
+	tenant, ok := saccoTenant(c, fn)
+	if !ok {
+		return vehicle, false
+	}
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", vehicleID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
+		return vehicle, false
+	}
+	return vehicle, true
+}
+
+// IssueTrackerToken issues a token for a GPS tracker fitted to one of the
+// sacco's vehicles, replacing any previous one. The token is only shown once.
+func IssueTrackerToken(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "IssueTrackerToken")
+	if !ok {
+		return
+	}
+	token, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("IssueTrackerToken: Failed to generate token.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	now := time.Now()
+	if err := config.DB.Model(&vehicle).Updates(map[string]interface{}{"tracker_token_hash": hash, "tracker_token_issued_at": now}).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("IssueTrackerToken: Failed to save token.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save token")
+		return
+	}
+	logrus.WithContext(c).WithField("vehicle_id", vehicle.ID).Info("IssueTrackerToken: Tracker token issued.")
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{
+		"vehicle_id": vehicle.ID,
+		"token":      token,
+		"header":     middleware.TrackerTokenHeader,
+		"issued_at":  now,
+	}})
+}
+
+// RevokeTrackerToken stops the vehicle's tracker from reporting.
+func RevokeTrackerToken(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "RevokeTrackerToken")
+	if !ok {
+		return
+	}
+	if vehicle.TrackerTokenHash == "" {
+		apierror.Respond(c, http.StatusNotFound, "Vehicle has no tracker token")
+		return
+	}
+	if err := config.DB.Model(&vehicle).Updates(map[string]interface{}{"tracker_token_hash": "", "tracker_token_issued_at": nil}).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("RevokeTrackerToken: Failed to revoke token.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+	logrus.WithContext(c).WithField("vehicle_id", vehicle.ID).Info("RevokeTrackerToken: Tracker token revoked.")
+	c.JSON(http.StatusOK, gin.H{"message": "Tracker token revoked"})
+}
+
+// IngestTrackerLocations stores points reported by a vehicle's tracker.
+// Body: {"points": [{"latitude": .., "longitude": .., "speed": .., "timestamp": ..}, ...]}.
+// Points are credited to the vehicle's current driver; while it has none they
+// are kept unattributed and filled in later from the assignment history.
+func IngestTrackerLocations(c *gin.Context) {
+	vehicle := c.MustGet("tracker_vehicle").(models.Vehicle)
+	var input struct {
+		Points []LocationData `json:"points" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if len(input.Points) == 0 || len(input.Points) > maxTrackerBatch {
+		apierror.Respond(c, http.StatusBadRequest, "points must hold between 1 and 500 locations")
+		return
+	}
+	for _, p := range input.Points {
+		if p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+			apierror.Respond(c, http.StatusBadRequest, "latitude or longitude out of range")
+			return
+		}
+	}
+	sort.Slice(input.Points, func(i, j int) bool { return input.Points[i].Timestamp.Before(input.Points[j].Timestamp) })
+
+	var last models.LocationHistory
+	if err := config.DB.Where("vehicle_id = ? AND source = ?", vehicle.ID, models.LocationSourceTracker).
+		Order("timestamp DESC").Limit(1).Find(&last).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("IngestTrackerLocations: Failed to load last location.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load last location")
+		return
+	}
+
+	// Trackers report on their own schedule and may upload points buffered
+	// while offline, so every in-order point is kept and classified against
+	// the one before it rather than filtered against the wall clock.
+	var records []models.LocationHistory
+	var prev *models.LocationHistory
+	if last.ID != 0 {
+		prev = &last
+	}
+	for _, p := range input.Points {
+		speed := p.Speed
+		if speed < 0 {
+			speed = 0
+		}
+		record := models.LocationHistory{
+			DriverID:  vehicle.DriverID,
+			VehicleID: vehicle.ID,
+			Source:    models.LocationSourceTracker,
+			Latitude:  p.Latitude,
+			Longitude: p.Longitude,
+			Accuracy:  p.Accuracy,
+			Speed:     speed,
+			Bearing:   p.Bearing,
+			Altitude:  p.Altitude,
+			IsMoving:  speed > 0.5,
+			Timestamp: p.Timestamp,
+			EventType: "initial",
+		}
+		if prev != nil {
+			if !p.Timestamp.After(prev.Timestamp) {
+				continue // Replayed or out-of-order point
+			}
+			record.DistanceFromLast = calculateDistance(prev.Latitude, prev.Longitude, p.Latitude, p.Longitude)
+			record.Bearing = calculateBearing(prev.Latitude, prev.Longitude, p.Latitude, p.Longitude)
+			switch {
+			case record.DistanceFromLast >= 5:
+				record.EventType = "move"
+			case prev.IsMoving && !record.IsMoving:
+				record.EventType = "stopped"
+			case !prev.IsMoving && record.IsMoving:
+				record.EventType = "started"
+			default:
+				record.EventType = "periodic"
+			}
+		}
+		matchToRoute(&record, vehicle.RouteID)
+		records = append(records, record)
+		prev = &records[len(records)-1]
+	}
+
+	if len(records) > 0 {
+		tripID := currentTrip(vehicle.DriverID, vehicle.ID, records[0].Timestamp)
+		for i := range records {
+			records[i].TripID = tripID
+		}
+		if err := config.DB.Create(&records).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("IngestTrackerLocations: Failed to save locations.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to save locations")
+			return
+		}
+		recordTripPoints(tripID, records)
+		limit := driving.LimitFor(config.DB, vehicle.SaccoID, vehicle.RouteID)
+		for _, r := range records {
+			trackSpeeding(r, vehicle.SaccoID, vehicle.RouteID, limit)
+			trackStages(r, vehicle.SaccoID, vehicle.RouteID)
+			trackDeviation(r, vehicle.SaccoID, vehicle.RouteID)
+		}
+		publishLocation(records[len(records)-1], &vehicle, vehicle.SaccoID)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"received":   len(input.Points),
+		"saved":      len(records),
+		"unassigned": vehicle.DriverID == 0,
+	}})
+}
+
+// ListVehicleAssignments returns who drove one of the sacco's vehicles over
+// ?from= to ?to= (default the last 30 days), newest first.
+func ListVehicleAssignments(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "ListVehicleAssignments")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+	var assignments []models.VehicleAssignment
+	if err := config.DB.Where("vehicle_id = ? AND started_at < ? AND (ended_at IS NULL OR ended_at > ?)", vehicle.ID, to, from).
+		Order("started_at DESC").Find(&assignments).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("ListVehicleAssignments: Failed to load assignments.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load assignments")
+		return
+	}
+	var unattributed int64
+	if err := config.DB.Model(&models.LocationHistory{}).
+		Where("vehicle_id = ? AND source = ? AND driver_id = 0 AND timestamp >= ? AND timestamp < ?", vehicle.ID, models.LocationSourceTracker, from, to).
+		Count(&unattributed).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Warn("ListVehicleAssignments: Failed to count unattributed points.")
+	}
+	c.JSON(http.StatusOK, gin.H{"data": assignments, "unattributed_points": unattributed})
+}
+
+// CorrectVehicleAssignment records who actually drove one of the sacco's
+// vehicles during a past period, and re-attributes the location points
+// reported in it. Body: {"driver_id": 12, "started_at": "...", "ended_at": "..."};
+// driver_id 0 records that nobody drove it.
+func CorrectVehicleAssignment(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "CorrectVehicleAssignment")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "CorrectVehicleAssignment")
+	if !ok {
+		return
+	}
+	var input struct {
+		DriverID  *uint     `json:"driver_id" binding:"required"`
+		StartedAt time.Time `json:"started_at" binding:"required"`
+		EndedAt   time.Time `json:"ended_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if *input.DriverID != 0 {
+		var driver models.Driver
+		if err := tenant.Scoped(config.DB).First(&driver, *input.DriverID).Error; err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Driver not found or does not belong to this Sacco.")
+			return
+		}
+	}
+
+	changed, err := attribution.Correct(config.DB, vehicle.ID, vehicle.SaccoID, *input.DriverID, input.StartedAt, input.EndedAt, time.Now())
+	if err != nil {
+		if errors.Is(err, attribution.ErrInvalidPeriod) {
+			apierror.Respond(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("CorrectVehicleAssignment: Failed to correct assignment history.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to correct assignment history")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"vehicle_id":   vehicle.ID,
+		"driver_id":    *input.DriverID,
+		"reattributed": changed,
+	}).Info("CorrectVehicleAssignment: Assignment history corrected.")
+	c.JSON(http.StatusOK, gin.H{"message": "Assignment history corrected", "reattributed_points": changed})
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/trips"
+	"ma3_tracker/internal/wsproto"
+)
+
+// tripStatus maps trip lifecycle errors to HTTP statuses; 0 means the error
+// is unexpected.
+func tripStatus(err error) int {
+	switch {
+	case errors.Is(err, trips.ErrTripActive), errors.Is(err, trips.ErrTripEnded):
+		return http.StatusConflict
+	case errors.Is(err, trips.ErrNoVehicle), errors.Is(err, trips.ErrNoRoute), errors.Is(err, trips.ErrRouteNotServed):
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+// currentTrip tags a point with the trip in progress, logging lookup errors:
+// a point is never dropped for want of a trip.
+func currentTrip(driverID, vehicleID uint, at time.Time) uint {
+	tripID, err := trips.Current(config.DB, driverID, vehicleID, at)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"driver_id": driverID, "vehicle_id": vehicleID}).Error("currentTrip: Failed to look up trip in progress.")
+	}
+	return tripID
+}
+
+// recordTripPoints adds saved points to their trip's totals.
+func recordTripPoints(tripID uint, points []models.LocationHistory) {
+	if err := trips.Record(config.DB, tripID, points); err != nil {
+		logrus.WithError(err).WithField("trip_id", tripID).Error("recordTripPoints: Failed to update trip.")
+	}
+}
+
+// tripCommand is a driver's WebSocket request to start or end a trip.
+type tripCommand struct {
+	Type    string `json:"type"` // "trip_start" or "trip_end"
+	RouteID uint   `json:"route_id"`
+}
+
+// processDriverTripCommand starts or ends the driver's trip and acknowledges
+// it on the connection.
+func processDriverTripCommand(driverConn *websocket.Conn, p []byte, driverID uint) {
+	var cmd tripCommand
+	if err := json.Unmarshal(p, &cmd); err != nil {
+		writeWSError(driverConn, "Invalid trip message.")
+		return
+	}
+	var trip *models.Trip
+	var err error
+	status := "trip_started"
+	if cmd.Type == "trip_start" {
+		trip, err = trips.Start(config.DB, driverID, cmd.RouteID, time.Now())
+	} else {
+		status = "trip_ended"
+		if trip, err = trips.ForDriver(config.DB, driverID); err == nil {
+			if trip == nil {
+				writeWSError(driverConn, "No trip in progress.")
+				return
+			}
+			trip, err = trips.End(config.DB, trip.ID, models.TripEndDriver, time.Now())
+		}
+	}
+	if err != nil {
+		if tripStatus(err) != 0 {
+			writeWSError(driverConn, err.Error())
+			return
+		}
+		logrus.WithError(err).WithField("driver_id", driverID).Error("processDriverTripCommand: Failed to update trip.")
+		writeWSError(driverConn, "Failed to update trip.")
+		return
+	}
+	writeWS(driverConn, wsproto.TypeAck, gin.H{
+		"type":       cmd.Type,
+		"status":     status,
+		"trip_id":    trip.ID,
+		"vehicle_id": trip.VehicleID,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// GetCurrentTrip returns the authenticated driver's trip in progress.
+func GetCurrentTrip(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "GetCurrentTrip")
+	if !ok {
+		return
+	}
+	trip, err := trips.ForDriver(config.DB, driver.ID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("GetCurrentTrip: Failed to load trip.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load trip")
+		return
+	}
+	if trip == nil {
+		apierror.Respond(c, http.StatusNotFound, "No trip in progress")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": trip})
+}
+
+// StartTrip starts a trip for the authenticated driver in their vehicle.
+// Body: {"route_id": 3}, optional; defaults to the vehicle's route.
+func StartTrip(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "StartTrip")
+	if !ok {
+		return
+	}
+	var input struct {
+		RouteID uint `json:"route_id"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			apierror.Fail(c, apierror.Invalid(err))
+			return
+		}
+	}
+	trip, err := trips.Start(config.DB, driver.ID, input.RouteID, time.Now())
+	if err != nil {
+		if status := tripStatus(err); status != 0 {
+			apierror.Respond(c, status, err.Error())
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("StartTrip: Failed to start trip.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to start trip")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"trip_id": trip.ID, "driver_id": driver.ID, "route_id": trip.RouteID}).Info("StartTrip: Trip started.")
+	c.JSON(http.StatusCreated, gin.H{"data": trip})
+}
+
+// EndTrip ends the authenticated driver's trip in progress.
+func EndTrip(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "EndTrip")
+	if !ok {
+		return
+	}
+	trip, err := trips.ForDriver(config.DB, driver.ID)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("driver_id", driver.ID).Error("EndTrip: Failed to load trip.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load trip")
+		return
+	}
+	if trip == nil {
+		apierror.Respond(c, http.StatusNotFound, "No trip in progress")
+		return
+	}
+	endTrip(c, "EndTrip", trip.ID, models.TripEndDriver)
+}
+
+// endTrip ends the trip and writes the response.
+func endTrip(c *gin.Context, fn string, tripID uint, reason string) {
+	trip, err := trips.End(config.DB, tripID, reason, time.Now())
+	if err != nil {
+		if status := tripStatus(err); status != 0 {
+			apierror.Respond(c, status, err.Error())
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("trip_id", tripID).Error(fn + ": Failed to end trip.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to end trip")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"trip_id": trip.ID, "reason": reason}).Info(fn + ": Trip ended.")
+	c.JSON(http.StatusOK, gin.H{"data": trip})
+}
+
+// tripListOptions are the sorts and filters the trip listings accept.
+var tripListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"started_at": "started_at",
+		"distance":   "distance_m",
+	},
+	DefaultSort: "-started_at",
+	Filters: map[string]pagination.Filter{
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"vehicle_id": pagination.Uint("vehicle_id = ?"),
+		"route_id":   pagination.Uint("route_id = ?"),
+		"end_reason": pagination.String("end_reason = ?"),
+	},
+}
+
+// listTrips responds with a page of the trips matching query that started
+// between ?from= and ?to= (default the last 7 days).
+func listTrips(c *gin.Context, fn string, query *gorm.DB) {
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	var list []models.Trip
+	meta, ok := paginate(c, fn, query.Model(&models.Trip{}).Where("started_at >= ? AND started_at < ?", from, to), tripListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta, "from": from, "to": to})
+}
+
+// ListOwnTrips returns the authenticated driver's trips.
+func ListOwnTrips(c *gin.Context) {
+	driver, ok := authenticatedDriver(c, "ListOwnTrips")
+	if !ok {
+		return
+	}
+	listTrips(c, "ListOwnTrips", config.DB.Where("driver_id = ?", driver.ID))
+}
+
+// ListSaccoTrips returns the trips of the sacco's vehicles.
+func ListSaccoTrips(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListSaccoTrips")
+	if !ok {
+		return
+	}
+	listTrips(c, "ListSaccoTrips", config.DB.Scopes(tenant.SaccoScope))
+}
+
+// loadSaccoTrip loads one of the authenticated sacco's trips from :id,
+// responding on failure.
+func loadSaccoTrip(c *gin.Context, fn string) (*models.Trip, bool) {
+	trip, ok := loadOwned[models.Trip](c, fn, "Trip", config.DB)
+	if !ok {
+		return nil, false
+	}
+	return &trip, true
+}
+
+// GetSaccoTrip returns one of the sacco's trips with its location points in
+// time order.
+func GetSaccoTrip(c *gin.Context) {
+	trip, ok := loadSaccoTrip(c, "GetSaccoTrip")
+	if !ok {
+		return
+	}
+	var track []models.LocationHistory
+	if err := config.DB.Where("trip_id = ?", trip.ID).Order("timestamp").Find(&track).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("trip_id", trip.ID).Error("GetSaccoTrip: Failed to load trip points.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load trip points")
+		return
+	}
+	points := make([]gin.H, 0, len(track))
+	for _, p := range track {
+		points = append(points, gin.H{
+			"latitude":   p.Latitude,
+			"longitude":  p.Longitude,
+			"accuracy":   p.Accuracy,
+			"speed":      p.Speed,
+			"bearing":    p.Bearing,
+			"timestamp":  p.Timestamp,
+			"event_type": p.EventType,
+			"source":     p.Source,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"trip": trip, "points": points}})
+}
+
+// EndSaccoTrip lets the sacco close one of its trips, e.g. one a driver
+// forgot to end.
+func EndSaccoTrip(c *gin.Context) {
+	trip, ok := loadSaccoTrip(c, "EndSaccoTrip")
+	if !ok {
+		return
+	}
+	endTrip(c, "EndSaccoTrip", trip.ID, models.TripEndSacco)
+}
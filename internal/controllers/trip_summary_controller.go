@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+)
+
+// tripSummaryListOptions are the sorts and filters the trip summary listing
+// accepts.
+var tripSummaryListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"started_at": "started_at",
+		"distance":   "distance_m",
+		"duration":   "duration_s",
+	},
+	DefaultSort: "-started_at",
+	Filters: map[string]pagination.Filter{
+		"vehicle_id": pagination.Uint("vehicle_id = ?"),
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"route_id":   pagination.Uint("route_id = ?"),
+		"trip_id":    pagination.Uint("trip_id = ?"),
+		"source":     pagination.String("source = ?"),
+	},
+}
+
+// ListTripSummaries returns the trips detected in the location history of
+// the sacco's vehicles that started between ?from= and ?to= (default the last
+// 7 days). Trips are detected periodically, so the latest ones appear some
+// time after they end.
+func ListTripSummaries(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListTripSummaries")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	query := config.Replica().Model(&models.TripSummary{}).Scopes(tenant.SaccoScope).Where("started_at >= ? AND started_at < ?", from, to)
+	var list []models.TripSummary
+	meta, ok := paginate(c, "ListTripSummaries", query, tripSummaryListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta, "from": from, "to": to})
+}
+
+// GetTripSummary returns one of the sacco's detected trips.
+func GetTripSummary(c *gin.Context) {
+	s, ok := loadOwned[models.TripSummary](c, "GetTripSummary", "Trip summary", config.Replica())
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": s})
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/attribution"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// driverConflictError reports the other vehicles a driver is already assigned to.
+type driverConflictError struct {
+	DriverID   uint
+	VehicleIDs []uint
+}
+
+func (e *driverConflictError) Error() string {
+	return fmt.Sprintf("driver %d is already assigned to vehicle(s) %v", e.DriverID, e.VehicleIDs)
+}
+
+// errReliefActive is returned when assigning a driver to a vehicle that is
+// currently handed over to a relief driver.
+var errReliefActive = errors.New("vehicle has an active relief session; end it before reassigning the driver")
+
+// errVehicleRetired is returned when assigning a driver to a retired vehicle.
+var errVehicleRetired = errors.New("vehicle is retired and cannot be assigned a driver")
+
+// assignDriver makes driverID the vehicle's driver inside tx, keeping
+// Vehicle.DriverID and Driver.VehicleID in step. The vehicle and driver rows
+// are locked. When the driver already holds other vehicles the assignment
+// fails with *driverConflictError unless reassign is set, in which case they
+// are unassigned first. A driverID of 0 clears the assignment. It returns the
+// IDs of vehicles the driver was taken off.
+func assignDriver(tx *gorm.DB, vehicle *models.Vehicle, driverID uint, reassign bool) ([]uint, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(vehicle, vehicle.ID).Error; err != nil {
+		return nil, err
+	}
+	if driverID != 0 && vehicle.Status == models.VehicleRetired {
+		return nil, errVehicleRetired
+	}
+	var relief int64
+	if err := tx.Model(&models.ReliefSession{}).Where("vehicle_id = ? AND ended_at IS NULL", vehicle.ID).Count(&relief).Error; err != nil {
+		return nil, err
+	}
+	if relief > 0 {
+		return nil, errReliefActive
+	}
+
+	var unassigned []uint
+	if driverID != 0 {
+		var driver models.Driver
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&driver, driverID).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Vehicle{}).Where("driver_id = ? AND id <> ?", driverID, vehicle.ID).Pluck("id", &unassigned).Error; err != nil {
+			return nil, err
+		}
+		if len(unassigned) > 0 {
+			if !reassign {
+				return nil, &driverConflictError{DriverID: driverID, VehicleIDs: unassigned}
+			}
+			if err := tx.Model(&models.Vehicle{}).Where("id IN ?", unassigned).Update("driver_id", 0).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	previous := vehicle.DriverID
+	if previous != 0 && previous != driverID {
+		if err := tx.Model(&models.Driver{}).Where("id = ? AND vehicle_id = ?", previous, vehicle.ID).Update("vehicle_id", 0).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Model(vehicle).Update("driver_id", driverID).Error; err != nil {
+		return nil, err
+	}
+	if previous != driverID || len(unassigned) > 0 {
+		if err := attribution.Record(tx, vehicle.ID, vehicle.SaccoID, driverID, models.AssignmentRegular, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if driverID != 0 {
+		if err := tx.Model(&models.Driver{}).Where("id = ?", driverID).Update("vehicle_id", vehicle.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+	vehicle.DriverID = driverID
+	return unassigned, nil
+}
+
+// respondAssignmentError maps assignDriver errors to responses. It returns
+// false when err was not an assignment conflict.
+func respondAssignmentError(c *gin.Context, err error) bool {
+	var conflict *driverConflictError
+	switch {
+	case errors.As(err, &conflict):
+		apierror.Fail(c, apierror.New(http.StatusConflict,
+			"Driver is already assigned to another vehicle. Retry with \"reassign\": true to move them.").
+			WithCode("driver_assigned").
+			WithDetail("vehicle_ids", conflict.VehicleIDs))
+	case errors.Is(err, errReliefActive):
+		apierror.Fail(c, apierror.New(http.StatusConflict, err.Error()).WithCode("relief_active"))
+	case errors.Is(err, errVehicleRetired):
+		apierror.Fail(c, apierror.New(http.StatusConflict, err.Error()).WithCode("vehicle_retired"))
+	default:
+		return false
+	}
+	return true
+}
+
+// AssignVehicleDriver sets or clears the driver of one of the sacco's vehicles.
+// Body: {"driver_id": 12, "reassign": false}; driver_id 0 unassigns.
+func AssignVehicleDriver(c *gin.Context) {
+	vehicleID, ok := parseUintParam(c, "id", "AssignVehicleDriver")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "AssignVehicleDriver")
+	if !ok {
+		return
+	}
+	var input struct {
+		DriverID *uint `json:"driver_id" binding:"required"`
+		Reassign bool  `json:"reassign"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", vehicleID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
+		return
+	}
+	if *input.DriverID != 0 {
+		var driver models.Driver
+		if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", *input.DriverID).First(&driver).Error; err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Driver not found or does not belong to this Sacco.")
+			return
+		}
+	}
+
+	var unassigned []uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		unassigned, err = assignDriver(tx, &vehicle, *input.DriverID, input.Reassign)
+		return err
+	})
+	if err != nil {
+		if respondAssignmentError(c, err) {
+			return
+		}
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("AssignVehicleDriver: Failed to assign driver.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to assign driver")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"vehicle_id":          vehicle.ID,
+		"driver_id":           vehicle.DriverID,
+		"unassigned_vehicles": unassigned,
+	}).Info("AssignVehicleDriver: Driver assignment updated.")
+	c.JSON(http.StatusOK, gin.H{"data": vehicle, "unassigned_vehicle_ids": unassigned})
+}
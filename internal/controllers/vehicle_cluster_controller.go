@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+)
+
+const (
+	// clusterCellPx is the size, in screen pixels at the requested zoom, of
+	// the grid cells vehicles are grouped by.
+	clusterCellPx = 64
+	// clusterMemberZoom is the zoom from which clusters list their vehicles.
+	clusterMemberZoom = 14
+	maxClusterZoom    = 22
+)
+
+// vehicleCluster is the vehicles falling in one grid cell of the map.
+type vehicleCluster struct {
+	Latitude   float64          `json:"latitude"` // Centroid of the members
+	Longitude  float64          `json:"longitude"`
+	Count      int              `json:"count"`
+	BBox       [4]float64       `json:"bbox"`                  // min_lng, min_lat, max_lng, max_lat of the members
+	VehicleIDs []uint           `json:"vehicle_ids,omitempty"` // From clusterMemberZoom
+	Vehicle    *vehiclePosition `json:"vehicle,omitempty"`     // When the cluster is a single vehicle
+}
+
+// ListVehicleClusters groups the last known positions of in-service vehicles
+// inside ?bbox=min_lng,min_lat,max_lng,max_lat into clusters on a grid of
+// about 64 screen pixels at ?zoom= (0-22), so a city-wide map draws a marker
+// per cluster rather than per vehicle. ?sacco_id= and ?route_id= narrow it
+// down; stale positions are left out unless ?include_stale=true. Clusters
+// list their vehicle IDs from zoom 14, and single vehicles come with their
+// position.
+func ListVehicleClusters(c *gin.Context) {
+	v, err := parseBBox(c.Query("bbox"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	minLng, minLat, maxLng, maxLat := v[0], v[1], v[2], v[3]
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 || minLat >= maxLat || minLng >= maxLng {
+		apierror.Respond(c, http.StatusBadRequest, "bbox must be min_lng,min_lat,max_lng,max_lat with min < max")
+		return
+	}
+	zoom, err := strconv.Atoi(c.Query("zoom"))
+	if err != nil || zoom < 0 || zoom > maxClusterZoom {
+		apierror.Respond(c, http.StatusBadRequest, "zoom must be an integer between 0 and "+strconv.Itoa(maxClusterZoom))
+		return
+	}
+	includeStale := false
+	if raw := c.Query("include_stale"); raw != "" {
+		if includeStale, err = strconv.ParseBool(raw); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid include_stale")
+			return
+		}
+	}
+
+	scope := config.DB.Where("l.latitude BETWEEN ? AND ? AND l.longitude BETWEEN ? AND ?", minLat, maxLat, minLng, maxLng)
+	for _, name := range []string{"sacco_id", "route_id"} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || id == 0 {
+			apierror.Respond(c, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		scope = scope.Where("v."+name+" = ?", id)
+	}
+	positions, err := positionsWhere(scope)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("ListVehicleClusters: Failed to load positions.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load vehicle positions")
+		return
+	}
+
+	clusters := clusterPositions(positions, zoom, includeStale)
+	total := 0
+	for _, cl := range clusters {
+		total += cl.Count
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":         clusters,
+		"zoom":         zoom,
+		"vehicles":     total,
+		"generated_at": time.Now().UTC(),
+	})
+}
+
+// clusterPositions groups positions by the clusterCellPx grid cell they fall
+// in at zoom, largest clusters first.
+func clusterPositions(positions []vehiclePosition, zoom int, includeStale bool) []*vehicleCluster {
+	type cell struct{ x, y int64 }
+	scale := 256 * math.Exp2(float64(zoom)) / clusterCellPx
+	byCell := map[cell]*vehicleCluster{}
+	var clusters []*vehicleCluster
+	for i := range positions {
+		p := &positions[i]
+		if p.Stale && !includeStale {
+			continue
+		}
+		x, y := geo.Mercator(geo.Point{Lat: p.Latitude, Lng: p.Longitude})
+		key := cell{int64(x * scale), int64(y * scale)}
+		cl, ok := byCell[key]
+		if !ok {
+			cl = &vehicleCluster{BBox: [4]float64{p.Longitude, p.Latitude, p.Longitude, p.Latitude}, Vehicle: p}
+			byCell[key] = cl
+			clusters = append(clusters, cl)
+		}
+		cl.Count++
+		cl.Latitude += p.Latitude
+		cl.Longitude += p.Longitude
+		cl.BBox = [4]float64{
+			math.Min(cl.BBox[0], p.Longitude), math.Min(cl.BBox[1], p.Latitude),
+			math.Max(cl.BBox[2], p.Longitude), math.Max(cl.BBox[3], p.Latitude),
+		}
+		if zoom >= clusterMemberZoom {
+			cl.VehicleIDs = append(cl.VehicleIDs, p.VehicleID)
+		}
+	}
+	for _, cl := range clusters {
+		cl.Latitude /= float64(cl.Count)
+		cl.Longitude /= float64(cl.Count)
+		if cl.Count > 1 {
+			cl.Vehicle = nil
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Count > clusters[j].Count })
+	return clusters
+}
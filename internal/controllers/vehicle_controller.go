@@ -4,12 +4,16 @@ import (
 	"errors" // Import for gorm.ErrRecordNotFound
 	"net/http"
 	"strconv" // Import for strconv.ParseUint
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm" // Import for GORM transaction and error handling
 
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/attribution"
 	"ma3_tracker/internal/config"
 	"ma3_tracker/internal/models" // Your models package
+	"ma3_tracker/internal/pagination"
 )
 
 // serviceStatusPayload defines the expected JSON for updating vehicle service status
@@ -26,62 +30,51 @@ func CreateVehicle(c *gin.Context) {
 		SaccoID       uint   `json:"sacco_id"`
 		DriverID            uint   `json:"driver_id" binding:"required"`
 		RouteID             uint   `json:"route_id" binding:"required"`
+		Capacity            int    `json:"capacity" binding:"omitempty,gte=1"` // Seats; defaults to 14 when omitted
+		Amenities           models.VehicleAmenities `json:"amenities"`
 	}
 
 	// Bind and validate JSON input from the request body
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
 
-	// Extract the authenticated UserID from JWT claims. This is the ID of the user
-	// who is making the request, which should be a Sacco owner in this context.
-	authenticatedUserID := uint(c.MustGet("user_id").(float64))
-
-	// Verify the authenticated user is indeed a Sacco owner and get their SaccoID.
-	// We preload the Sacco association to get the actual Sacco ID from the saccos table.
-	var saccoUser models.User
-	if err := config.DB.Preload("Sacco").First(&saccoUser, authenticatedUserID).Error; err != nil {
-		// If user not found or database error during fetch
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authenticated user not found or could not verify role."})
-		return
-	}
-	// Check if the user's role is 'sacco' and if they have an associated Sacco profile.
-	if saccoUser.Role != "sacco" || saccoUser.Sacco == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only Sacco owners can create vehicles."})
+	// The authenticated user must own a sacco; the vehicle is created in it
+	// and its driver and route must belong to it.
+	tenant, ok := saccoTenant(c, "CreateVehicle")
+	if !ok {
 		return
 	}
-	// Get the actual SaccoID from the associated Sacco model
-	saccoID := saccoUser.Sacco.ID
+	saccoID := tenant.SaccoID()
 
 	// Start a database transaction to ensure atomicity. If any step fails, everything is rolled back.
 	tx := config.DB.Begin()
 	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction."})
+		apierror.Respond(c, http.StatusInternalServerError, "Could not start transaction.")
 		return
 	}
 
 	// 1. Validate DriverID: Ensure the driver exists AND belongs to this specific Sacco.
 	var driver models.Driver
-	if err := tx.Where("id = ? AND sacco_id = ?", input.DriverID, saccoID).First(&driver).Error; err != nil {
+	if err := tenant.Scoped(tx).First(&driver, input.DriverID).Error; err != nil {
 		tx.Rollback() // Rollback the transaction on validation failure
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Assigned Driver not found or does not belong to this Sacco."})
+			apierror.Respond(c, http.StatusBadRequest, "Assigned Driver not found or does not belong to this Sacco.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error validating driver: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error validating driver", err))
 		}
 		return
 	}
 
 	// 2. Validate RouteID: Ensure the route exists AND belongs to this specific Sacco (assuming routes are Sacco-specific).
 	var route models.Route
-	// If routes can be shared across saccos, remove the `AND sacco_id = ?` part.
-	if err := tx.Where("id = ? AND sacco_id = ?", input.RouteID, saccoID).First(&route).Error; err != nil {
+	if err := tenant.Scoped(tx).First(&route, input.RouteID).Error; err != nil {
 		tx.Rollback() // Rollback the transaction on validation failure
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Assigned Route not found or does not belong to this Sacco."})
+			apierror.Respond(c, http.StatusBadRequest, "Assigned Route not found or does not belong to this Sacco.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error validating route: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error validating route", err))
 		}
 		return
 	}
@@ -90,22 +83,33 @@ func CreateVehicle(c *gin.Context) {
 	vehicle := models.Vehicle{
 		VehicleNo:           input.VehicleNo,
 		VehicleRegistration: input.VehicleRegistration,
-		SaccoID:             saccoID,        // Use the validated SaccoID from the authenticated user's Sacco profile
-		DriverID:            input.DriverID, // Use the validated DriverID from the request
-		RouteID:             input.RouteID,  // Use the validated RouteID from the request
-		InService:           true,           // Default to true
+		SaccoID:             saccoID,       // Use the validated SaccoID from the authenticated user's Sacco profile
+		RouteID:             input.RouteID, // Use the validated RouteID from the request
+		InService:           true,          // Default to true
+		Capacity:            input.Capacity,
+		Amenities:           input.Amenities,
 	}
 
 	// Save the new vehicle record to the database within the transaction
 	if err := tx.Create(&vehicle).Error; err != nil {
 		tx.Rollback() // Rollback if creation fails
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vehicle: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Failed to create vehicle", err))
+		return
+	}
+
+	// Assign the validated driver, keeping Driver.VehicleID in step and
+	// refusing drivers that already hold another vehicle.
+	if _, err := assignDriver(tx, &vehicle, input.DriverID, false); err != nil {
+		tx.Rollback()
+		if !respondAssignmentError(c, err) {
+			apierror.Fail(c, apierror.Internal("Failed to assign driver", err))
+		}
 		return
 	}
 
 	// Commit the transaction if all operations were successful
 	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not commit transaction: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Could not commit transaction", err))
 		return
 	}
 
@@ -119,54 +123,87 @@ func CreateVehicle(c *gin.Context) {
 
 // GetMyVehicles retrieves vehicles based on the authenticated user's role (Sacco owner or Driver).
 func GetMyVehicles(c *gin.Context) {
-	userID := uint(c.MustGet("user_id").(float64))
-
-	var user models.User
-	// Preload Sacco and Driver to determine user's specific role context
-	if err := config.DB.Preload("Sacco").Preload("Driver").First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authenticated user not found."})
+	tenant, ok := authenticatedTenant(c, "GetMyVehicles")
+	if !ok {
 		return
 	}
 
 	var vehicles []models.Vehicle
-	if user.Role == "sacco" && user.Sacco != nil {
+	if tenant.Sacco != nil {
 		// If it's a Sacco owner, list vehicles belonging to their Sacco
-		if err := config.DB.Where("sacco_id = ?", user.Sacco.ID).Find(&vehicles).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching vehicles for your Sacco: " + err.Error()})
+		if err := tenant.Scoped(config.DB).Find(&vehicles).Error; err != nil {
+			apierror.Fail(c, apierror.Internal("Error fetching vehicles for your Sacco", err))
 			return
 		}
-	} else if user.Role == "driver" && user.Driver != nil {
+	} else if tenant.Driver != nil {
 		// If it's a driver, list vehicles assigned to this specific driver
-		if err := config.DB.Where("driver_id = ?", user.Driver.ID).Find(&vehicles).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching vehicles assigned to you: " + err.Error()})
+		if err := config.DB.Scopes(tenant.DriverScope).Find(&vehicles).Error; err != nil {
+			apierror.Fail(c, apierror.Internal("Error fetching vehicles assigned to you", err))
 			return
 		}
 	} else {
 		// For other roles (commuter) or inconsistent states, deny access. Admin should use ListVehicles.
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied. You must be a Sacco owner or an assigned driver to view your vehicles."})
+		apierror.Respond(c, http.StatusForbidden, "Access denied. You must be a Sacco owner or an assigned driver to view your vehicles.")
 		return
 	}
 
+	attachVehiclePhotos(vehicles)
 	c.JSON(http.StatusOK, gin.H{"vehicles": vehicles})
 }
 
-// ListVehicles is typically for administrative use, fetching all vehicles without specific filtering.
+// vehicleListOptions are the sorts and filters ListVehicles accepts.
+var vehicleListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"id":                   "id",
+		"created_at":           "created_at",
+		"vehicle_no":           "vehicle_no",
+		"vehicle_registration": "vehicle_registration",
+		"status":               "status",
+	},
+	DefaultSort: "id",
+	Filters: map[string]pagination.Filter{
+		"in_service": pagination.Bool("in_service = ?"),
+		"route_id":   pagination.Uint("route_id = ?"),
+		"sacco_id":   pagination.Uint("sacco_id = ?"),
+		"driver_id":  pagination.Uint("driver_id = ?"),
+		"status":     pagination.String("status = ?"),
+	},
+}
+
+// ListVehicles lists vehicles a page at a time with optional filters (see
+// vehicleListOptions): every sacco's for admins, otherwise the caller's sacco's.
 func ListVehicles(c *gin.Context) {
+	tenant, ok := authenticatedTenant(c, "ListVehicles")
+	if !ok {
+		return
+	}
+	query, ok := includeDeleted(c, "ListVehicles", config.DB.Model(&models.Vehicle{}).Scopes(tenant.SaccoScope), tenant.SaccoID())
+	if !ok {
+		return
+	}
 	var vehicles []models.Vehicle
-	if err := config.DB.Find(&vehicles).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing vehicles: " + err.Error()})
+	meta, ok := paginate(c, "ListVehicles", query, vehicleListOptions, &vehicles)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": vehicles})
+	attachVehicleBranding(vehicles)
+	c.JSON(http.StatusOK, gin.H{"data": vehicles, "pagination": meta})
 }
 
-// ListVehicles returns only vehicles that are currently in service (in_service = true).
+// ListActiveVehicles returns only active vehicles that are currently in service.
 func ListActiveVehicles(c *gin.Context) {
 	var vehicles []models.Vehicle
-	if err := config.DB.Where("in_service = ?", true).Find(&vehicles).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing vehicles: " + err.Error()})
+	if err := config.DB.Where("in_service = ? AND status = ?", true, models.VehicleActive).Find(&vehicles).Error; err != nil {
+		apierror.Fail(c, apierror.Internal("Error listing vehicles", err))
 		return
 	}
+	accessibility, ok := commuterAccessibility(c, c.Query("accessibility"))
+	if !ok {
+		return
+	}
+	vehicles = filterAccessibleVehicles(vehicles, accessibility)
+	expireStaleOccupancy(vehicles)
+	attachVehicleBranding(vehicles)
 	c.JSON(http.StatusOK, gin.H{"data": vehicles})
 }
 
@@ -175,62 +212,64 @@ func ListVehiclesBySacco(c *gin.Context) {
 	// Get sacco_id from PATH parameter
 	saccoIDStr := c.Param("id") // Extract 'id' from the URL path (e.g., /vehicles/123 -> id = "123")
 	if saccoIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Sacco ID path parameter is required."})
+		apierror.Respond(c, http.StatusBadRequest, "Sacco ID path parameter is required.")
 		return
 	}
 
 	saccoID, err := strconv.ParseUint(saccoIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Sacco ID format in path parameter."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid Sacco ID format in path parameter.")
+		return
+	}
+
+	tenant, ok := pathSaccoTenant(c, "ListVehiclesBySacco", uint(saccoID))
+	if !ok {
 		return
 	}
 
 	var vehicles []models.Vehicle // Slice to hold the fetched vehicles
-	// Filter vehicles by the provided sacco_id
-	if err := config.DB.Where("sacco_id = ?", uint(saccoID)).Find(&vehicles).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing vehicles for sacco: " + err.Error()})
+	// Filter vehicles by the provided sacco_id, a page at a time
+	query, ok := includeDeleted(c, "ListVehiclesBySacco", tenant.Scoped(config.DB.Model(&models.Vehicle{}).Where("sacco_id = ?", uint(saccoID))), uint(saccoID))
+	if !ok {
+		return
+	}
+	meta, ok := paginate(c, "ListVehiclesBySacco", query, vehicleListOptions, &vehicles)
+	if !ok {
 		return
 	}
 
-	// Respond with the list of vehicles, wrapped in a "data" key for consistency
-	c.JSON(http.StatusOK, gin.H{"data": vehicles})
+	// Respond with the page of vehicles, wrapped in a "data" key for consistency
+	attachVehicleBranding(vehicles)
+	c.JSON(http.StatusOK, gin.H{"data": vehicles, "pagination": meta})
 	
 }
 
 // UpdateVehicle allows modifying vehicle details, restricted to Sacco owners or Admins.
 func UpdateVehicle(c *gin.Context) {
-	authenticatedUserID := uint(c.MustGet("user_id").(float64))
 	vehIDStr := c.Param("id")
 
-	var user models.User
-	if err := config.DB.Preload("Sacco").Preload("Driver").First(&user, authenticatedUserID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authenticated user not found."})
+	tenant, ok := authenticatedTenant(c, "UpdateVehicle")
+	if !ok {
 		return
 	}
 
-	if user.Role != "sacco" && user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only Sacco owners or administrators can update vehicles."})
+	if tenant.Sacco == nil && !tenant.Admin() {
+		apierror.Respond(c, http.StatusForbidden, "Only Sacco owners or administrators can update vehicles.")
 		return
 	}
 
 	vehID, err := strconv.ParseUint(vehIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Vehicle ID format."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid Vehicle ID format.")
 		return
 	}
 
 	var vehicle models.Vehicle
-	query := config.DB.Where("id = ?", uint(vehID))
-
-	if user.Role == "sacco" && user.Sacco != nil {
-		query = query.Where("sacco_id = ?", user.Sacco.ID)
-	}
-
-	if err := query.First(&vehicle).Error; err != nil {
+	if err := tenant.Scoped(config.DB).First(&vehicle, uint(vehID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found or not assigned to your Sacco."})
+			apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching vehicle: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error fetching vehicle", err))
 		}
 		return
 	}
@@ -241,16 +280,18 @@ func UpdateVehicle(c *gin.Context) {
 		DriverID            *uint   `json:"driver_id"`
 		RouteID             *uint   `json:"route_id"`
 		InService           *bool   `json:"in_service"`
+		Capacity            *int    `json:"capacity"`
+		Amenities           *models.VehicleAmenities `json:"amenities"`
 	}
 
 	if err := c.ShouldBindJSON(&updateInput); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid update input: " + err.Error()})
+		apierror.Fail(c, apierror.Invalid(err))
 		return
 	}
 
 	tx := config.DB.Begin()
 	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction."})
+		apierror.Respond(c, http.StatusInternalServerError, "Could not start transaction.")
 		return
 	}
 
@@ -261,39 +302,47 @@ func UpdateVehicle(c *gin.Context) {
 		vehicle.VehicleRegistration = *updateInput.VehicleRegistration
 	}
 	if updateInput.InService != nil {
+		if *updateInput.InService && respondServiceBlocked(c, vehicle) {
+			tx.Rollback()
+			return
+		}
 		vehicle.InService = *updateInput.InService
 	}
+	if updateInput.Capacity != nil {
+		if *updateInput.Capacity <= 0 {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusBadRequest, "Capacity must be positive.")
+			return
+		}
+		vehicle.Capacity = *updateInput.Capacity
+	}
+	if updateInput.Amenities != nil {
+		vehicle.Amenities = *updateInput.Amenities
+	}
 
+	var newDriverID *uint
 	if updateInput.DriverID != nil {
 		var newDriver models.Driver
-		driverQuery := tx.Where("id = ?", *updateInput.DriverID)
-		if user.Role == "sacco" && user.Sacco != nil {
-			driverQuery = driverQuery.Where("sacco_id = ?", user.Sacco.ID)
-		}
-		if err := driverQuery.First(&newDriver).Error; err != nil {
+		if err := tenant.Scoped(tx).First(&newDriver, *updateInput.DriverID).Error; err != nil {
 			tx.Rollback()
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Assigned driver not found or does not belong to this Sacco."})
+				apierror.Respond(c, http.StatusBadRequest, "Assigned driver not found or does not belong to this Sacco.")
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error validating new driver: " + err.Error()})
+				apierror.Fail(c, apierror.Internal("Database error validating new driver", err))
 			}
 			return
 		}
-		vehicle.DriverID = *updateInput.DriverID
+		newDriverID = updateInput.DriverID
 	}
 
 	if updateInput.RouteID != nil {
 		var newRoute models.Route
-		routeQuery := tx.Where("id = ?", *updateInput.RouteID)
-		if user.Role == "sacco" && user.Sacco != nil {
-			routeQuery = routeQuery.Where("sacco_id = ?", user.Sacco.ID)
-		}
-		if err := routeQuery.First(&newRoute).Error; err != nil {
+		if err := tenant.Scoped(tx).First(&newRoute, *updateInput.RouteID).Error; err != nil {
 			tx.Rollback()
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Assigned route not found or does not belong to this Sacco."})
+				apierror.Respond(c, http.StatusBadRequest, "Assigned route not found or does not belong to this Sacco.")
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error validating new route: " + err.Error()})
+				apierror.Fail(c, apierror.Internal("Database error validating new route", err))
 			}
 			return
 		}
@@ -302,12 +351,22 @@ func UpdateVehicle(c *gin.Context) {
 
 	if err := tx.Save(&vehicle).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vehicle details: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Failed to update vehicle details", err))
 		return
 	}
 
+	if newDriverID != nil && *newDriverID != vehicle.DriverID {
+		if _, err := assignDriver(tx, &vehicle, *newDriverID, false); err != nil {
+			tx.Rollback()
+			if !respondAssignmentError(c, err) {
+				apierror.Fail(c, apierror.Internal("Failed to assign driver", err))
+			}
+			return
+		}
+	}
+
 	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not commit transaction: " + err.Error()})
+		apierror.Fail(c, apierror.Internal("Could not commit transaction", err))
 		return
 	}
 
@@ -316,44 +375,42 @@ func UpdateVehicle(c *gin.Context) {
 
 // DeleteVehicle removes a vehicle, restricted to Sacco owners or Admins.
 func DeleteVehicle(c *gin.Context) {
-	authenticatedUserID := uint(c.MustGet("user_id").(float64))
 	vehIDStr := c.Param("id")
 
-	var user models.User
-	if err := config.DB.Preload("Sacco").First(&user, authenticatedUserID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authenticated user not found."})
+	tenant, ok := authenticatedTenant(c, "DeleteVehicle")
+	if !ok {
 		return
 	}
 
-	if user.Role != "sacco" && user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only Sacco owners or administrators can delete vehicles."})
+	if tenant.Sacco == nil && !tenant.Admin() {
+		apierror.Respond(c, http.StatusForbidden, "Only Sacco owners or administrators can delete vehicles.")
 		return
 	}
 
 	vehID, err := strconv.ParseUint(vehIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Vehicle ID format."})
+		apierror.Respond(c, http.StatusBadRequest, "Invalid Vehicle ID format.")
 		return
 	}
 
 	var vehicle models.Vehicle
-	query := config.DB.Where("id = ?", uint(vehID))
-
-	if user.Role == "sacco" && user.Sacco != nil {
-		query = query.Where("sacco_id = ?", user.Sacco.ID)
-	}
-
-	if err := query.First(&vehicle).Error; err != nil {
+	if err := tenant.Scoped(config.DB).First(&vehicle, uint(vehID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Vehicle not found or not assigned to your Sacco."})
+			apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error fetching vehicle for deletion: " + err.Error()})
+			apierror.Fail(c, apierror.Internal("Database error fetching vehicle for deletion", err))
 		}
 		return
 	}
 
-	if err := config.DB.Delete(&vehicle).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vehicle: " + err.Error()})
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&vehicle).Error; err != nil {
+			return err
+		}
+		return attribution.Record(tx, vehicle.ID, vehicle.SaccoID, 0, models.AssignmentRegular, time.Now())
+	})
+	if err != nil {
+		apierror.Fail(c, apierror.Internal("Failed to delete vehicle", err))
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Vehicle deleted successfully."})
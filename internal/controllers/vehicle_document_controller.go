@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/compliance"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/storage"
+)
+
+// vehicleDocumentInput is the body for creating or updating a document.
+// Dates are YYYY-MM-DD or RFC 3339.
+type vehicleDocumentInput struct {
+	Type      *string `json:"type"`
+	Number    *string `json:"number"`
+	IssuedAt  *string `json:"issued_at"`
+	ExpiresAt *string `json:"expires_at"`
+}
+
+// parseDocumentDate accepts a YYYY-MM-DD date or an RFC 3339 timestamp.
+func parseDocumentDate(raw string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD date", raw)
+}
+
+// apply copies the provided fields onto doc and validates the result.
+func (in vehicleDocumentInput) apply(doc *models.VehicleDocument) error {
+	if in.Type != nil {
+		doc.Type = strings.TrimSpace(*in.Type)
+	}
+	if in.Number != nil {
+		doc.Number = strings.TrimSpace(*in.Number)
+	}
+	if in.IssuedAt != nil {
+		t, err := parseDocumentDate(*in.IssuedAt)
+		if err != nil {
+			return fmt.Errorf("issued_at: %w", err)
+		}
+		doc.IssuedAt = t
+	}
+	if in.ExpiresAt != nil {
+		t, err := parseDocumentDate(*in.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("expires_at: %w", err)
+		}
+		doc.ExpiresAt = t
+	}
+	switch {
+	case !compliance.ValidType(doc.Type):
+		return fmt.Errorf("type must be one of %s", strings.Join(compliance.Types, ", "))
+	case doc.ExpiresAt.IsZero():
+		return errors.New("expires_at is required")
+	case !doc.IssuedAt.IsZero() && !doc.ExpiresAt.After(doc.IssuedAt):
+		return errors.New("expires_at must be after issued_at")
+	}
+	return nil
+}
+
+// documentResponse adds a short-lived link to the scanned file, if any.
+func documentResponse(doc models.VehicleDocument) gin.H {
+	out := gin.H{
+		"ID":         doc.ID,
+		"CreatedAt":  doc.CreatedAt,
+		"UpdatedAt":  doc.UpdatedAt,
+		"vehicle_id": doc.VehicleID,
+		"type":       doc.Type,
+		"number":     doc.Number,
+		"issued_at":  doc.IssuedAt,
+		"expires_at": doc.ExpiresAt,
+		"expired":    !doc.ExpiresAt.After(time.Now()),
+	}
+	if doc.FileKey != "" {
+		link, expires := storage.SignedURL(doc.FileKey, mediaLinkTTL)
+		out["file_url"] = link
+		out["file_url_expires_at"] = expires
+	}
+	return out
+}
+
+// refreshCompliance re-evaluates the vehicle after its documents changed so
+// its status does not wait for the next scheduled check.
+func refreshCompliance(fn string, vehicleID uint) {
+	var vehicle models.Vehicle
+	if err := config.DB.First(&vehicle, vehicleID).Error; err != nil {
+		logrus.WithError(err).WithField("vehicle_id", vehicleID).Warn(fn + ": Failed to load vehicle for compliance refresh.")
+		return
+	}
+	if _, _, err := compliance.Refresh(config.DB, &vehicle, time.Now()); err != nil {
+		logrus.WithError(err).WithField("vehicle_id", vehicleID).Warn(fn + ": Failed to refresh vehicle compliance.")
+	}
+}
+
+// loadSaccoVehicleDocument loads the document named by :id if it belongs to the authenticated sacco.
+func loadSaccoVehicleDocument(c *gin.Context, fn string) (models.VehicleDocument, bool) {
+	return loadOwned[models.VehicleDocument](c, fn, "Document", config.DB)
+}
+
+// ListVehicleDocuments returns the documents held for one of the sacco's vehicles.
+func ListVehicleDocuments(c *gin.Context) {
+	vehicleID, ok := parseUintParam(c, "id", "ListVehicleDocuments")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "ListVehicleDocuments")
+	if !ok {
+		return
+	}
+	var docs []models.VehicleDocument
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("vehicle_id = ?", vehicleID).Order("expires_at DESC").Find(&docs).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicleID).Error("ListVehicleDocuments: Failed to load documents.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load documents")
+		return
+	}
+	out := make([]gin.H, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, documentResponse(d))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// ListSaccoExpiringDocuments lists the sacco's documents that have expired or
+// expire within ?within_days= (default 30), soonest first.
+func ListSaccoExpiringDocuments(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "ListSaccoExpiringDocuments")
+	if !ok {
+		return
+	}
+	days := 30
+	if raw := c.Query("within_days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			apierror.Respond(c, http.StatusBadRequest, "within_days must be a non-negative integer")
+			return
+		}
+		days = n
+	}
+	// Superseded documents are skipped: only the latest expiry per vehicle and type counts.
+	var docs []models.VehicleDocument
+	err := config.DB.Raw(`
+		SELECT DISTINCT ON (vehicle_id, type) *
+		FROM vehicle_documents
+		WHERE sacco_id = $1 AND deleted_at IS NULL
+		ORDER BY vehicle_id, type, expires_at DESC`, sacco.ID).Scan(&docs).Error
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ListSaccoExpiringDocuments: Failed to load documents.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load documents")
+		return
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ExpiresAt.Before(docs[j].ExpiresAt) })
+	cutoff := time.Now().AddDate(0, 0, days)
+	out := make([]gin.H, 0)
+	for _, d := range docs {
+		if d.ExpiresAt.After(cutoff) {
+			continue
+		}
+		out = append(out, documentResponse(d))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out, "within_days": days})
+}
+
+// CreateVehicleDocument records a compliance document for one of the sacco's vehicles.
+func CreateVehicleDocument(c *gin.Context) {
+	vehicleID, ok := parseUintParam(c, "id", "CreateVehicleDocument")
+	if !ok {
+		return
+	}
+	tenant, ok := saccoTenant(c, "CreateVehicleDocument")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var vehicle models.Vehicle
+	if err := config.DB.Scopes(tenant.SaccoScope).Where("id = ?", vehicleID).First(&vehicle).Error; err != nil {
+		apierror.Respond(c, http.StatusNotFound, "Vehicle not found or not assigned to your Sacco.")
+		return
+	}
+	var input vehicleDocumentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	doc := models.VehicleDocument{VehicleID: vehicle.ID, SaccoID: sacco.ID}
+	if err := input.apply(&doc); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.DB.Create(&doc).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("CreateVehicleDocument: Failed to save document.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save document")
+		return
+	}
+	refreshCompliance("CreateVehicleDocument", vehicle.ID)
+	c.JSON(http.StatusCreated, gin.H{"data": documentResponse(doc)})
+}
+
+// UpdateVehicleDocument corrects a document's details.
+func UpdateVehicleDocument(c *gin.Context) {
+	doc, ok := loadSaccoVehicleDocument(c, "UpdateVehicleDocument")
+	if !ok {
+		return
+	}
+	var input vehicleDocumentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if err := input.apply(&doc); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.DB.Save(&doc).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("document_id", doc.ID).Error("UpdateVehicleDocument: Failed to save document.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save document")
+		return
+	}
+	refreshCompliance("UpdateVehicleDocument", doc.VehicleID)
+	c.JSON(http.StatusOK, gin.H{"data": documentResponse(doc)})
+}
+
+// DeleteVehicleDocument removes a document and its scanned file.
+func DeleteVehicleDocument(c *gin.Context) {
+	doc, ok := loadSaccoVehicleDocument(c, "DeleteVehicleDocument")
+	if !ok {
+		return
+	}
+	if err := config.DB.Delete(&doc).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("document_id", doc.ID).Error("DeleteVehicleDocument: Failed to delete document.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete document")
+		return
+	}
+	if doc.FileKey != "" {
+		if err := storage.Default().Delete(c.Request.Context(), doc.FileKey); err != nil {
+			logrus.WithContext(c).WithError(err).WithField("key", doc.FileKey).Warn("DeleteVehicleDocument: Failed to delete document file.")
+		}
+	}
+	refreshCompliance("DeleteVehicleDocument", doc.VehicleID)
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted"})
+}
+
+// UploadVehicleDocumentFile stores a PDF, PNG or JPEG scan (max 5 MiB) of the
+// document from the "file" form field. Scans are only served through signed links.
+func UploadVehicleDocumentFile(c *gin.Context) {
+	doc, ok := loadSaccoVehicleDocument(c, "UploadVehicleDocumentFile")
+	if !ok {
+		return
+	}
+	data, contentType, ext, ok := readUpload(c, scanUpload)
+	if !ok {
+		return
+	}
+	key := fmt.Sprintf("vehicle-documents/%d/%d/%d-%s%s", doc.SaccoID, doc.VehicleID, doc.ID, storage.RandomName(), ext)
+	if !replaceStoredFile(c, "UploadVehicleDocumentFile", &doc, "file_key", doc.FileKey, key, data, contentType) {
+		return
+	}
+	doc.FileKey = key
+	c.JSON(http.StatusOK, gin.H{"data": documentResponse(doc)})
+}
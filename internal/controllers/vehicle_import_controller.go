@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/spreadsheet"
+)
+
+const (
+	maxBulkImportBytes = 5 << 20 // 5 MiB
+	maxBulkImportRows  = 1000
+)
+
+// Recognised header names for each vehicle import column.
+var vehicleImportColumns = map[string][]string{
+	"vehicle_no":     {"vehicle_no", "fleet_no", "fleet_number", "vehicle_number"},
+	"registration":   {"vehicle_registration", "registration", "reg_no", "number_plate", "plate"},
+	"driver_id":      {"driver_id"},
+	"driver_license": {"driver_license", "driver_license_number", "license_number"},
+	"route_id":       {"route_id"},
+	"route":          {"route", "route_name"},
+	"capacity":       {"capacity", "seats"},
+	"wheelchair":     {"wheelchair"},
+	"low_step":       {"low_step"},
+}
+
+// importRowResult is one line of a bulk import report.
+type importRowResult struct {
+	Row    int      `json:"row"`
+	Key    string   `json:"key,omitempty"` // What identifies the row, e.g. the registration
+	Status string   `json:"status"`        // "created", "valid" (dry run) or "error"
+	ID     uint     `json:"id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+
+	// Credentials holds one-time sign-in details for created accounts.
+	Credentials gin.H `json:"credentials,omitempty"`
+}
+
+func (r *importRowResult) fail(msg string) {
+	r.Errors = append(r.Errors, msg)
+}
+
+// importReport summarises a bulk import.
+func importReport(dryRun bool, rows []importRowResult) gin.H {
+	succeeded, failed := 0, 0
+	for _, r := range rows {
+		if r.Status == "error" {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+	key := "created"
+	if dryRun {
+		key = "valid"
+	}
+	return gin.H{"dry_run": dryRun, "total": len(rows), key: succeeded, "failed": failed, "rows": rows}
+}
+
+// readBulkUpload reads the "file" form field as a CSV or XLSX sheet.
+func readBulkUpload(c *gin.Context, fn string) (spreadsheet.Sheet, bool) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "file is required")
+		return spreadsheet.Sheet{}, false
+	}
+	if fileHeader.Size > maxBulkImportBytes {
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, "file must be 5 MiB or smaller")
+		return spreadsheet.Sheet{}, false
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "could not read file")
+		return spreadsheet.Sheet{}, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBulkImportBytes+1))
+	if err != nil || len(data) > maxBulkImportBytes {
+		apierror.Respond(c, http.StatusBadRequest, "could not read file")
+		return spreadsheet.Sheet{}, false
+	}
+	sheet, err := spreadsheet.Read(fileHeader.Filename, data, maxBulkImportRows)
+	if err != nil {
+		if errors.Is(err, spreadsheet.ErrUnsupportedFormat) {
+			apierror.Respond(c, http.StatusUnsupportedMediaType, err.Error())
+		} else {
+			logrus.WithContext(c).WithError(err).Warn(fn + ": Failed to parse upload.")
+			apierror.Respond(c, http.StatusUnprocessableEntity, err.Error())
+		}
+		return sheet, false
+	}
+	return sheet, true
+}
+
+// parseImportBool reads an optional yes/no cell.
+func parseImportBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "", "0", "false", "no", "n":
+		return false, nil
+	case "1", "true", "yes", "y":
+		return true, nil
+	}
+	return false, errors.New("must be yes or no")
+}
+
+// normalizeRegistration compares number plates regardless of spacing and case.
+func normalizeRegistration(reg string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(reg))
+}
+
+// ImportVehicles creates vehicles in bulk from a CSV or XLSX sheet (multipart
+// field "file") with columns vehicle_no, vehicle_registration, route_id or
+// route (name), and optionally driver_id or driver_license, capacity,
+// wheelchair and low_step. Each row is validated and created on its own, so
+// one bad row does not block the rest; ?dry_run=true only validates. The
+// response reports the outcome of every row.
+func ImportVehicles(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ImportVehicles")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	dryRun := c.Query("dry_run") == "true"
+	sheet, ok := readBulkUpload(c, "ImportVehicles")
+	if !ok {
+		return
+	}
+	cols := sheet.Columns(vehicleImportColumns)
+	switch {
+	case !cols.Has("vehicle_no"):
+		apierror.Respond(c, http.StatusUnprocessableEntity, "file must have a vehicle_no column")
+		return
+	case !cols.Has("registration"):
+		apierror.Respond(c, http.StatusUnprocessableEntity, "file must have a vehicle_registration column")
+		return
+	case !cols.Has("route_id") && !cols.Has("route"):
+		apierror.Respond(c, http.StatusUnprocessableEntity, "file must have a route_id or route column")
+		return
+	}
+
+	// Load everything rows may refer to up front rather than per row.
+	var drivers []models.Driver
+	if err := config.DB.Scopes(tenant.SaccoScope).Find(&drivers).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ImportVehicles: Failed to load drivers.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load drivers")
+		return
+	}
+	var routes []models.Route
+	if err := config.DB.Select("id", "name").Scopes(tenant.SaccoScope).Find(&routes).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ImportVehicles: Failed to load routes.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load routes")
+		return
+	}
+	driversByID, driversByLicense := map[uint]models.Driver{}, map[string][]models.Driver{}
+	for _, d := range drivers {
+		driversByID[d.ID] = d
+		if d.LicenseNumber != "" {
+			key := strings.ToUpper(strings.TrimSpace(d.LicenseNumber))
+			driversByLicense[key] = append(driversByLicense[key], d)
+		}
+	}
+	routesByID, routesByName := map[uint]bool{}, map[string][]uint{}
+	for _, r := range routes {
+		routesByID[r.ID] = true
+		key := strings.ToLower(strings.TrimSpace(r.Name))
+		routesByName[key] = append(routesByName[key], r.ID)
+	}
+	var regs []string
+	for _, row := range sheet.Rows {
+		if reg := normalizeRegistration(cols.Get(row, "registration")); reg != "" {
+			regs = append(regs, reg)
+		}
+	}
+	taken := map[string]bool{}
+	if len(regs) > 0 {
+		var existing []string
+		if err := config.DB.Model(&models.Vehicle{}).
+			Where("UPPER(REPLACE(REPLACE(vehicle_registration, ' ', ''), '-', '')) IN ?", regs).
+			Pluck("vehicle_registration", &existing).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ImportVehicles: Failed to check registrations.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to check registrations")
+			return
+		}
+		for _, reg := range existing {
+			taken[normalizeRegistration(reg)] = true
+		}
+	}
+
+	seenRegs, seenDrivers := map[string]int{}, map[uint]int{}
+	results := make([]importRowResult, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		res := importRowResult{Row: row.Line, Status: "error"}
+		vehicle := models.Vehicle{SaccoID: sacco.ID, InService: true}
+		var driverID uint
+
+		vehicle.VehicleNo = cols.Get(row, "vehicle_no")
+		if vehicle.VehicleNo == "" {
+			res.fail("vehicle_no is required")
+		}
+		vehicle.VehicleRegistration = strings.ToUpper(cols.Get(row, "registration"))
+		res.Key = vehicle.VehicleRegistration
+		reg := normalizeRegistration(vehicle.VehicleRegistration)
+		switch {
+		case reg == "":
+			res.fail("vehicle_registration is required")
+		case taken[reg]:
+			res.fail("a vehicle with this registration already exists")
+		case seenRegs[reg] != 0:
+			res.fail("registration repeats row " + strconv.Itoa(seenRegs[reg]))
+		}
+
+		if raw := cols.Get(row, "route_id"); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil || !routesByID[uint(id)] {
+				res.fail("route_id " + raw + " is not one of your routes")
+			} else {
+				vehicle.RouteID = uint(id)
+			}
+		} else if name := cols.Get(row, "route"); name != "" {
+			switch ids := routesByName[strings.ToLower(name)]; len(ids) {
+			case 0:
+				res.fail("route " + strconv.Quote(name) + " is not one of your routes")
+			case 1:
+				vehicle.RouteID = ids[0]
+			default:
+				res.fail("several routes are named " + strconv.Quote(name) + "; use route_id")
+			}
+		} else {
+			res.fail("route_id or route is required")
+		}
+
+		if raw := cols.Get(row, "driver_id"); raw != "" {
+			id, err := strconv.ParseUint(raw, 10, 64)
+			if _, ok := driversByID[uint(id)]; err != nil || !ok {
+				res.fail("driver_id " + raw + " is not one of your drivers")
+			} else {
+				driverID = uint(id)
+			}
+		} else if license := cols.Get(row, "driver_license"); license != "" {
+			switch matches := driversByLicense[strings.ToUpper(license)]; len(matches) {
+			case 0:
+				res.fail("no driver of yours has license " + license)
+			case 1:
+				driverID = matches[0].ID
+			default:
+				res.fail("several drivers have license " + license + "; use driver_id")
+			}
+		}
+		if driverID != 0 {
+			switch {
+			case driversByID[driverID].VehicleID != 0:
+				res.fail("driver is already assigned to another vehicle")
+			case seenDrivers[driverID] != 0:
+				res.fail("driver is already assigned in row " + strconv.Itoa(seenDrivers[driverID]))
+			}
+		}
+
+		if raw := cols.Get(row, "capacity"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				res.fail("capacity must be a whole number of seats")
+			} else {
+				vehicle.Capacity = n
+			}
+		}
+		var err error
+		if vehicle.Amenities.Wheelchair, err = parseImportBool(cols.Get(row, "wheelchair")); err != nil {
+			res.fail("wheelchair " + err.Error())
+		}
+		if vehicle.Amenities.LowStep, err = parseImportBool(cols.Get(row, "low_step")); err != nil {
+			res.fail("low_step " + err.Error())
+		}
+
+		// Later rows are checked against this one even if it fails, so a
+		// repeated registration is reported on every copy after the first.
+		if reg != "" && seenRegs[reg] == 0 {
+			seenRegs[reg] = row.Line
+		}
+		if driverID != 0 && seenDrivers[driverID] == 0 {
+			seenDrivers[driverID] = row.Line
+		}
+		if len(res.Errors) > 0 {
+			results = append(results, res)
+			continue
+		}
+		if dryRun {
+			res.Status = "valid"
+			results = append(results, res)
+			continue
+		}
+
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&vehicle).Error; err != nil {
+				return err
+			}
+			if driverID == 0 {
+				return nil
+			}
+			_, err := assignDriver(tx, &vehicle, driverID, false)
+			return err
+		})
+		if err != nil {
+			var conflict *driverConflictError
+			if errors.As(err, &conflict) {
+				res.fail("driver is already assigned to another vehicle")
+			} else {
+				logrus.WithContext(c).WithError(err).WithFields(logrus.Fields{"sacco_id": sacco.ID, "row": row.Line}).Error("ImportVehicles: Failed to create vehicle.")
+				res.fail("failed to create vehicle")
+			}
+			results = append(results, res)
+			continue
+		}
+		res.Status, res.ID = "created", vehicle.ID
+		results = append(results, res)
+	}
+
+	report := importReport(dryRun, results)
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"sacco_id": sacco.ID,
+		"dry_run":  dryRun,
+		"rows":     len(results),
+		"failed":   report["failed"],
+	}).Info("ImportVehicles: Import processed.")
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var errInvalidTransition = errors.New("vehicle cannot move to that status")
+
+// respondServiceBlocked answers 409 and returns true when the vehicle cannot
+// be put in service, either because it is not active or because its
+// documents have expired.
+func respondServiceBlocked(c *gin.Context, vehicle models.Vehicle) bool {
+	msg, code := serviceBlock(vehicle)
+	if msg == "" {
+		return false
+	}
+	apierror.Fail(c, apierror.New(http.StatusConflict, msg).WithCode(code))
+	return true
+}
+
+// serviceBlock says why the vehicle cannot be put in service, or returns an
+// empty msg when it can.
+func serviceBlock(vehicle models.Vehicle) (msg, code string) {
+	switch {
+	case vehicle.Status != "" && vehicle.Status != models.VehicleActive:
+		return "Vehicle is " + vehicle.Status + " and cannot be put in service.", "vehicle_not_active"
+	case vehicle.SuspendedForCompliance:
+		return "Vehicle is suspended until its expired documents are renewed.", "compliance_suspended"
+	}
+	return "", ""
+}
+
+// changeVehicleStatus moves the vehicle, locked by the caller in tx, to
+// status to and records the change. It returns errInvalidTransition when
+// the lifecycle does not allow the move. vehicle is not updated.
+func changeVehicleStatus(tx *gorm.DB, vehicle *models.Vehicle, to, reason string, changedBy uint) (models.VehicleStatusChange, error) {
+	if !models.CanTransitionVehicle(vehicle.Status, to) {
+		return models.VehicleStatusChange{}, errInvalidTransition
+	}
+	updates := map[string]interface{}{"status": to, "in_service": false}
+	switch to {
+	case models.VehicleActive:
+		updates["in_service"] = !vehicle.SuspendedForCompliance
+	case models.VehicleRetired:
+		if vehicle.DriverID != 0 {
+			if _, err := assignDriver(tx, vehicle, 0, false); err != nil {
+				return models.VehicleStatusChange{}, err
+			}
+		}
+		updates["tracker_token_hash"] = ""
+		updates["tracker_token_issued_at"] = nil
+	}
+	change := models.VehicleStatusChange{
+		VehicleID:  vehicle.ID,
+		SaccoID:    vehicle.SaccoID,
+		FromStatus: vehicle.Status,
+		ToStatus:   to,
+		Reason:     strings.TrimSpace(reason),
+		ChangedBy:  changedBy,
+		ChangedAt:  time.Now(),
+	}
+	if err := tx.Model(vehicle).Updates(updates).Error; err != nil {
+		return change, err
+	}
+	return change, tx.Create(&change).Error
+}
+
+// SetVehicleStatus moves one of the sacco's vehicles through its lifecycle.
+// Body: {"status": "maintenance", "reason": "..."}. Leaving active takes the
+// vehicle out of service; returning to active puts it back unless its
+// documents have expired. Retiring is final: the driver is unassigned and the
+// tracker token revoked.
+func SetVehicleStatus(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "SetVehicleStatus")
+	if !ok {
+		return
+	}
+	var input struct {
+		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	to := strings.ToLower(strings.TrimSpace(input.Status))
+	if !models.ValidVehicleStatus(to) {
+		apierror.Respond(c, http.StatusBadRequest, "status must be one of active, maintenance, impounded, retired")
+		return
+	}
+
+	var change models.VehicleStatusChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, vehicle.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		change, err = changeVehicleStatus(tx, &vehicle, to, input.Reason, authenticatedUserID(c))
+		return err
+	})
+	if errors.Is(err, errInvalidTransition) {
+		apierror.Fail(c, apierror.New(http.StatusConflict, "Vehicle cannot move from "+vehicle.Status+" to "+to+".").
+			WithCode("invalid_transition").
+			WithDetail("allowed", models.VehicleTransitions(vehicle.Status)))
+		return
+	}
+	if err != nil {
+		if !respondAssignmentError(c, err) {
+			logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("SetVehicleStatus: Failed to change status.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to change vehicle status")
+		}
+		return
+	}
+	if err := config.DB.First(&vehicle, vehicle.ID).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Warn("SetVehicleStatus: Failed to reload vehicle.")
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{
+		"vehicle_id": vehicle.ID,
+		"from":       change.FromStatus,
+		"to":         change.ToStatus,
+	}).Info("SetVehicleStatus: Vehicle status changed.")
+	c.JSON(http.StatusOK, gin.H{"data": vehicle, "change": change})
+}
+
+// ListVehicleStatusChanges returns the lifecycle history of one of the
+// sacco's vehicles, newest first.
+func ListVehicleStatusChanges(c *gin.Context) {
+	vehicle, ok := saccoVehicle(c, "ListVehicleStatusChanges")
+	if !ok {
+		return
+	}
+	var changes []models.VehicleStatusChange
+	if err := config.DB.Where("vehicle_id = ?", vehicle.ID).Order("changed_at DESC").Find(&changes).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("vehicle_id", vehicle.ID).Error("ListVehicleStatusChanges: Failed to load history.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load status history")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":    changes,
+		"status":  vehicle.Status,
+		"allowed": models.VehicleTransitions(vehicle.Status),
+	})
+}
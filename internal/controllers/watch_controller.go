@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/eta"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/notify"
+)
+
+const (
+	maxActiveWatches   = 10
+	defaultWatchExpiry = 2 * time.Hour
+	maxWatchExpiry     = 24 * time.Hour
+)
+
+// watchPushChannel is the notify channel watch alerts are pushed on when one
+// is registered, in addition to the commuter's open WebSockets.
+const watchPushChannel = notify.PushChannel
+
+// watchInput is the body of CreateWatch. RouteID is optional and only
+// checked against the stage's route.
+type watchInput struct {
+	StageID          uint `json:"stage_id" binding:"required"`
+	RouteID          uint `json:"route_id"`
+	VehicleID        uint `json:"vehicle_id"`
+	WithinMinutes    int  `json:"within_minutes" binding:"required,min=1,max=60"`
+	ExpiresInMinutes int  `json:"expires_in_minutes" binding:"omitempty,min=1"`
+}
+
+// CreateWatch registers an alert for the authenticated commuter: "tell me
+// when vehicle_id (or any vehicle on the stage's route) is within_minutes of
+// stage_id". Watches fire once and lapse after expires_in_minutes (default
+// two hours).
+func CreateWatch(c *gin.Context) {
+	var input watchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	userID := authenticatedUserID(c)
+
+	var stage models.Stage
+	if err := config.DB.Joins("JOIN routes ON routes.id = stages.route_id AND routes.deleted_at IS NULL AND routes.status = ?", models.RouteStatusPublished).
+		First(&stage, input.StageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "Stage not found")
+		} else {
+			logrus.WithContext(c).WithError(err).WithField("stage_id", input.StageID).Error("CreateWatch: Failed to load stage.")
+			apierror.Respond(c, http.StatusInternalServerError, "Failed to load stage")
+		}
+		return
+	}
+	if input.RouteID != 0 && input.RouteID != stage.RouteID {
+		apierror.Respond(c, http.StatusBadRequest, "Stage is not on this route")
+		return
+	}
+	if input.VehicleID != 0 {
+		var vehicle models.Vehicle
+		if err := config.DB.Select("id", "route_id").First(&vehicle, input.VehicleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				apierror.Respond(c, http.StatusNotFound, "Vehicle not found")
+			} else {
+				logrus.WithContext(c).WithError(err).WithField("vehicle_id", input.VehicleID).Error("CreateWatch: Failed to load vehicle.")
+				apierror.Respond(c, http.StatusInternalServerError, "Failed to load vehicle")
+			}
+			return
+		}
+		if vehicle.RouteID != stage.RouteID {
+			apierror.Respond(c, http.StatusBadRequest, "Vehicle does not serve this stage's route")
+			return
+		}
+	}
+
+	now := time.Now()
+	var active int64
+	if err := config.DB.Model(&models.CommuterWatch{}).Where("user_id = ? AND triggered_at IS NULL AND expires_at > ?", userID, now).
+		Count(&active).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("CreateWatch: Failed to count watches.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save watch")
+		return
+	}
+	if active >= maxActiveWatches {
+		apierror.Respond(c, http.StatusConflict, fmt.Sprintf("At most %d watches can be active at once", maxActiveWatches))
+		return
+	}
+
+	expiry := defaultWatchExpiry
+	if input.ExpiresInMinutes > 0 {
+		expiry = time.Duration(input.ExpiresInMinutes) * time.Minute
+		if expiry > maxWatchExpiry {
+			expiry = maxWatchExpiry
+		}
+	}
+	watch := models.CommuterWatch{
+		UserID:        userID,
+		RouteID:       stage.RouteID,
+		StageID:       stage.ID,
+		VehicleID:     input.VehicleID,
+		WithinMinutes: input.WithinMinutes,
+		ExpiresAt:     now.Add(expiry),
+	}
+	if err := config.DB.Create(&watch).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("CreateWatch: Failed to save watch.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save watch")
+		return
+	}
+	watch.Stage = &stage
+	c.JSON(http.StatusCreated, gin.H{"data": watch})
+}
+
+// ListWatches returns the authenticated commuter's watches, newest first.
+// ?active=true limits it to ones that can still fire.
+func ListWatches(c *gin.Context) {
+	userID := authenticatedUserID(c)
+	query := config.DB.Preload("Stage").Where("user_id = ?", userID)
+	if c.Query("active") == "true" {
+		query = query.Where("triggered_at IS NULL AND expires_at > ?", time.Now())
+	}
+	var watches []models.CommuterWatch
+	if err := query.Order("created_at DESC").Limit(100).Find(&watches).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("user_id", userID).Error("ListWatches: Failed to load watches.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load watches")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": watches})
+}
+
+// DeleteWatch cancels one of the authenticated commuter's watches.
+func DeleteWatch(c *gin.Context) {
+	watchID, ok := parseUintParam(c, "id", "DeleteWatch")
+	if !ok {
+		return
+	}
+	res := config.DB.Where("id = ? AND user_id = ?", watchID, authenticatedUserID(c)).Delete(&models.CommuterWatch{})
+	if res.Error != nil {
+		logrus.WithContext(c).WithError(res.Error).Error("DeleteWatch: Failed to delete watch.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete watch")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "Watch not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Watch deleted successfully"})
+}
+
+// checkWatches fires the route's active watches that the vehicle's new ETAs
+// satisfy. It runs for every point published with ETAs.
+func checkWatches(vehicleID, routeID uint, etas []eta.StageETA) {
+	if len(etas) == 0 {
+		return
+	}
+	now := time.Now()
+	var watches []models.CommuterWatch
+	if err := config.DB.Where("route_id = ? AND expires_at > ? AND triggered_at IS NULL AND (vehicle_id = 0 OR vehicle_id = ?)", routeID, now, vehicleID).
+		Find(&watches).Error; err != nil {
+		logrus.WithError(err).WithField("route_id", routeID).Error("checkWatches: Failed to load watches.")
+		return
+	}
+	for _, w := range watches {
+		for _, e := range etas {
+			if e.StageID != w.StageID || e.Seconds > float64(w.WithinMinutes)*60 {
+				continue
+			}
+			// Claiming the watch in the database keeps replicas from firing it twice.
+			res := config.DB.Model(&models.CommuterWatch{}).Where("id = ? AND triggered_at IS NULL", w.ID).
+				Updates(map[string]interface{}{"triggered_at": now, "triggered_vehicle_id": vehicleID, "triggered_eta": e.Seconds})
+			if res.Error != nil {
+				logrus.WithError(res.Error).WithField("watch_id", w.ID).Error("checkWatches: Failed to mark watch triggered.")
+			} else if res.RowsAffected == 1 {
+				publishWatchAlert(w, vehicleID, e)
+			}
+			break
+		}
+	}
+}
+
+// publishWatchAlert sends a fired watch to the commuter's open WebSockets on
+// every replica and, when a push channel is registered, to their devices.
+func publishWatchAlert(w models.CommuterWatch, vehicleID uint, e eta.StageETA) {
+	minutes := int(math.Ceil(e.Seconds / 60))
+	var vehicleNo string
+	config.DB.Model(&models.Vehicle{}).Where("id = ?", vehicleID).Limit(1).Pluck("vehicle_no", &vehicleNo)
+
+	locationHub.PublishLocation(map[string]interface{}{
+		"type":              "watch_alert",
+		"recipient_user_id": float64(w.UserID),
+		"watch_id":          w.ID,
+		"vehicle_id":        vehicleID,
+		"vehicle_no":        vehicleNo,
+		"route_id":          w.RouteID,
+		"stage_id":          w.StageID,
+		"stage_name":        e.Name,
+		"eta_seconds":       e.Seconds,
+		"arrival_at":        e.ArrivalAt.Format(time.RFC3339Nano),
+		"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+	})
+
+	ch, ok := notify.Lookup(watchPushChannel)
+	if !ok {
+		return
+	}
+	title := "Your matatu is almost there"
+	body := fmt.Sprintf("%s is about %d min from %s.", vehicleNo, minutes, e.Name)
+	if vehicleNo == "" {
+		body = fmt.Sprintf("A vehicle is about %d min from %s.", minutes, e.Name)
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		msg := notify.Message{ID: w.ID, Title: title, Body: body, Data: map[string]string{
+			"type":       "watch_alert",
+			"watch_id":   strconv.FormatUint(uint64(w.ID), 10),
+			"vehicle_id": strconv.FormatUint(uint64(vehicleID), 10),
+			"stage_id":   strconv.FormatUint(uint64(w.StageID), 10),
+		}}
+		if err := ch.Send(ctx, notify.Recipient{UserID: w.UserID}, msg); err != nil && !errors.Is(err, notify.ErrUnreachable) {
+			logrus.WithError(err).WithField("watch_id", w.ID).Warn("publishWatchAlert: Failed to push watch alert.")
+		}
+	}()
+}
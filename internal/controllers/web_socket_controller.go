@@ -17,9 +17,15 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"ma3_tracker/internal/apierror"
 	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
 	"ma3_tracker/internal/middleware"
 	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/pubsub"
+	"ma3_tracker/internal/wsproto"
 )
 
 // upgrader configures the WebSocket connection.
@@ -29,6 +35,8 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all for development (restrict in production!)
 	},
+	Subprotocols:      []string{subprotocolProto, subprotocolJSON},
+	EnableCompression: wsCompression, // permessage-deflate, when the client offers it
 }
 
 // LocationData struct defines the format of incoming JSON from Flutter (driver's update).
@@ -81,84 +89,237 @@ func (ld *LocationData) UnmarshalJSON(data []byte) error {
 }
 
 // LocationHub manages active WebSocket connections for Sacco monitoring and broadcasts updates.
+// Commuters may instead follow a route or a single vehicle.
 type LocationHub struct {
-	saccoClients map[uint]map[*websocket.Conn]bool
+	saccoClients map[uint]map[*websocket.Conn]*wsClient
+	followers    map[followKey]map[*websocket.Conn]*wsClient
+	areaClients  map[*websocket.Conn]*wsClient // Commuters watching a viewport across saccos
+	lastSeen     map[uint]geo.Point            // Latest broadcast position per vehicle, to place messages without one
 	broadcast    chan map[string]interface{}
+	outbound     chan map[string]interface{} // Set when broadcasts go through a bus
+	bus          pubsub.Bus
 	mu           sync.Mutex
+
+	routesMu      sync.Mutex
+	vehicleRoutes map[uint]vehicleRoute // Cached vehicle -> route lookups
+}
+
+// followKey is what a commuter follows: a route ("route_id") or a single
+// vehicle ("vehicle_id").
+type followKey struct {
+	Field string
+	ID    uint
 }
 
+// vehicleRoute is a cached lookup of the route a vehicle serves.
+type vehicleRoute struct {
+	routeID uint
+	at      time.Time
+}
+
+// vehicleRouteTTL bounds how long a reassigned vehicle keeps reaching its old
+// route's subscribers.
+const vehicleRouteTTL = 30 * time.Second
+
 // NewLocationHub creates and returns a new LocationHub instance.
 // It also starts a goroutine to continuously run the broadcasting logic.
 func NewLocationHub() *LocationHub {
 	hub := &LocationHub{
-		saccoClients: make(map[uint]map[*websocket.Conn]bool),
-		broadcast:    make(chan map[string]interface{}, 100),
+		saccoClients:  make(map[uint]map[*websocket.Conn]*wsClient),
+		followers:     make(map[followKey]map[*websocket.Conn]*wsClient),
+		areaClients:   make(map[*websocket.Conn]*wsClient),
+		lastSeen:      make(map[uint]geo.Point),
+		broadcast:     make(chan map[string]interface{}, 100),
+		vehicleRoutes: make(map[uint]vehicleRoute),
 	}
 	go hub.run() // Start the goroutine for broadcasting messages
+	go hub.reapStale()
+	go hub.sweepVehicleRoutes()
 	return hub
 }
 
-// run listens for messages on the broadcast channel and sends them to relevant Sacco clients.
+// run listens for messages on the broadcast channel and sends them to relevant Sacco clients
+// and to the followers of the message's vehicle and of the route it serves.
+// Clients with a viewport only get messages about vehicles inside it.
 func (h *LocationHub) run() {
 	for msg := range h.broadcast {
+		hubMetrics.broadcasts.Add(1)
+		vehicleID, routeID := h.followTargets(msg)
 		h.mu.Lock()
+		// Messages for one commuter (see publishWatchAlert) go nowhere else.
+		if userID := messageID(msg["recipient_user_id"]); userID != 0 {
+			h.sendToUser(userID, msg)
+			h.mu.Unlock()
+			continue
+		}
 		// sacco_id is now explicitly float64 when put into broadcast map,
 		// so this type assertion should always succeed if data is present.
-		msgSaccoIDFloat, ok := msg["sacco_id"].(float64)
+		msgSaccoIDFloat, ok := msg["sacco_id"].(float64) // Also what JSON from other replicas decodes to
 		if !ok {
 			logrus.Warn("Broadcast message missing 'sacco_id' or has wrong type (expected float64). Skipping broadcast.")
 			h.mu.Unlock()
 			continue
 		}
 		msgSaccoID := uint(msgSaccoIDFloat)
+		at, located := messagePoint(msg)
+		if vehicleID != 0 {
+			if located {
+				h.lastSeen[vehicleID] = at
+			} else {
+				at, located = h.lastSeen[vehicleID]
+			}
+		}
+		public := commuterVisible(msg)
+		inView := func(client *wsClient) bool {
+			return client.area == nil || !located || client.area.contains(at)
+		}
 
-		if clients, exists := h.saccoClients[msgSaccoID]; exists {
-			for conn := range clients {
-				// FIX: Changed parameter name from 'm' to 'broadcastMessage' to resolve potential undefined issue.
-				// Explicitly pass msg into the goroutine to avoid common closure issues.
-				go func(c *websocket.Conn, broadcastMessage map[string]interface{}) { 
-					err := c.WriteJSON(broadcastMessage) // Use the new parameter name here
-					if err != nil {
-						if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) {
-							logrus.WithFields(logrus.Fields{
-								"sacco_id": msgSaccoID,
-								"conn_ptr": fmt.Sprintf("%p", c),
-							}).Info("Client connection closed during broadcast, unregistering.")
-							h.UnregisterClient(msgSaccoID, c)
-						} else {
-							logrus.WithError(err).WithFields(logrus.Fields{
-								"sacco_id": msgSaccoID,
-								"conn_ptr": fmt.Sprintf("%p", c),
-							}).Warn("Failed to send broadcast message to client.")
-						}
-					}
-				}(conn, msg) // Pass 'msg' (the current message from the channel) as 'broadcastMessage'
+		// Each client renders and writes the message on its own goroutine.
+		// Commuters watching a sacco only get what followers get.
+		for _, client := range h.saccoClients[msgSaccoID] {
+			if (public || !client.commuter) && inView(client) {
+				client.enqueue(msg)
+			}
+		}
+		for _, key := range []followKey{{"vehicle_id", vehicleID}, {"route_id", routeID}} {
+			if key.ID == 0 {
+				continue
+			}
+			for _, client := range h.followers[key] {
+				if inView(client) {
+					client.enqueue(msg)
+				}
+			}
+		}
+		if vehicleID != 0 && located {
+			for _, client := range h.areaClients {
+				if client.area.contains(at) {
+					client.enqueue(msg)
+				}
 			}
 		}
 		h.mu.Unlock()
 	}
 }
 
-// RegisterClient registers a new Sacco client connection with the hub.
-func (h *LocationHub) RegisterClient(saccoID uint, conn *websocket.Conn) {
+// commuterVisible reports whether a broadcast may go to commuters: location,
+// occupancy and stage updates. Alerts and SOS calls are for the sacco only.
+func commuterVisible(msg map[string]interface{}) bool {
+	switch t, _ := msg["type"].(string); t {
+	case "", "occupancy", "stage_arrival", "stage_departure":
+		return true
+	}
+	return false
+}
+
+// followTargets returns the vehicle a message is about and the route that
+// vehicle serves, as stamped by withRoute, zero when the message is not for
+// followers. Followers are commuters, so they only get commuterVisible updates.
+func (h *LocationHub) followTargets(msg map[string]interface{}) (vehicleID, routeID uint) {
+	if !commuterVisible(msg) {
+		return 0, 0
+	}
+	vehicleID = messageID(msg["vehicle_id"])
+	if vehicleID == 0 {
+		return 0, 0
+	}
+	return vehicleID, messageID(msg["route_id"])
+}
+
+// withRoute stamps a message for followers with the route its vehicle
+// serves, unless the publisher already did. It runs on the publisher's
+// goroutine so the broadcast loop never waits on the database, and before
+// the bus so other replicas need not look the route up again.
+func (h *LocationHub) withRoute(msg map[string]interface{}) map[string]interface{} {
+	if !commuterVisible(msg) || messageID(msg["route_id"]) != 0 {
+		return msg
+	}
+	if vehicleID := messageID(msg["vehicle_id"]); vehicleID != 0 {
+		if routeID := h.routeOf(vehicleID); routeID != 0 {
+			msg["route_id"] = routeID
+		}
+	}
+	return msg
+}
+
+// routeOf resolves the published route a vehicle serves, zero when it serves
+// none. It is looked up at publish time so reassignments take effect without
+// the publishers knowing about routes. The lookup runs outside routesMu, so a
+// cache miss only holds up its own publisher.
+func (h *LocationHub) routeOf(vehicleID uint) uint {
+	now := time.Now()
+	h.routesMu.Lock()
+	cached, ok := h.vehicleRoutes[vehicleID]
+	h.routesMu.Unlock()
+	if ok && now.Sub(cached.at) < vehicleRouteTTL {
+		return cached.routeID
+	}
+	var routeIDs []uint
+	published := config.DB.Model(&models.Route{}).Select("id").Where("status = ?", models.RouteStatusPublished)
+	if err := config.DB.Model(&models.Vehicle{}).Where("id = ? AND route_id IN (?)", vehicleID, published).Pluck("route_id", &routeIDs).Error; err != nil {
+		logrus.WithError(err).WithField("vehicle_id", vehicleID).Warn("LocationHub: Failed to resolve vehicle route.")
+		return 0
+	}
+	var routeID uint
+	if len(routeIDs) > 0 {
+		routeID = routeIDs[0]
+	}
+	h.routesMu.Lock()
+	h.vehicleRoutes[vehicleID] = vehicleRoute{routeID: routeID, at: now}
+	h.routesMu.Unlock()
+	return routeID
+}
+
+// sweepVehicleRoutes periodically drops expired route lookups, so vehicles
+// that stopped publishing do not stay cached.
+func (h *LocationHub) sweepVehicleRoutes() {
+	ticker := time.NewTicker(vehicleRouteTTL)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		h.expireVehicleRoutes(now)
+	}
+}
+
+// expireVehicleRoutes drops the route lookups older than vehicleRouteTTL.
+func (h *LocationHub) expireVehicleRoutes(now time.Time) {
+	h.routesMu.Lock()
+	defer h.routesMu.Unlock()
+	for id, cached := range h.vehicleRoutes {
+		if now.Sub(cached.at) >= vehicleRouteTTL {
+			delete(h.vehicleRoutes, id)
+		}
+	}
+}
+
+// RegisterClient registers a new Sacco client connection with the hub. A
+// snapshot of the sacco's vehicles is queued ahead of any broadcast.
+func (h *LocationHub) RegisterClient(saccoID uint, client *wsClient) {
+	conn := client.conn
+	if snapshot := snapshotMessage("sacco_id", saccoID, client.area, client.prefs); snapshot != nil {
+		client.enqueue(snapshot)
+	}
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if _, ok := h.saccoClients[saccoID]; !ok {
-		h.saccoClients[saccoID] = make(map[*websocket.Conn]bool)
+		h.saccoClients[saccoID] = make(map[*websocket.Conn]*wsClient)
 	}
-	h.saccoClients[saccoID][conn] = true
+	h.saccoClients[saccoID][conn] = client
 	logrus.WithFields(logrus.Fields{
 		"sacco_id": saccoID,
 		"conn_ptr": fmt.Sprintf("%p", conn),
 	}).Info("Client registered with LocationHub (Sacco or Commuter).")
 }
 
-// UnregisterClient removes a disconnected Sacco client connection from the hub.
+// UnregisterClient removes a disconnected Sacco client connection from the hub
+// and stops its writer.
 func (h *LocationHub) UnregisterClient(saccoID uint, conn *websocket.Conn) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if clients, ok := h.saccoClients[saccoID]; ok {
-		delete(clients, conn)
+		if client, ok := clients[conn]; ok {
+			client.stop()
+			delete(clients, conn)
+		}
 		if len(clients) == 0 {
 			delete(h.saccoClients, saccoID)
 			logrus.WithField("sacco_id", saccoID).Debug("Removed Sacco entry as no clients are left.")
@@ -170,18 +331,181 @@ func (h *LocationHub) UnregisterClient(saccoID uint, conn *websocket.Conn) {
 	}).Info("Client unregistered from LocationHub (Sacco or Commuter).")
 }
 
+// RegisterFollower subscribes a connection to a route or a single vehicle. A
+// snapshot of where the followed vehicles are is queued ahead of any broadcast.
+func (h *LocationHub) RegisterFollower(key followKey, client *wsClient) {
+	conn := client.conn
+	if snapshot := snapshotMessage(key.Field, key.ID, client.area, client.prefs); snapshot != nil {
+		client.enqueue(snapshot)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.followers[key]; !ok {
+		h.followers[key] = make(map[*websocket.Conn]*wsClient)
+	}
+	h.followers[key][conn] = client
+	logrus.WithFields(logrus.Fields{
+		key.Field:  key.ID,
+		"conn_ptr": fmt.Sprintf("%p", conn),
+	}).Info("Follower registered with LocationHub.")
+}
+
+// UnregisterFollower removes a route or vehicle subscription and stops its writer.
+func (h *LocationHub) UnregisterFollower(key followKey, conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if clients, ok := h.followers[key]; ok {
+		if client, ok := clients[conn]; ok {
+			client.stop()
+			delete(clients, conn)
+		}
+		if len(clients) == 0 {
+			delete(h.followers, key)
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		key.Field:  key.ID,
+		"conn_ptr": fmt.Sprintf("%p", conn),
+	}).Info("Follower unregistered from LocationHub.")
+}
+
 // PublishLocation publishes a new location update to the broadcast channel.
+// With a bus, it goes to every replica instead, this one included.
 func (h *LocationHub) PublishLocation(data map[string]interface{}) {
+	data = h.withRoute(data)
+	if h.outbound != nil {
+		select {
+		case h.outbound <- data:
+		default:
+			hubMetrics.dropped(dropBusQueue)
+			logrus.Warn("Location bus queue full, dropping message.")
+		}
+		return
+	}
+	h.deliver(data)
+}
+
+// urgentPublishTimeout bounds how long PublishUrgent waits for room in the
+// broadcast channel.
+const urgentPublishTimeout = 10 * time.Second
+
+// PublishUrgent publishes a message that must not be lost to a full queue,
+// such as an SOS. It goes to the bus straight away rather than through the
+// outbound queue, falling back to this replica's clients when the bus is
+// down, and waits for room in the broadcast channel instead of dropping it.
+func (h *LocationHub) PublishUrgent(data map[string]interface{}) {
+	data = h.withRoute(data)
+	if h.bus != nil {
+		payload, err := json.Marshal(data)
+		if err == nil {
+			if err = h.bus.Publish(payload); err == nil {
+				return
+			}
+		}
+		// Unlike a routine broadcast, it is delivered here even when it may
+		// have reached the bus: an SOS seen twice beats one never seen.
+		logrus.WithError(err).Warn("LocationHub: Failed to publish urgent message to bus, delivering locally.")
+	}
+	h.deliverUrgent(data)
+}
+
+// deliverUrgent queues a high-priority message for this replica's clients,
+// waiting up to urgentPublishTimeout for room.
+func (h *LocationHub) deliverUrgent(data map[string]interface{}) {
+	timer := time.NewTimer(urgentPublishTimeout)
+	defer timer.Stop()
+	select {
+	case h.broadcast <- data:
+	case <-timer.C:
+		hubMetrics.dropped(dropBroadcastChannel)
+		logrus.Error("LocationHub: Broadcast channel stayed full, dropping urgent message.")
+	}
+}
+
+// deliver queues a message for this replica's clients.
+func (h *LocationHub) deliver(data map[string]interface{}) {
 	select {
 	case h.broadcast <- data:
 		// Message sent to broadcast channel successfully.
 	default:
+		hubMetrics.dropped(dropBroadcastChannel)
 		logrus.Warn("Location broadcast channel full, dropping message. Consider increasing buffer size or processing rate.")
 	}
 }
 
+// UseBus shares the hub's broadcasts with other replicas through bus. Call it
+// once at startup, before clients connect.
+func (h *LocationHub) UseBus(bus pubsub.Bus) {
+	h.bus = bus
+	h.outbound = make(chan map[string]interface{}, 100)
+	bus.Subscribe(func(payload []byte) {
+		var msg map[string]interface{}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			logrus.WithError(err).Warn("LocationHub: Ignoring malformed bus message.")
+			return
+		}
+		if p, _ := msg["priority"].(string); p == wsproto.PriorityHigh {
+			h.deliverUrgent(msg)
+			return
+		}
+		h.deliver(msg)
+	})
+	go func() {
+		for msg := range h.outbound {
+			payload, err := json.Marshal(msg)
+			if err != nil {
+				logrus.WithError(err).Error("LocationHub: Failed to encode broadcast.")
+				continue
+			}
+			if err := bus.Publish(payload); errors.Is(err, pubsub.ErrNotSent) {
+				// Keep this replica's clients up to date while the bus is down.
+				logrus.WithError(err).Warn("LocationHub: Failed to publish to bus, delivering locally.")
+				h.deliver(msg)
+			} else if err != nil {
+				// Delivering it here too could show clients the update twice.
+				logrus.WithError(err).Warn("LocationHub: Broadcast may not have reached the bus.")
+			}
+		}
+	}()
+}
+
+// ConnectLocationHub attaches the bus configured in the environment (see
+// pubsub.FromEnv) to the location hub. Without one the hub stays in memory.
+func ConnectLocationHub() error {
+	bus, err := pubsub.FromEnv()
+	if err != nil || bus == nil {
+		return err
+	}
+	locationHub.UseBus(bus)
+	return nil
+}
+
+// messageID reads an ID from a broadcast message, which holds uint when
+// published locally and float64 when decoded from the bus.
+func messageID(v interface{}) uint {
+	switch id := v.(type) {
+	case uint:
+		return id
+	case float64:
+		return uint(id)
+	}
+	return 0
+}
+
 var locationHub = NewLocationHub()
 
+// localizeBroadcast returns a copy of a broadcast message with a "display" block
+// rendered in the client's preferred units and time zone. Canonical fields
+// (speed in m/s, UTC timestamp) are left untouched.
+func localizeBroadcast(msg map[string]interface{}, prefs format.Preferences) map[string]interface{} {
+	out := make(map[string]interface{}, len(msg)+1)
+	for k, v := range msg {
+		out[k] = v
+	}
+	out["display"] = format.Display(msg, prefs)
+	return out
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -189,16 +513,15 @@ func min(a, b int) int {
 	return b
 }
 
-// authenticateUserForWebSocket extracts and validates the JWT token from the Gin context,
+// authenticateUserForWebSocket validates the JWT token sent by the client,
 // determining the user's role (driver/sacco/commuter) and their associated IDs.
-func authenticateUserForWebSocket(c *gin.Context) (userID uint, role string, saccoID uint, driverID uint, err error) {
-	tokenString := c.Query("token")
+func authenticateUserForWebSocket(c *gin.Context, tokenString string) (userID uint, role string, saccoID uint, driverID uint, err error) {
 	if tokenString == "" {
-		logrus.Warn("WebSocket connection attempt: Missing token query parameter.")
+		logrus.WithContext(c).Warn("WebSocket connection attempt: Missing token.")
 		return 0, "", 0, 0, errors.New("missing authentication token")
 	}
 
-	logrus.WithField("token_snippet", tokenString[:min(len(tokenString), 30)]+"...").Debug("Received WebSocket connection request with token.")
+	logrus.WithContext(c).WithField("token_snippet", tokenString[:min(len(tokenString), 30)]+"...").Debug("Received WebSocket connection request with token.")
 
 	claims, err := middleware.ValidateToken(tokenString)
 	if err != nil {
@@ -208,51 +531,115 @@ func authenticateUserForWebSocket(c *gin.Context) (userID uint, role string, sac
 	userID = claims.UserID
 	role = claims.Role
 
+	// Guests have no user record; they may only watch a sacco like a commuter.
+	if role == middleware.RoleGuest {
+		saccoID, err = commuterSaccoID(c)
+		if err != nil {
+			return 0, "", 0, 0, err
+		}
+		return 0, role, saccoID, 0, nil
+	}
+
+	var user models.User
+	if err := principal.Lookup(&user, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, "", 0, 0, fmt.Errorf("user with ID %d not found", userID)
+		}
+		return 0, "", 0, 0, fmt.Errorf("database error fetching user for ID %d: %w", userID, err)
+	}
+	if user.Role != role {
+		return 0, "", 0, 0, fmt.Errorf("user with ID %d and role '%s' not found", userID, role)
+	}
+	if user.MustChangePassword {
+		return 0, "", 0, 0, errors.New("password change required")
+	}
+
 	switch role {
 	case "driver":
-		var driver models.Driver
-		if err := config.DB.Where("user_id = ?", userID).First(&driver).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return 0, "", 0, 0, fmt.Errorf("driver profile not found for user ID %d", userID)
-			}
-			return 0, "", 0, 0, fmt.Errorf("database error fetching driver profile for user ID %d: %w", userID, err)
+		if user.Driver == nil {
+			return 0, "", 0, 0, fmt.Errorf("driver profile not found for user ID %d", userID)
 		}
-		driverID = driver.ID
-		saccoID = driver.SaccoID
+		driverID = user.Driver.ID
+		saccoID = user.Driver.SaccoID
 	case "sacco":
-		var sacco models.Sacco
-		if err := config.DB.Where("user_id = ?", userID).First(&sacco).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return 0, "", 0, 0, fmt.Errorf("sacco profile not found for user ID %d", userID)
-			}
-			return 0, "", 0, 0, fmt.Errorf("database error fetching sacco profile for user ID %d: %w", userID, err)
+		if user.Sacco == nil {
+			return 0, "", 0, 0, fmt.Errorf("sacco profile not found for user ID %d", userID)
 		}
-		saccoID = sacco.ID
+		saccoID = user.Sacco.ID
 	case "commuter":
-		var user models.User
-		if err := config.DB.Where("id = ? AND role = ?", userID, role).First(&user).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return 0, "", 0, 0, fmt.Errorf("user with ID %d and role '%s' not found", userID, role)
-			}
-			return 0, "", 0, 0, fmt.Errorf("database error fetching user for ID %d: %w", userID, err)
-		}
-		
-		saccoIDString := c.Query("sacco_id")
-		if saccoIDString == "" {
-			return 0, "", 0, 0, errors.New("missing 'sacco_id' query parameter for commuter connection. Commuters must specify which Sacco they want to monitor.")
-		}
-		parsedSaccoID, err := strconv.ParseUint(saccoIDString, 10, 64)
+		saccoID, err = commuterSaccoID(c)
 		if err != nil {
-			return 0, "", 0, 0, fmt.Errorf("invalid 'sacco_id' parameter for commuter: %w", err)
+			return 0, "", 0, 0, err
 		}
-		saccoID = uint(parsedSaccoID)
 		driverID = 0
 	default:
-		return 0, "", 0, 0, errors.New("unauthorized role for WebSocket connection")
+		return 0, "", 0, 0, errWSRole
 	}
 	return userID, role, saccoID, driverID, nil
 }
 
+// commuterSaccoID reads the sacco a commuter or guest wants to monitor. It is
+// optional when they follow a route or vehicle, or watch an area, instead.
+func commuterSaccoID(c *gin.Context) (uint, error) {
+	saccoIDString := c.Query("sacco_id")
+	if saccoIDString == "" {
+		if c.Query("route_id") != "" || c.Query("vehicle_id") != "" || c.Query("bbox") != "" || c.Query("lat") != "" {
+			return 0, nil
+		}
+		return 0, errors.New("missing 'sacco_id' query parameter for commuter connection. Commuters must specify which Sacco they want to monitor.")
+	}
+	parsedSaccoID, err := strconv.ParseUint(saccoIDString, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid 'sacco_id' parameter for commuter: %w", err)
+	}
+	return uint(parsedSaccoID), nil
+}
+
+// commuterFollow reads the route or vehicle a commuter or guest wants to
+// follow. The key's ID is 0 when they monitor a whole sacco.
+func commuterFollow(c *gin.Context) (followKey, error) {
+	var key followKey
+	for _, field := range []string{"vehicle_id", "route_id"} {
+		raw := c.Query(field)
+		if raw == "" {
+			continue
+		}
+		if key.ID != 0 {
+			return followKey{}, errors.New("follow either a 'vehicle_id' or a 'route_id', not both")
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || id == 0 {
+			return followKey{}, fmt.Errorf("invalid '%s' parameter", field)
+		}
+		key = followKey{Field: field, ID: uint(id)}
+	}
+	return key, nil
+}
+
+// driverSession is a driver's live connection. Writes to it go through
+// writeWS, which serialises them, so other goroutines can message the driver
+// while their updates are being processed.
+type driverSession struct {
+	conn *websocket.Conn
+}
+
+var (
+	driverSessionsMu sync.RWMutex
+	driverSessions   = map[uint]*driverSession{}
+)
+
+// sendToDriver writes msg, a message of the given wsproto kind, to the
+// driver's live connection. It reports false when the driver is not connected.
+func sendToDriver(driverID uint, kind string, msg map[string]interface{}) (bool, error) {
+	driverSessionsMu.RLock()
+	session := driverSessions[driverID]
+	driverSessionsMu.RUnlock()
+	if session == nil {
+		return false, nil
+	}
+	return true, writeWS(session.conn, kind, msg)
+}
+
 // handleDriverWebSocket manages the WebSocket connection for a driver.
 func handleDriverWebSocket(conn *websocket.Conn, driverID, saccoID uint) {
 	logrus.WithFields(logrus.Fields{
@@ -261,8 +648,20 @@ func handleDriverWebSocket(conn *websocket.Conn, driverID, saccoID uint) {
 		"conn_ptr":  fmt.Sprintf("%p", conn),
 	}).Info("Driver WebSocket connection established.")
 
+	session := &driverSession{conn: conn}
+	driverSessionsMu.Lock()
+	driverSessions[driverID] = session // A reconnect replaces the stale connection
+	driverSessionsMu.Unlock()
+	defer func() {
+		driverSessionsMu.Lock()
+		if driverSessions[driverID] == session {
+			delete(driverSessions, driverID)
+		}
+		driverSessionsMu.Unlock()
+	}()
+
 	for {
-		messageType, p, err := conn.ReadMessage()
+		messageType, p, err := readMessage(conn, wsReadLimit)
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logrus.WithField("driver_id", driverID).Info("Driver WebSocket closed normally or abnormally.")
@@ -271,8 +670,22 @@ func handleDriverWebSocket(conn *websocket.Conn, driverID, saccoID uint) {
 			}
 			break
 		}
+		touchConn(conn)
 		if messageType == websocket.TextMessage {
-			processDriverLocation(conn, p, driverID, saccoID)
+			var envelope struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(p, &envelope)
+			switch envelope.Type {
+			case "occupancy":
+				processDriverOccupancy(conn, p, driverID)
+			case "trip_start", "trip_end":
+				processDriverTripCommand(conn, p, driverID)
+			case "sos":
+				processDriverSOS(conn, p, driverID)
+			default:
+				processDriverLocation(conn, p, driverID, saccoID)
+			}
 		}
 	}
 	logrus.WithFields(logrus.Fields{
@@ -282,17 +695,17 @@ func handleDriverWebSocket(conn *websocket.Conn, driverID, saccoID uint) {
 }
 
 // handleSaccoWebSocket manages the WebSocket connection for a Sacco client.
-func handleSaccoWebSocket(conn *websocket.Conn, saccoID uint) {
+func handleSaccoWebSocket(conn *websocket.Conn, saccoID uint, prefs format.Preferences) {
 	logrus.WithFields(logrus.Fields{
 		"sacco_id": saccoID,
 		"conn_ptr": fmt.Sprintf("%p", conn),
 	}).Info("Sacco WebSocket connection established (Monitoring).")
 
-	locationHub.RegisterClient(saccoID, conn)
+	locationHub.RegisterClient(saccoID, newWSClient(conn, prefs))
 	defer locationHub.UnregisterClient(saccoID, conn)
 
 	for {
-		_, _, err := conn.ReadMessage()
+		_, _, err := readMessage(conn, wsReadLimit)
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logrus.WithField("sacco_id", saccoID).Info("Sacco monitoring WebSocket closed normally or abnormally.")
@@ -301,6 +714,7 @@ func handleSaccoWebSocket(conn *websocket.Conn, saccoID uint) {
 			}
 			break
 		}
+		touchConn(conn)
 		logrus.WithField("sacco_id", saccoID).Warn("Sacco client sent unexpected message. Ignoring.")
 	}
 	logrus.WithFields(logrus.Fields{
@@ -310,26 +724,23 @@ func handleSaccoWebSocket(conn *websocket.Conn, saccoID uint) {
 }
 
 // handleCommuterWebSocket manages the WebSocket connection for a Commuter client.
-func handleCommuterWebSocket(conn *websocket.Conn, saccoID uint) {
+// The commuter may narrow it to a viewport, and move it, with viewport messages.
+func handleCommuterWebSocket(conn *websocket.Conn, saccoID uint, area *wsArea, prefs format.Preferences) {
 	logrus.WithFields(logrus.Fields{
 		"commuter_sacco_id": saccoID,
 		"conn_ptr":          fmt.Sprintf("%p", conn),
 	}).Info("Commuter WebSocket connection established (Monitoring).")
 
-	locationHub.RegisterClient(saccoID, conn)
+	client := newWSClient(conn, prefs)
+	client.commuter, client.area = true, area
+	locationHub.RegisterClient(saccoID, client)
 	defer locationHub.UnregisterClient(saccoID, conn)
 
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				logrus.WithField("commuter_sacco_id", saccoID).Info("Commuter monitoring WebSocket closed normally or abnormally.")
-			} else {
-				logrus.WithError(err).Errorf("Error reading WebSocket message from Commuter (Sacco ID %d)", saccoID)
-			}
-			break
-		}
-		logrus.WithField("commuter_sacco_id", saccoID).Warn("Commuter client sent unexpected message. Ignoring.")
+	err := readViewports(conn, "sacco_id", saccoID, logrus.Fields{"commuter_sacco_id": saccoID})
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		logrus.WithField("commuter_sacco_id", saccoID).Info("Commuter monitoring WebSocket closed normally or abnormally.")
+	} else {
+		logrus.WithError(err).Errorf("Error reading WebSocket message from Commuter (Sacco ID %d)", saccoID)
 	}
 	logrus.WithFields(logrus.Fields{
 		"commuter_sacco_id": saccoID,
@@ -337,52 +748,180 @@ func handleCommuterWebSocket(conn *websocket.Conn, saccoID uint) {
 	}).Info("Commuter WebSocket connection closed.")
 }
 
+// handleFollowWebSocket manages a commuter's subscription to one route or vehicle.
+func handleFollowWebSocket(conn *websocket.Conn, key followKey, area *wsArea, prefs format.Preferences) {
+	logrus.WithFields(logrus.Fields{
+		key.Field:  key.ID,
+		"conn_ptr": fmt.Sprintf("%p", conn),
+	}).Info("Commuter WebSocket connection established (Following).")
+
+	client := newWSClient(conn, prefs)
+	client.commuter, client.area = true, area
+	locationHub.RegisterFollower(key, client)
+	defer locationHub.UnregisterFollower(key, conn)
+
+	err := readViewports(conn, key.Field, key.ID, logrus.Fields{key.Field: key.ID})
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		logrus.WithError(err).WithField(key.Field, key.ID).Error("Error reading WebSocket message from following Commuter")
+	}
+	logrus.WithFields(logrus.Fields{
+		key.Field:  key.ID,
+		"conn_ptr": fmt.Sprintf("%p", conn),
+	}).Info("Commuter following WebSocket connection closed.")
+}
 
 // HandleLocationWebSocket is the main Gin handler for all WebSocket connections.
-// It authenticates the user based on a JWT token in the query parameter and then
+// It authenticates the user based on a JWT token, given in the query parameter
+// or in an "auth" message sent first (see awaitAuthMessage), and then
 // delegates to the appropriate handler (driver, sacco, or commuter) based on the user's role.
 // @Summary Universal WebSocket Endpoint for Drivers, Saccos, and Commuters
 // @Description Establishes a WebSocket connection. Drivers send location, Saccos and Commuters receive location.
+// @Description Without ?token= the first message must be {"type": "auth", "token": "..."}, sent within WS_AUTH_TIMEOUT (10s by default).
+// @Description The auth message may be at most 4 KiB and later messages WS_MAX_MESSAGE_BYTES (16 KiB by default); larger ones close the connection.
 // @Produce json
 // @Router /ws/location [get]
 // @Tags WebSocket
 // @Security BearerAuth
-// @Param token query string true "JWT token for authentication"
-// @Param sacco_id query integer false "Sacco ID to monitor (required for commuter role)"
+// @Param token query string false "JWT token for authentication; omit to send it in an auth message instead"
+// @Param sacco_id query integer false "Sacco ID to monitor (required for commuter role unless route_id is given)"
+// @Param route_id query integer false "Published route to follow instead of a whole sacco (commuter role)"
+// @Param vehicle_id query integer false "Single vehicle on a published route to follow instead of a whole sacco (commuter role)"
+// @Param bbox query string false "Viewport min_lng,min_lat,max_lng,max_lat; alone, watches every sacco's vehicles in it (commuter role)"
+// @Param lat query number false "Viewport center latitude, with lng and radius_m (commuter role)"
+// @Param lng query number false "Viewport center longitude (commuter role)"
+// @Param radius_m query number false "Viewport radius in metres, at most 25000 (commuter role)"
+// @Param protocol query string false "v1 for typed envelopes (see /ws/schema); flat messages by default"
+// @Param encoding query string false "json (default) or protobuf for binary v1 envelopes (see proto/ws/v1)"
 func HandleLocationWebSocket(c *gin.Context) {
-	userID, role, saccoID, driverID, authErr := authenticateUserForWebSocket(c)
-	if authErr != nil {
-		status := http.StatusUnauthorized
-		if errors.Is(authErr, errors.New("unauthorized role for WebSocket connection")) {
-			status = http.StatusForbidden
-		}
-		logrus.WithError(authErr).Warnf("WebSocket connection attempt failed for User ID %d, Role %s", userID, role)
-		c.JSON(status, gin.H{"error": authErr.Error()})
+	encoding, err := wsProtocol(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	var userID, saccoID, driverID uint
+	var role string
+	var follow followKey
+	var area *wsArea
+	tokenString := c.Query("token")
+	if tokenString != "" {
+		userID, role, saccoID, driverID, err = authenticateUserForWebSocket(c, tokenString)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, errWSRole) {
+				status = http.StatusForbidden
+			}
+			logrus.WithContext(c).WithError(err).Warnf("WebSocket connection attempt failed for User ID %d, Role %s", userID, role)
+			apierror.Respond(c, status, err.Error())
+			return
+		}
+		var status int
+		if follow, area, status, err = commuterSubscription(c, role); err != nil {
+			apierror.Respond(c, status, err.Error())
+			return
+		}
+	}
+
+	conn, err := upgradeWS(c.Writer, c.Request)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to upgrade WebSocket connection.")
+		logrus.WithContext(c).WithError(err).Error("Failed to upgrade WebSocket connection.")
 		return
 	}
 	defer conn.Close()
+	release, ok := trackConn(conn)
+	if !ok {
+		closeGoingAway(conn)
+		return
+	}
+	defer release()
+	tuneCompression(conn)
+	forgetProtocol := useProtocol(conn, negotiatedEncoding(conn, encoding))
+	defer forgetProtocol()
+
+	if tokenString == "" {
+		if tokenString, err = awaitAuthMessage(conn); err != nil {
+			logrus.WithContext(c).WithError(err).Warn("WebSocket connection attempt: No valid auth message.")
+			closeWithError(conn, err.Error())
+			return
+		}
+		if userID, role, saccoID, driverID, err = authenticateUserForWebSocket(c, tokenString); err != nil {
+			logrus.WithContext(c).WithError(err).Warnf("WebSocket connection attempt failed for User ID %d, Role %s", userID, role)
+			closeWithError(conn, err.Error())
+			return
+		}
+		if follow, area, _, err = commuterSubscription(c, role); err != nil {
+			closeWithError(conn, err.Error())
+			return
+		}
+		writeWS(conn, wsproto.TypeAck, gin.H{
+			"type":      "auth",
+			"status":    "authenticated",
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+	conn.SetReadLimit(wsReadLimit)
+	stopHeartbeat := keepAlive(conn)
+	defer stopHeartbeat()
+	defer hubMetrics.connected(role)()
+
+	prefs := format.FromRequest(c.Request)
+	if role == "commuter" {
+		forgetUser := identifyConn(conn, userID)
+		defer forgetUser()
+	}
 
 	if role == "driver" {
 		handleDriverWebSocket(conn, driverID, saccoID)
 	} else if role == "sacco" {
-		handleSaccoWebSocket(conn, saccoID)
-	} else if role == "commuter" {
-		handleCommuterWebSocket(conn, saccoID)
+		handleSaccoWebSocket(conn, saccoID, prefs)
+	} else if (role == "commuter" || role == middleware.RoleGuest) && follow.ID != 0 {
+		handleFollowWebSocket(conn, follow, area, prefs)
+	} else if (role == "commuter" || role == middleware.RoleGuest) && saccoID == 0 && area != nil {
+		handleAreaWebSocket(conn, area, prefs)
+	} else if role == "commuter" || role == middleware.RoleGuest {
+		handleCommuterWebSocket(conn, saccoID, area, prefs)
 	} else {
-		logrus.WithFields(logrus.Fields{"user_id": userID, "role": role}).Error("Unhandled user role for WebSocket connection.")
+		logrus.WithContext(c).WithFields(logrus.Fields{"user_id": userID, "role": role}).Error("Unhandled user role for WebSocket connection.")
 		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Unauthorized role"))
 	}
 }
 
+// commuterSubscription reads what a commuter or guest connection watches: a
+// followed route or vehicle, and an initial viewport. A followed route must be
+// published, and a followed vehicle must serve a published route. On failure
+// it returns the HTTP status to reject the connection with.
+func commuterSubscription(c *gin.Context, role string) (follow followKey, area *wsArea, status int, err error) {
+	if role != "commuter" && role != middleware.RoleGuest {
+		return follow, nil, 0, nil
+	}
+	if follow, err = commuterFollow(c); err != nil {
+		return follow, nil, http.StatusBadRequest, err
+	}
+	if area, err = parseAreaQuery(c); err != nil {
+		return follow, nil, http.StatusBadRequest, err
+	}
+	if follow.ID != 0 {
+		published := config.DB.Model(&models.Route{}).Select("id").Where("status = ?", models.RouteStatusPublished)
+		query := config.DB.Model(&models.Route{}).Where("id IN (?)", published)
+		name := "Route"
+		if follow.Field == "vehicle_id" {
+			query, name = config.DB.Model(&models.Vehicle{}).Where("route_id IN (?)", published), "Vehicle"
+		}
+		var count int64
+		if err := query.Where("id = ?", follow.ID).Count(&count).Error; err != nil {
+			logrus.WithContext(c).WithError(err).WithField(follow.Field, follow.ID).Error("HandleLocationWebSocket: Failed to look up followed item.")
+			return follow, nil, http.StatusInternalServerError, errors.New("Failed to look up " + strings.ToLower(name))
+		}
+		if count == 0 {
+			return follow, nil, http.StatusNotFound, errors.New(name + " not found")
+		}
+	}
+	return follow, area, 0, nil
+}
+
 // processDriverLocation handles incoming location messages from a driver.
-// It unmarshals the data, performs security checks, applies movement logic,
-// and then calls `saveAndPublishLocation` to persist and broadcast.
+// It unmarshals the data, performs security checks, and then hands the update
+// to `ingestDriverLocation`, answering the driver with its outcome.
 func processDriverLocation(driverConn *websocket.Conn, p []byte, authenticatedDriverID uint, saccoID uint) {
 	var locData LocationData // LocationData has custom UnmarshalJSON
 	if err := json.Unmarshal(p, &locData); err != nil {
@@ -390,7 +929,7 @@ func processDriverLocation(driverConn *websocket.Conn, p []byte, authenticatedDr
 			"driver_id": authenticatedDriverID,
 			"payload":   string(p),
 		}).Error("Error unmarshaling location data from Driver (via custom UnmarshalJSON).") // Updated log message
-		driverConn.WriteJSON(gin.H{"error": "Invalid location data format. Check timestamp format."})
+		writeWSError(driverConn, "Invalid location data format. Check timestamp format.")
 		return
 	}
 
@@ -412,21 +951,85 @@ func processDriverLocation(driverConn *websocket.Conn, p []byte, authenticatedDr
 			"authenticated_driver_id": authenticatedDriverID,
 			"payload_driver_id":       locData.DriverID,
 		}).Warn("SECURITY ALERT: Driver attempted to send location for a different Driver ID. Denying.")
-		driverConn.WriteJSON(gin.H{"error": "Unauthorized location update."})
+		writeWSError(driverConn, "Unauthorized location update.")
 		return
 	}
 
+	outcome := ingestDriverLocation(driverConn, locData, saccoID)
+	switch outcome.Status {
+	case locationRejected:
+		writeWSError(driverConn, outcome.Error)
+	case locationSaved:
+		writeWS(driverConn, wsproto.TypeAck, outcome.ack())
+	default:
+		if usesEnvelopes(driverConn) {
+			writeWS(driverConn, wsproto.TypeAck, gin.H{"status": "ignored", "distance": outcome.Distance})
+		} else {
+			writeWSText(driverConn, "Location received - no significant change")
+		}
+	}
+}
+
+// Outcomes of a driver's location update.
+const (
+	locationSaved    = "saved"
+	locationIgnored  = "ignored" // No significant movement since the last saved point
+	locationRejected = "rejected"
+)
+
+// locationOutcome is how a driver's location update was handled, for the
+// channel it came in on to acknowledge.
+type locationOutcome struct {
+	Status     string
+	EventType  string
+	Distance   float64
+	IsMoving   bool
+	Timestamp  time.Time
+	SequenceID uint   // ID of the saved point
+	TripID     uint
+	Error      string // Why a rejected update was refused
+}
+
+// ack is the WebSocket acknowledgement of a saved point.
+func (o locationOutcome) ack() map[string]interface{} {
+	response := map[string]interface{}{
+		"status":      o.Status,
+		"event_type":  o.EventType,
+		"distance":    o.Distance,
+		"is_moving":   o.IsMoving,
+		"timestamp":   o.Timestamp.Format(time.RFC3339Nano),
+		"sequence_id": o.SequenceID,
+	}
+	if o.TripID != 0 {
+		response["trip_id"] = o.TripID
+	}
+	return response
+}
+
+// ingestDriverLocation runs an authenticated driver's update through the
+// location pipeline: movement logic, driving events, stage tracking, and
+// saving and broadcasting significant points. Coaching events go to
+// driverConn, or to the driver's WebSocket when the update came in another
+// way (e.g. over gRPC) and driverConn is nil.
+func ingestDriverLocation(driverConn *websocket.Conn, locData LocationData, saccoID uint) locationOutcome {
+	// Attribute the point to the driver's current vehicle. Drivers without one
+	// are still tracked; their points are attributed once an assignment
+	// covering them is recorded (see internal/attribution).
+	var vehicle models.Vehicle
+	if err := config.DB.Where("driver_id = ?", locData.DriverID).Limit(1).Find(&vehicle).Error; err != nil {
+		logrus.WithError(err).WithField("driver_id", locData.DriverID).Error("Database error fetching vehicle for driver. Saving point unattributed.")
+		vehicle = models.Vehicle{}
+	}
+
 	// Fetch the last known location for this driver from the database.
 	var lastLocation models.LocationHistory
-	err := config.DB.Where("driver_id = ?", locData.DriverID).Order("created_at desc").First(&lastLocation).Error
+	err := config.DB.Where("driver_id = ? AND source = ?", locData.DriverID, models.LocationSourceDriver).Order("created_at desc").First(&lastLocation).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		saveAndPublishLocation(driverConn, locData, 0, 0, true, "initial", saccoID)
-		return
+		return saveAndPublishLocation(locData, &vehicle, 0, 0, true, "initial", saccoID)
 	} else if err != nil {
 		logrus.WithError(err).Errorf("Database error fetching last location for Driver ID %d", locData.DriverID)
-		driverConn.WriteJSON(gin.H{"error": "Database error fetching last location."})
-		return
+		return locationOutcome{Status: locationRejected, Error: "Database error fetching last location."}
 	}
 
 	currentLocationForCalc := models.LocationHistory{
@@ -448,10 +1051,20 @@ func processDriverLocation(driverConn *websocket.Conn, p []byte, authenticatedDr
 
 	bearing := calculateBearing(lastLocation.Latitude, lastLocation.Longitude, currentLocationForCalc.Latitude, currentLocationForCalc.Longitude)
 
+	currentLocationForCalc.DriverID = locData.DriverID
+	currentLocationForCalc.VehicleID = vehicle.ID
+	currentLocationForCalc.Source = models.LocationSourceDriver
+	currentLocationForCalc.Speed = currentSpeed
+	queueDrivingEvents(lastLocation, currentLocationForCalc, &vehicle, saccoID)
+	trackStages(currentLocationForCalc, saccoID, vehicle.RouteID)
+
 	isSignificant, eventType := shouldSaveLocation(distance, currentSpeed, timeDiff, lastLocation)
 
 	if isSignificant {
-		saveAndPublishLocation(driverConn, locData, distance, bearing, currentSpeed > 0.5, eventType, saccoID)
+		outcome := saveAndPublishLocation(locData, &vehicle, distance, bearing, currentSpeed > 0.5, eventType, saccoID)
+		if outcome.Status != locationSaved {
+			return outcome
+		}
 		logrus.WithFields(logrus.Fields{
 			"driver_id": locData.DriverID,
 			"event_type": eventType,
@@ -459,20 +1072,23 @@ func processDriverLocation(driverConn *websocket.Conn, p []byte, authenticatedDr
 			"speed_mps":  fmt.Sprintf("%.2f", currentSpeed),
 			"bearing_deg": fmt.Sprintf("%.2f", bearing),
 		}).Info("Driver location saved and published (significant movement).")
-	} else {
-		driverConn.WriteMessage(websocket.TextMessage, []byte("Location received - no significant change"))
-		logrus.WithFields(logrus.Fields{
-			"driver_id": locData.DriverID,
-			"distance_m": fmt.Sprintf("%.2f", distance),
-			"speed_mps": fmt.Sprintf("%.2f", currentSpeed),
-		}).Debug("Driver location received - minor movement, not saved.")
+		return outcome
 	}
+	logrus.WithFields(logrus.Fields{
+		"driver_id": locData.DriverID,
+		"distance_m": fmt.Sprintf("%.2f", distance),
+		"speed_mps": fmt.Sprintf("%.2f", currentSpeed),
+	}).Debug("Driver location received - minor movement, not saved.")
+	return locationOutcome{Status: locationIgnored, Distance: distance}
 }
 
 // saveAndPublishLocation saves location data to the database and publishes it to the hub for Sacco clients.
-func saveAndPublishLocation(driverConn *websocket.Conn, locData LocationData, distance, bearing float64, isMoving bool, eventType string, saccoID uint) {
+// vehicle is the driver's current vehicle, zero when they have none.
+func saveAndPublishLocation(locData LocationData, vehicle *models.Vehicle, distance, bearing float64, isMoving bool, eventType string, saccoID uint) locationOutcome {
 	locationRecord := models.LocationHistory{
 		DriverID:         locData.DriverID,
+		VehicleID:        vehicle.ID,
+		Source:           models.LocationSourceDriver,
 		Latitude:         locData.Latitude,
 		Longitude:        locData.Longitude,
 		Accuracy:         locData.Accuracy,
@@ -483,68 +1099,87 @@ func saveAndPublishLocation(driverConn *websocket.Conn, locData LocationData, di
 		DistanceFromLast: distance,
 		Timestamp:        locData.Timestamp, // locData.Timestamp is now time.Time
 		EventType:        eventType,
+		TripID:           currentTrip(locData.DriverID, vehicle.ID, locData.Timestamp),
 	}
+	matchToRoute(&locationRecord, vehicle.RouteID)
 
 	if err := config.DB.Create(&locationRecord).Error; err != nil {
 		logrus.WithError(err).Errorf("Failed to save location for Driver ID %d", locData.DriverID)
-		driverConn.WriteJSON(gin.H{"error": "Failed to save location."})
-	} else {
-		response := map[string]interface{}{
-			"status":      "saved",
-			"event_type":  eventType,
-			"distance":    distance,
-			"is_moving":   isMoving,
-			"timestamp":   locData.Timestamp.Format(time.RFC3339Nano), // locData.Timestamp is time.Time
-			"sequence_id": locationRecord.ID,
-		}
-		driverConn.WriteJSON(response)
-
-		// --- BEGIN UPDATED LOGIC TO FETCH VEHICLE ID ---
-		var vehicle models.Vehicle
-		var vehicleID uint = 0 // Default to 0 if no vehicle is found or an error occurs
-
-		// Attempt to find a vehicle associated with this driver ID in the `vehicles` table.
-		// Assumes a vehicle can be uniquely identified by its DriverID.
-		if err := config.DB.Where("driver_id = ?", locData.DriverID).First(&vehicle).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				logrus.WithField("driver_id", locData.DriverID).Warn("No vehicle found associated with this driver. Using 0 for broadcast.")
-			} else {
-				logrus.WithError(err).WithField("driver_id", locData.DriverID).Error("Database error fetching vehicle for driver. Using 0 for broadcast.")
-			}
-		} else {
-			// If a vehicle is found, use its ID.
-			vehicleID = vehicle.ID
-			logrus.WithFields(logrus.Fields{
-				"driver_id": locData.DriverID,
-				"vehicle_id": vehicleID,
-			}).Debug("Successfully found vehicle for driver.")
-		}
-		// --- END UPDATED LOGIC ---
-
-		// Explicitly cast saccoID to float64 for broadcast map consistency.
-		broadcastData := map[string]interface{}{
-			"driver_id":   locData.DriverID,
-			"vehicle_id":  vehicleID, // This will be the found Vehicle.ID or 0
-			"latitude":    locData.Latitude,
-			"longitude":   locData.Longitude,
-			"accuracy":    locData.Accuracy,
-			"speed":       locData.Speed,
-			"bearing":     bearing,
-			"altitude":    locData.Altitude,
-			"timestamp":   locData.Timestamp.Format(time.RFC3339Nano),
-			"event_type":  eventType,
-			"is_moving":   isMoving,
-			"sacco_id":    float64(saccoID),           // Explicitly cast saccoID to float64
-			"sequence_id": locationRecord.ID,
-		}
-		locationHub.PublishLocation(broadcastData)
-		logrus.WithFields(logrus.Fields{
-			"driver_id": locData.DriverID,
-			"sacco_id":  saccoID,
-			"event_type": eventType,
-			"sequence_id": locationRecord.ID,
-		}).Debug("Location data published to hub for Sacco clients.")
+		return locationOutcome{Status: locationRejected, Error: "Failed to save location."}
 	}
+	recordTripPoints(locationRecord.TripID, []models.LocationHistory{locationRecord})
+	trackDeviation(locationRecord, saccoID, vehicle.RouteID)
+	publishLocation(locationRecord, vehicle, saccoID)
+	return locationOutcome{
+		Status:     locationSaved,
+		EventType:  eventType,
+		Distance:   distance,
+		IsMoving:   isMoving,
+		Timestamp:  locData.Timestamp,
+		SequenceID: locationRecord.ID,
+		TripID:     locationRecord.TripID,
+	}
+}
+
+// publishLocation broadcasts a saved point to the sacco's monitoring clients.
+// driver_id and vehicle_id are only sent when known, and "unassigned" marks
+// points from a driver without a vehicle or a vehicle without a driver.
+// Points snapped onto their route are sent at the matched position, with the
+// raw fix alongside.
+func publishLocation(record models.LocationHistory, vehicle *models.Vehicle, saccoID uint) {
+	// Explicitly cast saccoID to float64 for broadcast map consistency.
+	broadcastData := map[string]interface{}{
+		"latitude":    record.Latitude,
+		"longitude":   record.Longitude,
+		"accuracy":    record.Accuracy,
+		"speed":       record.Speed,
+		"bearing":     record.Bearing,
+		"altitude":    record.Altitude,
+		"timestamp":   record.Timestamp.Format(time.RFC3339Nano),
+		"event_type":  record.EventType,
+		"is_moving":   record.IsMoving,
+		"source":      record.Source,
+		"sacco_id":    float64(saccoID),
+		"sequence_id": record.ID,
+	}
+	if record.MatchedLatitude != nil && record.MatchedLongitude != nil {
+		broadcastData["latitude"], broadcastData["longitude"] = *record.MatchedLatitude, *record.MatchedLongitude
+		broadcastData["raw_latitude"], broadcastData["raw_longitude"] = record.Latitude, record.Longitude
+		broadcastData["matched"] = true
+	}
+	if record.DriverID != 0 {
+		broadcastData["driver_id"] = record.DriverID
+	}
+	if record.TripID != 0 {
+		broadcastData["trip_id"] = record.TripID
+	}
+	if record.VehicleID != 0 {
+		broadcastData["vehicle_id"] = record.VehicleID
+		currentOccupancy(vehicle, time.Now())
+		broadcastData["capacity"] = vehicle.Capacity
+		broadcastData["occupancy_status"] = vehicle.OccupancyStatus
+		if vehicle.Occupancy != nil {
+			broadcastData["occupancy"] = *vehicle.Occupancy
+		}
+		if currentCrowding(vehicle, time.Now()); vehicle.Crowding.Level != models.CrowdingUnknown {
+			broadcastData["crowding"] = vehicle.Crowding
+		}
+		if etas := observeETAs(record, vehicle.RouteID); len(etas) > 0 {
+			broadcastData["etas"] = etas[:min(len(etas), etaBroadcastStages)]
+			checkWatches(record.VehicleID, vehicle.RouteID, etas)
+		}
+	}
+	if record.DriverID == 0 || record.VehicleID == 0 {
+		broadcastData["unassigned"] = true
+	}
+	publishThrottled(record.VehicleID, saccoID, broadcastData)
+	logrus.WithFields(logrus.Fields{
+		"driver_id":   record.DriverID,
+		"vehicle_id":  record.VehicleID,
+		"sacco_id":    saccoID,
+		"event_type":  record.EventType,
+		"sequence_id": record.ID,
+	}).Debug("Location data published to hub for Sacco clients.")
 }
 
 // shouldSaveLocation implements IoT-style logic to decide if a location update is significant enough to save.
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pagination"
+	"ma3_tracker/internal/webhooks"
+)
+
+// maxWebhooksPerSacco bounds how many webhooks a sacco can register.
+const maxWebhooksPerSacco = 10
+
+// webhookInput is the body of a webhook create or update.
+type webhookInput struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"` // Defaults to true when creating, kept on update
+}
+
+// webhookDeliveryListOptions are the sorts and filters the delivery listing
+// accepts.
+var webhookDeliveryListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]pagination.Filter{
+		"status": pagination.String("status = ?"),
+		"event":  pagination.String("event = ?"),
+	},
+}
+
+// webhookResponse shows a webhook with its events as a list.
+type webhookResponse struct {
+	models.Webhook
+	Events []string `json:"events"`
+}
+
+func toWebhookResponse(hook models.Webhook) webhookResponse {
+	return webhookResponse{hook, hook.EventList()}
+}
+
+// applyWebhookInput validates input and copies it onto hook, responding 400
+// and returning false when invalid.
+func applyWebhookInput(c *gin.Context, input webhookInput, hook *models.Webhook) bool {
+	url := strings.TrimSpace(input.URL)
+	if err := webhooks.ValidateURL(url); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if len(input.Events) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, "events must name at least one event")
+		return false
+	}
+	seen := map[string]bool{}
+	events := make([]string, 0, len(input.Events))
+	for _, e := range input.Events {
+		if !webhooks.ValidEvent(e) {
+			apierror.Fail(c, apierror.New(http.StatusBadRequest, "Unknown event "+e).WithDetail("events", webhooks.Events))
+			return false
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	if len(input.Description) > 200 {
+		apierror.Respond(c, http.StatusBadRequest, "description can be at most 200 characters")
+		return false
+	}
+	hook.URL = url
+	hook.Events = strings.Join(events, ",")
+	hook.Description = strings.TrimSpace(input.Description)
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+	return true
+}
+
+// CreateWebhook registers an endpoint of the sacco's own system to be called
+// back on the events it lists: trip_started, sos, document_expired and
+// route_published. Body: {"url": "https://...", "events": ["sos"],
+// "description": "..."}. Deliveries are signed with the returned secret,
+// which is only shown here and when rotated; see internal/webhooks for the
+// request format.
+func CreateWebhook(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "CreateWebhook")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	hook := models.Webhook{SaccoID: sacco.ID, Active: true}
+	if !applyWebhookInput(c, input, &hook) {
+		return
+	}
+	var count int64
+	if err := config.DB.Model(&models.Webhook{}).Scopes(tenant.SaccoScope).Count(&count).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("CreateWebhook: Failed to count webhooks.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	if count >= maxWebhooksPerSacco {
+		apierror.Respond(c, http.StatusConflict, "A sacco can have at most 10 webhooks")
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("CreateWebhook: Failed to generate secret.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	hook.Secret = secret
+	if err := config.DB.Create(&hook).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("CreateWebhook: Failed to save webhook.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"webhook_id": hook.ID, "sacco_id": sacco.ID, "events": hook.Events}).Info("CreateWebhook: Webhook registered.")
+	c.JSON(http.StatusCreated, gin.H{"data": toWebhookResponse(hook), "secret": secret})
+}
+
+// ListWebhooks returns the sacco's webhooks, without their secrets.
+func ListWebhooks(c *gin.Context) {
+	tenant, ok := saccoTenant(c, "ListWebhooks")
+	if !ok {
+		return
+	}
+	sacco := tenant.Sacco
+	var hooks []models.Webhook
+	if err := config.DB.Scopes(tenant.SaccoScope).Order("id").Find(&hooks).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("ListWebhooks: Failed to load webhooks.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to load webhooks")
+		return
+	}
+	out := make([]webhookResponse, len(hooks))
+	for i, h := range hooks {
+		out[i] = toWebhookResponse(h)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// loadSaccoWebhook loads the :id webhook if it belongs to the authenticated
+// sacco.
+func loadSaccoWebhook(c *gin.Context, fn string) (models.Webhook, bool) {
+	return loadOwned[models.Webhook](c, fn, "Webhook", config.DB)
+}
+
+// GetWebhook returns one of the sacco's webhooks.
+func GetWebhook(c *gin.Context) {
+	hook, ok := loadSaccoWebhook(c, "GetWebhook")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": toWebhookResponse(hook)})
+}
+
+// UpdateWebhook replaces one of the sacco's webhooks' URL, events and
+// description, and turns it on or off with "active". Deliveries already
+// queued go to the new URL.
+func UpdateWebhook(c *gin.Context) {
+	hook, ok := loadSaccoWebhook(c, "UpdateWebhook")
+	if !ok {
+		return
+	}
+	var input webhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if !applyWebhookInput(c, input, &hook) {
+		return
+	}
+	if err := config.DB.Model(&hook).Updates(map[string]interface{}{
+		"url":         hook.URL,
+		"events":      hook.Events,
+		"description": hook.Description,
+		"active":      hook.Active,
+	}).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("webhook_id", hook.ID).Error("UpdateWebhook: Failed to save webhook.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to update webhook")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": toWebhookResponse(hook)})
+}
+
+// DeleteWebhook removes one of the sacco's webhooks. Its pending deliveries
+// are not sent.
+func DeleteWebhook(c *gin.Context) {
+	hook, ok := loadSaccoWebhook(c, "DeleteWebhook")
+	if !ok {
+		return
+	}
+	if err := config.DB.Delete(&hook).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("webhook_id", hook.ID).Error("DeleteWebhook: Failed to delete webhook.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+	logrus.WithContext(c).WithFields(logrus.Fields{"webhook_id": hook.ID, "sacco_id": hook.SaccoID}).Info("DeleteWebhook: Webhook deleted.")
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// RotateWebhookSecret replaces a webhook's signing secret and returns the
+// new one. Deliveries sent from then on, retries included, are signed with
+// it.
+func RotateWebhookSecret(c *gin.Context) {
+	hook, ok := loadSaccoWebhook(c, "RotateWebhookSecret")
+	if !ok {
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		logrus.WithContext(c).WithError(err).Error("RotateWebhookSecret: Failed to generate secret.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to rotate secret")
+		return
+	}
+	if err := config.DB.Model(&hook).Update("secret", secret).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("webhook_id", hook.ID).Error("RotateWebhookSecret: Failed to save secret.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to rotate secret")
+		return
+	}
+	logrus.WithContext(c).WithField("webhook_id", hook.ID).Info("RotateWebhookSecret: Webhook secret rotated.")
+	c.JSON(http.StatusOK, gin.H{"data": toWebhookResponse(hook), "secret": secret})
+}
+
+// PingWebhook queues a ping event to one of the sacco's webhooks, to test
+// the endpoint. Its outcome shows in the webhook's deliveries.
+func PingWebhook(c *gin.Context) {
+	hook, ok := loadSaccoWebhook(c, "PingWebhook")
+	if !ok {
+		return
+	}
+	if !hook.Active {
+		apierror.Respond(c, http.StatusConflict, "Webhook is inactive")
+		return
+	}
+	delivery, err := webhooks.Ping(config.DB, hook)
+	if err != nil {
+		logrus.WithContext(c).WithError(err).WithField("webhook_id", hook.ID).Error("PingWebhook: Failed to queue ping.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to queue ping")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": delivery})
+}
+
+// ListWebhookDeliveries returns one of the sacco's webhooks' deliveries,
+// newest first, with the outcome of their latest attempt. ?status= and
+// ?event= filter them.
+func ListWebhookDeliveries(c *gin.Context) {
+	hook, ok := loadSaccoWebhook(c, "ListWebhookDeliveries")
+	if !ok {
+		return
+	}
+	var list []models.WebhookDelivery
+	meta, ok := paginate(c, "ListWebhookDeliveries", config.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", hook.ID), webhookDeliveryListOptions, &list)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "pagination": meta})
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
+)
+
+// maxAreaRadiusM bounds a viewport: a circle's radius, or half a bounding
+// box's diagonal. Area-only subscriptions receive every sacco's vehicles, so
+// they cannot cover a whole city.
+const maxAreaRadiusM = 25000
+
+// wsArea is the part of the map a commuter is looking at: a bounding box,
+// or a circle (center and radiusM) with its bounding box.
+type wsArea struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+
+	center  *geo.Point
+	radiusM float64
+}
+
+// contains reports whether p lies in the area.
+func (a *wsArea) contains(p geo.Point) bool {
+	if p.Lat < a.MinLat || p.Lat > a.MaxLat || p.Lng < a.MinLng || p.Lng > a.MaxLng {
+		return false
+	}
+	return a.center == nil || geo.Haversine(*a.center, p) <= a.radiusM
+}
+
+// newBoxArea validates a bounding box given as min/max longitude and latitude.
+func newBoxArea(minLng, minLat, maxLng, maxLat float64) (*wsArea, error) {
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 || minLat >= maxLat || minLng >= maxLng {
+		return nil, errors.New("bbox must be min_lng,min_lat,max_lng,max_lat with min < max")
+	}
+	if geo.Haversine(geo.Point{Lat: minLat, Lng: minLng}, geo.Point{Lat: maxLat, Lng: maxLng}) > 2*maxAreaRadiusM {
+		return nil, fmt.Errorf("bbox is too large; zoom in to under %d km across", 2*maxAreaRadiusM/1000)
+	}
+	return &wsArea{MinLat: minLat, MinLng: minLng, MaxLat: maxLat, MaxLng: maxLng}, nil
+}
+
+// newCircleArea validates a center and radius in metres.
+func newCircleArea(lat, lng, radiusM float64) (*wsArea, error) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, errors.New("center is out of range")
+	}
+	if radiusM <= 0 || radiusM > maxAreaRadiusM {
+		return nil, fmt.Errorf("radius_m must be between 0 and %d", maxAreaRadiusM)
+	}
+	dLat := radiusM / geo.EarthRadius * 180 / math.Pi
+	dLng := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	center := geo.Point{Lat: lat, Lng: lng}
+	return &wsArea{MinLat: lat - dLat, MinLng: lng - dLng, MaxLat: lat + dLat, MaxLng: lng + dLng, center: &center, radiusM: radiusM}, nil
+}
+
+// parseAreaQuery reads an initial viewport from ?bbox=min_lng,min_lat,max_lng,max_lat
+// or ?lat=&lng=&radius_m=. It returns nil when neither is given.
+func parseAreaQuery(c *gin.Context) (*wsArea, error) {
+	if raw := c.Query("bbox"); raw != "" {
+		v, err := parseBBox(raw)
+		if err != nil {
+			return nil, err
+		}
+		return newBoxArea(v[0], v[1], v[2], v[3])
+	}
+	if c.Query("lat") == "" && c.Query("lng") == "" && c.Query("radius_m") == "" {
+		return nil, nil
+	}
+	var v [3]float64
+	for i, name := range []string{"lat", "lng", "radius_m"} {
+		f, err := strconv.ParseFloat(c.Query(name), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' parameter", name)
+		}
+		v[i] = f
+	}
+	return newCircleArea(v[0], v[1], v[2])
+}
+
+// parseBBox reads "min_lng,min_lat,max_lng,max_lat" without checking the
+// values.
+func parseBBox(raw string) ([4]float64, error) {
+	var v [4]float64
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return v, errors.New("bbox must be min_lng,min_lat,max_lng,max_lat")
+	}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return v, errors.New("bbox must be min_lng,min_lat,max_lng,max_lat")
+		}
+		v[i] = f
+	}
+	return v, nil
+}
+
+// viewportMessage is sent by a commuter as they pan or zoom:
+//
+//	{"type": "viewport", "bbox": [min_lng, min_lat, max_lng, max_lat]}
+//	{"type": "viewport", "latitude": -1.28, "longitude": 36.82, "radius_m": 2000}
+//	{"type": "viewport"} clears it (not allowed on area-only connections)
+type viewportMessage struct {
+	Type      string    `json:"type"`
+	BBox      []float64 `json:"bbox"`
+	Latitude  *float64  `json:"latitude"`
+	Longitude *float64  `json:"longitude"`
+	RadiusM   float64   `json:"radius_m"`
+}
+
+// parseViewport reads a viewport message; the area is nil when it clears the
+// viewport.
+func parseViewport(p []byte) (*wsArea, error) {
+	var msg viewportMessage
+	if err := json.Unmarshal(p, &msg); err != nil || msg.Type != "viewport" {
+		return nil, errors.New(`expected a {"type": "viewport"} message`)
+	}
+	switch {
+	case len(msg.BBox) > 0:
+		if len(msg.BBox) != 4 {
+			return nil, errors.New("bbox must be [min_lng, min_lat, max_lng, max_lat]")
+		}
+		return newBoxArea(msg.BBox[0], msg.BBox[1], msg.BBox[2], msg.BBox[3])
+	case msg.Latitude != nil && msg.Longitude != nil:
+		return newCircleArea(*msg.Latitude, *msg.Longitude, msg.RadiusM)
+	case msg.Latitude != nil || msg.Longitude != nil || msg.RadiusM != 0:
+		return nil, errors.New("a circular viewport needs latitude, longitude and radius_m")
+	}
+	return nil, nil
+}
+
+// readViewports serves a commuter connection's read loop: each viewport
+// message moves the client's area and is answered with a snapshot of what is
+// now in view. field and id scope the snapshot as at registration; id is 0
+// for area-only connections, which must always keep an area. It returns when
+// the connection fails.
+func readViewports(conn *websocket.Conn, field string, id uint, logFields logrus.Fields) error {
+	for {
+		_, p, err := readMessage(conn, wsReadLimit)
+		if err != nil {
+			return err
+		}
+		touchConn(conn)
+		area, err := parseViewport(p)
+		if err == nil && area == nil && id == 0 {
+			err = errors.New("a viewport is required on this connection")
+		}
+		if err != nil {
+			logrus.WithError(err).WithFields(logFields).Debug("readViewports: Rejected viewport message.")
+			locationHub.sendToConn(conn, map[string]interface{}{"type": "error", "error": err.Error()})
+			continue
+		}
+		locationHub.SetViewport(conn, field, id, area)
+	}
+}
+
+// messagePoint returns the coordinates a broadcast carries, if any.
+func messagePoint(msg map[string]interface{}) (geo.Point, bool) {
+	lat, ok1 := msg["latitude"].(float64)
+	lng, ok2 := msg["longitude"].(float64)
+	return geo.Point{Lat: lat, Lng: lng}, ok1 && ok2
+}
+
+// RegisterArea subscribes a commuter to every vehicle inside the client's
+// area, whichever sacco runs it. A snapshot of the area is queued first.
+func (h *LocationHub) RegisterArea(client *wsClient) {
+	if snapshot := snapshotMessage("", 0, client.area, client.prefs); snapshot != nil {
+		client.enqueue(snapshot)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.areaClients[client.conn] = client
+	logrus.WithField("conn_ptr", fmt.Sprintf("%p", client.conn)).Info("Area subscriber registered with LocationHub.")
+}
+
+// UnregisterArea removes an area subscription and stops its writer.
+func (h *LocationHub) UnregisterArea(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client, ok := h.areaClients[conn]; ok {
+		client.stop()
+		delete(h.areaClients, conn)
+	}
+	logrus.WithField("conn_ptr", fmt.Sprintf("%p", conn)).Info("Area subscriber unregistered from LocationHub.")
+}
+
+// clientOf finds conn's registered client. Callers hold h.mu.
+func (h *LocationHub) clientOf(conn *websocket.Conn) *wsClient {
+	if client, ok := h.areaClients[conn]; ok {
+		return client
+	}
+	for _, clients := range h.saccoClients {
+		if client, ok := clients[conn]; ok {
+			return client
+		}
+	}
+	for _, clients := range h.followers {
+		if client, ok := clients[conn]; ok {
+			return client
+		}
+	}
+	return nil
+}
+
+// SetViewport moves a commuter client's area (nil clears it) and queues a
+// snapshot of the vehicles now in view, scoped by field and id as at
+// registration.
+func (h *LocationHub) SetViewport(conn *websocket.Conn, field string, id uint, area *wsArea) {
+	h.mu.Lock()
+	client := h.clientOf(conn)
+	if client != nil {
+		client.area = area
+	}
+	h.mu.Unlock()
+	if client == nil {
+		return
+	}
+	if snapshot := snapshotMessage(field, id, area, client.prefs); snapshot != nil {
+		client.enqueue(snapshot)
+	}
+}
+
+// sendToConn queues msg for conn's client alone.
+func (h *LocationHub) sendToConn(conn *websocket.Conn, msg map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client := h.clientOf(conn); client != nil {
+		client.enqueue(msg)
+	}
+}
+
+// handleAreaWebSocket serves a commuter watching a viewport rather than a
+// sacco, route or vehicle.
+func handleAreaWebSocket(conn *websocket.Conn, area *wsArea, prefs format.Preferences) {
+	logrus.WithField("conn_ptr", fmt.Sprintf("%p", conn)).Info("Commuter WebSocket connection established (Area).")
+
+	client := newWSClient(conn, prefs)
+	client.commuter, client.area = true, area
+	locationHub.RegisterArea(client)
+	defer locationHub.UnregisterArea(conn)
+
+	err := readViewports(conn, "", 0, logrus.Fields{"conn_ptr": fmt.Sprintf("%p", conn)})
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		logrus.WithError(err).Error("Error reading WebSocket message from area Commuter")
+	}
+	logrus.WithField("conn_ptr", fmt.Sprintf("%p", conn)).Info("Commuter area WebSocket connection closed.")
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ma3_tracker/internal/config"
+)
+
+// wsAuthTimeout is how long a connection opened without ?token= has to send
+// its auth message before it is closed.
+var wsAuthTimeout = config.EnvDuration("WS_AUTH_TIMEOUT", 10*time.Second)
+
+// wsAuthReadLimit caps, in bytes, what an unauthenticated connection may
+// send: an auth message is a JWT in a small JSON document.
+const wsAuthReadLimit = 4096
+
+// wsReadLimit caps, in bytes, each message of an authenticated connection.
+// Clients send locations, commands and viewports, all far smaller.
+var wsReadLimit = int64(config.EnvInt("WS_MAX_MESSAGE_BYTES", 16<<10))
+
+// errWSRole rejects tokens whose role has no WebSocket handler.
+var errWSRole = errors.New("unauthorized role for WebSocket connection")
+
+// authMessage is the first message of a connection opened without ?token=,
+// so the token stays out of URLs and access logs:
+//
+//	{"type": "auth", "token": "<JWT>"}
+type authMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// upgradeWS upgrades the request to a WebSocket connection that accepts no
+// more than an auth message until the caller is authenticated; raise the
+// limit with conn.SetReadLimit(wsReadLimit) afterwards.
+func upgradeWS(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(wsAuthReadLimit)
+	return conn, nil
+}
+
+// awaitAuthMessage reads the connection's auth message and returns its token.
+// It fails if none arrives within wsAuthTimeout or the first message is
+// anything else.
+func awaitAuthMessage(conn *websocket.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+	_, p, err := readMessage(conn, wsAuthReadLimit)
+	if err != nil {
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", errors.New("authentication timed out")
+		}
+		return "", err
+	}
+	conn.SetReadDeadline(time.Time{})
+	var msg authMessage
+	if err := json.Unmarshal(p, &msg); err != nil || msg.Type != "auth" {
+		return "", errors.New(`expected a {"type": "auth", "token": "..."} message`)
+	}
+	if msg.Token == "" {
+		return "", errors.New("missing authentication token")
+	}
+	return msg.Token, nil
+}
+
+// closeWithError tells the client why it is being turned away and closes the
+// connection with a policy violation.
+func closeWithError(conn *websocket.Conn, text string) {
+	writeWSError(conn, text)
+	if len(text) > 120 { // Close frames carry at most 123 bytes of reason
+		text = text[:120]
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, text), time.Now().Add(wsPingWriteWait))
+}
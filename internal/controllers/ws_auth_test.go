@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type authResult struct {
+	token string
+	err   error
+}
+
+// authServer serves connections the way the WebSocket endpoint does before
+// authentication, reporting what awaitAuthMessage read.
+func authServer(t *testing.T) (string, <-chan authResult) {
+	t.Helper()
+	results := make(chan authResult, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWS(w, r)
+		if err != nil {
+			results <- authResult{err: err}
+			return
+		}
+		defer conn.Close()
+		token, err := awaitAuthMessage(conn)
+		results <- authResult{token, err}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), results
+}
+
+func dialAndSend(t *testing.T, url, msg string) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func await(t *testing.T, results <-chan authResult) authResult {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result from the server")
+	}
+	return authResult{}
+}
+
+func TestAwaitAuthMessage(t *testing.T) {
+	url, results := authServer(t)
+	dialAndSend(t, url, `{"type": "auth", "token": "abc"}`)
+	if r := await(t, results); r.err != nil || r.token != "abc" {
+		t.Fatalf("got %q, %v; want abc", r.token, r.err)
+	}
+}
+
+func TestAwaitAuthMessageTooLarge(t *testing.T) {
+	url, results := authServer(t)
+	dialAndSend(t, url, `{"type": "auth", "token": "`+strings.Repeat("a", 1<<20)+`"}`)
+	r := await(t, results)
+	if r.err != websocket.ErrReadLimit {
+		t.Fatalf("got %q, %v; want ErrReadLimit", r.token, r.err)
+	}
+}
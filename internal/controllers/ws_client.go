@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/wsproto"
+)
+
+// wsClientQueue is how many broadcasts may wait for a slow monitoring client
+// before the oldest are dropped.
+var wsClientQueue = config.EnvInt("WS_CLIENT_QUEUE", 64)
+
+const wsWriteWait = 10 * time.Second
+
+// wsUrgentQueue bounds the separate queue for high-priority broadcasts.
+const wsUrgentQueue = 16
+
+// wsClient is a monitoring connection registered with the hub. Broadcasts are
+// queued on send (high-priority ones on urgent) and written by the client's
+// own writer goroutine, the only goroutine that writes data frames to conn
+// once it is registered.
+type wsClient struct {
+	conn   *websocket.Conn
+	prefs  format.Preferences
+	send   chan map[string]interface{}
+	urgent chan map[string]interface{}
+
+	commuter bool    // Only gets commuterVisible broadcasts
+	area     *wsArea // Viewport the client is limited to, if any; guarded by the hub's mu
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newWSClient starts the writer for conn.
+func newWSClient(conn *websocket.Conn, prefs format.Preferences) *wsClient {
+	c := &wsClient{
+		conn:   conn,
+		prefs:  prefs,
+		send:   make(chan map[string]interface{}, wsClientQueue),
+		urgent: make(chan map[string]interface{}, wsUrgentQueue),
+		done:   make(chan struct{}),
+	}
+	go c.writePump()
+	return c
+}
+
+// enqueue queues msg without blocking. When the queue is full the oldest
+// message is dropped: a client that falls behind should see the latest
+// positions, not stale ones. High-priority messages go on their own queue,
+// which routine traffic cannot crowd out.
+func (c *wsClient) enqueue(msg map[string]interface{}) {
+	hubMetrics.deliveries.Add(1)
+	if p, _ := msg["priority"].(string); p == wsproto.PriorityHigh {
+		select {
+		case c.urgent <- msg:
+		default:
+			hubMetrics.dropped(dropUrgentQueue)
+			logrus.WithField("conn_ptr", fmt.Sprintf("%p", c.conn)).Warn("wsClient: Urgent queue full, dropped high-priority message.")
+		}
+		return
+	}
+	for {
+		select {
+		case c.send <- msg:
+			return
+		default:
+		}
+		select {
+		case <-c.send:
+			hubMetrics.dropped(dropClientQueue)
+			logrus.WithField("conn_ptr", fmt.Sprintf("%p", c.conn)).Debug("wsClient: Queue full, dropped oldest message.")
+		default:
+		}
+	}
+}
+
+// stop ends the writer. Queued messages are discarded.
+func (c *wsClient) stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+}
+
+// writePump writes queued messages, urgent ones first, until the client is
+// stopped or a write fails. On failure it closes the connection, so the
+// handler's read loop ends and unregisters the client.
+func (c *wsClient) writePump() {
+	for {
+		var msg map[string]interface{}
+		select {
+		case <-c.done:
+			return
+		case msg = <-c.urgent:
+		default:
+			select {
+			case <-c.done:
+				return
+			case msg = <-c.urgent:
+			case msg = <-c.send:
+			}
+		}
+		if err := writeWS(c.conn, wsproto.KindOf(msg), localizeBroadcast(msg, c.prefs)); err != nil {
+			hubMetrics.writeErrors.Add(1)
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) {
+				logrus.WithError(err).WithField("conn_ptr", fmt.Sprintf("%p", c.conn)).Warn("wsClient: Failed to send broadcast, closing connection.")
+			}
+			c.stop()
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+var (
+	wsUsersMu sync.RWMutex
+	wsUsers   = map[*websocket.Conn]uint{} // Signed-in commuter behind a monitoring connection
+)
+
+// identifyConn records the user a connection belongs to so messages can be
+// addressed to them (see LocationHub.sendToUser). The returned func forgets
+// it; call it when the connection closes.
+func identifyConn(conn *websocket.Conn, userID uint) func() {
+	wsUsersMu.Lock()
+	wsUsers[conn] = userID
+	wsUsersMu.Unlock()
+	return func() {
+		wsUsersMu.Lock()
+		delete(wsUsers, conn)
+		wsUsersMu.Unlock()
+	}
+}
+
+// sendToUser queues msg on every connection of userID held by this replica.
+// Callers hold h.mu.
+func (h *LocationHub) sendToUser(userID uint, msg map[string]interface{}) {
+	wsUsersMu.RLock()
+	defer wsUsersMu.RUnlock()
+	send := func(clients map[*websocket.Conn]*wsClient) {
+		for conn, client := range clients {
+			if wsUsers[conn] == userID {
+				client.enqueue(msg)
+			}
+		}
+	}
+	for _, clients := range h.saccoClients {
+		send(clients)
+	}
+	for _, clients := range h.followers {
+		send(clients)
+	}
+}
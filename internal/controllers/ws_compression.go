@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"compress/flate"
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+)
+
+// Live broadcasts are small, repetitive JSON documents that permessage-deflate
+// shrinks several times over. Compression is used only when the client offers
+// it; CPU-constrained deployments can turn it off with WS_COMPRESSION=false or
+// trade ratio for speed with WS_COMPRESSION_LEVEL (1 fastest, 9 smallest).
+var (
+	wsCompression      = config.EnvBool("WS_COMPRESSION", true)
+	wsCompressionLevel = config.EnvInt("WS_COMPRESSION_LEVEL", flate.BestSpeed)
+)
+
+// readMessage reads the connection's next message, failing with
+// websocket.ErrReadLimit when it is longer than limit bytes. The
+// connection's own read limit counts bytes on the wire, which a compressed
+// message can inflate from a few kilobytes to gigabytes, so the limit is
+// applied again to the decompressed message.
+func readMessage(conn *websocket.Conn, limit int64) (int, []byte, error) {
+	messageType, r, err := conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	p, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return messageType, nil, err
+	}
+	if int64(len(p)) > limit {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""), time.Now().Add(wsPingWriteWait))
+		return messageType, nil, websocket.ErrReadLimit
+	}
+	return messageType, p, nil
+}
+
+// tuneCompression applies the configured compression level to a connection
+// that negotiated permessage-deflate; it does nothing for the others.
+func tuneCompression(conn *websocket.Conn) {
+	if !wsCompression {
+		return
+	}
+	if err := conn.SetCompressionLevel(wsCompressionLevel); err != nil {
+		logrus.WithError(err).WithField("level", wsCompressionLevel).Warn("tuneCompression: Invalid WS_COMPRESSION_LEVEL, keeping the default.")
+	}
+}
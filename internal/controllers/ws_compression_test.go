@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readOnce serves one connection like an authenticated one and reports the
+// length of its first message.
+func readOnce(t *testing.T) (string, <-chan error, <-chan int) {
+	t.Helper()
+	errs, sizes := make(chan error, 1), make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWS(w, r)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		tuneCompression(conn)
+		conn.SetReadLimit(wsReadLimit)
+		_, p, err := readMessage(conn, wsReadLimit)
+		if err != nil {
+			errs <- err
+			return
+		}
+		sizes <- len(p)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), errs, sizes
+}
+
+func sendCompressed(t *testing.T, url string, msg []byte) {
+	t.Helper()
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Fatal("compression was not negotiated")
+	}
+	conn.EnableWriteCompression(true)
+	if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestReadMessageCompressed(t *testing.T) {
+	url, errs, sizes := readOnce(t)
+	sendCompressed(t, url, []byte(strings.Repeat("a", 1000)))
+	select {
+	case n := <-sizes:
+		if n != 1000 {
+			t.Fatalf("read %d bytes, want 1000", n)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result from the server")
+	}
+}
+
+// A message that deflates to a few kilobytes on the wire must still be
+// refused when it inflates past the limit.
+func TestReadMessageDecompressionBomb(t *testing.T) {
+	url, errs, sizes := readOnce(t)
+	sendCompressed(t, url, []byte(strings.Repeat("a", 8<<20)))
+	select {
+	case n := <-sizes:
+		t.Fatalf("read %d bytes, want ErrReadLimit", n)
+	case err := <-errs:
+		if err != websocket.ErrReadLimit {
+			t.Fatalf("got %v, want ErrReadLimit", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result from the server")
+	}
+}
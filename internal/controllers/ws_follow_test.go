@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+func TestCommuterFollowNeedsPublishedRoute(t *testing.T) {
+	graphRouter(t, 0, "commuter")
+	for _, row := range []interface{}{
+		&models.Route{Model: gorm.Model{ID: 2}, SaccoID: 2, Name: "Draft", Status: models.RouteStatusDraft},
+		&models.Vehicle{Model: gorm.Model{ID: 4}, SaccoID: 2, RouteID: 2, VehicleNo: "KBB 004B"},
+	} {
+		if err := config.DB.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for query, want := range map[string]int{
+		"route_id=1":   0,
+		"route_id=2":   http.StatusNotFound,
+		"vehicle_id=3": 0,
+		"vehicle_id=4": http.StatusNotFound,
+		"vehicle_id=2": http.StatusNotFound, // No route at all
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/ws/location?"+query, nil)
+		if _, _, status, _ := commuterSubscription(c, "commuter"); status != want {
+			t.Errorf("%s: status %d; want %d", query, status, want)
+		}
+	}
+}
+
+// The route is stamped when a message is published, so the broadcast loop
+// routes it to followers without a lookup of its own.
+func TestPublishStampsRoute(t *testing.T) {
+	graphRouter(t, 0, "commuter")
+	h := &LocationHub{vehicleRoutes: make(map[uint]vehicleRoute)}
+	msg := h.withRoute(map[string]interface{}{"vehicle_id": uint(3), "sacco_id": float64(2)})
+	if vehicleID, routeID := h.followTargets(msg); vehicleID != 3 || routeID != 1 {
+		t.Errorf("follow targets %d, %d; want vehicle 3 on route 1", vehicleID, routeID)
+	}
+	alert := h.withRoute(map[string]interface{}{"type": "sos", "vehicle_id": uint(3)})
+	if _, ok := alert["route_id"]; ok {
+		t.Error("stamped a route on a message commuters never see")
+	}
+	if _, routeID := h.followTargets(h.withRoute(map[string]interface{}{"vehicle_id": uint(2)})); routeID != 0 {
+		t.Errorf("vehicle without a published route: route %d; want 0", routeID)
+	}
+}
+
+// A cache miss looks the route up without holding the cache lock, and
+// expired lookups are left for the sweep.
+func TestRouteLookupOutsideCacheLock(t *testing.T) {
+	graphRouter(t, 0, "commuter")
+	h := &LocationHub{vehicleRoutes: make(map[uint]vehicleRoute)}
+	var lockFree bool
+	if err := config.DB.Callback().Query().Before("gorm:query").Register("test:routes_lock", func(*gorm.DB) {
+		if h.routesMu.TryLock() {
+			lockFree = true
+			h.routesMu.Unlock()
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if routeID := h.routeOf(3); routeID != 1 || !lockFree {
+		t.Errorf("route %d, lock free during lookup %v; want route 1 looked up unlocked", routeID, lockFree)
+	}
+
+	h.vehicleRoutes[9] = vehicleRoute{routeID: 1, at: time.Now().Add(-vehicleRouteTTL)}
+	h.expireVehicleRoutes(time.Now())
+	if _, ok := h.vehicleRoutes[9]; ok {
+		t.Error("expired lookup survived the sweep")
+	}
+	if _, ok := h.vehicleRoutes[3]; !ok {
+		t.Error("fresh lookup was swept")
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+)
+
+// wsPongWait is how long a connection may go without a pong or any other
+// message before it is considered dead. Pings go out at 9/10 of it.
+var wsPongWait = config.EnvDuration("WS_PONG_WAIT", 60*time.Second)
+
+const wsPingWriteWait = 10 * time.Second
+
+var (
+	wsSeenMu sync.Mutex
+	wsSeen   = map[*websocket.Conn]time.Time{} // Last sign of life per connection
+)
+
+// keepAlive starts heartbeats on conn: it is pinged periodically and its read
+// deadline moves forward with every pong (and every message passed to
+// touchConn). The returned func stops the pings; call it when the connection
+// closes.
+func keepAlive(conn *websocket.Conn) func() {
+	touchConn(conn)
+	conn.SetPongHandler(func(string) error {
+		touchConn(conn)
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(wsPongWait * 9 / 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// WriteControl may run alongside the connection's other writes.
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsPingWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wsSeenMu.Lock()
+		delete(wsSeen, conn)
+		wsSeenMu.Unlock()
+	}
+}
+
+// touchConn records that the client is alive and extends its read deadline.
+func touchConn(conn *websocket.Conn) {
+	now := time.Now()
+	wsSeenMu.Lock()
+	wsSeen[conn] = now
+	wsSeenMu.Unlock()
+	conn.SetReadDeadline(now.Add(wsPongWait))
+}
+
+// reapStale periodically closes connections that have not answered a ping
+// within wsPongWait and drops them from the hub. Their handlers' read loops
+// then fail and finish cleaning up.
+func (h *LocationHub) reapStale() {
+	ticker := time.NewTicker(wsPongWait / 2)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		var stale []*websocket.Conn
+		wsSeenMu.Lock()
+		for conn, seen := range wsSeen {
+			if now.Sub(seen) > wsPongWait {
+				stale = append(stale, conn)
+				delete(wsSeen, conn)
+			}
+		}
+		wsSeenMu.Unlock()
+		for _, conn := range stale {
+			h.dropConn(conn)
+			conn.Close()
+			logrus.WithField("conn_ptr", fmt.Sprintf("%p", conn)).Info("LocationHub: Reaped unresponsive WebSocket connection.")
+		}
+	}
+}
+
+// dropConn removes conn from every subscription it holds and stops its writer.
+func (h *LocationHub) dropConn(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for saccoID, clients := range h.saccoClients {
+		if client, ok := clients[conn]; ok {
+			client.stop()
+			delete(clients, conn)
+		}
+		if len(clients) == 0 {
+			delete(h.saccoClients, saccoID)
+		}
+	}
+	for key, clients := range h.followers {
+		if client, ok := clients[conn]; ok {
+			client.stop()
+			delete(clients, conn)
+		}
+		if len(clients) == 0 {
+			delete(h.followers, key)
+		}
+	}
+	if client, ok := h.areaClients[conn]; ok {
+		client.stop()
+		delete(h.areaClients, conn)
+	}
+}
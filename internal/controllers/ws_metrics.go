@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Places a broadcast can be dropped, as reported by GetWebSocketMetrics.
+const (
+	dropBroadcastChannel = "broadcast_channel" // Hub's channel full
+	dropBusQueue         = "bus_queue"         // Outbound queue to the bus full
+	dropClientQueue      = "client_queue"      // Oldest message dropped for a slow client
+	dropUrgentQueue      = "urgent_queue"      // High-priority message dropped for a slow client
+)
+
+// broadcastRateWindow is how far back broadcasts_per_sec looks, sampled every
+// broadcastRateSample.
+const (
+	broadcastRateWindow = time.Minute
+	broadcastRateSample = 5 * time.Second
+)
+
+// wsMetrics counts this replica's WebSocket activity since it started.
+// Connections are a gauge; everything else only goes up.
+type wsMetrics struct {
+	mu          sync.Mutex
+	connections map[string]int64 // By role
+	drops       map[string]int64 // By drop* reason
+	samples     []rateSample     // Broadcast counts over the last broadcastRateWindow
+
+	broadcasts  atomic.Int64 // Messages taken off the hub's channel
+	deliveries  atomic.Int64 // Messages queued for a client
+	writeErrors atomic.Int64 // Client writes that failed and closed the connection
+	started     time.Time
+}
+
+type rateSample struct {
+	at    time.Time
+	count int64
+}
+
+var hubMetrics = newWSMetrics()
+
+// Labelled WebSocket metrics for Prometheus, kept up to date as connections
+// come and go and broadcasts are dropped.
+var (
+	wsConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ws_connections",
+		Help: "Open WebSocket connections, by role.",
+	}, []string{"role"})
+	wsDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_broadcast_drops_total",
+		Help: "Broadcasts dropped, by where they were dropped.",
+	}, []string{"reason"})
+)
+
+func newWSMetrics() *wsMetrics {
+	m := &wsMetrics{
+		connections: map[string]int64{},
+		drops:       map[string]int64{},
+		started:     time.Now(),
+	}
+	go m.sample()
+	return m
+}
+
+// connected counts a connection of role; the returned func uncounts it when
+// the connection closes.
+func (m *wsMetrics) connected(role string) func() {
+	m.mu.Lock()
+	m.connections[role]++
+	m.mu.Unlock()
+	wsConnections.WithLabelValues(role).Inc()
+	return func() {
+		m.mu.Lock()
+		m.connections[role]--
+		m.mu.Unlock()
+		wsConnections.WithLabelValues(role).Dec()
+	}
+}
+
+// dropped counts a broadcast lost at the given drop* reason.
+func (m *wsMetrics) dropped(reason string) {
+	m.mu.Lock()
+	m.drops[reason]++
+	m.mu.Unlock()
+	wsDrops.WithLabelValues(reason).Inc()
+}
+
+// sample records the broadcast count periodically for broadcastsPerSec.
+func (m *wsMetrics) sample() {
+	ticker := time.NewTicker(broadcastRateSample)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.mu.Lock()
+		m.samples = append(m.samples, rateSample{at: now, count: m.broadcasts.Load()})
+		for len(m.samples) > 1 && now.Sub(m.samples[0].at) > broadcastRateWindow {
+			m.samples = m.samples[1:]
+		}
+		m.mu.Unlock()
+	}
+}
+
+// broadcastsPerSec averages the hub's broadcast rate over the sampled window,
+// or since startup before the first sample. Callers hold m.mu.
+func (m *wsMetrics) broadcastsPerSec(now time.Time) float64 {
+	from := rateSample{at: m.started}
+	if len(m.samples) > 0 {
+		from = m.samples[0]
+	}
+	elapsed := now.Sub(from.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.broadcasts.Load()-from.count) / elapsed
+}
+
+// wsCounts is a consistent reading of the metrics and the hub's current
+// subscriptions.
+type wsCounts struct {
+	now                                  time.Time
+	connections, drops                   map[string]int64
+	totalConnections, totalDrops         int64
+	rate                                 float64
+	saccoClients, followers, areaClients int
+	drivers                              int
+	queueLength, queueCapacity           int
+}
+
+func (m *wsMetrics) read(h *LocationHub) wsCounts {
+	r := wsCounts{now: time.Now()}
+	m.mu.Lock()
+	r.connections = make(map[string]int64, len(m.connections))
+	for role, n := range m.connections {
+		r.connections[role] = n
+		r.totalConnections += n
+	}
+	r.drops = make(map[string]int64, len(m.drops))
+	for reason, n := range m.drops {
+		r.drops[reason] = n
+		r.totalDrops += n
+	}
+	r.rate = m.broadcastsPerSec(r.now)
+	m.mu.Unlock()
+
+	h.mu.Lock()
+	for _, clients := range h.saccoClients {
+		r.saccoClients += len(clients)
+	}
+	for _, clients := range h.followers {
+		r.followers += len(clients)
+	}
+	r.areaClients = len(h.areaClients)
+	h.mu.Unlock()
+	driverSessionsMu.RLock()
+	r.drivers = len(driverSessions)
+	driverSessionsMu.RUnlock()
+	r.queueLength, r.queueCapacity = len(h.broadcast), cap(h.broadcast)
+	return r
+}
+
+// snapshot returns the metrics with the hub's current subscriptions.
+func (m *wsMetrics) snapshot(h *LocationHub) gin.H {
+	r := m.read(h)
+	return gin.H{
+		"uptime_seconds":      int64(r.now.Sub(m.started).Seconds()),
+		"connections":         r.totalConnections,
+		"connections_by_role": r.connections,
+		"driver_sessions":     r.drivers,
+		"subscriptions": gin.H{
+			"sacco":    r.saccoClients,
+			"follower": r.followers,
+			"area":     r.areaClients,
+		},
+		"broadcasts":         m.broadcasts.Load(),
+		"broadcasts_per_sec": r.rate,
+		"broadcast_queue":    gin.H{"length": r.queueLength, "capacity": r.queueCapacity},
+		"deliveries":         m.deliveries.Load(),
+		"drops":              r.totalDrops,
+		"drops_by_reason":    r.drops,
+		"write_errors":       m.writeErrors.Load(),
+	}
+}
+
+var registerWSMetrics sync.Once
+
+// RegisterWebSocketMetrics exports the WebSocket metrics on /metrics. Calls
+// after the first do nothing.
+func RegisterWebSocketMetrics() {
+	registerWSMetrics.Do(registerWebSocketMetrics)
+}
+
+func registerWebSocketMetrics() {
+	for _, reason := range []string{dropBroadcastChannel, dropBusQueue, dropClientQueue, dropUrgentQueue} {
+		wsDrops.WithLabelValues(reason) // Report every reason, dropped or not
+	}
+	gauge := func(name, help string, labels prometheus.Labels, value func(wsCounts) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels},
+			func() float64 { return float64(value(hubMetrics.read(locationHub))) })
+	}
+	counter := func(name, help string, value *atomic.Int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help},
+			func() float64 { return float64(value.Load()) })
+	}
+	const subscriptionsHelp = "Location subscriptions held by the hub, by kind."
+	prometheus.MustRegister(
+		wsConnections,
+		wsDrops,
+		gauge("ws_driver_sessions", "Drivers with an open WebSocket session.", nil,
+			func(r wsCounts) int { return r.drivers }),
+		gauge("ws_subscriptions", subscriptionsHelp, prometheus.Labels{"kind": "sacco"},
+			func(r wsCounts) int { return r.saccoClients }),
+		gauge("ws_subscriptions", subscriptionsHelp, prometheus.Labels{"kind": "follower"},
+			func(r wsCounts) int { return r.followers }),
+		gauge("ws_subscriptions", subscriptionsHelp, prometheus.Labels{"kind": "area"},
+			func(r wsCounts) int { return r.areaClients }),
+		gauge("ws_broadcast_queue_length", "Broadcasts waiting on the hub's channel.", nil,
+			func(r wsCounts) int { return r.queueLength }),
+		gauge("ws_broadcast_queue_capacity", "Capacity of the hub's broadcast channel.", nil,
+			func(r wsCounts) int { return r.queueCapacity }),
+		counter("ws_broadcasts_total", "Messages taken off the hub's broadcast channel.", &hubMetrics.broadcasts),
+		counter("ws_deliveries_total", "Messages queued for a WebSocket client.", &hubMetrics.deliveries),
+		counter("ws_write_errors_total", "Client writes that failed and closed the connection.", &hubMetrics.writeErrors),
+	)
+}
+
+// GetWebSocketMetrics reports this replica's WebSocket connections and
+// broadcast traffic: connections by role, subscriptions held by the hub,
+// broadcasts (total and per second over the last minute), messages dropped
+// by where they were dropped, and failed client writes.
+func GetWebSocketMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": hubMetrics.snapshot(locationHub)})
+}
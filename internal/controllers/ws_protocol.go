@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"ma3_tracker/internal/wsproto"
+)
+
+// wsEncoding is how messages to a client are encoded.
+type wsEncoding int
+
+const (
+	encodingLegacy wsEncoding = iota // Flat JSON objects
+	encodingJSON                     // wsproto envelopes as JSON text frames
+	encodingProto                    // wsproto envelopes as protobuf binary frames
+)
+
+// WebSocket subprotocols selecting protocol v1; they take precedence over the
+// query parameters.
+const (
+	subprotocolJSON  = "ma3tracker.v1+json"
+	subprotocolProto = "ma3tracker.v1+proto"
+)
+
+var (
+	wsProtocolsMu sync.RWMutex
+	wsEncodings   = map[*websocket.Conn]wsEncoding{}
+	wsWriteLocks  = map[*websocket.Conn]*sync.Mutex{} // A connection takes one writer at a time
+)
+
+// wsProtocol reads ?protocol= ("v1" for wsproto envelopes, empty or "legacy"
+// for flat messages) and ?encoding= ("json" or "protobuf", which implies v1).
+func wsProtocol(c *gin.Context) (wsEncoding, error) {
+	enc := encodingLegacy
+	switch c.Query("protocol") {
+	case "", "legacy":
+	case "v1", "1":
+		enc = encodingJSON
+	default:
+		return 0, errors.New("unsupported 'protocol'; use v1 or legacy")
+	}
+	switch c.Query("encoding") {
+	case "", "json":
+	case "protobuf", "proto":
+		enc = encodingProto
+	default:
+		return 0, errors.New("unsupported 'encoding'; use json or protobuf")
+	}
+	return enc, nil
+}
+
+// negotiatedEncoding applies the subprotocol the client and server agreed on,
+// if any, over the encoding asked for in the query.
+func negotiatedEncoding(conn *websocket.Conn, fromQuery wsEncoding) wsEncoding {
+	switch conn.Subprotocol() {
+	case subprotocolProto:
+		return encodingProto
+	case subprotocolJSON:
+		return encodingJSON
+	}
+	return fromQuery
+}
+
+// useProtocol records how messages to conn are encoded. The returned func
+// forgets it; call it when the connection closes.
+func useProtocol(conn *websocket.Conn, enc wsEncoding) func() {
+	wsProtocolsMu.Lock()
+	wsEncodings[conn] = enc
+	wsWriteLocks[conn] = &sync.Mutex{}
+	wsProtocolsMu.Unlock()
+	return func() {
+		wsProtocolsMu.Lock()
+		delete(wsEncodings, conn)
+		delete(wsWriteLocks, conn)
+		wsProtocolsMu.Unlock()
+	}
+}
+
+// lockWrites waits for conn's other writers and returns the func that lets
+// the next one in.
+func lockWrites(conn *websocket.Conn) func() {
+	wsProtocolsMu.RLock()
+	mu := wsWriteLocks[conn]
+	wsProtocolsMu.RUnlock()
+	if mu == nil {
+		return func() {}
+	}
+	mu.Lock()
+	return mu.Unlock
+}
+
+func usesEnvelopes(conn *websocket.Conn) bool {
+	wsProtocolsMu.RLock()
+	defer wsProtocolsMu.RUnlock()
+	return wsEncodings[conn] != encodingLegacy
+}
+
+// writeWS sends a flat message of the given wsproto kind, wrapped in an
+// envelope when the client speaks protocol v1. It is safe to call from any
+// goroutine, and gives up on a client that does not read the message within
+// wsWriteWait.
+func writeWS(conn *websocket.Conn, kind string, msg map[string]interface{}) error {
+	wsProtocolsMu.RLock()
+	enc := wsEncodings[conn]
+	wsProtocolsMu.RUnlock()
+	defer lockWrites(conn)()
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if enc == encodingLegacy {
+		return conn.WriteJSON(msg)
+	}
+	env, err := wsproto.Wrap(kind, msg)
+	if err != nil {
+		return err
+	}
+	if enc == encodingProto {
+		b, err := env.MarshalProto()
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.BinaryMessage, b)
+	}
+	return conn.WriteJSON(env)
+}
+
+// writeWSText sends a plain text frame, as some legacy replies are.
+func writeWSText(conn *websocket.Conn, text string) error {
+	defer lockWrites(conn)()
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+// writeWSError tells a client its message was rejected.
+func writeWSError(conn *websocket.Conn, text string) error {
+	return writeWS(conn, wsproto.TypeError, gin.H{"error": text})
+}
+
+// GetWebSocketSchema serves the JSON Schema of the v1 WebSocket protocol.
+func GetWebSocketSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", wsproto.Schema())
+}
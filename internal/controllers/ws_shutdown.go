@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/config"
+)
+
+// wsCloseGrace is how long clients have to answer the close frame sent on
+// shutdown. Messages already being handled, such as a driver's location
+// update, still finish; their handlers then return.
+var wsCloseGrace = config.EnvDuration("WS_CLOSE_GRACE", 5*time.Second)
+
+var (
+	wsOpenMu  sync.Mutex
+	wsOpen    = map[*websocket.Conn]struct{}{} // Every upgraded connection, until its handler returns
+	wsClosing bool
+	wsActive  sync.WaitGroup
+)
+
+// trackConn records an upgraded connection so shutdown can close it. The
+// returned func forgets it; call it when the handler returns. ok is false
+// once the server is shutting down, and the connection should be closed.
+func trackConn(conn *websocket.Conn) (release func(), ok bool) {
+	wsOpenMu.Lock()
+	defer wsOpenMu.Unlock()
+	if wsClosing {
+		return nil, false
+	}
+	wsOpen[conn] = struct{}{}
+	wsActive.Add(1)
+	return func() {
+		wsOpenMu.Lock()
+		delete(wsOpen, conn)
+		wsOpenMu.Unlock()
+		wsActive.Done()
+	}, true
+}
+
+// closeGoingAway sends conn a close frame telling the client the server is
+// going away, so it can reconnect to another replica.
+func closeGoingAway(conn *websocket.Conn) error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	return conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsPingWriteWait))
+}
+
+// ShutdownLocationHub closes every WebSocket connection for shutdown. The
+// hub's writers are stopped, each client gets a close frame and has
+// wsCloseGrace to answer it, and their handlers are waited for, so location
+// updates already received are saved. Connections still open when ctx ends
+// are dropped and ctx's error returned. The hub's bus, if any, is closed last.
+func ShutdownLocationHub(ctx context.Context) error {
+	wsOpenMu.Lock()
+	wsClosing = true
+	conns := make([]*websocket.Conn, 0, len(wsOpen))
+	for conn := range wsOpen {
+		conns = append(conns, conn)
+	}
+	wsOpenMu.Unlock()
+
+	locationHub.stopWriters()
+	deadline := time.Now().Add(wsCloseGrace)
+	for _, conn := range conns {
+		closeGoingAway(conn)
+		// Read loops end on the client's close frame, or at the deadline.
+		conn.SetReadDeadline(deadline)
+	}
+	logrus.WithField("connections", len(conns)).Info("ShutdownLocationHub: Sent close frames, waiting for handlers.")
+
+	done := make(chan struct{})
+	go func() {
+		wsActive.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		wsOpenMu.Lock()
+		for conn := range wsOpen {
+			conn.Close()
+		}
+		wsOpenMu.Unlock()
+		logrus.WithError(err).Warn("ShutdownLocationHub: Dropped connections that did not close in time.")
+	}
+	locationHub.closeBus()
+	return err
+}
+
+// stopWriters stops every monitoring client's writer so nothing is written
+// after its close frame. Queued broadcasts are discarded.
+func (h *LocationHub) stopWriters() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, clients := range h.saccoClients {
+		for _, client := range clients {
+			client.stop()
+		}
+	}
+	for _, clients := range h.followers {
+		for _, client := range clients {
+			client.stop()
+		}
+	}
+	for _, client := range h.areaClients {
+		client.stop()
+	}
+}
+
+// closeBus disconnects the hub from its bus, if it has one.
+func (h *LocationHub) closeBus() {
+	if h.bus == nil {
+		return
+	}
+	if err := h.bus.Close(); err != nil {
+		logrus.WithError(err).Warn("ShutdownLocationHub: Failed to close location bus.")
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// wsBroadcastInterval is the least time between two live location updates of
+// a vehicle for saccos that have not set their own. Zero disables throttling.
+var wsBroadcastInterval = config.EnvDuration("WS_BROADCAST_INTERVAL", time.Second)
+
+// broadcastIntervalTTL bounds how long a sacco's setting is reused.
+const broadcastIntervalTTL = time.Minute
+
+// vehicleThrottle holds a vehicle's last broadcast and the newest update
+// waiting for its interval to pass.
+type vehicleThrottle struct {
+	last    time.Time
+	pending map[string]interface{}
+	timer   *time.Timer
+}
+
+type cachedInterval struct {
+	interval time.Duration
+	fetched  time.Time
+}
+
+var (
+	throttleMu sync.Mutex
+	throttles  = map[uint]*vehicleThrottle{}
+
+	intervalMu     sync.Mutex
+	saccoIntervals = map[uint]cachedInterval{}
+)
+
+// publishThrottled publishes a vehicle's location update at most once per
+// its sacco's broadcast interval. Updates arriving sooner are coalesced: only
+// the latest is sent, when the interval has passed. Updates without a vehicle
+// are published straight away.
+func publishThrottled(vehicleID, saccoID uint, msg map[string]interface{}) {
+	interval := broadcastInterval(saccoID)
+	if vehicleID == 0 || interval <= 0 {
+		locationHub.PublishLocation(msg)
+		return
+	}
+	throttleMu.Lock()
+	t, ok := throttles[vehicleID]
+	if !ok {
+		t = &vehicleThrottle{}
+		throttles[vehicleID] = t
+	}
+	now := time.Now()
+	if t.timer == nil && now.Sub(t.last) >= interval {
+		t.last = now
+		throttleMu.Unlock()
+		locationHub.PublishLocation(msg)
+		return
+	}
+	t.pending = msg
+	if t.timer == nil {
+		t.timer = time.AfterFunc(t.last.Add(interval).Sub(now), func() { flushThrottle(vehicleID) })
+	}
+	throttleMu.Unlock()
+}
+
+// flushThrottle publishes the vehicle's coalesced update.
+func flushThrottle(vehicleID uint) {
+	throttleMu.Lock()
+	t := throttles[vehicleID]
+	msg := t.pending
+	t.pending, t.timer, t.last = nil, nil, time.Now()
+	throttleMu.Unlock()
+	if msg != nil {
+		locationHub.PublishLocation(msg)
+	}
+}
+
+// broadcastInterval returns the sacco's broadcast interval, falling back to
+// wsBroadcastInterval when it has none or it cannot be loaded.
+func broadcastInterval(saccoID uint) time.Duration {
+	if saccoID == 0 {
+		return wsBroadcastInterval
+	}
+	intervalMu.Lock()
+	c, ok := saccoIntervals[saccoID]
+	intervalMu.Unlock()
+	if ok && time.Since(c.fetched) < broadcastIntervalTTL {
+		return c.interval
+	}
+	var ms []*int
+	if err := config.DB.Model(&models.Sacco{}).Where("id = ?", saccoID).Limit(1).Pluck("broadcast_interval_ms", &ms).Error; err != nil {
+		logrus.WithError(err).WithField("sacco_id", saccoID).Warn("broadcastInterval: Failed to load sacco setting.")
+		return wsBroadcastInterval
+	}
+	c = cachedInterval{interval: wsBroadcastInterval, fetched: time.Now()}
+	if len(ms) > 0 && ms[0] != nil {
+		c.interval = time.Duration(*ms[0]) * time.Millisecond
+	}
+	intervalMu.Lock()
+	saccoIntervals[saccoID] = c
+	intervalMu.Unlock()
+	return c.interval
+}
+
+// GetBroadcastThrottle returns the sacco's broadcast interval setting and the
+// interval in effect, in milliseconds.
+func GetBroadcastThrottle(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "GetBroadcastThrottle")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"broadcast_interval_ms": sacco.BroadcastIntervalMs,
+		"default_interval_ms":   wsBroadcastInterval.Milliseconds(),
+		"effective_interval_ms": broadcastInterval(sacco.ID).Milliseconds(),
+	}})
+}
+
+// SetBroadcastThrottle sets how often, at most, each of the sacco's vehicles
+// is broadcast to live clients. Body: {"broadcast_interval_ms": 2000}; 0
+// sends every update and null restores the default.
+func SetBroadcastThrottle(c *gin.Context) {
+	sacco, ok := authenticatedSacco(c, "SetBroadcastThrottle")
+	if !ok {
+		return
+	}
+	var input struct {
+		BroadcastIntervalMs *int `json:"broadcast_interval_ms" binding:"omitempty,min=0,max=30000"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Fail(c, apierror.Invalid(err))
+		return
+	}
+	if err := config.DB.Model(sacco).Update("broadcast_interval_ms", input.BroadcastIntervalMs).Error; err != nil {
+		logrus.WithContext(c).WithError(err).WithField("sacco_id", sacco.ID).Error("SetBroadcastThrottle: Failed to save setting.")
+		apierror.Respond(c, http.StatusInternalServerError, "Failed to save broadcast throttle")
+		return
+	}
+	intervalMu.Lock()
+	delete(saccoIntervals, sacco.ID)
+	intervalMu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"message": "Broadcast throttle updated", "data": gin.H{
+		"broadcast_interval_ms": input.BroadcastIntervalMs,
+		"effective_interval_ms": broadcastInterval(sacco.ID).Milliseconds(),
+	}})
+}
@@ -0,0 +1,232 @@
+// Package crowding turns commuter crowding reports into a decaying crowding
+// index per stop and per vehicle.
+package crowding
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// HalfLife is how quickly a report loses weight.
+	HalfLife = config.EnvDuration("CROWDING_HALF_LIFE", 15*time.Minute)
+	// Window bounds which reports are considered at all.
+	Window = config.EnvDuration("CROWDING_WINDOW", 2*time.Hour)
+	// Cooldown is the minimum gap between two reports by one user for one stop.
+	Cooldown = config.EnvDuration("CROWDING_REPORT_COOLDOWN", 10*time.Minute)
+	// HourlyLimit caps how many reports a user may file per hour across all
+	// stops, and separately across all vehicles.
+	HourlyLimit = config.EnvInt("CROWDING_REPORT_HOURLY_LIMIT", 12)
+
+	// Vehicles fill and empty at every stage, so their reports age faster.
+	VehicleHalfLife = config.EnvDuration("CROWDING_VEHICLE_HALF_LIFE", 5*time.Minute)
+	VehicleWindow   = config.EnvDuration("CROWDING_VEHICLE_WINDOW", 30*time.Minute)
+	VehicleCooldown = config.EnvDuration("CROWDING_VEHICLE_REPORT_COOLDOWN", 5*time.Minute)
+)
+
+// Errors returned by Submit when a report is refused.
+var (
+	ErrCooldown        = errors.New("you reported this stop recently")
+	ErrVehicleCooldown = errors.New("you reported this vehicle recently")
+	ErrHourlyLimit     = errors.New("too many crowding reports in the last hour")
+)
+
+// Index summarises recent reports for one stop.
+type Index struct {
+	StopID  uint      `json:"stop_id"`
+	Score   float64   `json:"score"` // 0 (empty) to 100 (packed)
+	Level   string    `json:"level"` // empty, light, moderate, busy or packed
+	Reports int       `json:"reports"`
+	AsOf    time.Time `json:"as_of"`
+}
+
+var (
+	levelNames        = []string{"empty", "light", "moderate", "busy", "packed"}
+	vehicleLevelNames = []string{"seats_available", "standing_room", "full"}
+)
+
+// lockReporter locks the reporter's user row for the rest of tx, so their
+// reports are checked against the limits one at a time: two submitted at once
+// cannot both pass the cooldown.
+func lockReporter(tx *gorm.DB, userID uint) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error
+}
+
+// Submit stores a report after enforcing the per-reporter limits.
+func Submit(db *gorm.DB, userID, stopID uint, level int, now time.Time) (models.StopCrowdingReport, error) {
+	report := models.StopCrowdingReport{StopID: stopID, UserID: userID, Level: level, ReportedAt: now}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReporter(tx, userID); err != nil {
+			return err
+		}
+		var recent int64
+		if err := tx.Model(&models.StopCrowdingReport{}).
+			Where("user_id = ? AND stop_id = ? AND reported_at > ?", userID, stopID, now.Add(-Cooldown)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrCooldown
+		}
+		var hourly int64
+		if err := tx.Model(&models.StopCrowdingReport{}).
+			Where("user_id = ? AND reported_at > ?", userID, now.Add(-time.Hour)).
+			Count(&hourly).Error; err != nil {
+			return err
+		}
+		if hourly >= int64(HourlyLimit) {
+			return ErrHourlyLimit
+		}
+		return tx.Create(&report).Error
+	})
+	return report, err
+}
+
+// observation is a report on a stop or vehicle (target).
+type observation struct {
+	target, user uint
+	level        int
+	at           time.Time
+}
+
+// weighted is the decayed mean level of a target's reports.
+type weighted struct {
+	mean      float64
+	reporters int
+}
+
+// aggregate weights each observation by 2^(-age/halfLife) and averages them
+// per target. Observations must be newest first; only a reporter's latest
+// one counts, so repeated reports cannot dominate.
+func aggregate(obs []observation, halfLife time.Duration, now time.Time) map[uint]weighted {
+	type key struct{ target, user uint }
+	seen := make(map[key]bool)
+	sums := make(map[uint][2]float64) // weighted level sum, weight sum
+	counts := make(map[uint]int)
+	for _, o := range obs {
+		k := key{o.target, o.user}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		w := math.Pow(2, -now.Sub(o.at).Seconds()/halfLife.Seconds())
+		s := sums[o.target]
+		s[0] += w * float64(o.level)
+		s[1] += w
+		sums[o.target] = s
+		counts[o.target]++
+	}
+	out := make(map[uint]weighted, len(sums))
+	for target, s := range sums {
+		if s[1] > 0 {
+			out[target] = weighted{mean: s[0] / s[1], reporters: counts[target]}
+		}
+	}
+	return out
+}
+
+// ForStops computes the crowding index of each stop that has recent reports.
+// Each report is weighted by 2^(-age/HalfLife), and a single reporter's
+// reports count as one so repeated reports cannot dominate.
+func ForStops(db *gorm.DB, stopIDs []uint, now time.Time) (map[uint]Index, error) {
+	out := make(map[uint]Index)
+	if len(stopIDs) == 0 {
+		return out, nil
+	}
+	var reports []models.StopCrowdingReport
+	if err := db.Where("stop_id IN ? AND reported_at > ?", stopIDs, now.Add(-Window)).
+		Order("reported_at DESC").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	obs := make([]observation, 0, len(reports))
+	for _, r := range reports {
+		obs = append(obs, observation{r.StopID, r.UserID, r.Level, r.ReportedAt})
+	}
+	for stopID, w := range aggregate(obs, HalfLife, now) {
+		out[stopID] = Index{
+			StopID:  stopID,
+			Score:   math.Round(w.mean/models.CrowdingPacked*1000) / 10,
+			Level:   levelNames[int(math.Round(w.mean))],
+			Reports: w.reporters,
+			AsOf:    now,
+		}
+	}
+	return out, nil
+}
+
+// SubmitVehicle stores a report on a vehicle after enforcing the
+// per-reporter limits.
+func SubmitVehicle(db *gorm.DB, userID, vehicleID uint, level int, lat, lng float64, now time.Time) (models.VehicleCrowdingReport, error) {
+	report := models.VehicleCrowdingReport{VehicleID: vehicleID, UserID: userID, Level: level, Latitude: lat, Longitude: lng, ReportedAt: now}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReporter(tx, userID); err != nil {
+			return err
+		}
+		var recent int64
+		if err := tx.Model(&models.VehicleCrowdingReport{}).
+			Where("user_id = ? AND vehicle_id = ? AND reported_at > ?", userID, vehicleID, now.Add(-VehicleCooldown)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrVehicleCooldown
+		}
+		var hourly int64
+		if err := tx.Model(&models.VehicleCrowdingReport{}).
+			Where("user_id = ? AND reported_at > ?", userID, now.Add(-time.Hour)).
+			Count(&hourly).Error; err != nil {
+			return err
+		}
+		if hourly >= int64(HourlyLimit) {
+			return ErrHourlyLimit
+		}
+		return tx.Create(&report).Error
+	})
+	return report, err
+}
+
+// ForVehicles computes the crowding of each vehicle with reports in the last
+// VehicleWindow, weighted like ForStops but with VehicleHalfLife.
+func ForVehicles(db *gorm.DB, vehicleIDs []uint, now time.Time) (map[uint]models.VehicleCrowding, error) {
+	out := make(map[uint]models.VehicleCrowding)
+	if len(vehicleIDs) == 0 {
+		return out, nil
+	}
+	var reports []models.VehicleCrowdingReport
+	if err := db.Where("vehicle_id IN ? AND reported_at > ?", vehicleIDs, now.Add(-VehicleWindow)).
+		Order("reported_at DESC").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	obs := make([]observation, 0, len(reports))
+	for _, r := range reports {
+		obs = append(obs, observation{r.VehicleID, r.UserID, r.Level, r.ReportedAt})
+	}
+	for vehicleID, w := range aggregate(obs, VehicleHalfLife, now) {
+		asOf := now
+		out[vehicleID] = models.VehicleCrowding{
+			Level:     vehicleLevelNames[int(math.Round(w.mean))],
+			Score:     math.Round(w.mean/models.VehicleFull*1000) / 10,
+			Reports:   w.reporters,
+			UpdatedAt: &asOf,
+		}
+	}
+	return out, nil
+}
+
+// VehicleLevel parses a vehicle crowding level name.
+func VehicleLevel(name string) (int, bool) {
+	for i, n := range vehicleLevelNames {
+		if n == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
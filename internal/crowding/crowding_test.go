@@ -0,0 +1,59 @@
+package crowding
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+func TestSubmitCooldown(t *testing.T) {
+	db := testdb.Open(t, &models.User{}, &models.StopCrowdingReport{}, &models.VehicleCrowdingReport{})
+	if err := db.Create(&models.User{Model: gorm.Model{ID: 1}, Email: "c@example.com", Role: "commuter"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// Reports submitted at once are checked one at a time.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Submit(db, 1, 1, models.CrowdingBusy, now)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var saved, refused int
+	for err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case errors.Is(err, ErrCooldown):
+			refused++
+		default:
+			t.Fatal(err)
+		}
+	}
+	if saved != 1 || refused != 3 {
+		t.Errorf("%d saved, %d refused; want 1 and 3", saved, refused)
+	}
+
+	if _, err := Submit(db, 1, 1, models.CrowdingBusy, now.Add(Cooldown+time.Second)); err != nil {
+		t.Errorf("after the cooldown: %v", err)
+	}
+	if _, err := SubmitVehicle(db, 1, 1, models.VehicleFull, 0, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SubmitVehicle(db, 1, 1, models.VehicleFull, 0, 0, now.Add(time.Second)); !errors.Is(err, ErrVehicleCooldown) {
+		t.Errorf("second vehicle report: err = %v; want ErrVehicleCooldown", err)
+	}
+}
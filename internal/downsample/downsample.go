@@ -0,0 +1,237 @@
+// Package downsample thins aged location history. Points arrive as often as
+// once a second, which trip detection, adherence scoring and driving
+// analysis need while they are recent; months later a point every
+// Resolution, plus those that keep the path's shape, is enough.
+package downsample
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// After is the age at which points are thinned; 0 turns thinning off.
+	After = config.EnvDuration("LOCATION_DOWNSAMPLE_AFTER", 30*24*time.Hour)
+	// Resolution is the longest stretch of time left without a point; 0
+	// thins by geometry alone.
+	Resolution = config.EnvDuration("LOCATION_DOWNSAMPLE_RESOLUTION", 30*time.Second)
+	// Tolerance is how far (meters) the thinned path may stray from the
+	// original one; 0 thins by time alone.
+	Tolerance = config.EnvFloat("LOCATION_DOWNSAMPLE_TOLERANCE_METERS", 50)
+)
+
+// minAge is the youngest data thinned whatever After says, leaving the
+// background jobs that read recent history their full-resolution points.
+const minAge = 7 * 24 * time.Hour
+
+const deleteBatchSize = 5000
+
+// Thin decides which of a stream's time-ordered points to keep: the first
+// and last, those the Douglas-Peucker simplification at toleranceMeters
+// keeps, one at least every resolution, and both sides of every change in
+// event type, movement or trip and of every reporting gap longer than
+// resolution.
+func Thin(points []models.LocationHistory, resolution time.Duration, toleranceMeters float64) []bool {
+	n := len(points)
+	keep := make([]bool, n)
+	if n == 0 {
+		return keep
+	}
+	if toleranceMeters > 0 {
+		line := make([]geo.Point, n)
+		for i, p := range points {
+			line[i] = geo.Point{Lat: p.Latitude, Lng: p.Longitude}
+		}
+		keep = geo.SimplifyMask(line, toleranceMeters)
+	}
+	keep[0], keep[n-1] = true, true
+
+	last := points[0].Timestamp
+	for i := 1; i < n; i++ {
+		p, prev := points[i], points[i-1]
+		switch {
+		case p.EventType != prev.EventType, p.IsMoving != prev.IsMoving, p.TripID != prev.TripID:
+			keep[i-1], keep[i] = true, true
+		case resolution > 0 && p.Timestamp.Sub(prev.Timestamp) > resolution:
+			keep[i-1], keep[i] = true, true
+		case resolution > 0 && p.Timestamp.Sub(last) >= resolution:
+			keep[i] = true
+		}
+		if keep[i] {
+			last = p.Timestamp
+		}
+	}
+	return keep
+}
+
+// StartDownsampling periodically thins the location history older than
+// After, a day at a time.
+func StartDownsampling(interval time.Duration) {
+	if After <= 0 {
+		logrus.Info("downsample: Location history thinning is turned off.")
+		return
+	}
+	if After < minAge {
+		logrus.Warnf("downsample: LOCATION_DOWNSAMPLE_AFTER is below %s; using %s.", minAge, minAge)
+		After = minAge
+	}
+	background.Every(interval, func(context.Context) { downsample(time.Now()) })
+}
+
+// downsample thins every whole day since the last run that is older than
+// After.
+func downsample(now time.Time) {
+	cutoff := now.Add(-After)
+	var last models.LocationDownsampleRun
+	if err := config.DB.Order("through DESC").Limit(1).Find(&last).Error; err != nil {
+		logrus.WithError(err).Error("downsample: Failed to load the last run.")
+		return
+	}
+	from := last.Through
+	if last.ID == 0 {
+		var first *time.Time
+		if err := config.DB.Model(&models.LocationHistory{}).Select("MIN(timestamp)").Scan(&first).Error; err != nil {
+			logrus.WithError(err).Error("downsample: Failed to find the oldest point.")
+			return
+		}
+		if first == nil {
+			return
+		}
+		from = first.UTC().Truncate(24 * time.Hour)
+	}
+
+	for to := from.Add(24 * time.Hour); !to.After(cutoff); from, to = to, to.Add(24*time.Hour) {
+		run, err := thinDay(from, to)
+		if err != nil {
+			logrus.WithError(err).WithField("from", from).Error("downsample: Failed to thin location history.")
+			return
+		}
+		if err := config.DB.Create(&run).Error; err != nil {
+			logrus.WithError(err).WithField("from", from).Error("downsample: Failed to record run.")
+			return
+		}
+		if run.Deleted > 0 {
+			logrus.Infof("downsample: Thinned %s: kept %d points, deleted %d.", from.Format("2006-01-02"), run.Kept, run.Deleted)
+		}
+	}
+}
+
+// stream is the points from one device: a driver's phone or a vehicle's
+// tracker, as attributed at the time.
+type stream struct {
+	Source    string
+	VehicleID uint
+	DriverID  uint
+}
+
+// thinDay thins each stream's points between from and to.
+func thinDay(from, to time.Time) (models.LocationDownsampleRun, error) {
+	run := models.LocationDownsampleRun{From: from, Through: to}
+	var streams []stream
+	err := config.DB.Model(&models.LocationHistory{}).
+		Distinct("source", "vehicle_id", "driver_id").
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Scan(&streams).Error
+	if err != nil {
+		return run, err
+	}
+
+	// Trip summaries stay as they are, but the points they start and end at
+	// are kept so the summaries can still be traced on the thinned history.
+	var summaries []models.TripSummary
+	err = config.DB.Select("vehicle_id", "source", "started_at", "ended_at").
+		Where("(started_at >= ? AND started_at < ?) OR (ended_at >= ? AND ended_at < ?)", from, to, from, to).
+		Find(&summaries).Error
+	if err != nil {
+		return run, err
+	}
+	pinned := make(map[stream]map[int64]bool)
+	for _, s := range summaries {
+		key := stream{Source: s.Source, VehicleID: s.VehicleID}
+		if pinned[key] == nil {
+			pinned[key] = make(map[int64]bool)
+		}
+		pinned[key][s.StartedAt.UnixMicro()] = true
+		pinned[key][s.EndedAt.UnixMicro()] = true
+	}
+
+	for _, s := range streams {
+		kept, deleted, err := thinStream(s, from, to, pinned[stream{Source: s.Source, VehicleID: s.VehicleID}])
+		if err != nil {
+			return run, err
+		}
+		run.Streams++
+		run.Kept += kept
+		run.Deleted += deleted
+	}
+	return run, nil
+}
+
+// thinStream deletes the stream's points between from and to that Thin
+// drops, always keeping those at pinned times. The distance from the last
+// point of each deleted run is added to the next point kept, so distance
+// totals don't change.
+func thinStream(s stream, from, to time.Time, pinned map[int64]bool) (int64, int64, error) {
+	var points []models.LocationHistory
+	err := config.DB.Select("id", "timestamp", "latitude", "longitude", "event_type", "is_moving", "trip_id", "distance_from_last").
+		Where("source = ? AND vehicle_id = ? AND driver_id = ? AND timestamp >= ? AND timestamp < ?", s.Source, s.VehicleID, s.DriverID, from, to).
+		Order("timestamp, id").
+		Find(&points).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	keep := Thin(points, Resolution, Tolerance)
+
+	var deleted []uint
+	var ids, distances []string
+	carry := 0.0
+	for i, p := range points {
+		if !keep[i] && !pinned[p.Timestamp.UnixMicro()] {
+			deleted = append(deleted, p.ID)
+			carry += p.DistanceFromLast
+			continue
+		}
+		if carry != 0 {
+			ids = append(ids, strconv.FormatUint(uint64(p.ID), 10))
+			distances = append(distances, strconv.FormatFloat(p.DistanceFromLast+carry, 'f', -1, 64))
+			carry = 0
+		}
+	}
+	if len(deleted) == 0 {
+		return int64(len(points)), 0, nil
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			err := tx.Exec(`UPDATE location_histories SET distance_from_last = v.distance
+				FROM unnest(CAST(? AS bigint[]), CAST(? AS float8[])) AS v(id, distance)
+				WHERE location_histories.id = v.id`,
+				"{"+strings.Join(ids, ",")+"}", "{"+strings.Join(distances, ",")+"}").Error
+			if err != nil {
+				return err
+			}
+		}
+		// Hard delete: soft-deleted rows would keep taking up the space.
+		for start := 0; start < len(deleted); start += deleteBatchSize {
+			end := min(start+deleteBatchSize, len(deleted))
+			if err := tx.Unscoped().Where("id IN ?", deleted[start:end]).Delete(&models.LocationHistory{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(len(points) - len(deleted)), int64(len(deleted)), nil
+}
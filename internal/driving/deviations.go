@@ -0,0 +1,192 @@
+package driving
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// OffRouteDistance is how far (meters) from its route line a vehicle may
+	// be before it counts as off route.
+	OffRouteDistance = config.EnvFloat("OFF_ROUTE_METERS", 150)
+	// OffRouteDuration is how long a vehicle must stay off route before a
+	// deviation is recorded, so a GPS glitch or a short detour is not.
+	OffRouteDuration = config.EnvDuration("OFF_ROUTE_DURATION", 2*time.Minute)
+	// DeviationGap ends an open deviation when no fix has arrived for this long.
+	DeviationGap = config.EnvDuration("OFF_ROUTE_GAP", 5*time.Minute)
+)
+
+// DeviationAlert reports a route deviation that started or ended. State is
+// ViolationStarted or ViolationEnded.
+type DeviationAlert struct {
+	State     string                `json:"state"`
+	Deviation models.RouteDeviation `json:"deviation"`
+}
+
+// trackedDeviation is a vehicle off its route: pending until it has been off
+// for OffRouteDuration, then recorded (d.ID set).
+type trackedDeviation struct {
+	d        models.RouteDeviation
+	received time.Time // Wall-clock time of the latest fix
+	saved    time.Time // When progress was last written
+}
+
+var (
+	deviationMu sync.Mutex
+	deviating   = map[string]*trackedDeviation{}
+)
+
+// TrackDeviation feeds a fix and its distance from the route (see
+// LocationHistory.RouteOffsetM) into the off-route tracker and returns alerts
+// for deviations it started or ended. Fixes without a distance are ignored.
+func TrackDeviation(db *gorm.DB, fix models.LocationHistory, saccoID, routeID uint) ([]DeviationAlert, error) {
+	if routeID == 0 || fix.RouteOffsetM == nil {
+		return nil, nil
+	}
+	offset := *fix.RouteOffsetM
+	deviationMu.Lock()
+	defer deviationMu.Unlock()
+
+	now := time.Now()
+	key := violationKey(fix)
+	var alerts []DeviationAlert
+	t := deviating[key]
+	if t != nil && !fix.Timestamp.After(t.d.LastSeenAt) {
+		return nil, nil // Older than what the episode already covers
+	}
+	if t != nil && (fix.Timestamp.Sub(t.d.LastSeenAt) > DeviationGap || t.d.RouteID != routeID) {
+		alert, err := endDeviation(db, key, t, t.d.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		if alert != nil {
+			alerts = append(alerts, *alert)
+		}
+		t = nil
+	}
+
+	if offset <= OffRouteDistance {
+		if t == nil {
+			return alerts, nil
+		}
+		alert, err := endDeviation(db, key, t, fix.Timestamp)
+		if err != nil {
+			return alerts, err
+		}
+		if alert != nil {
+			alerts = append(alerts, *alert)
+		}
+		return alerts, nil
+	}
+
+	if t == nil {
+		deviating[key] = &trackedDeviation{d: models.RouteDeviation{
+			SaccoID:      saccoID,
+			VehicleID:    fix.VehicleID,
+			DriverID:     fix.DriverID,
+			RouteID:      routeID,
+			TripID:       fix.TripID,
+			Source:       fix.Source,
+			MaxDistanceM: offset,
+			Latitude:     fix.Latitude,
+			Longitude:    fix.Longitude,
+			StartedAt:    fix.Timestamp,
+			LastSeenAt:   fix.Timestamp,
+		}, received: now}
+		return alerts, nil
+	}
+
+	t.received = now
+	t.d.LastSeenAt = fix.Timestamp
+	farther := offset > t.d.MaxDistanceM
+	if farther {
+		t.d.MaxDistanceM = offset
+	}
+	if t.d.ID == 0 {
+		if fix.Timestamp.Sub(t.d.StartedAt) < OffRouteDuration {
+			return alerts, nil
+		}
+		if err := db.Create(&t.d).Error; err != nil {
+			return alerts, err
+		}
+		t.saved = now
+		return append(alerts, DeviationAlert{State: ViolationStarted, Deviation: t.d}), nil
+	}
+	if farther || now.Sub(t.saved) >= violationSaveEvery {
+		if err := db.Model(&models.RouteDeviation{}).Where("id = ?", t.d.ID).
+			Updates(map[string]interface{}{"max_distance_m": t.d.MaxDistanceM, "last_seen_at": t.d.LastSeenAt}).Error; err != nil {
+			return alerts, err
+		}
+		t.saved = now
+	}
+	return alerts, nil
+}
+
+// endDeviation stops tracking a deviation at at. Pending ones are dropped
+// without an alert. Callers hold deviationMu.
+func endDeviation(db *gorm.DB, key string, t *trackedDeviation, at time.Time) (*DeviationAlert, error) {
+	delete(deviating, key)
+	if t.d.ID == 0 {
+		return nil, nil
+	}
+	t.d.EndedAt = &at
+	err := db.Model(&models.RouteDeviation{}).Where("id = ?", t.d.ID).
+		Updates(map[string]interface{}{"max_distance_m": t.d.MaxDistanceM, "last_seen_at": t.d.LastSeenAt, "ended_at": at}).Error
+	return &DeviationAlert{State: ViolationEnded, Deviation: t.d}, err
+}
+
+// CloseStaleDeviations ends deviations whose vehicle stopped reporting
+// DeviationGap ago, including ones left open by a restart, and returns alerts
+// for those tracked in this process.
+func CloseStaleDeviations(db *gorm.DB, now time.Time) ([]DeviationAlert, error) {
+	deviationMu.Lock()
+	var alerts []DeviationAlert
+	for key, t := range deviating {
+		if now.Sub(t.received) <= DeviationGap {
+			continue
+		}
+		alert, err := endDeviation(db, key, t, t.d.LastSeenAt)
+		if err != nil {
+			deviationMu.Unlock()
+			return alerts, err
+		}
+		if alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+	var tracked []uint
+	for _, t := range deviating {
+		if t.d.ID != 0 {
+			tracked = append(tracked, t.d.ID)
+		}
+	}
+	deviationMu.Unlock()
+
+	orphans := db.Model(&models.RouteDeviation{}).Where("ended_at IS NULL AND updated_at < ?", now.Add(-DeviationGap))
+	if len(tracked) > 0 {
+		orphans = orphans.Where("id NOT IN ?", tracked)
+	}
+	return alerts, orphans.Update("ended_at", gorm.Expr("last_seen_at")).Error
+}
+
+// StartDeviationSweep periodically runs CloseStaleDeviations and hands the
+// resulting alerts to publish.
+func StartDeviationSweep(interval time.Duration, publish func(DeviationAlert)) {
+	background.Every(interval, func(context.Context) {
+		alerts, err := CloseStaleDeviations(config.DB, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("driving: Failed to close stale route deviations.")
+		}
+		for _, a := range alerts {
+			publish(a)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package driving
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// location is the zone weeks are aligned to.
+var location = func() *time.Location {
+	loc, err := time.LoadLocation(config.EnvString("COACHING_TIMEZONE", "Africa/Nairobi"))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}()
+
+// WeekStart returns Monday 00:00 of the week containing t.
+func WeekStart(t time.Time) time.Time {
+	t = t.In(location)
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, location)
+}
+
+// ComputeDigest computes the driver's digest for the week that starts at
+// weekStart without saving it.
+func ComputeDigest(db *gorm.DB, driver models.Driver, weekStart time.Time) (models.CoachingDigest, error) {
+	var events []models.DrivingEvent
+	if err := db.Where("driver_id = ? AND occurred_at >= ? AND occurred_at < ?", driver.ID, weekStart, weekStart.AddDate(0, 0, 7)).
+		Find(&events).Error; err != nil {
+		return models.CoachingDigest{}, err
+	}
+
+	// Events are counted per source and the larger count kept, as in Scores,
+	// so a driver whose phone and tracker both report is not counted twice.
+	digest := models.CoachingDigest{DriverID: driver.ID, SaccoID: driver.SaccoID, WeekStart: weekStart}
+	counts := map[[2]string]int{}
+	for _, e := range events {
+		counts[[2]string{e.Source, e.Kind}]++
+		if e.Speed > digest.MaxSpeed {
+			digest.MaxSpeed = e.Speed
+		}
+	}
+	for key, n := range counts {
+		switch key[1] {
+		case models.DrivingEventSpeeding:
+			digest.SpeedingCount = max(digest.SpeedingCount, n)
+		case models.DrivingEventHarshBraking:
+			digest.HarshBrakingCount = max(digest.HarshBrakingCount, n)
+		case models.DrivingEventHarshAcceleration:
+			digest.HarshAccelerationCount = max(digest.HarshAccelerationCount, n)
+		}
+	}
+	digest.Summary = summarize(digest)
+	return digest, nil
+}
+
+// BuildDigest computes (or refreshes) and saves the driver's digest for the
+// week that starts at weekStart. Acknowledgment is preserved across refreshes.
+func BuildDigest(db *gorm.DB, driver models.Driver, weekStart time.Time) (models.CoachingDigest, error) {
+	digest, err := ComputeDigest(db, driver, weekStart)
+	if err != nil {
+		return digest, err
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "driver_id"}, {Name: "week_start"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"speeding_count", "harsh_braking_count", "harsh_acceleration_count", "max_speed", "summary", "updated_at",
+		}),
+	}).Create(&digest).Error
+	if err != nil {
+		return digest, err
+	}
+	err = db.Where("driver_id = ? AND week_start = ?", driver.ID, weekStart).First(&digest).Error
+	return digest, err
+}
+
+func summarize(d models.CoachingDigest) string {
+	total := d.SpeedingCount + d.HarshBrakingCount + d.HarshAccelerationCount
+	if total == 0 {
+		return "No speeding or harsh driving recorded this week. Keep it up!"
+	}
+	var parts []string
+	if d.SpeedingCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d speeding episode(s), top speed %.0f km/h", d.SpeedingCount, d.MaxSpeed*3.6))
+	}
+	if d.HarshBrakingCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d harsh braking event(s)", d.HarshBrakingCount))
+	}
+	if d.HarshAccelerationCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d harsh acceleration event(s)", d.HarshAccelerationCount))
+	}
+	tip := "Leave more following distance and brake early to keep passengers comfortable."
+	if d.SpeedingCount >= d.HarshBrakingCount+d.HarshAccelerationCount {
+		tip = fmt.Sprintf("Stay under %.0f km/h; most incidents this week were speeding.", SpeedLimit*3.6)
+	}
+	return "This week: " + strings.Join(parts, "; ") + ". " + tip
+}
+
+// StartWeeklyDigests builds last week's digest for every driver with events
+// once the week has closed, checking every interval.
+func StartWeeklyDigests(interval time.Duration) {
+	background.Every(interval, func(context.Context) { generatePreviousWeek() })
+}
+
+func generatePreviousWeek() {
+	weekStart := WeekStart(time.Now()).AddDate(0, 0, -7)
+	var drivers []models.Driver
+	err := config.DB.Where("id IN (?) AND id NOT IN (?)",
+		config.DB.Model(&models.DrivingEvent{}).Select("driver_id").
+			Where("occurred_at >= ? AND occurred_at < ?", weekStart, weekStart.AddDate(0, 0, 7)),
+		config.DB.Model(&models.CoachingDigest{}).Select("driver_id").Where("week_start = ?", weekStart),
+	).Find(&drivers).Error
+	if err != nil {
+		logrus.WithError(err).Error("driving: Failed to find drivers needing a weekly digest.")
+		return
+	}
+	for _, d := range drivers {
+		if _, err := BuildDigest(config.DB, d, weekStart); err != nil {
+			logrus.WithError(err).WithField("driver_id", d.ID).Error("driving: Failed to build weekly digest.")
+		}
+	}
+	if len(drivers) > 0 {
+		logrus.Infof("driving: Built %d weekly coaching digests for week of %s.", len(drivers), weekStart.Format("2006-01-02"))
+	}
+}
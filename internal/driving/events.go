@@ -0,0 +1,65 @@
+// Package driving detects speeding and harsh-driving events from location
+// updates, summarises them into weekly coaching digests and turns them into
+// per-driver safety scores.
+package driving
+
+import (
+	"time"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// SpeedLimit is the general speed limit in m/s (SPEED_LIMIT_KMH, default
+	// 80 km/h). Saccos and routes may set their own; see LimitFor.
+	SpeedLimit = config.EnvFloat("SPEED_LIMIT_KMH", 80) / 3.6
+	// HarshBraking is the deceleration, in m/s², treated as harsh.
+	HarshBraking = config.EnvFloat("HARSH_BRAKING_MPS2", 3.5)
+	// HarshAcceleration is the acceleration, in m/s², treated as harsh.
+	HarshAcceleration = config.EnvFloat("HARSH_ACCELERATION_MPS2", 3.0)
+	// maxSampleGap ignores acceleration across gaps too long to be meaningful.
+	maxSampleGap = 10 * time.Second
+)
+
+// Detect returns the events implied by moving from prev to curr, with
+// speeding judged against limit (m/s). prev may be zero when curr is the
+// driver's first fix.
+func Detect(prev, curr models.LocationHistory, limit float64) []models.DrivingEvent {
+	var events []models.DrivingEvent
+	newEvent := func(kind string, value, threshold float64) models.DrivingEvent {
+		return models.DrivingEvent{
+			DriverID:   curr.DriverID,
+			VehicleID:  curr.VehicleID,
+			Source:     curr.Source,
+			Kind:       kind,
+			Latitude:   curr.Latitude,
+			Longitude:  curr.Longitude,
+			Speed:      curr.Speed,
+			Value:      value,
+			Threshold:  threshold,
+			OccurredAt: curr.Timestamp,
+		}
+	}
+
+	// Only flag the start of a speeding episode, not every fix within it.
+	if curr.Speed > limit && (prev.ID == 0 || prev.Speed <= limit) {
+		events = append(events, newEvent(models.DrivingEventSpeeding, curr.Speed, limit))
+	}
+
+	if prev.ID == 0 {
+		return events
+	}
+	dt := curr.Timestamp.Sub(prev.Timestamp)
+	if dt <= 0 || dt > maxSampleGap {
+		return events
+	}
+	accel := (curr.Speed - prev.Speed) / dt.Seconds()
+	switch {
+	case accel <= -HarshBraking:
+		events = append(events, newEvent(models.DrivingEventHarshBraking, -accel, HarshBraking))
+	case accel >= HarshAcceleration:
+		events = append(events, newEvent(models.DrivingEventHarshAcceleration, accel, HarshAcceleration))
+	}
+	return events
+}
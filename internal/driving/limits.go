@@ -0,0 +1,72 @@
+package driving
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+)
+
+// limitCacheTTL bounds how long a looked-up speed limit is reused, since it
+// is needed for every location update.
+const limitCacheTTL = time.Minute
+
+type cachedLimit struct {
+	kmh     *float64
+	fetched time.Time
+}
+
+var (
+	limitMu     sync.Mutex
+	routeLimits = map[uint]cachedLimit{}
+	saccoLimits = map[uint]cachedLimit{}
+)
+
+// LimitFor returns the speed limit in m/s that applies on the route: the
+// route's own limit, else the sacco's, else SpeedLimit.
+func LimitFor(db *gorm.DB, saccoID, routeID uint) float64 {
+	if routeID != 0 {
+		if kmh := cachedKmh(db, routeLimits, &models.Route{}, routeID); kmh != nil {
+			return *kmh / 3.6
+		}
+	}
+	if saccoID != 0 {
+		if kmh := cachedKmh(db, saccoLimits, &models.Sacco{}, saccoID); kmh != nil {
+			return *kmh / 3.6
+		}
+	}
+	return SpeedLimit
+}
+
+// cachedKmh loads the speed_limit_kmh of the row with id from model's table.
+// Lookup failures fall back to the next limit rather than blocking tracking.
+func cachedKmh(db *gorm.DB, cache map[uint]cachedLimit, model interface{}, id uint) *float64 {
+	limitMu.Lock()
+	c, ok := cache[id]
+	limitMu.Unlock()
+	if ok && time.Since(c.fetched) < limitCacheTTL {
+		return c.kmh
+	}
+	var kmh []*float64
+	if err := db.Model(model).Where("id = ?", id).Limit(1).Pluck("speed_limit_kmh", &kmh).Error; err != nil {
+		return nil
+	}
+	c = cachedLimit{fetched: time.Now()}
+	if len(kmh) > 0 {
+		c.kmh = kmh[0]
+	}
+	limitMu.Lock()
+	cache[id] = c
+	limitMu.Unlock()
+	return c.kmh
+}
+
+// ForgetLimits drops cached limits after they were changed.
+func ForgetLimits() {
+	limitMu.Lock()
+	routeLimits = map[uint]cachedLimit{}
+	saccoLimits = map[uint]cachedLimit{}
+	limitMu.Unlock()
+}
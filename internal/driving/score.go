@@ -0,0 +1,153 @@
+package driving
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// Penalty points per event, applied per 100 km driven.
+	speedingWeight          = config.EnvFloat("SAFETY_WEIGHT_SPEEDING", 3)
+	harshBrakingWeight      = config.EnvFloat("SAFETY_WEIGHT_HARSH_BRAKING", 2)
+	harshAccelerationWeight = config.EnvFloat("SAFETY_WEIGHT_HARSH_ACCELERATION", 1.5)
+	// MinScoredKm is the distance below which a score would be too noisy to show.
+	MinScoredKm = config.EnvFloat("SAFETY_MIN_SCORED_KM", 20)
+)
+
+// Safety ratings derived from the score.
+const (
+	RatingExcellent    = "excellent"
+	RatingGood         = "good"
+	RatingFair         = "fair"
+	RatingPoor         = "poor"
+	RatingInsufficient = "insufficient_data"
+)
+
+// SafetyScore is a driver's safety score over a period. Score starts at 100
+// and loses the weighted events per 100 km driven, so drivers who cover more
+// distance are not penalised for it. Score is nil below MinScoredKm.
+type SafetyScore struct {
+	DriverID          uint     `json:"driver_id"`
+	Name              string   `json:"name"`
+	DistanceKm        float64  `json:"distance_km"`
+	Speeding          int      `json:"speeding"`
+	HarshBraking      int      `json:"harsh_braking"`
+	HarshAcceleration int      `json:"harsh_acceleration"`
+	EventsPer100Km    float64  `json:"events_per_100km"`
+	Score             *float64 `json:"score"`
+	Rating            string   `json:"rating"`
+}
+
+// rate fills in the derived fields from the counts and distance.
+func (s *SafetyScore) rate() {
+	s.Rating = RatingInsufficient
+	if s.DistanceKm < MinScoredKm || s.DistanceKm <= 0 {
+		return
+	}
+	s.EventsPer100Km = float64(s.Speeding+s.HarshBraking+s.HarshAcceleration) / s.DistanceKm * 100
+	penalty := (speedingWeight*float64(s.Speeding) + harshBrakingWeight*float64(s.HarshBraking) +
+		harshAccelerationWeight*float64(s.HarshAcceleration)) / s.DistanceKm * 100
+	score := 100 - penalty
+	if score < 0 {
+		score = 0
+	}
+	s.Score = &score
+	switch {
+	case score >= 90:
+		s.Rating = RatingExcellent
+	case score >= 75:
+		s.Rating = RatingGood
+	case score >= 50:
+		s.Rating = RatingFair
+	default:
+		s.Rating = RatingPoor
+	}
+}
+
+// Scores computes the safety score of each driver between from and to, best
+// first with unscored drivers last.
+func Scores(db *gorm.DB, drivers []models.Driver, from, to time.Time) ([]SafetyScore, error) {
+	out := make([]SafetyScore, 0, len(drivers))
+	if len(drivers) == 0 {
+		return out, nil
+	}
+	ids := make([]uint, 0, len(drivers))
+	byID := make(map[uint]*SafetyScore, len(drivers))
+	for _, d := range drivers {
+		ids = append(ids, d.ID)
+		out = append(out, SafetyScore{DriverID: d.ID, Name: d.Name})
+	}
+	for i := range out {
+		byID[out[i].DriverID] = &out[i]
+	}
+
+	// The phone and the tracker each report the driver's harsh braking, so
+	// like distance below, each kind is counted from whichever source saw more.
+	var counts []struct {
+		DriverID uint
+		Kind     string
+		N        int
+	}
+	if err := db.Raw(`
+		SELECT driver_id, kind, MAX(n) AS n
+		FROM (
+			SELECT driver_id, kind, source, COUNT(*) AS n
+			FROM driving_events
+			WHERE driver_id IN ? AND occurred_at >= ? AND occurred_at < ? AND deleted_at IS NULL
+			GROUP BY driver_id, kind, source
+		) per_source
+		GROUP BY driver_id, kind`, ids, from, to).Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		s := byID[c.DriverID]
+		switch c.Kind {
+		case models.DrivingEventSpeeding:
+			s.Speeding = c.N
+		case models.DrivingEventHarshBraking:
+			s.HarshBraking = c.N
+		case models.DrivingEventHarshAcceleration:
+			s.HarshAcceleration = c.N
+		}
+	}
+
+	// A driver's phone and their vehicle's tracker may both report the same
+	// kilometres, so the larger of the two sources is taken rather than the sum.
+	var distances []struct {
+		DriverID uint
+		Meters   float64
+	}
+	if err := db.Raw(`
+		SELECT driver_id, MAX(meters) AS meters
+		FROM (
+			SELECT driver_id, source, SUM(distance_from_last) AS meters
+			FROM location_histories
+			WHERE driver_id IN ? AND timestamp >= ? AND timestamp < ? AND deleted_at IS NULL
+			GROUP BY driver_id, source
+		) per_source
+		GROUP BY driver_id`, ids, from, to).Scan(&distances).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range distances {
+		byID[d.DriverID].DistanceKm = d.Meters / 1000
+	}
+
+	for i := range out {
+		out[i].rate()
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Score, out[j].Score
+		switch {
+		case a == nil || b == nil:
+			return a != nil && b == nil
+		default:
+			return *a > *b
+		}
+	})
+	return out, nil
+}
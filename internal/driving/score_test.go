@@ -0,0 +1,42 @@
+package driving
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// A driver whose phone and tracker both report a trip is scored on one of
+// them, not on the two added together.
+func TestScoresCountEachSourceOnce(t *testing.T) {
+	db := testdb.Open(t, &models.DrivingEvent{}, &models.LocationHistory{}, &models.CoachingDigest{})
+	now := time.Now()
+	driver := models.Driver{Model: gorm.Model{ID: 1}, Name: "Wanjiru"}
+	for _, source := range []string{models.LocationSourceDriver, models.LocationSourceTracker} {
+		for i := 0; i < 2; i++ {
+			db.Create(&models.DrivingEvent{DriverID: 1, VehicleID: 1, Source: source, Kind: models.DrivingEventHarshBraking, OccurredAt: now})
+		}
+		db.Create(&models.LocationHistory{DriverID: 1, VehicleID: 1, Source: source, DistanceFromLast: 50000, Timestamp: now})
+	}
+	db.Create(&models.DrivingEvent{DriverID: 1, VehicleID: 1, Source: models.LocationSourceTracker, Kind: models.DrivingEventHarshBraking, OccurredAt: now})
+
+	scores, err := Scores(db, []models.Driver{driver}, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := scores[0]; s.HarshBraking != 3 || s.DistanceKm != 50 {
+		t.Errorf("score %+v; want 3 harsh brakings over 50 km", s)
+	}
+
+	digest, err := ComputeDigest(db, driver, WeekStart(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest.HarshBrakingCount != 3 {
+		t.Errorf("digest counts %d harsh brakings; want 3", digest.HarshBrakingCount)
+	}
+}
@@ -0,0 +1,99 @@
+package driving
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// DetectStored derives driving events from tracker points that were saved or
+// attributed to a driver between since and until. Driver app updates are
+// checked live as they arrive; tracker uploads may be buffered and are only
+// credited to a driver once attributed, so they are analysed here instead.
+// Events already recorded for the same driver, kind, time and source are
+// skipped, so overlapping windows are harmless. It returns the number of new events.
+func DetectStored(db *gorm.DB, since, until time.Time) (int, error) {
+	changed := db.Model(&models.LocationHistory{}).
+		Where("source = ? AND driver_id <> 0 AND updated_at >= ? AND updated_at < ?", models.LocationSourceTracker, since, until)
+	var vehicleIDs []uint
+	if err := changed.Session(&gorm.Session{}).Distinct().Pluck("vehicle_id", &vehicleIDs).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, vehicleID := range vehicleIDs {
+		var fresh []models.LocationHistory
+		if err := changed.Session(&gorm.Session{}).Where("vehicle_id = ?", vehicleID).Order("timestamp").Find(&fresh).Error; err != nil {
+			return created, err
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		isFresh := make(map[uint]bool, len(fresh))
+		for _, p := range fresh {
+			isFresh[p.ID] = true
+		}
+		// Include the fix before the first fresh one so it can be paired.
+		var stream []models.LocationHistory
+		if err := db.Where("vehicle_id = ? AND source = ? AND timestamp >= ? AND timestamp <= ?",
+			vehicleID, models.LocationSourceTracker, fresh[0].Timestamp.Add(-maxSampleGap), fresh[len(fresh)-1].Timestamp).
+			Order("timestamp").Find(&stream).Error; err != nil {
+			return created, err
+		}
+		var vehicle models.Vehicle
+		if err := db.Unscoped().Select("id", "sacco_id", "route_id").First(&vehicle, vehicleID).Error; err != nil {
+			return created, err
+		}
+		limit := LimitFor(db, vehicle.SaccoID, vehicle.RouteID)
+
+		var prev models.LocationHistory
+		for _, curr := range stream {
+			if isFresh[curr.ID] && curr.DriverID != 0 {
+				if prev.DriverID != curr.DriverID {
+					prev = models.LocationHistory{} // Never pair fixes from different drivers
+				}
+				for _, e := range Detect(prev, curr, limit) {
+					var exists int64
+					if err := db.Model(&models.DrivingEvent{}).Where("driver_id = ? AND kind = ? AND occurred_at = ? AND source = ?", e.DriverID, e.Kind, e.OccurredAt, e.Source).
+						Count(&exists).Error; err != nil {
+						return created, err
+					}
+					if exists > 0 {
+						continue
+					}
+					e.SaccoID = vehicle.SaccoID
+					if err := db.Create(&e).Error; err != nil {
+						return created, err
+					}
+					created++
+				}
+			}
+			prev = curr
+		}
+	}
+	return created, nil
+}
+
+// StartTelemetryAnalysis periodically runs DetectStored over the points
+// saved or attributed since the previous run.
+func StartTelemetryAnalysis(interval time.Duration) {
+	since := time.Now().Add(-interval)
+	background.Every(interval, func(context.Context) {
+		until := time.Now()
+		n, err := DetectStored(config.DB, since, until)
+		if err != nil {
+			logrus.WithError(err).Error("driving: Failed to analyse tracker telemetry.")
+			return
+		}
+		since = until
+		if n > 0 {
+			logrus.Infof("driving: Recorded %d driving events from tracker telemetry.", n)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package driving
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Speed violation alert states.
+const (
+	ViolationStarted = "started"
+	ViolationEnded   = "ended"
+)
+
+var (
+	// ViolationGap ends an open violation when no fix has arrived for this long.
+	ViolationGap = config.EnvDuration("SPEED_VIOLATION_GAP", 2*time.Minute)
+	// violationSaveEvery throttles writes of an open violation's progress.
+	violationSaveEvery = 15 * time.Second
+)
+
+// ViolationAlert reports a speed violation that started or ended.
+type ViolationAlert struct {
+	State     string                `json:"state"`
+	Violation models.SpeedViolation `json:"violation"`
+}
+
+// episode caches the open violation of one vehicle or driver, whose row in
+// the database is the record. mu serialises that key's fixes.
+type episode struct {
+	mu     sync.Mutex
+	v      models.SpeedViolation // ID 0 while none is open
+	loaded time.Time             // When v was last read from the database
+	saved  time.Time             // When progress was last written
+}
+
+// episodeReload is how long "no open violation" is trusted before the
+// database is checked again for one opened elsewhere.
+const episodeReload = time.Minute
+
+var (
+	violationMu sync.Mutex // Guards episodes only, never held over queries
+	episodes    = map[string]*episode{}
+)
+
+func episodeFor(key string) *episode {
+	violationMu.Lock()
+	defer violationMu.Unlock()
+	e := episodes[key]
+	if e == nil {
+		e = &episode{}
+		episodes[key] = e
+	}
+	return e
+}
+
+// violationKey follows the vehicle when it is known, so a driver's phone and
+// the vehicle's tracker feed the same episode.
+func violationKey(fix models.LocationHistory) string {
+	if fix.VehicleID != 0 {
+		return "vehicle:" + strconv.FormatUint(uint64(fix.VehicleID), 10)
+	}
+	return "driver:" + strconv.FormatUint(uint64(fix.DriverID), 10)
+}
+
+// TrackSpeed feeds a fix into the speed-violation tracker and returns alerts
+// for violations it started or ended. limit is in m/s (see LimitFor). Fixes
+// of one vehicle are handled one at a time; other vehicles are not held up.
+func TrackSpeed(db *gorm.DB, fix models.LocationHistory, saccoID, routeID uint, limit float64) ([]ViolationAlert, error) {
+	key := violationKey(fix)
+	e := episodeFor(key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.v.ID == 0 && now.Sub(e.loaded) >= episodeReload {
+		if err := e.load(db, key, now); err != nil {
+			return nil, err
+		}
+	}
+	var alerts []ViolationAlert
+	if e.v.ID != 0 && !fix.Timestamp.After(e.v.LastSeenAt) {
+		return nil, nil // Older than what the episode already covers
+	}
+	if e.v.ID != 0 && fix.Timestamp.Sub(e.v.LastSeenAt) > ViolationGap {
+		alert, err := e.close(db, e.v.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if fix.Speed <= limit {
+		if e.v.ID == 0 {
+			return alerts, nil
+		}
+		alert, err := e.close(db, fix.Timestamp)
+		if err != nil {
+			return alerts, err
+		}
+		return append(alerts, alert), nil
+	}
+
+	if e.v.ID == 0 {
+		v := models.SpeedViolation{
+			DriverID:   fix.DriverID,
+			VehicleID:  fix.VehicleID,
+			SaccoID:    saccoID,
+			RouteID:    routeID,
+			Source:     fix.Source,
+			Limit:      limit,
+			MaxSpeed:   fix.Speed,
+			Latitude:   fix.Latitude,
+			Longitude:  fix.Longitude,
+			StartedAt:  fix.Timestamp,
+			LastSeenAt: fix.Timestamp,
+			EpisodeKey: &key,
+		}
+		err := db.Create(&v).Error
+		var state interface{ SQLState() string }
+		if errors.As(err, &state) && state.SQLState() == "23505" {
+			// Another replica opened it first; extend theirs.
+			if err := e.load(db, key, now); err != nil || e.v.ID == 0 {
+				return alerts, err
+			}
+		} else if err != nil {
+			return alerts, err
+		} else {
+			e.v, e.saved = v, now
+			return append(alerts, ViolationAlert{State: ViolationStarted, Violation: v}), nil
+		}
+	}
+
+	e.v.LastSeenAt = fix.Timestamp
+	faster := fix.Speed > e.v.MaxSpeed
+	if faster {
+		e.v.MaxSpeed = fix.Speed
+	}
+	if faster || now.Sub(e.saved) >= violationSaveEvery {
+		res := db.Model(&models.SpeedViolation{}).Where("id = ? AND ended_at IS NULL", e.v.ID).
+			Updates(map[string]interface{}{"max_speed": e.v.MaxSpeed, "last_seen_at": e.v.LastSeenAt})
+		if res.Error != nil {
+			return alerts, res.Error
+		}
+		if res.RowsAffected == 0 {
+			e.v = models.SpeedViolation{} // Closed by a sweep; the next fix over the limit opens another
+		}
+		e.saved = now
+	}
+	return alerts, nil
+}
+
+// load reads the key's open violation, if any. Callers hold e.mu.
+func (e *episode) load(db *gorm.DB, key string, now time.Time) error {
+	var v models.SpeedViolation
+	if err := db.Where("episode_key = ?", key).Limit(1).Find(&v).Error; err != nil {
+		return err
+	}
+	e.v, e.loaded, e.saved = v, now, now
+	return nil
+}
+
+// close ends the open violation at at. Callers hold e.mu.
+func (e *episode) close(db *gorm.DB, at time.Time) (ViolationAlert, error) {
+	v := e.v
+	e.v = models.SpeedViolation{}
+	v.EndedAt, v.EpisodeKey = &at, nil
+	err := db.Model(&models.SpeedViolation{}).Where("id = ?", v.ID).
+		Updates(map[string]interface{}{"max_speed": v.MaxSpeed, "last_seen_at": v.LastSeenAt, "ended_at": at, "episode_key": nil}).Error
+	return ViolationAlert{State: ViolationEnded, Violation: v}, err
+}
+
+// CloseStaleViolations ends violations whose vehicle or driver stopped
+// reporting ViolationGap ago, on any replica or left open by a restart, and
+// returns alerts for the ones it ended.
+func CloseStaleViolations(db *gorm.DB, now time.Time) ([]ViolationAlert, error) {
+	var stale []models.SpeedViolation
+	if err := db.Where("ended_at IS NULL AND updated_at < ?", now.Add(-ViolationGap)).Find(&stale).Error; err != nil {
+		return nil, err
+	}
+	var alerts []ViolationAlert
+	for _, v := range stale {
+		alert, ok, err := closeStale(db, v)
+		if err != nil {
+			return alerts, err
+		}
+		if ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// closeStale ends v at its last fix over the limit, unless a fix has
+// arrived for it since it was read.
+func closeStale(db *gorm.DB, v models.SpeedViolation) (ViolationAlert, bool, error) {
+	if v.EpisodeKey != nil {
+		e := episodeFor(*v.EpisodeKey)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.v.ID == v.ID {
+			v.MaxSpeed, v.LastSeenAt = e.v.MaxSpeed, e.v.LastSeenAt
+			e.v = models.SpeedViolation{}
+		}
+	}
+	at := v.LastSeenAt
+	res := db.Model(&models.SpeedViolation{}).Where("id = ? AND ended_at IS NULL AND updated_at = ?", v.ID, v.UpdatedAt).
+		Updates(map[string]interface{}{"max_speed": v.MaxSpeed, "last_seen_at": at, "ended_at": at, "episode_key": nil})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return ViolationAlert{}, false, res.Error
+	}
+	v.EndedAt, v.EpisodeKey = &at, nil
+	return ViolationAlert{State: ViolationEnded, Violation: v}, true, nil
+}
+
+// StartViolationSweep periodically runs CloseStaleViolations and hands the
+// resulting alerts to publish.
+func StartViolationSweep(interval time.Duration, publish func(ViolationAlert)) {
+	background.Every(interval, func(context.Context) {
+		alerts, err := CloseStaleViolations(config.DB, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("driving: Failed to close stale speed violations.")
+		}
+		for _, a := range alerts {
+			publish(a)
+		}
+	})
+}
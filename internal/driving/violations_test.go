@@ -0,0 +1,127 @@
+package driving
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+func violationsDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Open(t, &models.SpeedViolation{})
+	reset := func() {
+		violationMu.Lock()
+		episodes = map[string]*episode{}
+		violationMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+	return db
+}
+
+func fixAt(vehicleID uint, at time.Time, speed float64) models.LocationHistory {
+	return models.LocationHistory{DriverID: 7, VehicleID: vehicleID, Timestamp: at, Speed: speed}
+}
+
+func TestTrackSpeedEpisode(t *testing.T) {
+	db := violationsDB(t)
+	start := time.Now().Add(-time.Minute)
+	alerts, err := TrackSpeed(db, fixAt(1, start, 25), 1, 1, 20)
+	if err != nil || len(alerts) != 1 || alerts[0].State != ViolationStarted {
+		t.Fatalf("first fix over the limit: %+v, %v", alerts, err)
+	}
+	if alerts, err := TrackSpeed(db, fixAt(1, start.Add(5*time.Second), 30), 1, 1, 20); err != nil || len(alerts) != 0 {
+		t.Fatalf("second fix: %+v, %v", alerts, err)
+	}
+	alerts, err = TrackSpeed(db, fixAt(1, start.Add(10*time.Second), 15), 1, 1, 20)
+	if err != nil || len(alerts) != 1 || alerts[0].State != ViolationEnded || alerts[0].Violation.MaxSpeed != 30 {
+		t.Fatalf("fix under the limit: %+v, %v", alerts, err)
+	}
+	var v models.SpeedViolation
+	db.First(&v)
+	if v.EndedAt == nil || v.EpisodeKey != nil || v.MaxSpeed != 30 {
+		t.Errorf("saved violation %+v; want ended at 30 m/s", v)
+	}
+}
+
+// An episode lives in the database, so a restart (or another replica)
+// carries on with it rather than opening another.
+func TestTrackSpeedResumesFromDatabase(t *testing.T) {
+	db := violationsDB(t)
+	start := time.Now().Add(-time.Minute)
+	if _, err := TrackSpeed(db, fixAt(1, start, 25), 1, 1, 20); err != nil {
+		t.Fatal(err)
+	}
+	violationMu.Lock()
+	episodes = map[string]*episode{}
+	violationMu.Unlock()
+
+	alerts, err := TrackSpeed(db, fixAt(1, start.Add(5*time.Second), 26), 1, 1, 20)
+	if err != nil || len(alerts) != 0 {
+		t.Fatalf("after restart: %+v, %v; want the episode extended", alerts, err)
+	}
+	var n int64
+	db.Model(&models.SpeedViolation{}).Count(&n)
+	if n != 1 {
+		t.Errorf("%d violations; want 1", n)
+	}
+
+	key := "vehicle:1"
+	dup := models.SpeedViolation{VehicleID: 1, EpisodeKey: &key}
+	if err := db.Create(&dup).Error; err == nil {
+		t.Error("opened a second episode for the same vehicle")
+	}
+}
+
+func TestTrackSpeedOtherVehiclesNotHeld(t *testing.T) {
+	db := violationsDB(t)
+	e := episodeFor("vehicle:1")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := TrackSpeed(db, fixAt(2, time.Now(), 25), 1, 1, 20)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a fix for vehicle 2 waited on vehicle 1")
+	}
+}
+
+func TestCloseStaleViolations(t *testing.T) {
+	db := violationsDB(t)
+	start := time.Now().Add(-10 * time.Minute)
+	if _, err := TrackSpeed(db, fixAt(1, start, 25), 1, 1, 20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TrackSpeed(db, fixAt(2, time.Now(), 25), 1, 1, 20); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.SpeedViolation{}).Where("vehicle_id = ?", 1).UpdateColumn("updated_at", start)
+
+	alerts, err := CloseStaleViolations(db, time.Now())
+	if err != nil || len(alerts) != 1 || alerts[0].Violation.VehicleID != 1 {
+		t.Fatalf("got %+v, %v; want vehicle 1's violation ended", alerts, err)
+	}
+	var open int64
+	db.Model(&models.SpeedViolation{}).Where("ended_at IS NULL").Count(&open)
+	if open != 1 {
+		t.Errorf("%d violations open; want vehicle 2's", open)
+	}
+
+	// A fresh fix for vehicle 1 opens a new episode.
+	alerts, err = TrackSpeed(db, fixAt(1, time.Now(), 25), 1, 1, 20)
+	if err != nil || len(alerts) != 1 || alerts[0].State != ViolationStarted {
+		t.Errorf("fix after the sweep: %+v, %v", alerts, err)
+	}
+}
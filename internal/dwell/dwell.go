@@ -0,0 +1,116 @@
+// Package dwell summarizes how long vehicles stand at stages, from the
+// dwell time recorded on each geofence departure (see models.StageEvent).
+package dwell
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// MaxDwell leaves out longer stays, such as vehicles parked overnight at a
+	// terminus, which would swamp the averages.
+	MaxDwell = config.EnvDuration("DWELL_MAX", 3*time.Hour)
+	// Lookback is how much history the typical wait shown to commuters uses.
+	Lookback = config.EnvDuration("DWELL_LOOKBACK", 28*24*time.Hour)
+	// MinSamples is the fewest departures a typical wait is based on.
+	MinSamples = config.EnvInt("DWELL_MIN_SAMPLES", 5)
+)
+
+// Stats aggregates the dwell times of one stage, over the whole day or, when
+// Hour is set, departures from the hour starting then.
+type Stats struct {
+	StageID    uint    `json:"stage_id"`
+	Hour       *int    `json:"hour,omitempty"`
+	Departures int64   `json:"departures"`
+	AvgS       float64 `json:"avg_s"`
+	P50S       float64 `json:"p50_s"`
+	P90S       float64 `json:"p90_s"`
+	MaxS       float64 `json:"max_s"`
+}
+
+// Typical is the wait a commuter boarding at a stage can expect.
+type Typical struct {
+	TypicalS   float64 `json:"typical_s"` // Median dwell
+	LongS      float64 `json:"long_s"`    // 90th percentile: one vehicle in ten waits longer
+	Departures int64   `json:"departures"`
+	Hourly     bool    `json:"hourly"` // Based on this hour of the day rather than the whole day
+}
+
+// departures selects the departures counted between from and to.
+func departures(db *gorm.DB, from, to time.Time) *gorm.DB {
+	return db.Model(&models.StageEvent{}).
+		Where("kind = ? AND at >= ? AND at < ? AND dwell_seconds > 0 AND dwell_seconds <= ?", models.StageDeparture, from, to, MaxDwell.Seconds())
+}
+
+// aggregates are the Stats columns computed over a group of departures.
+const aggregates = `COUNT(*) AS departures,
+	AVG(dwell_seconds) AS avg_s,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY dwell_seconds) AS p50_s,
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY dwell_seconds) AS p90_s,
+	MAX(dwell_seconds) AS max_s`
+
+// Report aggregates dwell times per stage for departures between from and
+// to that match scope, and with byHour also per hour of the day in loc.
+func Report(db, scope *gorm.DB, from, to time.Time, loc *time.Location, byHour bool) ([]Stats, error) {
+	var rows []Stats
+	if !byHour {
+		err := departures(db, from, to).Where(scope).Select("stage_id, " + aggregates).Group("stage_id").Scan(&rows).Error
+		return rows, err
+	}
+	inner := departures(db, from, to).Where(scope).
+		Select("stage_id, dwell_seconds, EXTRACT(HOUR FROM at AT TIME ZONE ?)::int AS hour", loc.String())
+	err := db.Table("(?) AS d", inner).
+		Select("stage_id, hour, " + aggregates).
+		Group("GROUPING SETS ((stage_id, hour), (stage_id))").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// ForStages returns the typical wait at each stage with enough departures
+// over the last Lookback: from departures in now's hour of the day in loc
+// when there are MinSamples of them, otherwise from the whole day.
+func ForStages(db *gorm.DB, stageIDs []uint, now time.Time, loc *time.Location) (map[uint]Typical, error) {
+	out := make(map[uint]Typical)
+	if len(stageIDs) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		StageID    uint
+		Hourly     int64
+		HourlyP50  float64
+		HourlyP90  float64
+		Departures int64
+		P50        float64
+		P90        float64
+	}
+	inner := departures(db, now.Add(-Lookback), now).
+		Where("stage_id IN ?", stageIDs).
+		Select("stage_id, dwell_seconds, EXTRACT(HOUR FROM at AT TIME ZONE ?) = ? AS this_hour", loc.String(), now.In(loc).Hour())
+	err := db.Table("(?) AS d", inner).
+		Select(`stage_id,
+			COUNT(*) FILTER (WHERE this_hour) AS hourly,
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY dwell_seconds) FILTER (WHERE this_hour), 0) AS hourly_p50,
+			COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY dwell_seconds) FILTER (WHERE this_hour), 0) AS hourly_p90,
+			COUNT(*) AS departures,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY dwell_seconds) AS p50,
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY dwell_seconds) AS p90`).
+		Group("stage_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		switch {
+		case r.Hourly >= int64(MinSamples):
+			out[r.StageID] = Typical{TypicalS: r.HourlyP50, LongS: r.HourlyP90, Departures: r.Hourly, Hourly: true}
+		case r.Departures >= int64(MinSamples):
+			out[r.StageID] = Typical{TypicalS: r.P50, LongS: r.P90, Departures: r.Departures}
+		}
+	}
+	return out, nil
+}
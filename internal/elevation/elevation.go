@@ -0,0 +1,166 @@
+// Package elevation looks up terrain heights for points along a route, either
+// from an Open-Elevation compatible HTTP API or from an SRTM raster loaded into PostGIS.
+package elevation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+)
+
+// Provider returns the elevation in meters for each point, in order, or nil
+// for points the provider has no data for.
+type Provider interface {
+	Lookup(ctx context.Context, points []geo.Point) ([]*float64, error)
+	Name() string
+}
+
+// FromEnv selects a provider using ELEVATION_PROVIDER ("http" or "postgis").
+func FromEnv(db *gorm.DB) Provider {
+	switch config.EnvString("ELEVATION_PROVIDER", "http") {
+	case "postgis":
+		return &RasterProvider{
+			DB:    db,
+			Table: config.EnvString("ELEVATION_RASTER_TABLE", "srtm"),
+		}
+	default:
+		return &HTTPProvider{
+			URL:       config.EnvString("ELEVATION_API_URL", "https://api.open-elevation.com/api/v1/lookup"),
+			BatchSize: config.EnvInt("ELEVATION_API_BATCH_SIZE", 100),
+			Client:    &http.Client{Timeout: 20 * time.Second},
+		}
+	}
+}
+
+// HTTPProvider queries an Open-Elevation compatible POST /lookup endpoint.
+type HTTPProvider struct {
+	URL       string
+	BatchSize int
+	Client    *http.Client
+}
+
+// Name identifies the provider in cached profiles.
+func (p *HTTPProvider) Name() string { return "http" }
+
+type lookupLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type lookupResponse struct {
+	Results []struct {
+		Elevation *float64 `json:"elevation"` // null where there is no data
+	} `json:"results"`
+}
+
+// Lookup batches points into requests of BatchSize.
+func (p *HTTPProvider) Lookup(ctx context.Context, points []geo.Point) ([]*float64, error) {
+	batch := p.BatchSize
+	if batch <= 0 {
+		batch = 100
+	}
+	out := make([]*float64, 0, len(points))
+	for start := 0; start < len(points); start += batch {
+		end := start + batch
+		if end > len(points) {
+			end = len(points)
+		}
+		locations := make([]lookupLocation, 0, end-start)
+		for _, pt := range points[start:end] {
+			locations = append(locations, lookupLocation{Latitude: pt.Lat, Longitude: pt.Lng})
+		}
+		body, err := json.Marshal(map[string]interface{}{"locations": locations})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("elevation request failed: %w", err)
+		}
+		var parsed lookupResponse
+		err = json.NewDecoder(resp.Body).Decode(&parsed)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("elevation provider returned %s", resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode elevation response: %w", err)
+		}
+		if len(parsed.Results) != end-start {
+			return nil, fmt.Errorf("elevation provider returned %d results for %d points", len(parsed.Results), end-start)
+		}
+		for _, r := range parsed.Results {
+			out = append(out, r.Elevation)
+		}
+	}
+	return out, nil
+}
+
+// rasterBatch is how many points RasterProvider samples per query.
+const rasterBatch = 500
+
+// RasterProvider samples an SRTM raster table (column "rast", SRID 4326) with ST_Value.
+type RasterProvider struct {
+	DB    *gorm.DB
+	Table string
+}
+
+// Name identifies the provider in cached profiles.
+func (p *RasterProvider) Name() string { return "postgis" }
+
+// Lookup samples the raster tile covering each point, rasterBatch points per
+// query. Points outside coverage, or on nodata cells, get nil.
+func (p *RasterProvider) Lookup(ctx context.Context, points []geo.Point) ([]*float64, error) {
+	out := make([]*float64, 0, len(points))
+	for start := 0; start < len(points); start += rasterBatch {
+		end := start + rasterBatch
+		if end > len(points) {
+			end = len(points)
+		}
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, 3*(end-start))
+		for i, pt := range points[start:end] {
+			values = append(values, "(?::int, ST_SetSRID(ST_MakePoint(?, ?), 4326))")
+			args = append(args, i, pt.Lng, pt.Lat)
+		}
+		query := fmt.Sprintf(`
+			SELECT (SELECT ST_Value(r.rast, pt.geom) FROM %s r WHERE ST_Intersects(r.rast, pt.geom) LIMIT 1)
+			FROM (VALUES %s) AS pt(ord, geom)
+			ORDER BY pt.ord`, p.Table, strings.Join(values, ", "))
+		rows, err := p.DB.WithContext(ctx).Raw(query, args...).Rows()
+		if err != nil {
+			return nil, fmt.Errorf("raster elevation lookup failed: %w", err)
+		}
+		for rows.Next() {
+			var elevation *float64
+			if err := rows.Scan(&elevation); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("raster elevation lookup failed: %w", err)
+			}
+			out = append(out, elevation)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("raster elevation lookup failed: %w", err)
+		}
+	}
+	if len(out) != len(points) {
+		return nil, fmt.Errorf("raster elevation lookup returned %d results for %d points", len(out), len(points))
+	}
+	return out, nil
+}
@@ -0,0 +1,48 @@
+package elevation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ma3_tracker/internal/geo"
+)
+
+func TestHTTPProviderBatchesAndKeepsNoData(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var body struct {
+			Locations []lookupLocation `json:"locations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		results := make([]string, len(body.Locations))
+		for i, loc := range body.Locations {
+			if loc.Latitude < 0 {
+				results[i] = `{"elevation":null}`
+			} else {
+				results[i] = fmt.Sprintf(`{"elevation":%g}`, loc.Latitude*100)
+			}
+		}
+		fmt.Fprintf(w, `{"results":[%s]}`, strings.Join(results, ","))
+	}))
+	defer srv.Close()
+
+	p := &HTTPProvider{URL: srv.URL, BatchSize: 2, Client: srv.Client()}
+	got, err := p.Lookup(context.Background(), []geo.Point{{Lat: 1}, {Lat: -1}, {Lat: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests; want 2 batches", requests)
+	}
+	if len(got) != 3 || got[0] == nil || *got[0] != 100 || got[1] != nil || got[2] == nil || *got[2] != 200 {
+		t.Errorf("elevations = %v; want 100, nil, 200", got)
+	}
+}
@@ -0,0 +1,245 @@
+// Package eta estimates when vehicles will reach the stages ahead of them.
+//
+// A vehicle's position is projected onto its route's geometry; the distance
+// along the line to each downstream stage is divided by the vehicle's recent
+// progress along the route (not its instantaneous GPS speed, which is zero at
+// every stop). Routes are driven in both directions, so "downstream" follows
+// whichever way the vehicle has been moving along the line.
+package eta
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// OffRoute is how far from its route line a vehicle may be and still get ETAs.
+	OffRoute = config.EnvFloat("ETA_OFF_ROUTE_METERS", 150)
+	// Window is how much recent progress the speed estimate averages over.
+	Window = config.EnvDuration("ETA_SPEED_WINDOW", 10*time.Minute)
+	// DefaultSpeed (m/s) is used until a vehicle has enough recent progress.
+	DefaultSpeed = config.EnvFloat("ETA_DEFAULT_SPEED_KMH", 20) / 3.6
+	// MinSpeed (m/s) keeps ETAs finite for vehicles waiting at a stage.
+	MinSpeed = config.EnvFloat("ETA_MIN_SPEED_KMH", 8) / 3.6
+	// minSpan is the least history a measured speed is trusted on.
+	minSpan = time.Minute
+	// routeTTL bounds how long a route's line and stages are cached.
+	routeTTL = time.Minute
+)
+
+// ErrNoGeometry is returned for routes without a line to project onto.
+var ErrNoGeometry = geo.ErrNoGeometry
+
+// ErrOffRoute is returned when a vehicle is farther than OffRoute from its route.
+var ErrOffRoute = errors.New("vehicle is off its route")
+
+// StageETA is the estimated arrival of a vehicle at one stage.
+type StageETA struct {
+	StageID   uint      `json:"stage_id"`
+	Name      string    `json:"name"`
+	Seq       int       `json:"seq"`
+	DistanceM float64   `json:"distance_m"` // Along the route
+	Seconds   float64   `json:"eta_seconds"`
+	ArrivalAt time.Time `json:"arrival_at"`
+}
+
+// Projection is a vehicle's place on its route and its upcoming stages,
+// nearest first.
+type Projection struct {
+	RouteID   uint       `json:"route_id"`
+	AlongM    float64    `json:"along_m"`     // From the start of the route line
+	OffRouteM float64    `json:"off_route_m"` // Distance from the line
+	Forward   bool       `json:"forward"`     // Moving towards the end of the line
+	SpeedMps  float64    `json:"speed"`       // Speed the estimates assume
+	Measured  bool       `json:"measured"`    // Speed comes from recent progress, not DefaultSpeed
+	Upcoming  []StageETA `json:"upcoming"`
+}
+
+type routeStage struct {
+	stage  models.Stage
+	alongM float64
+}
+
+type cachedRoute struct {
+	line   []geo.Point
+	stages []routeStage // Ordered by position along the line
+	at     time.Time
+}
+
+type sample struct {
+	routeID uint
+	alongM  float64
+	at      time.Time
+}
+
+var (
+	routesMu sync.Mutex
+	routes   = map[uint]cachedRoute{}
+
+	progressMu sync.Mutex
+	progress   = map[uint][]sample{} // Recent positions along the route per vehicle
+)
+
+// Observe records a vehicle's fix and returns its projection with ETAs to
+// the stages ahead.
+func Observe(db *gorm.DB, fix models.LocationHistory, routeID uint) (Projection, error) {
+	r, err := routeFor(db, routeID)
+	if err != nil {
+		return Projection{}, err
+	}
+	along, off := geo.LocateOnLine(geo.Point{Lat: fix.Latitude, Lng: fix.Longitude}, r.line)
+	if off > OffRoute {
+		return Projection{}, ErrOffRoute
+	}
+	speed, forward, measured := record(fix.VehicleID, sample{routeID: routeID, alongM: along, at: fix.Timestamp})
+	return project(r, routeID, along, off, speed, forward, measured, fix.Timestamp), nil
+}
+
+// Project estimates ETAs for a vehicle at p at time at without recording
+// the position, using the vehicle's recent progress when this process has
+// seen it.
+func Project(db *gorm.DB, vehicleID, routeID uint, p geo.Point, at time.Time) (Projection, error) {
+	r, err := routeFor(db, routeID)
+	if err != nil {
+		return Projection{}, err
+	}
+	along, off := geo.LocateOnLine(p, r.line)
+	if off > OffRoute {
+		return Projection{}, ErrOffRoute
+	}
+	progressMu.Lock()
+	speed, forward, measured := estimate(progress[vehicleID], routeID)
+	progressMu.Unlock()
+	return project(r, routeID, along, off, speed, forward, measured, at), nil
+}
+
+func project(r cachedRoute, routeID uint, along, off, speed float64, forward, measured bool, at time.Time) Projection {
+	p := Projection{RouteID: routeID, AlongM: along, OffRouteM: off, Forward: forward, SpeedMps: speed, Measured: measured}
+	p.Upcoming = []StageETA{}
+	add := func(rs routeStage) {
+		d := math.Abs(rs.alongM - along)
+		seconds := d / speed
+		p.Upcoming = append(p.Upcoming, StageETA{
+			StageID:   rs.stage.ID,
+			Name:      rs.stage.Name,
+			Seq:       rs.stage.Seq,
+			DistanceM: d,
+			Seconds:   seconds,
+			ArrivalAt: at.Add(time.Duration(seconds * float64(time.Second))),
+		})
+	}
+	if forward {
+		for _, rs := range r.stages {
+			if rs.alongM >= along {
+				add(rs)
+			}
+		}
+	} else {
+		for i := len(r.stages) - 1; i >= 0; i-- {
+			if r.stages[i].alongM <= along {
+				add(r.stages[i])
+			}
+		}
+	}
+	return p
+}
+
+// record adds s to the vehicle's recent progress and returns the speed and
+// direction it implies.
+func record(vehicleID uint, s sample) (float64, bool, bool) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	samples := progress[vehicleID]
+	if n := len(samples); n > 0 {
+		switch {
+		case samples[n-1].routeID != s.routeID:
+			samples = nil // Reassigned; earlier progress is on another line
+		case !s.at.After(samples[n-1].at):
+			return estimate(samples, s.routeID) // Replayed or out-of-order fix
+		}
+	}
+	samples = append(samples, s)
+	cutoff := s.at.Add(-Window)
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].at.Before(cutoff) })
+	samples = append(samples[:0], samples[i:]...)
+	progress[vehicleID] = samples
+	return estimate(samples, s.routeID)
+}
+
+// estimate derives speed along the route and direction from samples.
+// Without enough history the vehicle is assumed to move forward at
+// DefaultSpeed.
+func estimate(samples []sample, routeID uint) (speed float64, forward, measured bool) {
+	n := len(samples)
+	if n < 2 || samples[0].routeID != routeID {
+		return DefaultSpeed, true, false
+	}
+	first, last := samples[0], samples[n-1]
+	moved := last.alongM - first.alongM
+	forward = moved >= 0
+	span := last.at.Sub(first.at)
+	if span < minSpan {
+		return DefaultSpeed, forward, false
+	}
+	return math.Max(math.Abs(moved)/span.Seconds(), MinSpeed), forward, true
+}
+
+// routeFor returns a route's line and its stages located on it, cached for
+// routeTTL.
+func routeFor(db *gorm.DB, routeID uint) (cachedRoute, error) {
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	now := time.Now()
+	if cached, ok := routes[routeID]; ok && now.Sub(cached.at) < routeTTL {
+		if cached.line == nil {
+			return cached, ErrNoGeometry
+		}
+		return cached, nil
+	}
+	var route models.Route
+	if err := db.Select("id", "geometry").First(&route, routeID).Error; err != nil {
+		return cachedRoute{}, err
+	}
+	var stages []models.Stage
+	if err := db.Select("id", "name", "seq", "lat", "lng").Where("route_id = ?", routeID).Find(&stages).Error; err != nil {
+		return cachedRoute{}, err
+	}
+	r := cachedRoute{at: now}
+	line, err := geo.LineFromWKB(route.Geometry)
+	if err == nil && len(line) >= 2 {
+		r.line = line
+		for _, s := range stages {
+			along, _ := geo.LocateOnLine(geo.Point{Lat: s.Lat, Lng: s.Lng}, line)
+			r.stages = append(r.stages, routeStage{stage: s, alongM: along})
+		}
+		sort.Slice(r.stages, func(i, j int) bool { return r.stages[i].alongM < r.stages[j].alongM })
+	}
+	routes[routeID] = r // Routes without geometry are cached too, so they are not reloaded per fix
+	if r.line == nil {
+		return r, ErrNoGeometry
+	}
+	return r, nil
+}
+
+// RouteLine returns a route's line from the same cache as the ETAs, or
+// ErrNoGeometry when it has none.
+func RouteLine(db *gorm.DB, routeID uint) ([]geo.Point, error) {
+	r, err := routeFor(db, routeID)
+	return r.line, err
+}
+
+// Forget drops a route's cached line and stages after they are edited.
+func Forget(routeID uint) {
+	routesMu.Lock()
+	delete(routes, routeID)
+	routesMu.Unlock()
+}
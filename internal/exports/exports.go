@@ -0,0 +1,247 @@
+// Package exports runs long exports (location history, GTFS bundles) as
+// background jobs, reporting progress on the ExportJob row and writing the
+// result to object storage.
+package exports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/storage"
+)
+
+// ErrUnknownKind is returned for export kinds and formats without a generator.
+var ErrUnknownKind = errors.New("unknown export kind or format")
+
+// Progress reports completion as a percentage between 0 and 100.
+type Progress func(percent int)
+
+// generator writes the export for job to w.
+type generator struct {
+	ext         string
+	contentType string
+	run         func(ctx context.Context, job *models.ExportJob, w io.Writer, progress Progress) error
+}
+
+// generators by kind and format.
+var generators = map[string]map[string]generator{
+	models.ExportKindLocationHistory: {
+		models.ExportFormatCSV:     {".csv", "text/csv", locationHistoryCSV},
+		models.ExportFormatGeoJSON: {".geojson", "application/geo+json", locationHistoryGeoJSON},
+		models.ExportFormatGPX:     {".gpx", "application/gpx+xml", locationHistoryGPX},
+	},
+	models.ExportKindGTFS: {
+		models.ExportFormatZip: {".zip", "application/zip", gtfsBundle},
+	},
+	models.ExportKindAdherence: {
+		models.ExportFormatCSV: {".csv", "text/csv", adherenceRollupCSV},
+	},
+}
+
+// defaultFormats is the format of each kind when the job doesn't name one.
+var defaultFormats = map[string]string{
+	models.ExportKindLocationHistory: models.ExportFormatCSV,
+	models.ExportKindGTFS:            models.ExportFormatZip,
+	models.ExportKindAdherence:       models.ExportFormatCSV,
+}
+
+// Supported reports whether kind can be exported as format, where an empty
+// format stands for the kind's default.
+func Supported(kind, format string) bool {
+	_, ok := generatorFor(kind, format)
+	return ok
+}
+
+// DefaultFormat returns the format kind is exported as when none is asked for.
+func DefaultFormat(kind string) string {
+	return defaultFormats[kind]
+}
+
+func generatorFor(kind, format string) (generator, bool) {
+	if format == "" {
+		format = defaultFormats[kind]
+	}
+	gen, ok := generators[kind][format]
+	return gen, ok
+}
+
+// FileName returns the name a download of job's result is offered under.
+func FileName(job *models.ExportJob, at time.Time) string {
+	gen, _ := generatorFor(job.Kind, job.Format)
+	return fmt.Sprintf("%s-%s%s", job.Kind, at.Format("20060102-150405"), gen.ext)
+}
+
+// ContentType returns the media type of job's result.
+func ContentType(job *models.ExportJob) string {
+	gen, _ := generatorFor(job.Kind, job.Format)
+	return gen.contentType
+}
+
+// Write generates job's export straight to w, for results small enough to
+// return in the response instead of through a background job. The job need
+// not be saved.
+func Write(ctx context.Context, job *models.ExportJob, w io.Writer) error {
+	gen, ok := generatorFor(job.Kind, job.Format)
+	if !ok {
+		return ErrUnknownKind
+	}
+	return gen.run(ctx, job, w, func(int) {})
+}
+
+// ResultTTL is how long a finished export is kept before cleanup.
+func ResultTTL() time.Duration {
+	return config.EnvDuration("EXPORT_RESULT_TTL", 72*time.Hour)
+}
+
+// JobKind is the kind of the background jobs that run exports.
+const JobKind = "export"
+
+// jobAttempts is how many times an export is tried before it is failed.
+const jobAttempts = 3
+
+func init() {
+	jobs.Register(JobKind, jobAttempts, runJob)
+}
+
+type jobPayload struct {
+	ExportID uint `json:"export_id"`
+}
+
+// Queue queues the export, already saved with tx, to run in the background.
+func Queue(tx *gorm.DB, job *models.ExportJob) error {
+	queued, err := jobs.Enqueue(tx, JobKind, jobPayload{ExportID: job.ID}, jobs.Options{UserID: job.UserID, SaccoID: job.SaccoID})
+	if err != nil {
+		return err
+	}
+	job.JobID = queued.ID
+	return tx.Model(job).Update("job_id", queued.ID).Error
+}
+
+// runJob runs the export named by a job. Until the last attempt fails the
+// export goes back to queued, keeping the error for the client to see.
+func runJob(ctx context.Context, queued *models.Job) error {
+	var payload jobPayload
+	if err := jobs.Decode(queued, &payload); err != nil {
+		return jobs.Permanent(err)
+	}
+	var job models.ExportJob
+	if err := config.DB.First(&job, payload.ExportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if job.Status == models.ExportStatusCompleted || job.Status == models.ExportStatusExpired {
+		return nil // Finished by an earlier attempt whose worker died
+	}
+	err := run(ctx, &job)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrUnknownKind) {
+		err = jobs.Permanent(err)
+	}
+	status := models.ExportStatusQueued
+	if ctx.Err() == nil && (jobs.LastAttempt(queued) || errors.Is(err, ErrUnknownKind)) {
+		status = models.ExportStatusFailed
+	}
+	logrus.WithError(err).WithFields(logrus.Fields{"export_id": job.ID, "attempt": queued.Attempts}).Error("exports: Export failed.")
+	config.DB.Model(&job).Updates(map[string]interface{}{"status": status, "error": err.Error()})
+	return err
+}
+
+func run(ctx context.Context, job *models.ExportJob) error {
+	gen, ok := generatorFor(job.Kind, job.Format)
+	if !ok {
+		return ErrUnknownKind
+	}
+	if err := config.DB.Model(job).Updates(map[string]interface{}{"status": models.ExportStatusRunning, "progress": 0}).Error; err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "export-*"+gen.ext)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	last := 0
+	progress := func(pct int) {
+		if pct > 99 {
+			pct = 99 // 100 is reserved for the upload having finished
+		}
+		if pct <= last {
+			return
+		}
+		last = pct
+		config.DB.Model(job).Update("progress", pct)
+	}
+	if err := gen.run(ctx, job, tmp, progress); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("exports/%d/%d-%s-%s%s", job.SaccoID, job.ID, job.Kind, storage.RandomName(), gen.ext)
+	if err := storage.Default().Put(ctx, key, tmp, gen.contentType); err != nil {
+		return fmt.Errorf("failed to store export: %w", err)
+	}
+
+	now := time.Now()
+	expires := now.Add(ResultTTL())
+	return config.DB.Model(job).Updates(map[string]interface{}{
+		"status":       models.ExportStatusCompleted,
+		"progress":     100,
+		"result_key":   key,
+		"file_name":    FileName(job, now),
+		"size_bytes":   size,
+		"completed_at": now,
+		"expires_at":   expires,
+	}).Error
+}
+
+// StartCleanup marks exports from before the job queue that a restart
+// interrupted as failed, and then periodically deletes expired results from
+// storage. Queued exports are picked up again by the job workers.
+func StartCleanup(interval time.Duration) {
+	config.DB.Model(&models.ExportJob{}).
+		Where("status IN ? AND job_id = 0", []string{models.ExportStatusQueued, models.ExportStatusRunning}).
+		Updates(map[string]interface{}{"status": models.ExportStatusFailed, "error": "interrupted by server restart"})
+
+	background.Every(interval, cleanupExpired)
+}
+
+func cleanupExpired(ctx context.Context) {
+	var expired []models.ExportJob
+	if err := config.DB.Where("status = ? AND expires_at < ?", models.ExportStatusCompleted, time.Now()).Find(&expired).Error; err != nil {
+		logrus.WithError(err).Error("exports: Failed to load expired exports.")
+		return
+	}
+	for _, job := range expired {
+		if err := storage.Default().Delete(ctx, job.ResultKey); err != nil {
+			logrus.WithError(err).WithField("export_id", job.ID).Warn("exports: Failed to delete expired export.")
+			continue
+		}
+		config.DB.Model(&job).Updates(map[string]interface{}{"status": models.ExportStatusExpired, "result_key": ""})
+	}
+	if len(expired) > 0 {
+		logrus.Infof("exports: Cleaned up %d expired exports.", len(expired))
+	}
+}
@@ -0,0 +1,184 @@
+package exports
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/pseudonym"
+)
+
+// driverColumn renders driver identifiers, as IDs or as pseudonyms when the
+// job asks for them.
+type driverColumn struct {
+	header string
+	pseudo *pseudonym.Pseudonymizer
+}
+
+func newDriverColumn(job *models.ExportJob) (driverColumn, error) {
+	if !job.Pseudonymize {
+		return driverColumn{header: "driver_id"}, nil
+	}
+	p, err := pseudonym.New(config.DB)
+	if err != nil {
+		return driverColumn{}, err
+	}
+	return driverColumn{header: "driver_pseudonym", pseudo: p}, nil
+}
+
+// value returns the identifier for driverID as of at; pseudonyms rotate by
+// epoch. Rows from an epoch whose key was destroyed get none.
+func (d driverColumn) value(driverID uint, at time.Time) (string, error) {
+	if d.pseudo == nil {
+		return strconv.FormatUint(uint64(driverID), 10), nil
+	}
+	v, err := d.pseudo.For(pseudonym.KindDriver, driverID, at)
+	if errors.Is(err, pseudonym.ErrKeyDestroyed) {
+		return "", nil
+	}
+	return v, err
+}
+
+// adherenceRow is one driver's route adherence on one route and day.
+type adherenceRow struct {
+	Day             time.Time
+	RouteID         uint
+	DriverID        uint
+	Trips           int
+	AvgAdherencePct float64
+	StagesServed    int
+	StagesSkipped   int
+	Excursions      int
+}
+
+// adherenceRollupCSV writes daily route adherence per driver and route, the
+// rollup shared with planners and researchers.
+func adherenceRollupCSV(ctx context.Context, job *models.ExportJob, w io.Writer, progress Progress) error {
+	query := config.Replica().WithContext(ctx).Model(&models.TripAdherence{}).
+		Select("date_trunc('day', started_at) AS day, route_id, driver_id, COUNT(*) AS trips, "+
+			"AVG(adherence_pct) AS avg_adherence_pct, SUM(stages_served) AS stages_served, "+
+			"SUM(stages_skipped) AS stages_skipped, SUM(excursions) AS excursions").
+		Where("sacco_id = ?", job.SaccoID).
+		Group("day, route_id, driver_id").
+		Order("day, route_id, driver_id")
+	if job.From != nil {
+		query = query.Where("started_at >= ?", *job.From)
+	}
+	if job.To != nil {
+		query = query.Where("started_at < ?", *job.To)
+	}
+	var rows []adherenceRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	driverColumn, err := newDriverColumn(job)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "route_id", driverColumn.header, "trips", "avg_adherence_pct", "stages_served", "stages_skipped", "excursions"})
+	for i, r := range rows {
+		driver, err := driverColumn.value(r.DriverID, r.Day)
+		if err != nil {
+			return err
+		}
+		cw.Write([]string{
+			r.Day.Format("2006-01-02"),
+			strconv.FormatUint(uint64(r.RouteID), 10),
+			driver,
+			strconv.Itoa(r.Trips),
+			strconv.FormatFloat(r.AvgAdherencePct, 'f', 1, 64),
+			strconv.Itoa(r.StagesServed),
+			strconv.Itoa(r.StagesSkipped),
+			strconv.Itoa(r.Excursions),
+		})
+		if i%1000 == 0 {
+			progress(i * 100 / len(rows))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// gtfsBundle writes the static GTFS files derivable from the sacco's published
+// routes: agency, routes, stops and shapes. Trips and stop times are omitted
+// because routes carry no schedules.
+func gtfsBundle(ctx context.Context, job *models.ExportJob, w io.Writer, progress Progress) error {
+	var sacco models.Sacco
+	if err := config.Replica().WithContext(ctx).First(&sacco, job.SaccoID).Error; err != nil {
+		return err
+	}
+	var routes []models.Route
+	if err := config.Replica().WithContext(ctx).Preload("Stages").
+		Where("sacco_id = ? AND status = ?", job.SaccoID, models.RouteStatusPublished).
+		Find(&routes).Error; err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	agencyID := strconv.FormatUint(uint64(sacco.ID), 10)
+	if err := writeCSV(zw, "agency.txt", [][]string{
+		{"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_phone"},
+		{agencyID, sacco.Name, "", "Africa/Nairobi", sacco.Phone},
+	}); err != nil {
+		return err
+	}
+
+	routeRows := [][]string{{"route_id", "agency_id", "route_short_name", "route_long_name", "route_desc", "route_type"}}
+	stopRows := [][]string{{"stop_id", "stop_name", "stop_lat", "stop_lon"}}
+	shapeRows := [][]string{{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"}}
+	for i, r := range routes {
+		id := strconv.FormatUint(uint64(r.ID), 10)
+		routeRows = append(routeRows, []string{id, agencyID, r.Name, r.Name, r.Description, "3"})
+		for _, s := range r.Stages {
+			stopRows = append(stopRows, []string{
+				strconv.FormatUint(uint64(s.ID), 10), s.Name,
+				strconv.FormatFloat(s.Lat, 'f', 6, 64), strconv.FormatFloat(s.Lng, 'f', 6, 64),
+			})
+		}
+		if line, err := geo.LineFromWKB(r.Geometry); err == nil {
+			var dist float64
+			for seq, p := range line {
+				if seq > 0 {
+					dist += geo.Haversine(line[seq-1], p)
+				}
+				shapeRows = append(shapeRows, []string{
+					id, strconv.FormatFloat(p.Lat, 'f', 6, 64), strconv.FormatFloat(p.Lng, 'f', 6, 64),
+					strconv.Itoa(seq + 1), fmt.Sprintf("%.1f", dist),
+				})
+			}
+		}
+		progress((i + 1) * 100 / len(routes))
+	}
+	if err := writeCSV(zw, "routes.txt", routeRows); err != nil {
+		return err
+	}
+	if err := writeCSV(zw, "stops.txt", stopRows); err != nil {
+		return err
+	}
+	if err := writeCSV(zw, "shapes.txt", shapeRows); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeCSV(zw *zip.Writer, name string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
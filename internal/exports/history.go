@@ -0,0 +1,274 @@
+package exports
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// historyProgressEvery is how many points are written between progress updates.
+const historyProgressEvery = 5000
+
+// historyQuery selects the points a location history job covers: those
+// reported by or attributed to the sacco's drivers and vehicles, including
+// ones since removed, narrowed to the job's driver, vehicle and time window.
+func historyQuery(ctx context.Context, job *models.ExportJob) *gorm.DB {
+	db := config.Replica().WithContext(ctx)
+	query := db.Model(&models.LocationHistory{}).
+		Where("driver_id IN (?) OR vehicle_id IN (?)",
+			db.Unscoped().Model(&models.Driver{}).Select("id").Where("sacco_id = ?", job.SaccoID),
+			db.Unscoped().Model(&models.Vehicle{}).Select("id").Where("sacco_id = ?", job.SaccoID))
+	if job.DriverID != nil {
+		query = query.Where("driver_id = ?", *job.DriverID)
+	}
+	if job.VehicleID != nil {
+		query = query.Where("vehicle_id = ?", *job.VehicleID)
+	}
+	if job.From != nil {
+		query = query.Where("timestamp >= ?", *job.From)
+	}
+	if job.To != nil {
+		query = query.Where("timestamp < ?", *job.To)
+	}
+	return query
+}
+
+// CountLocationHistory returns how many points a location history export
+// for job would contain.
+func CountLocationHistory(ctx context.Context, job *models.ExportJob) (int64, error) {
+	var total int64
+	err := historyQuery(ctx, job).Count(&total).Error
+	return total, err
+}
+
+// eachHistoryPoint calls fn with every point job covers, grouped into
+// tracks: ordered by vehicle, then driver, then time.
+func eachHistoryPoint(ctx context.Context, job *models.ExportJob, progress Progress, fn func(p *models.LocationHistory) error) error {
+	total, err := CountLocationHistory(ctx, job)
+	if err != nil {
+		return err
+	}
+	rows, err := historyQuery(ctx, job).Order("vehicle_id, driver_id, timestamp, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var done int64
+	for rows.Next() {
+		var p models.LocationHistory
+		if err := config.DB.ScanRows(rows, &p); err != nil {
+			return err
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+		done++
+		if done%historyProgressEvery == 0 && total > 0 {
+			progress(int(done * 100 / total))
+		}
+	}
+	return rows.Err()
+}
+
+// locationHistoryCSV writes one row per point.
+func locationHistoryCSV(ctx context.Context, job *models.ExportJob, w io.Writer, progress Progress) error {
+	driverColumn, err := newDriverColumn(job)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{driverColumn.header, "timestamp", "latitude", "longitude", "speed_mps", "bearing", "accuracy", "event_type", "vehicle_id", "source"})
+	err = eachHistoryPoint(ctx, job, progress, func(p *models.LocationHistory) error {
+		driver, err := driverColumn.value(p.DriverID, p.Timestamp)
+		if err != nil {
+			return err
+		}
+		cw.Write([]string{
+			driver,
+			p.Timestamp.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(p.Latitude, 'f', 6, 64),
+			strconv.FormatFloat(p.Longitude, 'f', 6, 64),
+			strconv.FormatFloat(p.Speed, 'f', 2, 64),
+			strconv.FormatFloat(p.Bearing, 'f', 1, 64),
+			strconv.FormatFloat(p.Accuracy, 'f', 1, 64),
+			p.EventType,
+			strconv.FormatUint(uint64(p.VehicleID), 10),
+			p.Source,
+		})
+		return cw.Error()
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// locationHistoryGeoJSON writes a FeatureCollection with a Point feature per
+// point. Features are written as they are read so large exports don't have to
+// fit in memory.
+func locationHistoryGeoJSON(ctx context.Context, job *models.ExportJob, w io.Writer, progress Progress) error {
+	driverColumn, err := newDriverColumn(job)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"type":"FeatureCollection","features":[`)
+	first := true
+	err = eachHistoryPoint(ctx, job, progress, func(p *models.LocationHistory) error {
+		driver, err := driverColumn.value(p.DriverID, p.Timestamp)
+		if err != nil {
+			return err
+		}
+		feature, err := json.Marshal(map[string]interface{}{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": [2]float64{p.Longitude, p.Latitude},
+			},
+			"properties": map[string]interface{}{
+				driverColumn.header: driver,
+				"vehicle_id":        p.VehicleID,
+				"timestamp":         p.Timestamp.UTC().Format(time.RFC3339),
+				"speed_mps":         p.Speed,
+				"bearing":           p.Bearing,
+				"accuracy":          p.Accuracy,
+				"altitude":          p.Altitude,
+				"event_type":        p.EventType,
+				"source":            p.Source,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		_, err = bw.Write(feature)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("]}\n")
+	return bw.Flush()
+}
+
+type gpxTrackPoint struct {
+	XMLName xml.Name  `xml:"trkpt"`
+	Lat     float64   `xml:"lat,attr"`
+	Lon     float64   `xml:"lon,attr"`
+	Ele     float64   `xml:"ele"`
+	Time    time.Time `xml:"time"`
+}
+
+// locationHistoryGPX writes a GPX 1.1 document with a track for each vehicle
+// and driver pairing, named after the vehicle's number.
+func locationHistoryGPX(ctx context.Context, job *models.ExportJob, w io.Writer, progress Progress) error {
+	driverColumn, err := newDriverColumn(job)
+	if err != nil {
+		return err
+	}
+	var vehicles []models.Vehicle
+	if err := config.Replica().WithContext(ctx).Unscoped().Select("id", "vehicle_no").Where("sacco_id = ?", job.SaccoID).Find(&vehicles).Error; err != nil {
+		return err
+	}
+	vehicleNos := make(map[uint]string, len(vehicles))
+	for _, v := range vehicles {
+		vehicleNos[v.ID] = v.VehicleNo
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	enc := xml.NewEncoder(bw)
+	enc.Indent("", "  ")
+	start := func(name string, attrs ...xml.Attr) error {
+		return enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs})
+	}
+	end := func(name string) error {
+		return enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+	err = start("gpx",
+		xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: "http://www.topografix.com/GPX/1/1"},
+		xml.Attr{Name: xml.Name{Local: "version"}, Value: "1.1"},
+		xml.Attr{Name: xml.Name{Local: "creator"}, Value: "ma3_tracker"})
+	if err != nil {
+		return err
+	}
+	err = enc.EncodeElement(struct {
+		Name string    `xml:"name"`
+		Time time.Time `xml:"time"`
+	}{"Location history", time.Now().UTC()}, xml.StartElement{Name: xml.Name{Local: "metadata"}})
+	if err != nil {
+		return err
+	}
+
+	type trackKey struct{ vehicleID, driverID uint }
+	var current *trackKey
+	err = eachHistoryPoint(ctx, job, progress, func(p *models.LocationHistory) error {
+		key := trackKey{p.VehicleID, p.DriverID}
+		if current == nil || *current != key {
+			if current != nil {
+				if err := end("trkseg"); err != nil {
+					return err
+				}
+				if err := end("trk"); err != nil {
+					return err
+				}
+			}
+			current = &key
+			driver, err := driverColumn.value(p.DriverID, p.Timestamp)
+			if err != nil {
+				return err
+			}
+			name := fmt.Sprintf("%s %s", driverColumn.header, driver)
+			if no, ok := vehicleNos[p.VehicleID]; ok {
+				name = fmt.Sprintf("%s (%s %s)", no, driverColumn.header, driver)
+			}
+			if err := start("trk"); err != nil {
+				return err
+			}
+			if err := enc.EncodeElement(name, xml.StartElement{Name: xml.Name{Local: "name"}}); err != nil {
+				return err
+			}
+			if err := start("trkseg"); err != nil {
+				return err
+			}
+		}
+		return enc.Encode(gpxTrackPoint{Lat: p.Latitude, Lon: p.Longitude, Ele: p.Altitude, Time: p.Timestamp.UTC()})
+	})
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if err := end("trkseg"); err != nil {
+			return err
+		}
+		if err := end("trk"); err != nil {
+			return err
+		}
+	}
+	if err := end("gpx"); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	bw.WriteString("\n")
+	return bw.Flush()
+}
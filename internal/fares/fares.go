@@ -0,0 +1,296 @@
+// Package fares estimates what a commuter pays for a matatu ride: the fare
+// from the route's fare matrix (see models.RouteFare), or from distance when
+// the sacco hasn't priced the pair of stages, adjusted by the time-of-day
+// window the ride starts in and by the route's fare rule in force then (see
+// models.FareRule).
+package fares
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/crowding"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// Bases of an estimate.
+const (
+	BasisMatrix   = "matrix"   // The sacco's fare for the pair of stages
+	BasisDistance = "distance" // BaseFare plus PerKm over the distance ridden
+)
+
+var (
+	// BaseFare and PerKm price rides between stages missing from the
+	// route's fare matrix, unless its fare rule sets its own.
+	BaseFare = config.EnvFloat("FARE_BASE", 50)
+	PerKm    = config.EnvFloat("FARE_PER_KM", 5)
+	// Rounding is the step fares are rounded up to, as crews don't give
+	// small change.
+	Rounding = config.EnvFloat("FARE_ROUNDING", 10)
+	// Rules are the default time-of-day multipliers, for routes whose fare
+	// rule sets no peak windows, from FARE_TIME_RULES as
+	// comma-separated HH:MM-HH:MM*multiplier windows in Nairobi time, e.g.
+	// "06:00-09:00*1.2,21:00-05:00*1.5". The first window a ride starts in
+	// applies; windows may run past midnight.
+	Rules = rulesFromEnv(config.EnvString("FARE_TIME_RULES", ""))
+)
+
+// Kinds of adjustment made to a base fare.
+const (
+	AdjustPeak   = "peak"   // The time-of-day window the ride starts in
+	AdjustRule   = "rule"   // The fare rule's own multiplier
+	AdjustDemand = "demand" // Crowding at the boarding stop
+)
+
+// demandHorizon is how far from now a ride may start for the crowding
+// reported now to bear on its fare.
+const demandHorizon = 30 * time.Minute
+
+// Errors returned for rides that can't be priced.
+var (
+	ErrStageNotOnRoute = errors.New("stage is not on the route")
+	ErrSameStage       = errors.New("boarding and alighting stages are the same")
+)
+
+// Rule multiplies fares for rides starting between two times of day,
+// counted in minutes since midnight.
+type Rule struct {
+	Start, End int
+	Multiplier float64
+}
+
+// Name renders the rule's window as HH:MM-HH:MM.
+func (r Rule) Name() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", r.Start/60, r.Start%60, r.End/60, r.End%60)
+}
+
+func (r Rule) covers(minute int) bool {
+	if r.Start <= r.End {
+		return minute >= r.Start && minute < r.End
+	}
+	return minute >= r.Start || minute < r.End
+}
+
+// ParseRules reads rules in the FARE_TIME_RULES format.
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		window, mult, ok := strings.Cut(part, "*")
+		from, to, ok2 := strings.Cut(window, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("fare rule %q is not HH:MM-HH:MM*multiplier", part)
+		}
+		start, err1 := parseClock(from)
+		end, err2 := parseClock(to)
+		m, err3 := strconv.ParseFloat(strings.TrimSpace(mult), 64)
+		if err := errors.Join(err1, err2, err3); err != nil || m <= 0 {
+			return nil, fmt.Errorf("fare rule %q is not HH:MM-HH:MM*multiplier", part)
+		}
+		rules = append(rules, Rule{Start: start, End: end, Multiplier: m})
+	}
+	return rules, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func rulesFromEnv(spec string) []Rule {
+	rules, err := ParseRules(spec)
+	if err != nil {
+		logrus.WithError(err).Warn("fares: Ignoring invalid FARE_TIME_RULES.")
+	}
+	return rules
+}
+
+// windowAt returns the first of rules covering t, if any.
+func windowAt(rules []Rule, t time.Time) *Rule {
+	local := t.In(format.Default().Location)
+	minute := local.Hour()*60 + local.Minute()
+	for i := range rules {
+		if rules[i].covers(minute) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// RuleAt returns the fare rule in force on the route at t: of those whose
+// schedule covers t, the one that took effect last. It returns nil when
+// none is, and the defaults apply.
+func RuleAt(db *gorm.DB, routeID uint, t time.Time) (*models.FareRule, error) {
+	var rule models.FareRule
+	err := db.Where("route_id = ? AND effective_from <= ? AND (effective_until IS NULL OR effective_until > ?)", routeID, t, t).
+		Order("effective_from DESC, id DESC").Limit(1).Find(&rule).Error
+	if err != nil || rule.ID == 0 {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CheckRule reports what is wrong with a fare rule, if anything.
+func CheckRule(r models.FareRule) error {
+	switch {
+	case r.EffectiveUntil != nil && !r.EffectiveUntil.After(r.EffectiveFrom):
+		return errors.New("effective_until must be after effective_from")
+	case r.BaseFare != nil && *r.BaseFare < 0, r.PerKm != nil && *r.PerKm < 0:
+		return errors.New("base_fare and per_km cannot be negative")
+	case r.Multiplier <= 0:
+		return errors.New("multiplier must be positive")
+	case r.DemandMultiplier < 0:
+		return errors.New("demand_multiplier cannot be negative")
+	case r.DemandMultiplier > 0 && (r.DemandThreshold <= 0 || r.DemandThreshold > 100):
+		return errors.New("demand_threshold must be between 1 and 100")
+	}
+	_, err := ParseRules(r.PeakWindows)
+	return err
+}
+
+// Adjustment is one multiplier applied to a base fare.
+type Adjustment struct {
+	Kind       string  `json:"kind"` // AdjustPeak, AdjustRule or AdjustDemand
+	Multiplier float64 `json:"multiplier"`
+	Detail     string  `json:"detail,omitempty"` // The window, the rule's name or the crowding score
+}
+
+// Estimate is the expected fare for one ride.
+type Estimate struct {
+	RouteID       uint         `json:"route_id"`
+	BoardStageID  uint         `json:"board_stage_id"`
+	AlightStageID uint         `json:"alight_stage_id"`
+	Basis         string       `json:"basis"`          // BasisMatrix or BasisDistance
+	BaseFare      float64      `json:"base_fare"`      // Before adjustments
+	Multiplier    float64      `json:"multiplier"`     // Of all adjustments together
+	Rule          string       `json:"rule,omitempty"` // Window of the time-of-day rule applied
+	FareRuleID    uint         `json:"fare_rule_id,omitempty"`
+	Adjustments   []Adjustment `json:"adjustments,omitempty"`
+	Fare          float64      `json:"fare"`
+}
+
+func (e *Estimate) adjust(kind string, multiplier float64, detail string) {
+	e.Adjustments = append(e.Adjustments, Adjustment{Kind: kind, Multiplier: multiplier, Detail: detail})
+	e.Multiplier = math.Round(e.Multiplier*multiplier*1000) / 1000
+}
+
+// Pair orders two stage IDs the way the fare matrix stores them.
+func Pair(a, b uint) (uint, uint) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// For estimates the fare for riding route from board to alight starting at
+// at, under the route's fare rule in force then. The route's Stages must be
+// loaded.
+func For(db *gorm.DB, route models.Route, boardID, alightID uint, at time.Time) (Estimate, error) {
+	e := Estimate{RouteID: route.ID, BoardStageID: boardID, AlightStageID: alightID, Multiplier: 1}
+	var board, alight *models.Stage
+	for i := range route.Stages {
+		switch route.Stages[i].ID {
+		case boardID:
+			board = &route.Stages[i]
+		case alightID:
+			alight = &route.Stages[i]
+		}
+	}
+	if boardID == alightID {
+		return e, ErrSameStage
+	}
+	if board == nil || alight == nil {
+		return e, ErrStageNotOnRoute
+	}
+
+	rule, err := RuleAt(db, route.ID, at)
+	if err != nil {
+		return e, err
+	}
+	base, perKm, windows := BaseFare, PerKm, Rules
+	if rule != nil {
+		e.FareRuleID = rule.ID
+		if rule.BaseFare != nil {
+			base = *rule.BaseFare
+		}
+		if rule.PerKm != nil {
+			perKm = *rule.PerKm
+		}
+		if rule.PeakWindows != "" {
+			if parsed, err := ParseRules(rule.PeakWindows); err == nil {
+				windows = parsed
+			} else {
+				logrus.WithError(err).WithField("fare_rule_id", rule.ID).Warn("fares: Ignoring invalid peak windows.")
+			}
+		}
+	}
+
+	from, to := Pair(boardID, alightID)
+	var entry models.RouteFare
+	if err := db.Where("route_id = ? AND from_stage_id = ? AND to_stage_id = ?", route.ID, from, to).Limit(1).Find(&entry).Error; err != nil {
+		return e, err
+	}
+	if entry.ID != 0 {
+		e.Basis, e.BaseFare = BasisMatrix, entry.Fare
+	} else {
+		e.Basis, e.BaseFare = BasisDistance, roundUp(base+perKm*rideDistance(route, *board, *alight)/1000)
+	}
+
+	if w := windowAt(windows, at); w != nil {
+		e.Rule = w.Name()
+		e.adjust(AdjustPeak, w.Multiplier, w.Name())
+	}
+	if rule != nil && rule.Multiplier > 0 && rule.Multiplier != 1 {
+		e.adjust(AdjustRule, rule.Multiplier, rule.Name)
+	}
+	if rule != nil && rule.DemandMultiplier > 0 && board.StopID != 0 && time.Until(at).Abs() <= demandHorizon {
+		index, err := crowding.ForStops(db, []uint{board.StopID}, time.Now())
+		if err != nil {
+			return e, err
+		}
+		if i, ok := index[board.StopID]; ok && i.Score >= rule.DemandThreshold {
+			e.adjust(AdjustDemand, rule.DemandMultiplier, fmt.Sprintf("crowding %.0f", i.Score))
+		}
+	}
+
+	e.Fare = e.BaseFare
+	if e.Multiplier != 1 {
+		e.Fare = roundUp(e.BaseFare * e.Multiplier)
+	}
+	return e, nil
+}
+
+// rideDistance measures the ride along the route's line, or in a straight
+// line when the route has no geometry.
+func rideDistance(route models.Route, board, alight models.Stage) float64 {
+	a, b := geo.Point{Lat: board.Lat, Lng: board.Lng}, geo.Point{Lat: alight.Lat, Lng: alight.Lng}
+	if line, err := geo.LineFromWKB(route.Geometry); err == nil && len(line) > 1 {
+		fromAlong, _ := geo.LocateOnLine(a, line)
+		toAlong, _ := geo.LocateOnLine(b, line)
+		return math.Abs(toAlong - fromAlong)
+	}
+	return geo.Haversine(a, b)
+}
+
+func roundUp(fare float64) float64 {
+	if Rounding <= 0 {
+		return fare
+	}
+	return math.Ceil(fare/Rounding) * Rounding
+}
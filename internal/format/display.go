@@ -0,0 +1,65 @@
+package format
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Canonical fields Display renders, by JSON name. Speeds are m/s and
+// distances meters wherever the API returns them under these names.
+var (
+	speedFields    = []string{"speed", "avg_speed", "max_speed", "median_speed", "p15_speed"}
+	distanceFields = []string{"distance", "distance_m"}
+)
+
+// Display renders the canonical speed, distance and timestamp fields of a
+// decoded JSON object in p's units and time zone, keyed by field name. Fields
+// that are missing, null or not of the canonical type are skipped, so a
+// "distance" that is already a Quantity is left alone.
+func Display(fields map[string]interface{}, p Preferences) map[string]interface{} {
+	display := map[string]interface{}{}
+	for _, name := range speedFields {
+		if v, ok := number(fields[name]); ok {
+			display[name] = p.Speed(v)
+		}
+	}
+	for _, name := range distanceFields {
+		if v, ok := number(fields[name]); ok {
+			display[name] = p.Distance(v)
+		}
+	}
+	if ts, ok := fields["timestamp"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			display["timestamp"] = p.Time(t)
+		}
+	}
+	return display
+}
+
+// renders reports whether Display renders the field with the given name.
+func renders(name string) bool {
+	if name == "timestamp" {
+		return true
+	}
+	for _, fields := range [][]string{speedFields, distanceFields} {
+		for _, field := range fields {
+			if field == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// number reads a JSON number decoded either as float64 or, with
+// json.Decoder.UseNumber, as json.Number.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
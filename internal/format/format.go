@@ -0,0 +1,209 @@
+// Package format renders canonical server values (m/s, meters, KES, UTC) into
+// the units, currency and time zone a client asked for.
+package format
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // containers often ship without a zoneinfo database
+)
+
+// Supported speed units.
+const (
+	SpeedKMH = "kmh"
+	SpeedMPS = "mps"
+	SpeedMPH = "mph"
+)
+
+// Supported distance units.
+const (
+	DistanceKM = "km"
+	DistanceM  = "m"
+	DistanceMI = "mi"
+)
+
+// DefaultTimeZone is the zone used when a client does not specify one.
+const DefaultTimeZone = "Africa/Nairobi"
+
+// DefaultCurrency is the ISO 4217 code fares are priced in.
+const DefaultCurrency = "KES"
+
+var nairobi = mustLoadLocation(DefaultTimeZone)
+
+// Preferences captures how a client wants values rendered.
+type Preferences struct {
+	SpeedUnit    string         `json:"speed_unit"`
+	DistanceUnit string         `json:"distance_unit"`
+	Currency     string         `json:"currency"`
+	Language     string         `json:"language"`
+	Location     *time.Location `json:"-"`
+}
+
+// Quantity is a converted numeric value with its unit and a display string.
+type Quantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	Text  string  `json:"text"`
+}
+
+// Money is an amount in a currency with a display string.
+type Money struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Text     string  `json:"text"`
+}
+
+// Default returns the preferences used for Kenyan clients that send nothing.
+func Default() Preferences {
+	return Preferences{
+		SpeedUnit:    SpeedKMH,
+		DistanceUnit: DistanceKM,
+		Currency:     DefaultCurrency,
+		Language:     "en",
+		Location:     nairobi,
+	}
+}
+
+// FromRequest reads preferences from query parameters (units, distance_units, tz)
+// or the equivalent X-Units, X-Distance-Units, X-Timezone and Accept-Language headers.
+func FromRequest(r *http.Request) Preferences {
+	p := Default()
+	q := r.URL.Query()
+
+	if u := firstNonEmpty(q.Get("units"), r.Header.Get("X-Units")); u != "" {
+		switch strings.ToLower(u) {
+		case SpeedKMH, "km/h", "metric":
+			p.SpeedUnit = SpeedKMH
+		case SpeedMPS, "m/s", "si":
+			p.SpeedUnit, p.DistanceUnit = SpeedMPS, DistanceM
+		case SpeedMPH, "imperial":
+			p.SpeedUnit, p.DistanceUnit = SpeedMPH, DistanceMI
+		}
+	}
+	if u := firstNonEmpty(q.Get("distance_units"), r.Header.Get("X-Distance-Units")); u != "" {
+		switch strings.ToLower(u) {
+		case DistanceKM, DistanceM, DistanceMI:
+			p.DistanceUnit = strings.ToLower(u)
+		}
+	}
+	if tz := firstNonEmpty(q.Get("tz"), r.Header.Get("X-Timezone")); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			p.Location = loc
+		}
+	}
+	if lang := r.Header.Get("Accept-Language"); lang != "" {
+		p.Language = primaryLanguage(lang)
+	}
+	return p
+}
+
+// Speed converts a speed in meters per second.
+func (p Preferences) Speed(mps float64) Quantity {
+	switch p.SpeedUnit {
+	case SpeedMPS:
+		return quantity(mps, "m/s", 1)
+	case SpeedMPH:
+		return quantity(mps*2.2369362921, "mph", 0)
+	default:
+		return quantity(mps*3.6, "km/h", 0)
+	}
+}
+
+// Distance converts a distance in meters.
+func (p Preferences) Distance(meters float64) Quantity {
+	switch p.DistanceUnit {
+	case DistanceM:
+		return quantity(meters, "m", 0)
+	case DistanceMI:
+		return quantity(meters/1609.344, "mi", 2)
+	default:
+		return quantity(meters/1000, "km", 2)
+	}
+}
+
+// Money renders an amount in the preferred currency (amounts are always KES server-side).
+func (p Preferences) Money(amount float64) Money {
+	currency := p.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{
+		Amount:   round(amount, 2),
+		Currency: currency,
+		Text:     currency + " " + groupThousands(round(amount, 2)),
+	}
+}
+
+// Time renders a timestamp in the preferred zone as RFC3339.
+func (p Preferences) Time(t time.Time) string {
+	loc := p.Location
+	if loc == nil {
+		loc = nairobi
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// Duration renders a duration rounded to whole minutes, e.g. "6 min" or "1 h 5 min".
+func (p Preferences) Duration(d time.Duration) string {
+	mins := int(math.Round(d.Minutes()))
+	if mins < 60 {
+		return fmt.Sprintf("%d min", mins)
+	}
+	return fmt.Sprintf("%d h %d min", mins/60, mins%60)
+}
+
+func quantity(v float64, unit string, decimals int) Quantity {
+	v = round(v, decimals)
+	return Quantity{Value: v, Unit: unit, Text: fmt.Sprintf("%.*f %s", decimals, v, unit)}
+}
+
+func round(v float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(v*pow) / pow
+}
+
+func groupThousands(v float64) string {
+	s := fmt.Sprintf("%.2f", math.Abs(v))
+	intPart, frac := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if v < 0 {
+		return "-" + b.String() + frac
+	}
+	return b.String() + frac
+}
+
+func primaryLanguage(header string) string {
+	tag := strings.TrimSpace(strings.Split(header, ",")[0])
+	tag = strings.Split(tag, ";")[0]
+	tag = strings.ToLower(strings.Split(tag, "-")[0])
+	if tag == "" || tag == "*" {
+		return "en"
+	}
+	return tag
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.FixedZone("EAT", 3*60*60)
+	}
+	return loc
+}
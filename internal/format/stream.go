@@ -0,0 +1,284 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Annotator copies a JSON document to an io.Writer as it is written, adding
+// a "display" object, as built by Display, to every object that has fields to
+// render and no "display" of its own. The document's own bytes go through
+// unchanged, so key order, numbers and string escaping are kept, and only the
+// rendered fields of the open objects are held in memory, whatever the size
+// of the document. From the first byte that is not valid JSON on, the rest is
+// copied as is.
+type Annotator struct {
+	w     io.Writer
+	prefs Preferences
+
+	stack  []*annotatedValue // Open objects and arrays, innermost last
+	mode   scanMode
+	quoted bool   // Whether the string being read is a key
+	escape bool   // Whether the last string byte was a backslash
+	tok    []byte // The scalar being read, when it may be needed
+	keep   bool   // Whether tok is being kept
+	broken bool
+}
+
+// annotatedValue is an open object or array.
+type annotatedValue struct {
+	object     bool
+	started    bool                   // Whether it has a member or element
+	key        string                 // Key of the object's member being read, when it may be rendered
+	fields     map[string]interface{} // Members Display renders
+	hasDisplay bool
+}
+
+type scanMode int
+
+const (
+	scanValue  scanMode = iota // Before a value
+	scanKey                    // Before a key, or the end of an empty object
+	scanColon                  // After a key
+	scanAfter                  // After a value
+	scanString                 // Inside a string
+	scanBare                   // Inside a number, true, false or null
+)
+
+// maxKept bounds the keys and values an Annotator keeps; longer ones are
+// never rendered.
+const maxKept = 64
+
+// NewAnnotator returns an Annotator writing to w in p's units and time zone.
+func NewAnnotator(w io.Writer, p Preferences) *Annotator {
+	return &Annotator{w: w, prefs: p}
+}
+
+func (a *Annotator) Write(b []byte) (int, error) {
+	if a.broken {
+		return a.w.Write(b)
+	}
+	start := 0
+	for i := 0; i < len(b); i++ {
+		display, ok := a.scan(b[i])
+		if !ok {
+			a.broken = true
+			break
+		}
+		if display == nil {
+			continue
+		}
+		if _, err := a.w.Write(b[start:i]); err != nil {
+			return start, err
+		}
+		if _, err := a.w.Write(display); err != nil {
+			return i, err
+		}
+		start = i
+	}
+	if _, err := a.w.Write(b[start:]); err != nil {
+		return start, err
+	}
+	return len(b), nil
+}
+
+// scan takes the next byte of the document, returning what to write before
+// it, and false when the document is not valid JSON.
+func (a *Annotator) scan(c byte) ([]byte, bool) {
+	switch a.mode {
+	case scanString:
+		a.keepByte(c)
+		switch {
+		case a.escape:
+			a.escape = false
+		case c == '\\':
+			a.escape = true
+		case c == '"':
+			a.endString()
+		}
+		return nil, true
+	case scanBare:
+		if isBare(c) {
+			a.keepByte(c)
+			return nil, true
+		}
+		a.endValue(json.Number(a.tok))
+		a.mode = scanAfter
+	}
+	if isSpace(c) {
+		return nil, true
+	}
+	switch a.mode {
+	case scanValue:
+		return nil, a.startValue(c)
+	case scanKey:
+		top := a.top()
+		if c == '}' && !top.started {
+			return a.close(true)
+		}
+		if c != '"' {
+			return nil, false
+		}
+		top.started = true
+		a.mode, a.quoted = scanString, true
+		a.startToken(c, true)
+		return nil, true
+	case scanColon:
+		a.mode = scanValue
+		return nil, c == ':'
+	case scanAfter:
+		if len(a.stack) == 0 {
+			return nil, false
+		}
+		top := a.stack[len(a.stack)-1]
+		switch c {
+		case ',':
+			if top.object {
+				a.mode = scanKey
+			} else {
+				a.mode = scanValue
+			}
+			return nil, true
+		case '}', ']':
+			return a.close(c == '}')
+		}
+	}
+	return nil, false
+}
+
+// startValue begins the value starting with c.
+func (a *Annotator) startValue(c byte) bool {
+	top := a.top()
+	if top != nil && top.key == "display" {
+		top.hasDisplay = true
+	}
+	if c == ']' {
+		// The end of an empty array
+		if top == nil || top.object || top.started {
+			return false
+		}
+		a.stack = a.stack[:len(a.stack)-1]
+		a.endValue(nil)
+		a.mode = scanAfter
+		return true
+	}
+	if top != nil {
+		top.started = true
+	}
+	switch {
+	case c == '{' || c == '[':
+		a.stack = append(a.stack, &annotatedValue{object: c == '{'})
+		a.mode = scanValue
+		if c == '{' {
+			a.mode = scanKey
+		}
+	case c == '"':
+		a.mode, a.quoted = scanString, false
+		a.startToken(c, a.rendering())
+	case c == '-' || c == 't' || c == 'f' || c == 'n' || (c >= '0' && c <= '9'):
+		a.mode = scanBare
+		a.startToken(c, a.rendering())
+	default:
+		return false
+	}
+	return true
+}
+
+// endString finishes the key or string value being read.
+func (a *Annotator) endString() {
+	var s string
+	if a.keep {
+		if err := json.Unmarshal(a.tok, &s); err != nil {
+			a.keep = false
+		}
+	}
+	if a.quoted {
+		top := a.top()
+		top.key = ""
+		if a.keep && (s == "display" || renders(s)) {
+			top.key = s
+		}
+		a.mode = scanColon
+		return
+	}
+	a.mode = scanAfter
+	if a.keep {
+		a.endValue(s)
+	} else {
+		a.endValue(nil)
+	}
+}
+
+// endValue records a finished member value, v, when it may be rendered.
+func (a *Annotator) endValue(v interface{}) {
+	top := a.top()
+	if top == nil || !top.object || top.key == "" || top.key == "display" || !a.keep {
+		return
+	}
+	if top.fields == nil {
+		top.fields = map[string]interface{}{}
+	}
+	top.fields[top.key] = v
+}
+
+// close ends the innermost object or array, returning the display object to
+// add to it.
+func (a *Annotator) close(object bool) ([]byte, bool) {
+	top := a.top()
+	if top == nil || top.object != object {
+		return nil, false
+	}
+	a.stack = a.stack[:len(a.stack)-1]
+	a.keep = false // The value was a container, which is never rendered
+	a.endValue(nil)
+	a.mode = scanAfter
+	if !object || top.hasDisplay || len(top.fields) == 0 {
+		return nil, true
+	}
+	display := Display(top.fields, a.prefs)
+	if len(display) == 0 {
+		return nil, true
+	}
+	out, err := json.Marshal(display)
+	if err != nil {
+		return nil, true
+	}
+	return append([]byte(`,"display":`), out...), true
+}
+
+func (a *Annotator) top() *annotatedValue {
+	if len(a.stack) == 0 {
+		return nil
+	}
+	return a.stack[len(a.stack)-1]
+}
+
+// rendering reports whether the value being started may be rendered.
+func (a *Annotator) rendering() bool {
+	top := a.top()
+	return top != nil && top.object && top.key != "" && top.key != "display"
+}
+
+func (a *Annotator) startToken(c byte, keep bool) {
+	a.tok, a.keep, a.escape = append(a.tok[:0], c), keep, false
+}
+
+func (a *Annotator) keepByte(c byte) {
+	if !a.keep {
+		return
+	}
+	if len(a.tok) >= maxKept {
+		a.keep = false
+		return
+	}
+	a.tok = append(a.tok, c)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isBare reports whether c may be part of a number, true, false or null.
+func isBare(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c == '.' || c == '-' || c == '+' || c == 'E'
+}
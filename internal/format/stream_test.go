@@ -0,0 +1,40 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+)
+
+func annotate(t *testing.T, doc string, chunk int) string {
+	t.Helper()
+	var out bytes.Buffer
+	a := NewAnnotator(&out, Preferences{SpeedUnit: "kmh", DistanceUnit: "km"})
+	for len(doc) > 0 {
+		n := min(chunk, len(doc))
+		if _, err := a.Write([]byte(doc[:n])); err != nil {
+			t.Fatal(err)
+		}
+		doc = doc[n:]
+	}
+	return out.String()
+}
+
+func TestAnnotatorKeepsDocument(t *testing.T) {
+	doc := `{"z":"<a> \"speed\"","items":[{"speed":10,"id":1e3},{"speed":null},[]],` +
+		`"nested":{"distance_m":1500,"display":{"x":1}},"n":-1.5E2}` + "\n"
+	want := `{"z":"<a> \"speed\"","items":[{"speed":10,"id":1e3,"display":{"speed":{"value":36,"unit":"km/h","text":"36 km/h"}}},{"speed":null},[]],` +
+		`"nested":{"distance_m":1500,"display":{"x":1}},"n":-1.5E2}` + "\n"
+	for _, chunk := range []int{1, 7, len(doc)} {
+		if got := annotate(t, doc, chunk); got != want {
+			t.Errorf("chunks of %d:\n got %s\nwant %s", chunk, got, want)
+		}
+	}
+}
+
+func TestAnnotatorPassesInvalidJSON(t *testing.T) {
+	for _, doc := range []string{`{"speed":10 oops}`, `not json`, `{"speed":10,}`, `[1,]`} {
+		if got := annotate(t, doc, 3); got != doc {
+			t.Errorf("%s: got %s; want it unchanged", doc, got)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package geo contains the planar/geodesic helpers used to work with route
+// geometries stored as WKB LineStrings.
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkb"
+)
+
+// EarthRadius is the mean Earth radius in meters.
+const EarthRadius = 6371000.0
+
+// Point is a WGS84 coordinate.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// ErrNoGeometry is returned when a route has no digitized geometry.
+var ErrNoGeometry = errors.New("route has no geometry")
+
+// LineFromWKB decodes a stored route geometry into an ordered list of points.
+// MultiLineStrings are flattened in order.
+func LineFromWKB(b []byte) ([]Point, error) {
+	if len(b) == 0 {
+		return nil, ErrNoGeometry
+	}
+	g, err := wkb.Unmarshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal WKB: %w", err)
+	}
+	return LineFromGeom(g)
+}
+
+// LineFromGeom converts a LineString or MultiLineString into points.
+func LineFromGeom(g geom.T) ([]Point, error) {
+	var coords []geom.Coord
+	switch t := g.(type) {
+	case *geom.LineString:
+		coords = t.Coords()
+	case *geom.MultiLineString:
+		for i := 0; i < t.NumLineStrings(); i++ {
+			coords = append(coords, t.LineString(i).Coords()...)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %T", g)
+	}
+	points := make([]Point, 0, len(coords))
+	for _, c := range coords {
+		points = append(points, Point{Lat: c.Y(), Lng: c.X()})
+	}
+	return points, nil
+}
+
+// LineToWKB encodes points as a little-endian WKB LineString with SRID 4326 coordinates.
+func LineToWKB(points []Point) ([]byte, error) {
+	flat := make([]float64, 0, len(points)*2)
+	for _, p := range points {
+		flat = append(flat, p.Lng, p.Lat)
+	}
+	ls := geom.NewLineStringFlat(geom.XY, flat)
+	return wkb.Marshal(ls, wkb.NDR)
+}
+
+// PointToWKB encodes p as a little-endian WKB Point.
+func PointToWKB(p Point) ([]byte, error) {
+	return wkb.Marshal(geom.NewPointFlat(geom.XY, []float64{p.Lng, p.Lat}), wkb.NDR)
+}
+
+// Haversine returns the great-circle distance between two points in meters.
+func Haversine(a, b Point) float64 {
+	dLat := toRadians(b.Lat - a.Lat)
+	dLng := toRadians(b.Lng - a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(a.Lat))*math.Cos(toRadians(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return EarthRadius * 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// Length returns the total length of a line in meters.
+func Length(line []Point) float64 {
+	var total float64
+	for i := 1; i < len(line); i++ {
+		total += Haversine(line[i-1], line[i])
+	}
+	return total
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Sample is a point on a line together with its distance from the start in meters.
+type Sample struct {
+	Point
+	Distance float64 `json:"distance"`
+}
+
+// Resample walks the line and returns points spaced intervalMeters apart,
+// always including the first and last vertex.
+func Resample(line []Point, intervalMeters float64) []Sample {
+	if len(line) == 0 {
+		return nil
+	}
+	samples := []Sample{{Point: line[0]}}
+	if intervalMeters <= 0 || len(line) == 1 {
+		return samples
+	}
+
+	var travelled float64
+	next := intervalMeters
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		segLen := Haversine(a, b)
+		for segLen > 0 && next <= travelled+segLen {
+			t := (next - travelled) / segLen
+			samples = append(samples, Sample{Point: Interpolate(a, b, t), Distance: next})
+			next += intervalMeters
+		}
+		travelled += segLen
+	}
+	if last := samples[len(samples)-1]; last.Distance < travelled {
+		samples = append(samples, Sample{Point: line[len(line)-1], Distance: travelled})
+	}
+	return samples
+}
+
+// Cut returns the part of line between from and to meters along it, with
+// interpolated endpoints.
+func Cut(line []Point, from, to float64) []Point {
+	var out []Point
+	var travelled float64
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		segLen := Haversine(a, b)
+		end := travelled + segLen
+		if end > from && travelled <= to && segLen > 0 {
+			if out == nil {
+				out = append(out, Interpolate(a, b, math.Max(0, (from-travelled)/segLen)))
+			}
+			if end >= to {
+				return append(out, Interpolate(a, b, (to-travelled)/segLen))
+			}
+			out = append(out, b)
+		}
+		travelled = end
+	}
+	return out
+}
+
+// PlanarFractions converts distances along line (meters, ascending) into
+// fractions of its length measured in degrees, the way PostGIS's
+// ST_LineLocatePoint measures SRID 4326 geometries.
+func PlanarFractions(line []Point, distances []float64) []float64 {
+	var planarTotal float64
+	for i := 1; i < len(line); i++ {
+		planarTotal += math.Hypot(line[i].Lng-line[i-1].Lng, line[i].Lat-line[i-1].Lat)
+	}
+	out := make([]float64, len(distances))
+	if planarTotal == 0 {
+		return out
+	}
+	var travelled, planar float64
+	j := 0
+	for i := 1; i < len(line) && j < len(distances); i++ {
+		segLen := Haversine(line[i-1], line[i])
+		segPlanar := math.Hypot(line[i].Lng-line[i-1].Lng, line[i].Lat-line[i-1].Lat)
+		for j < len(distances) && distances[j] <= travelled+segLen {
+			t := 0.0
+			if segLen > 0 {
+				t = math.Max(0, (distances[j]-travelled)/segLen)
+			}
+			out[j] = (planar + t*segPlanar) / planarTotal
+			j++
+		}
+		travelled += segLen
+		planar += segPlanar
+	}
+	for ; j < len(distances); j++ {
+		out[j] = 1
+	}
+	return out
+}
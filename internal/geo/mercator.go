@@ -0,0 +1,17 @@
+package geo
+
+import "math"
+
+// maxMercatorLat is where Web Mercator maps are cut off.
+const maxMercatorLat = 85.05112878
+
+// Mercator projects p onto the Web Mercator plane used by map tiles, scaled
+// to [0, 1) on both axes with y growing southwards. Multiply by
+// 256 * 2^zoom for world pixel coordinates.
+func Mercator(p Point) (x, y float64) {
+	lat := math.Max(-maxMercatorLat, math.Min(maxMercatorLat, p.Lat))
+	sin := math.Sin(lat * math.Pi / 180)
+	x = (p.Lng + 180) / 360
+	y = 0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)
+	return x, y
+}
@@ -0,0 +1,127 @@
+package geo
+
+import "math"
+
+// toXY projects p onto a local equirectangular plane (meters) centred on refLat.
+// Accurate enough for the few-kilometre spans between route vertices.
+func toXY(p Point, refLat float64) (float64, float64) {
+	x := toRadians(p.Lng) * EarthRadius * math.Cos(toRadians(refLat))
+	y := toRadians(p.Lat) * EarthRadius
+	return x, y
+}
+
+// DistanceToSegment returns the distance in meters from p to the segment a-b,
+// and the fraction (0..1) along a-b of the closest point.
+func DistanceToSegment(p, a, b Point) (float64, float64) {
+	refLat := (a.Lat + b.Lat) / 2
+	px, py := toXY(p, refLat)
+	ax, ay := toXY(a, refLat)
+	bx, by := toXY(b, refLat)
+
+	dx, dy := bx-ax, by-ay
+	lenSq := dx*dx + dy*dy
+	t := 0.0
+	if lenSq > 0 {
+		t = ((px-ax)*dx + (py-ay)*dy) / lenSq
+		t = math.Max(0, math.Min(1, t))
+	}
+	cx, cy := ax+t*dx, ay+t*dy
+	return math.Hypot(px-cx, py-cy), t
+}
+
+// Interpolate returns the point at fraction t along a-b.
+func Interpolate(a, b Point, t float64) Point {
+	return Point{Lat: a.Lat + (b.Lat-a.Lat)*t, Lng: a.Lng + (b.Lng-a.Lng)*t}
+}
+
+// Simplify reduces a line with the Douglas-Peucker algorithm. Vertices closer
+// than toleranceMeters to the simplified line are dropped; endpoints are kept.
+func Simplify(line []Point, toleranceMeters float64) []Point {
+	if len(line) < 3 || toleranceMeters <= 0 {
+		return line
+	}
+	out := make([]Point, 0, len(line))
+	for i, k := range SimplifyMask(line, toleranceMeters) {
+		if k {
+			out = append(out, line[i])
+		}
+	}
+	return out
+}
+
+// SimplifyMask is Simplify reporting which of line's vertices it keeps.
+func SimplifyMask(line []Point, toleranceMeters float64) []bool {
+	keep := make([]bool, len(line))
+	if len(line) < 3 || toleranceMeters <= 0 {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+	keep[0], keep[len(line)-1] = true, true
+
+	type span struct{ first, last int }
+	stack := []span{{0, len(line) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDist, index := 0.0, -1
+		for i := s.first + 1; i < s.last; i++ {
+			if d, _ := DistanceToSegment(line[i], line[s.first], line[s.last]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if index != -1 && maxDist > toleranceMeters {
+			keep[index] = true
+			stack = append(stack, span{s.first, index}, span{index, s.last})
+		}
+	}
+	return keep
+}
+
+// NearestOnLine returns the point on line closest to p and its distance in meters.
+func NearestOnLine(p Point, line []Point) (Point, float64) {
+	if len(line) == 1 {
+		return line[0], Haversine(p, line[0])
+	}
+	best, bestDist := Point{}, math.Inf(1)
+	for i := 1; i < len(line); i++ {
+		d, t := DistanceToSegment(p, line[i-1], line[i])
+		if d < bestDist {
+			best, bestDist = Interpolate(line[i-1], line[i], t), d
+		}
+	}
+	return best, bestDist
+}
+
+// LocateOnLine returns how far along line (meters from its start) the point
+// closest to p lies, and p's distance from the line.
+func LocateOnLine(p Point, line []Point) (float64, float64) {
+	bestAlong, bestDist, travelled := 0.0, math.Inf(1), 0.0
+	for i := 1; i < len(line); i++ {
+		segment := Haversine(line[i-1], line[i])
+		d, t := DistanceToSegment(p, line[i-1], line[i])
+		if d < bestDist {
+			bestAlong, bestDist = travelled+t*segment, d
+		}
+		travelled += segment
+	}
+	return bestAlong, bestDist
+}
+
+// Coverage returns the fraction of line a, sampled every intervalMeters, that
+// lies within toleranceMeters of line b.
+func Coverage(a, b []Point, toleranceMeters, intervalMeters float64) float64 {
+	samples := Resample(a, intervalMeters)
+	if len(samples) == 0 || len(b) == 0 {
+		return 0
+	}
+	within := 0
+	for _, s := range samples {
+		if _, d := NearestOnLine(s.Point, b); d <= toleranceMeters {
+			within++
+		}
+	}
+	return float64(within) / float64(len(samples))
+}
@@ -0,0 +1,154 @@
+// Package geofence detects vehicles arriving at and departing from the stages
+// of the route they serve.
+package geofence
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// Radius is how close a vehicle must come to a stage to arrive at it.
+	Radius = config.EnvFloat("GEOFENCE_STAGE_RADIUS_METERS", 50)
+	// exitFactor widens the fence for departures so GPS jitter around the
+	// edge does not produce a burst of arrivals and departures.
+	exitFactor = 1.5
+	// MaxAccuracy skips fixes too imprecise to place a vehicle at a stage.
+	MaxAccuracy = config.EnvFloat("GEOFENCE_MAX_ACCURACY_METERS", 100)
+	// Gap ends a stay when the vehicle has not reported for this long; the
+	// departure is then dated to its last fix at the stage.
+	Gap = config.EnvDuration("GEOFENCE_GAP", 10*time.Minute)
+	// stagesTTL bounds how long a route's stages are cached.
+	stagesTTL = time.Minute
+)
+
+// stay is a vehicle currently inside a stage's fence.
+type stay struct {
+	stage    models.Stage
+	routeID  uint
+	arrived  time.Time
+	lastSeen time.Time
+}
+
+type cachedStages struct {
+	stages []models.Stage
+	at     time.Time
+}
+
+var (
+	mu       sync.Mutex
+	stays    = map[uint]*stay{}
+	stagesMu sync.Mutex
+	stages   = map[uint]cachedStages{}
+)
+
+// Track feeds a vehicle's fix into stage detection and returns the arrivals
+// and departures it caused, already saved. Fixes without a vehicle or route
+// are ignored. Events carry their Stage.
+func Track(db *gorm.DB, fix models.LocationHistory, saccoID, routeID uint) ([]models.StageEvent, error) {
+	if fix.VehicleID == 0 || routeID == 0 {
+		return nil, nil
+	}
+	if fix.Accuracy > MaxAccuracy {
+		return nil, nil
+	}
+	routeStages, err := stagesFor(db, routeID)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	pt := geo.Point{Lat: fix.Latitude, Lng: fix.Longitude}
+	event := func(kind string, stage models.Stage, at time.Time) models.StageEvent {
+		return models.StageEvent{
+			VehicleID: fix.VehicleID,
+			DriverID:  fix.DriverID,
+			SaccoID:   saccoID,
+			RouteID:   routeID,
+			StageID:   stage.ID,
+			Kind:      kind,
+			At:        at,
+			Latitude:  fix.Latitude,
+			Longitude: fix.Longitude,
+			DistanceM: geo.Haversine(pt, geo.Point{Lat: stage.Lat, Lng: stage.Lng}),
+			Stage:     &stage,
+		}
+	}
+
+	var events []models.StageEvent
+	s := stays[fix.VehicleID]
+	if s != nil && !fix.Timestamp.After(s.lastSeen) {
+		return nil, nil // Older than what the stay already covers
+	}
+	if s != nil {
+		leftAt := fix.Timestamp
+		if fix.Timestamp.Sub(s.lastSeen) > Gap {
+			leftAt = s.lastSeen
+		}
+		d := geo.Haversine(pt, geo.Point{Lat: s.stage.Lat, Lng: s.stage.Lng})
+		if s.routeID == routeID && leftAt.Equal(fix.Timestamp) && d <= Radius*exitFactor {
+			s.lastSeen = fix.Timestamp
+			return nil, nil
+		}
+		e := event(models.StageDeparture, s.stage, leftAt)
+		e.DwellSeconds = leftAt.Sub(s.arrived).Seconds()
+		events = append(events, e)
+		delete(stays, fix.VehicleID)
+	}
+
+	if stage, ok := nearest(pt, routeStages); ok {
+		events = append(events, event(models.StageArrival, stage, fix.Timestamp))
+		stays[fix.VehicleID] = &stay{stage: stage, routeID: routeID, arrived: fix.Timestamp, lastSeen: fix.Timestamp}
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	if err := db.Omit("Stage").Create(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// nearest returns the closest stage within Radius of pt.
+func nearest(pt geo.Point, routeStages []models.Stage) (models.Stage, bool) {
+	best, bestDist := models.Stage{}, math.Inf(1)
+	for _, s := range routeStages {
+		if d := geo.Haversine(pt, geo.Point{Lat: s.Lat, Lng: s.Lng}); d <= Radius && d < bestDist {
+			best, bestDist = s, d
+		}
+	}
+	return best, !math.IsInf(bestDist, 1)
+}
+
+// stagesFor returns a route's stages, cached for stagesTTL.
+func stagesFor(db *gorm.DB, routeID uint) ([]models.Stage, error) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	now := time.Now()
+	if cached, ok := stages[routeID]; ok && now.Sub(cached.at) < stagesTTL {
+		return cached.stages, nil
+	}
+	var routeStages []models.Stage
+	if err := db.Select("id", "name", "seq", "lat", "lng", "route_id").Where("route_id = ?", routeID).
+		Order("seq").Find(&routeStages).Error; err != nil {
+		return nil, err
+	}
+	stages[routeID] = cachedStages{stages: routeStages, at: now}
+	return routeStages, nil
+}
+
+// Forget drops the cached stages of a route after they are edited.
+func Forget(routeID uint) {
+	stagesMu.Lock()
+	delete(stages, routeID)
+	stagesMu.Unlock()
+}
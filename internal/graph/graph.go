@@ -0,0 +1,104 @@
+// Package graph holds the GraphQL schema served at /graphql and the batching
+// loaders its resolvers use to avoid a query per object. The resolvers live
+// in internal/controllers next to the REST handlers they share code with.
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"sync"
+)
+
+var errFetchPanicked = errors.New("graph: loader fetch panicked")
+
+// Schema is the GraphQL schema definition.
+//
+//go:embed schema.graphql
+var Schema string
+
+// Loader loads values by key in batches, caching them for its lifetime; make
+// one per request. A resolver that returns a list primes the loader with the
+// keys its items will ask for, so the first item's Load fetches them all with
+// one call and the other items wait for that result.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	entries map[K]*entry[V]
+	pending []K // Primed keys not fetched yet
+}
+
+type entry[V any] struct {
+	done    chan struct{}
+	started bool
+	val     V
+	err     error
+}
+
+// NewLoader returns a loader that calls fetch for keys not loaded yet. Keys
+// missing from fetch's result load as V's zero value.
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, entries: make(map[K]*entry[V])}
+}
+
+// Prime queues keys for the next fetch.
+func (l *Loader[K, V]) Prime(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		l.add(k)
+	}
+}
+
+func (l *Loader[K, V]) add(k K) *entry[V] {
+	e, ok := l.entries[k]
+	if !ok {
+		e = &entry[V]{done: make(chan struct{})}
+		l.entries[k] = e
+		l.pending = append(l.pending, k)
+	}
+	return e
+}
+
+// Load returns the value for key, fetching it along with every primed key
+// when it has not been fetched yet.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	e := l.add(key)
+	var batch []K
+	if !e.started {
+		batch, l.pending = l.pending, nil
+		for _, k := range batch {
+			l.entries[k].started = true
+		}
+	}
+	l.mu.Unlock()
+
+	if batch != nil {
+		l.run(ctx, batch)
+	}
+	select {
+	case <-e.done:
+		return e.val, e.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *Loader[K, V]) run(ctx context.Context, keys []K) {
+	var vals map[K]V
+	err := errFetchPanicked
+	defer func() {
+		// Release the waiting resolvers even when fetch panics
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, k := range keys {
+			e := l.entries[k]
+			e.val, e.err = vals[k], err
+			close(e.done)
+		}
+	}()
+	vals, err = l.fetch(ctx, keys)
+}
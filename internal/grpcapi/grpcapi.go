@@ -0,0 +1,264 @@
+// Package grpcapi serves the gRPC API on its own port, next to the HTTP
+// server. Its services are defined under proto/ and generated into
+// subpackages such as locationsv1. Calls authenticate with the same tokens as
+// the REST API, sent as "authorization: Bearer <token>" metadata.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/tenancy"
+)
+
+var grpcCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_calls_total",
+	Help: "gRPC calls handled, by method and status code.",
+}, []string{"method", "code"})
+
+// Caller is the authenticated user behind a call.
+type Caller struct {
+	UserID   uint
+	Role     string
+	SaccoID  uint // The sacco the caller owns or drives for
+	DriverID uint // The caller's driver profile, for drivers
+
+	// When the call's token expires; zero for tokens without an expiry.
+	ExpiresAt time.Time
+}
+
+type callerKey struct{}
+
+// CallerFrom returns the caller authenticated for the call with ctx.
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
+
+// authenticate checks the call's bearer token and adds its Caller to ctx.
+// Guest tokens are refused.
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := md.Get("authorization")
+	if len(auth) == 0 || !strings.HasPrefix(auth[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid authorization metadata")
+	}
+	claims, err := middleware.ValidateToken(strings.TrimPrefix(auth[0], "Bearer "))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	if claims.Role == middleware.RoleGuest {
+		return nil, status.Error(codes.PermissionDenied, "guests cannot use the gRPC API")
+	}
+	t, err := tenancy.Lookup(claims.UserID, claims.Role)
+	if err == nil {
+		var required bool
+		if required, err = middleware.PasswordChangeRequired(claims.UserID); err == nil && required {
+			return nil, status.Error(codes.PermissionDenied, "change your password to continue")
+		}
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, status.Error(codes.Unauthenticated, "user not found")
+	case errors.Is(err, tenancy.ErrNoProfile):
+		return nil, status.Error(codes.PermissionDenied, "no "+t.Role+" profile for this user")
+	case err != nil:
+		logrus.WithContext(ctx).WithError(err).WithField("user_id", claims.UserID).Error("grpcapi: Failed to load caller.")
+		return nil, status.Error(codes.Unavailable, "failed to load user")
+	}
+	caller := Caller{UserID: t.UserID, Role: t.Role, SaccoID: t.SaccoID(), DriverID: t.DriverID()}
+	if claims.ExpiresAt != nil {
+		caller.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return context.WithValue(ctx, callerKey{}, caller), nil
+}
+
+// finish records a call's outcome, turning a handler's panic into an
+// Internal error.
+func finish(ctx context.Context, method string, start time.Time, err *error) {
+	if r := recover(); r != nil {
+		logrus.WithContext(ctx).WithFields(logrus.Fields{"method": method, "stack": string(debug.Stack())}).Errorf("grpcapi: Handler panicked: %v", r)
+		*err = status.Error(codes.Internal, "internal error")
+	}
+	code := status.Code(*err)
+	grpcCalls.WithLabelValues(method, code.String()).Inc()
+	log := logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"method":      method,
+		"code":        code.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if code == codes.Internal || code == codes.Unknown {
+		log.WithError(*err).Error("grpcapi: Call failed.")
+	} else {
+		log.Info("grpcapi: Call finished.")
+	}
+}
+
+func unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer finish(ctx, info.FullMethod, time.Now(), &err)
+	if ctx, err = authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// errTokenExpired ends streams that outlive the token they were opened with.
+var errTokenExpired = status.Error(codes.Unauthenticated, "token expired; reconnect with a fresh token")
+
+// authedStream carries the authenticated context to a stream's handler. A
+// stream outlives the check its token passed when it was opened, so the
+// context ends when the token expires and no message is received after.
+type authedStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	expiresAt time.Time
+}
+
+func (s authedStream) Context() context.Context { return s.ctx }
+
+func (s authedStream) expired() bool {
+	return !s.expiresAt.IsZero() && !time.Now().Before(s.expiresAt)
+}
+
+func (s authedStream) RecvMsg(m any) error {
+	if s.expired() {
+		return errTokenExpired
+	}
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.expired() {
+		return errTokenExpired
+	}
+	return nil
+}
+
+func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer finish(ss.Context(), info.FullMethod, time.Now(), &err)
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	caller, _ := CallerFrom(ctx)
+	if !caller.ExpiresAt.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, caller.ExpiresAt)
+		defer cancel()
+	}
+	stream := authedStream{ss, ctx, caller.ExpiresAt}
+	if err = handler(srv, stream); err != nil && stream.expired() {
+		return errTokenExpired
+	}
+	return err
+}
+
+// NewServer returns a gRPC server that authenticates, logs and counts calls,
+// with extra options such as transport credentials.
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	return grpc.NewServer(append([]grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryInterceptor),
+		grpc.StreamInterceptor(streamInterceptor),
+		// Notice devices that vanished without closing their stream
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: 2 * time.Minute, Timeout: 20 * time.Second}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: 30 * time.Second, PermitWithoutStream: true}),
+	}, opts...)...)
+}
+
+// ErrNoTLS is returned by Credentials when no certificate is configured and
+// plaintext wasn't explicitly allowed.
+var ErrNoTLS = errors.New("grpcapi: GRPC_TLS_CERT and GRPC_TLS_KEY are required; set GRPC_INSECURE=true only behind a proxy that terminates TLS")
+
+// Credentials returns the server's transport security: TLS with the
+// certificate in GRPC_TLS_CERT and key in GRPC_TLS_KEY. Tokens travel in
+// call metadata, so plaintext is refused unless GRPC_INSECURE=true, for a
+// proxy that terminates TLS in front of the server.
+func Credentials() (grpc.ServerOption, error) {
+	cert, key := config.EnvString("GRPC_TLS_CERT", ""), config.EnvString("GRPC_TLS_KEY", "")
+	if cert == "" || key == "" {
+		if config.EnvBool("GRPC_INSECURE", false) {
+			logrus.Warn("grpcapi: Serving gRPC without TLS (GRPC_INSECURE=true).")
+			return grpc.EmptyServerOption{}, nil
+		}
+		return nil, ErrNoTLS
+	}
+	creds, err := credentials.NewServerTLSFromFile(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("grpcapi: loading TLS certificate: %w", err)
+	}
+	return grpc.Creds(creds), nil
+}
+
+var (
+	server   *grpc.Server
+	stopOnce sync.Once
+	stopping = make(chan struct{})
+)
+
+// Start serves the gRPC API on addr, e.g. ":9090", in the background, with
+// the services register adds to the server. It refuses to serve without
+// transport security; see Credentials.
+func Start(addr string, register func(*grpc.Server)) error {
+	creds, err := Credentials()
+	if err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server = NewServer(creds)
+	register(server)
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			logrus.WithError(err).Error("grpcapi: Server stopped.")
+		}
+	}()
+	logrus.WithField("addr", lis.Addr().String()).Info("grpcapi: Serving gRPC.")
+	return nil
+}
+
+// Stopping is closed when the server starts shutting down, so long-lived
+// streams can end and let their clients reconnect to another replica.
+func Stopping() <-chan struct{} {
+	return stopping
+}
+
+// Shutdown stops accepting calls and waits for running ones to finish,
+// cutting them off when ctx ends first.
+func Shutdown(ctx context.Context) error {
+	stopOnce.Do(func() { close(stopping) })
+	if server == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream receives messages without end.
+type fakeStream struct {
+	grpc.ServerStream
+	received int
+}
+
+func (s *fakeStream) RecvMsg(any) error {
+	s.received++
+	return nil
+}
+
+func TestStreamEndsWhenTokenExpires(t *testing.T) {
+	ss := &fakeStream{}
+	live := authedStream{ServerStream: ss, ctx: context.Background(), expiresAt: time.Now().Add(time.Hour)}
+	if err := live.RecvMsg(nil); err != nil {
+		t.Fatalf("before expiry: %v", err)
+	}
+
+	expired := authedStream{ServerStream: ss, ctx: context.Background(), expiresAt: time.Now().Add(-time.Second)}
+	err := expired.RecvMsg(nil)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("after expiry: err = %v; want Unauthenticated", err)
+	}
+	if ss.received != 1 {
+		t.Errorf("%d messages received; want none after expiry", ss.received)
+	}
+
+	forever := authedStream{ServerStream: ss, ctx: context.Background()}
+	if err := forever.RecvMsg(nil); err != nil {
+		t.Errorf("token without expiry: %v", err)
+	}
+}
+
+func TestCredentialsRequireTLS(t *testing.T) {
+	t.Setenv("GRPC_TLS_CERT", "")
+	t.Setenv("GRPC_TLS_KEY", "")
+	t.Setenv("GRPC_INSECURE", "")
+	if _, err := Credentials(); !errors.Is(err, ErrNoTLS) {
+		t.Fatalf("without a certificate: err = %v; want ErrNoTLS", err)
+	}
+
+	t.Setenv("GRPC_INSECURE", "true")
+	if _, err := Credentials(); err != nil {
+		t.Fatalf("with GRPC_INSECURE=true: %v", err)
+	}
+
+	t.Setenv("GRPC_TLS_CERT", "/nonexistent/cert.pem")
+	t.Setenv("GRPC_TLS_KEY", "/nonexistent/key.pem")
+	if _, err := Credentials(); err == nil {
+		t.Fatal("missing certificate files accepted")
+	}
+}
@@ -0,0 +1,326 @@
+// gRPC location ingestion, for fleet hardware that would rather stream over
+// gRPC than hold a WebSocket open.
+//
+// Served over TLS on its own port when GRPC_PORT is set (off by default).
+// Every call carries the driver's token from /auth/login as
+// "authorization: Bearer <token>" metadata, as the REST API and the
+// WebSocket do; streams end when the token expires. Updates go through the
+// same pipeline as a driver's WebSocket location messages.
+//
+// Go code is generated into internal/grpcapi/locationsv1. Regenerate it
+// after changing this file, and never reuse a field number:
+//
+//   protoc -I proto --go_out=. --go_opt=module=ma3_tracker \
+//     --go-grpc_out=. --go-grpc_opt=module=ma3_tracker \
+//     proto/locations/v1/locations.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: locations/v1/locations.proto
+
+package locationsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LocationUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`                           // Chosen by the client and echoed in the ack
+	DriverId      uint64                 `protobuf:"varint,2,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"` // Optional; when set it must be the token's driver
+	Latitude      float64                `protobuf:"fixed64,3,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,4,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Accuracy      float64                `protobuf:"fixed64,5,opt,name=accuracy,proto3" json:"accuracy,omitempty"`                         // Metres
+	Speed         float64                `protobuf:"fixed64,6,opt,name=speed,proto3" json:"speed,omitempty"`                               // m/s
+	Bearing       float64                `protobuf:"fixed64,7,opt,name=bearing,proto3" json:"bearing,omitempty"`                           // Degrees
+	Altitude      float64                `protobuf:"fixed64,8,opt,name=altitude,proto3" json:"altitude,omitempty"`                         // Metres
+	TimestampMs   int64                  `protobuf:"varint,9,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"` // When the fix was taken, Unix milliseconds
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LocationUpdate) Reset() {
+	*x = LocationUpdate{}
+	mi := &file_locations_v1_locations_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LocationUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocationUpdate) ProtoMessage() {}
+
+func (x *LocationUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_locations_v1_locations_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocationUpdate.ProtoReflect.Descriptor instead.
+func (*LocationUpdate) Descriptor() ([]byte, []int) {
+	return file_locations_v1_locations_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LocationUpdate) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetDriverId() uint64 {
+	if x != nil {
+		return x.DriverId
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetAccuracy() float64 {
+	if x != nil {
+		return x.Accuracy
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetSpeed() float64 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetBearing() float64 {
+	if x != nil {
+		return x.Bearing
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetAltitude() float64 {
+	if x != nil {
+		return x.Altitude
+	}
+	return 0
+}
+
+func (x *LocationUpdate) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+type LocationAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`                             // The update's seq
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`                        // "saved", "ignored" (no significant movement) or "rejected"
+	EventType     string                 `protobuf:"bytes,3,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"` // Why a saved point was kept, "initial", "move", "stopped", "started" or "periodic"
+	Distance      float64                `protobuf:"fixed64,4,opt,name=distance,proto3" json:"distance,omitempty"`                  // Metres from the last saved point
+	IsMoving      bool                   `protobuf:"varint,5,opt,name=is_moving,json=isMoving,proto3" json:"is_moving,omitempty"`
+	SequenceId    uint64                 `protobuf:"varint,6,opt,name=sequence_id,json=sequenceId,proto3" json:"sequence_id,omitempty"` // ID of the saved point
+	TripId        uint64                 `protobuf:"varint,7,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`             // Trip the point was added to, when there is one
+	Error         string                 `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`                              // Why a rejected update was refused
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LocationAck) Reset() {
+	*x = LocationAck{}
+	mi := &file_locations_v1_locations_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LocationAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocationAck) ProtoMessage() {}
+
+func (x *LocationAck) ProtoReflect() protoreflect.Message {
+	mi := &file_locations_v1_locations_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocationAck.ProtoReflect.Descriptor instead.
+func (*LocationAck) Descriptor() ([]byte, []int) {
+	return file_locations_v1_locations_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LocationAck) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *LocationAck) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *LocationAck) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *LocationAck) GetDistance() float64 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *LocationAck) GetIsMoving() bool {
+	if x != nil {
+		return x.IsMoving
+	}
+	return false
+}
+
+func (x *LocationAck) GetSequenceId() uint64 {
+	if x != nil {
+		return x.SequenceId
+	}
+	return 0
+}
+
+func (x *LocationAck) GetTripId() uint64 {
+	if x != nil {
+		return x.TripId
+	}
+	return 0
+}
+
+func (x *LocationAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_locations_v1_locations_proto protoreflect.FileDescriptor
+
+const file_locations_v1_locations_proto_rawDesc = "" +
+	"\n" +
+	"\x1clocations/v1/locations.proto\x12\x17ma3tracker.locations.v1\"\x84\x02\n" +
+	"\x0eLocationUpdate\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x1b\n" +
+	"\tdriver_id\x18\x02 \x01(\x04R\bdriverId\x12\x1a\n" +
+	"\blatitude\x18\x03 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\x04 \x01(\x01R\tlongitude\x12\x1a\n" +
+	"\baccuracy\x18\x05 \x01(\x01R\baccuracy\x12\x14\n" +
+	"\x05speed\x18\x06 \x01(\x01R\x05speed\x12\x18\n" +
+	"\abearing\x18\a \x01(\x01R\abearing\x12\x1a\n" +
+	"\baltitude\x18\b \x01(\x01R\baltitude\x12!\n" +
+	"\ftimestamp_ms\x18\t \x01(\x03R\vtimestampMs\"\xdf\x01\n" +
+	"\vLocationAck\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x03 \x01(\tR\teventType\x12\x1a\n" +
+	"\bdistance\x18\x04 \x01(\x01R\bdistance\x12\x1b\n" +
+	"\tis_moving\x18\x05 \x01(\bR\bisMoving\x12\x1f\n" +
+	"\vsequence_id\x18\x06 \x01(\x04R\n" +
+	"sequenceId\x12\x17\n" +
+	"\atrip_id\x18\a \x01(\x04R\x06tripId\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error2y\n" +
+	"\x11LocationIngestion\x12d\n" +
+	"\x0fStreamLocations\x12'.ma3tracker.locations.v1.LocationUpdate\x1a$.ma3tracker.locations.v1.LocationAck(\x010\x01B*Z(ma3_tracker/internal/grpcapi/locationsv1b\x06proto3"
+
+var (
+	file_locations_v1_locations_proto_rawDescOnce sync.Once
+	file_locations_v1_locations_proto_rawDescData []byte
+)
+
+func file_locations_v1_locations_proto_rawDescGZIP() []byte {
+	file_locations_v1_locations_proto_rawDescOnce.Do(func() {
+		file_locations_v1_locations_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_locations_v1_locations_proto_rawDesc), len(file_locations_v1_locations_proto_rawDesc)))
+	})
+	return file_locations_v1_locations_proto_rawDescData
+}
+
+var file_locations_v1_locations_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_locations_v1_locations_proto_goTypes = []any{
+	(*LocationUpdate)(nil), // 0: ma3tracker.locations.v1.LocationUpdate
+	(*LocationAck)(nil),    // 1: ma3tracker.locations.v1.LocationAck
+}
+var file_locations_v1_locations_proto_depIdxs = []int32{
+	0, // 0: ma3tracker.locations.v1.LocationIngestion.StreamLocations:input_type -> ma3tracker.locations.v1.LocationUpdate
+	1, // 1: ma3tracker.locations.v1.LocationIngestion.StreamLocations:output_type -> ma3tracker.locations.v1.LocationAck
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_locations_v1_locations_proto_init() }
+func file_locations_v1_locations_proto_init() {
+	if File_locations_v1_locations_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_locations_v1_locations_proto_rawDesc), len(file_locations_v1_locations_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_locations_v1_locations_proto_goTypes,
+		DependencyIndexes: file_locations_v1_locations_proto_depIdxs,
+		MessageInfos:      file_locations_v1_locations_proto_msgTypes,
+	}.Build()
+	File_locations_v1_locations_proto = out.File
+	file_locations_v1_locations_proto_goTypes = nil
+	file_locations_v1_locations_proto_depIdxs = nil
+}
@@ -0,0 +1,71 @@
+// Package headway measures how evenly vehicles on a route are spaced: the
+// time between consecutive arrivals at each stage, from the geofence
+// arrival events (see models.StageEvent).
+package headway
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// MaxHeadway leaves out longer intervals, such as the overnight break in
+	// service, which are not gaps between vehicles in service.
+	MaxHeadway = config.EnvDuration("HEADWAY_MAX", 2*time.Hour)
+	// BunchedRatio and GapRatio flag headways shorter or longer than this
+	// multiple of the stage's median: vehicles running bunched together, or
+	// commuters left waiting.
+	BunchedRatio = config.EnvFloat("HEADWAY_BUNCHED_RATIO", 0.5)
+	GapRatio     = config.EnvFloat("HEADWAY_GAP_RATIO", 2)
+)
+
+// Stats summarizes the headways at one stage of a route, or over all its
+// stages when StageID is nil. CV, the standard deviation over the mean, is 0
+// for perfectly regular service and grows as it gets less even.
+type Stats struct {
+	RouteID    uint     `json:"route_id"`
+	StageID    *uint    `json:"stage_id,omitempty"`
+	Headways   int64    `json:"headways"`
+	MeanS      float64  `json:"mean_s"`
+	MedianS    float64  `json:"median_s"`
+	P90S       float64  `json:"p90_s"`
+	StdDevS    *float64 `json:"stddev_s"`
+	CV         *float64 `json:"cv"`
+	BunchedPct float64  `json:"bunched_pct"`
+	GapPct     float64  `json:"gap_pct"`
+}
+
+// Report computes headways from the arrivals between from and to that match
+// scope, per route and stage and per route overall. Bunching and gaps are
+// judged against each stage's own median.
+func Report(db, scope *gorm.DB, from, to time.Time) ([]Stats, error) {
+	arrivals := db.Model(&models.StageEvent{}).
+		Select("route_id, stage_id, EXTRACT(EPOCH FROM at - LAG(at) OVER (PARTITION BY route_id, stage_id ORDER BY at)) AS headway").
+		Where("kind = ? AND at >= ? AND at < ?", models.StageArrival, from, to).
+		Where(scope)
+	var rows []Stats
+	err := db.Raw(`WITH h AS (
+			SELECT * FROM (?) a WHERE headway > 0 AND headway <= ?
+		), m AS (
+			SELECT route_id, stage_id, percentile_cont(0.5) WITHIN GROUP (ORDER BY headway) AS median
+			FROM h GROUP BY route_id, stage_id
+		)
+		SELECT h.route_id, h.stage_id, COUNT(*) AS headways,
+			AVG(h.headway) AS mean_s,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY h.headway) AS median_s,
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY h.headway) AS p90_s,
+			STDDEV_SAMP(h.headway) AS std_dev_s,
+			STDDEV_SAMP(h.headway) / NULLIF(AVG(h.headway), 0) AS cv,
+			100 * AVG(CASE WHEN h.headway < m.median * ? THEN 1 ELSE 0 END) AS bunched_pct,
+			100 * AVG(CASE WHEN h.headway > m.median * ? THEN 1 ELSE 0 END) AS gap_pct
+		FROM h JOIN m ON m.route_id = h.route_id AND m.stage_id = h.stage_id
+		GROUP BY GROUPING SETS ((h.route_id, h.stage_id), (h.route_id))
+		ORDER BY h.route_id, h.stage_id NULLS FIRST`,
+		arrivals, MaxHeadway.Seconds(), BunchedRatio, GapRatio).
+		Scan(&rows).Error
+	return rows, err
+}
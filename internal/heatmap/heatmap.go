@@ -0,0 +1,192 @@
+// Package heatmap turns point densities into map tiles: PNG images for
+// raster overlays and Mapbox Vector Tiles for client-side styling. Densities
+// are counted on a grid of Cells × Cells cells per tile by the caller.
+package heatmap
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// TileSize is the width and height of a PNG tile in pixels.
+	TileSize = 256
+	// Cells is how many grid cells a tile is divided into along each axis.
+	Cells = 64
+	// Buffer is how many cells around a tile must be counted too, so the
+	// blur of points just outside it reaches in and tiles join seamlessly.
+	Buffer = 3
+
+	cellPixels = TileSize / Cells
+	radius     = Buffer * cellPixels // Blur radius in pixels
+	mvtExtent  = 4096
+)
+
+// MaxZoom is the deepest zoom level tiles are served for.
+const MaxZoom = 20
+
+// ErrInvalidTile is returned for tile coordinates outside the zoom level.
+var ErrInvalidTile = errors.New("invalid tile coordinates")
+
+// Cell is the weight of the points in one grid cell. X and Y count cells
+// from the tile's top-left corner and run from -Buffer to Cells+Buffer-1.
+type Cell struct {
+	X, Y   int
+	Weight float64
+}
+
+// Tile is a z/x/y tile in the Web Mercator scheme used by slippy maps.
+type Tile struct {
+	Z, X, Y int
+}
+
+// Validate checks that the tile exists at its zoom level.
+func (t Tile) Validate() error {
+	if t.Z < 0 || t.Z > MaxZoom {
+		return ErrInvalidTile
+	}
+	n := 1 << t.Z
+	if t.X < 0 || t.X >= n || t.Y < 0 || t.Y >= n {
+		return ErrInvalidTile
+	}
+	return nil
+}
+
+// Bounds returns the tile's extent widened by Buffer cells, as the longitude
+// and latitude ranges points must fall in to be counted.
+func (t Tile) Bounds() (west, south, east, north float64) {
+	pad := float64(Buffer) / Cells
+	x0, x1 := float64(t.X)-pad, float64(t.X+1)+pad
+	y0, y1 := float64(t.Y)-pad, float64(t.Y+1)+pad
+	n := float64(int(1) << t.Z)
+	lng := func(x float64) float64 { return x/n*360 - 180 }
+	lat := func(y float64) float64 { return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi }
+	return lng(x0), lat(y1), lng(x1), lat(y0)
+}
+
+// PNG renders the cells as a heatmap: each cell's weight is blurred over
+// its neighbours and mapped from transparent blue through to red. Density
+// at or above max is drawn fully red; with max <= 0 the densest spot in the
+// tile is, which suits a single tile but makes neighbours' colors disagree.
+func PNG(w io.Writer, cells []Cell, max float64) error {
+	density := make([]float64, TileSize*TileSize)
+	sigma2 := 2 * math.Pow(radius/2.0, 2)
+	for _, c := range cells {
+		cx := float64(c.X*cellPixels) + cellPixels/2.0
+		cy := float64(c.Y*cellPixels) + cellPixels/2.0
+		for py := int(cy) - radius; py <= int(cy)+radius; py++ {
+			if py < 0 || py >= TileSize {
+				continue
+			}
+			for px := int(cx) - radius; px <= int(cx)+radius; px++ {
+				if px < 0 || px >= TileSize {
+					continue
+				}
+				dx, dy := float64(px)+0.5-cx, float64(py)+0.5-cy
+				if d2 := dx*dx + dy*dy; d2 <= radius*radius {
+					density[py*TileSize+px] += c.Weight * math.Exp(-d2/sigma2)
+				}
+			}
+		}
+	}
+	if max <= 0 {
+		for _, d := range density {
+			max = math.Max(max, d)
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, TileSize, TileSize))
+	if max > 0 {
+		for i, d := range density {
+			if d > 0 {
+				img.SetNRGBA(i%TileSize, i/TileSize, ramp(math.Sqrt(math.Min(d/max, 1))))
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// gradient is the color ramp from sparse to dense.
+var gradient = []color.NRGBA{
+	{0, 0, 255, 0},
+	{0, 160, 255, 140},
+	{0, 220, 90, 170},
+	{255, 230, 0, 200},
+	{255, 0, 0, 230},
+}
+
+// ramp interpolates the gradient at v in [0, 1].
+func ramp(v float64) color.NRGBA {
+	pos := v * float64(len(gradient)-1)
+	i := int(pos)
+	if i >= len(gradient)-1 {
+		return gradient[len(gradient)-1]
+	}
+	t := pos - float64(i)
+	a, b := gradient[i], gradient[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5) }
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// MVT encodes the cells inside the tile as a Mapbox Vector Tile with one
+// layer of points at the cell centres, each with a "weight" property.
+func MVT(cells []Cell, layer string) []byte {
+	var features, values []byte
+	valueIndex := map[float64]uint64{}
+	var id uint64
+	for _, c := range cells {
+		if c.X < 0 || c.X >= Cells || c.Y < 0 || c.Y >= Cells {
+			continue
+		}
+		v, ok := valueIndex[c.Weight]
+		if !ok {
+			v = uint64(len(valueIndex))
+			valueIndex[c.Weight] = v
+			var value []byte
+			value = protowire.AppendTag(value, 3, protowire.Fixed64Type) // double_value
+			value = protowire.AppendFixed64(value, math.Float64bits(c.Weight))
+			values = protowire.AppendTag(values, 4, protowire.BytesType)
+			values = protowire.AppendBytes(values, value)
+		}
+		id++
+		x := (2*c.X + 1) * mvtExtent / Cells / 2
+		y := (2*c.Y + 1) * mvtExtent / Cells / 2
+		var geometry []byte
+		geometry = protowire.AppendVarint(geometry, 1|1<<3) // MoveTo, one point
+		geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(int64(x)))
+		geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(int64(y)))
+
+		var feature []byte
+		feature = protowire.AppendTag(feature, 1, protowire.VarintType) // id
+		feature = protowire.AppendVarint(feature, id)
+		feature = protowire.AppendTag(feature, 2, protowire.BytesType) // tags: key 0, value v
+		feature = protowire.AppendBytes(feature, protowire.AppendVarint(protowire.AppendVarint(nil, 0), v))
+		feature = protowire.AppendTag(feature, 3, protowire.VarintType) // type POINT
+		feature = protowire.AppendVarint(feature, 1)
+		feature = protowire.AppendTag(feature, 4, protowire.BytesType) // geometry
+		feature = protowire.AppendBytes(feature, geometry)
+		features = protowire.AppendTag(features, 2, protowire.BytesType)
+		features = protowire.AppendBytes(features, feature)
+	}
+
+	var l []byte
+	l = protowire.AppendTag(l, 15, protowire.VarintType) // version
+	l = protowire.AppendVarint(l, 2)
+	l = protowire.AppendTag(l, 1, protowire.BytesType) // name
+	l = protowire.AppendString(l, layer)
+	l = append(l, features...)
+	l = protowire.AppendTag(l, 3, protowire.BytesType) // keys
+	l = protowire.AppendString(l, "weight")
+	l = append(l, values...)
+	l = protowire.AppendTag(l, 5, protowire.VarintType) // extent
+	l = protowire.AppendVarint(l, mvtExtent)
+
+	tile := protowire.AppendTag(nil, 3, protowire.BytesType) // layers
+	return protowire.AppendBytes(tile, l)
+}
@@ -0,0 +1,174 @@
+// Package i18n translates API error and status messages into the languages
+// the apps are used in.
+//
+// Each message has a stable, machine-readable code. The catalogs in locales/
+// map codes to text, one file per language; en.json lists every code and the
+// other languages fall back to English for codes they lack. A text may end in
+// %s, standing for detail the server appends (e.g. "Invalid input: %s").
+//
+// Controllers still write English text, so messages are also looked up by
+// their English wording, ignoring case.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported languages.
+const (
+	English = "en"
+	Swahili = "sw"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalogs maps a language to its code -> text catalog.
+var catalogs = map[string]map[string]string{}
+
+// byText maps lower-cased English texts without a detail to their codes.
+var byText = map[string]string{}
+
+// prefix is an English text ending in detail.
+type prefix struct {
+	text string // Lower-cased, up to where the detail starts
+	code string
+}
+
+// prefixes are the English texts that take a detail, longest first so the
+// most specific one matches.
+var prefixes []prefix
+
+func init() {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		raw, err := locales.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(raw, &catalog); err != nil {
+			panic("i18n: invalid catalog " + f.Name() + ": " + err.Error())
+		}
+		catalogs[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = catalog
+	}
+	for code, text := range catalogs[English] {
+		text = strings.ToLower(text)
+		if strings.HasSuffix(text, "%s") {
+			prefixes = append(prefixes, prefix{strings.TrimSuffix(text, "%s"), code})
+		} else {
+			byText[text] = code
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i].text) > len(prefixes[j].text) })
+}
+
+// Supported reports whether lang has a catalog.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Negotiate picks the supported language the client prefers most from an
+// Accept-Language header, e.g. "sw-KE,sw;q=0.9,en;q=0.8", or English.
+func Negotiate(header string) string {
+	best, bestQ := English, 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		lang = strings.SplitN(lang, "-", 2)[0]
+		if !Supported(lang) {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// Text returns the message for code in lang, falling back to English, with
+// detail in place of %s. It returns false for unknown codes.
+func Text(lang, code, detail string) (string, bool) {
+	text, ok := catalogs[lang][code]
+	if !ok {
+		if text, ok = catalogs[English][code]; !ok {
+			return "", false
+		}
+	}
+	return strings.Replace(text, "%s", detail, 1), true
+}
+
+// Identify finds the code of an English message as the controllers write it,
+// and the detail appended to it, if any.
+func Identify(message string) (code, detail string, ok bool) {
+	lower := strings.ToLower(message)
+	if code, ok := byText[lower]; ok {
+		return code, "", true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(lower, p.text) {
+			return p.code, message[len(p.text):], true
+		}
+	}
+	return "", "", false
+}
+
+// Localize translates an English message into lang and returns its code. A
+// message not in the catalog comes back as is, with ok false.
+func Localize(lang, message string) (code, text string, ok bool) {
+	code, detail, ok := Identify(message)
+	if !ok {
+		return "", message, false
+	}
+	text, _ = Text(lang, code, detail)
+	return code, text, true
+}
+
+// StatusCode is the code given to errors that have none of their own.
+func StatusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return "payload_too_large"
+	case http.StatusUnsupportedMediaType:
+		return "unsupported_media_type"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable"
+	case http.StatusTooManyRequests:
+		return "too_many_requests"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
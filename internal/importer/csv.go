@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ma3_tracker/internal/geo"
+)
+
+// Recognised CSV header names for each column.
+var csvColumns = map[string][]string{
+	"route": {"route", "route_name", "corridor"},
+	"name":  {"stage", "stage_name", "stop", "stop_name", "name"},
+	"seq":   {"seq", "sequence", "order", "stop_sequence"},
+	"lat":   {"lat", "latitude", "stop_lat"},
+	"lng":   {"lng", "lon", "long", "longitude", "stop_lon"},
+}
+
+// ParseCSV reads a stop list with a header row. Each distinct route column
+// value becomes a route (one unnamed route when the column is absent) whose
+// geometry joins its stops in sequence order.
+func ParseCSV(r io.Reader, defaultRouteName string) (Result, error) {
+	res := Result{Source: "csv"}
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return res, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		for key, names := range csvColumns {
+			for _, n := range names {
+				if h == n {
+					if _, dup := cols[key]; !dup {
+						cols[key] = i
+					}
+				}
+			}
+		}
+	}
+	if _, ok := cols["lat"]; !ok {
+		return res, errors.New("CSV must have a lat/latitude column")
+	}
+	if _, ok := cols["lng"]; !ok {
+		return res, errors.New("CSV must have a lng/lon/longitude column")
+	}
+
+	field := func(rec []string, key string) string {
+		if i, ok := cols[key]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	type row struct {
+		stage Stage
+		line  int
+	}
+	byRoute := make(map[string][]row)
+	var order []string
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+		lat, errLat := strconv.ParseFloat(field(rec, "lat"), 64)
+		lng, errLng := strconv.ParseFloat(field(rec, "lng"), 64)
+		if errLat != nil || errLng != nil || !validCoordinate(lat, lng) {
+			res.warnf("line %d has an invalid coordinate and was skipped", line)
+			continue
+		}
+		seq, err := strconv.Atoi(field(rec, "seq"))
+		if err != nil {
+			seq = line // Keep file order when no sequence is given
+		}
+		name := field(rec, "name")
+		if name == "" {
+			name = fmt.Sprintf("Stage %d", line-1)
+		}
+		routeName := field(rec, "route")
+		if routeName == "" {
+			routeName = defaultRouteName
+		}
+		if _, seen := byRoute[routeName]; !seen {
+			order = append(order, routeName)
+		}
+		byRoute[routeName] = append(byRoute[routeName], row{Stage{Name: name, Seq: seq, Lat: lat, Lng: lng}, line})
+	}
+
+	for _, name := range order {
+		rows := byRoute[name]
+		sort.SliceStable(rows, func(a, b int) bool { return rows[a].stage.Seq < rows[b].stage.Seq })
+		if len(rows) < 2 {
+			res.warnf("route %q has fewer than two stops and was skipped", name)
+			continue
+		}
+		route := Route{Name: name}
+		for i, r := range rows {
+			r.stage.Seq = i + 1
+			route.Stages = append(route.Stages, r.stage)
+			route.Line = append(route.Line, geo.Point{Lat: r.stage.Lat, Lng: r.stage.Lng})
+		}
+		route.LengthM = geo.Length(route.Line)
+		res.Routes = append(res.Routes, route)
+	}
+	if len(res.Routes) == 0 {
+		return res, ErrNoRoutes
+	}
+	res.warnf("CSV geometries join stops with straight lines; redraw them before publishing")
+	return res, nil
+}
@@ -0,0 +1,123 @@
+// Package importer converts corridor data supplied by county transport
+// departments (zipped shapefiles or CSV stop lists) into routes and stages.
+// Parsing produces a preview; Commit writes a confirmed preview as draft routes.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/stops"
+)
+
+// MaxStageDistance is how far a shapefile stop point may be from a corridor
+// to be attached to it as a stage. It shares the stage validation limit.
+var MaxStageDistance = config.EnvFloat("STAGE_MAX_OFFSET_METERS", 150)
+
+// ErrNoRoutes is returned when a file contains nothing that can become a route.
+var ErrNoRoutes = errors.New("no routes found in file")
+
+// Stage is a stop along an imported route.
+type Stage struct {
+	Name string  `json:"name"`
+	Seq  int     `json:"seq"`
+	Lat  float64 `json:"lat"`
+	Lng  float64 `json:"lng"`
+}
+
+// Route is one corridor ready to be created.
+type Route struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Line        []geo.Point `json:"line"`
+	LengthM     float64     `json:"length_m"`
+	Stages      []Stage     `json:"stages"`
+}
+
+// Result is the preview produced by parsing an upload.
+type Result struct {
+	Source   string   `json:"source"` // "shapefile" or "csv"
+	Routes   []Route  `json:"routes"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (r *Result) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+func validCoordinate(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && !(lat == 0 && lng == 0)
+}
+
+// attachStages assigns stop points to the nearest route within
+// MaxStageDistance and orders each route's stages along its line.
+func attachStages(res *Result, points []Stage) {
+	type located struct {
+		stage Stage
+		along float64
+	}
+	perRoute := make([][]located, len(res.Routes))
+	for _, p := range points {
+		best, bestDist, bestAlong := -1, MaxStageDistance, 0.0
+		for i, r := range res.Routes {
+			along, dist := geo.LocateOnLine(geo.Point{Lat: p.Lat, Lng: p.Lng}, r.Line)
+			if dist <= bestDist {
+				best, bestDist, bestAlong = i, dist, along
+			}
+		}
+		if best < 0 {
+			res.warnf("stop %q is more than %.0f m from every corridor and was skipped", p.Name, MaxStageDistance)
+			continue
+		}
+		perRoute[best] = append(perRoute[best], located{p, bestAlong})
+	}
+	for i, stages := range perRoute {
+		sort.SliceStable(stages, func(a, b int) bool { return stages[a].along < stages[b].along })
+		for seq, s := range stages {
+			s.stage.Seq = seq + 1
+			res.Routes[i].Stages = append(res.Routes[i].Stages, s.stage)
+		}
+	}
+}
+
+// Commit creates the given routes for a sacco as drafts, linking their stages
+// to shared stops. It returns the new route IDs.
+func Commit(tx *gorm.DB, saccoID uint, routes []Route) ([]uint, error) {
+	ids := make([]uint, 0, len(routes))
+	for _, r := range routes {
+		wkbGeom, err := geo.LineToWKB(r.Line)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", r.Name, err)
+		}
+		route := models.Route{
+			Name:        r.Name,
+			Description: r.Description,
+			SaccoID:     saccoID,
+			Geometry:    wkbGeom,
+			Status:      models.RouteStatusDraft,
+		}
+		if err := tx.Create(&route).Error; err != nil {
+			return nil, fmt.Errorf("route %q: %w", r.Name, err)
+		}
+		if len(r.Stages) > 0 {
+			stages := make([]models.Stage, 0, len(r.Stages))
+			for _, s := range r.Stages {
+				stages = append(stages, models.Stage{Name: s.Name, Seq: s.Seq, Lat: s.Lat, Lng: s.Lng, RouteID: route.ID})
+			}
+			if err := stops.Link(tx, stages); err != nil {
+				return nil, fmt.Errorf("route %q: %w", r.Name, err)
+			}
+			if err := tx.Create(&stages).Error; err != nil {
+				return nil, fmt.Errorf("route %q: %w", r.Name, err)
+			}
+		}
+		ids = append(ids, route.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,202 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/jonas-p/go-shp"
+
+	"ma3_tracker/internal/geo"
+)
+
+// nameFields are DBF columns checked, in order, for a feature's name.
+var nameFields = []string{"NAME", "ROUTE_NAME", "ROUTE", "RT_NAME", "STAGE", "STOP_NAME", "LABEL"}
+
+// maxShapefileMemberBytes bounds how much a .shp or .dbf member of the
+// archive may inflate to, so a small zip cannot expand into gigabytes.
+const maxShapefileMemberBytes = 64 << 20
+
+// ParseShapefileZip reads every shapefile in a zip archive. Line features
+// become routes and point features become stages of the nearest route.
+// Coordinates must be geographic (WGS84); projected data is rejected.
+func ParseShapefileZip(data []byte) (Result, error) {
+	res := Result{Source: "shapefile"}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return res, fmt.Errorf("not a valid zip archive: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	var shapes []string
+	for _, f := range zr.File {
+		lower := strings.ToLower(f.Name)
+		files[lower] = f
+		if strings.HasSuffix(lower, ".shp") && !strings.HasPrefix(path.Base(lower), "._") {
+			shapes = append(shapes, lower)
+		}
+	}
+	if len(shapes) == 0 {
+		return res, errors.New("archive does not contain a .shp file")
+	}
+
+	var points []Stage
+	for _, name := range shapes {
+		base := strings.TrimSuffix(name, ".shp")
+		if prj, ok := files[base+".prj"]; ok {
+			if wkt, err := readZipFile(prj); err == nil && strings.HasPrefix(strings.TrimSpace(strings.ToUpper(wkt)), "PROJCS") {
+				return res, fmt.Errorf("%s uses a projected coordinate system; re-export it in WGS84 (EPSG:4326)", path.Base(name))
+			}
+		} else {
+			res.warnf("%s has no .prj file; coordinates are assumed to be WGS84", path.Base(name))
+		}
+		if err := readShapefile(&res, &points, files[name], files[base+".dbf"]); err != nil {
+			return res, fmt.Errorf("%s: %w", path.Base(name), err)
+		}
+	}
+	if len(res.Routes) == 0 {
+		return res, ErrNoRoutes
+	}
+	attachStages(&res, points)
+	return res, nil
+}
+
+func readShapefile(res *Result, points *[]Stage, shpFile, dbfFile *zip.File) error {
+	if dbfFile == nil {
+		return errors.New("missing .dbf attribute file")
+	}
+	shpReader, err := openZipMember(shpFile)
+	if err != nil {
+		return err
+	}
+	dbfReader, err := openZipMember(dbfFile)
+	if err != nil {
+		shpReader.Close()
+		return err
+	}
+	sr := shp.SequentialReaderFromExt(shpReader, dbfReader)
+	defer sr.Close()
+
+	fields := sr.Fields()
+	featureName := func(fallback string) string {
+		for _, want := range nameFields {
+			for i, f := range fields {
+				if strings.EqualFold(f.String(), want) {
+					if v := strings.Trim(sr.Attribute(i), " \x00"); v != "" {
+						return v
+					}
+				}
+			}
+		}
+		return fallback
+	}
+
+	for sr.Next() {
+		n, shape := sr.Shape()
+		switch s := shape.(type) {
+		case *shp.PolyLine:
+			addLines(res, featureName(fmt.Sprintf("Corridor %d", n+1)), s.Parts, s.Points)
+		case *shp.PolyLineZ:
+			addLines(res, featureName(fmt.Sprintf("Corridor %d", n+1)), s.Parts, s.Points)
+		case *shp.PolyLineM:
+			addLines(res, featureName(fmt.Sprintf("Corridor %d", n+1)), s.Parts, s.Points)
+		case *shp.Point:
+			addPoint(res, points, featureName(fmt.Sprintf("Stop %d", n+1)), *s)
+		case *shp.PointZ:
+			addPoint(res, points, featureName(fmt.Sprintf("Stop %d", n+1)), shp.Point{X: s.X, Y: s.Y})
+		case *shp.PointM:
+			addPoint(res, points, featureName(fmt.Sprintf("Stop %d", n+1)), shp.Point{X: s.X, Y: s.Y})
+		case *shp.Null:
+			// Null shapes carry no geometry.
+		default:
+			res.warnf("feature %d has unsupported shape type %T and was skipped", n+1, shape)
+		}
+	}
+	return sr.Err()
+}
+
+// addLines adds each part of a line feature as a route of its own. The parts
+// of a multi-part feature are separate pieces of line, often far apart;
+// joined up they would become a corridor with straight jumps between them.
+func addLines(res *Result, name string, parts []int32, pts []shp.Point) {
+	split := splitParts(parts, pts)
+	if len(split) > 1 {
+		res.warnf("corridor %q has %d parts; each was imported as a route of its own", name, len(split))
+	}
+	for i, part := range split {
+		partName := name
+		if len(split) > 1 {
+			partName = fmt.Sprintf("%s (part %d)", name, i+1)
+		}
+		addLine(res, partName, part)
+	}
+}
+
+// splitParts cuts a feature's points at the start index of each part.
+// Indexes that are out of order or out of range are ignored.
+func splitParts(parts []int32, pts []shp.Point) [][]shp.Point {
+	var out [][]shp.Point
+	start := 0
+	for _, p := range parts {
+		end := int(p)
+		if end <= start || end > len(pts) {
+			continue
+		}
+		out = append(out, pts[start:end])
+		start = end
+	}
+	return append(out, pts[start:])
+}
+
+func addLine(res *Result, name string, pts []shp.Point) {
+	line := make([]geo.Point, 0, len(pts))
+	for _, p := range pts {
+		if !validCoordinate(p.Y, p.X) {
+			res.warnf("corridor %q has coordinates outside WGS84 range and was skipped", name)
+			return
+		}
+		line = append(line, geo.Point{Lat: p.Y, Lng: p.X})
+	}
+	if len(line) < 2 {
+		res.warnf("corridor %q has fewer than two points and was skipped", name)
+		return
+	}
+	res.Routes = append(res.Routes, Route{Name: name, Line: line, LengthM: geo.Length(line)})
+}
+
+func addPoint(res *Result, points *[]Stage, name string, p shp.Point) {
+	if !validCoordinate(p.Y, p.X) {
+		res.warnf("stop %q has coordinates outside WGS84 range and was skipped", name)
+		return
+	}
+	*points = append(*points, Stage{Name: name, Lat: p.Y, Lng: p.X})
+}
+
+// openZipMember opens a shapefile member of the archive, reading at most
+// maxShapefileMemberBytes of it.
+func openZipMember(f *zip.File) (io.ReadCloser, error) {
+	if f.UncompressedSize64 > maxShapefileMemberBytes {
+		return nil, fmt.Errorf("%s is larger than %d MiB uncompressed", path.Base(f.Name), maxShapefileMemberBytes>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, maxShapefileMemberBytes), rc}, nil
+}
+
+func readZipFile(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, 64<<10))
+	return string(b), err
+}
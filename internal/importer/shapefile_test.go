@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonas-p/go-shp"
+)
+
+// zipShapefile writes lines as a polyline shapefile named corridors and
+// returns it zipped.
+func zipShapefile(t *testing.T, lines map[string][][]shp.Point) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	w, err := shp.Create(filepath.Join(dir, "corridors.shp"), shp.POLYLINE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetFields([]shp.Field{shp.StringField("NAME", 50)})
+	for name, parts := range lines {
+		n := w.Write(shp.NewPolyLine(parts))
+		w.WriteAttribute(int(n), 0, name)
+	}
+	w.Close()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// go-shp's writer names the attribute file "corridorsdbf"
+	for ext, written := range map[string]string{".shp": ".shp", ".shx": ".shx", ".dbf": "dbf"} {
+		data, err := os.ReadFile(filepath.Join(dir, "corridors"+written))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, _ := zw.Create("corridors" + ext)
+		f.Write(data)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestShapefileMultiPartLine(t *testing.T) {
+	data := zipShapefile(t, map[string][][]shp.Point{
+		"Thika Road": {
+			{{X: 36.82, Y: -1.28}, {X: 36.83, Y: -1.27}},
+			{{X: 36.90, Y: -1.20}, {X: 36.91, Y: -1.19}, {X: 36.92, Y: -1.18}},
+		},
+	})
+	res, err := ParseShapefileZip(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Routes) != 2 {
+		t.Fatalf("%d routes; want one per part", len(res.Routes))
+	}
+	if res.Routes[0].Name != "Thika Road (part 1)" || len(res.Routes[0].Line) != 2 || len(res.Routes[1].Line) != 3 {
+		t.Errorf("routes %+v; want the parts kept apart", res.Routes)
+	}
+}
+
+func TestShapefileMemberTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("big.shp")
+	chunk := make([]byte, 1<<20) // Zeros compress to almost nothing
+	for i := 0; i <= maxShapefileMemberBytes>>20; i++ {
+		f.Write(chunk)
+	}
+	zw.Create("big.dbf")
+	zw.Close()
+	if _, err := ParseShapefileZip(buf.Bytes()); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("err = %v; want the member refused", err)
+	}
+}
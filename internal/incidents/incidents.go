@@ -0,0 +1,287 @@
+// Package incidents detects road incidents from the live GPS stream. Clusters
+// of harsh braking become hazards and vehicles crawling away from any stage
+// become congestion. Only aggregate counts are kept so incidents can be shared
+// outside the platform once an admin verifies them.
+package incidents
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// Window is how far back each detection pass looks.
+	Window = config.EnvDuration("INCIDENT_WINDOW", 30*time.Minute)
+	// CellSize is the side of the grid cells events are clustered in, and the
+	// radius within which a new cluster is merged into an open incident.
+	CellSize = config.EnvFloat("INCIDENT_CELL_METERS", 300)
+	// MinVehicles is how many distinct vehicles must agree before an incident is raised.
+	MinVehicles = config.EnvInt("INCIDENT_MIN_VEHICLES", 3)
+	// CrawlSpeed is the speed below which a vehicle counts as stuck in traffic.
+	CrawlSpeed = config.EnvFloat("INCIDENT_CRAWL_SPEED_MPS", 2)
+	// ResolveAfter closes detected incidents that have not been seen for this long.
+	ResolveAfter = config.EnvDuration("INCIDENT_RESOLVE_AFTER", time.Hour)
+	// minSlowPoints is how many crawling fixes a vehicle needs in a cell to
+	// count, so a single stop at a junction is ignored.
+	minSlowPoints = 3
+	// metersPerDegree is the length of one degree of latitude.
+	metersPerDegree = 111320.0
+)
+
+// Detected reports whether kind is raised by the detector rather than by admins.
+func Detected(kind string) bool {
+	return kind == models.IncidentHazard || kind == models.IncidentCongestion
+}
+
+// cluster accumulates the events that fell into one grid cell.
+type cluster struct {
+	kind     string
+	sumLat   float64
+	sumLng   float64
+	events   int
+	vehicles map[uint]int // Vehicle ID to the number of events it contributed
+}
+
+func (c *cluster) center() geo.Point {
+	return geo.Point{Lat: c.sumLat / float64(c.events), Lng: c.sumLng / float64(c.events)}
+}
+
+type cellKey struct {
+	kind     string
+	row, col int64
+}
+
+// cellOf returns the grid cell containing p.
+func cellOf(kind string, p geo.Point) cellKey {
+	latStep := CellSize / metersPerDegree
+	lngStep := CellSize / (metersPerDegree * math.Cos(p.Lat*math.Pi/180))
+	return cellKey{kind: kind, row: int64(math.Floor(p.Lat / latStep)), col: int64(math.Floor(p.Lng / lngStep))}
+}
+
+func add(cells map[cellKey]*cluster, kind string, p geo.Point, vehicleID uint) {
+	key := cellOf(kind, p)
+	c, ok := cells[key]
+	if !ok {
+		c = &cluster{kind: kind, vehicles: make(map[uint]int)}
+		cells[key] = c
+	}
+	c.sumLat += p.Lat
+	c.sumLng += p.Lng
+	c.events++
+	c.vehicles[vehicleID]++
+}
+
+// Severity grades an incident by how many vehicles reported it.
+func Severity(vehicles int) string {
+	switch {
+	case vehicles >= 3*MinVehicles:
+		return models.SeverityHigh
+	case vehicles >= 2*MinVehicles:
+		return models.SeverityMedium
+	default:
+		return models.SeverityLow
+	}
+}
+
+// AffectedRoutes returns the published routes passing within radius meters of p.
+func AffectedRoutes(db *gorm.DB, p geo.Point, radius float64) ([]models.Route, error) {
+	var routes []models.Route
+	err := db.Select("id", "name").
+		Where("status = ? AND geometry IS NOT NULL", models.RouteStatusPublished).
+		Where("ST_DWithin(ST_SetSRID(geometry::geometry, 4326)::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)", p.Lng, p.Lat, radius).
+		Find(&routes).Error
+	return routes, err
+}
+
+// collect clusters the harsh braking and crawling fixes recorded since since.
+// Rows are streamed rather than loaded, since a busy window holds far more
+// fixes than clusters.
+func collect(db *gorm.DB, since time.Time) (map[cellKey]*cluster, error) {
+	cells := make(map[cellKey]*cluster)
+
+	// Events recorded before vehicles were kept on them cannot be counted
+	// by vehicle, so they are left out.
+	events := db.Model(&models.DrivingEvent{}).Select("vehicle_id", "latitude", "longitude").
+		Where("kind = ? AND occurred_at > ? AND vehicle_id <> 0", models.DrivingEventHarshBraking, since)
+	err := eachFix(events, func(vehicleID uint, p geo.Point) {
+		add(cells, models.IncidentHazard, p, vehicleID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Vehicles wait at stages as a matter of course, so cells holding a stage
+	// are left out of congestion detection.
+	var stages []models.Stage
+	if err := db.Select("lat", "lng").Find(&stages).Error; err != nil {
+		return nil, err
+	}
+	stageCells := make(map[cellKey]bool, len(stages))
+	for _, s := range stages {
+		stageCells[cellOf(models.IncidentCongestion, geo.Point{Lat: s.Lat, Lng: s.Lng})] = true
+	}
+
+	points := db.Model(&models.LocationHistory{}).Select("vehicle_id", "latitude", "longitude").
+		Where("timestamp > ? AND speed < ? AND vehicle_id <> 0", since, CrawlSpeed)
+	err = eachFix(points, func(vehicleID uint, p geo.Point) {
+		if !stageCells[cellOf(models.IncidentCongestion, p)] {
+			add(cells, models.IncidentCongestion, p, vehicleID)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cells {
+		if c.kind != models.IncidentCongestion {
+			continue
+		}
+		for id, n := range c.vehicles {
+			if n < minSlowPoints {
+				delete(c.vehicles, id)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// eachFix streams the vehicle_id, latitude and longitude selected by query
+// into fn one row at a time.
+func eachFix(query *gorm.DB, fn func(vehicleID uint, p geo.Point)) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var vehicleID uint
+		var p geo.Point
+		if err := rows.Scan(&vehicleID, &p.Lat, &p.Lng); err != nil {
+			return err
+		}
+		fn(vehicleID, p)
+	}
+	return rows.Err()
+}
+
+// Detect runs one detection pass: clusters seen by enough vehicles refresh a
+// nearby open incident of the same kind or raise a new one, and detected
+// incidents that have gone quiet are resolved. It returns the number of new
+// incidents.
+func Detect(db *gorm.DB, now time.Time) (int, error) {
+	cells, err := collect(db, now.Add(-Window))
+	if err != nil {
+		return 0, err
+	}
+
+	// Dismissed incidents stay open until they go quiet so the same cluster
+	// is not raised again straight after an admin dismissed it.
+	var open []models.Incident
+	if err := db.Where("resolved_at IS NULL AND kind IN ?", []string{models.IncidentHazard, models.IncidentCongestion}).Find(&open).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, c := range cells {
+		if len(c.vehicles) < MinVehicles {
+			continue
+		}
+		center := c.center()
+		if existing := nearest(open, c.kind, center); existing != nil {
+			updates := map[string]interface{}{
+				"last_seen_at":  now,
+				"vehicle_count": len(c.vehicles),
+				"event_count":   c.events,
+				"severity":      Severity(len(c.vehicles)),
+			}
+			if err := db.Model(existing).Updates(updates).Error; err != nil {
+				return created, err
+			}
+			continue
+		}
+
+		incident := models.Incident{
+			Kind:         c.kind,
+			Severity:     Severity(len(c.vehicles)),
+			Status:       models.IncidentDetected,
+			Title:        title(c.kind, len(c.vehicles)),
+			Latitude:     center.Lat,
+			Longitude:    center.Lng,
+			RadiusM:      CellSize,
+			VehicleCount: len(c.vehicles),
+			EventCount:   c.events,
+			StartedAt:    now,
+			LastSeenAt:   now,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&incident).Error; err != nil {
+				return err
+			}
+			routes, err := AffectedRoutes(tx, center, CellSize)
+			if err != nil || len(routes) == 0 {
+				return err
+			}
+			return tx.Model(&incident).Association("Routes").Replace(routes)
+		})
+		if err != nil {
+			return created, err
+		}
+		open = append(open, incident)
+		created++
+	}
+
+	res := db.Model(&models.Incident{}).
+		Where("resolved_at IS NULL AND kind IN ? AND last_seen_at < ?", []string{models.IncidentHazard, models.IncidentCongestion}, now.Add(-ResolveAfter)).
+		Update("resolved_at", now)
+	if res.Error != nil {
+		return created, res.Error
+	}
+	if res.RowsAffected > 0 {
+		logrus.Infof("incidents: Resolved %d incidents that have not been seen for %s.", res.RowsAffected, ResolveAfter)
+	}
+	return created, nil
+}
+
+// nearest returns the open incident of kind closest to p within CellSize.
+func nearest(open []models.Incident, kind string, p geo.Point) *models.Incident {
+	var best *models.Incident
+	bestDist := CellSize
+	for i := range open {
+		if open[i].Kind != kind {
+			continue
+		}
+		d := geo.Haversine(p, geo.Point{Lat: open[i].Latitude, Lng: open[i].Longitude})
+		if d <= bestDist {
+			best, bestDist = &open[i], d
+		}
+	}
+	return best
+}
+
+func title(kind string, vehicles int) string {
+	if kind == models.IncidentHazard {
+		return fmt.Sprintf("Possible road hazard: %d vehicles braked hard here", vehicles)
+	}
+	return fmt.Sprintf("Slow traffic: %d vehicles crawling", vehicles)
+}
+
+// StartDetection periodically runs Detect against the live database.
+func StartDetection(interval time.Duration) {
+	background.Every(interval, func(context.Context) {
+		n, err := Detect(config.DB, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("incidents: Detection pass failed.")
+		} else if n > 0 {
+			logrus.Infof("incidents: Raised %d new incidents for review.", n)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package incidents
+
+import (
+	"testing"
+	"time"
+
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// Clusters count vehicles, so a tracker that is not yet attributed to a
+// driver still counts, and one driver braking in several vehicles does not
+// pass for several.
+func TestCollectCountsVehicles(t *testing.T) {
+	db := testdb.Open(t, &models.DrivingEvent{}, &models.Stage{}, &models.LocationHistory{})
+	now := time.Now()
+	hazard := geo.Point{Lat: -1.30, Lng: 36.80}
+	crawl := geo.Point{Lat: -1.35, Lng: 36.85}
+	for v := uint(1); v <= 3; v++ {
+		db.Create(&models.DrivingEvent{DriverID: 7, VehicleID: v, Kind: models.DrivingEventHarshBraking, Latitude: hazard.Lat, Longitude: hazard.Lng, OccurredAt: now})
+		for i := 0; i < minSlowPoints; i++ {
+			db.Create(&models.LocationHistory{VehicleID: v, Latitude: crawl.Lat, Longitude: crawl.Lng, Speed: 0.5, Timestamp: now})
+		}
+	}
+	// An event from before vehicles were recorded is left out.
+	db.Create(&models.DrivingEvent{DriverID: 8, Kind: models.DrivingEventHarshBraking, Latitude: hazard.Lat, Longitude: hazard.Lng, OccurredAt: now})
+
+	cells, err := collect(db, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind, p := range map[string]geo.Point{models.IncidentHazard: hazard, models.IncidentCongestion: crawl} {
+		c := cells[cellOf(kind, p)]
+		if c == nil || len(c.vehicles) != 3 {
+			t.Errorf("%s cluster = %+v; want 3 vehicles", kind, c)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package jobs runs background work queued in the database. Work is queued
+// with Enqueue, inside the transaction that creates what it works on when
+// there is one, and picked up by the workers Start launches on any replica.
+// A worker claims a job with SELECT ... FOR UPDATE SKIP LOCKED and holds it
+// under a lease it renews while the job runs, so a job whose worker died is
+// picked up again once the lease lapses. Failed attempts are retried with
+// exponential backoff until the job's MaxAttempts is reached.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+)
+
+// DefaultMaxAttempts is how many times a job is tried when its kind was
+// registered without a limit.
+const DefaultMaxAttempts = 5
+
+// Handler does the work of one job. ctx is cancelled when the server shuts
+// down before the job finishes, in which case the job is queued again.
+// Returning an error retries the job later, unless it is Permanent.
+type Handler func(ctx context.Context, job *models.Job) error
+
+type kindInfo struct {
+	handler     Handler
+	maxAttempts int
+}
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = map[string]kindInfo{}
+)
+
+// Register sets the handler for jobs of kind, tried up to maxAttempts times
+// (DefaultMaxAttempts when 0). Packages register their kinds at init, so
+// every server and worker knows them before Start; workers only claim kinds
+// they know.
+func Register(kind string, maxAttempts int, h Handler) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	if _, dup := kinds[kind]; dup {
+		panic("jobs: kind registered twice: " + kind)
+	}
+	kinds[kind] = kindInfo{handler: h, maxAttempts: maxAttempts}
+}
+
+func lookup(kind string) (kindInfo, bool) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	k, ok := kinds[kind]
+	return k, ok
+}
+
+// Kinds returns the registered job kinds, sorted.
+func Kinds() []string {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	out := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		out = append(out, kind)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Options describe who a job is for and when it may run.
+type Options struct {
+	UserID  uint
+	SaccoID uint
+	RunAt   time.Time // Zero runs it as soon as a worker is free
+}
+
+// Enqueue queues a job of kind with payload, encoded as JSON, using db so it
+// can be part of a caller's transaction. Workers cannot see a job queued in a
+// transaction until it commits, so the caller then calls Wake.
+func Enqueue(db *gorm.DB, kind string, payload interface{}, opts Options) (models.Job, error) {
+	k, ok := lookup(kind)
+	if !ok {
+		return models.Job{}, fmt.Errorf("jobs: unknown kind %q", kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("jobs: encoding %s payload: %w", kind, err)
+	}
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	job := models.Job{
+		Kind:        kind,
+		Payload:     data,
+		UserID:      opts.UserID,
+		SaccoID:     opts.SaccoID,
+		Status:      models.JobQueued,
+		RunAt:       runAt,
+		MaxAttempts: k.maxAttempts,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return job, err
+	}
+	Wake(db)
+	return job, nil
+}
+
+// Decode unmarshals the job's payload into v.
+func Decode(job *models.Job, v interface{}) error {
+	return json.Unmarshal(job.Payload, v)
+}
+
+// LastAttempt reports whether a failure of the running attempt is final, so
+// handlers can record the failure on what they work on.
+func LastAttempt(job *models.Job) bool {
+	return job.Attempts >= job.MaxAttempts
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the job fails straight away.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,283 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// Lease is how long a claimed job is held before another worker may
+	// take it over; running workers renew it every third of the lease.
+	Lease = config.EnvDuration("JOB_LEASE", 5*time.Minute)
+	// RetryBackoff is the wait before a failed job's second attempt. It
+	// doubles with every further attempt, up to maxBackoff.
+	RetryBackoff = config.EnvDuration("JOB_RETRY_BACKOFF", 30*time.Second)
+)
+
+const (
+	maxBackoff = time.Hour
+	// cancelGrace is how long Shutdown waits for cancelled jobs to return.
+	cancelGrace = 5 * time.Second
+)
+
+var jobsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "jobs_processed_total",
+	Help: "Background job attempts, by kind and outcome.",
+}, []string{"kind", "outcome"})
+
+var (
+	stopOnce          sync.Once
+	stopping          = make(chan struct{})
+	wakeup            = make(chan struct{}, 1)
+	active            sync.WaitGroup
+	runCtx, cancelRun = context.WithCancel(context.Background())
+)
+
+// Start launches workers that poll for due jobs every poll interval, or
+// sooner when this process queues one. With no workers, jobs queued here
+// are run by other replicas or cmd/worker.
+func Start(workers int, poll time.Duration) {
+	if workers <= 0 {
+		logrus.Info("jobs: Workers are turned off in this process.")
+		return
+	}
+	for i := 0; i < workers; i++ {
+		active.Add(1)
+		go work(poll)
+	}
+	logrus.WithFields(logrus.Fields{"workers": workers, "kinds": Kinds()}).Info("jobs: Workers started.")
+}
+
+// Shutdown stops the workers from claiming jobs and waits for the running
+// ones to finish. When ctx ends first their handlers' contexts are cancelled,
+// so the jobs are queued again, and ctx's error is returned.
+func Shutdown(ctx context.Context) error {
+	stopOnce.Do(func() { close(stopping) })
+	done := make(chan struct{})
+	go func() {
+		active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	// Out of time: cancel the running jobs and give their handlers a moment
+	// to return, so none is still using the database when it closes.
+	cancelRun()
+	select {
+	case <-done:
+	case <-time.After(cancelGrace):
+		logrus.Warn("jobs: Interrupted jobs still running at shutdown.")
+	}
+	return ctx.Err()
+}
+
+// Wake lets an idle worker in this process look for jobs queued with db
+// straight away. It does nothing while db is inside a transaction, as the
+// jobs are not visible until it commits; call it again with the handle the
+// transaction was started on once it has.
+func Wake(db *gorm.DB) {
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func work(poll time.Duration) {
+	defer active.Done()
+	for {
+		select {
+		case <-stopping:
+			return
+		default:
+		}
+		job, err := claim(time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("jobs: Failed to claim a job.")
+		}
+		if job != nil {
+			process(job)
+			continue
+		}
+		timer := time.NewTimer(poll)
+		select {
+		case <-stopping:
+			timer.Stop()
+			return
+		case <-wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// claim takes the next due job of a registered kind: a queued one whose
+// time has come, or a running one whose worker's lease lapsed. It returns
+// nil when there is none.
+func claim(now time.Time) (*models.Job, error) {
+	registered := Kinds()
+	if len(registered) == 0 {
+		return nil, nil
+	}
+	var job models.Job
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("kind IN ?", registered).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)", models.JobQueued, now, models.JobRunning, now).
+			Order("run_at, id").Limit(1).Find(&job).Error; err != nil {
+			return err
+		}
+		if job.ID == 0 {
+			return nil
+		}
+		if job.Status == models.JobRunning && LastAttempt(&job) {
+			// Its last attempt's worker died
+			logrus.WithFields(logrus.Fields{"job_id": job.ID, "kind": job.Kind}).Warn("jobs: Job's worker stopped responding on its last attempt.")
+			jobsProcessed.WithLabelValues(job.Kind, "failed").Inc()
+			err := tx.Model(&job).Updates(map[string]interface{}{
+				"status":       models.JobFailed,
+				"last_error":   "worker stopped responding",
+				"locked_until": nil,
+				"finished_at":  now,
+			}).Error
+			job.ID = 0
+			return err
+		}
+		token, err := newLeaseToken()
+		if err != nil {
+			return err
+		}
+		lease := now.Add(Lease)
+		job.Status, job.Attempts, job.LockedUntil, job.StartedAt, job.LeaseToken = models.JobRunning, job.Attempts+1, &lease, &now, token
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"attempts":     job.Attempts,
+			"locked_until": lease,
+			"started_at":   now,
+			"lease_token":  token,
+		}).Error
+	})
+	if err != nil || job.ID == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func process(job *models.Job) {
+	k, _ := lookup(job.Kind)
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	go renewLease(ctx, job)
+
+	log := logrus.WithFields(logrus.Fields{"job_id": job.ID, "kind": job.Kind, "attempt": job.Attempts})
+	start := time.Now()
+	err := runHandler(ctx, k.handler, job)
+	cancel() // Stop renewing the lease
+	log = log.WithField("duration_ms", time.Since(start).Milliseconds())
+
+	now := time.Now()
+	updates := map[string]interface{}{"locked_until": nil}
+	var outcome string
+	switch {
+	case err == nil:
+		outcome = "succeeded"
+		updates["status"], updates["finished_at"], updates["last_error"] = models.JobSucceeded, now, ""
+		log.Info("jobs: Job succeeded.")
+	case runCtx.Err() != nil && errors.Is(err, context.Canceled):
+		// Shut down mid-run; the attempt doesn't count
+		outcome = "interrupted"
+		updates["status"], updates["run_at"], updates["attempts"] = models.JobQueued, now, job.Attempts-1
+		updates["last_error"] = "interrupted by shutdown"
+		log.Warn("jobs: Job interrupted by shutdown, queued again.")
+	case IsPermanent(err) || LastAttempt(job):
+		outcome = "failed"
+		updates["status"], updates["finished_at"], updates["last_error"] = models.JobFailed, now, err.Error()
+		log.WithError(err).Error("jobs: Job failed.")
+	default:
+		outcome = "retried"
+		runAt := now.Add(backoff(job.Attempts))
+		updates["status"], updates["run_at"], updates["last_error"] = models.JobQueued, runAt, err.Error()
+		log.WithError(err).WithField("run_at", runAt).Warn("jobs: Job attempt failed, will retry.")
+	}
+	// Only while this worker still holds the lease: after it lapsed, another
+	// worker may have claimed the job and owns its outcome.
+	res := config.DB.Model(&models.Job{}).Where("id = ? AND lease_token = ?", job.ID, job.LeaseToken).Updates(updates)
+	switch {
+	case res.Error != nil:
+		log.WithError(res.Error).Error("jobs: Failed to record job outcome.")
+	case res.RowsAffected == 0:
+		log.Warn("jobs: Job's lease was taken over by another worker; outcome not recorded.")
+		outcome = "superseded"
+	}
+	jobsProcessed.WithLabelValues(job.Kind, outcome).Inc()
+}
+
+// newLeaseToken returns a random token identifying one claim of a job.
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// runHandler runs h, turning a panic into an error.
+func runHandler(ctx context.Context, h Handler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithFields(logrus.Fields{"job_id": job.ID, "stack": string(debug.Stack())}).Error("jobs: Handler panicked.")
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// renewLease extends the job's lease until ctx ends, as long as it is still
+// the job's current claim.
+func renewLease(ctx context.Context, job *models.Job) {
+	ticker := time.NewTicker(Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := config.DB.Model(&models.Job{}).Where("id = ? AND status = ? AND lease_token = ?", job.ID, models.JobRunning, job.LeaseToken).
+				Update("locked_until", time.Now().Add(Lease)).Error; err != nil {
+				logrus.WithError(err).WithField("job_id", job.ID).Warn("jobs: Failed to renew lease.")
+			}
+		}
+	}
+}
+
+// backoff is the wait after the given failed attempt.
+func backoff(attempt int) time.Duration {
+	d := RetryBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+func init() {
+	Register("test_wake", 1, func(context.Context, *models.Job) error { return nil })
+	Register("test_lease", 3, func(context.Context, *models.Job) error {
+		// Meanwhile another worker takes the job over.
+		return config.DB.Model(&models.Job{}).Where("kind = ?", "test_lease").Update("lease_token", "other").Error
+	})
+}
+
+func woken() bool {
+	select {
+	case <-wakeup:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestEnqueueWakesAfterCommit(t *testing.T) {
+	db := testdb.Use(t, &models.Job{})
+	woken()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := Enqueue(tx, "test_wake", nil, Options{})
+		if woken() {
+			t.Error("workers woken before the job was committed")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wake(db)
+	if !woken() {
+		t.Error("Wake after the commit did not wake the workers")
+	}
+
+	if _, err := Enqueue(db, "test_wake", nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !woken() {
+		t.Error("Enqueue outside a transaction did not wake the workers")
+	}
+}
+
+// A worker whose lease lapsed and was claimed again must not overwrite the
+// new claim's outcome.
+func TestProcessAfterLeaseTakenOver(t *testing.T) {
+	db := testdb.Use(t, &models.Job{})
+	if _, err := Enqueue(db, "test_lease", nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := claim(time.Now())
+	if err != nil || job == nil {
+		t.Fatalf("claim: %v, %v", job, err)
+	}
+	if job.LeaseToken == "" {
+		t.Fatal("claim set no lease token")
+	}
+	process(job)
+
+	var stored models.Job
+	db.First(&stored, job.ID)
+	if stored.Status != models.JobRunning || stored.LeaseToken != "other" {
+		t.Errorf("status %q, token %q; want the other worker's claim left running", stored.Status, stored.LeaseToken)
+	}
+}
@@ -0,0 +1,127 @@
+package journeys
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+)
+
+// TripLeg is one ride of a past journey, named for display, with the IDs
+// needed to book it again.
+type TripLeg struct {
+	ReceiptLeg
+	RouteID       uint `json:"route_id"`
+	BoardStageID  uint `json:"board_stage_id"`
+	AlightStageID uint `json:"alight_stage_id"`
+	VehicleID     uint `json:"vehicle_id,omitempty"`
+}
+
+// Trip is a journey as listed in a commuter's trip history.
+type Trip struct {
+	JourneyID   uint       `json:"journey_id"`
+	Reference   string     `json:"reference"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Currency    string     `json:"currency"`
+	Legs        []TripLeg  `json:"legs"`
+	FareTotal   float64    `json:"fare_total"`
+	PaidTotal   float64    `json:"paid_total"`
+}
+
+// History describes journeys loaded with their segments and payments, in
+// the order given.
+func History(db *gorm.DB, list []models.Journey) ([]Trip, error) {
+	var segments []models.JourneySegment
+	for _, j := range list {
+		segments = append(segments, j.Segments...)
+	}
+	names, err := loadNames(db, segments)
+	if err != nil {
+		return nil, err
+	}
+	trips := make([]Trip, 0, len(list))
+	for _, j := range list {
+		t := Trip{
+			JourneyID:   j.ID,
+			Reference:   j.Reference,
+			Status:      j.Status,
+			StartedAt:   j.CreatedAt,
+			CompletedAt: j.CompletedAt,
+			Currency:    j.Currency,
+			Legs:        make([]TripLeg, 0, len(j.Segments)),
+		}
+		if t.Currency == "" {
+			t.Currency = format.DefaultCurrency
+		}
+		paidBySegment := map[uint]float64{}
+		for _, p := range j.Payments {
+			paidBySegment[p.SegmentID] += p.Amount
+			t.PaidTotal += p.Amount
+		}
+		ordered := append([]models.JourneySegment(nil), j.Segments...)
+		sort.Slice(ordered, func(a, b int) bool { return ordered[a].Sequence < ordered[b].Sequence })
+		for _, s := range ordered {
+			leg := TripLeg{
+				ReceiptLeg:    names.leg(s),
+				RouteID:       s.RouteID,
+				BoardStageID:  s.BoardStageID,
+				AlightStageID: s.AlightStageID,
+				VehicleID:     s.VehicleID,
+			}
+			leg.Paid = paidBySegment[s.ID]
+			t.FareTotal += s.Fare
+			t.Legs = append(t.Legs, leg)
+		}
+		trips = append(trips, t)
+	}
+	return trips, nil
+}
+
+// FrequentTrip is a sequence of rides a commuter has made more than once.
+type FrequentTrip struct {
+	Times         int       `json:"times"`
+	LastTakenAt   time.Time `json:"last_taken_at"`
+	LastJourneyID uint      `json:"last_journey_id"` // The journey to repeat to make the trip again
+	Legs          []TripLeg `json:"legs"`            // As ridden last time
+}
+
+// Frequent groups trips, newest first, by the rides they are made of and
+// returns up to n of those made at least twice, most often made first.
+func Frequent(trips []Trip, n int) []FrequentTrip {
+	byKey := map[string]*FrequentTrip{}
+	var order []string
+	for _, t := range trips {
+		if len(t.Legs) == 0 {
+			continue
+		}
+		var key strings.Builder
+		for _, l := range t.Legs {
+			fmt.Fprintf(&key, "%d:%d:%d|", l.RouteID, l.BoardStageID, l.AlightStageID)
+		}
+		f, ok := byKey[key.String()]
+		if !ok {
+			f = &FrequentTrip{LastTakenAt: t.StartedAt, LastJourneyID: t.JourneyID, Legs: t.Legs}
+			byKey[key.String()] = f
+			order = append(order, key.String())
+		}
+		f.Times++
+	}
+	out := []FrequentTrip{}
+	for _, k := range order {
+		if byKey[k].Times >= 2 {
+			out = append(out, *byKey[k])
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Times > out[j].Times })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
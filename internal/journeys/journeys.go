@@ -0,0 +1,402 @@
+// Package journeys records commuter journeys made of one or more matatu
+// segments, lets crews validate each segment on board, and produces a single
+// consolidated receipt per journey covering every leg and payment.
+package journeys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// ErrNotOpen is returned when changing a journey that has been completed.
+	ErrNotOpen = errors.New("journey is already completed")
+	// ErrNoPendingSegment is returned when a journey has no unvalidated leg on the crew's route.
+	ErrNoPendingSegment = errors.New("journey has no pending leg on this route")
+	// ErrNoSigningKey is returned when RECEIPT_SIGNING_KEY is unset.
+	ErrNoSigningKey = errors.New("journeys: RECEIPT_SIGNING_KEY is not set")
+	// ErrPaymentConfirmed is returned when confirming a payment twice.
+	ErrPaymentConfirmed = errors.New("payment is already confirmed")
+	// ErrPaymentWrongRoute is returned when a crew confirms a payment for rides
+	// on another route.
+	ErrPaymentWrongRoute = errors.New("payment is not for a ride on this route")
+)
+
+// NewReference returns a random, human-friendly journey reference.
+func NewReference() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "J" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// CheckSigningKey reports whether receipts and tickets can be signed. Servers
+// refuse to start without RECEIPT_SIGNING_KEY rather than sign with a key
+// that can be guessed or is shared with logins.
+func CheckSigningKey() error {
+	if len(signingKey()) == 0 {
+		return ErrNoSigningKey
+	}
+	return nil
+}
+
+func signingKey() []byte {
+	return []byte(config.EnvString("RECEIPT_SIGNING_KEY", ""))
+}
+
+// Load returns the journey with its segments and payments in order.
+func Load(db *gorm.DB, id uint) (models.Journey, error) {
+	var j models.Journey
+	err := db.Preload("Segments", func(tx *gorm.DB) *gorm.DB { return tx.Order("sequence") }).
+		Preload("Payments", func(tx *gorm.DB) *gorm.DB { return tx.Order("paid_at") }).
+		First(&j, id).Error
+	return j, err
+}
+
+// Validate marks the first pending segment of the journey with the given
+// reference that runs on the vehicle's route as validated on that vehicle.
+// fare, when positive, records the fare the crew charged for the leg.
+func Validate(db *gorm.DB, reference string, vehicle models.Vehicle, fare float64, now time.Time) (models.JourneySegment, error) {
+	var segment models.JourneySegment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var j models.Journey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", strings.ToUpper(strings.TrimSpace(reference))).First(&j).Error; err != nil {
+			return err
+		}
+		if j.Status != models.JourneyOpen {
+			return ErrNotOpen
+		}
+		err := tx.Where("journey_id = ? AND route_id = ? AND validation_status = ?", j.ID, vehicle.RouteID, models.SegmentPending).
+			Order("sequence").First(&segment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNoPendingSegment
+		}
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"validation_status": models.SegmentValidated,
+			"validated_at":      now,
+			"vehicle_id":        vehicle.ID,
+			"driver_id":         vehicle.DriverID,
+		}
+		if fare > 0 {
+			updates["fare"] = fare
+		}
+		if err := tx.Model(&segment).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&segment, segment.ID).Error
+	})
+	return segment, err
+}
+
+// Confirmation is a confirmed payment with its receipt and the tickets it
+// paid for.
+type Confirmation struct {
+	Payment models.JourneyPayment `json:"payment"`
+	Receipt models.PaymentReceipt `json:"receipt"`
+	Tickets []models.Ticket       `json:"tickets"`
+}
+
+// ConfirmPayment lets the crew of vehicle confirm a payment the commuter
+// reported towards the journey with the given reference, e.g. cash handed
+// over on board. The payment must be for a ride on the vehicle's route, or
+// for the whole journey when one of its rides is. The payment's receipt is
+// issued, and tickets for the rides it now covers.
+func ConfirmPayment(db *gorm.DB, reference string, paymentID uint, vehicle models.Vehicle, now time.Time) (Confirmation, error) {
+	var out Confirmation
+	payment := &out.Payment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var j models.Journey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", strings.ToUpper(strings.TrimSpace(reference))).First(&j).Error; err != nil {
+			return err
+		}
+		if j.Status != models.JourneyOpen {
+			return ErrNotOpen
+		}
+		if err := tx.Where("journey_id = ?", j.ID).First(payment, paymentID).Error; err != nil {
+			return err
+		}
+		if payment.Status == models.PaymentConfirmed {
+			return ErrPaymentConfirmed
+		}
+		onRoute := tx.Model(&models.JourneySegment{}).Where("journey_id = ? AND route_id = ?", j.ID, vehicle.RouteID)
+		if payment.SegmentID != 0 {
+			onRoute = onRoute.Where("id = ?", payment.SegmentID)
+		}
+		var n int64
+		if err := onRoute.Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrPaymentWrongRoute
+		}
+		payment.Status, payment.ConfirmedAt, payment.ConfirmedByDriver = models.PaymentConfirmed, &now, vehicle.DriverID
+		if err := tx.Model(payment).Updates(map[string]interface{}{
+			"status":              payment.Status,
+			"confirmed_at":        now,
+			"confirmed_by_driver": vehicle.DriverID,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		if out.Receipt, err = IssuePaymentReceipt(tx, j, *payment); err != nil {
+			return err
+		}
+		out.Tickets, err = IssueTickets(tx, j.ID, now)
+		return err
+	})
+	return out, err
+}
+
+// Complete closes the journey. Segments that were never validated are marked
+// skipped so the receipt shows which legs a crew did not check.
+func Complete(db *gorm.DB, j *models.Journey, now time.Time) error {
+	if j.Status != models.JourneyOpen {
+		return ErrNotOpen
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JourneySegment{}).
+			Where("journey_id = ? AND validation_status = ?", j.ID, models.SegmentPending).
+			Update("validation_status", models.SegmentSkipped).Error; err != nil {
+			return err
+		}
+		j.Status, j.CompletedAt = models.JourneyCompleted, &now
+		return tx.Model(j).Updates(map[string]interface{}{"status": j.Status, "completed_at": now}).Error
+	})
+}
+
+// ReceiptLeg is one segment as shown on a receipt.
+type ReceiptLeg struct {
+	Sequence         int        `json:"sequence"`
+	Route            string     `json:"route"`
+	Sacco            string     `json:"sacco,omitempty"`
+	Vehicle          string     `json:"vehicle,omitempty"`
+	From             string     `json:"from"`
+	To               string     `json:"to"`
+	Fare             float64    `json:"fare"`
+	Paid             float64    `json:"paid"`
+	ValidationStatus string     `json:"validation_status"`
+	ValidatedAt      *time.Time `json:"validated_at,omitempty"`
+}
+
+// ReceiptPayment is one payment as shown on a receipt.
+type ReceiptPayment struct {
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Reference string    `json:"reference,omitempty"`
+	Leg       int       `json:"leg,omitempty"` // Sequence of the segment paid for, 0 for the whole journey
+	PaidAt    time.Time `json:"paid_at"`
+}
+
+// Receipt is the consolidated record of a journey. It is provisional while
+// the journey is still open, and only covers confirmed payments.
+type Receipt struct {
+	Reference        string           `json:"reference"`
+	Status           string           `json:"status"`
+	Provisional      bool             `json:"provisional"`
+	StartedAt        time.Time        `json:"started_at"`
+	CompletedAt      *time.Time       `json:"completed_at,omitempty"`
+	IssuedAt         time.Time        `json:"issued_at"`
+	Currency         string           `json:"currency"`
+	Legs             []ReceiptLeg     `json:"legs"`
+	Payments         []ReceiptPayment `json:"payments"`
+	FareTotal        float64          `json:"fare_total"`
+	PaidTotal        float64          `json:"paid_total"`
+	Balance          float64          `json:"balance"`
+	Unconfirmed      float64          `json:"unconfirmed,omitempty"` // Reported, not yet confirmed; not in PaidTotal
+	VerificationCode string           `json:"verification_code"`
+}
+
+// BuildReceipt assembles the receipt of a journey loaded with Load.
+func BuildReceipt(db *gorm.DB, j models.Journey, now time.Time) (Receipt, error) {
+	r := Receipt{
+		Reference:   j.Reference,
+		Status:      j.Status,
+		Provisional: j.Status == models.JourneyOpen,
+		StartedAt:   j.CreatedAt,
+		CompletedAt: j.CompletedAt,
+		IssuedAt:    now,
+		Currency:    j.Currency,
+		Legs:        []ReceiptLeg{},
+		Payments:    []ReceiptPayment{},
+	}
+	if r.Currency == "" {
+		r.Currency = format.DefaultCurrency
+	}
+
+	names, err := loadNames(db, j.Segments)
+	if err != nil {
+		return r, err
+	}
+
+	paidBySegment := map[uint]float64{}
+	sequenceOf := map[uint]int{}
+	for _, s := range j.Segments {
+		sequenceOf[s.ID] = s.Sequence
+	}
+	for _, p := range j.Payments {
+		// Only confirmed payments are vouched for by the receipt.
+		if p.Status != models.PaymentConfirmed {
+			r.Unconfirmed += p.Amount
+			continue
+		}
+		paidBySegment[p.SegmentID] += p.Amount
+		r.PaidTotal += p.Amount
+		r.Payments = append(r.Payments, ReceiptPayment{
+			Amount:    p.Amount,
+			Method:    p.Method,
+			Reference: p.Reference,
+			Leg:       sequenceOf[p.SegmentID],
+			PaidAt:    p.PaidAt,
+		})
+	}
+	for _, s := range j.Segments {
+		leg := names.leg(s)
+		leg.Paid = paidBySegment[s.ID]
+		r.FareTotal += s.Fare
+		r.Legs = append(r.Legs, leg)
+	}
+	r.Balance = r.FareTotal - r.PaidTotal
+	r.VerificationCode = verificationCode(r)
+	return r, nil
+}
+
+// names holds what the segments of one or more journeys refer to, for
+// display.
+type names struct {
+	routes   map[uint]models.Route
+	stages   map[uint]models.Stage
+	vehicles map[uint]models.Vehicle
+	saccos   map[uint]models.Sacco
+}
+
+// loadNames loads the routes, stages, vehicles and saccos of segments.
+func loadNames(db *gorm.DB, segments []models.JourneySegment) (names, error) {
+	n := names{map[uint]models.Route{}, map[uint]models.Stage{}, map[uint]models.Vehicle{}, map[uint]models.Sacco{}}
+	if len(segments) == 0 {
+		return n, nil
+	}
+	var routeIDs, stageIDs, vehicleIDs, saccoIDs []uint
+	for _, s := range segments {
+		routeIDs = append(routeIDs, s.RouteID)
+		stageIDs = append(stageIDs, s.BoardStageID, s.AlightStageID)
+		vehicleIDs = append(vehicleIDs, s.VehicleID)
+		saccoIDs = append(saccoIDs, s.SaccoID)
+	}
+	var rs []models.Route
+	var ss []models.Stage
+	var vs []models.Vehicle
+	var sc []models.Sacco
+	// Soft-deleted routes and stages still name the legs they served.
+	if err := db.Unscoped().Select("id", "name").Where("id IN ?", routeIDs).Find(&rs).Error; err != nil {
+		return n, err
+	}
+	if err := db.Unscoped().Select("id", "name").Where("id IN ?", stageIDs).Find(&ss).Error; err != nil {
+		return n, err
+	}
+	if err := db.Unscoped().Select("id", "vehicle_no", "vehicle_registration").Where("id IN ?", vehicleIDs).Find(&vs).Error; err != nil {
+		return n, err
+	}
+	if err := db.Unscoped().Select("id", "name").Where("id IN ?", saccoIDs).Find(&sc).Error; err != nil {
+		return n, err
+	}
+	for _, x := range rs {
+		n.routes[x.ID] = x
+	}
+	for _, x := range ss {
+		n.stages[x.ID] = x
+	}
+	for _, x := range vs {
+		n.vehicles[x.ID] = x
+	}
+	for _, x := range sc {
+		n.saccos[x.ID] = x
+	}
+	return n, nil
+}
+
+// leg describes a segment as shown on a receipt, without what was paid.
+func (n names) leg(s models.JourneySegment) ReceiptLeg {
+	leg := ReceiptLeg{
+		Sequence:         s.Sequence,
+		Route:            n.routes[s.RouteID].Name,
+		Sacco:            n.saccos[s.SaccoID].Name,
+		From:             n.stages[s.BoardStageID].Name,
+		To:               n.stages[s.AlightStageID].Name,
+		Fare:             s.Fare,
+		ValidationStatus: s.ValidationStatus,
+		ValidatedAt:      s.ValidatedAt,
+	}
+	if v, ok := n.vehicles[s.VehicleID]; ok {
+		leg.Vehicle = strings.TrimSpace(v.VehicleNo + " " + v.VehicleRegistration)
+	}
+	return leg
+}
+
+// verificationCode signs the receipt's reference, leg states and totals so a
+// printed or forwarded copy can be checked with Verify.
+func verificationCode(r Receipt) string {
+	mac := hmac.New(sha256.New, signingKey())
+	fmt.Fprintf(mac, "%s|%s|%.2f|%.2f", r.Reference, r.Status, r.FareTotal, r.PaidTotal)
+	for _, l := range r.Legs {
+		fmt.Fprintf(mac, "|%d:%s:%.2f", l.Sequence, l.ValidationStatus, l.Fare)
+	}
+	return strings.ToUpper(hex.EncodeToString(mac.Sum(nil))[:12])
+}
+
+// Verify reports whether code matches the receipt as it stands now.
+func Verify(r Receipt, code string) bool {
+	return hmac.Equal([]byte(verificationCode(r)), []byte(strings.ToUpper(strings.TrimSpace(code))))
+}
+
+// Text renders the receipt as plain text for printing or sharing.
+func (r Receipt) Text() string {
+	var b strings.Builder
+	title := "JOURNEY RECEIPT"
+	if r.Provisional {
+		title += " (PROVISIONAL)"
+	}
+	fmt.Fprintf(&b, "%s\nReference: %s\nStarted:   %s\n", title, r.Reference, r.StartedAt.Format(time.RFC1123))
+	if r.CompletedAt != nil {
+		fmt.Fprintf(&b, "Completed: %s\n", r.CompletedAt.Format(time.RFC1123))
+	}
+	for _, l := range r.Legs {
+		fmt.Fprintf(&b, "\nLeg %d: %s\n  %s -> %s\n", l.Sequence, l.Route, l.From, l.To)
+		if l.Sacco != "" {
+			fmt.Fprintf(&b, "  Sacco:   %s\n", l.Sacco)
+		}
+		if l.Vehicle != "" {
+			fmt.Fprintf(&b, "  Vehicle: %s\n", l.Vehicle)
+		}
+		fmt.Fprintf(&b, "  Fare:    %s %.2f\n  Status:  %s\n", r.Currency, l.Fare, l.ValidationStatus)
+	}
+	if len(r.Payments) > 0 {
+		b.WriteString("\nPayments\n")
+		for _, p := range r.Payments {
+			fmt.Fprintf(&b, "  %s  %-12s %s %.2f %s\n", p.PaidAt.Format("2006-01-02 15:04"), p.Method, r.Currency, p.Amount, p.Reference)
+		}
+	}
+	fmt.Fprintf(&b, "\nTotal fare: %s %.2f\nPaid:       %s %.2f\nBalance:    %s %.2f\n", r.Currency, r.FareTotal, r.Currency, r.PaidTotal, r.Currency, r.Balance)
+	if r.Unconfirmed > 0 {
+		fmt.Fprintf(&b, "Awaiting confirmation: %s %.2f\n", r.Currency, r.Unconfirmed)
+	}
+	fmt.Fprintf(&b, "\nVerification code: %s\nIssued: %s\n", r.VerificationCode, r.IssuedAt.Format(time.RFC1123))
+	return b.String()
+}
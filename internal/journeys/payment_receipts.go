@@ -0,0 +1,137 @@
+package journeys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/format"
+	"ma3_tracker/internal/models"
+)
+
+// PaymentReceiptDetail is a payment receipt with the journey it was paid
+// towards and the legs it covers.
+type PaymentReceiptDetail struct {
+	models.PaymentReceipt
+	JourneyReference string       `json:"journey_reference"`
+	Legs             []ReceiptLeg `json:"legs"`
+}
+
+// newReceiptReference returns a random, human-friendly receipt reference.
+func newReceiptReference() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "R" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// paymentReceiptCode signs what a payment receipt says was paid, so a
+// printed or forwarded copy can be checked with VerifyPaymentReceipt.
+func paymentReceiptCode(r models.PaymentReceipt) string {
+	mac := hmac.New(sha256.New, signingKey())
+	fmt.Fprintf(mac, "%s|%d|%d|%.2f|%s|%s|%s|%d", r.Reference, r.JourneyID, r.SegmentID, r.Amount, r.Currency, r.Method, r.PaymentReference, r.PaidAt.Unix())
+	return strings.ToUpper(hex.EncodeToString(mac.Sum(nil))[:12])
+}
+
+// VerifyPaymentReceipt reports whether code matches the receipt.
+func VerifyPaymentReceipt(r models.PaymentReceipt, code string) bool {
+	return hmac.Equal([]byte(paymentReceiptCode(r)), []byte(strings.ToUpper(strings.TrimSpace(code))))
+}
+
+// ErrPaymentUnconfirmed is returned when issuing the receipt of a payment no
+// crew or provider has confirmed.
+var ErrPaymentUnconfirmed = errors.New("payment is not confirmed")
+
+// IssuePaymentReceipt records the receipt of a confirmed payment towards j.
+// Call it in the transaction that confirms the payment, so every confirmed
+// payment has one.
+func IssuePaymentReceipt(tx *gorm.DB, j models.Journey, p models.JourneyPayment) (models.PaymentReceipt, error) {
+	if p.Status != models.PaymentConfirmed {
+		return models.PaymentReceipt{}, ErrPaymentUnconfirmed
+	}
+	if err := CheckSigningKey(); err != nil {
+		return models.PaymentReceipt{}, err
+	}
+	reference, err := newReceiptReference()
+	if err != nil {
+		return models.PaymentReceipt{}, err
+	}
+	r := models.PaymentReceipt{
+		Reference:        reference,
+		UserID:           j.UserID,
+		JourneyID:        j.ID,
+		JourneyPaymentID: p.ID,
+		SegmentID:        p.SegmentID,
+		Amount:           p.Amount,
+		Currency:         j.Currency,
+		Method:           p.Method,
+		PaymentReference: p.Reference,
+		// Stored times come back at microsecond precision; sign what will
+		// be read back.
+		PaidAt: p.PaidAt.Truncate(time.Microsecond),
+	}
+	if r.Currency == "" {
+		r.Currency = format.DefaultCurrency
+	}
+	r.VerificationCode = paymentReceiptCode(r)
+	return r, tx.Create(&r).Error
+}
+
+// DescribePaymentReceipt adds the journey reference and the legs the payment
+// covers: the one it was made for, or all of them.
+func DescribePaymentReceipt(db *gorm.DB, r models.PaymentReceipt) (PaymentReceiptDetail, error) {
+	d := PaymentReceiptDetail{PaymentReceipt: r, Legs: []ReceiptLeg{}}
+	var j models.Journey
+	if err := db.Unscoped().Select("id", "reference").First(&j, r.JourneyID).Error; err != nil {
+		return d, err
+	}
+	d.JourneyReference = j.Reference
+	query := db.Unscoped().Where("journey_id = ?", r.JourneyID)
+	if r.SegmentID != 0 {
+		query = query.Where("id = ?", r.SegmentID)
+	}
+	var segments []models.JourneySegment
+	if err := query.Order("sequence").Find(&segments).Error; err != nil {
+		return d, err
+	}
+	names, err := loadNames(db, segments)
+	if err != nil {
+		return d, err
+	}
+	for _, s := range segments {
+		d.Legs = append(d.Legs, names.leg(s))
+	}
+	return d, nil
+}
+
+// Text renders the receipt as plain text for printing or sharing.
+func (d PaymentReceiptDetail) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "FARE PAYMENT RECEIPT\nReceipt:   %s\nJourney:   %s\nPaid:      %s\n", d.Reference, d.JourneyReference, d.PaidAt.Format(time.RFC1123))
+	fmt.Fprintf(&b, "Method:    %s\n", d.Method)
+	if d.PaymentReference != "" {
+		fmt.Fprintf(&b, "Reference: %s\n", d.PaymentReference)
+	}
+	for _, l := range d.Legs {
+		fmt.Fprintf(&b, "\nLeg %d: %s\n  %s -> %s\n", l.Sequence, l.Route, l.From, l.To)
+		if l.Sacco != "" {
+			fmt.Fprintf(&b, "  Sacco:   %s\n", l.Sacco)
+		}
+		if l.Vehicle != "" {
+			fmt.Fprintf(&b, "  Vehicle: %s\n", l.Vehicle)
+		}
+		fmt.Fprintf(&b, "  Fare:    %s %.2f\n", d.Currency, l.Fare)
+	}
+	fmt.Fprintf(&b, "\nAmount paid: %s %.2f\n", d.Currency, d.Amount)
+	fmt.Fprintf(&b, "\nVerification code: %s\n", d.VerificationCode)
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package journeys
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ma3_tracker/internal/models"
+)
+
+func TestReceiptsOnlyForConfirmedPayments(t *testing.T) {
+	db, j, s := openJourney(t)
+	p := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, SegmentID: s.ID, Amount: 80, Method: models.PaymentCash})
+
+	if _, err := IssuePaymentReceipt(db, j, p); !errors.Is(err, ErrPaymentUnconfirmed) {
+		t.Fatalf("receipt for a reported payment: err = %v; want ErrPaymentUnconfirmed", err)
+	}
+	var n int64
+	db.Model(&models.PaymentReceipt{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("%d receipts saved for a reported payment", n)
+	}
+
+	confirmation, err := ConfirmPayment(db, j.Reference, p.ID, models.Vehicle{RouteID: 1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := confirmation.Receipt
+	if r.ID == 0 || r.JourneyPaymentID != p.ID || r.Amount != 80 {
+		t.Fatalf("receipt = %+v", r)
+	}
+	if !VerifyPaymentReceipt(r, r.VerificationCode) {
+		t.Error("receipt's own code did not verify")
+	}
+	r.Amount = 800
+	if VerifyPaymentReceipt(r, confirmation.Receipt.VerificationCode) {
+		t.Error("code verified for an altered amount")
+	}
+}
+
+func TestJourneyReceiptLeavesOutUnconfirmedPayments(t *testing.T) {
+	db, j, s := openJourney(t)
+	confirmed := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, SegmentID: s.ID, Amount: 30, Method: models.PaymentCash})
+	if _, err := ConfirmPayment(db, j.Reference, confirmed.ID, models.Vehicle{RouteID: 1}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, Amount: 1000, Method: models.PaymentMobileMoney})
+
+	loaded, err := Load(db, j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := BuildReceipt(db, loaded, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PaidTotal != 30 || r.Balance != 50 || r.Unconfirmed != 1000 || len(r.Payments) != 1 {
+		t.Fatalf("receipt paid %v, balance %v, unconfirmed %v, %d payments; want 30, 50, 1000, 1",
+			r.PaidTotal, r.Balance, r.Unconfirmed, len(r.Payments))
+	}
+	if !Verify(r, r.VerificationCode) {
+		t.Error("receipt's own code did not verify")
+	}
+	r.PaidTotal = 1030
+	if Verify(r, r.VerificationCode) {
+		t.Error("code verified for an altered total")
+	}
+}
@@ -0,0 +1,181 @@
+package journeys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// ticketPrefix starts every QR payload, so scanners can tell tickets from
+// other codes and the format can change later.
+const ticketPrefix = "MA3T1"
+
+// TicketValidity is how long a ticket can be used after it is issued.
+var TicketValidity = config.EnvDuration("TICKET_VALIDITY", 12*time.Hour)
+
+// Errors returned by UseTicket for tickets that don't admit the ride.
+var (
+	ErrTicketInvalid    = errors.New("ticket is not valid")
+	ErrTicketExpired    = errors.New("ticket has expired")
+	ErrTicketUsed       = errors.New("ticket has already been used")
+	ErrTicketWrongRoute = errors.New("ticket is for another route")
+)
+
+// ticketSignature signs what a ticket admits and until when.
+func ticketSignature(t models.Ticket) string {
+	mac := hmac.New(sha256.New, signingKey())
+	fmt.Fprintf(mac, "ticket|%s|%d|%d|%d", t.Code, t.SegmentID, t.RouteID, t.ExpiresAt.Unix())
+	return strings.ToUpper(hex.EncodeToString(mac.Sum(nil))[:16])
+}
+
+// TicketPayload is the text to encode in the ticket's QR code.
+func TicketPayload(t models.Ticket) string {
+	return fmt.Sprintf("%s.%s.%d.%s", ticketPrefix, t.Code, t.ExpiresAt.Unix(), ticketSignature(t))
+}
+
+// IssueTickets issues a ticket for each ride of the journey that is now paid
+// for in full and has none yet. Only confirmed payments count: payments for
+// a ride towards it, and payments towards the whole journey towards its
+// rides in order. Rides whose fare isn't known yet aren't ticketed. Call it
+// in the transaction that confirms a payment.
+func IssueTickets(tx *gorm.DB, journeyID uint, now time.Time) ([]models.Ticket, error) {
+	if err := CheckSigningKey(); err != nil {
+		return nil, err
+	}
+	var j models.Journey
+	if err := tx.Preload("Segments").Preload("Payments", "status = ?", models.PaymentConfirmed).First(&j, journeyID).Error; err != nil {
+		return nil, err
+	}
+	var ticketed []uint
+	if err := tx.Model(&models.Ticket{}).Where("journey_id = ?", j.ID).Pluck("segment_id", &ticketed).Error; err != nil {
+		return nil, err
+	}
+	hasTicket := map[uint]bool{}
+	for _, id := range ticketed {
+		hasTicket[id] = true
+	}
+
+	paid, pool := map[uint]float64{}, 0.0
+	for _, p := range j.Payments {
+		if p.SegmentID == 0 {
+			pool += p.Amount
+		} else {
+			paid[p.SegmentID] += p.Amount
+		}
+	}
+	segments := append([]models.JourneySegment(nil), j.Segments...)
+	sort.Slice(segments, func(a, b int) bool { return segments[a].Sequence < segments[b].Sequence })
+
+	issued := []models.Ticket{}
+	for _, s := range segments {
+		if s.Fare <= 0 {
+			continue
+		}
+		if need := s.Fare - paid[s.ID]; need > 0 {
+			if pool < need {
+				continue
+			}
+			pool -= need
+		}
+		if hasTicket[s.ID] {
+			continue
+		}
+		code, err := newTicketCode()
+		if err != nil {
+			return nil, err
+		}
+		t := models.Ticket{
+			Code:          code,
+			UserID:        j.UserID,
+			JourneyID:     j.ID,
+			SegmentID:     s.ID,
+			RouteID:       s.RouteID,
+			BoardStageID:  s.BoardStageID,
+			AlightStageID: s.AlightStageID,
+			Status:        models.TicketValid,
+			// Whole seconds, as signed in the payload.
+			ExpiresAt: now.Add(TicketValidity).Truncate(time.Second),
+		}
+		if err := tx.Create(&t).Error; err != nil {
+			return nil, err
+		}
+		t.QR = TicketPayload(t)
+		issued = append(issued, t)
+	}
+	return issued, nil
+}
+
+func newTicketCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "T" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// UseTicket admits the ride a scanned QR payload stands for on vehicle: the
+// signature must match, the ticket must be unexpired, unused and for the
+// vehicle's route. The ticket is then marked used and its ride validated on
+// the vehicle, so the same code can't be used twice. The ticket is returned
+// with the error when it was found, e.g. to show when it was used.
+func UseTicket(db *gorm.DB, payload string, vehicle models.Vehicle, now time.Time) (models.Ticket, error) {
+	var t models.Ticket
+	parts := strings.Split(strings.TrimSpace(payload), ".")
+	if len(parts) != 4 || parts[0] != ticketPrefix {
+		return t, ErrTicketInvalid
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || CheckSigningKey() != nil {
+		return t, ErrTicketInvalid
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", parts[1]).First(&t).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTicketInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if t.ExpiresAt.Unix() != expires || !hmac.Equal([]byte(ticketSignature(t)), []byte(strings.ToUpper(parts[3]))) {
+			return ErrTicketInvalid
+		}
+		switch {
+		case t.Status == models.TicketUsed:
+			return ErrTicketUsed
+		case !now.Before(t.ExpiresAt):
+			return ErrTicketExpired
+		case t.RouteID != vehicle.RouteID:
+			return ErrTicketWrongRoute
+		}
+		t.Status, t.UsedAt, t.VehicleID, t.DriverID = models.TicketUsed, &now, vehicle.ID, vehicle.DriverID
+		if err := tx.Save(&t).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.JourneySegment{}).
+			Where("id = ? AND validation_status = ?", t.SegmentID, models.SegmentPending).
+			Updates(map[string]interface{}{
+				"validation_status": models.SegmentValidated,
+				"validated_at":      now,
+				"vehicle_id":        vehicle.ID,
+				"driver_id":         vehicle.DriverID,
+			}).Error
+	})
+	if errors.Is(err, ErrTicketInvalid) {
+		return models.Ticket{}, err
+	}
+	return t, err
+}
@@ -0,0 +1,156 @@
+package journeys
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// openJourney saves an open journey with one ride on route 1 for a fare of
+// 80, and returns it with its ride.
+func openJourney(t *testing.T) (*gorm.DB, models.Journey, models.JourneySegment) {
+	t.Helper()
+	t.Setenv("RECEIPT_SIGNING_KEY", "test-receipt-key")
+	db := testdb.Open(t, &models.Journey{}, &models.JourneySegment{}, &models.JourneyPayment{}, &models.Ticket{}, &models.PaymentReceipt{},
+		&models.Route{}, &models.Stage{}, &models.Vehicle{}, &models.Sacco{})
+	j := models.Journey{UserID: 9, Reference: "JTEST1", Status: models.JourneyOpen}
+	if err := db.Create(&j).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := models.JourneySegment{JourneyID: j.ID, Sequence: 1, RouteID: 1, SaccoID: 1, Fare: 80}
+	if err := db.Create(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, j, s
+}
+
+// reportPayment saves a payment the commuter reported.
+func reportPayment(t *testing.T, db *gorm.DB, p models.JourneyPayment) models.JourneyPayment {
+	t.Helper()
+	p.PaidAt = time.Now()
+	if err := db.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != models.PaymentReported {
+		t.Fatalf("new payment has status %q; want %q", p.Status, models.PaymentReported)
+	}
+	return p
+}
+
+func TestReportedPaymentsIssueNoTickets(t *testing.T) {
+	db, j, s := openJourney(t)
+	reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, SegmentID: s.ID, Amount: 1000, Method: models.PaymentMobileMoney})
+
+	tickets, err := IssueTickets(db, j.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tickets) != 0 {
+		t.Fatalf("IssueTickets issued %d tickets for a payment no one confirmed", len(tickets))
+	}
+}
+
+func TestConfirmPaymentIssuesTickets(t *testing.T) {
+	db, j, s := openJourney(t)
+	p := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, Amount: 80, Method: models.PaymentCash})
+	now := time.Now()
+
+	if _, err := ConfirmPayment(db, j.Reference, p.ID, models.Vehicle{RouteID: 2, DriverID: 5}, now); !errors.Is(err, ErrPaymentWrongRoute) {
+		t.Fatalf("confirming on another route: err = %v; want ErrPaymentWrongRoute", err)
+	}
+
+	vehicle := models.Vehicle{RouteID: 1, DriverID: 5}
+	confirmation, err := ConfirmPayment(db, "jtest1", p.ID, vehicle, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, tickets := confirmation.Payment, confirmation.Tickets
+	if confirmed.Status != models.PaymentConfirmed || confirmed.ConfirmedByDriver != 5 {
+		t.Errorf("confirmed payment = %+v", confirmed)
+	}
+	if len(tickets) != 1 || tickets[0].SegmentID != s.ID {
+		t.Fatalf("tickets = %+v; want one for the ride", tickets)
+	}
+
+	if _, err := ConfirmPayment(db, j.Reference, p.ID, vehicle, now); !errors.Is(err, ErrPaymentConfirmed) {
+		t.Fatalf("confirming twice: err = %v; want ErrPaymentConfirmed", err)
+	}
+
+	used, err := UseTicket(db, tickets[0].QR, vehicle, now)
+	if err != nil || used.Status != models.TicketUsed {
+		t.Fatalf("UseTicket = %+v, %v", used, err)
+	}
+	if _, err := UseTicket(db, tickets[0].QR, vehicle, now); !errors.Is(err, ErrTicketUsed) {
+		t.Fatalf("second UseTicket: err = %v; want ErrTicketUsed", err)
+	}
+}
+
+func TestConfirmPaymentOfAnotherJourney(t *testing.T) {
+	db, j, s := openJourney(t)
+	other := models.Journey{UserID: 10, Reference: "JTEST2", Status: models.JourneyOpen}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	p := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, SegmentID: s.ID, Amount: 80, Method: models.PaymentCash})
+
+	_, err := ConfirmPayment(db, other.Reference, p.ID, models.Vehicle{RouteID: 1}, time.Now())
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("err = %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestUnderpaidRidesAreNotTicketed(t *testing.T) {
+	db, j, _ := openJourney(t)
+	p := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, Amount: 50, Method: models.PaymentCash})
+
+	confirmation, err := ConfirmPayment(db, j.Reference, p.ID, models.Vehicle{RouteID: 1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(confirmation.Tickets) != 0 {
+		t.Fatalf("issued %d tickets for 50 towards a fare of 80", len(confirmation.Tickets))
+	}
+}
+
+func TestTicketsNeedSigningKey(t *testing.T) {
+	db, j, s := openJourney(t)
+	p := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, SegmentID: s.ID, Amount: 80, Method: models.PaymentCash})
+	vehicle := models.Vehicle{RouteID: 1}
+	confirmation, err := ConfirmPayment(db, j.Reference, p.ID, vehicle, time.Now())
+	if err != nil || len(confirmation.Tickets) != 1 {
+		t.Fatalf("ConfirmPayment = %+v, %v", confirmation, err)
+	}
+	tickets := confirmation.Tickets
+
+	t.Setenv("RECEIPT_SIGNING_KEY", "")
+	if err := CheckSigningKey(); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("CheckSigningKey() = %v; want ErrNoSigningKey", err)
+	}
+	if _, err := IssueTickets(db, j.ID, time.Now()); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("IssueTickets without a key: err = %v; want ErrNoSigningKey", err)
+	}
+	if _, err := UseTicket(db, tickets[0].QR, vehicle, time.Now()); !errors.Is(err, ErrTicketInvalid) {
+		t.Fatalf("UseTicket without a key: err = %v; want ErrTicketInvalid", err)
+	}
+}
+
+func TestForgedTicketIsRejected(t *testing.T) {
+	db, j, s := openJourney(t)
+	p := reportPayment(t, db, models.JourneyPayment{JourneyID: j.ID, SegmentID: s.ID, Amount: 80, Method: models.PaymentCash})
+	vehicle := models.Vehicle{RouteID: 1}
+	confirmation, err := ConfirmPayment(db, j.Reference, p.ID, vehicle, time.Now())
+	if err != nil || len(confirmation.Tickets) != 1 {
+		t.Fatalf("ConfirmPayment = %+v, %v", confirmation, err)
+	}
+	tickets := confirmation.Tickets
+
+	t.Setenv("RECEIPT_SIGNING_KEY", "another-key")
+	if _, err := UseTicket(db, tickets[0].QR, vehicle, time.Now()); !errors.Is(err, ErrTicketInvalid) {
+		t.Fatalf("ticket signed with another key: err = %v; want ErrTicketInvalid", err)
+	}
+}
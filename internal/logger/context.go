@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"context"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// RequestIDKey is the log field, and the gin context key, holding the ID of
+// the request being handled.
+const RequestIDKey = "request_id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx: a request's context or a
+// *gin.Context, which keeps it under RequestIDKey. It is empty outside
+// requests.
+func RequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// contextHook adds the request ID to entries logged with a request's context,
+// e.g. logrus.WithContext(c).Error(...), so they can be matched with the
+// request's access log line.
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if _, set := entry.Data[RequestIDKey]; set {
+		return nil
+	}
+	if id := RequestID(entry.Context); id != "" {
+		entry.Data[RequestIDKey] = id
+	}
+	return nil
+}
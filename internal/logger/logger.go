@@ -25,6 +25,9 @@ func Setup() {
         TimestampFormat: time.RFC3339,
     })
     logrus.SetLevel(logrus.DebugLevel) // capture SQL at Debug/Info
+
+    // 3) Tag entries logged with a request's context with its request ID
+    logrus.AddHook(contextHook{})
 }
 
 // GormLogger returns the standard Logrus logger for GORM
@@ -0,0 +1,147 @@
+// Package mapmatch snaps noisy GPS traces onto the road network, either with
+// an OSRM /match service or, when none is configured, by passing them through.
+package mapmatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+)
+
+// Matcher snaps a trace to roads and returns the matched geometry.
+type Matcher interface {
+	Match(ctx context.Context, trace []geo.Point, times []time.Time) ([]geo.Point, error)
+	Name() string
+}
+
+// FromEnv selects a matcher using MAP_MATCH_PROVIDER ("osrm" or "none").
+func FromEnv() Matcher {
+	switch config.EnvString("MAP_MATCH_PROVIDER", "none") {
+	case "osrm":
+		return &OSRMMatcher{
+			URL:       strings.TrimSuffix(config.EnvString("OSRM_URL", "http://localhost:5000"), "/"),
+			Profile:   config.EnvString("OSRM_PROFILE", "driving"),
+			Radius:    config.EnvFloat("MAP_MATCH_RADIUS_METERS", 25),
+			ChunkSize: config.EnvInt("MAP_MATCH_CHUNK_SIZE", 100),
+			Client:    &http.Client{Timeout: 30 * time.Second},
+		}
+	default:
+		return Passthrough{}
+	}
+}
+
+// Passthrough returns traces unchanged.
+type Passthrough struct{}
+
+// Match returns the trace as-is.
+func (Passthrough) Match(_ context.Context, trace []geo.Point, _ []time.Time) ([]geo.Point, error) {
+	return trace, nil
+}
+
+// Name identifies the matcher.
+func (Passthrough) Name() string { return "none" }
+
+// OSRMMatcher calls an OSRM /match/v1 endpoint in chunks of ChunkSize points.
+type OSRMMatcher struct {
+	URL       string
+	Profile   string
+	Radius    float64
+	ChunkSize int
+	Client    *http.Client
+}
+
+// Name identifies the matcher.
+func (m *OSRMMatcher) Name() string { return "osrm" }
+
+type osrmResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Matchings []struct {
+		Geometry struct {
+			Coordinates [][2]float64 `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"matchings"`
+}
+
+// Match splits the trace into overlapping chunks and joins the matched pieces.
+func (m *OSRMMatcher) Match(ctx context.Context, trace []geo.Point, times []time.Time) ([]geo.Point, error) {
+	chunk := m.ChunkSize
+	if chunk < 2 {
+		chunk = 100
+	}
+	var out []geo.Point
+	for start := 0; start < len(trace)-1; start += chunk - 1 {
+		end := start + chunk
+		if end > len(trace) {
+			end = len(trace)
+		}
+		var chunkTimes []time.Time
+		if len(times) == len(trace) {
+			chunkTimes = times[start:end]
+		}
+		matched, err := m.matchChunk(ctx, trace[start:end], chunkTimes)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > 0 && len(matched) > 0 {
+			matched = matched[1:] // Chunks share their boundary point
+		}
+		out = append(out, matched...)
+	}
+	return out, nil
+}
+
+func (m *OSRMMatcher) matchChunk(ctx context.Context, trace []geo.Point, times []time.Time) ([]geo.Point, error) {
+	coords := make([]string, 0, len(trace))
+	radiuses := make([]string, 0, len(trace))
+	for _, p := range trace {
+		coords = append(coords, strconv.FormatFloat(p.Lng, 'f', 6, 64)+","+strconv.FormatFloat(p.Lat, 'f', 6, 64))
+		radiuses = append(radiuses, strconv.FormatFloat(m.Radius, 'f', 0, 64))
+	}
+	q := url.Values{}
+	q.Set("geometries", "geojson")
+	q.Set("overview", "full")
+	q.Set("gaps", "ignore")
+	q.Set("radiuses", strings.Join(radiuses, ";"))
+	if len(times) == len(trace) {
+		ts := make([]string, 0, len(times))
+		for _, t := range times {
+			ts = append(ts, strconv.FormatInt(t.Unix(), 10))
+		}
+		q.Set("timestamps", strings.Join(ts, ";"))
+	}
+	endpoint := fmt.Sprintf("%s/match/v1/%s/%s?%s", m.URL, m.Profile, strings.Join(coords, ";"), q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("map matching request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded osrmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode map matching response: %w", err)
+	}
+	if decoded.Code != "Ok" {
+		return nil, fmt.Errorf("map matching failed: %s %s", decoded.Code, decoded.Message)
+	}
+	var out []geo.Point
+	for _, matching := range decoded.Matchings {
+		for _, c := range matching.Geometry.Coordinates {
+			out = append(out, geo.Point{Lat: c[1], Lng: c[0]})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,25 @@
+package mapmatch
+
+import (
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+)
+
+// SnapTolerance is how far (meters) a live position may stray from its
+// vehicle's route and still be snapped onto it. Zero turns snapping off.
+var SnapTolerance = config.EnvFloat("MAP_MATCH_SNAP_METERS", 30)
+
+// Snap moves p onto the nearest point of line when it lies within tolerance
+// of it, returning the snapped point and p's distance from the line.
+// Positions farther away (the vehicle has left its route) are returned as-is
+// with ok false.
+func Snap(p geo.Point, line []geo.Point, tolerance float64) (snapped geo.Point, offset float64, ok bool) {
+	if len(line) == 0 {
+		return p, 0, false
+	}
+	nearest, d := geo.NearestOnLine(p, line)
+	if tolerance <= 0 || d > tolerance {
+		return p, d, false
+	}
+	return nearest, d, true
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// APIKeyHeader carries the key on requests to the public feeds.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyLimiter throttles each API key independently.
+var apiKeyLimiter = NewRateLimiter(
+	config.EnvInt("API_KEY_RATE_LIMIT_PER_MINUTE", 60),
+	config.EnvInt("API_KEY_RATE_LIMIT_BURST", 20),
+)
+
+// apiKeyClientLimiter throttles each client IP across all the keys it
+// presents, so a stream of made-up keys cannot reach the database at will.
+var apiKeyClientLimiter = NewRateLimiter(
+	config.EnvInt("API_KEY_CLIENT_RATE_LIMIT_PER_MINUTE", 300),
+	config.EnvInt("API_KEY_CLIENT_RATE_LIMIT_BURST", 60),
+)
+
+// GenerateAPIKey returns a new random key and the hash to store for it.
+func GenerateAPIKey() (key, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = "ma3_" + hex.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the stored form of key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequireAPIKey admits requests carrying an unrevoked API key and rate-limits
+// them per client and per key. Both limits apply before the key is looked up.
+// The key's ID is exposed in the context as api_key_id.
+func RequireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			apierror.Abort(c, http.StatusUnauthorized, "Missing "+APIKeyHeader+" header")
+			return
+		}
+
+		hash := HashAPIKey(key)
+		for _, limit := range []struct {
+			rl  *RateLimiter
+			key string
+		}{
+			{apiKeyClientLimiter, "apikey-client:" + c.ClientIP()},
+			{apiKeyLimiter, "apikey:" + hash},
+		} {
+			if ok, retry := limit.rl.Allow(limit.key); !ok {
+				c.Header("Retry-After", strconv.Itoa(retry))
+				apierror.Abort(c, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+		}
+
+		var apiKey models.APIKey
+		if err := config.DB.Where("key_hash = ? AND revoked_at IS NULL", hash).First(&apiKey).Error; err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid or revoked API key")
+			return
+		}
+
+		// Usage is tracked to the minute to avoid a write on every request.
+		now := time.Now()
+		if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+			if err := config.DB.Model(&apiKey).Update("last_used_at", now).Error; err != nil {
+				logrus.WithContext(c).WithError(err).WithField("api_key_id", apiKey.ID).Warn("RequireAPIKey: Failed to record key usage.")
+			}
+		}
+
+		c.Set("api_key_id", apiKey.ID)
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// Throttled requests are turned away before the key is looked up.
+func TestRequireAPIKeyLimitsBeforeLookup(t *testing.T) {
+	db := testdb.Use(t, &models.APIKey{})
+	var lookups int
+	db.Callback().Query().Before("gorm:query").Register("count_lookups", func(*gorm.DB) { lookups++ })
+	prevKey, prevClient := apiKeyLimiter, apiKeyClientLimiter
+	t.Cleanup(func() { apiKeyLimiter, apiKeyClientLimiter = prevKey, prevClient })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/feed", RequireAPIKey(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		req.Header.Set(APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	apiKeyLimiter, apiKeyClientLimiter = NewRateLimiter(1, 1), NewRateLimiter(60, 60)
+	if code := call("ma3_bogus"); code != http.StatusUnauthorized {
+		t.Fatalf("first request: status %d; want 401", code)
+	}
+	if code := call("ma3_bogus"); code != http.StatusTooManyRequests || lookups != 1 {
+		t.Errorf("same key again: status %d after %d lookups; want 429 after 1", code, lookups)
+	}
+
+	// Fresh keys from one client are capped too.
+	apiKeyLimiter, apiKeyClientLimiter = NewRateLimiter(60, 60), NewRateLimiter(1, 2)
+	lookups = 0
+	for _, key := range []string{"ma3_a", "ma3_b", "ma3_c"} {
+		call(key)
+	}
+	if lookups != 2 {
+		t.Errorf("%d lookups for three made-up keys; want 2", lookups)
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/testdb"
+)
+
+// BenchmarkRequireAuth serves an authenticated request, reporting the p95
+// latency when the caller comes from the principal cache and when every
+// request looks them up.
+func BenchmarkRequireAuth(b *testing.B) {
+	db := testdb.Use(b, &models.User{}, &models.Sacco{}, &models.Driver{})
+	principal.InvalidateAll()
+	b.Cleanup(principal.InvalidateAll)
+	db.Create(&models.User{Model: gorm.Model{ID: 1}, Email: "s@example.com", Role: "sacco"})
+	db.Create(&models.Sacco{Model: gorm.Model{ID: 1}, UserID: 1, Name: "A"})
+	token, err := GenerateToken(1, "sacco")
+	if err != nil {
+		b.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/profile", RequireAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, bc := range []struct {
+		name   string
+		cached bool
+	}{{"uncached", false}, {"cached", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			took := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !bc.cached {
+					principal.Invalidate(1)
+				}
+				req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				start := time.Now()
+				r.ServeHTTP(w, req)
+				took[i] = time.Since(start)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status %d", w.Code)
+				}
+			}
+			b.StopTimer()
+			sort.Slice(took, func(i, j int) bool { return took[i] < took[j] })
+			b.ReportMetric(float64(took[len(took)*95/100].Nanoseconds()), "p95-ns")
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Deprecation describes an endpoint that is scheduled for removal.
+type Deprecation struct {
+	Since     time.Time // When the endpoint was deprecated
+	Sunset    time.Time // When the endpoint will stop working (zero if not scheduled)
+	Successor string    // Path of the replacement endpoint, if any
+}
+
+// Deprecated marks a route as deprecated. It emits the Deprecation, Sunset and
+// Link headers and records which client called it so admins can chase
+// stragglers before the sunset date.
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		since := d.Since
+		if since.IsZero() {
+			since = time.Now()
+		}
+		c.Header("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+		if !d.Sunset.IsZero() {
+			c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Successor != "" {
+			c.Header("Link", "<"+d.Successor+">; rel=\"successor-version\"")
+		}
+
+		c.Next()
+
+		recordDeprecatedUsage(c)
+	}
+}
+
+// deprecatedUsageFlush is how often calls to deprecated endpoints, counted
+// in memory, are added to the usage table.
+var deprecatedUsageFlush = config.EnvDuration("DEPRECATED_USAGE_FLUSH_INTERVAL", time.Minute)
+
+// maxPendingUsage bounds the clients counted between flushes; calls from
+// further clients are not recorded until the next flush.
+const maxPendingUsage = 10000
+
+type usageKey struct {
+	method, path, clientID string
+	userID                 uint
+}
+
+type usageCount struct {
+	role     string
+	calls    int64
+	lastSeen time.Time
+}
+
+var (
+	usageMu      sync.Mutex
+	pendingUsage = map[usageKey]*usageCount{}
+	usageFlusher sync.Once
+)
+
+// recordDeprecatedUsage counts the call for the calling client. The counts
+// are written out by FlushDeprecatedUsage, so requests do not wait on the
+// database.
+func recordDeprecatedUsage(c *gin.Context) {
+	usageFlusher.Do(func() {
+		background.Every(deprecatedUsageFlush, func(context.Context) { FlushDeprecatedUsage() })
+	})
+
+	var userID uint
+	if v, ok := c.Get("user_id"); ok {
+		if f, ok := v.(float64); ok {
+			userID = uint(f)
+		}
+	}
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+
+	clientID := c.GetHeader("X-Client-Id")
+	if clientID == "" {
+		clientID = c.Request.UserAgent()
+	}
+
+	key := usageKey{method: c.Request.Method, path: c.FullPath(), clientID: clientID, userID: userID}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	count, ok := pendingUsage[key]
+	if !ok {
+		if len(pendingUsage) >= maxPendingUsage {
+			return
+		}
+		count = &usageCount{}
+		pendingUsage[key] = count
+	}
+	count.role, count.lastSeen = roleStr, time.Now()
+	count.calls++
+}
+
+// FlushDeprecatedUsage adds the calls counted since the last flush to the
+// usage table in one upsert. The server calls it once more on shutdown.
+func FlushDeprecatedUsage() {
+	if config.DB == nil {
+		return
+	}
+	usageMu.Lock()
+	batch := pendingUsage
+	pendingUsage = map[usageKey]*usageCount{}
+	usageMu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	rows := make([]models.DeprecatedEndpointUsage, 0, len(batch))
+	for key, count := range batch {
+		rows = append(rows, models.DeprecatedEndpointUsage{
+			Method:     key.method,
+			Path:       key.path,
+			UserID:     key.userID,
+			ClientID:   key.clientID,
+			Role:       count.role,
+			CallCount:  count.calls,
+			LastSeenAt: count.lastSeen,
+		})
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "method"}, {Name: "path"}, {Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"call_count":   gorm.Expr("deprecated_endpoint_usages.call_count + excluded.call_count"),
+			"last_seen_at": gorm.Expr("excluded.last_seen_at"),
+			"role":         gorm.Expr("excluded.role"),
+			"updated_at":   gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		logrus.WithError(err).WithField("clients", len(rows)).Warn("Deprecated: failed to record deprecated endpoint usage.")
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+func TestDeprecatedUsageFlushedInBatches(t *testing.T) {
+	db := testdb.Use(t, &models.DeprecatedEndpointUsage{})
+	usageFlusher.Do(func() {}) // Flush by hand only
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/old", Deprecated(Deprecation{Successor: "/new"}), func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(n int) {
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/old", nil)
+			req.Header.Set("X-Client-Id", "app/1.0")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	call(3)
+	var rows int64
+	db.Model(&models.DeprecatedEndpointUsage{}).Count(&rows)
+	if rows != 0 {
+		t.Fatalf("%d usage rows written during requests; want none before the flush", rows)
+	}
+	FlushDeprecatedUsage()
+	call(2)
+	FlushDeprecatedUsage()
+
+	var usage []models.DeprecatedEndpointUsage
+	db.Find(&usage)
+	if len(usage) != 1 || usage[0].CallCount != 5 || usage[0].ClientID != "app/1.0" || usage[0].Path != "/old" {
+		t.Errorf("usage = %+v; want one row for app/1.0 with 5 calls", usage)
+	}
+}
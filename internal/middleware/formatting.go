@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/format"
+)
+
+// FormatPreferencesKey is the context key holding the caller's format.Preferences.
+const FormatPreferencesKey = "format_prefs"
+
+// Formatting resolves the client's unit, currency and time zone preferences
+// once per request so handlers can render values consistently. Successful
+// JSON responses also get a "display" object next to canonical speeds (m/s),
+// distances (meters) and timestamps, rendered per the preferences by
+// format.Display; the canonical fields themselves are never changed. The
+// objects are added as the response is written (see format.Annotator), so
+// responses of any size get them. GraphQL responses are left as the query
+// shaped them.
+func Formatting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prefs := format.FromRequest(c.Request)
+		c.Set(FormatPreferencesKey, prefs)
+		c.Writer = &displayWriter{
+			ResponseWriter: c.Writer,
+			prefs:          prefs,
+			// GraphQL responses hold exactly the fields the query selected
+			graphQL: c.FullPath() == "/graphql",
+		}
+		c.Next()
+	}
+}
+
+// displayWriter passes successful JSON bodies through a format.Annotator and
+// everything else straight through.
+type displayWriter struct {
+	gin.ResponseWriter
+	prefs     format.Preferences
+	graphQL   bool
+	decided   bool // Whether the body is being annotated is settled
+	annotator *format.Annotator
+}
+
+func (w *displayWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		isJSON := strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+		if isJSON && w.Status() < http.StatusMultipleChoices && !w.graphQL {
+			w.Header().Add("Vary", "X-Units, X-Distance-Units, X-Timezone")
+			w.annotator = format.NewAnnotator(w.ResponseWriter, w.prefs)
+		}
+	}
+	if w.annotator == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.annotator.Write(b)
+}
+
+func (w *displayWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// FormatPreferences returns the preferences resolved by Formatting, or the defaults.
+func FormatPreferences(c *gin.Context) format.Preferences {
+	if v, ok := c.Get(FormatPreferencesKey); ok {
+		if p, ok := v.(format.Preferences); ok {
+			return p
+		}
+	}
+	return format.FromRequest(c.Request)
+}
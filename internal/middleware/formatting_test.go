@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apierror"
+)
+
+func formattingRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Formatting(), Localize())
+	r.GET("/positions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": []gin.H{
+			{"vehicle_id": uint64(9007199254740993), "speed": 10.0, "timestamp": "2026-10-16T09:00:00Z"},
+			{"vehicle_id": 2, "speed": nil},
+		}})
+	})
+	r.GET("/missing", func(c *gin.Context) { apierror.Respond(c, http.StatusNotFound, "Not found") })
+	r.GET("/big", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"speed": 10.0, "padding": strings.Repeat("x", 1<<20)})
+	})
+	return r
+}
+
+func TestFormattingAnnotatesJSON(t *testing.T) {
+	r := formattingRouter()
+	req := httptest.NewRequest(http.MethodGet, "/positions?units=mph&tz=UTC", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var body struct {
+		Data []map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Data) != 2 {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	first := body.Data[0]
+	if !strings.HasPrefix(w.Body.String(), `{"data":[{"speed":10,"timestamp":"2026-10-16T09:00:00Z","vehicle_id":9007199254740993,"display":`) {
+		t.Errorf("canonical fields changed or moved: %s", w.Body)
+	}
+	if string(first["vehicle_id"]) != "9007199254740993" || string(first["speed"]) != "10" {
+		t.Errorf("canonical fields changed: %s", w.Body)
+	}
+	var display struct {
+		Speed struct {
+			Unit  string  `json:"unit"`
+			Value float64 `json:"value"`
+		} `json:"speed"`
+		Timestamp string `json:"timestamp"`
+	}
+	json.Unmarshal(first["display"], &display)
+	if display.Speed.Unit != "mph" || display.Speed.Value != 22 || display.Timestamp != "2026-10-16T09:00:00Z" {
+		t.Errorf("display = %s; want 22 mph at 09:00 UTC", first["display"])
+	}
+	if _, ok := body.Data[1]["display"]; ok {
+		t.Errorf("display added for a null speed: %s", body.Data[1])
+	}
+}
+
+// Large bodies get display objects like any other.
+func TestFormattingAnnotatesLargeJSON(t *testing.T) {
+	r := formattingRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/big", nil))
+	var body struct {
+		Padding string          `json:"padding"`
+		Display json.RawMessage `json:"display"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK || len(body.Padding) != 1<<20 || body.Display == nil {
+		t.Errorf("large body: status %d, display %s, %v; want it annotated", w.Code, body.Display, err)
+	}
+}
+
+func TestFormattingLeavesErrorsAlone(t *testing.T) {
+	r := formattingRouter()
+
+	// Error responses are not annotated but still localized.
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("Accept-Language", "sw")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Haikupatikana") {
+		t.Errorf("error response: %d %s; want the Swahili 404", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+)
+
+// RoleGuest is the role carried by tokens issued to visitors without an account.
+const RoleGuest = "guest"
+
+// GuestTokenTTL bounds how long a guest token is valid.
+var GuestTokenTTL = config.EnvDuration("GUEST_TOKEN_TTL", 24*time.Hour)
+
+// guestLimiter applies tight limits to guest traffic only.
+var guestLimiter = NewRateLimiter(
+	config.EnvInt("GUEST_RATE_LIMIT_PER_MINUTE", 30),
+	config.EnvInt("GUEST_RATE_LIMIT_BURST", 10),
+)
+
+// guestSessionLimiter throttles guest sign-ins per client IP, so guest
+// tokens, and with them the per-guest limits, can't be minted at will.
+var guestSessionLimiter = NewRateLimiter(
+	config.EnvInt("GUEST_SESSION_RATE_LIMIT_PER_MINUTE", 10),
+	config.EnvInt("GUEST_SESSION_RATE_LIMIT_BURST", 20),
+)
+
+// NewGuestID returns a random identifier for a guest session.
+func NewGuestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateGuestToken issues a short-lived read-only token for a guest session.
+func GenerateGuestToken(guestID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(GuestTokenTTL)
+	claims := jwt.MapClaims{
+		"user_id":  0,
+		"role":     RoleGuest,
+		"guest_id": guestID,
+		"exp":      expiresAt.Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(secret)
+	return signed, expiresAt, err
+}
+
+// RequireAuthWithAnyRole ensures a valid JWT whose role is one of roles. Guest
+// tokens additionally expose guest_id in the context.
+func RequireAuthWithAnyRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			apierror.Abort(c, http.StatusUnauthorized, "Missing or invalid Authorization header")
+			return
+		}
+
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			return secret, nil
+		})
+		if err != nil || !token.Valid {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token claims")
+			return
+		}
+
+		c.Set("user_id", claims["user_id"])
+		c.Set("role", claims["role"])
+		if guestID, ok := claims["guest_id"].(string); ok {
+			c.Set("guest_id", guestID)
+		}
+
+		roleStr, _ := claims["role"].(string)
+		for _, r := range roles {
+			if roleStr == r {
+				if passwordChanged(c, claims) {
+					c.Next()
+				}
+				return
+			}
+		}
+		apierror.Abort(c, http.StatusForbidden, "Insufficient permissions")
+	}
+}
+
+// GuestRateLimit throttles requests made with guest tokens; other roles pass through.
+func GuestRateLimit() gin.HandlerFunc {
+	return guestLimiter.Limit(func(c *gin.Context) string {
+		if role, _ := c.Get("role"); role != RoleGuest {
+			return ""
+		}
+		guestID, _ := c.Get("guest_id")
+		id, _ := guestID.(string)
+		if id == "" {
+			return "guest:" + c.ClientIP()
+		}
+		return "guest:" + id
+	})
+}
+
+// GuestSessionRateLimit throttles requests for new guest tokens per client IP.
+func GuestSessionRateLimit() gin.HandlerFunc {
+	return guestSessionLimiter.Limit(func(c *gin.Context) string {
+		return "guest-session:" + c.ClientIP()
+	})
+}
+
+// IsGuest reports whether the request was made with a guest token.
+func IsGuest(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	return role == RoleGuest
+}
+
+// DenyGuests rejects guest tokens on endpoints that need a real account.
+func DenyGuests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsGuest(c) {
+			apierror.Abort(c, http.StatusForbidden, "This feature requires an account. Sign up to continue.")
+			return
+		}
+		c.Next()
+	}
+}
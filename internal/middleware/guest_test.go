@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGuestSessionRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/guest", GuestSessionRateLimit(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	post := func(ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/guest", nil)
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	burst := int(guestSessionLimiter.burst)
+	for i := 0; i < burst; i++ {
+		if code := post("198.51.100.7"); code != http.StatusCreated {
+			t.Fatalf("request %d: status %d; want 201", i+1, code)
+		}
+	}
+	if code := post("198.51.100.7"); code != http.StatusTooManyRequests {
+		t.Errorf("request past the burst: status %d; want 429", code)
+	}
+	if code := post("198.51.100.8"); code != http.StatusCreated {
+		t.Errorf("another client: status %d; want 201", code)
+	}
+}
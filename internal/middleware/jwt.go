@@ -8,6 +8,8 @@ import (
 	"time"
 	"os"
 	"github.com/golang-jwt/jwt/v5"
+
+	"ma3_tracker/internal/apierror"
 )
 
 var secret = []byte(getJWTSecret())
@@ -31,8 +33,9 @@ func GenerateToken(userID uint, role string) (string, error) {
 
 // Claims structure for JWT
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID  uint   `json:"user_id"`
+	Role    string `json:"role"`
+	GuestID string `json:"guest_id,omitempty"` // Set only on guest tokens
 	jwt.RegisteredClaims
 }
 
@@ -55,7 +58,7 @@ func RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid Authorization header"})
+			apierror.Abort(c, http.StatusUnauthorized, "Missing or invalid Authorization header")
 			return
 		}
 
@@ -64,15 +67,18 @@ func RequireAuth() gin.HandlerFunc {
 			return secret, nil
 		})
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["user_id"])
-			c.Set("role", claims["role"])
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token claims")
+			return
+		}
+		c.Set("user_id", claims["user_id"])
+		c.Set("role", claims["role"])
+		if !passwordChanged(c, claims) {
 			return
 		}
 
@@ -86,7 +92,7 @@ func RequireAuthWithRole(requiredRole string) gin.HandlerFunc {
 		// Validate the token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid Authorization header"})
+			apierror.Abort(c, http.StatusUnauthorized, "Missing or invalid Authorization header")
 			return
 		}
 
@@ -95,14 +101,14 @@ func RequireAuthWithRole(requiredRole string) gin.HandlerFunc {
 			return secret, nil
 		})
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
 		// Extract claims
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid token claims")
 			return
 		}
 
@@ -111,7 +117,10 @@ func RequireAuthWithRole(requiredRole string) gin.HandlerFunc {
 
 		// Check role
 		if roleStr, ok := claims["role"].(string); !ok || roleStr != requiredRole {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			apierror.Abort(c, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		if !passwordChanged(c, claims) {
 			return
 		}
 
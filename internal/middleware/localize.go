@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/i18n"
+)
+
+// LanguageKey is the context key holding the language negotiated for the
+// request.
+const LanguageKey = "language"
+
+// maxLocalizedBody bounds how much of a response Localize holds back to
+// rewrite; longer ones, like listings and exports, go out untouched.
+const maxLocalizedBody = 16 << 10
+
+// Localize translates the message of JSON error responses (see package
+// apierror), and the "message" of other responses, into the language
+// negotiated from Accept-Language. Messages missing from the catalogs stay
+// in English.
+func Localize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+		c.Set(LanguageKey, lang)
+		w := &rewritingWriter{
+			ResponseWriter: c.Writer,
+			limit:          maxLocalizedBody,
+			hold:           func(int) bool { return lang != i18n.English },
+		}
+		w.rewrite = func(body []byte) []byte {
+			body, translated := localizeBody(body, lang)
+			w.Header().Add("Vary", "Accept-Language")
+			if translated {
+				w.Header().Set("Content-Language", lang)
+			}
+			return body
+		}
+		c.Writer = w
+		c.Next()
+		w.finish()
+	}
+}
+
+// Language returns the language negotiated by Localize, or English.
+func Language(c *gin.Context) string {
+	if lang := c.GetString(LanguageKey); lang != "" {
+		return lang
+	}
+	return i18n.English
+}
+
+// localizeBody translates the message of an error envelope, or the
+// "message" string of another JSON object, reporting whether it translated
+// anything. Anything else is returned as is.
+func localizeBody(body []byte, lang string) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, false
+	}
+	if raw, ok := fields["error"]; ok {
+		inner, translated := localizeBody(raw, lang)
+		if !translated {
+			return body, false
+		}
+		fields["error"] = inner
+	} else {
+		var text string
+		if raw, ok := fields["message"]; !ok || json.Unmarshal(raw, &text) != nil {
+			return body, false
+		}
+		_, localized, ok := i18n.Localize(lang, text)
+		if !ok || localized == text {
+			return body, false
+		}
+		fields["message"], _ = json.Marshal(localized)
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body, false
+	}
+	return out, true
+}
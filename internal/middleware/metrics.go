@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route and handler.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "handler"})
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being handled.",
+	})
+)
+
+// knownMethods are the request methods given a series of their own; any
+// other method is labelled "OTHER" so clients cannot mint new series at will.
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+// Metrics counts and times requests by route template, so /sacco/routes/1
+// and /sacco/routes/2 share a series; requests no route matched are
+// labelled "unmatched", and unknown methods "OTHER". WebSocket upgrades are
+// counted but not timed, as they last as long as the connection.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			return
+		}
+		handler := "unmatched"
+		if route != "unmatched" {
+			handler = c.HandlerName()[strings.LastIndex(c.HandlerName(), "/")+1:]
+		}
+		httpDuration.WithLabelValues(method, route, handler).Observe(time.Since(start).Seconds())
+	}
+}
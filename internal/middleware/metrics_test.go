@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsLabelsUnknownMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.Use(Metrics())
+	r.GET("/metrics-test", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, method := range []string{"BREW", "PROPFIND", http.MethodGet} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/metrics-test", nil))
+	}
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	out := string(body)
+	if strings.Contains(out, `method="BREW"`) || strings.Contains(out, `method="PROPFIND"`) {
+		t.Error("request method used as a label value as sent")
+	}
+	if !strings.Contains(out, `method="OTHER"`) || !strings.Contains(out, `method="GET",route="/metrics-test"`) {
+		t.Errorf("missing OTHER or GET series in:\n%s", out)
+	}
+}
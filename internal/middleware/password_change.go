@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+)
+
+// passwordChangeRoute is the one endpoint open to a user who must change
+// their password.
+const (
+	passwordChangeMethod = http.MethodPut
+	passwordChangeRoute  = "/api/change-password"
+)
+
+// PasswordChangeRequired reports whether the user still signs in with a
+// temporary password and so may do nothing but change it.
+func PasswordChangeRequired(userID uint) (bool, error) {
+	if userID == 0 {
+		return false, nil // Guests have no password
+	}
+	var user models.User
+	if err := principal.Lookup(&user, userID); err != nil {
+		return false, err
+	}
+	return user.MustChangePassword, nil
+}
+
+// passwordChanged aborts a request from a user who must change their
+// password first, with 403 password_change_required, unless it is the
+// password change itself. It reports whether the request may go on.
+func passwordChanged(c *gin.Context, claims jwt.MapClaims) bool {
+	if c.Request.Method == passwordChangeMethod && c.FullPath() == passwordChangeRoute {
+		return true
+	}
+	userID, _ := claims["user_id"].(float64)
+	required, err := PasswordChangeRequired(uint(userID))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apierror.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
+		return false
+	case err != nil:
+		logrus.WithContext(c).WithError(err).WithField("user_id", uint(userID)).Error("passwordChanged: Failed to load user.")
+		apierror.Fail(c, apierror.Internal("Failed to load user", err))
+		c.Abort()
+		return false
+	case required:
+		apierror.Fail(c, apierror.New(http.StatusForbidden, "Change your password to continue").WithCode("password_change_required"))
+		c.Abort()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/testdb"
+)
+
+func TestPasswordChangeRequired(t *testing.T) {
+	db := testdb.Use(t, &models.User{}, &models.Sacco{}, &models.Driver{})
+	principal.InvalidateAll()
+	t.Cleanup(principal.InvalidateAll)
+	user := models.User{Model: gorm.Model{ID: 1}, Email: "d@example.com", Role: "driver", MustChangePassword: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, err := GenerateToken(user.ID, user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api := r.Group("/api", RequireAuth())
+	api.PUT("/change-password", ok)
+	api.GET("/profile", ok)
+	r.GET("/driver/trips", RequireAuthWithRole("driver"), ok)
+	r.POST("/graphql", RequireAuthWithAnyRole("driver", "commuter"), ok)
+	call := func(method, path string) (int, string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Error.Code
+	}
+
+	if code, _ := call(http.MethodPut, "/api/change-password"); code != http.StatusOK {
+		t.Errorf("password change: status %d; want 200", code)
+	}
+	for _, tc := range [][2]string{{http.MethodGet, "/api/profile"}, {http.MethodGet, "/driver/trips"}, {http.MethodPost, "/graphql"}} {
+		if code, errCode := call(tc[0], tc[1]); code != http.StatusForbidden || errCode != "password_change_required" {
+			t.Errorf("%s %s: status %d, code %q; want 403 password_change_required", tc[0], tc[1], code, errCode)
+		}
+	}
+
+	db.Model(&user).Update("must_change_password", false)
+	principal.Invalidate(user.ID)
+	if code, _ := call(http.MethodGet, "/api/profile"); code != http.StatusOK {
+		t.Errorf("after the change: status %d; want 200", code)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/config"
+)
+
+// paymentLimiter throttles how often each user can have a payment prompt
+// sent to their phone.
+var paymentLimiter = NewRateLimiter(
+	config.EnvInt("MPESA_RATE_LIMIT_PER_MINUTE", 3),
+	config.EnvInt("MPESA_RATE_LIMIT_BURST", 3),
+)
+
+// PaymentRateLimit throttles payment requests per authenticated user, or per
+// client IP before authentication.
+func PaymentRateLimit() gin.HandlerFunc {
+	return paymentLimiter.Limit(func(c *gin.Context) string {
+		if userID, ok := c.Get("user_id"); ok {
+			return fmt.Sprint("user:", userID)
+		}
+		return "ip:" + c.ClientIP()
+	})
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apierror"
+)
+
+// RateLimiter is an in-memory token bucket keyed by an arbitrary client key.
+type RateLimiter struct {
+	rate    float64 // tokens added per second
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows perMinute requests per key with bursts of up to burst.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+	go rl.sweep()
+	return rl
+}
+
+// Allow consumes a token for key and reports whether the request may proceed,
+// along with the seconds to wait before retrying when it may not.
+func (rl *RateLimiter) Allow(key string) (bool, int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.lastSeen).Seconds() * rl.rate
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		retry := int((1-b.tokens)/rl.rate) + 1
+		return false, retry
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (rl *RateLimiter) sweep() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		idle := time.Duration(rl.burst/rl.rate) * time.Second
+		rl.mu.Lock()
+		for k, b := range rl.buckets {
+			if time.Since(b.lastSeen) > idle {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// Limit rejects requests with 429 once the key returned by keyFn runs out of
+// tokens. Requests for which keyFn returns "" are not limited.
+func (rl *RateLimiter) Limit(keyFn func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFn(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if ok, retry := rl.Allow(key); !ok {
+			c.Header("Retry-After", strconv.Itoa(retry))
+			apierror.Abort(c, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
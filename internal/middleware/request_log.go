@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"ma3_tracker/internal/logger"
+)
+
+// RequestIDHeader carries a request's ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLog gives every request an ID, taken from the X-Request-ID header
+// when the caller (or a proxy) sent a usable one, and echoes it back. Logs
+// written with the request's context carry it (see logger.RequestID), and
+// once the request is handled one structured line records the method, route,
+// status, latency and, when known, the user and sacco.
+func RequestLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(logger.RequestIDKey, id)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		fields := logrus.Fields{
+			logger.RequestIDKey: id,
+			"method":            c.Request.Method,
+			"route":             loggedRoute(c),
+			"status":            status,
+			"latency_ms":        float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":         c.ClientIP(),
+			"bytes":             c.Writer.Size(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := userID.(float64); ok { // JWT claims decode numbers as float64
+				userID = uint(id)
+			}
+			fields["user_id"] = userID
+		}
+		if saccoID, ok := c.Get("sacco_id"); ok {
+			fields["sacco_id"] = saccoID
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.String()
+		}
+		entry := logrus.WithFields(fields)
+		switch {
+		case status >= 500:
+			entry.Error("HTTP request")
+		case status >= 400:
+			entry.Warn("HTTP request")
+		default:
+			entry.Info("HTTP request")
+		}
+	}
+}
+
+// loggedRoute names the request's route by its pattern, e.g.
+// /payments/mpesa/callback/:token, never the path itself: paths can carry
+// secrets such as the M-Pesa callback token. Requests no route matched are
+// logged as unmatched.
+func loggedRoute(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// validRequestID accepts IDs of up to 128 visible ASCII characters, so a
+// caller can't inject line breaks or huge values into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
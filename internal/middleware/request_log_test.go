@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRequestLogOmitsPathSecrets(t *testing.T) {
+	var out bytes.Buffer
+	prevOut, prevFormatter := logrus.StandardLogger().Out, logrus.StandardLogger().Formatter
+	logrus.SetOutput(&out)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer func() {
+		logrus.SetOutput(prevOut)
+		logrus.SetFormatter(prevFormatter)
+	}()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestLog())
+	r.POST("/payments/mpesa/callback/:token", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/payments/mpesa/callback/s3cret-token", "/s3cret-token/elsewhere"} {
+		out.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+		line := out.String()
+		if strings.Contains(line, "s3cret-token") {
+			t.Errorf("%s: log line carries the path: %s", path, line)
+		}
+		if !strings.Contains(line, `"route"`) {
+			t.Errorf("%s: log line has no route: %s", path, line)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rewritingWriter holds back JSON bodies that may need rewriting until the
+// handler is done, and passes everything else straight through, as do bodies
+// that grow past limit.
+type rewritingWriter struct {
+	gin.ResponseWriter
+	limit   int
+	hold    func(status int) bool    // Whether a JSON response with status may need rewriting
+	rewrite func(body []byte) []byte // Called by finish with the held-back body
+
+	status    int
+	decided   bool // Whether the body is being held back is settled
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (w *rewritingWriter) WriteHeader(code int) {
+	if w.decided && !w.buffering {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *rewritingWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *rewritingWriter) Written() bool {
+	return w.decided || w.ResponseWriter.Written()
+}
+
+func (w *rewritingWriter) Size() int {
+	if w.buffering {
+		return w.buf.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// decide settles whether the body needs holding back.
+func (w *rewritingWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	isJSON := strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	w.buffering = isJSON && w.hold(w.Status())
+	if !w.buffering && w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// passThrough sends what was held back unchanged and stops holding back.
+func (w *rewritingWriter) passThrough() error {
+	w.buffering = false
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *rewritingWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		if w.buf.Len()+len(b) <= w.limit {
+			return w.buf.Write(b)
+		}
+		if err := w.passThrough(); err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *rewritingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *rewritingWriter) WriteHeaderNow() {
+	if !w.buffering {
+		w.decide()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *rewritingWriter) Flush() {
+	if w.buffering {
+		w.passThrough()
+	}
+	w.decided = true
+	w.ResponseWriter.Flush()
+}
+
+// finish writes out the held-back body, rewritten, or the status of a
+// response that had none.
+func (w *rewritingWriter) finish() {
+	if !w.decided {
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	if !w.buffering {
+		return
+	}
+	w.buffering = false
+	body := w.rewrite(w.buf.Bytes())
+	w.ResponseWriter.WriteHeader(w.Status())
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// TrackerTokenHeader carries the token of a GPS tracker fitted to a vehicle.
+const TrackerTokenHeader = "X-Tracker-Token"
+
+// trackerLimiter throttles each vehicle's tracker independently.
+var trackerLimiter = NewRateLimiter(
+	config.EnvInt("TRACKER_RATE_LIMIT_PER_MINUTE", 120),
+	config.EnvInt("TRACKER_RATE_LIMIT_BURST", 30),
+)
+
+// RequireTrackerToken admits requests from a vehicle's tracker. Tokens are
+// issued per vehicle with GenerateAPIKey and stored hashed. The vehicle is
+// exposed in the context as tracker_vehicle.
+func RequireTrackerToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(TrackerTokenHeader)
+		if token == "" {
+			apierror.Abort(c, http.StatusUnauthorized, "Missing "+TrackerTokenHeader+" header")
+			return
+		}
+
+		var vehicle models.Vehicle
+		if err := config.DB.Where("tracker_token_hash = ?", HashAPIKey(token)).First(&vehicle).Error; err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, "Invalid or revoked tracker token")
+			return
+		}
+
+		if ok, retry := trackerLimiter.Allow("tracker:" + strconv.FormatUint(uint64(vehicle.ID), 10)); !ok {
+			c.Header("Retry-After", strconv.Itoa(retry))
+			apierror.Abort(c, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		c.Set("tracker_vehicle", vehicle)
+		c.Next()
+	}
+}
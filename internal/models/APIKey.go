@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey grants an external organization, such as a county transport
+// authority or newsroom, access to the public data feeds. Only the SHA-256
+// hash of the key is stored.
+type APIKey struct {
+	gorm.Model
+
+	Name         string     `json:"name"`
+	Organization string     `json:"organization"`
+	Prefix       string     `json:"prefix"` // First characters of the key, to tell keys apart
+	KeyHash      string     `json:"-" gorm:"uniqueIndex"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,39 @@
+package models
+
+// Accessibility needs a commuter can declare.
+const (
+	AccessibilityWheelchair = "wheelchair"
+	AccessibilityLowStep    = "low_step"
+)
+
+// VehicleAmenities describes the accessibility features of a vehicle.
+type VehicleAmenities struct {
+	Wheelchair bool `json:"wheelchair"` // Ramp or lift and a secured wheelchair space
+	LowStep    bool `json:"low_step"`   // Low floor or low first step
+}
+
+// Serves reports whether the vehicle meets the accessibility need.
+func (a VehicleAmenities) Serves(need string) bool {
+	switch need {
+	case AccessibilityWheelchair:
+		return a.Wheelchair
+	case AccessibilityLowStep:
+		return a.LowStep || a.Wheelchair
+	default:
+		return true
+	}
+}
+
+// StopAmenities describes the accessibility features of a boarding point.
+type StopAmenities struct {
+	StepFree bool `json:"step_free"` // Level or ramped access from the street to the boarding point
+	Shelter  bool `json:"shelter"`
+}
+
+// Serves reports whether the stop meets the accessibility need.
+func (a StopAmenities) Serves(need string) bool {
+	if need == AccessibilityWheelchair {
+		return a.StepFree
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Bulk message states.
+const (
+	BulkMessageSending   = "sending"
+	BulkMessageCompleted = "completed"
+)
+
+// Per-recipient delivery outcomes.
+const (
+	DeliveryDelivered   = "delivered"
+	DeliveryUnreachable = "unreachable" // Offline, or no phone number on file
+	DeliveryFailed      = "failed"
+)
+
+// BulkMessage is a message sent by an admin or sacco to a cohort of users.
+// Notices raised by the platform itself have SenderUserID 0.
+type BulkMessage struct {
+	gorm.Model
+	SenderUserID uint       `json:"sender_user_id" gorm:"index"`
+	SaccoID      uint       `json:"sacco_id" gorm:"index"` // 0 when sent by an admin
+	Cohort       string     `json:"cohort"`                // route_drivers, sacco_drivers, all_drivers or sacco_owners
+	CohortFilter string     `json:"cohort_filter"`         // Route ID, sacco ID or region the cohort was narrowed by
+	Title        string     `json:"title"`
+	Body         string     `json:"body"`
+	Channels     string     `json:"channels"` // Comma-separated channel names
+	Recipients   int        `json:"recipients"`
+	Status       string     `json:"status" gorm:"index"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// BulkMessageDelivery records the outcome of one message on one channel for one recipient.
+type BulkMessageDelivery struct {
+	gorm.Model
+	BulkMessageID uint       `json:"bulk_message_id" gorm:"index"`
+	UserID        uint       `json:"user_id" gorm:"index"`
+	DriverID      uint       `json:"driver_id,omitempty"`
+	Channel       string     `json:"channel"`
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
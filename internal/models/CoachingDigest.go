@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CoachingDigest is a driver's weekly summary of driving events. Saccos use
+// AcknowledgedAt to verify the driver reviewed it.
+type CoachingDigest struct {
+	gorm.Model
+
+	DriverID  uint      `json:"driver_id" gorm:"uniqueIndex:idx_coaching_driver_week,priority:1"`
+	SaccoID   uint      `json:"sacco_id" gorm:"index"`
+	WeekStart time.Time `json:"week_start" gorm:"uniqueIndex:idx_coaching_driver_week,priority:2"` // Monday 00:00 local time
+
+	SpeedingCount          int     `json:"speeding_count"`
+	HarshBrakingCount      int     `json:"harsh_braking_count"`
+	HarshAccelerationCount int     `json:"harsh_acceleration_count"`
+	MaxSpeed               float64 `json:"max_speed"` // m/s
+	Summary                string  `json:"summary"`
+
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	DriverComment  string     `json:"driver_comment,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// CommuterFavorite is a route (and optionally a stage on it) a commuter saved
+// for quick access.
+type CommuterFavorite struct {
+	gorm.Model
+	UserID  uint   `json:"user_id" gorm:"uniqueIndex:idx_favorite_user_route_stage"`
+	RouteID uint   `json:"route_id" gorm:"uniqueIndex:idx_favorite_user_route_stage"`
+	StageID uint   `json:"stage_id" gorm:"uniqueIndex:idx_favorite_user_route_stage"` // 0 when the whole route is saved
+	Label   string `json:"label"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// CommuterPreference holds a commuter's journey planning preferences.
+type CommuterPreference struct {
+	gorm.Model
+	UserID        uint   `json:"user_id" gorm:"uniqueIndex"`
+	Accessibility string `json:"accessibility"` // wheelchair, low_step or empty
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommuterWatch asks for an alert when a vehicle (VehicleID), or any vehicle
+// on the stage's route when VehicleID is 0, is expected at a stage within
+// WithinMinutes. A watch fires once; TriggeredAt records when.
+type CommuterWatch struct {
+	gorm.Model
+	UserID        uint       `json:"user_id" gorm:"index"`
+	RouteID       uint       `json:"route_id" gorm:"index:idx_commuter_watches_route_active,priority:1"`
+	StageID       uint       `json:"stage_id"`
+	VehicleID     uint       `json:"vehicle_id,omitempty"`
+	WithinMinutes int        `json:"within_minutes"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"index:idx_commuter_watches_route_active,priority:2"`
+	TriggeredAt   *time.Time `json:"triggered_at,omitempty"`
+	// Vehicle that set the watch off and its ETA at the time
+	TriggeredVehicleID uint    `json:"triggered_vehicle_id,omitempty"`
+	TriggeredETA       float64 `json:"triggered_eta_seconds,omitempty"`
+
+	Stage *Stage `json:"stage,omitempty" gorm:"foreignKey:StageID"`
+}
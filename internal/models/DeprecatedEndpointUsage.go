@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeprecatedEndpointUsage tracks which clients still call endpoints that are
+// scheduled for removal. One row exists per endpoint/user/client combination
+// and is bumped on every call.
+type DeprecatedEndpointUsage struct {
+	gorm.Model
+	Method     string    `json:"method" gorm:"uniqueIndex:idx_deprecated_usage_client"`
+	Path       string    `json:"path" gorm:"uniqueIndex:idx_deprecated_usage_client"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_deprecated_usage_client"`
+	ClientID   string    `json:"client_id" gorm:"uniqueIndex:idx_deprecated_usage_client"` // X-Client-Id header, falls back to User-Agent
+	Role       string    `json:"role"`
+	CallCount  int64     `json:"call_count"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Platforms a device token can be registered for.
+const (
+	DevicePlatformAndroid = "android"
+	DevicePlatformIOS     = "ios"
+	DevicePlatformWeb     = "web"
+)
+
+// DeviceToken is the push notification token of one app install, so the
+// user can be notified while the app is in the background. A token belongs
+// to whoever last registered it on the device, and is deleted outright when
+// unregistered or reported stale by the push service.
+type DeviceToken struct {
+	gorm.Model
+	UserID     uint      `json:"user_id" gorm:"index"`
+	Token      string    `json:"token" gorm:"uniqueIndex"`
+	Platform   string    `json:"platform"`
+	LastSeenAt time.Time `json:"last_seen_at"` // Last registration from the device
+}
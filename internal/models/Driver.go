@@ -14,7 +14,14 @@ type Driver struct {
     Name            string `json:"name"`                  // Driver's specific name (if different from User.Name)
     Phone           string `json:"phone"`                 // Driver's specific phone (if different from User.Phone)
     LicenseNumber   string `json:"license_number"`
-    SaccoID         uint   `json:"sacco_id"` // Foreign key to Sacco
+    SaccoID         uint   `json:"sacco_id" gorm:"index"` // Foreign key to Sacco
     Sacco           Sacco  `gorm:"foreignKey:SaccoID"` // Sacco association
+
+    // Storage keys of uploaded media. The license and PSV badge scans are
+    // private and only served through signed links.
+    PhotoKey        string `json:"-"`
+    LicenseScanKey  string `json:"-"`
+    BadgeScanKey    string `json:"-"`
+    PhotoURL        string `json:"photo_url,omitempty" gorm:"-"` // Filled in for API responses
     // DO NOT include Email, Password, or Role here. They are in the User model.
 }
\ No newline at end of file
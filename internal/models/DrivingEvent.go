@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Driving event kinds detected from location updates.
+const (
+	DrivingEventSpeeding          = "speeding"
+	DrivingEventHarshBraking      = "harsh_braking"
+	DrivingEventHarshAcceleration = "harsh_acceleration"
+)
+
+// DrivingEvent is a speeding or harsh-driving incident detected from a driver's GPS stream.
+type DrivingEvent struct {
+	gorm.Model
+
+	DriverID   uint      `json:"driver_id" gorm:"index:idx_driving_events_driver_time,priority:1"`
+	VehicleID  uint      `json:"vehicle_id" gorm:"index"`      // Zero for events recorded before vehicles were kept
+	Source     string    `json:"source" gorm:"default:driver"` // LocationSource of the fixes the event came from
+	SaccoID    uint      `json:"sacco_id" gorm:"index"`
+	Kind       string    `json:"kind"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Speed      float64   `json:"speed"`     // m/s at the time of the event
+	Value      float64   `json:"value"`     // Speed (m/s) for speeding, acceleration (m/s²) otherwise
+	Threshold  float64   `json:"threshold"` // Limit that was exceeded, same unit as Value
+	OccurredAt time.Time `json:"occurred_at" gorm:"index:idx_driving_events_driver_time,priority:2"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Export job kinds and states.
+const (
+	ExportKindLocationHistory = "location_history"
+	ExportKindGTFS            = "gtfs"
+	ExportKindAdherence       = "adherence_rollup"
+
+	ExportFormatCSV     = "csv"
+	ExportFormatGeoJSON = "geojson"
+	ExportFormatGPX     = "gpx"
+	ExportFormatZip     = "zip"
+
+	ExportStatusQueued    = "queued"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+	ExportStatusExpired   = "expired"
+)
+
+// ExportJob tracks a long-running export whose result is written to object storage.
+type ExportJob struct {
+	gorm.Model
+
+	UserID  uint   `json:"user_id" gorm:"index"`
+	SaccoID uint   `json:"sacco_id" gorm:"index"`
+	Kind    string `json:"kind"`
+	Format  string `json:"format"` // One of the kind's formats; empty on jobs from before formats existed
+
+	// Optional time window for history exports
+	From *time.Time `json:"from,omitempty" gorm:"column:range_from"`
+	To   *time.Time `json:"to,omitempty" gorm:"column:range_to"`
+
+	// Optional narrowing of location history exports to one driver or vehicle
+	DriverID  *uint `json:"driver_id,omitempty"`
+	VehicleID *uint `json:"vehicle_id,omitempty"`
+
+	// Pseudonymize replaces driver IDs with rotating pseudonyms (see internal/pseudonym)
+	Pseudonymize bool `json:"pseudonymize"`
+
+	JobID       uint       `json:"job_id,omitempty"` // Background job running it; 0 on exports from before the job queue
+	Status      string     `json:"status" gorm:"default:queued;index"`
+	Progress    int        `json:"progress"` // Percentage 0-100
+	Error       string     `json:"error,omitempty"`
+	ResultKey   string     `json:"-"`
+	FileName    string     `json:"file_name,omitempty"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" gorm:"index"` // Result is deleted after this
+}
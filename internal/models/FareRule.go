@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FareRule is how a sacco prices rides on one of its routes from
+// EffectiveFrom until EffectiveUntil, or indefinitely. When several rules
+// are in force the one that took effect last applies, so a short rule (say
+// for heavy rain or a holiday) can be scheduled over a standing one.
+type FareRule struct {
+	gorm.Model
+	RouteID        uint       `json:"route_id" gorm:"index:idx_fare_rules_route_from,priority:1"`
+	SaccoID        uint       `json:"sacco_id" gorm:"index"`
+	Name           string     `json:"name"`
+	EffectiveFrom  time.Time  `json:"effective_from" gorm:"index:idx_fare_rules_route_from,priority:2"`
+	EffectiveUntil *time.Time `json:"effective_until,omitempty"`
+
+	// BaseFare and PerKm price stage pairs missing from the route's fare
+	// matrix, in place of the defaults, when set.
+	BaseFare *float64 `json:"base_fare,omitempty"`
+	PerKm    *float64 `json:"per_km,omitempty"`
+	// PeakWindows are time-of-day multipliers in the FARE_TIME_RULES format,
+	// e.g. "06:00-09:00*1.2,17:00-20:00*1.3". When empty the default
+	// windows apply.
+	PeakWindows string `json:"peak_windows,omitempty"`
+	// Multiplier applies to every ride while the rule is in force.
+	Multiplier float64 `json:"multiplier" gorm:"default:1"`
+	// DemandMultiplier applies to rides boarding at a stop whose crowding
+	// score (0 to 100) is at least DemandThreshold. 0 disables it.
+	DemandMultiplier float64 `json:"demand_multiplier,omitempty"`
+	DemandThreshold  float64 `json:"demand_threshold,omitempty"`
+}
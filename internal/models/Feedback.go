@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Feedback kinds.
+const (
+	FeedbackComplaint  = "complaint"
+	FeedbackCompliment = "compliment"
+)
+
+// Feedback categories a commuter can file under.
+const (
+	FeedbackRecklessDriving = "reckless_driving"
+	FeedbackOvercharging    = "overcharging"
+	FeedbackHarassment      = "harassment"
+	FeedbackOverloading     = "overloading"
+	FeedbackCleanliness     = "cleanliness"
+	FeedbackService         = "service" // Courtesy, punctuality and the like
+	FeedbackOther           = "other"
+)
+
+// Feedback triage states. The sacco takes feedback on and resolves it,
+// leaving a note for the commuter.
+const (
+	FeedbackOpen       = "open"
+	FeedbackInProgress = "in_progress"
+	FeedbackResolved   = "resolved"
+)
+
+// Feedback is a commuter's complaint or compliment about a sacco's vehicle,
+// driver or route; at least one of them is set, and all belong to SaccoID.
+// The optional photo is stored privately under PhotoKey.
+type Feedback struct {
+	gorm.Model
+	UserID    uint   `json:"user_id" gorm:"index"`
+	SaccoID   uint   `json:"sacco_id" gorm:"index:idx_feedback_sacco_status,priority:1"`
+	VehicleID uint   `json:"vehicle_id,omitempty" gorm:"index"`
+	DriverID  uint   `json:"driver_id,omitempty" gorm:"index"`
+	RouteID   uint   `json:"route_id,omitempty"`
+	Kind      string `json:"kind"`
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+	PhotoKey  string `json:"-"`
+	PhotoURL  string `json:"photo_url,omitempty" gorm:"-"` // Short-lived link to the photo
+
+	OccurredAt *time.Time `json:"occurred_at,omitempty"` // When it happened, if the commuter says
+	Status     string     `json:"status" gorm:"index:idx_feedback_sacco_status,priority:2"`
+	Resolution string     `json:"resolution,omitempty"` // The sacco's note to the commuter
+	HandledBy  uint       `json:"handled_by,omitempty"` // User who last changed the status
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GuestSession records a guest token issued to a visitor without an account,
+// and the commuter account it was converted into, if any.
+type GuestSession struct {
+	gorm.Model
+	GuestID         string     `json:"guest_id" gorm:"uniqueIndex"`
+	ClientIP        string     `json:"client_ip"`
+	UserAgent       string     `json:"user_agent"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	ConvertedUserID *uint      `json:"converted_user_id,omitempty" gorm:"index"`
+	ConvertedAt     *time.Time `json:"converted_at,omitempty"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Incident kinds. Hazards and congestion are detected from the GPS stream;
+// closures and service disruptions are recorded by admins.
+const (
+	IncidentHazard            = "hazard"     // Cluster of harsh braking by several vehicles
+	IncidentCongestion        = "congestion" // Several vehicles crawling away from any stage
+	IncidentClosure           = "closure"
+	IncidentServiceDisruption = "service_disruption"
+)
+
+// Incident severities.
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Incident review states. Only verified incidents are published in the feed.
+const (
+	IncidentDetected  = "detected"
+	IncidentVerified  = "verified"
+	IncidentDismissed = "dismissed"
+)
+
+// Incident is a road incident or service disruption. Detected incidents carry
+// aggregate counts only; the drivers and vehicles behind them are not stored.
+type Incident struct {
+	gorm.Model
+
+	Kind         string     `json:"kind" gorm:"index"`
+	Severity     string     `json:"severity"`
+	Status       string     `json:"status" gorm:"default:detected;index"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Latitude     float64    `json:"latitude"`
+	Longitude    float64    `json:"longitude"`
+	RadiusM      float64    `json:"radius_m"`      // Zero for route-wide disruptions without a location
+	VehicleCount int        `json:"vehicle_count"` // Distinct vehicles behind the latest detection
+	EventCount   int        `json:"event_count"`
+	StartedAt    time.Time  `json:"started_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at" gorm:"index"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty" gorm:"index"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+
+	Routes []Route `json:"routes,omitempty" gorm:"many2many:incident_routes;"`
+}
+
+// Active reports whether the incident has not been resolved.
+func (i Incident) Active() bool {
+	return i.ResolvedAt == nil
+}
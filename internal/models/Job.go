@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Background job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed" // Gave up after its last attempt
+)
+
+// Job is a unit of background work for the job workers (see internal/jobs).
+// A failed attempt is retried later until MaxAttempts is reached.
+type Job struct {
+	gorm.Model
+
+	Kind    string `json:"kind" gorm:"index"`
+	Payload []byte `json:"-" gorm:"type:jsonb"`   // JSON arguments for the kind's handler
+	UserID  uint   `json:"user_id" gorm:"index"`  // Who queued it; 0 for the platform
+	SaccoID uint   `json:"sacco_id" gorm:"index"` // 0 when not sacco work
+
+	Status      string     `json:"status" gorm:"default:queued;index:idx_jobs_ready,priority:1"`
+	RunAt       time.Time  `json:"run_at" gorm:"index:idx_jobs_ready,priority:2"` // Not started before this
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	LockedUntil *time.Time `json:"-"` // End of the running worker's lease; the job is retried if it lapses
+	LeaseToken  string     `json:"-"` // Set by each claim; a worker whose lease was taken over can no longer update the job
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Journey lifecycle states.
+const (
+	JourneyOpen      = "open"
+	JourneyCompleted = "completed"
+)
+
+// Validation states of a journey segment.
+const (
+	SegmentPending   = "pending"   // Not yet checked by a crew
+	SegmentValidated = "validated" // Checked on board a vehicle serving the route
+	SegmentSkipped   = "skipped"   // The journey ended without the leg being checked
+)
+
+// Ways a journey payment can be made.
+const (
+	PaymentCash        = "cash"
+	PaymentMobileMoney = "mobile_money"
+	PaymentCard        = "card"
+)
+
+// States of a journey payment. Payments commuters report themselves stay
+// reported until a crew confirms them; M-Pesa payments are confirmed when
+// Safaricom settles them. Only confirmed payments pay for tickets.
+const (
+	PaymentReported  = "reported"
+	PaymentConfirmed = "confirmed"
+)
+
+// Journey is a commuter's door-to-door trip, possibly made on several
+// matatus with transfers in between. It carries one reference and produces a
+// single receipt covering every segment and payment.
+type Journey struct {
+	gorm.Model
+
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Reference   string     `json:"reference" gorm:"uniqueIndex"`
+	Status      string     `json:"status" gorm:"default:open;index"`
+	Currency    string     `json:"currency"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	Segments []JourneySegment `json:"segments" gorm:"foreignKey:JourneyID"`
+	Payments []JourneyPayment `json:"payments" gorm:"foreignKey:JourneyID"`
+}
+
+// JourneySegment is one matatu ride within a journey. Vehicle and driver are
+// filled in when a crew validates the segment on board.
+type JourneySegment struct {
+	gorm.Model
+
+	JourneyID        uint       `json:"journey_id" gorm:"index"`
+	Sequence         int        `json:"sequence"`
+	RouteID          uint       `json:"route_id" gorm:"index"`
+	SaccoID          uint       `json:"sacco_id" gorm:"index"`
+	BoardStageID     uint       `json:"board_stage_id"`
+	AlightStageID    uint       `json:"alight_stage_id"`
+	Fare             float64    `json:"fare"` // 0 until the fare is known
+	ValidationStatus string     `json:"validation_status" gorm:"default:pending"`
+	ValidatedAt      *time.Time `json:"validated_at,omitempty"`
+	VehicleID        uint       `json:"vehicle_id,omitempty" gorm:"index"`
+	DriverID         uint       `json:"driver_id,omitempty" gorm:"index"`
+}
+
+// JourneyPayment is money paid towards a journey, either for one segment or
+// for the journey as a whole (SegmentID 0).
+type JourneyPayment struct {
+	gorm.Model
+
+	JourneyID uint      `json:"journey_id" gorm:"index"`
+	SegmentID uint      `json:"segment_id,omitempty"`
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Reference string    `json:"reference,omitempty"` // e.g. the mobile money transaction code
+	PaidAt    time.Time `json:"paid_at"`
+
+	Status            string     `json:"status" gorm:"default:reported;index"`
+	ConfirmedAt       *time.Time `json:"confirmed_at,omitempty"`
+	ConfirmedByDriver uint       `json:"confirmed_by_driver,omitempty"` // 0 for payments a provider settled
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LocationDownsampleRun records one day of location history thinned by
+// internal/downsample. The latest run's Through is where the next one
+// resumes, so no point is thinned twice.
+type LocationDownsampleRun struct {
+	gorm.Model
+	From    time.Time `json:"from"`
+	Through time.Time `json:"through" gorm:"index"`
+	Streams int       `json:"streams"` // Distinct source, vehicle and driver combinations
+	Kept    int64     `json:"kept"`
+	Deleted int64     `json:"deleted"`
+}
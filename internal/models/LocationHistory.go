@@ -5,18 +5,37 @@ import (
 	"gorm.io/gorm"
 )
 
+// Where a location point was reported from.
+const (
+	LocationSourceDriver  = "driver"  // The driver's app; VehicleID is derived
+	LocationSourceTracker = "tracker" // A device fitted to the vehicle; DriverID is derived
+)
+
+// LocationHistory is one GPS point. The reporting side (see Source) is always
+// set; the other side is looked up from the vehicle's assignments and may be 0
+// until internal/attribution can work it out.
 type LocationHistory struct {
 	gorm.Model
-	DriverID    uint      `json:"driver_id" gorm:"index"`
+	DriverID    uint      `json:"driver_id" gorm:"index;index:idx_location_driver_time,priority:1"`
 	Driver      Driver    `gorm:"foreignKey:DriverID"`
+	VehicleID   uint      `json:"vehicle_id" gorm:"index:idx_location_vehicle_time,priority:1"`
+	Source      string    `json:"source" gorm:"default:driver;index"`
 	Latitude    float64   `json:"latitude"`
 	Longitude   float64   `json:"longitude"`
 	Accuracy    float64   `json:"accuracy"`    // GPS accuracy in meters
-	Speed       float64   `json:"speed"`       // Speed in km/h
+	Speed       float64   `json:"speed"`       // Speed in m/s (convert for display via internal/format)
 	Bearing     float64   `json:"bearing"`     // Direction in degrees
 	Altitude    float64   `json:"altitude"`    // Altitude in meters
 	IsMoving    bool      `json:"is_moving"`   // Movement status
 	DistanceFromLast float64 `json:"distance_from_last"` // Distance from previous point
-	Timestamp   time.Time `json:"timestamp"`
+	Timestamp   time.Time `json:"timestamp" gorm:"index:idx_location_driver_time,priority:2;index:idx_location_vehicle_time,priority:2"`
 	EventType   string    `json:"event_type"` // "start", "moving", "stopped", "idle", "significant_movement"
+	TripID      uint      `json:"trip_id,omitempty" gorm:"index"` // Trip in progress when reported, 0 when none
+
+	// The reported position snapped onto the vehicle's route (see
+	// internal/mapmatch); nil when it was too far off the route or the route
+	// has no geometry. Latitude and Longitude always keep the raw fix.
+	MatchedLatitude  *float64 `json:"matched_latitude,omitempty"`
+	MatchedLongitude *float64 `json:"matched_longitude,omitempty"`
+	RouteOffsetM     *float64 `json:"route_offset_m,omitempty"` // Distance of the raw fix from the route line; nil without geometry
 }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// M-Pesa payment states. A payment starts pending when the STK push is sent
+// to the commuter's phone and settles when Safaricom reports the result. A
+// pending payment nobody hears back about expires, but a late result still
+// settles it.
+const (
+	MpesaPending   = "pending"
+	MpesaSucceeded = "succeeded"
+	MpesaFailed    = "failed"
+	MpesaCancelled = "cancelled" // The commuter dismissed the prompt
+	MpesaExpired   = "expired"
+)
+
+// MpesaPayment is a fare payment requested from a commuter's phone through
+// M-Pesa STK push, towards a journey or one of its segments. Once it
+// succeeds the money is recorded against the journey as JourneyPaymentID,
+// with a receipt.
+type MpesaPayment struct {
+	gorm.Model
+	UserID    uint    `json:"user_id" gorm:"index"`
+	JourneyID uint    `json:"journey_id" gorm:"index;uniqueIndex:idx_mpesa_payments_pending_journey,where:status = 'pending'"` // One pending payment per journey
+	SegmentID uint    `json:"segment_id,omitempty"`
+	Amount    float64 `json:"amount"` // Requested, in whole shillings
+	Phone     string  `json:"phone"`
+	Status    string  `json:"status" gorm:"index"`
+
+	// Set once Safaricom accepts the STK push; the payment is saved before.
+	MerchantRequestID string  `json:"merchant_request_id"`
+	CheckoutRequestID *string `json:"checkout_request_id" gorm:"uniqueIndex"`
+
+	ResultCode       *int       `json:"result_code,omitempty"`
+	ResultDesc       string     `json:"result_desc,omitempty"`
+	ReceiptNumber    string     `json:"receipt_number,omitempty" gorm:"index"` // M-Pesa transaction code
+	PaidAmount       float64    `json:"paid_amount,omitempty"`                 // As Safaricom reported it
+	JourneyPaymentID uint       `json:"journey_payment_id,omitempty"`
+	PaymentReceiptID uint       `json:"payment_receipt_id,omitempty"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentReceipt is issued for every payment towards a journey. Its
+// reference is what a commuter quotes, and a sacco looks up, when a fare is
+// disputed.
+type PaymentReceipt struct {
+	gorm.Model
+	Reference        string    `json:"reference" gorm:"uniqueIndex"`
+	UserID           uint      `json:"user_id" gorm:"index"`
+	JourneyID        uint      `json:"journey_id" gorm:"index"`
+	JourneyPaymentID uint      `json:"journey_payment_id" gorm:"uniqueIndex"`
+	SegmentID        uint      `json:"segment_id,omitempty"` // 0 when paid towards the whole journey
+	Amount           float64   `json:"amount"`
+	Currency         string    `json:"currency"`
+	Method           string    `json:"method"`
+	PaymentReference string    `json:"payment_reference,omitempty" gorm:"index"` // e.g. the M-Pesa transaction code
+	PaidAt           time.Time `json:"paid_at"`
+	VerificationCode string    `json:"verification_code"`
+}
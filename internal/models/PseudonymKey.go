@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PseudonymKey is the secret used to derive pseudonyms during one rotation
+// epoch. It is stored sealed with the escrow key and destroyed once its
+// retention period ends, after which its pseudonyms can no longer be reversed.
+type PseudonymKey struct {
+	gorm.Model
+
+	Epoch    int64     `json:"epoch" gorm:"uniqueIndex"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at" gorm:"index"`
+	Sealed   []byte    `json:"-" gorm:"type:bytea"` // AES-GCM nonce followed by ciphertext
+}
+
+// ReidentificationRequest is the audit record of a pseudonym being resolved
+// back to a real identifier.
+type ReidentificationRequest struct {
+	gorm.Model
+
+	RequestedBy uint   `json:"requested_by" gorm:"index"` // Admin user ID
+	Pseudonym   string `json:"pseudonym" gorm:"index"`
+	Epoch       int64  `json:"epoch"`
+	Reason      string `json:"reason"` // Legal basis, e.g. a court order or case number
+	SubjectKind string `json:"subject_kind,omitempty"`
+	SubjectID   uint   `json:"subject_id,omitempty"`
+	Outcome     string `json:"outcome"` // resolved, not_found or key_destroyed
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reasons a relief session ended.
+const (
+	ReliefEndHandback  = "handback"
+	ReliefEndExpired   = "expired"
+	ReliefEndCancelled = "cancelled"
+)
+
+// ReliefSession records a relief driver temporarily taking over a vehicle from
+// its regular driver. While active, the vehicle's DriverID points at the relief
+// driver so tracking, trips and scoring are attributed to them.
+type ReliefSession struct {
+	gorm.Model
+
+	VehicleID       uint       `json:"vehicle_id" gorm:"index"`
+	SaccoID         uint       `json:"sacco_id" gorm:"index"`
+	PrimaryDriverID uint       `json:"primary_driver_id" gorm:"index"`
+	ReliefDriverID  uint       `json:"relief_driver_id" gorm:"index"`
+	StartedAt       time.Time  `json:"started_at"`
+	ExpiresAt       time.Time  `json:"expires_at" gorm:"index"`
+	EndedAt         *time.Time `json:"ended_at,omitempty" gorm:"index"`
+	EndReason       string     `json:"end_reason,omitempty"`
+	Note            string     `json:"note,omitempty"`
+}
+
+// Active reports whether the session has not ended yet.
+func (s ReliefSession) Active() bool {
+	return s.EndedAt == nil
+}
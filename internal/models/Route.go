@@ -1,9 +1,43 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Route lifecycle states. Only published routes are visible to commuters.
+const (
+	RouteStatusDraft         = "draft"
+	RouteStatusPendingReview = "pending_review"
+	RouteStatusPublished     = "published"
+	RouteStatusArchived      = "archived"
+)
+
+// routeTransitions lists the states each route state may move to. Archived
+// routes go back to draft before they can be published again.
+var routeTransitions = map[string][]string{
+	RouteStatusDraft:         {RouteStatusPendingReview, RouteStatusPublished, RouteStatusArchived},
+	RouteStatusPendingReview: {RouteStatusPublished, RouteStatusDraft, RouteStatusArchived},
+	RouteStatusPublished:     {RouteStatusDraft, RouteStatusArchived},
+	RouteStatusArchived:      {RouteStatusDraft},
+}
+
+// RouteTransitions returns the states a route in status may move to.
+func RouteTransitions(status string) []string {
+	return routeTransitions[status]
+}
+
+// CanTransitionRoute reports whether a route may move from one state to another.
+func CanTransitionRoute(from, to string) bool {
+	for _, s := range routeTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
 // Route represents a service path operated by a sacco
 // A sacco can have multiple routes; each route has many stages and assigned vehicles
 type Route struct {
@@ -11,13 +45,23 @@ type Route struct {
 
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"description"`
-	SaccoID     uint     `json:"sacco_id"`
+	SaccoID     uint     `json:"sacco_id" gorm:"index"`
 
 	// Geometry stored in PostGIS as a LINESTRING (SRID 4326)
 	// When creating, provide GeoJSON; migrations define the column type appropriately.
 	Geometry    []byte  `gorm:"type:bytea"`
 
+	// Status is draft, pending_review, published or archived. The column default
+	// keeps routes that predate the workflow visible; CreateRoute starts new ones as drafts.
+	Status      string     `json:"status" gorm:"default:published;index"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	ReviewNote  string     `json:"review_note,omitempty"` // Admin feedback when a submission is rejected
+
+	// SpeedLimitKmh overrides the sacco's speed limit on this route.
+	SpeedLimitKmh *float64 `json:"speed_limit_kmh,omitempty"`
+
 	// Associations
 	Stages      []Stage  `gorm:"foreignKey:RouteID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"stages,omitempty"`
 	Vehicles    []Vehicle`gorm:"foreignKey:RouteID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"vehicles,omitempty"`
+	Tags        []Tag    `gorm:"many2many:route_tags;" json:"tags,omitempty"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RouteDeviation is one continuous episode of a vehicle straying from its
+// assigned route by more than the off-route distance for longer than the
+// off-route duration (see internal/driving). It stays open (EndedAt nil)
+// until the vehicle is back on its route or stops reporting.
+type RouteDeviation struct {
+	gorm.Model
+	SaccoID      uint       `json:"sacco_id" gorm:"index:idx_route_deviations_sacco_time,priority:1"`
+	VehicleID    uint       `json:"vehicle_id" gorm:"index"`
+	DriverID     uint       `json:"driver_id" gorm:"index"`
+	RouteID      uint       `json:"route_id" gorm:"index"`
+	TripID       uint       `json:"trip_id,omitempty"`
+	Source       string     `json:"source"`         // LocationSourceDriver or LocationSourceTracker
+	MaxDistanceM float64    `json:"max_distance_m"` // Farthest from the route line
+	Latitude     float64    `json:"latitude"`       // Where the vehicle left the route
+	Longitude    float64    `json:"longitude"`
+	StartedAt    time.Time  `json:"started_at" gorm:"index:idx_route_deviations_sacco_time,priority:2"`
+	LastSeenAt   time.Time  `json:"last_seen_at"` // Latest fix off the route
+	EndedAt      *time.Time `json:"ended_at,omitempty" gorm:"index"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RouteElevationProfile caches a sampled elevation profile for one version of a
+// route's geometry. GeometryHash changes whenever the geometry is edited.
+type RouteElevationProfile struct {
+	gorm.Model
+	RouteID        uint     `json:"route_id" gorm:"uniqueIndex:idx_elevation_route_version"`
+	GeometryHash   string   `json:"geometry_hash" gorm:"uniqueIndex:idx_elevation_route_version"`
+	SampleInterval float64  `json:"sample_interval" gorm:"uniqueIndex:idx_elevation_route_version"`
+	Provider       string   `json:"provider"`
+	Samples        []byte   `json:"-" gorm:"type:jsonb"` // JSON-encoded []ElevationSample
+	TotalAscent    float64  `json:"total_ascent"`
+	TotalDescent   float64  `json:"total_descent"`
+	MinElevation   *float64 `json:"min_elevation"` // null when no sample has data
+	MaxElevation   *float64 `json:"max_elevation"`
+}
+
+// ElevationSample is one point of an elevation profile.
+type ElevationSample struct {
+	Lat       float64  `json:"lat"`
+	Lng       float64  `json:"lng"`
+	Distance  float64  `json:"distance"`  // Meters from the start of the route
+	Elevation *float64 `json:"elevation"` // Meters above sea level; null where the provider has no data
+}
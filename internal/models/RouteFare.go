@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RouteFare is one entry of a route's fare matrix: the fare between two of
+// its stages, in either direction. FromStageID is always the lower ID so
+// each pair is stored once.
+type RouteFare struct {
+	gorm.Model
+	RouteID     uint    `json:"route_id" gorm:"uniqueIndex:idx_route_fares_pair,priority:1"`
+	FromStageID uint    `json:"from_stage_id" gorm:"uniqueIndex:idx_route_fares_pair,priority:2"`
+	ToStageID   uint    `json:"to_stage_id" gorm:"uniqueIndex:idx_route_fares_pair,priority:3"`
+	Fare        float64 `json:"fare"` // In format.DefaultCurrency
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Geometry proposal review states.
+const (
+	GeometryProposalPending  = "pending"
+	GeometryProposalAccepted = "accepted"
+	GeometryProposalRejected = "rejected"
+)
+
+// RouteGeometryProposal is a route line inferred from driver GPS traces,
+// waiting for the sacco to accept or reject it.
+type RouteGeometryProposal struct {
+	gorm.Model
+
+	RouteID    uint       `json:"route_id" gorm:"index"`
+	SaccoID    uint       `json:"sacco_id" gorm:"index"`
+	Geometry   []byte     `json:"-" gorm:"type:bytea"`
+	TraceCount int        `json:"trace_count"` // Trips that contributed to the inference
+	Matcher    string     `json:"matcher"`     // Map matching provider, "none" when unmatched
+	LengthM    float64    `json:"length_m"`
+	Spread     float64    `json:"spread_m"` // Mean distance of the other traces from the chosen one
+	Status     string     `json:"status" gorm:"default:pending;index"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Route import states.
+const (
+	RouteImportPreview   = "preview"
+	RouteImportConfirmed = "confirmed"
+	RouteImportDiscarded = "discarded"
+)
+
+// RouteImport holds a parsed shapefile/CSV upload until the sacco confirms it.
+type RouteImport struct {
+	gorm.Model
+
+	SaccoID  uint   `json:"sacco_id" gorm:"index"`
+	UserID   uint   `json:"user_id"`
+	Source   string `json:"source"` // "shapefile" or "csv"
+	FileName string `json:"file_name"`
+	Status   string `json:"status" gorm:"default:preview;index"`
+
+	Preview         string     `json:"-" gorm:"type:text"` // JSON-encoded importer.Result
+	CreatedRouteIDs string     `json:"-"`                  // Comma-separated, set on confirm
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+}
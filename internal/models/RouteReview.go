@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Route review moderation states. Saccos can flag a review they think breaks
+// the rules; it stays public until an admin hides it or clears the flag.
+const (
+	ReviewVisible = "visible"
+	ReviewFlagged = "flagged"
+	ReviewHidden  = "hidden"
+)
+
+// RouteReview is a commuter's rating of a route, each aspect scored 1 to 5,
+// with an optional written review. A commuter has at most one review per
+// route, which they can edit; deleting it removes the row.
+type RouteReview struct {
+	gorm.Model
+	UserID      uint   `json:"user_id,omitempty" gorm:"uniqueIndex:idx_route_reviews_route_user,priority:2"`
+	RouteID     uint   `json:"route_id" gorm:"uniqueIndex:idx_route_reviews_route_user,priority:1"`
+	SaccoID     uint   `json:"sacco_id" gorm:"index"`
+	Reliability int    `json:"reliability"` // Shows up when expected and keeps to the route
+	Safety      int    `json:"safety"`
+	Comfort     int    `json:"comfort"`
+	Comment     string `json:"comment,omitempty"`
+	Mine        bool   `json:"mine,omitempty" gorm:"-"` // Set on public listings for the commuter's own review
+
+	Status         string     `json:"status" gorm:"index"`
+	FlagReason     string     `json:"flag_reason,omitempty"`     // Why the sacco flagged it
+	ModerationNote string     `json:"moderation_note,omitempty"` // The admin's reason for hiding it
+	ModeratedBy    uint       `json:"moderated_by,omitempty"`    // User who last flagged, hid or restored it
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SOS alert kinds, as chosen on the driver's panic button.
+const (
+	SOSAccident = "accident"
+	SOSSecurity = "security"
+	SOSMedical  = "medical"
+	SOSOther    = "other"
+)
+
+// SOS alert states. An alert is raised by the driver, acknowledged by
+// whoever takes it on and resolved once the driver is safe.
+const (
+	SOSRaised       = "raised"
+	SOSAcknowledged = "acknowledged"
+	SOSResolved     = "resolved"
+)
+
+// SOSAlert is a driver's panic call. The location is the one sent with the
+// alert or, failing that, the driver's last saved position (LocationAt says
+// when it was taken).
+type SOSAlert struct {
+	gorm.Model
+	SaccoID   uint   `json:"sacco_id" gorm:"index:idx_sos_alerts_sacco_status,priority:1"`
+	DriverID  uint   `json:"driver_id" gorm:"index"`
+	VehicleID uint   `json:"vehicle_id,omitempty"`
+	RouteID   uint   `json:"route_id,omitempty"`
+	TripID    uint   `json:"trip_id,omitempty"`
+	Kind      string `json:"kind"`
+	Note      string `json:"note,omitempty"`
+	Status    string `json:"status" gorm:"index:idx_sos_alerts_sacco_status,priority:2"`
+
+	Latitude   float64    `json:"latitude"`
+	Longitude  float64    `json:"longitude"`
+	Accuracy   float64    `json:"accuracy,omitempty"`
+	LocationAt *time.Time `json:"location_at,omitempty"` // Nil when the driver's position is unknown
+
+	RaisedAt       time.Time  `json:"raised_at" gorm:"index"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy uint       `json:"acknowledged_by,omitempty"` // User ID
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy     uint       `json:"resolved_by,omitempty"` // User ID
+	Resolution     string     `json:"resolution,omitempty"`
+
+	// RepeatKey is the driver's ID while repeated presses fold into this
+	// alert, and nil once it is resolved or past the repeat window. Being
+	// unique, it keeps concurrent presses from raising two alerts.
+	RepeatKey *uint `json:"-" gorm:"uniqueIndex"`
+}
+
+// Open reports whether the alert still needs attention.
+func (a SOSAlert) Open() bool {
+	return a.Status != SOSResolved
+}
@@ -15,5 +15,20 @@ type Sacco struct {
     Email     string    `json:"email"`
     Phone     string    `json:"phone"`
     Address   string    `json:"address,omitempty"` // Add this field if you intend to use `sacco.Address`
+    Region    string    `json:"region,omitempty" gorm:"index"` // Operating region, e.g. county, used to target announcements
     Vehicles  []Vehicle `json:"vehicles,omitempty" gorm:"foreignKey:SaccoID"` // One-to-Many association with Vehicles
+    Branding  SaccoBranding `json:"branding" gorm:"embedded;embeddedPrefix:brand_"`
+    PhotoKey  string    `json:"-"`                            // Storage key of the office or fleet photo
+    PhotoURL  string    `json:"photo_url,omitempty" gorm:"-"` // Filled in for API responses
+    SpeedLimitKmh *float64 `json:"speed_limit_kmh,omitempty"` // Sacco speed policy; unset uses the general limit
+    BroadcastIntervalMs *int `json:"broadcast_interval_ms,omitempty"` // Least time between live updates per vehicle; unset uses the default, 0 disables throttling
+}
+
+// SaccoBranding is the public identity apps use to render branded vehicle
+// markers and route cards.
+type SaccoBranding struct {
+    DisplayName string `json:"display_name"`
+    Color       string `json:"color"`            // Hex colour, e.g. "#E4002B"
+    LogoKey     string `json:"-"`                // Storage key of the uploaded logo
+    LogoURL     string `json:"logo_url,omitempty" gorm:"-"`
 }
\ No newline at end of file
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Service alert causes.
+const (
+	AlertStrike     = "strike"
+	AlertDiversion  = "diversion"
+	AlertFareChange = "fare_change"
+	AlertDelay      = "delay"
+	AlertOther      = "other"
+)
+
+// ServiceAlert is a sacco's announcement of a disruption to its service,
+// such as a strike, a diversion or a fare change. It covers the whole sacco,
+// one of its routes (RouteID), or one stage on that route (StageID), and is
+// in effect from StartsAt until EndsAt, or until further notice without one.
+type ServiceAlert struct {
+	gorm.Model
+	SaccoID  uint       `json:"sacco_id" gorm:"index"`
+	RouteID  uint       `json:"route_id,omitempty" gorm:"index"` // 0 for sacco-wide alerts
+	StageID  uint       `json:"stage_id,omitempty"`              // 0 unless about one stage of the route
+	Cause    string     `json:"cause"`
+	Severity string     `json:"severity"` // SeverityLow, SeverityMedium or SeverityHigh
+	Title    string     `json:"title"`
+	Body     string     `json:"body"`
+	StartsAt time.Time  `json:"starts_at" gorm:"index"`
+	EndsAt   *time.Time `json:"ends_at,omitempty" gorm:"index"`
+
+	CreatedByUserID uint       `json:"created_by_user_id"`
+	NotifiedAt      *time.Time `json:"notified_at,omitempty"` // When commuters were sent a push notification
+}
+
+// ActiveAt reports whether the alert is in effect at t.
+func (a ServiceAlert) ActiveAt(t time.Time) bool {
+	return !a.StartsAt.After(t) && (a.EndsAt == nil || a.EndsAt.After(t))
+}
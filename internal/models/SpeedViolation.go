@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SpeedViolation is one continuous episode of a vehicle or driver exceeding
+// the speed limit that applied to them. It stays open (EndedAt nil) while
+// the episode lasts.
+type SpeedViolation struct {
+	gorm.Model
+	DriverID   uint       `json:"driver_id" gorm:"index:idx_speed_violations_driver_time,priority:1"`
+	VehicleID  uint       `json:"vehicle_id" gorm:"index"`
+	SaccoID    uint       `json:"sacco_id" gorm:"index:idx_speed_violations_sacco_time,priority:1"`
+	RouteID    uint       `json:"route_id"`
+	Source     string     `json:"source"`    // LocationSourceDriver or LocationSourceTracker
+	Limit      float64    `json:"limit"`     // m/s
+	MaxSpeed   float64    `json:"max_speed"` // m/s
+	Latitude   float64    `json:"latitude"`  // Where the episode started
+	Longitude  float64    `json:"longitude"`
+	StartedAt  time.Time  `json:"started_at" gorm:"index:idx_speed_violations_driver_time,priority:2;index:idx_speed_violations_sacco_time,priority:2"`
+	LastSeenAt time.Time  `json:"last_seen_at"` // Latest fix over the limit
+	EndedAt    *time.Time `json:"ended_at,omitempty" gorm:"index"`
+
+	// EpisodeKey names the vehicle or driver the episode follows while it is
+	// open, and is nil once it ends. Being unique, it keeps two replicas from
+	// opening an episode for the same vehicle.
+	EpisodeKey *string `json:"-" gorm:"uniqueIndex"`
+}
@@ -6,6 +6,7 @@ import (
 
 // Stage represents a stop or dropoff location along a route
 // Sequence indicates order and optional geographic coordinates
+// Each stage links a route to a shared Stop; Lat/Lng default to the stop's position.
 type Stage struct {
 	gorm.Model
 
@@ -15,5 +16,9 @@ type Stage struct {
 	Lng     float64 `json:"lng" binding:"required"`
 
 	// Foreign key to route
-	RouteID uint    `json:"route_id"`
+	RouteID uint    `json:"route_id" gorm:"index"`
+
+	// Shared stop this stage refers to (see models.Stop)
+	StopID  uint    `json:"stop_id" gorm:"index"`
+	Stop    *Stop   `json:"stop,omitempty" gorm:"foreignKey:StopID"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Stage event kinds.
+const (
+	StageArrival   = "arrival"
+	StageDeparture = "departure"
+)
+
+// StageEvent records a vehicle entering (arrival) or leaving (departure) the
+// geofence around one of its route's stages.
+type StageEvent struct {
+	gorm.Model
+	VehicleID    uint      `json:"vehicle_id" gorm:"index:idx_stage_events_vehicle_time,priority:1"`
+	DriverID     uint      `json:"driver_id,omitempty"`
+	SaccoID      uint      `json:"sacco_id" gorm:"index:idx_stage_events_sacco_time,priority:1"`
+	RouteID      uint      `json:"route_id" gorm:"index:idx_stage_events_stage_time,priority:1"`
+	StageID      uint      `json:"stage_id" gorm:"index:idx_stage_events_stage_time,priority:2"`
+	Kind         string    `json:"kind"` // StageArrival or StageDeparture
+	At           time.Time `json:"at" gorm:"index:idx_stage_events_vehicle_time,priority:2;index:idx_stage_events_sacco_time,priority:2;index:idx_stage_events_stage_time,priority:3"`
+	Latitude     float64   `json:"latitude"` // The fix that triggered the event
+	Longitude    float64   `json:"longitude"`
+	DistanceM    float64   `json:"distance_m"`              // From the stage at that fix
+	DwellSeconds float64   `json:"dwell_seconds,omitempty"` // Departures only
+
+	Stage *Stage `json:"stage,omitempty" gorm:"foreignKey:StageID"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Stop is a physical boarding point shared by every route that serves it.
+// Routes reference stops through Stage, which carries the per-route sequence.
+type Stop struct {
+	gorm.Model
+
+	Name string  `json:"name" binding:"required"`
+	Lat  float64 `json:"lat" gorm:"index:idx_stops_lat_lng,priority:1"`
+	Lng  float64 `json:"lng" gorm:"index:idx_stops_lat_lng,priority:2"`
+
+	// Normalised name and ~50 m grid cell (see stops.MatchKey). Unique among
+	// live stops, so two requests resolving the same stage at once share one
+	// stop. Null for stops created before it existed.
+	MatchKey *string `json:"-" gorm:"uniqueIndex:idx_stops_match_key,where:deleted_at IS NULL"`
+
+	// Point geometry as WKB (SRID 4326), kept in sync with Lat/Lng
+	Geometry []byte `json:"-" gorm:"type:bytea"`
+
+	Amenities StopAmenities `json:"amenities" gorm:"embedded;embeddedPrefix:amenity_"`
+
+	Stages []Stage `json:"stages,omitempty" gorm:"foreignKey:StopID"`
+}
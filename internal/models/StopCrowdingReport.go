@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Crowding levels a commuter can report at a stop.
+const (
+	CrowdingEmpty    = 0
+	CrowdingLight    = 1
+	CrowdingModerate = 2
+	CrowdingBusy     = 3
+	CrowdingPacked   = 4
+)
+
+// StopCrowdingReport is one commuter's observation of how crowded a stop is.
+type StopCrowdingReport struct {
+	gorm.Model
+
+	StopID     uint      `json:"stop_id" gorm:"index:idx_crowding_stop_time,priority:1"`
+	UserID     uint      `json:"user_id" gorm:"index:idx_crowding_user_time,priority:1"`
+	Level      int       `json:"level"` // 0 (empty) to 4 (packed)
+	ReportedAt time.Time `json:"reported_at" gorm:"index:idx_crowding_stop_time,priority:2;index:idx_crowding_user_time,priority:2"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Tag labels routes for filtering ("express", "night service", "cbd").
+// Canonical tags are curated by admins; saccos may add their own, which are
+// folded into a canonical tag when the slugs match.
+type Tag struct {
+	gorm.Model
+
+	Name      string `json:"name"`
+	Slug      string `json:"slug" gorm:"uniqueIndex"`
+	Canonical bool   `json:"canonical" gorm:"index"`
+
+	// Sacco that first used a non-canonical tag (nil for admin-created tags)
+	CreatedBySaccoID *uint `json:"created_by_sacco_id,omitempty"`
+}
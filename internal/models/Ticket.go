@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ticket states. A valid ticket past ExpiresAt is reported as expired.
+const (
+	TicketValid   = "valid"
+	TicketUsed    = "used"
+	TicketExpired = "expired"
+)
+
+// Ticket entitles a commuter to one paid ride, shown to the crew as a QR
+// code and scanned on board. Each journey segment gets at most one.
+type Ticket struct {
+	gorm.Model
+	Code          string     `json:"code" gorm:"uniqueIndex"`
+	UserID        uint       `json:"user_id" gorm:"index"`
+	JourneyID     uint       `json:"journey_id" gorm:"index"`
+	SegmentID     uint       `json:"segment_id" gorm:"uniqueIndex"`
+	RouteID       uint       `json:"route_id"`
+	BoardStageID  uint       `json:"board_stage_id"`
+	AlightStageID uint       `json:"alight_stage_id"`
+	Status        string     `json:"status" gorm:"default:valid;index"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty"`
+	VehicleID     uint       `json:"vehicle_id,omitempty"` // Scanned on
+	DriverID      uint       `json:"driver_id,omitempty"`
+
+	QR string `json:"qr,omitempty" gorm:"-"` // Signed payload to render as the QR code
+}
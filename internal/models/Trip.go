@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reasons a trip ended.
+const (
+	TripEndDriver     = "driver"     // The driver ended it
+	TripEndInactivity = "inactivity" // No location points for trips.IdleTimeout
+	TripEndSacco      = "sacco"      // Closed by the sacco
+)
+
+// Trip is one run of a vehicle along a route, started and ended by its driver
+// (or closed automatically when the vehicle stops reporting). Location points
+// reported during the trip carry its ID.
+type Trip struct {
+	gorm.Model
+	DriverID   uint       `json:"driver_id" gorm:"index:idx_trips_driver_time,priority:1"`
+	VehicleID  uint       `json:"vehicle_id" gorm:"index:idx_trips_vehicle_time,priority:1"`
+	SaccoID    uint       `json:"sacco_id" gorm:"index:idx_trips_sacco_time,priority:1"`
+	RouteID    uint       `json:"route_id" gorm:"index"`
+	StartedAt  time.Time  `json:"started_at" gorm:"index:idx_trips_driver_time,priority:2;index:idx_trips_vehicle_time,priority:2;index:idx_trips_sacco_time,priority:2"`
+	EndedAt    *time.Time `json:"ended_at,omitempty" gorm:"index"`
+	EndReason  string     `json:"end_reason,omitempty"`
+	LastSeenAt time.Time  `json:"last_seen_at"` // Latest point of the trip
+	PointCount int        `json:"point_count"`
+	DistanceM  float64    `json:"distance_m"`
+}
+
+// Active reports whether the trip has not ended yet.
+func (t Trip) Active() bool {
+	return t.EndedAt == nil
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TripAdherence scores how closely one trip followed the vehicle's assigned route.
+type TripAdherence struct {
+	gorm.Model
+
+	VehicleID uint      `json:"vehicle_id" gorm:"index"`
+	DriverID  uint      `json:"driver_id" gorm:"uniqueIndex:idx_trip_adherence_driver_start,priority:1"`
+	RouteID   uint      `json:"route_id" gorm:"index"`
+	SaccoID   uint      `json:"sacco_id" gorm:"index"`
+	StartedAt time.Time `json:"started_at" gorm:"uniqueIndex:idx_trip_adherence_driver_start,priority:2"`
+	EndedAt   time.Time `json:"ended_at"`
+
+	PointCount    int     `json:"point_count"`
+	PointsOnRoute int     `json:"points_on_route"`
+	AdherencePct  float64 `json:"adherence_pct"`
+	StagesServed  int     `json:"stages_served"`
+	StagesSkipped int     `json:"stages_skipped"`
+	Excursions    int     `json:"excursions"`      // Runs of consecutive off-route points
+	MaxDeviationM float64 `json:"max_deviation_m"` // Furthest distance from the route line
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TripSummary is a trip detected in a vehicle's location history: a run of
+// movement between long stops or reporting gaps (see trips.Summarize). It is
+// derived independently of the trips drivers start and end; TripID links the
+// explicit trip most of its points were tagged with, if any.
+type TripSummary struct {
+	gorm.Model
+	VehicleID uint      `json:"vehicle_id" gorm:"uniqueIndex:idx_trip_summaries_vehicle_start,priority:1"`
+	DriverID  uint      `json:"driver_id" gorm:"index"`
+	SaccoID   uint      `json:"sacco_id" gorm:"index:idx_trip_summaries_sacco_time,priority:1"`
+	RouteID   uint      `json:"route_id" gorm:"index"`
+	TripID    uint      `json:"trip_id,omitempty"`
+	Source    string    `json:"source"` // Which points it was built from: LocationSourceTracker or LocationSourceDriver
+	StartedAt time.Time `json:"started_at" gorm:"uniqueIndex:idx_trip_summaries_vehicle_start,priority:2;index:idx_trip_summaries_sacco_time,priority:2"`
+	EndedAt   time.Time `json:"ended_at"`
+
+	PointCount int     `json:"point_count"`
+	DistanceM  float64 `json:"distance_m"`
+	DurationS  float64 `json:"duration_s"`
+	MovingS    float64 `json:"moving_s"`  // Duration less the time spent at stops
+	AvgSpeed   float64 `json:"avg_speed"` // m/s over the whole duration
+	MaxSpeed   float64 `json:"max_speed"` // m/s
+	StopCount  int     `json:"stop_count"`
+
+	StartLatitude  float64 `json:"start_latitude"`
+	StartLongitude float64 `json:"start_longitude"`
+	EndLatitude    float64 `json:"end_latitude"`
+	EndLongitude   float64 `json:"end_longitude"`
+}
@@ -8,7 +8,11 @@ type User struct {
 	Email    string `json:"email" gorm:"unique"`
 	Password string `json:"password"`
 	Phone    string `json:"phone"`
-	Role     string `json:"role"` // "commuter", "driver", "sacco", "admin"
+	Role     string `json:"role" gorm:"index"` // "commuter", "driver", "sacco", "admin"
+
+	// MustChangePassword is set while the user signs in with a temporary
+	// password issued by someone else.
+	MustChangePassword bool `json:"must_change_password"`
 
 	// Actor-specific relations
 	Sacco     *Sacco         `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"sacco,omitempty"`
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserInvite lets someone whose account was created for them, such as a
+// driver onboarded by their sacco, set their own password. The token is
+// stored hashed and works once.
+type UserInvite struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	SaccoID    uint       `json:"sacco_id" gorm:"index"` // Sacco that created the account, if any
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
@@ -2,17 +2,55 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Occupancy states reported by drivers.
+const (
+	OccupancyUnknown        = "unknown"
+	OccupancySeatsAvailable = "seats_available"
+	OccupancyFewSeats       = "few_seats"
+	OccupancyFull           = "full"
+)
+
 type Vehicle struct {
 	gorm.Model
 	VehicleNo               string `json:"vehicle_no"`
 	VehicleRegistration     string `json:"vehicle_registration"`
-	SaccoID                 uint   `json:"sacco_id"`
-	DriverID                uint   `json:"driver_id"`  
+	SaccoID                 uint   `json:"sacco_id" gorm:"index:idx_vehicles_sacco_service,priority:1"`
+	DriverID                uint   `json:"driver_id" gorm:"index"`
 	Driver      *Driver `json:"driver,omitempty" gorm:"foreignKey:DriverID"`             // link to the driver user
-	InService               bool   `json:"in_service" gorm:"default:true"`
+	InService               bool   `json:"in_service" gorm:"default:true;index:idx_vehicles_sacco_service,priority:2"`
+	// Status is the lifecycle state (see VehicleActive and friends). InService
+	// only says whether an active vehicle is operating right now.
+	Status                  string `json:"status" gorm:"default:active;index"`
 	 // ← add this so Route.Vehicles works
-    RouteID             uint   `json:"route_id"`
+    RouteID             uint   `json:"route_id" gorm:"index"`
+
+	// Capacity is the licensed seat count; occupancy is reported live by the driver.
+	Capacity            int        `json:"capacity" gorm:"default:14"`
+	OccupancyStatus     string     `json:"occupancy_status" gorm:"default:unknown"`
+	Occupancy           *int       `json:"occupancy,omitempty"` // Passengers on board, when the driver counts them
+	OccupancyUpdatedAt  *time.Time `json:"occupancy_updated_at,omitempty"`
+	// Crowding is what commuters on the street report, see internal/crowding.
+	Crowding            VehicleCrowding `json:"crowding" gorm:"embedded;embeddedPrefix:crowding_"`
+
+	Amenities VehicleAmenities `json:"amenities" gorm:"embedded;embeddedPrefix:amenity_"`
+
+	// Compliance reflects the vehicle's documents and is kept up to date by
+	// internal/compliance. SuspendedForCompliance is set when the vehicle was
+	// taken out of service automatically, so it can be restored on renewal.
+	ComplianceStatus       string `json:"compliance_status" gorm:"default:ok"`
+	SuspendedForCompliance bool   `json:"suspended_for_compliance"`
+
+	PhotoKey string `json:"-"`                            // Storage key of the vehicle photo
+	PhotoURL string `json:"photo_url,omitempty" gorm:"-"` // Filled in for API responses
+
+	// A GPS tracker fitted to the vehicle reports with this token (stored hashed).
+	TrackerTokenHash     string     `json:"-" gorm:"index"`
+	TrackerTokenIssuedAt *time.Time `json:"tracker_token_issued_at,omitempty"`
+
+	Branding *SaccoBranding `json:"branding,omitempty" gorm:"-"` // Filled in for API responses
 }
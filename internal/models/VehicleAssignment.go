@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How a vehicle assignment came to be recorded.
+const (
+	AssignmentRegular    = "assignment" // The sacco assigned the driver
+	AssignmentRelief     = "relief"     // A relief session handed the vehicle over
+	AssignmentCorrection = "correction" // Recorded after the fact to fix history
+)
+
+// VehicleAssignment records who drove a vehicle over a period of time. Location
+// points are attributed against this history, so a point reported by a
+// vehicle's tracker can be credited to its driver and vice versa, including
+// after the history is corrected. An open assignment has no EndedAt.
+type VehicleAssignment struct {
+	gorm.Model
+
+	VehicleID uint       `json:"vehicle_id" gorm:"index:idx_assignment_vehicle_time,priority:1"`
+	SaccoID   uint       `json:"sacco_id" gorm:"index"`
+	DriverID  uint       `json:"driver_id" gorm:"index:idx_assignment_driver_time,priority:1"`
+	StartedAt time.Time  `json:"started_at" gorm:"index:idx_assignment_vehicle_time,priority:2;index:idx_assignment_driver_time,priority:2"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Source    string     `json:"source"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Crowding levels a commuter can report for a vehicle they can see.
+const (
+	VehicleSeatsAvailable = 0
+	VehicleStandingRoom   = 1
+	VehicleFull           = 2
+)
+
+// CrowdingUnknown is the level of a vehicle without recent reports.
+const CrowdingUnknown = "unknown"
+
+// VehicleCrowdingReport is one commuter's observation of how full a vehicle
+// is, with where they were when they made it.
+type VehicleCrowdingReport struct {
+	gorm.Model
+
+	VehicleID  uint      `json:"vehicle_id" gorm:"index:idx_vehicle_crowding_vehicle_time,priority:1"`
+	UserID     uint      `json:"user_id" gorm:"index:idx_vehicle_crowding_user_time,priority:1"`
+	Level      int       `json:"level"` // VehicleSeatsAvailable to VehicleFull
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	ReportedAt time.Time `json:"reported_at" gorm:"index:idx_vehicle_crowding_vehicle_time,priority:2;index:idx_vehicle_crowding_user_time,priority:2"`
+}
+
+// VehicleCrowding is a vehicle's crowding as aggregated from recent
+// commuter reports by internal/crowding.
+type VehicleCrowding struct {
+	Level     string     `json:"level" gorm:"default:unknown"` // seats_available, standing_room, full or unknown
+	Score     float64    `json:"score"`                        // 0 (seats available) to 100 (full)
+	Reports   int        `json:"reports"`                      // Distinct reporters behind it
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
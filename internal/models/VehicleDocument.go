@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Compliance document types.
+const (
+	DocumentInsurance  = "insurance"
+	DocumentInspection = "inspection"
+	DocumentPSVLicense = "psv_license"
+)
+
+// Vehicle compliance states.
+const (
+	ComplianceOK       = "ok"
+	ComplianceExpiring = "expiring"
+	ComplianceExpired  = "expired"
+)
+
+// VehicleDocument is an insurance cover, inspection certificate or PSV
+// license held for a vehicle. Renewals are recorded as new documents; the one
+// with the latest expiry counts for each type.
+type VehicleDocument struct {
+	gorm.Model
+
+	VehicleID uint      `json:"vehicle_id" gorm:"index"`
+	SaccoID   uint      `json:"sacco_id" gorm:"index"`
+	Type      string    `json:"type"`
+	Number    string    `json:"number"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	FileKey   string    `json:"-"` // Storage key of the scanned document, if uploaded
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Vehicle lifecycle states. Only active vehicles can be put in service.
+const (
+	VehicleActive      = "active"
+	VehicleMaintenance = "maintenance"
+	VehicleImpounded   = "impounded"
+	VehicleRetired     = "retired" // Final: the vehicle has left the fleet
+)
+
+// vehicleTransitions lists the states each state may move to.
+var vehicleTransitions = map[string][]string{
+	VehicleActive:      {VehicleMaintenance, VehicleImpounded, VehicleRetired},
+	VehicleMaintenance: {VehicleActive, VehicleImpounded, VehicleRetired},
+	VehicleImpounded:   {VehicleActive, VehicleMaintenance, VehicleRetired},
+	VehicleRetired:     {},
+}
+
+// ValidVehicleStatus reports whether s is a lifecycle state.
+func ValidVehicleStatus(s string) bool {
+	_, ok := vehicleTransitions[s]
+	return ok
+}
+
+// VehicleTransitions returns the states a vehicle in status may move to.
+func VehicleTransitions(status string) []string {
+	return vehicleTransitions[status]
+}
+
+// CanTransitionVehicle reports whether a vehicle may move from one state to another.
+func CanTransitionVehicle(from, to string) bool {
+	for _, s := range vehicleTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// VehicleStatusChange records one lifecycle transition of a vehicle.
+type VehicleStatusChange struct {
+	gorm.Model
+	VehicleID  uint      `json:"vehicle_id" gorm:"index"`
+	SaccoID    uint      `json:"sacco_id" gorm:"index"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedBy  uint      `json:"changed_by"` // User who made the change
+	ChangedAt  time.Time `json:"changed_at"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Platform events a webhook can subscribe to. Ping is sent on request only,
+// to test an endpoint.
+const (
+	WebhookTripStarted     = "trip_started"
+	WebhookSOS             = "sos"
+	WebhookDocumentExpired = "document_expired"
+	WebhookRoutePublished  = "route_published"
+	WebhookPing            = "ping"
+)
+
+// DeliveryPending is the state of a webhook delivery still being tried. It
+// ends DeliveryDelivered, or DeliveryFailed after the last attempt.
+const DeliveryPending = "pending"
+
+// Webhook is an endpoint of a sacco's own system that is called back when
+// events it subscribed to happen (see internal/webhooks). Deliveries are
+// signed with Secret, which is only shown when created or rotated.
+type Webhook struct {
+	gorm.Model
+
+	SaccoID     uint   `json:"sacco_id" gorm:"index"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Events      string `json:"-"` // Comma-separated event names
+	Secret      string `json:"-"`
+	Active      bool   `json:"active"` // Inactive webhooks get no deliveries
+
+	LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty"` // Status of the latest finished delivery
+}
+
+// EventList returns the events the webhook subscribes to.
+func (w Webhook) EventList() []string {
+	if w.Events == "" {
+		return []string{}
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Subscribes reports whether the webhook wants deliveries of event.
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to a webhook.
+// Failed attempts are retried by the job queue with backoff.
+type WebhookDelivery struct {
+	gorm.Model
+
+	WebhookID uint   `json:"webhook_id" gorm:"index"`
+	SaccoID   uint   `json:"sacco_id" gorm:"index"`
+	Event     string `json:"event"`
+	EventID   string `json:"event_id" gorm:"index"` // Shared by the deliveries of one event, for receivers to deduplicate
+	Payload   []byte `json:"-" gorm:"type:jsonb"`   // The JSON body sent
+	JobID     uint   `json:"job_id"`
+
+	Status       string     `json:"status" gorm:"default:pending"`
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"response_code,omitempty"` // HTTP status of the latest attempt
+	LastError    string     `json:"last_error,omitempty"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+}
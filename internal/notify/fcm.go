@@ -0,0 +1,245 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// PushChannel is the name of the push notification channel.
+const PushChannel = "push"
+
+// fcmScope is the OAuth scope needed to send through FCM.
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// errStaleToken means FCM no longer knows the device token.
+var errStaleToken = errors.New("device token is no longer registered")
+
+// RegisterPushFromEnv registers the push channel when FCM_CREDENTIALS_FILE
+// names a Firebase service account key.
+func RegisterPushFromEnv() {
+	path := config.EnvString("FCM_CREDENTIALS_FILE", "")
+	if path == "" {
+		return
+	}
+	fcm, err := NewFCM(config.DB, path)
+	if err != nil {
+		logrus.WithError(err).Error("notify: Failed to set up FCM; push notifications are disabled.")
+		return
+	}
+	Register(fcm)
+}
+
+// FCM sends push notifications to every device the recipient registered,
+// through the Firebase Cloud Messaging HTTP v1 API. Tokens FCM reports as
+// unregistered are deleted.
+type FCM struct {
+	DB       *gorm.DB
+	Endpoint string // messages:send URL of the Firebase project
+	Client   *http.Client
+
+	email    string
+	key      *rsa.PrivateKey
+	tokenURL string
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCM reads the service account key at credentialsFile.
+func NewFCM(db *gorm.DB, credentialsFile string) (*FCM, error) {
+	raw, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, errors.New("service account key lacks project_id or client_email")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &FCM{
+		DB:       db,
+		Endpoint: "https://fcm.googleapis.com/v1/projects/" + url.PathEscape(account.ProjectID) + "/messages:send",
+		Client:   &http.Client{Timeout: 15 * time.Second},
+		email:    account.ClientEmail,
+		key:      key,
+		tokenURL: account.TokenURI,
+	}, nil
+}
+
+// Name identifies the channel.
+func (f *FCM) Name() string { return PushChannel }
+
+// Send pushes the message to each of the recipient's devices. It succeeds
+// when at least one device accepted it, and reports the recipient
+// unreachable when they have no registered devices left.
+func (f *FCM) Send(ctx context.Context, r Recipient, m Message) error {
+	if r.UserID == 0 {
+		return ErrUnreachable
+	}
+	var devices []models.DeviceToken
+	if err := f.DB.Where("user_id = ?", r.UserID).Find(&devices).Error; err != nil {
+		return err
+	}
+	delivered := false
+	var lastErr error
+	for _, d := range devices {
+		err := f.push(ctx, d.Token, m)
+		switch {
+		case err == nil:
+			delivered = true
+		case errors.Is(err, errStaleToken):
+			if err := f.DB.Unscoped().Delete(&d).Error; err != nil {
+				logrus.WithError(err).WithField("device_id", d.ID).Warn("notify: Failed to delete stale device token.")
+			}
+		default:
+			lastErr = err
+		}
+	}
+	if delivered {
+		return nil
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+	return ErrUnreachable
+}
+
+type fcmError struct {
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (f *FCM) push(ctx context.Context, token string, m Message) error {
+	data := map[string]string{"message_id": strconv.FormatUint(uint64(m.ID), 10)}
+	for k, v := range m.Data {
+		data[k] = v
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": m.Title, "body": m.Body},
+			"data":         data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fcm request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var decoded fcmError
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	for _, d := range decoded.Error.Details {
+		if d.ErrorCode == "UNREGISTERED" || d.ErrorCode == "SENDER_ID_MISMATCH" {
+			return errStaleToken
+		}
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		// Let the next send fetch a fresh access token.
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	}
+	return fmt.Errorf("fcm returned %s: %s", resp.Status, decoded.Error.Message)
+}
+
+// token returns an OAuth access token for FCM, exchanging a signed service
+// account assertion for a new one shortly before the current one expires.
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Until(f.expiresAt) > time.Minute {
+		return f.accessToken, nil
+	}
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.email,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fcm token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("fcm token endpoint returned %s", resp.Status)
+	}
+	var decoded struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", fmt.Errorf("failed to decode fcm token response: %w", err)
+	}
+	f.accessToken = decoded.AccessToken
+	f.expiresAt = now.Add(time.Duration(decoded.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
@@ -0,0 +1,224 @@
+// Package notify delivers messages to users over pluggable channels
+// (WebSocket, SMS, push, ...) and records per-recipient delivery outcomes.
+package notify
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+)
+
+// ErrUnreachable means the recipient cannot be reached on a channel right now,
+// e.g. a driver who is offline or a user without a phone number.
+var ErrUnreachable = errors.New("recipient is not reachable on this channel")
+
+// Recipient identifies who a message is for. DriverID is 0 for non-drivers.
+type Recipient struct {
+	UserID   uint   `json:"user_id"`
+	DriverID uint   `json:"driver_id,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+}
+
+// Message is the content delivered to each recipient. Data carries extra
+// keys for channels that pass them on to the app, e.g. push, so it can open
+// the right screen.
+type Message struct {
+	ID    uint
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Channel delivers a message to one recipient.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, r Recipient, m Message) error
+}
+
+var (
+	mu       sync.RWMutex
+	channels = map[string]Channel{}
+)
+
+// Register makes a channel available by name, replacing any previous one.
+func Register(ch Channel) {
+	mu.Lock()
+	defer mu.Unlock()
+	channels[ch.Name()] = ch
+}
+
+// Lookup returns the channel registered under name.
+func Lookup(name string) (Channel, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	ch, ok := channels[name]
+	return ch, ok
+}
+
+// Names lists the registered channels.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(channels))
+	for name := range channels {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// JobKind is the kind of the background jobs that deliver bulk messages.
+const JobKind = "bulk_message"
+
+func init() {
+	jobs.Register(JobKind, 0, runJob)
+}
+
+// jobPayload is what a bulk message job delivers.
+type jobPayload struct {
+	BulkMessageID uint        `json:"bulk_message_id"`
+	Channels      []string    `json:"channels"`
+	Recipients    []Recipient `json:"recipients"`
+}
+
+// Queue queues delivery of the bulk message over each channel to every
+// recipient, using db so it can be part of the transaction saving the
+// message. A message whose worker dies part way through is picked up again
+// and finished.
+func Queue(db *gorm.DB, bulk models.BulkMessage, channelNames []string, recipients []Recipient) error {
+	payload := jobPayload{BulkMessageID: bulk.ID, Channels: channelNames, Recipients: recipients}
+	_, err := jobs.Enqueue(db, JobKind, payload, jobs.Options{UserID: bulk.SenderUserID, SaccoID: bulk.SaccoID})
+	return err
+}
+
+func runJob(ctx context.Context, job *models.Job) error {
+	var payload jobPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return jobs.Permanent(err)
+	}
+	var bulk models.BulkMessage
+	if err := config.DB.First(&bulk, payload.BulkMessageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if bulk.Status == models.BulkMessageCompleted {
+		return nil
+	}
+	err := Deliver(ctx, config.DB, bulk, payload.Channels, payload.Recipients)
+	if err != nil && jobs.LastAttempt(job) && ctx.Err() == nil {
+		// Don't leave the message sending for good.
+		complete(config.DB, bulk)
+	}
+	return err
+}
+
+// Deliver sends the bulk message over each channel to every recipient,
+// recording one BulkMessageDelivery per pair, and marks the message completed.
+// Pairs with a delivery already recorded, by an earlier run, are skipped. It
+// stops when ctx is done, returning its error with the message still sending.
+func Deliver(ctx context.Context, db *gorm.DB, bulk models.BulkMessage, channelNames []string, recipients []Recipient) error {
+	msg := Message{ID: bulk.ID, Title: bulk.Title, Body: bulk.Body}
+	var done []models.BulkMessageDelivery
+	if err := db.Select("channel", "user_id", "driver_id").Where("bulk_message_id = ?", bulk.ID).Find(&done).Error; err != nil {
+		return err
+	}
+	type pair struct {
+		channel          string
+		userID, driverID uint
+	}
+	sent := make(map[pair]bool, len(done))
+	for _, d := range done {
+		sent[pair{d.Channel, d.UserID, d.DriverID}] = true
+	}
+	for _, name := range channelNames {
+		ch, ok := Lookup(name)
+		if !ok {
+			continue
+		}
+		for _, r := range recipients {
+			if sent[pair{name, r.UserID, r.DriverID}] {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			d := models.BulkMessageDelivery{
+				BulkMessageID: bulk.ID,
+				UserID:        r.UserID,
+				DriverID:      r.DriverID,
+				Channel:       name,
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+			err := ch.Send(sendCtx, r, msg)
+			cancel()
+			switch {
+			case err == nil:
+				now := time.Now()
+				d.Status, d.DeliveredAt = models.DeliveryDelivered, &now
+			case errors.Is(err, ErrUnreachable):
+				d.Status = models.DeliveryUnreachable
+			case ctx.Err() != nil:
+				return ctx.Err() // Interrupted, not failed: try again later
+			default:
+				d.Status, d.Error = models.DeliveryFailed, err.Error()
+			}
+			if err := db.Create(&d).Error; err != nil {
+				logrus.WithError(err).WithField("bulk_message_id", bulk.ID).Error("notify: Failed to record delivery.")
+			}
+		}
+	}
+	complete(db, bulk)
+	logrus.WithFields(logrus.Fields{"bulk_message_id": bulk.ID, "recipients": len(recipients)}).Info("notify: Bulk message delivered.")
+	return nil
+}
+
+func complete(db *gorm.DB, bulk models.BulkMessage) {
+	if err := db.Model(&bulk).Updates(map[string]interface{}{
+		"status":       models.BulkMessageCompleted,
+		"completed_at": time.Now(),
+	}).Error; err != nil {
+		logrus.WithError(err).WithField("bulk_message_id", bulk.ID).Error("notify: Failed to mark bulk message completed.")
+	}
+}
+
+// Notice records a message raised by the platform itself (SenderUserID 0) and
+// queues its delivery on whichever of channelNames are registered. The
+// message is kept even when no channel is available so the sacco can still
+// find it in its message history.
+func Notice(db *gorm.DB, saccoID uint, cohort, filter, title, body string, channelNames []string, recipients []Recipient) (models.BulkMessage, error) {
+	var available []string
+	for _, name := range channelNames {
+		if _, ok := Lookup(name); ok {
+			available = append(available, name)
+		}
+	}
+	bulk := models.BulkMessage{
+		SaccoID:      saccoID,
+		Cohort:       cohort,
+		CohortFilter: filter,
+		Title:        title,
+		Body:         body,
+		Channels:     strings.Join(available, ","),
+		Recipients:   len(recipients),
+		Status:       models.BulkMessageSending,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&bulk).Error; err != nil {
+			return err
+		}
+		return Queue(tx, bulk, available, recipients)
+	})
+	return bulk, err
+}
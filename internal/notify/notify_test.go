@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// countingChannel counts sends and runs onSend, when set, after each.
+type countingChannel struct {
+	mu     sync.Mutex
+	sent   []Recipient
+	onSend func()
+}
+
+func (c *countingChannel) Name() string { return "notify-test" }
+
+func (c *countingChannel) Send(ctx context.Context, r Recipient, m Message) error {
+	c.mu.Lock()
+	c.sent = append(c.sent, r)
+	c.mu.Unlock()
+	if c.onSend != nil {
+		c.onSend()
+	}
+	return nil
+}
+
+func setup(t *testing.T) (*gorm.DB, *countingChannel, models.BulkMessage, []Recipient) {
+	t.Helper()
+	db := testdb.Use(t, &models.BulkMessage{}, &models.BulkMessageDelivery{}, &models.Job{})
+	ch := &countingChannel{}
+	Register(ch)
+	bulk := models.BulkMessage{Body: "hello", Status: models.BulkMessageSending}
+	if err := db.Create(&bulk).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, ch, bulk, []Recipient{{UserID: 1}, {UserID: 2}, {UserID: 3}}
+}
+
+func TestDeliverResumes(t *testing.T) {
+	db, ch, bulk, recipients := setup(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch.onSend = cancel // Interrupted after the first send
+	if err := Deliver(ctx, db, bulk, []string{ch.Name()}, recipients); err != context.Canceled {
+		t.Fatalf("interrupted Deliver returned %v; want context.Canceled", err)
+	}
+	db.First(&bulk, bulk.ID)
+	if bulk.Status != models.BulkMessageSending || len(ch.sent) != 1 {
+		t.Fatalf("after interruption: status %q, %d sent; want sending, 1", bulk.Status, len(ch.sent))
+	}
+
+	ch.onSend = nil
+	if err := Deliver(context.Background(), db, bulk, []string{ch.Name()}, recipients); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&bulk, bulk.ID)
+	if bulk.Status != models.BulkMessageCompleted || len(ch.sent) != 3 {
+		t.Errorf("after resuming: status %q, %d sent; want completed, 3 (no repeats)", bulk.Status, len(ch.sent))
+	}
+	var deliveries int64
+	db.Model(&models.BulkMessageDelivery{}).Where("bulk_message_id = ?", bulk.ID).Count(&deliveries)
+	if deliveries != 3 {
+		t.Errorf("%d deliveries recorded; want 3", deliveries)
+	}
+}
+
+func TestQueuedJobDelivers(t *testing.T) {
+	db, ch, bulk, recipients := setup(t)
+	if err := Queue(db, bulk, []string{ch.Name()}, recipients); err != nil {
+		t.Fatal(err)
+	}
+	var job models.Job
+	if err := db.Where("kind = ?", JobKind).First(&job).Error; err != nil {
+		t.Fatalf("no job queued: %v", err)
+	}
+	if err := runJob(context.Background(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if err := runJob(context.Background(), &job); err != nil { // A worker that died after finishing
+		t.Fatal(err)
+	}
+	if len(ch.sent) != 3 {
+		t.Errorf("%d sent; want 3", len(ch.sent))
+	}
+}
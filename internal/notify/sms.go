@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ma3_tracker/internal/config"
+)
+
+// RegisterSMSFromEnv registers the SMS channel when SMS_PROVIDER is configured.
+// Only "africastalking" is supported.
+func RegisterSMSFromEnv() {
+	if config.EnvString("SMS_PROVIDER", "") != "africastalking" {
+		return
+	}
+	Register(&AfricasTalkingSMS{
+		URL:      config.EnvString("AT_SMS_URL", "https://api.africastalking.com/version1/messaging"),
+		Username: config.EnvString("AT_USERNAME", ""),
+		APIKey:   config.EnvString("AT_API_KEY", ""),
+		From:     config.EnvString("AT_SENDER_ID", ""),
+		Client:   &http.Client{Timeout: 15 * time.Second},
+	})
+}
+
+// AfricasTalkingSMS sends text messages through the Africa's Talking API.
+type AfricasTalkingSMS struct {
+	URL      string
+	Username string
+	APIKey   string
+	From     string
+	Client   *http.Client
+}
+
+// Name identifies the channel.
+func (s *AfricasTalkingSMS) Name() string { return "sms" }
+
+type atResponse struct {
+	SMSMessageData struct {
+		Recipients []struct {
+			Status     string `json:"status"`
+			StatusCode int    `json:"statusCode"`
+		} `json:"Recipients"`
+	} `json:"SMSMessageData"`
+}
+
+// Send texts the message to the recipient's phone number.
+func (s *AfricasTalkingSMS) Send(ctx context.Context, r Recipient, m Message) error {
+	if strings.TrimSpace(r.Phone) == "" {
+		return ErrUnreachable
+	}
+	text := m.Body
+	if m.Title != "" {
+		text = m.Title + ": " + m.Body
+	}
+	form := url.Values{}
+	form.Set("username", s.Username)
+	form.Set("to", r.Phone)
+	form.Set("message", text)
+	if s.From != "" {
+		form.Set("from", s.From)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("apiKey", s.APIKey)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sms provider returned %s", resp.Status)
+	}
+	var decoded atResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("failed to decode sms response: %w", err)
+	}
+	for _, rec := range decoded.SMSMessageData.Recipients {
+		if rec.StatusCode >= 400 {
+			return fmt.Errorf("sms rejected: %s", rec.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+// Package pagination pages, sorts and filters list queries the same way for
+// every listing endpoint.
+//
+// The query-string convention is:
+//
+//	?page=2&per_page=50          1-based page; ?limit= is an alias of per_page
+//	?cursor=<next_cursor>        instead of page: the page after the cursor
+//	?sort=name or ?sort=-created_at,name   comma-separated, "-" for descending
+//	?<filter>=<value>            exact-match filters declared per endpoint
+//
+// Every page comes with a Meta holding the total and the cursor of the next
+// page. Cursors remember the sort they were made with; filters must be
+// repeated with them.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 200
+)
+
+// Filter turns one query parameter into a condition. Where has a single
+// placeholder for the parsed value.
+type Filter struct {
+	Where string
+	Parse func(string) (interface{}, error)
+}
+
+// Options declares what a listing can be sorted and filtered by.
+type Options struct {
+	Sorts       map[string]string // ?sort= field -> column
+	DefaultSort string
+	Filters     map[string]Filter
+}
+
+// Meta describes the page returned. Page is 0 for pages fetched by cursor,
+// and NextCursor nil on the last page.
+type Meta struct {
+	Page       int     `json:"page,omitempty"`
+	PerPage    int     `json:"per_page"`
+	Total      int64   `json:"total"`
+	TotalPages int64   `json:"total_pages"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// Error is a problem with the request's parameters, to report as a 400.
+type Error struct {
+	Message  string
+	Sortable []string // Set when the sort was rejected
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func badRequest(msg string) error { return &Error{Message: msg} }
+
+// Uint, Bool and String declare filters on a column of that type.
+func Uint(where string) Filter   { return Filter{where, ParseUint} }
+func Bool(where string) Filter   { return Filter{where, ParseBool} }
+func String(where string) Filter { return Filter{where, ParseString} }
+
+func ParseUint(raw string) (interface{}, error) {
+	return strconv.ParseUint(raw, 10, 64)
+}
+
+func ParseBool(raw string) (interface{}, error) {
+	return strconv.ParseBool(raw)
+}
+
+func ParseString(raw string) (interface{}, error) {
+	return raw, nil
+}
+
+// Limit reads the page size from ?limit= or ?per_page=, between 1 and max.
+func Limit(params url.Values, def, max int) (int, error) {
+	raw := params.Get("limit")
+	if raw == "" {
+		raw = params.Get("per_page")
+	}
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > max {
+		return 0, badRequest("limit must be between 1 and " + strconv.Itoa(max))
+	}
+	return n, nil
+}
+
+// EncodeCursor makes an opaque cursor of v.
+func EncodeCursor(v interface{}) string {
+	raw, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor reads a cursor made by EncodeCursor into v.
+func DecodeCursor(s string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return badRequest("invalid cursor")
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("invalid cursor")
+	}
+	return nil
+}
+
+// cursor is where a page ends: after the row with sort key Keys, or, when
+// the sort can't be resumed by key, after Offset rows.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Keys   []interface{} `json:"k,omitempty"`
+	Offset int           `json:"o,omitempty"`
+}
+
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+// Find applies params' filters, sort and page or cursor to query (which must
+// have its model set), loads the page into dest, a pointer to a slice, with
+// the given preloads and describes it. Bad parameters are reported as an
+// *Error; anything else is a database error.
+func Find(query *gorm.DB, params url.Values, opts Options, dest interface{}, preloads ...string) (Meta, error) {
+	limit, err := Limit(params, DefaultPerPage, MaxPerPage)
+	if err != nil {
+		return Meta{}, err
+	}
+	page := 0
+	var after *cursor
+	if raw := params.Get("cursor"); raw != "" {
+		if params.Get("page") != "" {
+			return Meta{}, badRequest("Use either page or cursor, not both")
+		}
+		after = &cursor{}
+		if err := DecodeCursor(raw, after); err != nil {
+			return Meta{}, err
+		}
+		if after.Offset < 0 {
+			return Meta{}, badRequest("invalid cursor")
+		}
+	} else {
+		page, err = strconv.Atoi(firstNonEmpty(params.Get("page"), "1"))
+		if err != nil || page < 1 {
+			return Meta{}, badRequest("page must be a positive integer")
+		}
+	}
+
+	for name, f := range opts.Filters {
+		raw := params.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := f.Parse(raw)
+		if err != nil {
+			return Meta{}, badRequest("Invalid " + name)
+		}
+		query = query.Where(f.Where, value)
+	}
+
+	sortParam := params.Get("sort")
+	switch {
+	case after != nil && sortParam != "" && sortParam != after.Sort:
+		return Meta{}, badRequest("sort can't change between pages of a cursor")
+	case after != nil:
+		sortParam = after.Sort
+	case sortParam == "":
+		sortParam = opts.DefaultSort
+	}
+	keys, ok := parseSort(sortParam, opts.Sorts)
+	if !ok {
+		fields := make([]string, 0, len(opts.Sorts))
+		for f := range opts.Sorts {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		return Meta{}, &Error{Message: "Invalid sort", Sortable: fields}
+	}
+
+	// Count and Find must not share a statement.
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return Meta{}, err
+	}
+
+	offset := (page - 1) * limit
+	find := query
+	if after != nil {
+		offset = after.Offset
+		if after.Keys != nil {
+			if len(after.Keys) != len(keys) {
+				return Meta{}, badRequest("invalid cursor")
+			}
+			where, args := keysetCondition(keys, after.Keys)
+			find = find.Where(where, args...)
+		}
+	}
+	// One row more than asked for tells whether there is a next page.
+	find = find.Order(orderClause(keys)).Offset(offset).Limit(limit + 1)
+	for _, p := range preloads {
+		find = find.Preload(p)
+	}
+	res := find.Find(dest)
+	if res.Error != nil {
+		return Meta{}, res.Error
+	}
+
+	meta := Meta{Page: page, PerPage: limit, Total: total, TotalPages: (total + int64(limit) - 1) / int64(limit)}
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > limit {
+		rows.Set(rows.Slice(0, limit))
+		next := cursor{Sort: sortParam}
+		if values, ok := rowKeys(res, rows.Index(limit-1), keys); ok {
+			next.Keys = values
+		} else {
+			next.Offset = offset + limit
+		}
+		encoded := EncodeCursor(next)
+		meta.NextCursor = &encoded
+	}
+	return meta, nil
+}
+
+func firstNonEmpty(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// parseSort reads a sort parameter, allowing only the whitelisted fields. The
+// primary key is always the final key so pages are stable.
+func parseSort(param string, sorts map[string]string) ([]sortKey, bool) {
+	var keys []sortKey
+	byID := false
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		column, ok := sorts[strings.TrimPrefix(field, "-")]
+		if !ok {
+			return nil, false
+		}
+		byID = byID || column == "id"
+		keys = append(keys, sortKey{column, desc})
+	}
+	if !byID {
+		keys = append(keys, sortKey{"id", false})
+	}
+	return keys, true
+}
+
+func orderClause(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.column + " ASC"
+		if k.desc {
+			parts[i] = k.column + " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keysetCondition selects the rows sorted after the row with the given key
+// values.
+func keysetCondition(keys []sortKey, values []interface{}) (string, []interface{}) {
+	var ors []string
+	var args []interface{}
+	for i, k := range keys {
+		var ands []string
+		for j, prev := range keys[:i] {
+			ands = append(ands, prev.column+" = ?")
+			args = append(args, cursorValue(values[j]))
+		}
+		if k.desc {
+			ands = append(ands, k.column+" < ?")
+		} else {
+			ands = append(ands, k.column+" > ?")
+		}
+		args = append(args, cursorValue(values[i]))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// cursorValue turns a decoded JSON number back into a Go number.
+func cursorValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// rowKeys reads the sort key of row. It fails when a key isn't a plain
+// column of the loaded model or could be NULL, as rows can't then be resumed
+// by key.
+func rowKeys(res *gorm.DB, row reflect.Value, keys []sortKey) ([]interface{}, bool) {
+	s := res.Statement.Schema
+	row = reflect.Indirect(row)
+	if s == nil || row.Type() != s.ModelType {
+		return nil, false
+	}
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		field := s.LookUpField(k.column)
+		if field == nil {
+			return nil, false
+		}
+		switch field.FieldType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		default:
+			if field.FieldType != timeType {
+				return nil, false
+			}
+		}
+		values[i], _ = field.ValueOf(res.Statement.Context, row)
+	}
+	return values, true
+}
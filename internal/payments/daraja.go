@@ -0,0 +1,286 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ma3_tracker/internal/format"
+)
+
+// ErrStillProcessing is returned by Query while the commuter hasn't answered
+// the prompt yet.
+var ErrStillProcessing = errors.New("the transaction is still being processed")
+
+// Daraja talks to Safaricom's Daraja API to prompt commuters to pay on their
+// phones (Lipa na M-Pesa Online, or STK push) and to look up the outcome.
+type Daraja struct {
+	BaseURL         string // e.g. https://sandbox.safaricom.co.ke
+	ConsumerKey     string
+	ConsumerSecret  string
+	ShortCode       string // Paybill or till number the money goes to
+	Passkey         string
+	TransactionType string // CustomerPayBillOnline or CustomerBuyGoodsOnline
+	CallbackURL     string
+	Client          *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// STKRequest asks for Amount from Phone (2547XXXXXXXX). Reference shows on
+// the commuter's prompt and statement.
+type STKRequest struct {
+	Phone       string
+	Amount      int
+	Reference   string
+	Description string
+}
+
+// STKResponse is Safaricom's acknowledgement of an STK push; the outcome
+// follows on the callback.
+type STKResponse struct {
+	MerchantRequestID string `json:"MerchantRequestID"`
+	CheckoutRequestID string `json:"CheckoutRequestID"`
+	ResponseCode      string `json:"ResponseCode"`
+	ResponseDesc      string `json:"ResponseDescription"`
+	CustomerMessage   string `json:"CustomerMessage"`
+}
+
+// Result is the outcome of an STK push, from the callback or a query.
+// ResultCode 0 means the commuter paid.
+type Result struct {
+	MerchantRequestID string
+	CheckoutRequestID string
+	ResultCode        int
+	ResultDesc        string
+	Amount            float64 // Only on success, and only from callbacks
+	ReceiptNumber     string
+	Phone             string
+}
+
+type darajaError struct {
+	RequestID    string `json:"requestId"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// password returns the STK password and the timestamp it was made with.
+func (d *Daraja) password(now time.Time) (string, string) {
+	timestamp := now.In(format.Default().Location).Format("20060102150405")
+	return base64.StdEncoding.EncodeToString([]byte(d.ShortCode + d.Passkey + timestamp)), timestamp
+}
+
+// Push sends the payment prompt to the commuter's phone.
+func (d *Daraja) Push(ctx context.Context, r STKRequest) (STKResponse, error) {
+	var out STKResponse
+	password, timestamp := d.password(time.Now())
+	err := d.post(ctx, "/mpesa/stkpush/v1/processrequest", map[string]interface{}{
+		"BusinessShortCode": d.ShortCode,
+		"Password":          password,
+		"Timestamp":         timestamp,
+		"TransactionType":   d.TransactionType,
+		"Amount":            r.Amount,
+		"PartyA":            r.Phone,
+		"PartyB":            d.ShortCode,
+		"PhoneNumber":       r.Phone,
+		"CallBackURL":       d.CallbackURL,
+		"AccountReference":  truncate(r.Reference, 12),
+		"TransactionDesc":   truncate(r.Description, 13),
+	}, &out)
+	if err != nil {
+		return out, err
+	}
+	if out.ResponseCode != "0" {
+		return out, fmt.Errorf("stk push rejected: %s", out.ResponseDesc)
+	}
+	return out, nil
+}
+
+// Query looks up the outcome of an STK push, returning ErrStillProcessing
+// while the commuter hasn't answered.
+func (d *Daraja) Query(ctx context.Context, checkoutRequestID string) (Result, error) {
+	var out struct {
+		MerchantRequestID string `json:"MerchantRequestID"`
+		CheckoutRequestID string `json:"CheckoutRequestID"`
+		ResultCode        string `json:"ResultCode"`
+		ResultDesc        string `json:"ResultDesc"`
+	}
+	password, timestamp := d.password(time.Now())
+	err := d.post(ctx, "/mpesa/stkpushquery/v1/query", map[string]interface{}{
+		"BusinessShortCode": d.ShortCode,
+		"Password":          password,
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": checkoutRequestID,
+	}, &out)
+	if err != nil {
+		return Result{}, err
+	}
+	code, err := strconv.Atoi(out.ResultCode)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected stk query result code %q", out.ResultCode)
+	}
+	return Result{
+		MerchantRequestID: out.MerchantRequestID,
+		CheckoutRequestID: out.CheckoutRequestID,
+		ResultCode:        code,
+		ResultDesc:        out.ResultDesc,
+	}, nil
+}
+
+func (d *Daraja) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	token, err := d.token(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("daraja request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var decoded darajaError
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		if decoded.ErrorCode == "500.001.1001" && strings.Contains(strings.ToLower(decoded.ErrorMessage), "being processed") {
+			return ErrStillProcessing
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Let the next request fetch a fresh access token.
+			d.mu.Lock()
+			d.accessToken = ""
+			d.mu.Unlock()
+		}
+		return fmt.Errorf("daraja returned %s: %s %s", resp.Status, decoded.ErrorCode, decoded.ErrorMessage)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode daraja response: %w", err)
+	}
+	return nil
+}
+
+// token returns an OAuth access token, fetching a new one shortly before the
+// current one expires.
+func (d *Daraja) token(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.accessToken != "" && time.Until(d.expiresAt) > time.Minute {
+		return d.accessToken, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(d.ConsumerKey, d.ConsumerSecret)
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("daraja token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("daraja token endpoint returned %s", resp.Status)
+	}
+	var decoded struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"` // Seconds, as a string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", fmt.Errorf("failed to decode daraja token response: %w", err)
+	}
+	seconds, _ := strconv.Atoi(decoded.ExpiresIn)
+	d.accessToken = decoded.AccessToken
+	d.expiresAt = time.Now().Add(time.Duration(seconds) * time.Second)
+	return d.accessToken, nil
+}
+
+// ParseCallback decodes the result Safaricom posts to the callback URL.
+func ParseCallback(body []byte) (Result, error) {
+	var cb struct {
+		Body struct {
+			STKCallback struct {
+				MerchantRequestID string `json:"MerchantRequestID"`
+				CheckoutRequestID string `json:"CheckoutRequestID"`
+				ResultCode        int    `json:"ResultCode"`
+				ResultDesc        string `json:"ResultDesc"`
+				CallbackMetadata  struct {
+					Item []struct {
+						Name  string          `json:"Name"`
+						Value json.RawMessage `json:"Value"`
+					} `json:"Item"`
+				} `json:"CallbackMetadata"`
+			} `json:"stkCallback"`
+		} `json:"Body"`
+	}
+	if err := json.Unmarshal(body, &cb); err != nil {
+		return Result{}, err
+	}
+	s := cb.Body.STKCallback
+	if s.CheckoutRequestID == "" {
+		return Result{}, errors.New("callback has no CheckoutRequestID")
+	}
+	r := Result{
+		MerchantRequestID: s.MerchantRequestID,
+		CheckoutRequestID: s.CheckoutRequestID,
+		ResultCode:        s.ResultCode,
+		ResultDesc:        s.ResultDesc,
+	}
+	for _, item := range s.CallbackMetadata.Item {
+		// Values are numbers or strings depending on the item.
+		value := strings.Trim(string(item.Value), `"`)
+		switch item.Name {
+		case "Amount":
+			r.Amount, _ = strconv.ParseFloat(value, 64)
+		case "MpesaReceiptNumber":
+			r.ReceiptNumber = value
+		case "PhoneNumber":
+			r.Phone = value
+		}
+	}
+	return r, nil
+}
+
+// NormalizePhone turns a Kenyan mobile number written as 07XXXXXXXX,
+// 01XXXXXXXX, +2547XXXXXXXX or 2547XXXXXXXX into the 2547XXXXXXXX form
+// Daraja expects. It returns false for anything else.
+func NormalizePhone(phone string) (string, bool) {
+	p := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(phone))
+	p = strings.TrimPrefix(p, "+")
+	switch {
+	case strings.HasPrefix(p, "0") && len(p) == 10:
+		p = "254" + p[1:]
+	case (strings.HasPrefix(p, "7") || strings.HasPrefix(p, "1")) && len(p) == 9:
+		p = "254" + p
+	}
+	if len(p) != 12 || !strings.HasPrefix(p, "254") || (p[3] != '7' && p[3] != '1') {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(p, 10, 64); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,302 @@
+// Package payments collects fares through M-Pesa: it prompts the commuter to
+// pay on their phone, settles the payment when Safaricom reports the result
+// and records the money against the journey.
+package payments
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/journeys"
+	"ma3_tracker/internal/models"
+)
+
+// Result codes Safaricom reports for STK pushes that don't go through as paid.
+const (
+	resultPaid      = 0
+	resultCancelled = 1032 // The commuter dismissed the prompt
+)
+
+// queryAfter is how long a payment stays pending before reconciliation asks
+// Safaricom about it instead of waiting for the callback.
+const queryAfter = 2 * time.Minute
+
+var (
+	// ErrNotConfigured is returned when M-Pesa credentials aren't set.
+	ErrNotConfigured = errors.New("mobile money payments are not available")
+	// ErrUnknownPayment is returned for results about a payment never requested.
+	ErrUnknownPayment = errors.New("no payment matches the checkout request")
+	// ErrPaymentPending is returned by Request while an earlier prompt for
+	// the journey is still waiting on the commuter's phone.
+	ErrPaymentPending = errors.New("a payment for this journey is already waiting on the phone")
+)
+
+var (
+	daraja        *Daraja
+	callbackToken string
+	pendingTTL    time.Duration
+)
+
+// ConfigureFromEnv sets up the Daraja client when MPESA_CONSUMER_KEY is set.
+// Safaricom posts results to MPESA_CALLBACK_BASE_URL followed by
+// /payments/mpesa/callback/ and MPESA_CALLBACK_TOKEN, so only it can.
+func ConfigureFromEnv() {
+	if config.EnvString("MPESA_CONSUMER_KEY", "") == "" {
+		return
+	}
+	callbackToken = config.EnvString("MPESA_CALLBACK_TOKEN", "")
+	if callbackToken == "" {
+		logrus.Warn("payments: MPESA_CALLBACK_TOKEN is not set; M-Pesa payments are disabled.")
+		return
+	}
+	pendingTTL = config.EnvDuration("MPESA_PENDING_TTL", 10*time.Minute)
+	daraja = &Daraja{
+		BaseURL:         strings.TrimRight(config.EnvString("MPESA_BASE_URL", "https://sandbox.safaricom.co.ke"), "/"),
+		ConsumerKey:     config.EnvString("MPESA_CONSUMER_KEY", ""),
+		ConsumerSecret:  config.EnvString("MPESA_CONSUMER_SECRET", ""),
+		ShortCode:       config.EnvString("MPESA_SHORTCODE", ""),
+		Passkey:         config.EnvString("MPESA_PASSKEY", ""),
+		TransactionType: config.EnvString("MPESA_TRANSACTION_TYPE", "CustomerPayBillOnline"),
+		CallbackURL:     strings.TrimRight(config.EnvString("MPESA_CALLBACK_BASE_URL", ""), "/") + "/payments/mpesa/callback/" + callbackToken,
+		Client:          &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Enabled reports whether M-Pesa payments are configured.
+func Enabled() bool { return daraja != nil }
+
+// CallbackTokenValid reports whether token is the one in the callback URL,
+// in constant time.
+func CallbackTokenValid(token string) bool {
+	return callbackToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(callbackToken)) == 1
+}
+
+// Request prompts phone to pay amount, rounded up to whole shillings, towards
+// the journey (or one of its segments). The pending payment is saved before
+// the prompt is sent, so no result can arrive for a payment we don't know,
+// and only one prompt per journey can be waiting at a time: the journey row
+// is locked while checking, and a partial unique index backs that up.
+// ErrPaymentPending is returned while another one is. A prompt Safaricom
+// refuses marks the payment failed.
+func Request(ctx context.Context, db *gorm.DB, journey models.Journey, segmentID uint, amount float64, phone string) (models.MpesaPayment, error) {
+	if daraja == nil {
+		return models.MpesaPayment{}, ErrNotConfigured
+	}
+	whole := int(math.Ceil(amount))
+	payment := models.MpesaPayment{
+		UserID:    journey.UserID,
+		JourneyID: journey.ID,
+		SegmentID: segmentID,
+		Amount:    float64(whole),
+		Phone:     phone,
+		Status:    models.MpesaPending,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked models.Journey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&locked, journey.ID).Error; err != nil {
+			return err
+		}
+		var pending int64
+		err := tx.Model(&models.MpesaPayment{}).
+			Where("journey_id = ? AND status = ?", journey.ID, models.MpesaPending).Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrPaymentPending
+		}
+		return tx.Create(&payment).Error
+	})
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "23505" {
+		return payment, ErrPaymentPending
+	}
+	if err != nil {
+		return payment, err
+	}
+
+	resp, err := daraja.Push(ctx, STKRequest{
+		Phone:       phone,
+		Amount:      whole,
+		Reference:   journey.Reference,
+		Description: "Matatu fare",
+	})
+	if err != nil {
+		now := time.Now()
+		payment.Status, payment.ResultDesc, payment.CompletedAt = models.MpesaFailed, truncate(err.Error(), 255), &now
+		if saveErr := db.Save(&payment).Error; saveErr != nil {
+			logrus.WithError(saveErr).WithField("payment_id", payment.ID).Error("payments: Failed to mark refused payment failed.")
+		}
+		return payment, err
+	}
+	payment.MerchantRequestID = resp.MerchantRequestID
+	payment.CheckoutRequestID = &resp.CheckoutRequestID
+	err = db.Model(&payment).Updates(map[string]interface{}{
+		"merchant_request_id": resp.MerchantRequestID,
+		"checkout_request_id": resp.CheckoutRequestID,
+	}).Error
+	if err != nil {
+		return payment, fmt.Errorf("stk push %s sent but not saved: %w", resp.CheckoutRequestID, err)
+	}
+	return payment, nil
+}
+
+// errNotSent marks, in Reconcile, a pending payment whose prompt never got
+// a checkout request ID; there is nothing to ask Safaricom about.
+var errNotSent = errors.New("stk push not acknowledged")
+
+// canSettle reports whether a payment in status may take the outcome of a
+// result. Expired payments still can, as Safaricom's result may arrive late.
+func canSettle(status string) bool {
+	return status == models.MpesaPending || status == models.MpesaExpired
+}
+
+// Settle applies a result to the payment it is about. A successful payment
+// is recorded against its journey, with its receipt and tickets for the
+// rides it pays for, in the same transaction. Results for payments that have
+// already settled are ignored, so repeated callbacks are harmless.
+func Settle(db *gorm.DB, r Result, now time.Time) (models.MpesaPayment, error) {
+	var payment models.MpesaPayment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("checkout_request_id = ?", r.CheckoutRequestID).First(&payment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownPayment
+		}
+		if err != nil {
+			return err
+		}
+		if !canSettle(payment.Status) {
+			return nil
+		}
+		code := r.ResultCode
+		payment.ResultCode = &code
+		payment.ResultDesc = r.ResultDesc
+		payment.CompletedAt = &now
+		switch code {
+		case resultPaid:
+			payment.Status = models.MpesaSucceeded
+			payment.ReceiptNumber = r.ReceiptNumber
+			payment.PaidAmount = r.Amount
+			if payment.PaidAmount == 0 {
+				// Query results don't carry the amount; the prompt was for the full one.
+				payment.PaidAmount = payment.Amount
+			}
+			if payment.PaidAmount != payment.Amount {
+				logrus.WithFields(logrus.Fields{
+					"payment_id": payment.ID,
+					"requested":  payment.Amount,
+					"paid":       payment.PaidAmount,
+				}).Warn("payments: M-Pesa paid amount differs from the amount requested.")
+			}
+			reference := payment.ReceiptNumber
+			if reference == "" {
+				reference = *payment.CheckoutRequestID
+			}
+			record := models.JourneyPayment{
+				JourneyID: payment.JourneyID,
+				SegmentID: payment.SegmentID,
+				Amount:    payment.PaidAmount,
+				Method:    models.PaymentMobileMoney,
+				Reference: reference,
+				PaidAt:    now,
+				// Safaricom settled it
+				Status:      models.PaymentConfirmed,
+				ConfirmedAt: &now,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			var journey models.Journey
+			if err := tx.Select("id", "user_id", "currency").First(&journey, payment.JourneyID).Error; err != nil {
+				return err
+			}
+			receipt, err := journeys.IssuePaymentReceipt(tx, journey, record)
+			if err != nil {
+				return err
+			}
+			if _, err := journeys.IssueTickets(tx, journey.ID, now); err != nil {
+				return err
+			}
+			payment.JourneyPaymentID, payment.PaymentReceiptID = record.ID, receipt.ID
+		case resultCancelled:
+			payment.Status = models.MpesaCancelled
+		default:
+			payment.Status = models.MpesaFailed
+		}
+		return tx.Save(&payment).Error
+	})
+	return payment, err
+}
+
+// Reconcile asks Safaricom about payments that have been pending a while
+// without a callback and settles those with an outcome. Payments still
+// unanswered after the pending TTL expire. It returns how many payments
+// changed status.
+func Reconcile(db *gorm.DB, now time.Time) (int, error) {
+	var pending []models.MpesaPayment
+	err := db.Where("status = ? AND created_at < ?", models.MpesaPending, now.Add(-queryAfter)).
+		Order("created_at").Limit(100).Find(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, p := range pending {
+		err := errNotSent
+		var r Result
+		if p.CheckoutRequestID != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			r, err = daraja.Query(ctx, *p.CheckoutRequestID)
+			cancel()
+		}
+		if err == nil {
+			if _, err := Settle(db, r, now); err != nil {
+				logrus.WithError(err).WithField("payment_id", p.ID).Error("payments: Failed to settle queried payment.")
+				continue
+			}
+			changed++
+			continue
+		}
+		if !errors.Is(err, ErrStillProcessing) && !errors.Is(err, errNotSent) {
+			logrus.WithError(err).WithField("payment_id", p.ID).Warn("payments: Failed to query M-Pesa payment.")
+		}
+		if p.CreatedAt.Before(now.Add(-pendingTTL)) {
+			res := db.Model(&models.MpesaPayment{}).
+				Where("id = ? AND status = ?", p.ID, models.MpesaPending).
+				Updates(map[string]interface{}{"status": models.MpesaExpired, "completed_at": now})
+			if res.Error != nil {
+				return changed, res.Error
+			}
+			changed += int(res.RowsAffected)
+		}
+	}
+	return changed, nil
+}
+
+// StartReconciliation periodically runs Reconcile in the background when
+// M-Pesa payments are configured.
+func StartReconciliation(interval time.Duration) {
+	if daraja == nil {
+		return
+	}
+	background.Every(interval, func(context.Context) {
+		n, err := Reconcile(config.DB, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("payments: Reconciliation failed.")
+		} else if n > 0 {
+			logrus.Infof("payments: Settled or expired %d M-Pesa payments.", n)
+		}
+	})
+}
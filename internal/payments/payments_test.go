@@ -0,0 +1,235 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// fakeDaraja answers STK pushes with successive checkout request IDs, or
+// refuses them while refuse is set. push, when set, runs on each push.
+type fakeDaraja struct {
+	pushes atomic.Int32
+	refuse atomic.Bool
+	push   func()
+}
+
+func (f *fakeDaraja) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/oauth/"):
+		fmt.Fprint(w, `{"access_token": "t", "expires_in": "3599"}`)
+	case r.URL.Path == "/mpesa/stkpush/v1/processrequest":
+		n := f.pushes.Add(1)
+		if f.push != nil {
+			f.push()
+		}
+		if f.refuse.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorCode": "400.002.02", "errorMessage": "Bad Request - Invalid PhoneNumber"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(STKResponse{
+			MerchantRequestID: fmt.Sprintf("m-%d", n),
+			CheckoutRequestID: fmt.Sprintf("ws_CO_%d", n),
+			ResponseCode:      "0",
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// setup configures payments against a fake Daraja and saves an open journey
+// with one ride for a fare of 80.
+func setup(t *testing.T) (*gorm.DB, *fakeDaraja, models.Journey) {
+	t.Helper()
+	t.Setenv("RECEIPT_SIGNING_KEY", "test-receipt-key")
+	db := testdb.Open(t, &models.MpesaPayment{}, &models.Journey{}, &models.JourneySegment{}, &models.JourneyPayment{},
+		&models.Ticket{}, &models.PaymentReceipt{}, &models.Route{}, &models.Stage{}, &models.Vehicle{}, &models.Sacco{})
+	fake := &fakeDaraja{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	prev, prevToken, prevTTL := daraja, callbackToken, pendingTTL
+	t.Cleanup(func() { daraja, callbackToken, pendingTTL = prev, prevToken, prevTTL })
+	daraja = &Daraja{BaseURL: srv.URL, ShortCode: "174379", Passkey: "p", CallbackURL: "https://example.com/cb", Client: srv.Client()}
+	callbackToken, pendingTTL = "s3cret-callback-token", 10*time.Minute
+
+	j := models.Journey{UserID: 9, Reference: "JPAY1", Status: models.JourneyOpen}
+	if err := db.Create(&j).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := models.JourneySegment{JourneyID: j.ID, Sequence: 1, RouteID: 1, SaccoID: 1, Fare: 80}
+	if err := db.Create(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, fake, j
+}
+
+func TestCallbackTokenValid(t *testing.T) {
+	prev := callbackToken
+	defer func() { callbackToken = prev }()
+
+	callbackToken = ""
+	if CallbackTokenValid("") {
+		t.Error("empty token accepted while none is configured")
+	}
+	callbackToken = "s3cret"
+	for token, want := range map[string]bool{"s3cret": true, "s3cre": false, "s3cret!": false, "": false} {
+		if got := CallbackTokenValid(token); got != want {
+			t.Errorf("CallbackTokenValid(%q) = %v; want %v", token, got, want)
+		}
+	}
+}
+
+func TestRequestSavesPaymentBeforePush(t *testing.T) {
+	db, fake, j := setup(t)
+	var seen int64
+	fake.push = func() {
+		db.Model(&models.MpesaPayment{}).Where("journey_id = ? AND status = ?", j.ID, models.MpesaPending).Count(&seen)
+	}
+
+	p, err := Request(context.Background(), db, j, 0, 79.5, "254712345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != 1 {
+		t.Errorf("pending payments during the push = %d; want 1", seen)
+	}
+	if p.Amount != 80 || p.CheckoutRequestID == nil || *p.CheckoutRequestID != "ws_CO_1" {
+		t.Errorf("payment = %+v", p)
+	}
+	var saved models.MpesaPayment
+	db.First(&saved, p.ID)
+	if saved.CheckoutRequestID == nil || *saved.CheckoutRequestID != "ws_CO_1" || saved.MerchantRequestID != "m-1" {
+		t.Errorf("saved payment = %+v; want the checkout request recorded", saved)
+	}
+}
+
+func TestRequestOnePendingPerJourney(t *testing.T) {
+	db, fake, j := setup(t)
+	if _, err := Request(context.Background(), db, j, 0, 80, "254712345678"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Request(context.Background(), db, j, 0, 80, "254712345678"); !errors.Is(err, ErrPaymentPending) {
+		t.Fatalf("second request: err = %v; want ErrPaymentPending", err)
+	}
+	if n := fake.pushes.Load(); n != 1 {
+		t.Errorf("%d pushes sent; want 1", n)
+	}
+
+	// The database refuses a second pending payment even if the check is
+	// bypassed.
+	dup := models.MpesaPayment{JourneyID: j.ID, Status: models.MpesaPending}
+	if err := db.Create(&dup).Error; err == nil {
+		t.Error("saved a second pending payment for the journey")
+	}
+}
+
+func TestRequestRefusedMarksFailed(t *testing.T) {
+	db, fake, j := setup(t)
+	fake.refuse.Store(true)
+	p, err := Request(context.Background(), db, j, 0, 80, "254712345678")
+	if err == nil {
+		t.Fatal("refused push reported no error")
+	}
+	var saved models.MpesaPayment
+	db.First(&saved, p.ID)
+	if saved.Status != models.MpesaFailed || saved.CompletedAt == nil {
+		t.Errorf("refused payment = %+v; want failed", saved)
+	}
+
+	fake.refuse.Store(false)
+	if _, err := Request(context.Background(), db, j, 0, 80, "254712345678"); err != nil {
+		t.Fatalf("retry after a refused push: %v", err)
+	}
+}
+
+const paidCallback = `{"Body": {"stkCallback": {
+	"MerchantRequestID": "m-1", "CheckoutRequestID": "ws_CO_1", "ResultCode": 0, "ResultDesc": "ok",
+	"CallbackMetadata": {"Item": [
+		{"Name": "Amount", "Value": 80},
+		{"Name": "MpesaReceiptNumber", "Value": "QK12ABC"},
+		{"Name": "PhoneNumber", "Value": 254712345678}
+	]}}}}`
+
+func TestSettleFromCallback(t *testing.T) {
+	db, _, j := setup(t)
+	if _, err := Request(context.Background(), db, j, 0, 80, "254712345678"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseCallback([]byte(paidCallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Amount != 80 || r.ReceiptNumber != "QK12ABC" || r.Phone != "254712345678" {
+		t.Fatalf("parsed %+v", r)
+	}
+
+	now := time.Now()
+	p, err := Settle(db, r, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != models.MpesaSucceeded || p.JourneyPaymentID == 0 || p.PaymentReceiptID == 0 {
+		t.Fatalf("settled payment = %+v", p)
+	}
+	var record models.JourneyPayment
+	db.First(&record, p.JourneyPaymentID)
+	if record.Status != models.PaymentConfirmed || record.Reference != "QK12ABC" {
+		t.Errorf("journey payment = %+v; want confirmed with the receipt number", record)
+	}
+	var tickets int64
+	db.Model(&models.Ticket{}).Where("journey_id = ?", j.ID).Count(&tickets)
+	if tickets != 1 {
+		t.Errorf("%d tickets issued; want 1", tickets)
+	}
+
+	// Safaricom may repeat a callback; it must not pay twice.
+	if _, err := Settle(db, r, now); err != nil {
+		t.Fatal(err)
+	}
+	var records int64
+	db.Model(&models.JourneyPayment{}).Where("journey_id = ?", j.ID).Count(&records)
+	if records != 1 {
+		t.Errorf("%d journey payments after a repeated callback; want 1", records)
+	}
+
+	r.CheckoutRequestID = "ws_CO_unknown"
+	if _, err := Settle(db, r, now); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("unknown checkout request: err = %v; want ErrUnknownPayment", err)
+	}
+}
+
+func TestReconcileExpiresUnsentPayments(t *testing.T) {
+	db, fake, j := setup(t)
+	old := time.Now().Add(-time.Hour)
+	unsent := models.MpesaPayment{JourneyID: j.ID, Amount: 80, Status: models.MpesaPending}
+	unsent.CreatedAt = old
+	if err := db.Create(&unsent).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Reconcile(db, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved models.MpesaPayment
+	db.First(&saved, unsent.ID)
+	if n != 1 || saved.Status != models.MpesaExpired {
+		t.Errorf("Reconcile changed %d; payment status %q; want it expired", n, saved.Status)
+	}
+	if fake.pushes.Load() != 0 {
+		t.Error("Reconcile contacted Daraja")
+	}
+}
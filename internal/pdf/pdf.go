@@ -0,0 +1,102 @@
+// Package pdf renders plain text as a PDF document, for printable copies of
+// receipts and other short records. It lays text out in a fixed-width font on
+// A4 pages and needs no fonts or images of its own.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Page geometry, in points.
+const (
+	pageWidth  = 595 // A4
+	pageHeight = 842
+	margin     = 56
+	fontSize   = 10
+	leading    = 14
+	// maxColumns is how many Courier characters fit between the margins,
+	// and linesPerPage how many lines.
+	maxColumns   = (pageWidth - 2*margin) * 1000 / (fontSize * 600)
+	linesPerPage = (pageHeight - 2*margin) / leading
+)
+
+// FromText renders text, one line per line, wrapping lines too long for the
+// page and starting a new page when one fills up. Characters outside
+// printable ASCII are replaced with '?'.
+func FromText(title, text string) []byte {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		for len(line) > maxColumns {
+			lines = append(lines, line[:maxColumns])
+			line = line[maxColumns:]
+		}
+		lines = append(lines, line)
+	}
+	var pages [][]string
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects: 1 catalog, 2 page tree, 3 font, 4 info, then a page and its
+	// content stream for each page.
+	objects := []string{
+		"", // Catalog, filled in below
+		"", // Page tree, filled in below
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (ma3_tracker) >>", escape(title)),
+	}
+	var kids []string
+	for _, page := range pages {
+		pageObj, contentObj := len(objects)+1, len(objects)+2
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj))
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, leading, margin, pageHeight-margin-fontSize)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", escape(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, contentObj),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// escape makes s safe inside a PDF string literal.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
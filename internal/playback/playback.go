@@ -0,0 +1,151 @@
+// Package playback turns a vehicle's location history into a replay for
+// animating on a map: frames indexed by time, with the stops and events
+// along the way placed on the same timeline.
+package playback
+
+import (
+	"sort"
+	"time"
+
+	"ma3_tracker/internal/models"
+)
+
+// Frame is the vehicle's position at one moment of the replay.
+type Frame struct {
+	At           time.Time `json:"at"`
+	OffsetS      float64   `json:"offset_s"` // Seconds since the first frame
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	Speed        float64   `json:"speed"` // m/s
+	Bearing      float64   `json:"bearing"`
+	Moving       bool      `json:"moving"`
+	Interpolated bool      `json:"interpolated,omitempty"` // Between two reported points rather than one of them
+}
+
+// Event is something that happened during the replay. Frame is the index of
+// the last frame at or before At, so players can show it as they pass.
+type Event struct {
+	Type      string                 `json:"type"`
+	At        time.Time              `json:"at"`
+	EndedAt   *time.Time             `json:"ended_at,omitempty"`
+	OffsetS   float64                `json:"offset_s"`
+	Frame     int                    `json:"frame"`
+	Latitude  float64                `json:"latitude"`
+	Longitude float64                `json:"longitude"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// EventStop is the type of the events Stops returns.
+const EventStop = "stop"
+
+// Track returns a frame for each of the time-ordered points.
+func Track(points []models.LocationHistory) []Frame {
+	frames := make([]Frame, 0, len(points))
+	for _, p := range points {
+		frames = append(frames, frameOf(p, points[0].Timestamp))
+	}
+	return frames
+}
+
+// Resample returns frames every interval from the first point to the last,
+// interpolated linearly between the points either side. No frames are made
+// inside reporting gaps longer than maxGap, so the replay jumps across them
+// rather than gliding in a straight line.
+func Resample(points []models.LocationHistory, interval, maxGap time.Duration) []Frame {
+	if len(points) == 0 || interval <= 0 {
+		return Track(points)
+	}
+	start := points[0].Timestamp
+	var frames []Frame
+	i := 0
+	for at := start; !at.After(points[len(points)-1].Timestamp); at = at.Add(interval) {
+		for i+1 < len(points) && !points[i+1].Timestamp.After(at) {
+			i++
+		}
+		a := points[i]
+		if a.Timestamp.Equal(at) || i+1 == len(points) {
+			frames = append(frames, frameAt(a, at, start))
+			continue
+		}
+		b := points[i+1]
+		span := b.Timestamp.Sub(a.Timestamp)
+		if span > maxGap {
+			continue
+		}
+		t := float64(at.Sub(a.Timestamp)) / float64(span)
+		f := frameAt(a, at, start)
+		f.Latitude += (b.Latitude - a.Latitude) * t
+		f.Longitude += (b.Longitude - a.Longitude) * t
+		f.Speed += (b.Speed - a.Speed) * t
+		f.Interpolated = true
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func frameOf(p models.LocationHistory, start time.Time) Frame {
+	return frameAt(p, p.Timestamp, start)
+}
+
+func frameAt(p models.LocationHistory, at, start time.Time) Frame {
+	return Frame{
+		At:        at,
+		OffsetS:   at.Sub(start).Seconds(),
+		Latitude:  p.Latitude,
+		Longitude: p.Longitude,
+		Speed:     p.Speed,
+		Bearing:   p.Bearing,
+		Moving:    p.IsMoving,
+	}
+}
+
+// Stops finds the runs of stationary points lasting at least minStop, from
+// the first stationary point to the next moving one.
+func Stops(points []models.LocationHistory, minStop time.Duration) []Event {
+	out := []Event{}
+	start := -1
+	closeStop := func(end time.Time) {
+		if start < 0 {
+			return
+		}
+		if d := end.Sub(points[start].Timestamp); d >= minStop {
+			ended := end
+			out = append(out, Event{
+				Type:      EventStop,
+				At:        points[start].Timestamp,
+				EndedAt:   &ended,
+				Latitude:  points[start].Latitude,
+				Longitude: points[start].Longitude,
+				Details:   map[string]interface{}{"duration_s": d.Seconds()},
+			})
+		}
+		start = -1
+	}
+	for i, p := range points {
+		if p.IsMoving {
+			closeStop(p.Timestamp)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		closeStop(points[len(points)-1].Timestamp)
+	}
+	return out
+}
+
+// Timeline orders events by time and places each on the frames.
+func Timeline(frames []Frame, events []Event) []Event {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	for i := range events {
+		frame := sort.Search(len(frames), func(k int) bool { return frames[k].At.After(events[i].At) }) - 1
+		if frame < 0 {
+			frame = 0
+		}
+		events[i].Frame = frame
+		if len(frames) > 0 {
+			events[i].OffsetS = events[i].At.Sub(frames[0].At).Seconds()
+		}
+	}
+	return events
+}
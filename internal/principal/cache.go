@@ -0,0 +1,102 @@
+// Package principal caches the authenticated user together with their sacco
+// and driver profiles. Almost every request resolves the caller this way, so
+// a short TTL removes the repeated lookups from the hot path.
+package principal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+type entry struct {
+	user      models.User
+	expiresAt time.Time
+}
+
+var (
+	mu    sync.RWMutex
+	cache = make(map[uint]entry)
+	ttl   = config.EnvDuration("PRINCIPAL_CACHE_TTL", 30*time.Second)
+)
+
+// Lookup fills dst with the user identified by userID, with Sacco and Driver
+// preloaded. Results are cached for PRINCIPAL_CACHE_TTL (default 30s); a TTL of
+// zero disables caching. gorm.ErrRecordNotFound is returned for unknown users.
+func Lookup(dst *models.User, userID uint) error {
+	if ttl > 0 {
+		mu.RLock()
+		e, ok := cache[userID]
+		mu.RUnlock()
+		if ok && time.Now().Before(e.expiresAt) {
+			*dst = clone(e.user)
+			return nil
+		}
+	}
+
+	var user models.User
+	if err := config.DB.Preload("Sacco").Preload("Driver").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if ttl > 0 {
+		mu.Lock()
+		cache[userID] = entry{user: clone(user), expiresAt: time.Now().Add(ttl)}
+		mu.Unlock()
+	}
+	*dst = user
+	return nil
+}
+
+// Invalidate drops the cached principal for userID. Call it after changing a
+// user's role, sacco or driver profile.
+func Invalidate(userID uint) {
+	mu.Lock()
+	delete(cache, userID)
+	mu.Unlock()
+}
+
+// StartSweep drops expired entries every interval. Lookup only replaces an
+// entry when its user comes back, so without it every user seen since start-up
+// would stay in memory.
+func StartSweep(interval time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	background.Every(interval, func(context.Context) { sweep(time.Now()) })
+}
+
+func sweep(now time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	for id, e := range cache {
+		if !now.Before(e.expiresAt) {
+			delete(cache, id)
+		}
+	}
+}
+
+// InvalidateAll empties the cache.
+func InvalidateAll() {
+	mu.Lock()
+	cache = make(map[uint]entry)
+	mu.Unlock()
+}
+
+// clone copies the user and its pointer associations so callers can't mutate cached state.
+func clone(u models.User) models.User {
+	out := u
+	if u.Sacco != nil {
+		s := *u.Sacco
+		out.Sacco = &s
+	}
+	if u.Driver != nil {
+		d := *u.Driver
+		out.Driver = &d
+	}
+	return out
+}
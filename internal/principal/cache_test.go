@@ -0,0 +1,75 @@
+package principal
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+func seed(tb testing.TB) {
+	tb.Helper()
+	db := testdb.Use(tb, &models.User{}, &models.Sacco{}, &models.Driver{})
+	InvalidateAll()
+	tb.Cleanup(InvalidateAll)
+	for _, r := range []interface{}{
+		&models.User{Model: gorm.Model{ID: 1}, Email: "s@example.com", Role: "sacco"},
+		&models.Sacco{Model: gorm.Model{ID: 1}, UserID: 1, Name: "A"},
+	} {
+		if err := db.Create(r).Error; err != nil {
+			tb.Fatalf("create %T: %v", r, err)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	seed(t)
+	var u models.User
+	if err := Lookup(&u, 1); err != nil {
+		t.Fatal(err)
+	}
+	if u.Sacco == nil || u.Sacco.ID != 1 {
+		t.Fatalf("sacco not preloaded: %+v", u.Sacco)
+	}
+	sweep(time.Now())
+	if len(cache) != 1 {
+		t.Fatalf("%d entries after sweeping before expiry; want 1", len(cache))
+	}
+	sweep(time.Now().Add(ttl))
+	if len(cache) != 0 {
+		t.Errorf("%d entries after sweeping at expiry; want 0", len(cache))
+	}
+}
+
+// BenchmarkLookup compares resolving the caller, as every authenticated
+// request does, with and without the cache, reporting the p95 latency.
+func BenchmarkLookup(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		ttl  time.Duration
+	}{{"uncached", 0}, {"cached", 30 * time.Second}} {
+		b.Run(bc.name, func(b *testing.B) {
+			seed(b)
+			prev := ttl
+			ttl = bc.ttl
+			b.Cleanup(func() { ttl = prev })
+			took := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				var u models.User
+				if err := Lookup(&u, 1); err != nil {
+					b.Fatal(err)
+				}
+				took[i] = time.Since(start)
+			}
+			b.StopTimer()
+			sort.Slice(took, func(i, j int) bool { return took[i] < took[j] })
+			b.ReportMetric(float64(took[len(took)*95/100].Nanoseconds()), "p95-ns")
+		})
+	}
+}
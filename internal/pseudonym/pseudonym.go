@@ -0,0 +1,306 @@
+// Package pseudonym replaces driver and user identifiers in analytics output
+// with keyed pseudonyms that rotate every epoch, so the same person cannot be
+// linked across epochs. Epoch keys are stored sealed with an escrow key held
+// by the operator; with it an admin can lawfully re-identify a pseudonym, and
+// once a key's retention ends it is destroyed and the pseudonyms it produced
+// become irreversible.
+package pseudonym
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Subject kinds that can be pseudonymized, with the prefix their pseudonyms carry.
+const (
+	KindDriver = "driver"
+	KindUser   = "user"
+)
+
+var prefixes = map[string]string{KindDriver: "drv", KindUser: "usr"}
+
+var (
+	// Rotation is the length of an epoch; pseudonyms change when it rolls over.
+	Rotation = config.EnvDuration("PSEUDONYM_ROTATION", 30*24*time.Hour)
+	// Retention is how long after an epoch ends its key is kept for re-identification.
+	Retention = config.EnvDuration("PSEUDONYM_KEY_RETENTION", 365*24*time.Hour)
+)
+
+var (
+	// ErrNotConfigured is returned when PSEUDONYM_ESCROW_KEY is not set.
+	ErrNotConfigured = errors.New("pseudonymization is not configured (PSEUDONYM_ESCROW_KEY)")
+	// ErrMalformed is returned for strings that are not pseudonyms.
+	ErrMalformed = errors.New("malformed pseudonym")
+	// ErrKeyDestroyed is returned when the epoch's key is past retention.
+	ErrKeyDestroyed = errors.New("pseudonym key for this epoch has been destroyed")
+	// ErrNotFound is returned when no subject maps to the pseudonym.
+	ErrNotFound = errors.New("no subject matches this pseudonym")
+)
+
+// escrowKey decodes the base64 AES-256 key that seals epoch keys.
+func escrowKey() ([]byte, error) {
+	raw := config.EnvString("PSEUDONYM_ESCROW_KEY", "")
+	if raw == "" {
+		return nil, ErrNotConfigured
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("PSEUDONYM_ESCROW_KEY must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// Enabled reports whether an escrow key is configured.
+func Enabled() bool {
+	_, err := escrowKey()
+	return err == nil
+}
+
+// EpochOf returns the rotation epoch t falls in.
+func EpochOf(t time.Time) int64 {
+	return t.Unix() / int64(Rotation/time.Second)
+}
+
+// epochBounds returns the start and end of epoch.
+func epochBounds(epoch int64) (time.Time, time.Time) {
+	secs := int64(Rotation / time.Second)
+	return time.Unix(epoch*secs, 0).UTC(), time.Unix((epoch+1)*secs, 0).UTC()
+}
+
+func seal(escrow, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(escrow)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func unseal(escrow, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(escrow)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed key is truncated")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// destroyed reports whether epoch's key is past its retention at now, so it
+// is gone or about to be purged. Every instance agrees on this without
+// waiting for the purge.
+func destroyed(epoch int64, now time.Time) bool {
+	_, ends := epochBounds(epoch)
+	return ends.Before(now.Add(-Retention))
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[int64][]byte{}
+)
+
+// epochKey returns the key for epoch, creating it when create is set. Keys are
+// cached in memory once unsealed, until their retention ends. A key past its
+// retention is never created again.
+func epochKey(db *gorm.DB, epoch int64, create bool) ([]byte, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if destroyed(epoch, time.Now()) {
+		delete(cache, epoch)
+		return nil, ErrKeyDestroyed
+	}
+	if k, ok := cache[epoch]; ok {
+		return k, nil
+	}
+	escrow, err := escrowKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var row models.PseudonymKey
+	err = db.Where("epoch = ?", epoch).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && create {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		sealed, sealErr := seal(escrow, secret)
+		if sealErr != nil {
+			return nil, sealErr
+		}
+		starts, ends := epochBounds(epoch)
+		// Another instance may create the key concurrently; keep whichever landed first.
+		candidate := models.PseudonymKey{Epoch: epoch, StartsAt: starts, EndsAt: ends, Sealed: sealed}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&candidate).Error; err != nil {
+			return nil, err
+		}
+		err = db.Where("epoch = ?", epoch).First(&row).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrKeyDestroyed
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := unseal(escrow, row.Sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal pseudonym key for epoch %d: %w", epoch, err)
+	}
+	cache[epoch] = key
+	return key, nil
+}
+
+func derive(key []byte, kind string, epoch int64, id uint) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%d", kind, id)
+	return prefixes[kind] + "_" + strconv.FormatInt(epoch, 10) + "_" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Pseudonymizer derives pseudonyms for one export or rollup run. It holds the
+// keys it has loaded so a long export does not hit the database per row.
+type Pseudonymizer struct {
+	db   *gorm.DB
+	keys map[int64][]byte
+}
+
+// New returns a Pseudonymizer, or ErrNotConfigured without an escrow key.
+func New(db *gorm.DB) (*Pseudonymizer, error) {
+	if _, err := escrowKey(); err != nil {
+		return nil, err
+	}
+	return &Pseudonymizer{db: db, keys: map[int64][]byte{}}, nil
+}
+
+// For returns the pseudonym of the subject during the epoch containing at,
+// or ErrKeyDestroyed when that epoch's retention has ended.
+func (p *Pseudonymizer) For(kind string, id uint, at time.Time) (string, error) {
+	if _, ok := prefixes[kind]; !ok {
+		return "", fmt.Errorf("unknown pseudonym kind %q", kind)
+	}
+	epoch := EpochOf(at)
+	if destroyed(epoch, time.Now()) {
+		delete(p.keys, epoch)
+		return "", ErrKeyDestroyed
+	}
+	key, ok := p.keys[epoch]
+	if !ok {
+		var err error
+		if key, err = epochKey(p.db, epoch, true); err != nil {
+			return "", err
+		}
+		p.keys[epoch] = key
+	}
+	return derive(key, kind, epoch, id), nil
+}
+
+// Parse splits a pseudonym into its subject kind and epoch.
+func Parse(pseudonym string) (string, int64, error) {
+	parts := strings.Split(pseudonym, "_")
+	if len(parts) != 3 || len(parts[2]) != 16 {
+		return "", 0, ErrMalformed
+	}
+	epoch, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, ErrMalformed
+	}
+	for kind, prefix := range prefixes {
+		if prefix == parts[0] {
+			return kind, epoch, nil
+		}
+	}
+	return "", 0, ErrMalformed
+}
+
+// Reidentify resolves a pseudonym to the subject's ID by re-deriving the
+// pseudonyms of every known subject under the epoch key. Callers must record
+// the request for audit.
+func Reidentify(db *gorm.DB, pseudonym string) (string, uint, error) {
+	kind, epoch, err := Parse(pseudonym)
+	if err != nil {
+		return "", 0, err
+	}
+	key, err := epochKey(db, epoch, false)
+	if err != nil {
+		return kind, 0, err
+	}
+
+	var ids []uint
+	query := db.Unscoped().Model(&models.Driver{})
+	if kind == KindUser {
+		query = db.Unscoped().Model(&models.User{})
+	}
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return kind, 0, err
+	}
+	for _, id := range ids {
+		if hmac.Equal([]byte(derive(key, kind, epoch, id)), []byte(pseudonym)) {
+			return kind, id, nil
+		}
+	}
+	return kind, 0, ErrNotFound
+}
+
+// purge destroys keys whose epochs ended more than Retention ago.
+func purge(db *gorm.DB, now time.Time) {
+	var expired []models.PseudonymKey
+	if err := db.Where("ends_at < ?", now.Add(-Retention)).Find(&expired).Error; err != nil {
+		logrus.WithError(err).Error("pseudonym: Failed to load expired keys.")
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+	epochs := make([]int64, 0, len(expired))
+	for _, k := range expired {
+		epochs = append(epochs, k.Epoch)
+	}
+	// Drop the unsealed copies first, even if the delete below fails.
+	cacheMu.Lock()
+	for _, e := range epochs {
+		delete(cache, e)
+	}
+	cacheMu.Unlock()
+	// Hard delete: a soft-deleted row would keep the sealed key recoverable.
+	if err := db.Unscoped().Where("epoch IN ?", epochs).Delete(&models.PseudonymKey{}).Error; err != nil {
+		logrus.WithError(err).Error("pseudonym: Failed to destroy expired keys.")
+		return
+	}
+	logrus.Infof("pseudonym: Destroyed %d keys past their retention period.", len(epochs))
+}
+
+// StartRetention periodically destroys keys past their retention period.
+func StartRetention(interval time.Duration) {
+	background.Every(interval, func(context.Context) { purge(config.DB, time.Now()) })
+}
@@ -0,0 +1,91 @@
+package pseudonym
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+func setup(t *testing.T) *gorm.DB {
+	t.Helper()
+	t.Setenv("PSEUDONYM_ESCROW_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	prevRotation, prevRetention := Rotation, Retention
+	Rotation, Retention = 24*time.Hour, 7*24*time.Hour
+	reset := func() {
+		cacheMu.Lock()
+		cache = map[int64][]byte{}
+		cacheMu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		Rotation, Retention = prevRotation, prevRetention
+		reset()
+	})
+	return testdb.Open(t, &models.PseudonymKey{}, &models.Driver{})
+}
+
+func TestForRefusesDestroyedEpoch(t *testing.T) {
+	db := setup(t)
+	p, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.For(KindDriver, 1, time.Now().Add(-30*24*time.Hour)); !errors.Is(err, ErrKeyDestroyed) {
+		t.Fatalf("epoch past retention: err = %v; want ErrKeyDestroyed", err)
+	}
+	var keys int64
+	db.Model(&models.PseudonymKey{}).Count(&keys)
+	if keys != 0 {
+		t.Errorf("%d keys created for a destroyed epoch", keys)
+	}
+	if _, err := p.For(KindDriver, 1, time.Now()); err != nil {
+		t.Errorf("current epoch: %v", err)
+	}
+}
+
+func TestPurgeEvictsCache(t *testing.T) {
+	db := setup(t)
+	at := time.Now().Add(-3 * 24 * time.Hour)
+	p, _ := New(db)
+	name, err := p.For(KindDriver, 1, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, id, err := Reidentify(db, name); err != nil && !errors.Is(err, ErrNotFound) || id != 0 {
+		t.Fatalf("reidentify before purge: %d, %v", id, err)
+	}
+
+	// The epoch's retention ends.
+	Retention = time.Hour
+	purge(db, time.Now())
+	cacheMu.Lock()
+	cached := len(cache)
+	cacheMu.Unlock()
+	if cached != 0 {
+		t.Errorf("%d keys still cached after purge", cached)
+	}
+	if _, _, err := Reidentify(db, name); !errors.Is(err, ErrKeyDestroyed) {
+		t.Errorf("reidentify after purge: err = %v; want ErrKeyDestroyed", err)
+	}
+}
+
+// An instance that has not purged yet still stops using a key once its
+// retention ends.
+func TestCachedKeyExpires(t *testing.T) {
+	db := setup(t)
+	epoch := EpochOf(time.Now().Add(-3 * 24 * time.Hour))
+	if _, err := epochKey(db, epoch, true); err != nil {
+		t.Fatal(err)
+	}
+	Retention = time.Hour
+	if _, err := epochKey(db, epoch, false); !errors.Is(err, ErrKeyDestroyed) {
+		t.Errorf("err = %v; want ErrKeyDestroyed", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Package pubsub carries live broadcasts between server replicas, so a client
+// connected to one instance receives updates published on another.
+package pubsub
+
+import (
+	"fmt"
+
+	"ma3_tracker/internal/config"
+)
+
+// Bus delivers published payloads to every subscribed replica, including the
+// publisher itself.
+type Bus interface {
+	// Publish sends payload to all subscribers.
+	Publish(payload []byte) error
+	// Subscribe calls deliver for every payload until Close, reconnecting
+	// as needed. It returns immediately.
+	Subscribe(deliver func(payload []byte))
+	Close() error
+}
+
+// FromEnv returns the bus selected by LOCATION_HUB_BACKEND: nil for "memory"
+// (the default, a single instance) or a Redis bus for "redis", configured by
+// REDIS_URL (redis:// or rediss:// for TLS) and LOCATION_HUB_CHANNEL.
+func FromEnv() (Bus, error) {
+	switch backend := config.EnvString("LOCATION_HUB_BACKEND", "memory"); backend {
+	case "", "memory":
+		return nil, nil
+	case "redis":
+		return NewRedis(
+			config.EnvString("REDIS_URL", "redis://localhost:6379"),
+			config.EnvString("LOCATION_HUB_CHANNEL", "ma3tracker:locations"),
+		)
+	default:
+		return nil, fmt.Errorf("unknown LOCATION_HUB_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,93 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	redisDialTimeout  = 5 * time.Second
+	redisWriteTimeout = 5 * time.Second // Also bounds the wait for a PUBLISH reply
+	redisKeepAlive    = 30 * time.Second
+	// redisHealthCheck is how long the subscription may go quiet before it is
+	// pinged, so a half-open connection is noticed and replaced.
+	redisHealthCheck = 15 * time.Second
+)
+
+// ErrNotSent wraps Publish errors for payloads that never reached Redis, so
+// the caller can deliver them some other way without risking a duplicate.
+var ErrNotSent = errors.New("pubsub: payload not sent")
+
+// Redis is a Bus over Redis pub/sub.
+type Redis struct {
+	client  *redis.Client
+	channel string
+	sub     *redis.PubSub
+}
+
+// NewRedis returns a bus on channel of the server at rawURL
+// (redis://[[user]:password@]host[:port][/db], or rediss:// for TLS).
+func NewRedis(rawURL, channel string) (*Redis, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	opts.DialTimeout = redisDialTimeout
+	opts.ReadTimeout = redisWriteTimeout
+	opts.WriteTimeout = redisWriteTimeout
+	// A PUBLISH that failed after it was written may still have gone out, so
+	// it is never retried; a retry could deliver the payload twice.
+	opts.MaxRetries = -1
+	opts.Dialer = keepAliveDialer(opts.TLSConfig)
+	return &Redis{client: redis.NewClient(opts), channel: channel}, nil
+}
+
+// keepAliveDialer dials with TCP keepalives, over TLS when tlsConfig is set.
+func keepAliveDialer(tlsConfig *tls.Config) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := &net.Dialer{Timeout: redisDialTimeout, KeepAlive: redisKeepAlive}
+		if tlsConfig == nil {
+			return d.DialContext(ctx, network, addr)
+		}
+		return (&tls.Dialer{NetDialer: d, Config: tlsConfig}).DialContext(ctx, network, addr)
+	}
+}
+
+// Publish sends payload to the channel. Errors from connections that could
+// not be made wrap ErrNotSent.
+func (r *Redis) Publish(payload []byte) error {
+	err := r.client.Publish(context.Background(), r.channel, payload).Err()
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return fmt.Errorf("%w: %v", ErrNotSent, err)
+	}
+	return err
+}
+
+// Subscribe starts delivering the channel's messages in the background. The
+// subscription is pinged when quiet and re-established after it drops.
+func (r *Redis) Subscribe(deliver func(payload []byte)) {
+	r.sub = r.client.Subscribe(context.Background(), r.channel)
+	messages := r.sub.Channel(redis.WithChannelHealthCheckInterval(redisHealthCheck))
+	logrus.WithField("channel", r.channel).Info("pubsub: Subscribed to Redis channel.")
+	go func() {
+		for msg := range messages {
+			deliver([]byte(msg.Payload))
+		}
+	}()
+}
+
+// Close stops the subscription and closes the connections.
+func (r *Redis) Close() error {
+	if r.sub != nil {
+		r.sub.Close()
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisRoundTrip(t *testing.T) {
+	srv := miniredis.RunT(t)
+	srv.RequireUserAuth("bus", "secret")
+	bus, err := NewRedis("redis://bus:secret@"+srv.Addr(), "locations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	got := make(chan string, 10)
+	bus.Subscribe(func(payload []byte) { got <- string(payload) })
+	waitSubscribed(t, srv, "locations")
+
+	if err := bus.Publish([]byte(`{"vehicle_id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-got:
+		if p != `{"vehicle_id":1}` {
+			t.Errorf("delivered %q", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("published payload never delivered")
+	}
+	select {
+	case p := <-got:
+		t.Errorf("payload delivered twice: %q", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// The subscription comes back by itself after the server drops it.
+func TestRedisResubscribes(t *testing.T) {
+	srv := miniredis.RunT(t)
+	bus, err := NewRedis("redis://"+srv.Addr(), "locations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	got := make(chan string, 10)
+	bus.Subscribe(func(payload []byte) { got <- string(payload) })
+	waitSubscribed(t, srv, "locations")
+
+	srv.Restart()
+	waitSubscribed(t, srv, "locations")
+	srv.Publish("locations", "after restart")
+	select {
+	case p := <-got:
+		if p != "after restart" {
+			t.Errorf("delivered %q", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing delivered after the server restarted")
+	}
+}
+
+func TestRedisPublishUnreachable(t *testing.T) {
+	srv := miniredis.RunT(t)
+	addr := srv.Addr()
+	srv.Close()
+	bus, err := NewRedis("redis://"+addr, "locations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if err := bus.Publish([]byte("x")); !errors.Is(err, ErrNotSent) {
+		t.Errorf("err = %v; want ErrNotSent", err)
+	}
+}
+
+func waitSubscribed(t *testing.T, srv *miniredis.Miniredis, channel string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for srv.PubSubNumSub(channel)[channel] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("never subscribed to %s", channel)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,164 @@
+// Package relief hands a vehicle over to a relief driver for a bounded session
+// and returns it to the regular driver when the session ends or expires.
+package relief
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/attribution"
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// MaxDuration caps how long a single relief session may last.
+var MaxDuration = config.EnvDuration("RELIEF_MAX_DURATION", 12*time.Hour)
+
+var (
+	// ErrSessionActive is returned when the vehicle is already handed over.
+	ErrSessionActive = errors.New("vehicle already has an active relief session")
+	// ErrNoDriver is returned when the vehicle has no regular driver to relieve.
+	ErrNoDriver = errors.New("vehicle has no assigned driver")
+	// ErrDriverBusy is returned when the relief driver is already on another vehicle.
+	ErrDriverBusy = errors.New("relief driver is already assigned to a vehicle")
+	// ErrSameDriver is returned when a driver is asked to relieve themselves.
+	ErrSameDriver = errors.New("relief driver is the vehicle's current driver")
+	// ErrEnded is returned when ending a session that is already over.
+	ErrEnded = errors.New("relief session has already ended")
+)
+
+// Start hands the vehicle to the relief driver until now+duration. The vehicle
+// and then the relief driver are locked, in the order assignments take them,
+// so concurrent handovers and assignments cannot give either to two parties.
+func Start(db *gorm.DB, vehicleID, reliefDriverID uint, duration time.Duration, note string, now time.Time) (*models.ReliefSession, error) {
+	var session models.ReliefSession
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var vehicle models.Vehicle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, vehicleID).Error; err != nil {
+			return err
+		}
+		if vehicle.DriverID == 0 {
+			return ErrNoDriver
+		}
+		if vehicle.DriverID == reliefDriverID {
+			return ErrSameDriver
+		}
+		var active int64
+		if err := tx.Model(&models.ReliefSession{}).Where("vehicle_id = ? AND ended_at IS NULL", vehicle.ID).Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrSessionActive
+		}
+		var driver models.Driver
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&driver, reliefDriverID).Error; err != nil {
+			return err
+		}
+		// A driver whose own vehicle is handed over gets it back when that
+		// session ends, so they count as busy too.
+		var busy int64
+		if err := tx.Model(&models.Vehicle{}).Where("driver_id = ?", reliefDriverID).Count(&busy).Error; err != nil {
+			return err
+		}
+		if busy == 0 {
+			err := tx.Model(&models.ReliefSession{}).
+				Where("ended_at IS NULL AND (primary_driver_id = ? OR relief_driver_id = ?)", reliefDriverID, reliefDriverID).
+				Count(&busy).Error
+			if err != nil {
+				return err
+			}
+		}
+		if busy > 0 {
+			return ErrDriverBusy
+		}
+
+		session = models.ReliefSession{
+			VehicleID:       vehicle.ID,
+			SaccoID:         vehicle.SaccoID,
+			PrimaryDriverID: vehicle.DriverID,
+			ReliefDriverID:  reliefDriverID,
+			StartedAt:       now,
+			ExpiresAt:       now.Add(duration),
+			Note:            note,
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&vehicle).Update("driver_id", reliefDriverID).Error; err != nil {
+			return err
+		}
+		return attribution.Record(tx, vehicle.ID, vehicle.SaccoID, reliefDriverID, models.AssignmentRelief, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// End closes the session and gives the vehicle back to its regular driver,
+// unless the sacco has reassigned the vehicle in the meantime.
+func End(db *gorm.DB, sessionID uint, reason string, now time.Time) (*models.ReliefSession, error) {
+	var session models.ReliefSession
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, sessionID).Error; err != nil {
+			return err
+		}
+		if !session.Active() {
+			return ErrEnded
+		}
+		session.EndedAt, session.EndReason = &now, reason
+		if err := tx.Model(&session).Updates(map[string]interface{}{"ended_at": now, "end_reason": reason}).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&models.Vehicle{}).
+			Where("id = ? AND driver_id = ?", session.VehicleID, session.ReliefDriverID).
+			Update("driver_id", session.PrimaryDriverID)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return attribution.Record(tx, session.VehicleID, session.SaccoID, session.PrimaryDriverID, models.AssignmentRegular, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ForDriver returns the active session in which the driver is either the
+// regular or the relief driver, or nil.
+func ForDriver(db *gorm.DB, driverID uint) (*models.ReliefSession, error) {
+	var session models.ReliefSession
+	err := db.Where("ended_at IS NULL AND (primary_driver_id = ? OR relief_driver_id = ?)", driverID, driverID).
+		Order("started_at DESC").Limit(1).Find(&session).Error
+	if err != nil || session.ID == 0 {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// StartExpiry periodically ends sessions that have run past their expiry.
+func StartExpiry(interval time.Duration) {
+	background.Every(interval, func(context.Context) { expire(time.Now()) })
+}
+
+func expire(now time.Time) {
+	var ids []uint
+	if err := config.DB.Model(&models.ReliefSession{}).Where("ended_at IS NULL AND expires_at <= ?", now).Pluck("id", &ids).Error; err != nil {
+		logrus.WithError(err).Error("relief: Failed to load expired sessions.")
+		return
+	}
+	for _, id := range ids {
+		if _, err := End(config.DB, id, models.ReliefEndExpired, now); err != nil && !errors.Is(err, ErrEnded) {
+			logrus.WithError(err).WithField("session_id", id).Error("relief: Failed to expire session.")
+		}
+	}
+	if len(ids) > 0 {
+		logrus.Infof("relief: Returned %d vehicles to their regular drivers after relief sessions expired.", len(ids))
+	}
+}
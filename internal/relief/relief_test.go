@@ -0,0 +1,70 @@
+package relief
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// setup seeds vehicles 1 and 2, driven by drivers 1 and 2, and a spare driver 3.
+func setup(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Open(t, &models.Vehicle{}, &models.Driver{}, &models.ReliefSession{}, &models.VehicleAssignment{})
+	for i := uint(1); i <= 3; i++ {
+		if err := db.Create(&models.Driver{Model: gorm.Model{ID: i}, UserID: i, SaccoID: 1, Name: "Driver"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint(1); i <= 2; i++ {
+		if err := db.Create(&models.Vehicle{Model: gorm.Model{ID: i}, SaccoID: 1, DriverID: i, VehicleNo: fmt.Sprintf("KAA %03dA", i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestStartRelievesOneVehicleAtATime(t *testing.T) {
+	db := setup(t)
+	now := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = Start(db, uint(i+1), 3, time.Hour, "", now)
+		}(i)
+	}
+	wg.Wait()
+	started := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case !errors.Is(err, ErrDriverBusy):
+			t.Errorf("Start: %v", err)
+		}
+	}
+	if started != 1 {
+		t.Errorf("driver 3 relieved %d vehicles; want 1", started)
+	}
+}
+
+func TestStartRefusesDriverAwayFromOwnVehicle(t *testing.T) {
+	db := setup(t)
+	now := time.Now()
+	if _, err := Start(db, 1, 3, time.Hour, "", now); err != nil {
+		t.Fatal(err)
+	}
+	// Driver 1 gets vehicle 1 back when the session ends.
+	if _, err := Start(db, 2, 1, time.Hour, "", now); !errors.Is(err, ErrDriverBusy) {
+		t.Errorf("err = %v; want ErrDriverBusy", err)
+	}
+}
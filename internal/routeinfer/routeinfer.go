@@ -0,0 +1,236 @@
+// Package routeinfer proposes a line for routes that have stages but no
+// digitized geometry, using the GPS traces of vehicles assigned to the route.
+package routeinfer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/mapmatch"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/trips"
+)
+
+var (
+	// Lookback is how much location history is considered for each route.
+	Lookback = config.EnvDuration("ROUTE_INFERENCE_LOOKBACK", 14*24*time.Hour)
+	// MinTraces is the number of usable trips required before proposing a line.
+	MinTraces = config.EnvInt("ROUTE_INFERENCE_MIN_TRACES", 3)
+	// EndpointRadius is how close a trip must pass to the first and last stage.
+	EndpointRadius = config.EnvFloat("ROUTE_INFERENCE_ENDPOINT_RADIUS_METERS", 300)
+	// SimplifyTolerance thins the proposed line before it is stored.
+	SimplifyTolerance = config.EnvFloat("ROUTE_INFERENCE_SIMPLIFY_METERS", 5)
+	// RetryAfter is how long the job waits before proposing again for a route
+	// whose last proposal was rejected.
+	RetryAfter = config.EnvDuration("ROUTE_INFERENCE_RETRY_AFTER", 7*24*time.Hour)
+	// compareSamples is how many evenly spaced points traces are compared on.
+	compareSamples = 100
+	// minTripPoints filters out GPS blips that are not real trips.
+	minTripPoints = 10
+)
+
+// ErrNotEnoughTraces is returned when too few trips cover the route end to end.
+var ErrNotEnoughTraces = errors.New("not enough GPS traces cover this route")
+
+// trace is one trip clipped to the stretch between the route's end stages.
+type trace struct {
+	points  []geo.Point
+	times   []time.Time
+	samples []geo.Point
+}
+
+// Infer builds a geometry proposal for the route from recent trips of the
+// drivers currently assigned to its vehicles. The route must have its Stages loaded.
+func Infer(ctx context.Context, db *gorm.DB, route models.Route, matcher mapmatch.Matcher, now time.Time) (*models.RouteGeometryProposal, error) {
+	if len(route.Stages) < 2 {
+		return nil, errors.New("route needs at least two stages")
+	}
+	stages := append([]models.Stage(nil), route.Stages...)
+	sort.Slice(stages, func(i, j int) bool { return stages[i].Seq < stages[j].Seq })
+	first := geo.Point{Lat: stages[0].Lat, Lng: stages[0].Lng}
+	last := geo.Point{Lat: stages[len(stages)-1].Lat, Lng: stages[len(stages)-1].Lng}
+
+	var driverIDs []uint
+	if err := db.Model(&models.Vehicle{}).Where("route_id = ? AND driver_id <> 0", route.ID).Pluck("driver_id", &driverIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var traces []trace
+	for _, driverID := range driverIDs {
+		var points []models.LocationHistory
+		if err := db.Where("driver_id = ? AND timestamp > ?", driverID, now.Add(-Lookback)).Order("timestamp").Find(&points).Error; err != nil {
+			return nil, err
+		}
+		for _, seg := range trips.Segment(points, trips.Gap, minTripPoints) {
+			if t, ok := clip(seg, first, last); ok {
+				traces = append(traces, t)
+			}
+		}
+	}
+	if len(traces) < MinTraces {
+		return nil, ErrNotEnoughTraces
+	}
+
+	best, spread := medoid(traces)
+	line := best.points
+	matcherName := matcher.Name()
+	matched, err := matcher.Match(ctx, best.points, best.times)
+	if err != nil {
+		// An unmatched line is still useful for review; note it and carry on.
+		logrus.WithError(err).WithField("route_id", route.ID).Warn("routeinfer: Map matching failed, proposing raw trace.")
+		matcherName = "none"
+	} else if len(matched) >= 2 {
+		line = matched
+	}
+	line = geo.Simplify(line, SimplifyTolerance)
+
+	wkb, err := geo.LineToWKB(line)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RouteGeometryProposal{
+		RouteID:    route.ID,
+		SaccoID:    route.SaccoID,
+		Geometry:   wkb,
+		TraceCount: len(traces),
+		Matcher:    matcherName,
+		LengthM:    geo.Length(line),
+		Spread:     spread,
+		Status:     models.GeometryProposalPending,
+	}, nil
+}
+
+// clip keeps the part of a trip between its closest approaches to the first
+// and last stage, oriented first to last. Trips that miss either end are dropped.
+func clip(seg []models.LocationHistory, first, last geo.Point) (trace, bool) {
+	iFirst, iLast := -1, -1
+	dFirst, dLast := EndpointRadius, EndpointRadius
+	for i, p := range seg {
+		pt := geo.Point{Lat: p.Latitude, Lng: p.Longitude}
+		if d := geo.Haversine(pt, first); d <= dFirst {
+			iFirst, dFirst = i, d
+		}
+		if d := geo.Haversine(pt, last); d <= dLast {
+			iLast, dLast = i, d
+		}
+	}
+	if iFirst < 0 || iLast < 0 || iFirst == iLast {
+		return trace{}, false
+	}
+
+	var t trace
+	step := 1
+	if iFirst > iLast {
+		step = -1 // Trip ran last-to-first; walk it backwards
+	}
+	for i := iFirst; ; i += step {
+		t.points = append(t.points, geo.Point{Lat: seg[i].Latitude, Lng: seg[i].Longitude})
+		t.times = append(t.times, seg[i].Timestamp)
+		if i == iLast {
+			break
+		}
+	}
+	if step < 0 {
+		t.times = nil // Map matchers expect increasing timestamps
+	}
+	if len(t.points) < minTripPoints/2 {
+		return trace{}, false
+	}
+	total := geo.Length(t.points)
+	if total == 0 {
+		return trace{}, false
+	}
+	for _, s := range geo.Resample(t.points, total/float64(compareSamples-1)) {
+		t.samples = append(t.samples, s.Point)
+	}
+	return t, true
+}
+
+// medoid picks the trace with the smallest mean distance to all others and
+// returns it with that mean distance.
+func medoid(traces []trace) (trace, float64) {
+	bestIdx, bestMean := 0, -1.0
+	for i := range traces {
+		var sum float64
+		for j := range traces {
+			if i != j {
+				sum += traceDistance(traces[i], traces[j])
+			}
+		}
+		mean := sum / float64(len(traces)-1)
+		if bestMean < 0 || mean < bestMean {
+			bestIdx, bestMean = i, mean
+		}
+	}
+	return traces[bestIdx], bestMean
+}
+
+// traceDistance is the mean distance between corresponding resampled points.
+func traceDistance(a, b trace) float64 {
+	n := len(a.samples)
+	if len(b.samples) < n {
+		n = len(b.samples)
+	}
+	if n == 0 {
+		return 0
+	}
+	var sum float64
+	for k := 0; k < n; k++ {
+		sum += geo.Haversine(a.samples[k], b.samples[k])
+	}
+	return sum / float64(n)
+}
+
+// StartInference periodically proposes geometry for routes that have at
+// least two stages, no geometry, no proposal awaiting review and no recently
+// rejected proposal.
+func StartInference(interval time.Duration) {
+	matcher := mapmatch.FromEnv()
+	background.Every(interval, func(ctx context.Context) { inferMissing(ctx, matcher, time.Now()) })
+}
+
+func inferMissing(ctx context.Context, matcher mapmatch.Matcher, now time.Time) {
+	var routes []models.Route
+	err := config.DB.Preload("Stages").
+		Where("geometry IS NULL OR octet_length(geometry) = 0").
+		Where("(SELECT COUNT(*) FROM stages s WHERE s.route_id = routes.id AND s.deleted_at IS NULL) >= 2").
+		Where("NOT EXISTS (SELECT 1 FROM route_geometry_proposals p WHERE p.route_id = routes.id AND p.deleted_at IS NULL AND "+
+			"(p.status = ? OR (p.status = ? AND p.reviewed_at > ?)))", models.GeometryProposalPending, models.GeometryProposalRejected, now.Add(-RetryAfter)).
+		Find(&routes).Error
+	if err != nil {
+		logrus.WithError(err).Error("routeinfer: Failed to load routes missing geometry.")
+		return
+	}
+	proposed := 0
+	for _, route := range routes {
+		if ctx.Err() != nil {
+			break // Shutting down
+		}
+		routeCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		proposal, err := Infer(routeCtx, config.DB, route, matcher, now)
+		cancel()
+		if errors.Is(err, ErrNotEnoughTraces) || ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("route_id", route.ID).Warn("routeinfer: Failed to infer route geometry.")
+			continue
+		}
+		if err := config.DB.Create(proposal).Error; err != nil {
+			logrus.WithError(err).WithField("route_id", route.ID).Error("routeinfer: Failed to save geometry proposal.")
+			continue
+		}
+		proposed++
+	}
+	if proposed > 0 {
+		logrus.Infof("routeinfer: Proposed geometry for %d routes.", proposed)
+	}
+}
@@ -15,6 +15,42 @@ func AdminRoutes(r *gin.Engine){
 		admin.GET("/vehicles",controllers.ListVehicles)
 		admin.GET("/commuters",controllers.ListCommuters)
 		admin.GET("/drivers",controllers.ListDrivers)
+		admin.GET("/deprecations", controllers.ListDeprecatedEndpointUsage)
+		admin.GET("/stats", controllers.GetAdminStats)
+		admin.GET("/ws/metrics", controllers.GetWebSocketMetrics)
+		admin.GET("/routes/pending", controllers.ListPendingRoutes)
+		admin.POST("/routes/:id/approve", controllers.ApproveRoute)
+		admin.POST("/routes/:id/reject", controllers.RejectRoute)
+		admin.PUT("/stops/:id", controllers.UpdateStop)
+		admin.POST("/stops/:id/merge", controllers.MergeStop)
+		admin.GET("/tags", controllers.ListTags)
+		admin.POST("/tags", controllers.CreateCanonicalTag)
+		admin.POST("/tags/:id/merge", controllers.MergeTag)
+		admin.POST("/messages/bulk", controllers.SendAdminBulkMessage)
+		admin.GET("/messages", controllers.ListAdminBulkMessages)
+		admin.GET("/messages/:id", controllers.GetAdminBulkMessage)
+		admin.GET("/incidents", controllers.ListIncidents)
+		admin.POST("/incidents", controllers.CreateIncident)
+		admin.POST("/incidents/:id/verify", controllers.VerifyIncident)
+		admin.POST("/incidents/:id/dismiss", controllers.DismissIncident)
+		admin.POST("/incidents/:id/resolve", controllers.ResolveIncident)
+		admin.GET("/sos", controllers.ListSOSAlerts)
+		admin.POST("/sos/:id/acknowledge", controllers.AcknowledgeSOS)
+		admin.POST("/sos/:id/resolve", controllers.ResolveSOS)
+		admin.GET("/complaints", controllers.ListUnresolvedComplaints)
+		admin.GET("/complaints/summary", controllers.GetComplaintSummary)
+		admin.GET("/reviews", controllers.ListReviewsForModeration)
+		admin.POST("/reviews/:id/hide", controllers.HideRouteReview)
+		admin.POST("/reviews/:id/restore", controllers.RestoreRouteReview)
+		admin.GET("/payments", controllers.ListAdminMpesaPayments)
+		admin.GET("/jobs", controllers.ListJobs)
+		admin.GET("/jobs/:id", controllers.GetJob)
+		admin.POST("/jobs/:id/retry", controllers.RetryJob)
+		admin.GET("/api-keys", controllers.ListAPIKeys)
+		admin.POST("/api-keys", controllers.CreateAPIKey)
+		admin.DELETE("/api-keys/:id", controllers.RevokeAPIKey)
+		admin.POST("/pseudonyms/reidentify", controllers.ReidentifyPseudonym)
+		admin.GET("/pseudonyms/reidentifications", controllers.ListReidentificationRequests)
 
 	}
 }
\ No newline at end of file
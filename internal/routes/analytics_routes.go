@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+	"ma3_tracker/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnalyticsRoutes serves aggregate views of fleet activity to saccos (their
+// own vehicles) and admins.
+func AnalyticsRoutes(r *gin.Engine) {
+	analytics := r.Group("/analytics")
+	analytics.Use(middleware.RequireAuthWithAnyRole("sacco", "admin"))
+	{
+		analytics.GET("/heatmap/:z/:x/:y", controllers.GetHeatmapTile)
+	}
+}
@@ -11,6 +11,8 @@ func AuthRoutes(r *gin.Engine) {
 	{
 		auth.POST("/signup", controllers.SignupUser)
 		auth.POST("/login", controllers.LoginUser)
+		auth.POST("/guest", middleware.GuestSessionRateLimit(), controllers.CreateGuestSession)
+		auth.POST("/invites/accept", controllers.AcceptInvite)
 	}
 
 	protected := r.Group("/api")
@@ -19,5 +21,13 @@ func AuthRoutes(r *gin.Engine) {
         protected.PATCH("/profile", controllers.UpdateUserDetails)
         protected.GET("/profile", controllers.GetMyProfile) // <-- ADD THIS LINE
         protected.PUT("/change-password", controllers.ChangePassword)
+
+        // Push notification tokens of the user's app installs
+        protected.POST("/devices", middleware.DenyGuests(), controllers.RegisterDevice)
+        protected.GET("/devices", middleware.DenyGuests(), controllers.ListDevices)
+        protected.DELETE("/devices/:id", middleware.DenyGuests(), controllers.UnregisterDevice)
+
+        // Status of background jobs the user queued, e.g. exports
+        protected.GET("/jobs/:id", middleware.DenyGuests(), controllers.GetJob)
     }
 }
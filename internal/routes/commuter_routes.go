@@ -9,17 +9,66 @@ import (
 
 func CommuterRoutes (r *gin.Engine){
 	commuter :=r.Group("/commuter")
-	commuter.Use(middleware.RequireAuthWithRole("commuter"))
+	// Guests may browse read-only data under tight rate limits
+	commuter.Use(middleware.RequireAuthWithAnyRole("commuter", middleware.RoleGuest), middleware.GuestRateLimit())
 	{
 		commuter.POST("/routes/find-optimal", controllers.FindOptimalRoute)
+		commuter.POST("/fares/estimate", controllers.EstimateFare)
 		   // Route to get all routes visible to a commuter
         commuter.GET("/routes", controllers.ListAllCommuterRoutes) // Assuming ListRoutes returns all public routes
+        commuter.GET("/routes/:id/etas", controllers.GetRouteETAs)
+        commuter.GET("/stages/:id/arrivals", controllers.GetStageArrivals)
+        commuter.GET("/routes/:id/reviews", controllers.ListRouteReviews)
+        commuter.PUT("/routes/:id/review", middleware.DenyGuests(), controllers.ReviewRoute)
+        commuter.DELETE("/routes/:id/review", middleware.DenyGuests(), controllers.DeleteRouteReview)
+        commuter.GET("/alerts", controllers.ListServiceAlerts)
 
         // Route to get all vehicles visible to a commuter
         commuter.GET("/vehicles", controllers.ListActiveVehicles) // Assuming ListVehicles returns all public vehicles
+        commuter.GET("/vehicles/positions", controllers.ListVehiclePositions)
+        commuter.GET("/vehicles/clusters", controllers.ListVehicleClusters)
+        commuter.POST("/vehicles/:id/crowding", middleware.DenyGuests(), controllers.ReportVehicleCrowding)
 
         // Route to get all drivers visible to a commuter
-        commuter.GET("/drivers", controllers.ListDrivers) // Assuming ListDrivers returns all public drivers
+        commuter.GET("/drivers", middleware.DenyGuests(), controllers.ListDrivers) // Assuming ListDrivers returns all public drivers
+
+        commuter.GET("/tags", controllers.ListTags)
+        commuter.GET("/stops", controllers.ListStops)
+        commuter.GET("/stops/:id", controllers.GetStop)
+        commuter.POST("/stops/:id/crowding", middleware.DenyGuests(), controllers.ReportStopCrowding)
+
+        commuter.GET("/favorites", middleware.DenyGuests(), controllers.ListFavorites)
+        commuter.POST("/favorites", middleware.DenyGuests(), controllers.AddFavorites)
+        commuter.DELETE("/favorites/:id", middleware.DenyGuests(), controllers.DeleteFavorite)
+
+        commuter.GET("/watches", middleware.DenyGuests(), controllers.ListWatches)
+        commuter.POST("/watches", middleware.DenyGuests(), controllers.CreateWatch)
+        commuter.DELETE("/watches/:id", middleware.DenyGuests(), controllers.DeleteWatch)
+
+        commuter.GET("/preferences", middleware.DenyGuests(), controllers.GetCommuterPreferences)
+        commuter.PUT("/preferences", middleware.DenyGuests(), controllers.UpdateCommuterPreferences)
+
+        commuter.POST("/journeys", middleware.DenyGuests(), controllers.CreateJourney)
+        commuter.GET("/journeys", middleware.DenyGuests(), controllers.ListJourneys)
+        commuter.GET("/journeys/:id", middleware.DenyGuests(), controllers.GetJourney)
+        commuter.POST("/journeys/:id/payments", middleware.DenyGuests(), controllers.RecordJourneyPayment)
+        commuter.POST("/journeys/:id/complete", middleware.DenyGuests(), controllers.CompleteJourney)
+        commuter.GET("/journeys/:id/receipt", middleware.DenyGuests(), controllers.GetJourneyReceipt)
+        commuter.POST("/journeys/:id/mpesa", middleware.DenyGuests(), middleware.PaymentRateLimit(), controllers.PayJourneyWithMpesa)
+        commuter.GET("/payments", middleware.DenyGuests(), controllers.ListMpesaPayments)
+        commuter.GET("/payments/:id", middleware.DenyGuests(), controllers.GetMpesaPayment)
+        commuter.GET("/receipts", middleware.DenyGuests(), controllers.ListPaymentReceipts)
+        commuter.GET("/receipts/:id", middleware.DenyGuests(), controllers.GetPaymentReceipt)
+        commuter.GET("/tickets", middleware.DenyGuests(), controllers.ListTickets)
+        commuter.GET("/tickets/:id", middleware.DenyGuests(), controllers.GetTicket)
+        commuter.GET("/trips", middleware.DenyGuests(), controllers.ListTrips)
+        commuter.GET("/trips/frequent", middleware.DenyGuests(), controllers.GetFrequentTrips)
+        commuter.POST("/trips/:id/repeat", middleware.DenyGuests(), controllers.RepeatTrip)
+
+        commuter.POST("/feedback", middleware.DenyGuests(), controllers.SubmitFeedback)
+        commuter.GET("/feedback", middleware.DenyGuests(), controllers.ListMyFeedback)
+        commuter.GET("/feedback/:id", middleware.DenyGuests(), controllers.GetMyFeedback)
+        commuter.POST("/feedback/:id/photo", middleware.DenyGuests(), controllers.UploadFeedbackPhoto)
 
 	}
 
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DocsRoutes serves the API reference for client developers.
+func DocsRoutes(r *gin.Engine) {
+	docs := r.Group("/docs")
+	{
+		docs.GET("", controllers.APIDocs)
+		docs.GET("/openapi.json", controllers.OpenAPISpec)
+	}
+}
@@ -4,15 +4,34 @@ import (
 	//"ma3_tracker/internal/controllers"
 	"ma3_tracker/internal/middleware"
 	"ma3_tracker/internal/controllers"
+	"ma3_tracker/internal/tenancy"
 	"github.com/gin-gonic/gin"
 )
 
 func DriverRoutes (r *gin.Engine){
 	driver := r.Group("/driver")
-	driver.Use(middleware.RequireAuthWithRole("driver"))
+	driver.Use(middleware.RequireAuthWithRole("driver"), tenancy.Middleware())
 	{
 		 driver.GET("/vehicles/driver/:driverId", controllers.GetVehicleByDriverID)
 		 driver.PATCH("/vehicles/:id", controllers.UpdateVehicleStatus)
+		 driver.GET("/coaching/digests", controllers.ListCoachingDigests)
+		 driver.GET("/coaching/digests/:id", controllers.GetCoachingDigest)
+		 driver.POST("/coaching/digests/:id/acknowledge", controllers.AcknowledgeCoachingDigest)
+		 driver.GET("/safety-score", controllers.GetOwnSafetyScore)
+		 driver.GET("/speed-violations", controllers.ListOwnSpeedViolations)
+		 driver.GET("/relief-session", controllers.GetDriverReliefSession)
+		 driver.POST("/relief-session", controllers.HandOverVehicle)
+		 driver.POST("/relief-session/end", controllers.HandBackVehicle)
+		 driver.POST("/media/:kind", controllers.UploadOwnDriverMedia)
+		 driver.GET("/media/:kind", controllers.DownloadOwnDriverMedia)
+		 driver.POST("/journeys/validate", controllers.ValidateJourneySegment)
+		 driver.POST("/journeys/payments/confirm", controllers.ConfirmJourneyPayment)
+		 driver.POST("/tickets/validate", controllers.ValidateTicket)
+		 driver.GET("/trip", controllers.GetCurrentTrip)
+		 driver.POST("/trip", controllers.StartTrip)
+		 driver.POST("/trip/end", controllers.EndTrip)
+		 driver.GET("/trips", controllers.ListOwnTrips)
+		 driver.POST("/sos", controllers.RaiseSOS)
 
 	}
 
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+	"ma3_tracker/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GraphQLRoutes serves the GraphQL API, which apps use alongside REST to
+// fetch a screen's data in one request. Guests may query it under the guest
+// rate limits.
+func GraphQLRoutes(r *gin.Engine) {
+	r.POST("/graphql", middleware.RequireAuthWithAnyRole("admin", "sacco", "driver", "commuter", middleware.RoleGuest),
+		middleware.GuestRateLimit(), controllers.GraphQL)
+	r.GET("/graphql/schema", controllers.GraphQLSchema)
+}
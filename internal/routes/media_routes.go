@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaRoutes serves uploaded media such as sacco logos.
+func MediaRoutes(r *gin.Engine) {
+	r.GET("/media/*key", controllers.ServeMedia)
+}
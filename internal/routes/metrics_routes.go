@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsRoutes exposes metrics for Prometheus to scrape with METRICS_TOKEN
+// as a bearer token. Without METRICS_TOKEN they are not served.
+func MetricsRoutes(r *gin.Engine) {
+	r.GET("/metrics", controllers.Metrics)
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentRoutes receives results from payment providers. They authenticate
+// with a secret in the path rather than a user token.
+func PaymentRoutes(r *gin.Engine) {
+	payments := r.Group("/payments")
+	{
+		payments.POST("/mpesa/callback/:token", controllers.MpesaCallback)
+	}
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+	"ma3_tracker/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PublicRoutes serves data feeds to external organizations holding an API key.
+func PublicRoutes(r *gin.Engine) {
+	public := r.Group("/public/v1")
+	public.Use(middleware.RequireAPIKey())
+	{
+		public.GET("/incidents", controllers.GetIncidentFeed)
+		public.GET("/routes/:id/headways", controllers.GetPublicRouteHeadways)
+	}
+}
@@ -1,12 +1,48 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/middleware"
+)
+
+// Legacy endpoints that predate the sacco-scoped API share one deprecation schedule.
+var (
+	legacyDeprecatedSince = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	legacySunset          = time.Date(2027, time.January, 31, 0, 0, 0, 0, time.UTC)
 )
 
 func SetupRouter() *gin.Engine{
-	r:=gin.Default()
+	// No gin.Logger: RequestLog writes the access log, without secrets in paths
+	r:=gin.New()
+
+	// Request IDs, and one structured log line per request
+	r.Use(middleware.RequestLog())
+
+	// Request counts and latency by route for /metrics
+	r.Use(middleware.Metrics())
+
+	// Render units, currency and time zone per client preferences
+	r.Use(middleware.Formatting())
+
+	// Messages in the client's language
+	r.Use(middleware.Localize())
 
+	// Panics and unknown paths answer with the error envelope too
+	r.Use(gin.CustomRecovery(apierror.Recovered))
+	r.NoRoute(apierror.NoRoute)
+
+	RegisterRoutes(r)
+
+	return r
+}
+
+// RegisterRoutes adds every API endpoint to r. cmd/openapi walks the same
+// set to describe the API.
+func RegisterRoutes(r *gin.Engine) {
 	// Auth routes
 	AuthRoutes(r)
 	DriverRoutes(r)
@@ -15,8 +51,12 @@ func SetupRouter() *gin.Engine{
 	AdminRoutes(r)
 	WebSocketRoutes(r)
 	CommuterRoutes(r)
-
-	r.Run(":8080")
-
-	return r
+	MediaRoutes(r)
+	PublicRoutes(r)
+	TrackerRoutes(r)
+	AnalyticsRoutes(r)
+	PaymentRoutes(r)
+	DocsRoutes(r)
+	MetricsRoutes(r)
+	GraphQLRoutes(r)
 }
\ No newline at end of file
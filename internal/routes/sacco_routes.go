@@ -3,26 +3,147 @@ package routes
 import (
 	"ma3_tracker/internal/controllers"
 	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/tenancy"
 	"github.com/gin-gonic/gin"
 )
 
 func SaccoRoutes (r *gin.Engine){
 	sacco :=r.Group("/sacco")
-	sacco.Use(middleware.RequireAuthWithRole("sacco"))
+	sacco.Use(middleware.RequireAuthWithRole("sacco"), tenancy.Middleware())
 	{
 		//sacco.POST("/",controllers.CreateSacco)
 		sacco.POST("/routes",controllers.CreateRoute)
 		sacco.PATCH("/routes/:id/stages", controllers.AddStagesToRoute) // New endpoint for adding/updating stages
         sacco.GET("/routes", controllers.ListRoutes)
 		sacco.GET("/drivers/:id", controllers.ListDriversBySacco)
+		sacco.GET("/drivers/:id/locations", controllers.ListDriverLocations)
 		sacco.GET("/drivers", controllers.ListDrivers)
+		sacco.POST("/drivers/import", controllers.ImportDrivers)
 		sacco.POST("/vehicle", controllers.CreateVehicle)
 		sacco.GET("/vehicles", controllers.ListVehicles)
+		sacco.POST("/vehicles/import", controllers.ImportVehicles)
+		sacco.PATCH("/vehicles/bulk", controllers.BulkUpdateVehicles)
 		sacco.GET("/vehicles/:id", controllers.ListVehiclesBySacco)
+		sacco.GET("/vehicles/:id/locations", controllers.ListVehicleLocations)
+		sacco.GET("/vehicles/:id/playback", controllers.GetVehiclePlayback)
+		sacco.POST("/vehicles/:id/assign-driver", controllers.AssignVehicleDriver)
+		sacco.POST("/vehicles/:id/status", controllers.SetVehicleStatus)
+		sacco.GET("/vehicles/:id/status-history", controllers.ListVehicleStatusChanges)
+		sacco.GET("/vehicles/:id/assignments", controllers.ListVehicleAssignments)
+		sacco.POST("/vehicles/:id/assignments", controllers.CorrectVehicleAssignment)
+		sacco.POST("/vehicles/:id/tracker-token", controllers.IssueTrackerToken)
+		sacco.DELETE("/vehicles/:id/tracker-token", controllers.RevokeTrackerToken)
+		sacco.POST("/vehicles/:id/restore", controllers.RestoreVehicle)
+		sacco.POST("/vehicles/:id/photo", controllers.UploadVehiclePhoto)
+		sacco.POST("/drivers/:id/media/:kind", controllers.UploadSaccoDriverMedia)
+		sacco.GET("/drivers/:id/media/:kind", controllers.DownloadSaccoDriverMedia)
+		sacco.GET("/vehicles/:id/documents", controllers.ListVehicleDocuments)
+		sacco.POST("/vehicles/:id/documents", controllers.CreateVehicleDocument)
+		sacco.GET("/vehicle-documents", controllers.ListSaccoExpiringDocuments)
+		sacco.PUT("/vehicle-documents/:id", controllers.UpdateVehicleDocument)
+		sacco.DELETE("/vehicle-documents/:id", controllers.DeleteVehicleDocument)
+		sacco.POST("/vehicle-documents/:id/file", controllers.UploadVehicleDocumentFile)
+		sacco.POST("/vehicles/:id/relief-sessions", controllers.StartVehicleRelief)
+		sacco.GET("/relief-sessions", controllers.ListReliefSessions)
+		sacco.POST("/relief-sessions/:id/end", controllers.EndSaccoReliefSession)
+		sacco.POST("/messages/bulk", controllers.SendSaccoBulkMessage)
+		sacco.GET("/messages", controllers.ListSaccoBulkMessages)
+		sacco.GET("/messages/:id", controllers.GetSaccoBulkMessage)
+		sacco.GET("/journeys/:reference/receipt", controllers.VerifyJourneyReceipt)
+		sacco.GET("/receipts", controllers.ListSaccoPaymentReceipts)
+		sacco.GET("/receipts/:reference", controllers.GetSaccoPaymentReceipt)
 		sacco.GET("/route/:id", controllers.GetRoute)
-		sacco.GET("/routes/:id", controllers.ListRoutesBySacco)
+		sacco.GET("/routes/:id/export", controllers.ExportRoute)
+		sacco.GET("/routes/:id/elevation", controllers.GetRouteElevation)
+		sacco.GET("/routes/:id/speed-profile", controllers.GetRouteSpeedProfile)
+		sacco.GET("/routes/:id/headways", controllers.GetRouteHeadways)
+		sacco.GET("/branding", controllers.GetSaccoBranding)
+		sacco.PUT("/branding", controllers.UpdateSaccoBranding)
+		sacco.POST("/branding/logo", controllers.UploadSaccoLogo)
+		sacco.POST("/photo", controllers.UploadSaccoPhoto)
+		sacco.POST("/exports", controllers.CreateExportJob)
+		sacco.GET("/exports", controllers.ListExportJobs)
+		sacco.GET("/exports/:id", controllers.GetExportJob)
+		sacco.GET("/exports/:id/download", controllers.DownloadExportJob)
+		sacco.GET("/location-history/export", controllers.ExportLocationHistory)
+		sacco.GET("/allocation/recommendations", controllers.GetAllocationRecommendations)
+		sacco.GET("/coaching/digests", controllers.ListSaccoCoachingDigests)
+		sacco.POST("/imports", controllers.CreateRouteImport)
+		sacco.GET("/imports/:id", controllers.GetRouteImport)
+		sacco.POST("/imports/:id/confirm", controllers.ConfirmRouteImport)
+		sacco.DELETE("/imports/:id", controllers.DiscardRouteImport)
+		sacco.GET("/reports/adherence", controllers.GetAdherenceReport)
+		sacco.GET("/reports/adherence/trips", controllers.ListTripAdherence)
+		sacco.GET("/reports/safety", controllers.GetSafetyReport)
+		sacco.GET("/reports/vehicle-distance", controllers.GetVehicleDistanceReport)
+		sacco.GET("/reports/stage-dwell", controllers.GetStageDwellReport)
+		sacco.GET("/reports/headways", controllers.GetHeadwayReport)
+		sacco.GET("/reports/revenue", controllers.GetRevenueReport)
+		sacco.GET("/dashboard/summary", controllers.GetDashboardSummary)
+		sacco.GET("/speed-limits", controllers.GetSpeedLimits)
+		sacco.PUT("/speed-limit", controllers.SetSaccoSpeedLimit)
+		sacco.PUT("/routes/:id/speed-limit", controllers.SetRouteSpeedLimit)
+		sacco.GET("/broadcast-throttle", controllers.GetBroadcastThrottle)
+		sacco.PUT("/broadcast-throttle", controllers.SetBroadcastThrottle)
+		sacco.GET("/speed-violations", controllers.ListSpeedViolations)
+		sacco.GET("/speed-violations/:id", controllers.GetSpeedViolation)
+		sacco.GET("/route-deviations", controllers.ListRouteDeviations)
+		sacco.GET("/route-deviations/summary", controllers.SummarizeRouteDeviations)
+		sacco.GET("/route-deviations/:id", controllers.GetRouteDeviation)
+		sacco.GET("/stage-events", controllers.ListStageEvents)
+		sacco.GET("/trips", controllers.ListSaccoTrips)
+		sacco.GET("/trip-summaries", controllers.ListTripSummaries)
+		sacco.GET("/trip-summaries/:id", controllers.GetTripSummary)
+		sacco.GET("/trips/:id", controllers.GetSaccoTrip)
+		sacco.POST("/trips/:id/end", controllers.EndSaccoTrip)
+		sacco.GET("/sos", controllers.ListSaccoSOSAlerts)
+		sacco.POST("/sos/:id/acknowledge", controllers.AcknowledgeSOS)
+		sacco.POST("/sos/:id/resolve", controllers.ResolveSOS)
+		sacco.POST("/alerts", controllers.CreateServiceAlert)
+		sacco.GET("/alerts", controllers.ListSaccoServiceAlerts)
+		sacco.GET("/alerts/:id", controllers.GetServiceAlert)
+		sacco.PUT("/alerts/:id", controllers.UpdateServiceAlert)
+		sacco.DELETE("/alerts/:id", controllers.DeleteServiceAlert)
+		sacco.POST("/alerts/:id/restore", controllers.RestoreServiceAlert)
+		sacco.GET("/feedback", controllers.ListSaccoFeedback)
+		sacco.GET("/feedback/:id", controllers.GetSaccoFeedback)
+		sacco.PATCH("/feedback/:id", controllers.UpdateFeedbackStatus)
+		sacco.GET("/reviews", controllers.ListSaccoRouteReviews)
+		sacco.POST("/reviews/:id/flag", controllers.FlagRouteReview)
+		sacco.POST("/routes/:id/publish", controllers.PublishRoute)
+		sacco.POST("/routes/:id/unpublish", controllers.UnpublishRoute)
+		sacco.POST("/routes/:id/archive", controllers.ArchiveRoute)
+		sacco.POST("/routes/:id/restore", controllers.RestoreRoute)
+		sacco.PUT("/routes/:id/tags", controllers.SetRouteTags)
+		sacco.GET("/routes/:id/fares", controllers.ListRouteFares)
+		sacco.PUT("/routes/:id/fares", controllers.SetRouteFares)
+		sacco.GET("/routes/:id/fare-rules", controllers.ListFareRules)
+		sacco.POST("/routes/:id/fare-rules", controllers.CreateFareRule)
+		sacco.GET("/fare-rules/:id", controllers.GetFareRule)
+		sacco.PUT("/fare-rules/:id", controllers.UpdateFareRule)
+		sacco.DELETE("/fare-rules/:id", controllers.DeleteFareRule)
+		sacco.POST("/fare-rules/:id/restore", controllers.RestoreFareRule)
+		sacco.POST("/routes/:id/geometry-proposals", controllers.InferRouteGeometry)
+		sacco.GET("/routes/:id/geometry-proposals", controllers.ListRouteGeometryProposals)
+		sacco.POST("/geometry-proposals/:id/accept", controllers.AcceptGeometryProposal)
+		sacco.POST("/geometry-proposals/:id/reject", controllers.RejectGeometryProposal)
+		sacco.GET("/tags", controllers.ListTags)
+		sacco.POST("/webhooks", controllers.CreateWebhook)
+		sacco.GET("/webhooks", controllers.ListWebhooks)
+		sacco.GET("/webhooks/:id", controllers.GetWebhook)
+		sacco.PUT("/webhooks/:id", controllers.UpdateWebhook)
+		sacco.DELETE("/webhooks/:id", controllers.DeleteWebhook)
+		sacco.POST("/webhooks/:id/rotate-secret", controllers.RotateWebhookSecret)
+		sacco.POST("/webhooks/:id/ping", controllers.PingWebhook)
+		sacco.GET("/webhooks/:id/deliveries", controllers.ListWebhookDeliveries)
+		sacco.GET("/routes/:id", middleware.Deprecated(middleware.Deprecation{
+			Since:     legacyDeprecatedSince,
+			Sunset:    legacySunset,
+			Successor: "/sacco/routes",
+		}), controllers.ListRoutesBySacco)
 		sacco.PUT("/routes/:id", controllers.UpdateRoute)              // For updating route metadata
         sacco.DELETE("/routes/:id", controllers.DeleteRoute)
+		sacco.DELETE("/routes/bulk", controllers.BulkDeleteRoutes)
 	}
 
 }
\ No newline at end of file
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"ma3_tracker/internal/controllers"
+	"ma3_tracker/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrackerRoutes accepts locations from GPS trackers fitted to vehicles.
+func TrackerRoutes(r *gin.Engine) {
+	tracker := r.Group("/tracker")
+	tracker.Use(middleware.RequireTrackerToken())
+	{
+		tracker.POST("/locations", controllers.IngestTrackerLocations)
+	}
+}
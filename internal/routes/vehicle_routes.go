@@ -10,6 +10,10 @@ func VehicleRoutes (r *gin.Engine){
 	vehicle := r.Group("/vehicle")
 	vehicle.Use(middleware.RequireAuth())
 	{
-		vehicle.POST("/",controllers.CreateVehicle)
+		vehicle.POST("/", middleware.Deprecated(middleware.Deprecation{
+			Since:     legacyDeprecatedSince,
+			Sunset:    legacySunset,
+			Successor: "/sacco/vehicle",
+		}), controllers.CreateVehicle)
 	}
 }
\ No newline at end of file
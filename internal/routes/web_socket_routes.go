@@ -14,6 +14,7 @@ func WebSocketRoutes (r *gin.Engine){
 	{
 
 		wsRoutes.GET("/location", controllers.HandleLocationWebSocket) // <--- NEW WEBSOCKET ROUTE
+		wsRoutes.GET("/schema", controllers.GetWebSocketSchema)
 
 	}
 }
\ No newline at end of file
@@ -0,0 +1,141 @@
+// Package spreadsheet reads tabular uploads (CSV or the first worksheet of an
+// XLSX workbook) into a header and data rows, for bulk imports that report
+// per row.
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for files that are neither CSV nor XLSX.
+	ErrUnsupportedFormat = errors.New("upload a .csv or .xlsx file")
+	// ErrEmpty is returned when the file has no header row.
+	ErrEmpty = errors.New("file is empty")
+)
+
+// Row is one data row. Line is its row number in the file (the header is 1).
+type Row struct {
+	Line  int
+	Cells []string
+}
+
+// Sheet is a header row and the non-blank rows below it.
+type Sheet struct {
+	Header []string
+	Rows   []Row
+}
+
+// Read parses data according to filename's extension. At most maxRows data
+// rows are accepted.
+func Read(filename string, data []byte, maxRows int) (Sheet, error) {
+	var lines [][]string
+	var numbers []int
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".txt":
+		lines, numbers, err = readCSV(data)
+	case ".xlsx":
+		lines, numbers, err = readXLSX(data)
+	default:
+		return Sheet{}, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return Sheet{}, err
+	}
+
+	var sheet Sheet
+	for i, cells := range lines {
+		for j := range cells {
+			cells[j] = strings.TrimSpace(cells[j])
+		}
+		if blank(cells) {
+			continue
+		}
+		if sheet.Header == nil {
+			cells[0] = strings.TrimPrefix(cells[0], "\ufeff")
+			sheet.Header = cells
+			continue
+		}
+		if len(sheet.Rows) == maxRows {
+			return Sheet{}, fmt.Errorf("file has more than %d rows", maxRows)
+		}
+		sheet.Rows = append(sheet.Rows, Row{Line: numbers[i], Cells: cells})
+	}
+	if sheet.Header == nil {
+		return Sheet{}, ErrEmpty
+	}
+	return sheet, nil
+}
+
+func blank(cells []string) bool {
+	for _, c := range cells {
+		if c != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func readCSV(data []byte) ([][]string, []int, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	var lines [][]string
+	var numbers []int
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return lines, numbers, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		lines, numbers = append(lines, rec), append(numbers, line)
+	}
+}
+
+// Columns maps column keys to their position in a sheet's header.
+type Columns map[string]int
+
+// Columns resolves each key of aliases to the first header cell matching one
+// of its names, ignoring case. Keys with no matching column are left out.
+func (s Sheet) Columns(aliases map[string][]string) Columns {
+	cols := Columns{}
+	for i, h := range s.Header {
+		h = strings.ToLower(h)
+		for key, names := range aliases {
+			if _, done := cols[key]; done {
+				continue
+			}
+			for _, n := range names {
+				if h == n {
+					cols[key] = i
+					break
+				}
+			}
+		}
+	}
+	return cols
+}
+
+// Has reports whether the sheet has a column for key.
+func (c Columns) Has(key string) bool {
+	_, ok := c[key]
+	return ok
+}
+
+// Get returns the row's value in the column for key, or "" when absent.
+func (c Columns) Get(row Row, key string) string {
+	if i, ok := c[key]; ok && i < len(row.Cells) {
+		return row.Cells[i]
+	}
+	return ""
+}
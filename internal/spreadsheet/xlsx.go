@@ -0,0 +1,186 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxXMLBytes bounds how much of each workbook part is decompressed.
+const maxXMLBytes = 64 << 20
+
+var errInvalidXLSX = errors.New("file is not a valid .xlsx workbook")
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string: plain text or rich-text runs.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			V      string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the cell text of the workbook's first worksheet.
+func readXLSX(data []byte) ([][]string, []int, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, errInvalidXLSX
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decodePart(f, &sst); err != nil {
+			return nil, nil, err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	f, ok := files[firstSheetPath(files)]
+	if !ok {
+		return nil, nil, errInvalidXLSX
+	}
+	var ws xlsxWorksheet
+	if err := decodePart(f, &ws); err != nil {
+		return nil, nil, err
+	}
+
+	var lines [][]string
+	var numbers []int
+	for i, row := range ws.Rows {
+		number := row.R
+		if number == 0 {
+			number = i + 1
+		}
+		var cells []string
+		for j, c := range row.Cells {
+			col := j
+			if c.R != "" {
+				col = columnIndex(c.R)
+			}
+			if col < 0 {
+				return nil, nil, fmt.Errorf("invalid cell reference %q", c.R)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			switch c.T {
+			case "s":
+				n, err := strconv.Atoi(c.V)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, nil, fmt.Errorf("cell %s refers to a missing shared string", c.R)
+				}
+				cells[col] = shared[n]
+			case "inlineStr":
+				cells[col] = c.Inline.String()
+			case "b":
+				cells[col] = strconv.FormatBool(c.V == "1")
+			default:
+				cells[col] = c.V
+			}
+		}
+		lines, numbers = append(lines, cells), append(numbers, number)
+	}
+	return lines, numbers, nil
+}
+
+// firstSheetPath resolves the workbook's first sheet through its
+// relationships, falling back to the conventional name.
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+	wbFile, ok := files["xl/workbook.xml"]
+	relsFile, ok2 := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !ok2 {
+		return fallback
+	}
+	var wb xlsxWorkbook
+	var rels xlsxRelationships
+	if decodePart(wbFile, &wb) != nil || decodePart(relsFile, &rels) != nil || len(wb.Sheets) == 0 {
+		return fallback
+	}
+	for _, r := range rels.Relationships {
+		if r.ID != wb.Sheets[0].RelID {
+			continue
+		}
+		if strings.HasPrefix(r.Target, "/") {
+			return strings.TrimPrefix(r.Target, "/")
+		}
+		return path.Join("xl", r.Target)
+	}
+	return fallback
+}
+
+func decodePart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return errInvalidXLSX
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, maxXMLBytes)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidXLSX, f.Name)
+	}
+	return nil
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12" to a
+// zero-based column index.
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A') + 1
+		} else {
+			break
+		}
+	}
+	return col - 1
+}
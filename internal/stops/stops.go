@@ -0,0 +1,168 @@
+// Package stops links route stages to shared Stop records so a physical stage
+// used by many routes is stored once.
+package stops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+// MatchRadiusMeters is how close a stage must be to an existing stop with the
+// same name to be treated as the same physical stop.
+var MatchRadiusMeters = 50.0
+
+// ErrDuplicate is returned when a stop is renamed or moved onto another live
+// stop with the same name; merge them instead.
+var ErrDuplicate = errors.New("stops: a stop with this name is already there")
+
+// MatchKey is a stop's name, normalised as stages are matched, and the grid
+// cell of MatchRadiusMeters it lies in. Stops with the same key are the same
+// stop; the unique index on it settles races that the radius search in
+// Resolve cannot see.
+func MatchKey(name string, lat, lng float64) string {
+	cell := MatchRadiusMeters / geo.EarthRadius * 180 / math.Pi
+	return fmt.Sprintf("%s|%d|%d", normalName(name), int64(math.Floor(lat/cell)), int64(math.Floor(lng/cell)))
+}
+
+// Resolve returns the stop a stage at (lat, lng) named name belongs to,
+// creating one when no nearby stop with the same name exists.
+func Resolve(tx *gorm.DB, name string, lat, lng float64) (models.Stop, error) {
+	var candidates []models.Stop
+	dLat := MatchRadiusMeters / geo.EarthRadius * 180 / math.Pi
+	dLng := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	if err := tx.Where("lat BETWEEN ? AND ? AND lng BETWEEN ? AND ?", lat-dLat, lat+dLat, lng-dLng, lng+dLng).
+		Find(&candidates).Error; err != nil {
+		return models.Stop{}, err
+	}
+
+	here := geo.Point{Lat: lat, Lng: lng}
+	var best *models.Stop
+	bestDist := math.Inf(1)
+	for i := range candidates {
+		if !sameName(candidates[i].Name, name) {
+			continue
+		}
+		if d := geo.Haversine(here, geo.Point{Lat: candidates[i].Lat, Lng: candidates[i].Lng}); d <= MatchRadiusMeters && d < bestDist {
+			best, bestDist = &candidates[i], d
+		}
+	}
+	if best != nil {
+		return *best, nil
+	}
+
+	key := MatchKey(name, lat, lng)
+	stop := models.Stop{Name: strings.TrimSpace(name), Lat: lat, Lng: lng, MatchKey: &key}
+	stop.Geometry, _ = geo.PointToWKB(geo.Point{Lat: lat, Lng: lng})
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stop).Error; err != nil {
+		return models.Stop{}, err
+	}
+	if stop.ID == 0 {
+		// Another request created the stop first
+		err := tx.Where("match_key = ?", key).First(&stop).Error
+		return stop, err
+	}
+	return stop, nil
+}
+
+// Fill copies the position (and name, when missing) of the referenced stop
+// onto stages that name an existing stop_id.
+func Fill(tx *gorm.DB, stages []models.Stage) error {
+	for i := range stages {
+		if stages[i].StopID == 0 {
+			continue
+		}
+		var stop models.Stop
+		if err := tx.First(&stop, stages[i].StopID).Error; err != nil {
+			return err
+		}
+		stages[i].Lat, stages[i].Lng = stop.Lat, stop.Lng
+		if stages[i].Name == "" {
+			stages[i].Name = stop.Name
+		}
+	}
+	return nil
+}
+
+// Link attaches stages without a stop_id to a matching or new shared stop.
+func Link(tx *gorm.DB, stages []models.Stage) error {
+	for i := range stages {
+		if stages[i].StopID != 0 {
+			continue
+		}
+		stop, err := Resolve(tx, stages[i].Name, stages[i].Lat, stages[i].Lng)
+		if err != nil {
+			return err
+		}
+		stages[i].StopID = stop.ID
+	}
+	return nil
+}
+
+// Backfill links stages created before shared stops existed. It is safe to run
+// on every start-up; only stages without a stop are touched.
+func Backfill(db *gorm.DB) error {
+	var stages []models.Stage
+	if err := db.Where("stop_id IS NULL OR stop_id = 0").Order("id").Find(&stages).Error; err != nil {
+		return err
+	}
+	if len(stages) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, s := range stages {
+			stop, err := Resolve(tx, s.Name, s.Lat, s.Lng)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Stage{}).Where("id = ?", s.ID).Update("stop_id", stop.ID).Error; err != nil {
+				return err
+			}
+		}
+		logrus.Infof("stops: Linked %d existing stages to shared stops.", len(stages))
+		return nil
+	})
+}
+
+// Move updates a stop's position and every stage that references it. It
+// returns ErrDuplicate when another stop with the stop's name is there.
+func Move(tx *gorm.DB, stop *models.Stop, lat, lng float64) error {
+	stop.Lat, stop.Lng = lat, lng
+	stop.Geometry, _ = geo.PointToWKB(geo.Point{Lat: lat, Lng: lng})
+	key := MatchKey(stop.Name, lat, lng)
+	stop.MatchKey = &key
+	if err := tx.Save(stop).Error; err != nil {
+		var state interface{ SQLState() string }
+		if errors.As(err, &state) && state.SQLState() == "23505" {
+			return ErrDuplicate
+		}
+		return err
+	}
+	return tx.Model(&models.Stage{}).Where("stop_id = ?", stop.ID).
+		Updates(map[string]interface{}{"lat": lat, "lng": lng}).Error
+}
+
+// Merge repoints every stage of duplicate to target and deletes duplicate.
+func Merge(tx *gorm.DB, target, duplicate models.Stop) error {
+	if err := tx.Model(&models.Stage{}).Where("stop_id = ?", duplicate.ID).
+		Updates(map[string]interface{}{"stop_id": target.ID, "lat": target.Lat, "lng": target.Lng}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&duplicate).Error
+}
+
+func sameName(a, b string) bool {
+	return normalName(a) == normalName(b)
+}
+
+func normalName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
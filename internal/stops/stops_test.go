@@ -0,0 +1,65 @@
+package stops_test
+
+import (
+	"testing"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/stops"
+	"ma3_tracker/internal/testdb"
+)
+
+func TestResolveSharesStop(t *testing.T) {
+	db := testdb.Open(t, &models.Stop{})
+	a, err := stops.Resolve(db, "Kencom", -1.2850, 36.8250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := stops.Resolve(db, " kencom ", -1.28501, 36.82501)
+	if err != nil || b.ID != a.ID {
+		t.Fatalf("nearby stage with the same name resolved to %d, %v; want stop %d", b.ID, err, a.ID)
+	}
+	c, err := stops.Resolve(db, "Ambassadeur", -1.2850, 36.8250)
+	if err != nil || c.ID == a.ID {
+		t.Errorf("another name at the same spot resolved to %d, %v; want a new stop", c.ID, err)
+	}
+}
+
+// The radius search misses a stop created by a concurrent request; the
+// unique match key catches it.
+func TestResolveConflict(t *testing.T) {
+	db := testdb.Open(t, &models.Stop{})
+	key := stops.MatchKey("Kencom", -1.2850, 36.8250)
+	// Created elsewhere after this request's search, modelled by a row the
+	// search does not see
+	existing := models.Stop{Name: "Kencom", Lat: 10, Lng: 10, MatchKey: &key}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+	stop, err := stops.Resolve(db, "Kencom", -1.2850, 36.8250)
+	if err != nil || stop.ID != existing.ID {
+		t.Fatalf("got stop %d, %v; want the existing stop %d", stop.ID, err, existing.ID)
+	}
+	var n int64
+	db.Model(&models.Stop{}).Count(&n)
+	if n != 1 {
+		t.Errorf("%d stops; want 1", n)
+	}
+}
+
+func TestMoveOntoSameName(t *testing.T) {
+	db := testdb.Open(t, &models.Stop{}, &models.Stage{})
+	a, _ := stops.Resolve(db, "Kencom", -1.2850, 36.8250)
+	b, _ := stops.Resolve(db, "Kencom", -1.3000, 36.8000)
+	if a.ID == b.ID {
+		t.Fatal("distant stages share a stop")
+	}
+	if err := stops.Move(db, &b, a.Lat, a.Lng); err == nil {
+		t.Error("moved a stop onto another with the same name")
+	}
+	if err := db.Delete(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := stops.Move(db, &b, a.Lat, a.Lng); err != nil {
+		t.Errorf("move after the other stop was deleted: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanKey(t *testing.T) {
+	cases := map[string]string{
+		"exports/1/a.csv":      "exports/1/a.csv",
+		"/exports/1/a.csv":     "exports/1/a.csv",
+		"///exports/1/a.csv":   "exports/1/a.csv",
+		"/./exports/1/a.csv":   "exports/1/a.csv",
+		"exports//1/./a.csv":   "exports/1/a.csv",
+		"saccos/2/photo-1.png": "saccos/2/photo-1.png",
+	}
+	for in, want := range cases {
+		got, err := CleanKey(in)
+		if err != nil || got != want {
+			t.Errorf("CleanKey(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "/", "//./", "../etc/passwd", "saccos/../exports/1/a.csv", "a/.."} {
+		if got, err := CleanKey(in); err == nil {
+			t.Errorf("CleanKey(%q) = %q; want an error", in, got)
+		}
+	}
+}
+
+func TestIsPrivate(t *testing.T) {
+	private := []string{
+		"exports/1/a.csv",
+		"/exports/1/a.csv",
+		"///exports/1/a.csv",
+		"/./exports/1/a.csv",
+		".//driver-documents/3/licence-x.pdf",
+		"vehicle-documents/1/2/3-x.pdf",
+		"feedback/9/photo-x.jpg",
+		"saccos/../exports/1/a.csv",
+	}
+	for _, key := range private {
+		if !IsPrivate(key) {
+			t.Errorf("IsPrivate(%q) = false", key)
+		}
+	}
+	for _, key := range []string{"saccos/1/logo.png", "/vehicles/2/photo-1.jpg", "exportsx/a"} {
+		if IsPrivate(key) {
+			t.Errorf("IsPrivate(%q) = true", key)
+		}
+	}
+}
+
+func TestRandomName(t *testing.T) {
+	a, b := RandomName(), RandomName()
+	if len(a) != 32 || a == b {
+		t.Fatalf("RandomName() = %q, %q; want distinct 32-character names", a, b)
+	}
+}
+
+// signedParams returns the expires and sig values of a URL from SignedURL.
+func signedParams(t *testing.T, key string, ttl time.Duration) (string, string) {
+	t.Helper()
+	raw, _ := SignedURL(key, ttl)
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("SignedURL(%q) = %q: %v", key, raw, err)
+	}
+	return u.Query().Get("expires"), u.Query().Get("sig")
+}
+
+func TestVerifySignature(t *testing.T) {
+	t.Setenv("STORAGE_SIGNING_KEY", "test-signing-key")
+
+	expires, sig := signedParams(t, "exports/1/a.csv", time.Minute)
+	if !VerifySignature("exports/1/a.csv", expires, sig) {
+		t.Fatal("signature for exports/1/a.csv did not verify")
+	}
+	// Equivalent spellings of the key share its signature
+	if !VerifySignature("///exports/1/a.csv", expires, sig) {
+		t.Error("signature did not verify for an equivalent key")
+	}
+	if VerifySignature("exports/1/b.csv", expires, sig) {
+		t.Error("signature verified for another key")
+	}
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	if VerifySignature("exports/1/a.csv", later, sig) {
+		t.Error("signature verified with a changed expiry")
+	}
+	if VerifySignature("exports/1/a.csv", expires, strings.Repeat("0", len(sig))) {
+		t.Error("forged signature verified")
+	}
+
+	expired, sig := signedParams(t, "exports/1/a.csv", -time.Second)
+	if VerifySignature("exports/1/a.csv", expired, sig) {
+		t.Error("expired signature verified")
+	}
+
+	t.Setenv("STORAGE_SIGNING_KEY", "another-key")
+	if VerifySignature("exports/1/a.csv", expires, sig) {
+		t.Error("signature verified under another signing key")
+	}
+}
+
+func TestVerifySignatureWithoutKey(t *testing.T) {
+	t.Setenv("STORAGE_SIGNING_KEY", "")
+	if err := CheckSigningKey(); err != ErrNoSigningKey {
+		t.Fatalf("CheckSigningKey() = %v; want ErrNoSigningKey", err)
+	}
+	// A signature made with the empty key must not be accepted
+	exp := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	n, _ := strconv.ParseInt(exp, 10, 64)
+	if VerifySignature("exports/1/a.csv", exp, signature("exports/1/a.csv", n)) {
+		t.Fatal("signature verified without a signing key")
+	}
+}
+
+func TestLocalStoreCleansKeys(t *testing.T) {
+	s := &LocalStore{Root: t.TempDir()}
+	ctx := context.Background()
+	if err := s.Put(ctx, "/./exports/1/a.csv", strings.NewReader("x"), "text/csv"); err != nil {
+		t.Fatal(err)
+	}
+	rc, _, err := s.Open(ctx, "exports/1/a.csv")
+	if err != nil {
+		t.Fatalf("object stored under an unclean key was not found: %v", err)
+	}
+	rc.Close()
+	if _, _, err := s.Open(ctx, "../a.csv"); err == nil {
+		t.Fatal("Open accepted a key outside the store")
+	}
+}
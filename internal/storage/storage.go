@@ -0,0 +1,138 @@
+// Package storage persists uploaded media (logos, photos, documents) behind a
+// small interface so the backend can change without touching controllers.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ma3_tracker/internal/config"
+)
+
+// ErrNotFound is returned when a key does not exist in the store.
+var ErrNotFound = errors.New("object not found")
+
+// Store saves and retrieves objects by key (a slash-separated relative path).
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+var (
+	defaultStore Store
+	defaultOnce  sync.Once
+)
+
+// Default returns the process-wide store configured from the environment:
+// STORAGE_BACKEND=local (default) writes under STORAGE_DIR, s3 uses the
+// S3_* settings.
+func Default() Store {
+	defaultOnce.Do(func() {
+		baseURL := config.EnvString("MEDIA_BASE_URL", "/media")
+		if strings.EqualFold(config.EnvString("STORAGE_BACKEND", "local"), "s3") {
+			defaultStore = &S3Store{
+				Endpoint:        config.EnvString("S3_ENDPOINT", "https://s3.amazonaws.com"),
+				Region:          config.EnvString("S3_REGION", "us-east-1"),
+				Bucket:          config.EnvString("S3_BUCKET", ""),
+				AccessKeyID:     config.EnvString("S3_ACCESS_KEY_ID", ""),
+				SecretAccessKey: config.EnvString("S3_SECRET_ACCESS_KEY", ""),
+				PathStyle:       config.EnvBool("S3_PATH_STYLE", true),
+				Prefix:          config.EnvString("S3_KEY_PREFIX", ""),
+				BaseURL:         baseURL,
+				Client:          &http.Client{Timeout: config.EnvDuration("S3_TIMEOUT", 5*time.Minute)},
+			}
+			return
+		}
+		defaultStore = &LocalStore{
+			Root:    config.EnvString("STORAGE_DIR", "./uploads"),
+			BaseURL: baseURL,
+		}
+	})
+	return defaultStore
+}
+
+// LocalStore keeps objects on the local filesystem under Root.
+type LocalStore struct {
+	Root    string
+	BaseURL string
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	clean, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the object, creating parent directories as needed.
+func (s *LocalStore) Put(_ context.Context, key string, r io.Reader, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(p)
+		return err
+	}
+	return f.Close()
+}
+
+// Open returns the object and its content type inferred from the key extension.
+func (s *LocalStore) Open(_ context.Context, key string) (io.ReadCloser, string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f, contentType, nil
+}
+
+// Delete removes the object; missing objects are not an error.
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL returns the public URL the media endpoint serves the object from.
+func (s *LocalStore) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + strings.TrimPrefix(key, "/")
+}
@@ -0,0 +1,182 @@
+// Package tenancy resolves whose data a request may touch. The caller's
+// sacco and driver profile are looked up once per request and kept on it as
+// a Tenant, whose scopes limit GORM queries to the tenant's rows, so
+// handlers load "the sacco's vehicle 7" with one scoped query instead of
+// checking ownership by hand.
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/apierror"
+	"ma3_tracker/internal/middleware"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+)
+
+// ErrNoProfile is returned for sacco and driver accounts missing the sacco
+// or driver profile their role needs.
+var ErrNoProfile = errors.New("tenancy: no profile for the caller's role")
+
+// Tenant is the caller a request acts for.
+type Tenant struct {
+	UserID uint
+	Role   string
+	Sacco  *models.Sacco  // The sacco owned, for sacco accounts
+	Driver *models.Driver // The driver profile, for drivers
+}
+
+// Admin reports whether the tenant sees every sacco's data.
+func (t *Tenant) Admin() bool {
+	return t.Role == "admin"
+}
+
+// SaccoID returns the sacco the tenant owns or drives for, or 0.
+func (t *Tenant) SaccoID() uint {
+	switch {
+	case t.Sacco != nil:
+		return t.Sacco.ID
+	case t.Driver != nil:
+		return t.Driver.SaccoID
+	}
+	return 0
+}
+
+// DriverID returns the tenant's driver profile, or 0.
+func (t *Tenant) DriverID() uint {
+	if t.Driver == nil {
+		return 0
+	}
+	return t.Driver.ID
+}
+
+// SaccoScope limits a query to rows of the tenant's sacco, by the sacco_id
+// column of the query's table. Admins see every row and callers without a
+// sacco none.
+func (t *Tenant) SaccoScope(db *gorm.DB) *gorm.DB {
+	return t.scope(db, "sacco_id", t.SaccoID())
+}
+
+// DriverScope limits a query to the tenant driver's rows, by the driver_id
+// column of the query's table. Admins see every row and callers without a
+// driver profile none.
+func (t *Tenant) DriverScope(db *gorm.DB) *gorm.DB {
+	return t.scope(db, "driver_id", t.DriverID())
+}
+
+// SaccoScopeOn is SaccoScope by the named column, for queries over joins or
+// aliased tables, e.g. SaccoScopeOn("v.sacco_id").
+func (t *Tenant) SaccoScopeOn(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return t.scopeOn(db, clause.Column{Name: column, Raw: true}, t.SaccoID())
+	}
+}
+
+func (t *Tenant) scope(db *gorm.DB, column string, id uint) *gorm.DB {
+	return t.scopeOn(db, clause.Column{Table: clause.CurrentTable, Name: column}, id)
+}
+
+func (t *Tenant) scopeOn(db *gorm.DB, column clause.Column, id uint) *gorm.DB {
+	switch {
+	case t.Admin():
+		return db
+	case id == 0:
+		return db.Where("1 = 0")
+	}
+	return db.Where(clause.Eq{Column: column, Value: id})
+}
+
+// Scoped returns db limited to the tenant's sacco, for queries on tables
+// with a sacco_id column.
+func (t *Tenant) Scoped(db *gorm.DB) *gorm.DB {
+	return db.Scopes(t.SaccoScope)
+}
+
+const contextKey = "tenant"
+
+// Lookup resolves the tenant of the user with userID and role, the role of
+// their token. Guests have no user to look up. gorm.ErrRecordNotFound is
+// returned for unknown users and ErrNoProfile when a sacco or driver account
+// lacks its profile.
+func Lookup(userID uint, role string) (*Tenant, error) {
+	if role == middleware.RoleGuest {
+		return &Tenant{Role: role}, nil
+	}
+	var user models.User
+	if err := principal.Lookup(&user, userID); err != nil {
+		return nil, err
+	}
+	t := &Tenant{UserID: user.ID, Role: user.Role}
+	switch user.Role {
+	case "sacco":
+		if user.Sacco == nil {
+			return t, ErrNoProfile
+		}
+		t.Sacco = user.Sacco
+	case "driver":
+		if user.Driver == nil {
+			return t, ErrNoProfile
+		}
+		t.Driver = user.Driver
+	}
+	return t, nil
+}
+
+type result struct {
+	tenant *Tenant
+	err    error
+}
+
+// Resolve returns the request's tenant, looking the caller up the first
+// time it is asked for and reusing the answer for the rest of the request.
+// It must run after an authentication middleware.
+func Resolve(c *gin.Context) (*Tenant, error) {
+	if v, ok := c.Get(contextKey); ok {
+		r := v.(result)
+		return r.tenant, r.err
+	}
+	var userID uint
+	if id, ok := c.Get("user_id"); ok {
+		if f, ok := id.(float64); ok {
+			userID = uint(f)
+		}
+	}
+	t, err := Lookup(userID, c.GetString("role"))
+	c.Set(contextKey, result{t, err})
+	if err == nil && t.SaccoID() != 0 {
+		c.Set("sacco_id", t.SaccoID()) // For the request log
+	}
+	return t, err
+}
+
+// Middleware resolves the tenant for every request of a group, after its
+// authentication middleware. It responds 401 when the user no longer
+// exists and 403 when the caller lacks the profile their role needs, so
+// handlers behind it can rely on the tenant.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := Resolve(c); err != nil {
+			abort(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// abort ends the request with the response for an error of Resolve.
+func abort(c *gin.Context, err error) {
+	log := logrus.WithContext(c).WithField("user_id", c.Value("user_id"))
+	if errors.Is(err, ErrNoProfile) {
+		log.Warn("tenancy: User has no profile for their role.")
+		apierror.Abort(c, http.StatusForbidden, "Access denied")
+		return
+	}
+	log.WithError(err).Error("tenancy: User not found or unauthorized.")
+	apierror.Abort(c, http.StatusUnauthorized, "User not authorized")
+}
@@ -0,0 +1,152 @@
+package tenancy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/principal"
+	"ma3_tracker/internal/testdb"
+)
+
+// fleet holds two saccos with a driver and two vehicles each.
+func fleet(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Use(t, &models.User{}, &models.Sacco{}, &models.Driver{}, &models.Vehicle{})
+	principal.InvalidateAll()
+	t.Cleanup(principal.InvalidateAll)
+	for _, u := range []models.User{
+		{Model: gorm.Model{ID: 1}, Email: "a@example.com", Role: "sacco"},
+		{Model: gorm.Model{ID: 2}, Email: "b@example.com", Role: "sacco"},
+		{Model: gorm.Model{ID: 3}, Email: "d@example.com", Role: "driver"},
+		{Model: gorm.Model{ID: 4}, Email: "admin@example.com", Role: "admin"},
+		{Model: gorm.Model{ID: 5}, Email: "orphan@example.com", Role: "sacco"},
+	} {
+		mustCreate(t, db, &u)
+	}
+	mustCreate(t, db, &models.Sacco{Model: gorm.Model{ID: 1}, UserID: 1, Name: "A"})
+	mustCreate(t, db, &models.Sacco{Model: gorm.Model{ID: 2}, UserID: 2, Name: "B"})
+	mustCreate(t, db, &models.Driver{Model: gorm.Model{ID: 1}, UserID: 3, SaccoID: 2})
+	for i, sacco := range []uint{1, 1, 2, 2} {
+		mustCreate(t, db, &models.Vehicle{Model: gorm.Model{ID: uint(i + 1)}, SaccoID: sacco, DriverID: uint(i % 2)})
+	}
+	return db
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, v interface{}) {
+	t.Helper()
+	if err := db.Create(v).Error; err != nil {
+		t.Fatalf("create %T: %v", v, err)
+	}
+}
+
+func vehicleIDs(t *testing.T, q *gorm.DB) []uint {
+	t.Helper()
+	var ids []uint
+	if err := q.Model(&models.Vehicle{}).Order("id").Pluck("vehicles.id", &ids).Error; err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	return ids
+}
+
+func equal(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSaccoScope(t *testing.T) {
+	db := fleet(t)
+	cases := []struct {
+		name   string
+		tenant *Tenant
+		want   []uint
+	}{
+		{"sacco", &Tenant{Role: "sacco", Sacco: &models.Sacco{Model: gorm.Model{ID: 1}}}, []uint{1, 2}},
+		{"driver", &Tenant{Role: "driver", Driver: &models.Driver{SaccoID: 2}}, []uint{3, 4}},
+		{"admin", &Tenant{Role: "admin"}, []uint{1, 2, 3, 4}},
+		{"no sacco", &Tenant{Role: "commuter"}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := vehicleIDs(t, tc.tenant.Scoped(db)); !equal(got, tc.want) {
+				t.Errorf("Scoped: got %v, want %v", got, tc.want)
+			}
+			joined := db.Table("vehicles AS v").Joins("JOIN saccos s ON s.id = v.sacco_id").Scopes(tc.tenant.SaccoScopeOn("v.sacco_id"))
+			var ids []uint
+			if err := joined.Order("v.id").Pluck("v.id", &ids).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !equal(ids, tc.want) {
+				t.Errorf("SaccoScopeOn: got %v, want %v", ids, tc.want)
+			}
+		})
+	}
+}
+
+func TestScopeInGroupAndSubquery(t *testing.T) {
+	db := fleet(t)
+	tenant := &Tenant{Role: "sacco", Sacco: &models.Sacco{Model: gorm.Model{ID: 2}}}
+
+	// An OR inside the scoped group must not widen the query.
+	group := db.Scopes(tenant.SaccoScope).Where("driver_id = ?", 1)
+	if got := vehicleIDs(t, db.Where(group).Or("id = ?", 0)); !equal(got, []uint{4}) {
+		t.Errorf("group: got %v, want [4]", got)
+	}
+
+	owned := db.Model(&models.Vehicle{}).Select("id").Scopes(tenant.SaccoScope)
+	if got := vehicleIDs(t, db.Where("id IN (?)", owned)); !equal(got, []uint{3, 4}) {
+		t.Errorf("subquery: got %v, want [3 4]", got)
+	}
+}
+
+func TestDriverScope(t *testing.T) {
+	db := fleet(t)
+	tenant := &Tenant{Role: "driver", Driver: &models.Driver{Model: gorm.Model{ID: 1}, SaccoID: 2}}
+	if got := vehicleIDs(t, db.Scopes(tenant.DriverScope)); !equal(got, []uint{2, 4}) {
+		t.Errorf("got %v, want [2 4]", got)
+	}
+	if got := vehicleIDs(t, db.Scopes((&Tenant{Role: "sacco"}).DriverScope)); len(got) != 0 {
+		t.Errorf("tenant without a driver profile sees %v", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fleet(t)
+	gin.SetMode(gin.TestMode)
+	resolve := func(userID uint, role string) (*Tenant, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("user_id", float64(userID))
+		c.Set("role", role)
+		return Resolve(c)
+	}
+
+	tenant, err := resolve(2, "sacco")
+	if err != nil || tenant.SaccoID() != 2 {
+		t.Fatalf("sacco: got %+v, %v", tenant, err)
+	}
+	tenant, err = resolve(3, "driver")
+	if err != nil || tenant.DriverID() != 1 || tenant.SaccoID() != 2 {
+		t.Fatalf("driver: got %+v, %v", tenant, err)
+	}
+	tenant, err = resolve(4, "admin")
+	if err != nil || !tenant.Admin() {
+		t.Fatalf("admin: got %+v, %v", tenant, err)
+	}
+	if _, err := resolve(5, "sacco"); !errors.Is(err, ErrNoProfile) {
+		t.Errorf("sacco without a sacco: got %v, want ErrNoProfile", err)
+	}
+	if _, err := resolve(99, "sacco"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("unknown user: got %v, want ErrRecordNotFound", err)
+	}
+}
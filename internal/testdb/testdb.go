@@ -0,0 +1,45 @@
+// Package testdb opens throwaway databases for tests. They are in-memory
+// SQLite, so tests run without a Postgres server; queries that only
+// Postgres understands have to be tested against one.
+package testdb
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"ma3_tracker/internal/config"
+)
+
+// Open returns an empty database with tables for models. It is closed when
+// the test ends.
+func Open(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+	// Every connection to ":memory:" is a database of its own.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("testdb: migrating: %v", err)
+	}
+	return db
+}
+
+// Use is Open, also installing the database as config.DB for the test.
+func Use(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db := Open(t, models...)
+	prev := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = prev })
+	return db
+}
@@ -0,0 +1,182 @@
+package trips
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// Tolerance is how far from the route line a point may be and still count as on-route.
+	Tolerance = config.EnvFloat("ADHERENCE_TOLERANCE_METERS", 75)
+	// StageRadius is how close a trip must pass to a stage for it to count as served.
+	StageRadius = config.EnvFloat("ADHERENCE_STAGE_RADIUS_METERS", 50)
+	// minTripPoints filters out GPS blips that are not real trips.
+	minTripPoints = 10
+	// lookback bounds how much history each scoring pass reads.
+	lookback = 48 * time.Hour
+)
+
+// Score computes adherence for one trip against the route line and stages.
+func Score(points []models.LocationHistory, line []geo.Point, stages []models.Stage) models.TripAdherence {
+	score := models.TripAdherence{
+		StartedAt:  points[0].Timestamp,
+		EndedAt:    points[len(points)-1].Timestamp,
+		PointCount: len(points),
+	}
+
+	minAlong, maxAlong := -1.0, -1.0
+	offRoute := 0
+	for _, p := range points {
+		pt := geo.Point{Lat: p.Latitude, Lng: p.Longitude}
+		along, dist := geo.LocateOnLine(pt, line)
+		if dist <= Tolerance {
+			score.PointsOnRoute++
+			if minAlong < 0 || along < minAlong {
+				minAlong = along
+			}
+			if along > maxAlong {
+				maxAlong = along
+			}
+			offRoute = 0
+			continue
+		}
+		offRoute++
+		if offRoute == 2 {
+			score.Excursions++ // A single stray fix is treated as GPS noise
+		}
+		if dist > score.MaxDeviationM {
+			score.MaxDeviationM = dist
+		}
+	}
+	score.AdherencePct = float64(score.PointsOnRoute) / float64(len(points)) * 100
+
+	// Only stages inside the stretch of route actually driven are expected.
+	for _, s := range stages {
+		sp := geo.Point{Lat: s.Lat, Lng: s.Lng}
+		stageAlong, _ := geo.LocateOnLine(sp, line)
+		if minAlong < 0 || stageAlong < minAlong-StageRadius || stageAlong > maxAlong+StageRadius {
+			continue
+		}
+		served := false
+		for _, p := range points {
+			if geo.Haversine(sp, geo.Point{Lat: p.Latitude, Lng: p.Longitude}) <= StageRadius {
+				served = true
+				break
+			}
+		}
+		if served {
+			score.StagesServed++
+		} else {
+			score.StagesSkipped++
+		}
+	}
+	return score
+}
+
+// StartScoring periodically scores completed trips against the route of the
+// vehicle each driver held at the time.
+func StartScoring(interval time.Duration) {
+	background.Every(interval, func(context.Context) { scoreCompletedTrips(time.Now()) })
+}
+
+// scoreCompletedTrips scores the trips of every vehicle assignment (regular
+// or relief) overlapping the lookback. A driver's fixes are only scored
+// within the periods they held a vehicle, and against that vehicle, so a
+// driver who changed vehicles is not scored against the route of the one
+// they hold now.
+func scoreCompletedTrips(now time.Time) {
+	var assignments []models.VehicleAssignment
+	if err := config.DB.Where("driver_id <> 0 AND started_at <= ? AND (ended_at IS NULL OR ended_at > ?)", now, now.Add(-lookback)).
+		Order("driver_id, started_at").Find(&assignments).Error; err != nil {
+		logrus.WithError(err).Error("trips: Failed to load vehicle assignments for adherence scoring.")
+		return
+	}
+	vehicles := make(map[uint]*models.Vehicle)
+	scored := 0
+	for _, a := range assignments {
+		v, ok := vehicles[a.VehicleID]
+		if !ok {
+			var found []models.Vehicle
+			if err := config.DB.Where("id = ?", a.VehicleID).Limit(1).Find(&found).Error; err != nil {
+				logrus.WithError(err).WithField("vehicle_id", a.VehicleID).Warn("trips: Failed to load vehicle for adherence scoring.")
+				continue
+			}
+			if len(found) > 0 {
+				v = &found[0]
+			}
+			vehicles[a.VehicleID] = v
+		}
+		if v == nil || v.RouteID == 0 {
+			continue
+		}
+		n, err := scoreAssignment(a, v.RouteID, now)
+		if err != nil {
+			logrus.WithError(err).WithField("assignment_id", a.ID).Warn("trips: Failed to score assignment trips.")
+			continue
+		}
+		scored += n
+	}
+	if scored > 0 {
+		logrus.Infof("trips: Scored route adherence for %d completed trips.", scored)
+	}
+}
+
+// scoreAssignment scores the completed trips the assignment's driver made
+// while they held its vehicle, against routeID.
+func scoreAssignment(a models.VehicleAssignment, routeID uint, now time.Time) (int, error) {
+	since, until := now.Add(-lookback), now
+	if a.StartedAt.After(since) {
+		since = a.StartedAt
+	}
+	if a.EndedAt != nil && a.EndedAt.Before(until) {
+		until = *a.EndedAt
+	}
+	var last models.TripAdherence
+	if err := config.DB.Where("driver_id = ? AND vehicle_id = ? AND started_at >= ? AND ended_at <= ?", a.DriverID, a.VehicleID, since, until).
+		Order("ended_at DESC").Limit(1).Find(&last).Error; err != nil {
+		return 0, err
+	}
+	if last.ID != 0 {
+		since = last.EndedAt
+	}
+
+	var points []models.LocationHistory
+	if err := config.DB.Where("driver_id = ? AND timestamp > ? AND timestamp <= ?", a.DriverID, since, until).Order("timestamp").Find(&points).Error; err != nil {
+		return 0, err
+	}
+	segments := Segment(points, Gap, minTripPoints)
+	if len(segments) == 0 {
+		return 0, nil
+	}
+
+	var route models.Route
+	if err := config.DB.Preload("Stages").First(&route, routeID).Error; err != nil {
+		return 0, err
+	}
+	line, err := geo.LineFromWKB(route.Geometry)
+	if err != nil {
+		return 0, nil // Routes without geometry can't be scored
+	}
+
+	n := 0
+	for _, seg := range segments {
+		if a.EndedAt == nil && now.Sub(seg[len(seg)-1].Timestamp) <= Gap {
+			continue // Trip may still be in progress
+		}
+		score := Score(seg, line, route.Stages)
+		score.VehicleID, score.DriverID, score.RouteID, score.SaccoID = a.VehicleID, a.DriverID, route.ID, a.SaccoID
+		if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&score).Error; err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
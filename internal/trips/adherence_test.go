@@ -0,0 +1,71 @@
+package trips
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/testdb"
+)
+
+// A driver who moved to another vehicle is scored against the route of the
+// vehicle they held at each fix, not the one they hold now.
+func TestScoreCompletedTripsByAssignment(t *testing.T) {
+	db := testdb.Use(t, &models.Vehicle{}, &models.Route{}, &models.Stage{}, &models.VehicleAssignment{}, &models.LocationHistory{}, &models.TripAdherence{})
+	west := []geo.Point{{Lat: -1.28, Lng: 36.80}, {Lat: -1.28, Lng: 36.82}}
+	east := []geo.Point{{Lat: -1.28, Lng: 36.90}, {Lat: -1.28, Lng: 36.92}}
+	westWKB, _ := geo.LineToWKB(west)
+	eastWKB, _ := geo.LineToWKB(east)
+	now := time.Now()
+	switched := now.Add(-3 * time.Hour)
+	rows := []interface{}{
+		&models.Route{Model: gorm.Model{ID: 1}, SaccoID: 1, Name: "West", Geometry: westWKB},
+		&models.Route{Model: gorm.Model{ID: 2}, SaccoID: 1, Name: "East", Geometry: eastWKB},
+		&models.Vehicle{Model: gorm.Model{ID: 1}, SaccoID: 1, RouteID: 1, VehicleNo: "KAA 001A"},
+		&models.Vehicle{Model: gorm.Model{ID: 2}, SaccoID: 1, RouteID: 2, DriverID: 7, VehicleNo: "KAA 002A"},
+		&models.VehicleAssignment{VehicleID: 1, SaccoID: 1, DriverID: 7, StartedAt: now.Add(-6 * time.Hour), EndedAt: &switched},
+		&models.VehicleAssignment{VehicleID: 2, SaccoID: 1, DriverID: 7, StartedAt: switched},
+	}
+	// A trip on the west route before the switch and one on the east route
+	// after it.
+	for trip, line := range [][]geo.Point{west, east} {
+		start := switched.Add(time.Duration(2*trip-1) * time.Hour)
+		for i := 0; i < 12; i++ {
+			f := float64(i) / 11
+			rows = append(rows, &models.LocationHistory{
+				DriverID:  7,
+				Latitude:  line[0].Lat,
+				Longitude: line[0].Lng + f*(line[1].Lng-line[0].Lng),
+				Timestamp: start.Add(time.Duration(i) * time.Minute),
+			})
+		}
+	}
+	for _, r := range rows {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("create %T: %v", r, err)
+		}
+	}
+
+	scoreCompletedTrips(now)
+	var scores []models.TripAdherence
+	db.Order("started_at").Find(&scores)
+	if len(scores) != 2 {
+		t.Fatalf("%d trips scored; want 2", len(scores))
+	}
+	for i, want := range []uint{1, 2} {
+		if scores[i].VehicleID != want || scores[i].RouteID != want || scores[i].AdherencePct != 100 {
+			t.Errorf("trip %d: vehicle %d, route %d, %.0f%% on route; want vehicle and route %d, 100%%",
+				i+1, scores[i].VehicleID, scores[i].RouteID, scores[i].AdherencePct, want)
+		}
+	}
+
+	scoreCompletedTrips(now) // A second pass adds nothing
+	var n int64
+	db.Model(&models.TripAdherence{}).Count(&n)
+	if n != 2 {
+		t.Errorf("%d scores after a second pass; want 2", n)
+	}
+}
@@ -0,0 +1,192 @@
+package trips
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+	"ma3_tracker/internal/webhooks"
+)
+
+// IdleTimeout closes a trip whose vehicle has not reported for this long.
+var IdleTimeout = config.EnvDuration("TRIP_IDLE_TIMEOUT", 30*time.Minute)
+
+var (
+	// ErrTripActive is returned when starting a trip while one is in progress.
+	ErrTripActive = errors.New("a trip is already in progress")
+	// ErrNoVehicle is returned when the driver has no vehicle to drive.
+	ErrNoVehicle = errors.New("driver has no assigned vehicle")
+	// ErrNoRoute is returned when no route was given and the vehicle has none.
+	ErrNoRoute = errors.New("no route given and the vehicle has no assigned route")
+	// ErrRouteNotServed is returned for a route of another sacco.
+	ErrRouteNotServed = errors.New("route does not belong to the vehicle's sacco")
+	// ErrTripEnded is returned when ending a trip that is already over.
+	ErrTripEnded = errors.New("trip has already ended")
+)
+
+// Start begins a trip for the driver in their current vehicle on routeID, or
+// on the vehicle's route when routeID is 0. The vehicle row is locked so two
+// trips cannot start at once. The sacco's trip_started webhooks are queued
+// with the trip.
+func Start(db *gorm.DB, driverID, routeID uint, now time.Time) (*models.Trip, error) {
+	var trip models.Trip
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var vehicle models.Vehicle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("driver_id = ?", driverID).Limit(1).Find(&vehicle).Error; err != nil {
+			return err
+		}
+		if vehicle.ID == 0 {
+			return ErrNoVehicle
+		}
+		if routeID == 0 {
+			routeID = vehicle.RouteID
+		}
+		if routeID == 0 {
+			return ErrNoRoute
+		}
+		var served int64
+		if err := tx.Model(&models.Route{}).Where("id = ? AND sacco_id = ?", routeID, vehicle.SaccoID).Count(&served).Error; err != nil {
+			return err
+		}
+		if served == 0 {
+			return ErrRouteNotServed
+		}
+
+		current, err := active(tx, "vehicle_id = ? OR driver_id = ?", vehicle.ID, driverID)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			if now.Sub(current.LastSeenAt) <= IdleTimeout {
+				return ErrTripActive
+			}
+			if err := end(tx, current, models.TripEndInactivity, current.LastSeenAt); err != nil {
+				return err
+			}
+		}
+
+		trip = models.Trip{
+			DriverID:   driverID,
+			VehicleID:  vehicle.ID,
+			SaccoID:    vehicle.SaccoID,
+			RouteID:    routeID,
+			StartedAt:  now,
+			LastSeenAt: now,
+		}
+		if err := tx.Create(&trip).Error; err != nil {
+			return err
+		}
+		return webhooks.Publish(tx, trip.SaccoID, models.WebhookTripStarted, trip)
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs.Wake(db)
+	return &trip, nil
+}
+
+// End closes the trip at now.
+func End(db *gorm.DB, tripID uint, reason string, now time.Time) (*models.Trip, error) {
+	var trip models.Trip
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&trip, tripID).Error; err != nil {
+			return err
+		}
+		if !trip.Active() {
+			return ErrTripEnded
+		}
+		return end(tx, &trip, reason, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+func end(tx *gorm.DB, trip *models.Trip, reason string, at time.Time) error {
+	trip.EndedAt, trip.EndReason = &at, reason
+	return tx.Model(trip).Updates(map[string]interface{}{"ended_at": at, "end_reason": reason}).Error
+}
+
+// ForDriver returns the driver's trip in progress, or nil.
+func ForDriver(db *gorm.DB, driverID uint) (*models.Trip, error) {
+	return active(db, "driver_id = ?", driverID)
+}
+
+func active(db *gorm.DB, where string, args ...interface{}) (*models.Trip, error) {
+	var trip models.Trip
+	err := db.Where("ended_at IS NULL").Where(where, args...).Order("started_at DESC").Limit(1).Find(&trip).Error
+	if err != nil || trip.ID == 0 {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+// Current returns the ID of the trip a new point belongs to: the active trip
+// of the vehicle or, for points without a vehicle, of the driver. It is 0
+// when there is none or the trip has been idle for IdleTimeout, in which
+// case the trip is closed here rather than waiting for the sweep.
+func Current(db *gorm.DB, driverID, vehicleID uint, at time.Time) (uint, error) {
+	var trip *models.Trip
+	var err error
+	if vehicleID != 0 {
+		trip, err = active(db, "vehicle_id = ?", vehicleID)
+	} else if driverID != 0 {
+		trip, err = ForDriver(db, driverID)
+	}
+	if err != nil || trip == nil {
+		return 0, err
+	}
+	if at.Sub(trip.LastSeenAt) > IdleTimeout {
+		if _, err := End(db, trip.ID, models.TripEndInactivity, trip.LastSeenAt); err != nil && !errors.Is(err, ErrTripEnded) {
+			return 0, err
+		}
+		return 0, nil
+	}
+	return trip.ID, nil
+}
+
+// Record adds saved points to their trip's running totals.
+func Record(db *gorm.DB, tripID uint, points []models.LocationHistory) error {
+	if tripID == 0 || len(points) == 0 {
+		return nil
+	}
+	distance, last := 0.0, points[0].Timestamp
+	for _, p := range points {
+		distance += p.DistanceFromLast
+		if p.Timestamp.After(last) {
+			last = p.Timestamp
+		}
+	}
+	return db.Model(&models.Trip{}).Where("id = ?", tripID).Updates(map[string]interface{}{
+		"point_count":  gorm.Expr("point_count + ?", len(points)),
+		"distance_m":   gorm.Expr("distance_m + ?", distance),
+		"last_seen_at": gorm.Expr("GREATEST(last_seen_at, ?)", last),
+	}).Error
+}
+
+// StartIdleClosure periodically ends trips whose vehicle stopped reporting
+// IdleTimeout ago. They are dated to their last point.
+func StartIdleClosure(interval time.Duration) {
+	background.Every(interval, func(context.Context) { closeIdle(time.Now()) })
+}
+
+func closeIdle(now time.Time) {
+	res := config.DB.Model(&models.Trip{}).Where("ended_at IS NULL AND last_seen_at < ?", now.Add(-IdleTimeout)).
+		Updates(map[string]interface{}{"ended_at": gorm.Expr("last_seen_at"), "end_reason": models.TripEndInactivity})
+	if res.Error != nil {
+		logrus.WithError(res.Error).Error("trips: Failed to close idle trips.")
+		return
+	}
+	if res.RowsAffected > 0 {
+		logrus.Infof("trips: Closed %d trips after %s without location updates.", res.RowsAffected, IdleTimeout)
+	}
+}
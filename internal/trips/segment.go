@@ -0,0 +1,29 @@
+// Package trips splits a driver's location history into trips and scores how
+// closely each trip followed its assigned route.
+package trips
+
+import (
+	"time"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/models"
+)
+
+// Gap is the pause in location updates that ends one trip and starts the next.
+var Gap = config.EnvDuration("TRIP_GAP", 15*time.Minute)
+
+// Segment splits time-ordered points into trips wherever consecutive points
+// are more than gap apart. Trips with fewer than minPoints points are dropped.
+func Segment(points []models.LocationHistory, gap time.Duration, minPoints int) [][]models.LocationHistory {
+	var out [][]models.LocationHistory
+	start := 0
+	for i := 1; i <= len(points); i++ {
+		if i == len(points) || points[i].Timestamp.Sub(points[i-1].Timestamp) > gap {
+			if i-start >= minPoints {
+				out = append(out, points[start:i])
+			}
+			start = i
+		}
+	}
+	return out
+}
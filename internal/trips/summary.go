@@ -0,0 +1,194 @@
+package trips
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+
+	"ma3_tracker/internal/background"
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/geo"
+	"ma3_tracker/internal/models"
+)
+
+var (
+	// StopDwell is how long a vehicle must stand still for its trip to end.
+	// Shorter stops, e.g. to pick up passengers, are counted within the trip.
+	StopDwell = config.EnvDuration("TRIP_SUMMARY_STOP_DWELL", 5*time.Minute)
+	// MinStop is the shortest standstill counted as a stop.
+	MinStop = config.EnvDuration("TRIP_SUMMARY_MIN_STOP", 30*time.Second)
+	// MinDistance drops detected trips shorter than this (meters), e.g. a
+	// vehicle being moved around a stage.
+	MinDistance = config.EnvFloat("TRIP_SUMMARY_MIN_DISTANCE_METERS", 500)
+)
+
+// Summarize splits a vehicle's time-ordered points into trips using their
+// moving/stopped state. A trip runs from a moving point to the last moving
+// point before the vehicle stands still for StopDwell or stops reporting for
+// gap. Trips still in progress at now are left out. The summaries carry the
+// points' measures only; the caller fills in the vehicle, sacco and route.
+func Summarize(points []models.LocationHistory, gap time.Duration, now time.Time) []models.TripSummary {
+	var out []models.TripSummary
+	start, lastMoving := -1, -1
+	var stoppedSince time.Time
+	stops := 0
+	stopped := time.Duration(0)
+	closeTrip := func() {
+		if start >= 0 && lastMoving > start {
+			if s := summarize(points[start : lastMoving+1]); s.DistanceM >= MinDistance {
+				s.StopCount = stops
+				s.MovingS = s.DurationS - stopped.Seconds()
+				out = append(out, s)
+			}
+		}
+		start, lastMoving, stops, stopped = -1, -1, 0, 0
+		stoppedSince = time.Time{}
+	}
+	for i, p := range points {
+		if start >= 0 && p.Timestamp.Sub(points[i-1].Timestamp) > gap {
+			closeTrip()
+		}
+		if p.IsMoving {
+			if start < 0 {
+				start = i
+			}
+			if !stoppedSince.IsZero() {
+				if d := p.Timestamp.Sub(stoppedSince); d >= MinStop {
+					stops++
+					stopped += d
+				}
+				stoppedSince = time.Time{}
+			}
+			lastMoving = i
+			continue
+		}
+		if start < 0 {
+			continue
+		}
+		if stoppedSince.IsZero() {
+			stoppedSince = p.Timestamp
+		} else if p.Timestamp.Sub(stoppedSince) >= StopDwell {
+			closeTrip()
+		}
+	}
+	if start >= 0 && now.Sub(points[len(points)-1].Timestamp) > gap {
+		closeTrip()
+	}
+	return out
+}
+
+// summarize measures one trip's points.
+func summarize(points []models.LocationHistory) models.TripSummary {
+	first, last := points[0], points[len(points)-1]
+	s := models.TripSummary{
+		Source:         first.Source,
+		StartedAt:      first.Timestamp,
+		EndedAt:        last.Timestamp,
+		PointCount:     len(points),
+		DurationS:      last.Timestamp.Sub(first.Timestamp).Seconds(),
+		StartLatitude:  first.Latitude,
+		StartLongitude: first.Longitude,
+		EndLatitude:    last.Latitude,
+		EndLongitude:   last.Longitude,
+	}
+	drivers, tripIDs := map[uint]int{}, map[uint]int{}
+	for i, p := range points {
+		if i > 0 {
+			s.DistanceM += geo.Haversine(geo.Point{Lat: points[i-1].Latitude, Lng: points[i-1].Longitude}, geo.Point{Lat: p.Latitude, Lng: p.Longitude})
+		}
+		if p.Speed > s.MaxSpeed {
+			s.MaxSpeed = p.Speed
+		}
+		if p.DriverID != 0 {
+			drivers[p.DriverID]++
+		}
+		if p.TripID != 0 {
+			tripIDs[p.TripID]++
+		}
+	}
+	if s.DurationS > 0 {
+		s.AvgSpeed = s.DistanceM / s.DurationS
+	}
+	s.DriverID, s.TripID = mostCommon(drivers), mostCommon(tripIDs)
+	return s
+}
+
+func mostCommon(counts map[uint]int) uint {
+	var best uint
+	for id, n := range counts {
+		if n > counts[best] || (n == counts[best] && id < best) {
+			best = id
+		}
+	}
+	return best
+}
+
+// StartSummaries periodically detects and stores the trips completed in
+// every vehicle's recent location history.
+func StartSummaries(interval time.Duration) {
+	background.Every(interval, func(context.Context) { summarizeRecent(time.Now()) })
+}
+
+func summarizeRecent(now time.Time) {
+	var vehicleIDs []uint
+	if err := config.DB.Model(&models.LocationHistory{}).Where("vehicle_id <> 0 AND timestamp > ?", now.Add(-lookback)).
+		Distinct().Pluck("vehicle_id", &vehicleIDs).Error; err != nil {
+		logrus.WithError(err).Error("trips: Failed to load vehicles for trip summaries.")
+		return
+	}
+	stored := 0
+	for _, id := range vehicleIDs {
+		n, err := summarizeVehicle(id, now)
+		if err != nil {
+			logrus.WithError(err).WithField("vehicle_id", id).Warn("trips: Failed to summarize vehicle trips.")
+			continue
+		}
+		stored += n
+	}
+	if stored > 0 {
+		logrus.Infof("trips: Stored %d detected trip summaries.", stored)
+	}
+}
+
+// summarizeVehicle stores the vehicle's trips completed since its last
+// summary. Its tracker's points are used when it has any in that window, as
+// they do not depend on the driver's phone; the two sources are never mixed.
+func summarizeVehicle(vehicleID uint, now time.Time) (int, error) {
+	since := now.Add(-lookback)
+	var last models.TripSummary
+	if err := config.DB.Where("vehicle_id = ?", vehicleID).Order("ended_at DESC").Limit(1).Find(&last).Error; err != nil {
+		return 0, err
+	}
+	if last.ID != 0 && last.EndedAt.After(since) {
+		since = last.EndedAt
+	}
+	var vehicle models.Vehicle
+	if err := config.DB.Unscoped().Select("id", "sacco_id", "route_id").First(&vehicle, vehicleID).Error; err != nil {
+		return 0, err
+	}
+
+	var trackerPoints int64
+	if err := config.DB.Model(&models.LocationHistory{}).Where("vehicle_id = ? AND source = ? AND timestamp > ?", vehicleID, models.LocationSourceTracker, since).
+		Count(&trackerPoints).Error; err != nil {
+		return 0, err
+	}
+	source := models.LocationSourceDriver
+	if trackerPoints > 0 {
+		source = models.LocationSourceTracker
+	}
+	var points []models.LocationHistory
+	if err := config.DB.Where("vehicle_id = ? AND source = ? AND timestamp > ?", vehicleID, source, since).Order("timestamp").Find(&points).Error; err != nil {
+		return 0, err
+	}
+	summaries := Summarize(points, Gap, now)
+	if len(summaries) == 0 {
+		return 0, nil
+	}
+	for i := range summaries {
+		summaries[i].VehicleID, summaries[i].SaccoID, summaries[i].RouteID = vehicle.ID, vehicle.SaccoID, vehicle.RouteID
+	}
+	res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&summaries)
+	return int(res.RowsAffected), res.Error
+}
@@ -0,0 +1,371 @@
+// Package webhooks calls saccos' own systems back when platform events
+// happen. Publish records a delivery for each of the sacco's webhooks
+// subscribed to the event and queues it on the job queue, which retries
+// failed deliveries with backoff.
+//
+// Each delivery is a POST of the JSON envelope
+//
+//	{"id": "...", "type": "sos", "created_at": "...", "sacco_id": 3, "data": {...}}
+//
+// with headers X-Ma3-Event, X-Ma3-Delivery (the delivery ID),
+// X-Ma3-Timestamp (Unix seconds) and X-Ma3-Signature, "sha256=" followed by
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook's
+// secret. Receivers should check the signature and reject old timestamps;
+// the envelope's id is the same for every retry, for deduplication. Any 2xx
+// response counts as delivered; 410 Gone turns the webhook off.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"ma3_tracker/internal/config"
+	"ma3_tracker/internal/jobs"
+	"ma3_tracker/internal/models"
+)
+
+// Events lists the events webhooks can subscribe to.
+var Events = []string{models.WebhookTripStarted, models.WebhookSOS, models.WebhookDocumentExpired, models.WebhookRoutePublished}
+
+// ValidEvent reports whether event can be subscribed to.
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// Timeout bounds one delivery attempt.
+	Timeout = config.EnvDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	// AllowHTTP accepts plain http:// URLs, for local development.
+	AllowHTTP = config.EnvBool("WEBHOOK_ALLOW_HTTP", false)
+	// AllowPrivate lets deliveries reach loopback and private network
+	// addresses, which are refused by default so a webhook cannot be used to
+	// probe the platform's own network.
+	AllowPrivate = config.EnvBool("WEBHOOK_ALLOW_PRIVATE", false)
+)
+
+// JobKind is the kind of the background jobs that send deliveries.
+const JobKind = "webhook_delivery"
+
+// jobAttempts is how many times a delivery is tried. With the job queue's
+// default backoff the last try is about an hour after the first.
+var jobAttempts = config.EnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+
+var deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_deliveries_total",
+	Help: "Webhook delivery attempts, by event and outcome.",
+}, []string{"event", "outcome"})
+
+func init() {
+	jobs.Register(JobKind, jobAttempts, runJob)
+}
+
+var (
+	errPrivateAddress = errors.New("webhook address is on a private network")
+	errWebhookGone    = errors.New("webhook was deleted")
+	errInactive       = errors.New("webhook is inactive")
+)
+
+// client sends deliveries. It does not follow redirects, which count as
+// failures, and dials only public addresses unless AllowPrivate is set.
+var client = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: checkDial}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// checkDial refuses connections to non-public addresses. It runs after name
+// resolution, so a public host name pointing at a private address is
+// refused too.
+func checkDial(_, address string, _ syscall.RawConn) error {
+	if AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !public(addr) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// ValidateURL checks that raw is an absolute https URL (or http with
+// AllowHTTP) that deliveries may be sent to.
+func ValidateURL(raw string) error {
+	if len(raw) > 2000 {
+		return errors.New("url is too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("url must be an absolute URL")
+	}
+	if u.Scheme != "https" && !(AllowHTTP && u.Scheme == "http") {
+		return errors.New("url must use https")
+	}
+	if u.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !AllowPrivate && !public(addr) {
+		return errPrivateAddress
+	}
+	if !AllowPrivate && strings.EqualFold(u.Hostname(), "localhost") {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// NewSecret returns a random signing secret for a webhook.
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Ma3-Signature value of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// envelope is the body of a delivery.
+type envelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	SaccoID   uint        `json:"sacco_id"`
+	Data      interface{} `json:"data"`
+}
+
+// Publish queues a delivery of event, with data as its payload, to each of
+// the sacco's active webhooks subscribed to it. It uses db, so when called
+// inside a transaction the deliveries only go out if it commits.
+func Publish(db *gorm.DB, saccoID uint, event string, data interface{}) error {
+	if saccoID == 0 {
+		return nil
+	}
+	var hooks []models.Webhook
+	if err := db.Where("sacco_id = ? AND active", saccoID).Find(&hooks).Error; err != nil {
+		return err
+	}
+	subscribed := hooks[:0]
+	for _, h := range hooks {
+		if h.Subscribes(event) {
+			subscribed = append(subscribed, h)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+	_, err := queue(db, subscribed, event, data)
+	return err
+}
+
+// Ping queues a ping event to hook, whatever it subscribes to, so a sacco
+// can check their endpoint.
+func Ping(db *gorm.DB, hook models.Webhook) (models.WebhookDelivery, error) {
+	queued, err := queue(db, []models.Webhook{hook}, models.WebhookPing, map[string]interface{}{"webhook_id": hook.ID})
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return queued[0], nil
+}
+
+func queue(db *gorm.DB, hooks []models.Webhook, event string, data interface{}) ([]models.WebhookDelivery, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	eventID := hex.EncodeToString(b)
+	body, err := json.Marshal(envelope{ID: eventID, Type: event, CreatedAt: time.Now().UTC(), SaccoID: hooks[0].SaccoID, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: encoding %s payload: %w", event, err)
+	}
+	out := make([]models.WebhookDelivery, 0, len(hooks))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, h := range hooks {
+			d := models.WebhookDelivery{
+				WebhookID: h.ID,
+				SaccoID:   h.SaccoID,
+				Event:     event,
+				EventID:   eventID,
+				Payload:   body,
+				Status:    models.DeliveryPending,
+			}
+			if err := tx.Create(&d).Error; err != nil {
+				return err
+			}
+			job, err := jobs.Enqueue(tx, JobKind, jobPayload{DeliveryID: d.ID}, jobs.Options{SaccoID: h.SaccoID})
+			if err != nil {
+				return err
+			}
+			d.JobID = job.ID
+			if err := tx.Model(&d).Update("job_id", job.ID).Error; err != nil {
+				return err
+			}
+			out = append(out, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs.Wake(db)
+	return out, nil
+}
+
+type jobPayload struct {
+	DeliveryID uint `json:"delivery_id"`
+}
+
+// runJob makes one attempt at the delivery named by a job, recording the
+// outcome on it.
+func runJob(ctx context.Context, job *models.Job) error {
+	var payload jobPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return jobs.Permanent(err)
+	}
+	var d models.WebhookDelivery
+	if err := config.DB.First(&d, payload.DeliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if d.Status != models.DeliveryPending {
+		return nil // Finished by an earlier attempt whose worker died
+	}
+	var hook models.Webhook
+	if err := config.DB.Limit(1).Find(&hook, d.WebhookID).Error; err != nil {
+		return err
+	}
+	var code int
+	var err error
+	switch {
+	case hook.ID == 0:
+		err = jobs.Permanent(errWebhookGone)
+	case !hook.Active:
+		err = jobs.Permanent(errInactive)
+	default:
+		code, err = send(ctx, hook, d)
+	}
+	if err != nil && ctx.Err() != nil {
+		return err // Shutting down; the job is queued again
+	}
+	record(job, hook, &d, code, err)
+	return err
+}
+
+// send POSTs the delivery to the webhook, returning the response's status
+// code.
+func send(ctx context.Context, hook models.Webhook, d models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, jobs.Permanent(err)
+	}
+	now := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ma3tracker-webhooks/1")
+	req.Header.Set("X-Ma3-Event", d.Event)
+	req.Header.Set("X-Ma3-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-Ma3-Timestamp", strconv.FormatInt(now, 10))
+	req.Header.Set("X-Ma3-Signature", Sign(hook.Secret, now, d.Payload))
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, errPrivateAddress) {
+			return 0, jobs.Permanent(errPrivateAddress)
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Let the connection be reused
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusGone:
+		if err := config.DB.Model(&hook).Update("active", false).Error; err != nil {
+			logrus.WithError(err).WithField("webhook_id", hook.ID).Error("webhooks: Failed to turn off gone webhook.")
+		}
+		logrus.WithFields(logrus.Fields{"webhook_id": hook.ID, "sacco_id": hook.SaccoID}).Warn("webhooks: Endpoint answered 410 Gone; webhook turned off.")
+		return resp.StatusCode, jobs.Permanent(errors.New("endpoint answered 410 Gone; webhook turned off"))
+	default:
+		msg := fmt.Sprintf("endpoint answered %d", resp.StatusCode)
+		if s := strings.TrimSpace(string(snippet)); s != "" {
+			msg += ": " + s
+		}
+		return resp.StatusCode, errors.New(msg)
+	}
+}
+
+// record stores the outcome of an attempt on the delivery and, once it is
+// final, on the webhook.
+func record(job *models.Job, hook models.Webhook, d *models.WebhookDelivery, code int, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": job.Attempts, "response_code": code, "last_error": ""}
+	outcome := "retry"
+	switch {
+	case err == nil:
+		outcome = models.DeliveryDelivered
+		updates["status"], updates["delivered_at"] = models.DeliveryDelivered, now
+	case jobs.LastAttempt(job) || jobs.IsPermanent(err):
+		outcome = models.DeliveryFailed
+		updates["status"] = models.DeliveryFailed
+	}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	}
+	deliveries.WithLabelValues(d.Event, outcome).Inc()
+	log := logrus.WithFields(logrus.Fields{"delivery_id": d.ID, "webhook_id": d.WebhookID, "event": d.Event, "attempt": job.Attempts, "response_code": code})
+	if err != nil {
+		log.WithError(err).Warn("webhooks: Delivery attempt failed.")
+	}
+	if dbErr := config.DB.Model(d).Updates(updates).Error; dbErr != nil {
+		log.WithError(dbErr).Error("webhooks: Failed to record delivery attempt.")
+	}
+	if outcome != "retry" && hook.ID != 0 {
+		config.DB.Model(&hook).Updates(map[string]interface{}{"last_delivery_at": now, "last_status": outcome})
+	}
+}
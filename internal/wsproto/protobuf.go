@@ -0,0 +1,232 @@
+package wsproto
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"ma3_tracker/internal/wsproto/wsv1"
+)
+
+// MarshalProto encodes the envelope as the Envelope message of
+// proto/ws/v1/messages.proto. Display blocks are not encoded.
+func (e Envelope) MarshalProto() ([]byte, error) {
+	msg, err := e.toProto()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// toProto converts the envelope to its generated protobuf message.
+func (e Envelope) toProto() (*wsv1.Envelope, error) {
+	env := &wsv1.Envelope{Version: uint32(e.Version)}
+	switch p := e.Payload.(type) {
+	case *Location:
+		env.Payload = &wsv1.Envelope_Location{Location: p.toProto()}
+	case *Snapshot:
+		env.Payload = &wsv1.Envelope_Snapshot{Snapshot: p.toProto()}
+	case *Occupancy:
+		env.Payload = &wsv1.Envelope_Occupancy{Occupancy: p.toProto()}
+	case *Alert:
+		env.Payload = &wsv1.Envelope_Alert{Alert: p.toProto()}
+	case *StageEvent:
+		if e.Type == TypeDeparture {
+			env.Payload = &wsv1.Envelope_StageDeparture{StageDeparture: p.toProto()}
+		} else {
+			env.Payload = &wsv1.Envelope_StageArrival{StageArrival: p.toProto()}
+		}
+	case *WatchAlert:
+		env.Payload = &wsv1.Envelope_WatchAlert{WatchAlert: p.toProto()}
+	case *SOS:
+		env.Payload = &wsv1.Envelope_Sos{Sos: p.toProto()}
+	case *Coaching:
+		env.Payload = &wsv1.Envelope_Coaching{Coaching: &wsv1.Coaching{EventJson: p.Event, Message: p.Message}}
+	case *DriverMessage:
+		env.Payload = &wsv1.Envelope_Message{Message: &wsv1.DriverMessage{MessageId: uint64(p.MessageID), Title: p.Title, Body: p.Body}}
+	case *Ack:
+		env.Payload = &wsv1.Envelope_Ack{Ack: p.toProto()}
+	case *Error:
+		env.Payload = &wsv1.Envelope_Error{Error: &wsv1.Error{Error: p.Error}}
+	default:
+		return nil, fmt.Errorf("wsproto: no protobuf encoding for %T", e.Payload)
+	}
+	return env, nil
+}
+
+func (l *Location) toProto() *wsv1.Location {
+	m := &wsv1.Location{
+		SaccoId:         uint64(l.SaccoID),
+		VehicleId:       uint64(l.VehicleID),
+		VehicleNo:       l.VehicleNo,
+		RouteId:         uint64(l.RouteID),
+		DriverId:        uint64(l.DriverID),
+		Latitude:        l.Latitude,
+		Longitude:       l.Longitude,
+		Accuracy:        l.Accuracy,
+		Speed:           l.Speed,
+		Bearing:         l.Bearing,
+		Altitude:        l.Altitude,
+		TimestampMs:     unixMilli(l.Timestamp),
+		EventType:       l.EventType,
+		IsMoving:        l.IsMoving,
+		Source:          l.Source,
+		SequenceId:      uint64(l.SequenceID),
+		Capacity:        int32(l.Capacity),
+		OccupancyStatus: l.OccupancyStatus,
+		Occupancy:       int32Ptr(l.Occupancy),
+		Unassigned:      l.Unassigned,
+		AgeSeconds:      l.AgeSeconds,
+		Stale:           l.Stale,
+		TripId:          uint64(l.TripID),
+		Matched:         l.Matched,
+		RawLatitude:     l.RawLatitude,
+		RawLongitude:    l.RawLongitude,
+	}
+	for i := range l.ETAs {
+		e := &l.ETAs[i]
+		m.Etas = append(m.Etas, &wsv1.StageETA{
+			StageId:     uint64(e.StageID),
+			Name:        e.Name,
+			Seq:         int32(e.Seq),
+			DistanceM:   e.DistanceM,
+			EtaSeconds:  e.Seconds,
+			ArrivalAtMs: unixMilli(e.ArrivalAt),
+		})
+	}
+	return m
+}
+
+func (s *Snapshot) toProto() *wsv1.Snapshot {
+	m := &wsv1.Snapshot{StaleAfterSeconds: s.StaleAfterSeconds, TimestampMs: unixMilli(s.Timestamp)}
+	for i := range s.Vehicles {
+		m.Vehicles = append(m.Vehicles, s.Vehicles[i].toProto())
+	}
+	return m
+}
+
+func (o *Occupancy) toProto() *wsv1.Occupancy {
+	return &wsv1.Occupancy{
+		SaccoId:         uint64(o.SaccoID),
+		VehicleId:       uint64(o.VehicleID),
+		DriverId:        uint64(o.DriverID),
+		Capacity:        int32(o.Capacity),
+		OccupancyStatus: o.OccupancyStatus,
+		Occupancy:       int32Ptr(o.Occupancy),
+		TimestampMs:     unixMilli(o.Timestamp),
+	}
+}
+
+func (a *Alert) toProto() *wsv1.Alert {
+	return &wsv1.Alert{
+		Kind:        a.Kind,
+		State:       a.State,
+		SaccoId:     uint64(a.SaccoID),
+		ViolationId: uint64(a.ViolationID),
+		VehicleId:   uint64(a.VehicleID),
+		DriverId:    uint64(a.DriverID),
+		Speed:       a.Speed,
+		Limit:       a.Limit,
+		Latitude:    a.Latitude,
+		Longitude:   a.Longitude,
+		StartedAtMs: unixMilli(a.StartedAt),
+		TimestampMs: unixMilli(a.Timestamp),
+		DeviationId: uint64(a.DeviationID),
+		RouteId:     uint64(a.RouteID),
+		DistanceM:   a.DistanceM,
+	}
+}
+
+func (s *StageEvent) toProto() *wsv1.StageEvent {
+	return &wsv1.StageEvent{
+		SaccoId:      uint64(s.SaccoID),
+		EventId:      uint64(s.EventID),
+		VehicleId:    uint64(s.VehicleID),
+		DriverId:     uint64(s.DriverID),
+		RouteId:      uint64(s.RouteID),
+		StageId:      uint64(s.StageID),
+		StageName:    s.StageName,
+		StageSeq:     int32(s.StageSeq),
+		Latitude:     s.Latitude,
+		Longitude:    s.Longitude,
+		Distance:     s.Distance,
+		DwellSeconds: s.DwellSeconds,
+		TimestampMs:  unixMilli(s.Timestamp),
+	}
+}
+
+func (w *WatchAlert) toProto() *wsv1.WatchAlert {
+	return &wsv1.WatchAlert{
+		WatchId:     uint64(w.WatchID),
+		VehicleId:   uint64(w.VehicleID),
+		VehicleNo:   w.VehicleNo,
+		RouteId:     uint64(w.RouteID),
+		StageId:     uint64(w.StageID),
+		StageName:   w.StageName,
+		EtaSeconds:  w.Seconds,
+		ArrivalAtMs: unixMilli(w.ArrivalAt),
+		TimestampMs: unixMilli(w.Timestamp),
+	}
+}
+
+func (s *SOS) toProto() *wsv1.SOS {
+	m := &wsv1.SOS{
+		SaccoId:      uint64(s.SaccoID),
+		SosId:        uint64(s.SOSID),
+		State:        s.State,
+		Priority:     s.Priority,
+		Kind:         s.Kind,
+		Note:         s.Note,
+		DriverId:     uint64(s.DriverID),
+		DriverName:   s.DriverName,
+		DriverPhone:  s.DriverPhone,
+		VehicleId:    uint64(s.VehicleID),
+		VehicleNo:    s.VehicleNo,
+		RouteId:      uint64(s.RouteID),
+		TripId:       uint64(s.TripID),
+		Accuracy:     s.Accuracy,
+		LocationAtMs: unixMilli(s.LocationAt),
+		RaisedAtMs:   unixMilli(s.RaisedAt),
+		Resolution:   s.Resolution,
+		TimestampMs:  unixMilli(s.Timestamp),
+	}
+	// A position is only sent whole.
+	if s.Latitude != nil && s.Longitude != nil {
+		m.Latitude, m.Longitude = s.Latitude, s.Longitude
+	}
+	return m
+}
+
+func (a *Ack) toProto() *wsv1.Ack {
+	return &wsv1.Ack{
+		Status:          a.Status,
+		EventType:       a.EventType,
+		Distance:        a.Distance,
+		IsMoving:        a.IsMoving,
+		TimestampMs:     unixMilli(a.Timestamp),
+		SequenceId:      uint64(a.SequenceID),
+		VehicleId:       uint64(a.VehicleID),
+		OccupancyStatus: a.OccupancyStatus,
+		Occupancy:       int32Ptr(a.Occupancy),
+		TripId:          uint64(a.TripID),
+		SosId:           uint64(a.SOSID),
+	}
+}
+
+func int32Ptr(v *int) *int32 {
+	if v == nil {
+		return nil
+	}
+	n := int32(*v)
+	return &n
+}
+
+// unixMilli converts an RFC 3339 time to Unix milliseconds, 0 when unset.
+func unixMilli(ts string) int64 {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
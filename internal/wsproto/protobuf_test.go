@@ -0,0 +1,79 @@
+package wsproto
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"ma3_tracker/internal/wsproto/wsv1"
+)
+
+func TestMarshalProtoRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)
+	env, err := Wrap(TypeLocation, map[string]interface{}{
+		"sacco_id":      2,
+		"vehicle_id":    7,
+		"vehicle_no":    "KBB 007B",
+		"latitude":      -1.3,
+		"longitude":     36.8,
+		"speed":         12.5,
+		"timestamp":     at.Format(time.RFC3339Nano),
+		"occupancy":     0,
+		"raw_latitude":  -1.31,
+		"raw_longitude": 36.81,
+		"etas":          []map[string]interface{}{{"stage_id": 4, "name": "Bomas", "seq": 2, "eta_seconds": 90}},
+		"display":       map[string]interface{}{"speed": "45 km/h"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := env.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got wsv1.Envelope
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	l := got.GetLocation()
+	switch {
+	case got.GetVersion() != Version || l == nil:
+		t.Fatalf("decoded %v", &got)
+	case l.GetSaccoId() != 2 || l.GetVehicleId() != 7 || l.GetVehicleNo() != "KBB 007B" || l.GetSpeed() != 12.5:
+		t.Errorf("location fields %v", l)
+	case l.GetTimestampMs() != at.UnixMilli():
+		t.Errorf("timestamp_ms = %d; want %d", l.GetTimestampMs(), at.UnixMilli())
+	case l.Occupancy == nil || *l.Occupancy != 0:
+		t.Errorf("occupancy = %v; want an explicit 0", l.Occupancy)
+	case l.GetRawLatitude() != -1.31 || l.AgeSeconds != nil:
+		t.Errorf("optional fields raw_latitude=%v age_seconds=%v", l.RawLatitude, l.AgeSeconds)
+	case len(l.GetEtas()) != 1 || l.GetEtas()[0].GetName() != "Bomas" || l.GetEtas()[0].GetEtaSeconds() != 90:
+		t.Errorf("etas %v", l.GetEtas())
+	}
+}
+
+func TestMarshalProtoEveryType(t *testing.T) {
+	for _, kind := range []string{TypeLocation, TypeSnapshot, TypeOccupancy, TypeAlert, TypeArrival, TypeDeparture,
+		TypeWatch, TypeSOS, TypeCoaching, TypeMessage, TypeAck, TypeError} {
+		env, err := Wrap(kind, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		b, err := env.MarshalProto()
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		var got wsv1.Envelope
+		if err := proto.Unmarshal(b, &got); err != nil || got.GetPayload() == nil {
+			t.Errorf("%s: decoded %v, %v; want the payload set even when empty", kind, &got, err)
+		}
+	}
+	env, _ := Wrap(TypeDeparture, map[string]interface{}{"stage_id": 3})
+	b, _ := env.MarshalProto()
+	var got wsv1.Envelope
+	proto.Unmarshal(b, &got)
+	if got.GetStageDeparture().GetStageId() != 3 {
+		t.Errorf("departure decoded as %v", &got)
+	}
+}
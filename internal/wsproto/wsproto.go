@@ -0,0 +1,294 @@
+// Package wsproto defines the versioned messages of the location WebSocket.
+//
+// Clients that connect with ?protocol=v1 receive every message wrapped in an
+// Envelope whose Type says which payload struct it carries. Older clients
+// keep receiving the flat JSON objects; each payload uses the same keys as
+// its flat counterpart, minus "type". schema.json describes all of them.
+// Envelopes can also be sent as protobuf binary frames (see MarshalProto and
+// proto/ws/v1/messages.proto).
+package wsproto
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// Version is the current protocol version.
+const Version = 1
+
+// Message types.
+const (
+	TypeLocation  = "location"        // A vehicle or driver moved (Location)
+	TypeSnapshot  = "snapshot"        // Last known positions on connect (Snapshot)
+	TypeOccupancy = "occupancy"       // A vehicle's passenger load changed (Occupancy)
+	TypeAlert     = "alert"           // Something needs attention, e.g. speeding (Alert)
+	TypeArrival   = "stage_arrival"   // A vehicle reached a stage (StageEvent)
+	TypeDeparture = "stage_departure" // A vehicle left a stage (StageEvent)
+	TypeWatch     = "watch_alert"     // A commuter's watch fired (WatchAlert)
+	TypeSOS       = "sos"             // A driver raised an SOS or its state changed (SOS)
+	TypeCoaching  = "coaching_event"  // Feedback to a driver about their driving (Coaching)
+	TypeMessage   = "message"         // A message from the sacco to a driver (DriverMessage)
+	TypeAck       = "ack"             // A driver's update was processed (Ack)
+	TypeError     = "error"           // A driver's update was rejected (Error)
+)
+
+// PriorityHigh marks broadcasts, such as SOS alerts, that are queued ahead
+// of routine updates and never dropped in favour of them.
+const PriorityHigh = "high"
+
+// Envelope wraps every message of protocol v1.
+type Envelope struct {
+	Type    string      `json:"type"`
+	Version int         `json:"version"`
+	Payload interface{} `json:"payload"`
+}
+
+// Location is a saved location point. Driver and vehicle are only set when
+// known; Unassigned marks a point missing one of them.
+type Location struct {
+	SaccoID         uint                   `json:"sacco_id"`
+	VehicleID       uint                   `json:"vehicle_id,omitempty"`
+	VehicleNo       string                 `json:"vehicle_no,omitempty"`
+	RouteID         uint                   `json:"route_id,omitempty"`
+	DriverID        uint                   `json:"driver_id,omitempty"`
+	Latitude        float64                `json:"latitude"`
+	Longitude       float64                `json:"longitude"`
+	Accuracy        float64                `json:"accuracy"`
+	Speed           float64                `json:"speed"` // m/s
+	Bearing         float64                `json:"bearing"`
+	Altitude        float64                `json:"altitude,omitempty"`
+	Timestamp       string                 `json:"timestamp"` // RFC 3339, UTC
+	EventType       string                 `json:"event_type,omitempty"`
+	IsMoving        bool                   `json:"is_moving,omitempty"`
+	Source          string                 `json:"source,omitempty"`
+	SequenceID      uint                   `json:"sequence_id,omitempty"`
+	Capacity        int                    `json:"capacity,omitempty"`
+	OccupancyStatus string                 `json:"occupancy_status,omitempty"`
+	Occupancy       *int                   `json:"occupancy,omitempty"`
+	Unassigned      bool                   `json:"unassigned,omitempty"`
+	AgeSeconds      *float64               `json:"age_seconds,omitempty"` // Snapshot entries only
+	Stale           bool                   `json:"stale,omitempty"`
+	TripID          uint                   `json:"trip_id,omitempty"`
+	Matched         bool                   `json:"matched,omitempty"`       // Latitude/Longitude are snapped onto the route
+	RawLatitude     *float64               `json:"raw_latitude,omitempty"`  // Reported fix, when matched
+	RawLongitude    *float64               `json:"raw_longitude,omitempty"` // Reported fix, when matched
+	ETAs            []StageETA             `json:"etas,omitempty"`          // Next stages on the vehicle's route
+	Display         map[string]interface{} `json:"display,omitempty"`       // Rendered in the client's units
+}
+
+// StageETA is when a vehicle is expected at one of its upcoming stages.
+type StageETA struct {
+	StageID   uint    `json:"stage_id"`
+	Name      string  `json:"name"`
+	Seq       int     `json:"seq"`
+	DistanceM float64 `json:"distance_m"` // Along the route
+	Seconds   float64 `json:"eta_seconds"`
+	ArrivalAt string  `json:"arrival_at"`
+}
+
+// Snapshot lists the last known position of each relevant vehicle.
+type Snapshot struct {
+	Vehicles          []Location `json:"vehicles"`
+	StaleAfterSeconds float64    `json:"stale_after_seconds"`
+	Timestamp         string     `json:"timestamp"`
+}
+
+// Occupancy is a vehicle's reported passenger load.
+type Occupancy struct {
+	SaccoID         uint                   `json:"sacco_id"`
+	VehicleID       uint                   `json:"vehicle_id"`
+	DriverID        uint                   `json:"driver_id,omitempty"`
+	Capacity        int                    `json:"capacity"`
+	OccupancyStatus string                 `json:"occupancy_status"`
+	Occupancy       *int                   `json:"occupancy,omitempty"`
+	Timestamp       string                 `json:"timestamp"`
+	Display         map[string]interface{} `json:"display,omitempty"`
+}
+
+// Alert kinds.
+const (
+	AlertSpeedViolation = "speed_violation"
+	AlertOffRoute       = "off_route"
+)
+
+// Alert reports an episode that needs the sacco's attention. State is
+// "started" or "ended". Speed and Limit are set for speed violations;
+// DeviationID, RouteID and DistanceM for off-route alerts.
+type Alert struct {
+	Kind        string                 `json:"kind"`
+	State       string                 `json:"state"`
+	SaccoID     uint                   `json:"sacco_id"`
+	ViolationID uint                   `json:"violation_id,omitempty"`
+	VehicleID   uint                   `json:"vehicle_id,omitempty"`
+	DriverID    uint                   `json:"driver_id,omitempty"`
+	Speed       float64                `json:"speed"` // m/s
+	Limit       float64                `json:"limit"` // m/s
+	Latitude    float64                `json:"latitude"`
+	Longitude   float64                `json:"longitude"`
+	StartedAt   string                 `json:"started_at"`
+	Timestamp   string                 `json:"timestamp"`
+	DeviationID uint                   `json:"deviation_id,omitempty"`
+	RouteID     uint                   `json:"route_id,omitempty"`
+	DistanceM   float64                `json:"distance_m,omitempty"` // Farthest from the route so far
+	Display     map[string]interface{} `json:"display,omitempty"`
+}
+
+// StageEvent is a vehicle arriving at or departing from a stage on its
+// route. DwellSeconds is set on departures.
+type StageEvent struct {
+	SaccoID      uint                   `json:"sacco_id"`
+	EventID      uint                   `json:"event_id"`
+	VehicleID    uint                   `json:"vehicle_id"`
+	DriverID     uint                   `json:"driver_id,omitempty"`
+	RouteID      uint                   `json:"route_id"`
+	StageID      uint                   `json:"stage_id"`
+	StageName    string                 `json:"stage_name,omitempty"`
+	StageSeq     int                    `json:"stage_seq,omitempty"`
+	Latitude     float64                `json:"latitude"`
+	Longitude    float64                `json:"longitude"`
+	Distance     float64                `json:"distance"` // Metres from the stage
+	DwellSeconds float64                `json:"dwell_seconds,omitempty"`
+	Timestamp    string                 `json:"timestamp"`
+	Display      map[string]interface{} `json:"display,omitempty"`
+}
+
+// WatchAlert tells a commuter that a vehicle they watch for is close to
+// their stage.
+type WatchAlert struct {
+	WatchID   uint                   `json:"watch_id"`
+	VehicleID uint                   `json:"vehicle_id"`
+	VehicleNo string                 `json:"vehicle_no,omitempty"`
+	RouteID   uint                   `json:"route_id"`
+	StageID   uint                   `json:"stage_id"`
+	StageName string                 `json:"stage_name,omitempty"`
+	Seconds   float64                `json:"eta_seconds"`
+	ArrivalAt string                 `json:"arrival_at"`
+	Timestamp string                 `json:"timestamp"`
+	Display   map[string]interface{} `json:"display,omitempty"`
+}
+
+// SOS is a driver's panic alert. State is "raised", "acknowledged" or
+// "resolved"; the location is left out when the driver's position is
+// unknown.
+type SOS struct {
+	SaccoID     uint                   `json:"sacco_id"`
+	SOSID       uint                   `json:"sos_id"`
+	State       string                 `json:"state"`
+	Priority    string                 `json:"priority"`
+	Kind        string                 `json:"kind"`
+	Note        string                 `json:"note,omitempty"`
+	DriverID    uint                   `json:"driver_id"`
+	DriverName  string                 `json:"driver_name,omitempty"`
+	DriverPhone string                 `json:"driver_phone,omitempty"`
+	VehicleID   uint                   `json:"vehicle_id,omitempty"`
+	VehicleNo   string                 `json:"vehicle_no,omitempty"`
+	RouteID     uint                   `json:"route_id,omitempty"`
+	TripID      uint                   `json:"trip_id,omitempty"`
+	Latitude    *float64               `json:"latitude,omitempty"`
+	Longitude   *float64               `json:"longitude,omitempty"`
+	Accuracy    float64                `json:"accuracy,omitempty"`
+	LocationAt  string                 `json:"location_at,omitempty"`
+	RaisedAt    string                 `json:"raised_at"`
+	Resolution  string                 `json:"resolution,omitempty"`
+	Timestamp   string                 `json:"timestamp"`
+	Display     map[string]interface{} `json:"display,omitempty"`
+}
+
+// Coaching is feedback to a driver about a driving event.
+type Coaching struct {
+	Event   json.RawMessage `json:"event"`
+	Message string          `json:"message"`
+}
+
+// DriverMessage is a message from the sacco delivered to a driver.
+type DriverMessage struct {
+	MessageID uint   `json:"message_id"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
+
+// Ack confirms a driver's update. Status is "saved", "ignored" for a location
+// too close to the last saved one, "trip_started"/"trip_ended" or
+// "sos_raised"; any client's auth message is answered with "authenticated".
+type Ack struct {
+	Status          string  `json:"status"`
+	EventType       string  `json:"event_type,omitempty"`
+	Distance        float64 `json:"distance,omitempty"`
+	IsMoving        bool    `json:"is_moving,omitempty"`
+	Timestamp       string  `json:"timestamp,omitempty"`
+	SequenceID      uint    `json:"sequence_id,omitempty"`
+	VehicleID       uint    `json:"vehicle_id,omitempty"`
+	OccupancyStatus string  `json:"occupancy_status,omitempty"`
+	Occupancy       *int    `json:"occupancy,omitempty"`
+	TripID          uint    `json:"trip_id,omitempty"`
+	SOSID           uint    `json:"sos_id,omitempty"`
+}
+
+// Error rejects a driver's update.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// KindOf returns the message type of a flat broadcast, which carries its
+// kind in "type" (absent for location updates).
+func KindOf(flat map[string]interface{}) string {
+	switch t, _ := flat["type"].(string); t {
+	case "":
+		return TypeLocation
+	case AlertSpeedViolation, AlertOffRoute:
+		return TypeAlert
+	default:
+		return t
+	}
+}
+
+// Wrap converts a flat message of the given kind into its envelope.
+func Wrap(kind string, flat map[string]interface{}) (Envelope, error) {
+	var payload interface{}
+	switch kind {
+	case TypeLocation:
+		payload = &Location{}
+	case TypeSnapshot:
+		payload = &Snapshot{}
+	case TypeOccupancy:
+		payload = &Occupancy{}
+	case TypeAlert:
+		payload = &Alert{}
+	case TypeArrival, TypeDeparture:
+		payload = &StageEvent{}
+	case TypeWatch:
+		payload = &WatchAlert{}
+	case TypeSOS:
+		payload = &SOS{}
+	case TypeCoaching:
+		payload = &Coaching{}
+	case TypeMessage:
+		payload = &DriverMessage{}
+	case TypeAck:
+		payload = &Ack{}
+	case TypeError:
+		payload = &Error{}
+	default:
+		return Envelope{}, fmt.Errorf("wsproto: unknown message type %q", kind)
+	}
+	raw, err := json.Marshal(flat)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return Envelope{}, fmt.Errorf("wsproto: %s payload: %w", kind, err)
+	}
+	if alert, ok := payload.(*Alert); ok {
+		alert.Kind, _ = flat["type"].(string)
+	}
+	return Envelope{Type: kind, Version: Version, Payload: payload}, nil
+}
+
+//go:embed schema.json
+var schema []byte
+
+// Schema returns the JSON Schema describing protocol v1.
+func Schema() []byte {
+	return schema
+}
@@ -0,0 +1,1950 @@
+// Binary encoding of the location WebSocket, protocol v1.
+//
+// Clients negotiate it with the "ma3tracker.v1+proto" subprotocol (or
+// ?encoding=protobuf) and then receive every server message as a binary
+// frame holding one Envelope. Messages sent to the server stay JSON.
+//
+// Fields mirror the JSON payloads in internal/wsproto/schema.json, except
+// that times are Unix milliseconds and the "display" blocks are left out:
+// binary clients render units themselves.
+//
+// Go code is generated into internal/wsproto/wsv1, and
+// internal/wsproto/protobuf.go fills it in from the JSON payloads. Regenerate
+// it after changing this file, keep protobuf.go in step, and never reuse a
+// field number:
+//
+//   protoc -I proto --go_out=. --go_opt=module=ma3_tracker \
+//     proto/ws/v1/messages.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: ws/v1/messages.proto
+
+package wsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Envelope struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Version uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*Envelope_Location
+	//	*Envelope_Snapshot
+	//	*Envelope_Occupancy
+	//	*Envelope_Alert
+	//	*Envelope_Coaching
+	//	*Envelope_Message
+	//	*Envelope_Ack
+	//	*Envelope_Error
+	//	*Envelope_StageArrival
+	//	*Envelope_StageDeparture
+	//	*Envelope_WatchAlert
+	//	*Envelope_Sos
+	Payload       isEnvelope_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Envelope) Reset() {
+	*x = Envelope{}
+	mi := &file_ws_v1_messages_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Envelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Envelope) ProtoMessage() {}
+
+func (x *Envelope) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Envelope.ProtoReflect.Descriptor instead.
+func (*Envelope) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Envelope) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Envelope) GetPayload() isEnvelope_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Envelope) GetLocation() *Location {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Location); ok {
+			return x.Location
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetSnapshot() *Snapshot {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetOccupancy() *Occupancy {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Occupancy); ok {
+			return x.Occupancy
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetAlert() *Alert {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Alert); ok {
+			return x.Alert
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetCoaching() *Coaching {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Coaching); ok {
+			return x.Coaching
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetMessage() *DriverMessage {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Message); ok {
+			return x.Message
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetAck() *Ack {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetStageArrival() *StageEvent {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_StageArrival); ok {
+			return x.StageArrival
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetStageDeparture() *StageEvent {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_StageDeparture); ok {
+			return x.StageDeparture
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetWatchAlert() *WatchAlert {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_WatchAlert); ok {
+			return x.WatchAlert
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetSos() *SOS {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Sos); ok {
+			return x.Sos
+		}
+	}
+	return nil
+}
+
+type isEnvelope_Payload interface {
+	isEnvelope_Payload()
+}
+
+type Envelope_Location struct {
+	Location *Location `protobuf:"bytes,10,opt,name=location,proto3,oneof"`
+}
+
+type Envelope_Snapshot struct {
+	Snapshot *Snapshot `protobuf:"bytes,11,opt,name=snapshot,proto3,oneof"`
+}
+
+type Envelope_Occupancy struct {
+	Occupancy *Occupancy `protobuf:"bytes,12,opt,name=occupancy,proto3,oneof"`
+}
+
+type Envelope_Alert struct {
+	Alert *Alert `protobuf:"bytes,13,opt,name=alert,proto3,oneof"`
+}
+
+type Envelope_Coaching struct {
+	Coaching *Coaching `protobuf:"bytes,14,opt,name=coaching,proto3,oneof"`
+}
+
+type Envelope_Message struct {
+	Message *DriverMessage `protobuf:"bytes,15,opt,name=message,proto3,oneof"`
+}
+
+type Envelope_Ack struct {
+	Ack *Ack `protobuf:"bytes,16,opt,name=ack,proto3,oneof"`
+}
+
+type Envelope_Error struct {
+	Error *Error `protobuf:"bytes,17,opt,name=error,proto3,oneof"`
+}
+
+type Envelope_StageArrival struct {
+	StageArrival *StageEvent `protobuf:"bytes,18,opt,name=stage_arrival,json=stageArrival,proto3,oneof"`
+}
+
+type Envelope_StageDeparture struct {
+	StageDeparture *StageEvent `protobuf:"bytes,19,opt,name=stage_departure,json=stageDeparture,proto3,oneof"`
+}
+
+type Envelope_WatchAlert struct {
+	WatchAlert *WatchAlert `protobuf:"bytes,20,opt,name=watch_alert,json=watchAlert,proto3,oneof"`
+}
+
+type Envelope_Sos struct {
+	Sos *SOS `protobuf:"bytes,21,opt,name=sos,proto3,oneof"`
+}
+
+func (*Envelope_Location) isEnvelope_Payload() {}
+
+func (*Envelope_Snapshot) isEnvelope_Payload() {}
+
+func (*Envelope_Occupancy) isEnvelope_Payload() {}
+
+func (*Envelope_Alert) isEnvelope_Payload() {}
+
+func (*Envelope_Coaching) isEnvelope_Payload() {}
+
+func (*Envelope_Message) isEnvelope_Payload() {}
+
+func (*Envelope_Ack) isEnvelope_Payload() {}
+
+func (*Envelope_Error) isEnvelope_Payload() {}
+
+func (*Envelope_StageArrival) isEnvelope_Payload() {}
+
+func (*Envelope_StageDeparture) isEnvelope_Payload() {}
+
+func (*Envelope_WatchAlert) isEnvelope_Payload() {}
+
+func (*Envelope_Sos) isEnvelope_Payload() {}
+
+type Location struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	SaccoId         uint64                 `protobuf:"varint,1,opt,name=sacco_id,json=saccoId,proto3" json:"sacco_id,omitempty"`
+	VehicleId       uint64                 `protobuf:"varint,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	VehicleNo       string                 `protobuf:"bytes,3,opt,name=vehicle_no,json=vehicleNo,proto3" json:"vehicle_no,omitempty"`
+	RouteId         uint64                 `protobuf:"varint,4,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	DriverId        uint64                 `protobuf:"varint,5,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	Latitude        float64                `protobuf:"fixed64,6,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude       float64                `protobuf:"fixed64,7,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Accuracy        float64                `protobuf:"fixed64,8,opt,name=accuracy,proto3" json:"accuracy,omitempty"` // Metres
+	Speed           float64                `protobuf:"fixed64,9,opt,name=speed,proto3" json:"speed,omitempty"`       // m/s
+	Bearing         float64                `protobuf:"fixed64,10,opt,name=bearing,proto3" json:"bearing,omitempty"`  // Degrees
+	Altitude        float64                `protobuf:"fixed64,11,opt,name=altitude,proto3" json:"altitude,omitempty"`
+	TimestampMs     int64                  `protobuf:"varint,12,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	EventType       string                 `protobuf:"bytes,13,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	IsMoving        bool                   `protobuf:"varint,14,opt,name=is_moving,json=isMoving,proto3" json:"is_moving,omitempty"`
+	Source          string                 `protobuf:"bytes,15,opt,name=source,proto3" json:"source,omitempty"` // "driver" or "tracker"
+	SequenceId      uint64                 `protobuf:"varint,16,opt,name=sequence_id,json=sequenceId,proto3" json:"sequence_id,omitempty"`
+	Capacity        int32                  `protobuf:"varint,17,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	OccupancyStatus string                 `protobuf:"bytes,18,opt,name=occupancy_status,json=occupancyStatus,proto3" json:"occupancy_status,omitempty"`
+	Occupancy       *int32                 `protobuf:"varint,19,opt,name=occupancy,proto3,oneof" json:"occupancy,omitempty"`
+	Unassigned      bool                   `protobuf:"varint,20,opt,name=unassigned,proto3" json:"unassigned,omitempty"`
+	AgeSeconds      *float64               `protobuf:"fixed64,21,opt,name=age_seconds,json=ageSeconds,proto3,oneof" json:"age_seconds,omitempty"` // Snapshot entries only
+	Stale           bool                   `protobuf:"varint,22,opt,name=stale,proto3" json:"stale,omitempty"`
+	Etas            []*StageETA            `protobuf:"bytes,23,rep,name=etas,proto3" json:"etas,omitempty"` // Next stages on the vehicle's route
+	TripId          uint64                 `protobuf:"varint,24,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`
+	Matched         bool                   `protobuf:"varint,25,opt,name=matched,proto3" json:"matched,omitempty"`                                   // latitude/longitude are snapped onto the route
+	RawLatitude     *float64               `protobuf:"fixed64,26,opt,name=raw_latitude,json=rawLatitude,proto3,oneof" json:"raw_latitude,omitempty"` // Reported fix, when matched
+	RawLongitude    *float64               `protobuf:"fixed64,27,opt,name=raw_longitude,json=rawLongitude,proto3,oneof" json:"raw_longitude,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Location) Reset() {
+	*x = Location{}
+	mi := &file_ws_v1_messages_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Location) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Location) ProtoMessage() {}
+
+func (x *Location) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Location.ProtoReflect.Descriptor instead.
+func (*Location) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Location) GetSaccoId() uint64 {
+	if x != nil {
+		return x.SaccoId
+	}
+	return 0
+}
+
+func (x *Location) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *Location) GetVehicleNo() string {
+	if x != nil {
+		return x.VehicleNo
+	}
+	return ""
+}
+
+func (x *Location) GetRouteId() uint64 {
+	if x != nil {
+		return x.RouteId
+	}
+	return 0
+}
+
+func (x *Location) GetDriverId() uint64 {
+	if x != nil {
+		return x.DriverId
+	}
+	return 0
+}
+
+func (x *Location) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *Location) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *Location) GetAccuracy() float64 {
+	if x != nil {
+		return x.Accuracy
+	}
+	return 0
+}
+
+func (x *Location) GetSpeed() float64 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+func (x *Location) GetBearing() float64 {
+	if x != nil {
+		return x.Bearing
+	}
+	return 0
+}
+
+func (x *Location) GetAltitude() float64 {
+	if x != nil {
+		return x.Altitude
+	}
+	return 0
+}
+
+func (x *Location) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+func (x *Location) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *Location) GetIsMoving() bool {
+	if x != nil {
+		return x.IsMoving
+	}
+	return false
+}
+
+func (x *Location) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Location) GetSequenceId() uint64 {
+	if x != nil {
+		return x.SequenceId
+	}
+	return 0
+}
+
+func (x *Location) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *Location) GetOccupancyStatus() string {
+	if x != nil {
+		return x.OccupancyStatus
+	}
+	return ""
+}
+
+func (x *Location) GetOccupancy() int32 {
+	if x != nil && x.Occupancy != nil {
+		return *x.Occupancy
+	}
+	return 0
+}
+
+func (x *Location) GetUnassigned() bool {
+	if x != nil {
+		return x.Unassigned
+	}
+	return false
+}
+
+func (x *Location) GetAgeSeconds() float64 {
+	if x != nil && x.AgeSeconds != nil {
+		return *x.AgeSeconds
+	}
+	return 0
+}
+
+func (x *Location) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+func (x *Location) GetEtas() []*StageETA {
+	if x != nil {
+		return x.Etas
+	}
+	return nil
+}
+
+func (x *Location) GetTripId() uint64 {
+	if x != nil {
+		return x.TripId
+	}
+	return 0
+}
+
+func (x *Location) GetMatched() bool {
+	if x != nil {
+		return x.Matched
+	}
+	return false
+}
+
+func (x *Location) GetRawLatitude() float64 {
+	if x != nil && x.RawLatitude != nil {
+		return *x.RawLatitude
+	}
+	return 0
+}
+
+func (x *Location) GetRawLongitude() float64 {
+	if x != nil && x.RawLongitude != nil {
+		return *x.RawLongitude
+	}
+	return 0
+}
+
+type StageETA struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StageId       uint64                 `protobuf:"varint,1,opt,name=stage_id,json=stageId,proto3" json:"stage_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Seq           int32                  `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	DistanceM     float64                `protobuf:"fixed64,4,opt,name=distance_m,json=distanceM,proto3" json:"distance_m,omitempty"` // Along the route
+	EtaSeconds    float64                `protobuf:"fixed64,5,opt,name=eta_seconds,json=etaSeconds,proto3" json:"eta_seconds,omitempty"`
+	ArrivalAtMs   int64                  `protobuf:"varint,6,opt,name=arrival_at_ms,json=arrivalAtMs,proto3" json:"arrival_at_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StageETA) Reset() {
+	*x = StageETA{}
+	mi := &file_ws_v1_messages_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StageETA) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StageETA) ProtoMessage() {}
+
+func (x *StageETA) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StageETA.ProtoReflect.Descriptor instead.
+func (*StageETA) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StageETA) GetStageId() uint64 {
+	if x != nil {
+		return x.StageId
+	}
+	return 0
+}
+
+func (x *StageETA) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *StageETA) GetSeq() int32 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StageETA) GetDistanceM() float64 {
+	if x != nil {
+		return x.DistanceM
+	}
+	return 0
+}
+
+func (x *StageETA) GetEtaSeconds() float64 {
+	if x != nil {
+		return x.EtaSeconds
+	}
+	return 0
+}
+
+func (x *StageETA) GetArrivalAtMs() int64 {
+	if x != nil {
+		return x.ArrivalAtMs
+	}
+	return 0
+}
+
+type Snapshot struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Vehicles          []*Location            `protobuf:"bytes,1,rep,name=vehicles,proto3" json:"vehicles,omitempty"`
+	StaleAfterSeconds float64                `protobuf:"fixed64,2,opt,name=stale_after_seconds,json=staleAfterSeconds,proto3" json:"stale_after_seconds,omitempty"`
+	TimestampMs       int64                  `protobuf:"varint,3,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_ws_v1_messages_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Snapshot) GetVehicles() []*Location {
+	if x != nil {
+		return x.Vehicles
+	}
+	return nil
+}
+
+func (x *Snapshot) GetStaleAfterSeconds() float64 {
+	if x != nil {
+		return x.StaleAfterSeconds
+	}
+	return 0
+}
+
+func (x *Snapshot) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+type Occupancy struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	SaccoId         uint64                 `protobuf:"varint,1,opt,name=sacco_id,json=saccoId,proto3" json:"sacco_id,omitempty"`
+	VehicleId       uint64                 `protobuf:"varint,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	DriverId        uint64                 `protobuf:"varint,3,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	Capacity        int32                  `protobuf:"varint,4,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	OccupancyStatus string                 `protobuf:"bytes,5,opt,name=occupancy_status,json=occupancyStatus,proto3" json:"occupancy_status,omitempty"`
+	Occupancy       *int32                 `protobuf:"varint,6,opt,name=occupancy,proto3,oneof" json:"occupancy,omitempty"`
+	TimestampMs     int64                  `protobuf:"varint,7,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Occupancy) Reset() {
+	*x = Occupancy{}
+	mi := &file_ws_v1_messages_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Occupancy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Occupancy) ProtoMessage() {}
+
+func (x *Occupancy) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Occupancy.ProtoReflect.Descriptor instead.
+func (*Occupancy) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Occupancy) GetSaccoId() uint64 {
+	if x != nil {
+		return x.SaccoId
+	}
+	return 0
+}
+
+func (x *Occupancy) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *Occupancy) GetDriverId() uint64 {
+	if x != nil {
+		return x.DriverId
+	}
+	return 0
+}
+
+func (x *Occupancy) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *Occupancy) GetOccupancyStatus() string {
+	if x != nil {
+		return x.OccupancyStatus
+	}
+	return ""
+}
+
+func (x *Occupancy) GetOccupancy() int32 {
+	if x != nil && x.Occupancy != nil {
+		return *x.Occupancy
+	}
+	return 0
+}
+
+func (x *Occupancy) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+type Alert struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          string                 `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`   // "speed_violation" or "off_route"
+	State         string                 `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"` // "started" or "ended"
+	SaccoId       uint64                 `protobuf:"varint,3,opt,name=sacco_id,json=saccoId,proto3" json:"sacco_id,omitempty"`
+	ViolationId   uint64                 `protobuf:"varint,4,opt,name=violation_id,json=violationId,proto3" json:"violation_id,omitempty"`
+	VehicleId     uint64                 `protobuf:"varint,5,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	DriverId      uint64                 `protobuf:"varint,6,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	Speed         float64                `protobuf:"fixed64,7,opt,name=speed,proto3" json:"speed,omitempty"` // m/s
+	Limit         float64                `protobuf:"fixed64,8,opt,name=limit,proto3" json:"limit,omitempty"` // m/s
+	Latitude      float64                `protobuf:"fixed64,9,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,10,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	StartedAtMs   int64                  `protobuf:"varint,11,opt,name=started_at_ms,json=startedAtMs,proto3" json:"started_at_ms,omitempty"`
+	TimestampMs   int64                  `protobuf:"varint,12,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	DeviationId   uint64                 `protobuf:"varint,13,opt,name=deviation_id,json=deviationId,proto3" json:"deviation_id,omitempty"`
+	RouteId       uint64                 `protobuf:"varint,14,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	DistanceM     float64                `protobuf:"fixed64,15,opt,name=distance_m,json=distanceM,proto3" json:"distance_m,omitempty"` // Farthest from the route so far
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Alert) Reset() {
+	*x = Alert{}
+	mi := &file_ws_v1_messages_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Alert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Alert) ProtoMessage() {}
+
+func (x *Alert) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Alert.ProtoReflect.Descriptor instead.
+func (*Alert) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Alert) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *Alert) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Alert) GetSaccoId() uint64 {
+	if x != nil {
+		return x.SaccoId
+	}
+	return 0
+}
+
+func (x *Alert) GetViolationId() uint64 {
+	if x != nil {
+		return x.ViolationId
+	}
+	return 0
+}
+
+func (x *Alert) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *Alert) GetDriverId() uint64 {
+	if x != nil {
+		return x.DriverId
+	}
+	return 0
+}
+
+func (x *Alert) GetSpeed() float64 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+func (x *Alert) GetLimit() float64 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *Alert) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *Alert) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *Alert) GetStartedAtMs() int64 {
+	if x != nil {
+		return x.StartedAtMs
+	}
+	return 0
+}
+
+func (x *Alert) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+func (x *Alert) GetDeviationId() uint64 {
+	if x != nil {
+		return x.DeviationId
+	}
+	return 0
+}
+
+func (x *Alert) GetRouteId() uint64 {
+	if x != nil {
+		return x.RouteId
+	}
+	return 0
+}
+
+func (x *Alert) GetDistanceM() float64 {
+	if x != nil {
+		return x.DistanceM
+	}
+	return 0
+}
+
+type StageEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SaccoId       uint64                 `protobuf:"varint,1,opt,name=sacco_id,json=saccoId,proto3" json:"sacco_id,omitempty"`
+	EventId       uint64                 `protobuf:"varint,2,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	VehicleId     uint64                 `protobuf:"varint,3,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	DriverId      uint64                 `protobuf:"varint,4,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	RouteId       uint64                 `protobuf:"varint,5,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	StageId       uint64                 `protobuf:"varint,6,opt,name=stage_id,json=stageId,proto3" json:"stage_id,omitempty"`
+	StageName     string                 `protobuf:"bytes,7,opt,name=stage_name,json=stageName,proto3" json:"stage_name,omitempty"`
+	StageSeq      int32                  `protobuf:"varint,8,opt,name=stage_seq,json=stageSeq,proto3" json:"stage_seq,omitempty"`
+	Latitude      float64                `protobuf:"fixed64,9,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,10,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Distance      float64                `protobuf:"fixed64,11,opt,name=distance,proto3" json:"distance,omitempty"`                             // Metres from the stage
+	DwellSeconds  float64                `protobuf:"fixed64,12,opt,name=dwell_seconds,json=dwellSeconds,proto3" json:"dwell_seconds,omitempty"` // Departures only
+	TimestampMs   int64                  `protobuf:"varint,13,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StageEvent) Reset() {
+	*x = StageEvent{}
+	mi := &file_ws_v1_messages_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StageEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StageEvent) ProtoMessage() {}
+
+func (x *StageEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StageEvent.ProtoReflect.Descriptor instead.
+func (*StageEvent) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StageEvent) GetSaccoId() uint64 {
+	if x != nil {
+		return x.SaccoId
+	}
+	return 0
+}
+
+func (x *StageEvent) GetEventId() uint64 {
+	if x != nil {
+		return x.EventId
+	}
+	return 0
+}
+
+func (x *StageEvent) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *StageEvent) GetDriverId() uint64 {
+	if x != nil {
+		return x.DriverId
+	}
+	return 0
+}
+
+func (x *StageEvent) GetRouteId() uint64 {
+	if x != nil {
+		return x.RouteId
+	}
+	return 0
+}
+
+func (x *StageEvent) GetStageId() uint64 {
+	if x != nil {
+		return x.StageId
+	}
+	return 0
+}
+
+func (x *StageEvent) GetStageName() string {
+	if x != nil {
+		return x.StageName
+	}
+	return ""
+}
+
+func (x *StageEvent) GetStageSeq() int32 {
+	if x != nil {
+		return x.StageSeq
+	}
+	return 0
+}
+
+func (x *StageEvent) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *StageEvent) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *StageEvent) GetDistance() float64 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *StageEvent) GetDwellSeconds() float64 {
+	if x != nil {
+		return x.DwellSeconds
+	}
+	return 0
+}
+
+func (x *StageEvent) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+type WatchAlert struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	WatchId       uint64                 `protobuf:"varint,1,opt,name=watch_id,json=watchId,proto3" json:"watch_id,omitempty"`
+	VehicleId     uint64                 `protobuf:"varint,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	VehicleNo     string                 `protobuf:"bytes,3,opt,name=vehicle_no,json=vehicleNo,proto3" json:"vehicle_no,omitempty"`
+	RouteId       uint64                 `protobuf:"varint,4,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	StageId       uint64                 `protobuf:"varint,5,opt,name=stage_id,json=stageId,proto3" json:"stage_id,omitempty"`
+	StageName     string                 `protobuf:"bytes,6,opt,name=stage_name,json=stageName,proto3" json:"stage_name,omitempty"`
+	EtaSeconds    float64                `protobuf:"fixed64,7,opt,name=eta_seconds,json=etaSeconds,proto3" json:"eta_seconds,omitempty"`
+	ArrivalAtMs   int64                  `protobuf:"varint,8,opt,name=arrival_at_ms,json=arrivalAtMs,proto3" json:"arrival_at_ms,omitempty"`
+	TimestampMs   int64                  `protobuf:"varint,9,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchAlert) Reset() {
+	*x = WatchAlert{}
+	mi := &file_ws_v1_messages_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchAlert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchAlert) ProtoMessage() {}
+
+func (x *WatchAlert) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchAlert.ProtoReflect.Descriptor instead.
+func (*WatchAlert) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WatchAlert) GetWatchId() uint64 {
+	if x != nil {
+		return x.WatchId
+	}
+	return 0
+}
+
+func (x *WatchAlert) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *WatchAlert) GetVehicleNo() string {
+	if x != nil {
+		return x.VehicleNo
+	}
+	return ""
+}
+
+func (x *WatchAlert) GetRouteId() uint64 {
+	if x != nil {
+		return x.RouteId
+	}
+	return 0
+}
+
+func (x *WatchAlert) GetStageId() uint64 {
+	if x != nil {
+		return x.StageId
+	}
+	return 0
+}
+
+func (x *WatchAlert) GetStageName() string {
+	if x != nil {
+		return x.StageName
+	}
+	return ""
+}
+
+func (x *WatchAlert) GetEtaSeconds() float64 {
+	if x != nil {
+		return x.EtaSeconds
+	}
+	return 0
+}
+
+func (x *WatchAlert) GetArrivalAtMs() int64 {
+	if x != nil {
+		return x.ArrivalAtMs
+	}
+	return 0
+}
+
+func (x *WatchAlert) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+type SOS struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SaccoId       uint64                 `protobuf:"varint,1,opt,name=sacco_id,json=saccoId,proto3" json:"sacco_id,omitempty"`
+	SosId         uint64                 `protobuf:"varint,2,opt,name=sos_id,json=sosId,proto3" json:"sos_id,omitempty"`
+	State         string                 `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`       // "raised", "acknowledged" or "resolved"
+	Priority      string                 `protobuf:"bytes,4,opt,name=priority,proto3" json:"priority,omitempty"` // Always "high"
+	Kind          string                 `protobuf:"bytes,5,opt,name=kind,proto3" json:"kind,omitempty"`         // "accident", "security", "medical" or "other"
+	Note          string                 `protobuf:"bytes,6,opt,name=note,proto3" json:"note,omitempty"`
+	DriverId      uint64                 `protobuf:"varint,7,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	DriverName    string                 `protobuf:"bytes,8,opt,name=driver_name,json=driverName,proto3" json:"driver_name,omitempty"`
+	DriverPhone   string                 `protobuf:"bytes,9,opt,name=driver_phone,json=driverPhone,proto3" json:"driver_phone,omitempty"`
+	VehicleId     uint64                 `protobuf:"varint,10,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	VehicleNo     string                 `protobuf:"bytes,11,opt,name=vehicle_no,json=vehicleNo,proto3" json:"vehicle_no,omitempty"`
+	RouteId       uint64                 `protobuf:"varint,12,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	TripId        uint64                 `protobuf:"varint,13,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`
+	Latitude      *float64               `protobuf:"fixed64,14,opt,name=latitude,proto3,oneof" json:"latitude,omitempty"` // Unset when the driver's position is unknown
+	Longitude     *float64               `protobuf:"fixed64,15,opt,name=longitude,proto3,oneof" json:"longitude,omitempty"`
+	Accuracy      float64                `protobuf:"fixed64,16,opt,name=accuracy,proto3" json:"accuracy,omitempty"`                              // Metres
+	LocationAtMs  int64                  `protobuf:"varint,17,opt,name=location_at_ms,json=locationAtMs,proto3" json:"location_at_ms,omitempty"` // When the position was taken
+	RaisedAtMs    int64                  `protobuf:"varint,18,opt,name=raised_at_ms,json=raisedAtMs,proto3" json:"raised_at_ms,omitempty"`
+	Resolution    string                 `protobuf:"bytes,19,opt,name=resolution,proto3" json:"resolution,omitempty"`
+	TimestampMs   int64                  `protobuf:"varint,20,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SOS) Reset() {
+	*x = SOS{}
+	mi := &file_ws_v1_messages_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SOS) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SOS) ProtoMessage() {}
+
+func (x *SOS) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SOS.ProtoReflect.Descriptor instead.
+func (*SOS) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SOS) GetSaccoId() uint64 {
+	if x != nil {
+		return x.SaccoId
+	}
+	return 0
+}
+
+func (x *SOS) GetSosId() uint64 {
+	if x != nil {
+		return x.SosId
+	}
+	return 0
+}
+
+func (x *SOS) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *SOS) GetPriority() string {
+	if x != nil {
+		return x.Priority
+	}
+	return ""
+}
+
+func (x *SOS) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *SOS) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
+func (x *SOS) GetDriverId() uint64 {
+	if x != nil {
+		return x.DriverId
+	}
+	return 0
+}
+
+func (x *SOS) GetDriverName() string {
+	if x != nil {
+		return x.DriverName
+	}
+	return ""
+}
+
+func (x *SOS) GetDriverPhone() string {
+	if x != nil {
+		return x.DriverPhone
+	}
+	return ""
+}
+
+func (x *SOS) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *SOS) GetVehicleNo() string {
+	if x != nil {
+		return x.VehicleNo
+	}
+	return ""
+}
+
+func (x *SOS) GetRouteId() uint64 {
+	if x != nil {
+		return x.RouteId
+	}
+	return 0
+}
+
+func (x *SOS) GetTripId() uint64 {
+	if x != nil {
+		return x.TripId
+	}
+	return 0
+}
+
+func (x *SOS) GetLatitude() float64 {
+	if x != nil && x.Latitude != nil {
+		return *x.Latitude
+	}
+	return 0
+}
+
+func (x *SOS) GetLongitude() float64 {
+	if x != nil && x.Longitude != nil {
+		return *x.Longitude
+	}
+	return 0
+}
+
+func (x *SOS) GetAccuracy() float64 {
+	if x != nil {
+		return x.Accuracy
+	}
+	return 0
+}
+
+func (x *SOS) GetLocationAtMs() int64 {
+	if x != nil {
+		return x.LocationAtMs
+	}
+	return 0
+}
+
+func (x *SOS) GetRaisedAtMs() int64 {
+	if x != nil {
+		return x.RaisedAtMs
+	}
+	return 0
+}
+
+func (x *SOS) GetResolution() string {
+	if x != nil {
+		return x.Resolution
+	}
+	return ""
+}
+
+func (x *SOS) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+type Coaching struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EventJson     []byte                 `protobuf:"bytes,1,opt,name=event_json,json=eventJson,proto3" json:"event_json,omitempty"` // The driving event as JSON
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Coaching) Reset() {
+	*x = Coaching{}
+	mi := &file_ws_v1_messages_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Coaching) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Coaching) ProtoMessage() {}
+
+func (x *Coaching) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Coaching.ProtoReflect.Descriptor instead.
+func (*Coaching) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Coaching) GetEventJson() []byte {
+	if x != nil {
+		return x.EventJson
+	}
+	return nil
+}
+
+func (x *Coaching) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type DriverMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     uint64                 `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Title         string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Body          string                 `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DriverMessage) Reset() {
+	*x = DriverMessage{}
+	mi := &file_ws_v1_messages_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DriverMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DriverMessage) ProtoMessage() {}
+
+func (x *DriverMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DriverMessage.ProtoReflect.Descriptor instead.
+func (*DriverMessage) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DriverMessage) GetMessageId() uint64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *DriverMessage) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *DriverMessage) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+type Ack struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Status          string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"` // "saved", "ignored", "trip_started", "trip_ended", "sos_raised" or "authenticated"
+	EventType       string                 `protobuf:"bytes,2,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	Distance        float64                `protobuf:"fixed64,3,opt,name=distance,proto3" json:"distance,omitempty"`
+	IsMoving        bool                   `protobuf:"varint,4,opt,name=is_moving,json=isMoving,proto3" json:"is_moving,omitempty"`
+	TimestampMs     int64                  `protobuf:"varint,5,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	SequenceId      uint64                 `protobuf:"varint,6,opt,name=sequence_id,json=sequenceId,proto3" json:"sequence_id,omitempty"`
+	VehicleId       uint64                 `protobuf:"varint,7,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	OccupancyStatus string                 `protobuf:"bytes,8,opt,name=occupancy_status,json=occupancyStatus,proto3" json:"occupancy_status,omitempty"`
+	Occupancy       *int32                 `protobuf:"varint,9,opt,name=occupancy,proto3,oneof" json:"occupancy,omitempty"`
+	TripId          uint64                 `protobuf:"varint,10,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`
+	SosId           uint64                 `protobuf:"varint,11,opt,name=sos_id,json=sosId,proto3" json:"sos_id,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_ws_v1_messages_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Ack) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Ack) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *Ack) GetDistance() float64 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *Ack) GetIsMoving() bool {
+	if x != nil {
+		return x.IsMoving
+	}
+	return false
+}
+
+func (x *Ack) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+func (x *Ack) GetSequenceId() uint64 {
+	if x != nil {
+		return x.SequenceId
+	}
+	return 0
+}
+
+func (x *Ack) GetVehicleId() uint64 {
+	if x != nil {
+		return x.VehicleId
+	}
+	return 0
+}
+
+func (x *Ack) GetOccupancyStatus() string {
+	if x != nil {
+		return x.OccupancyStatus
+	}
+	return ""
+}
+
+func (x *Ack) GetOccupancy() int32 {
+	if x != nil && x.Occupancy != nil {
+		return *x.Occupancy
+	}
+	return 0
+}
+
+func (x *Ack) GetTripId() uint64 {
+	if x != nil {
+		return x.TripId
+	}
+	return 0
+}
+
+func (x *Ack) GetSosId() uint64 {
+	if x != nil {
+		return x.SosId
+	}
+	return 0
+}
+
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_ws_v1_messages_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_ws_v1_messages_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_ws_v1_messages_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Error) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_ws_v1_messages_proto protoreflect.FileDescriptor
+
+const file_ws_v1_messages_proto_rawDesc = "" +
+	"\n" +
+	"\x14ws/v1/messages.proto\x12\x10ma3tracker.ws.v1\"\xde\x05\n" +
+	"\bEnvelope\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x128\n" +
+	"\blocation\x18\n" +
+	" \x01(\v2\x1a.ma3tracker.ws.v1.LocationH\x00R\blocation\x128\n" +
+	"\bsnapshot\x18\v \x01(\v2\x1a.ma3tracker.ws.v1.SnapshotH\x00R\bsnapshot\x12;\n" +
+	"\toccupancy\x18\f \x01(\v2\x1b.ma3tracker.ws.v1.OccupancyH\x00R\toccupancy\x12/\n" +
+	"\x05alert\x18\r \x01(\v2\x17.ma3tracker.ws.v1.AlertH\x00R\x05alert\x128\n" +
+	"\bcoaching\x18\x0e \x01(\v2\x1a.ma3tracker.ws.v1.CoachingH\x00R\bcoaching\x12;\n" +
+	"\amessage\x18\x0f \x01(\v2\x1f.ma3tracker.ws.v1.DriverMessageH\x00R\amessage\x12)\n" +
+	"\x03ack\x18\x10 \x01(\v2\x15.ma3tracker.ws.v1.AckH\x00R\x03ack\x12/\n" +
+	"\x05error\x18\x11 \x01(\v2\x17.ma3tracker.ws.v1.ErrorH\x00R\x05error\x12C\n" +
+	"\rstage_arrival\x18\x12 \x01(\v2\x1c.ma3tracker.ws.v1.StageEventH\x00R\fstageArrival\x12G\n" +
+	"\x0fstage_departure\x18\x13 \x01(\v2\x1c.ma3tracker.ws.v1.StageEventH\x00R\x0estageDeparture\x12?\n" +
+	"\vwatch_alert\x18\x14 \x01(\v2\x1c.ma3tracker.ws.v1.WatchAlertH\x00R\n" +
+	"watchAlert\x12)\n" +
+	"\x03sos\x18\x15 \x01(\v2\x15.ma3tracker.ws.v1.SOSH\x00R\x03sosB\t\n" +
+	"\apayload\"\x91\a\n" +
+	"\bLocation\x12\x19\n" +
+	"\bsacco_id\x18\x01 \x01(\x04R\asaccoId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\x04R\tvehicleId\x12\x1d\n" +
+	"\n" +
+	"vehicle_no\x18\x03 \x01(\tR\tvehicleNo\x12\x19\n" +
+	"\broute_id\x18\x04 \x01(\x04R\arouteId\x12\x1b\n" +
+	"\tdriver_id\x18\x05 \x01(\x04R\bdriverId\x12\x1a\n" +
+	"\blatitude\x18\x06 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\a \x01(\x01R\tlongitude\x12\x1a\n" +
+	"\baccuracy\x18\b \x01(\x01R\baccuracy\x12\x14\n" +
+	"\x05speed\x18\t \x01(\x01R\x05speed\x12\x18\n" +
+	"\abearing\x18\n" +
+	" \x01(\x01R\abearing\x12\x1a\n" +
+	"\baltitude\x18\v \x01(\x01R\baltitude\x12!\n" +
+	"\ftimestamp_ms\x18\f \x01(\x03R\vtimestampMs\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\r \x01(\tR\teventType\x12\x1b\n" +
+	"\tis_moving\x18\x0e \x01(\bR\bisMoving\x12\x16\n" +
+	"\x06source\x18\x0f \x01(\tR\x06source\x12\x1f\n" +
+	"\vsequence_id\x18\x10 \x01(\x04R\n" +
+	"sequenceId\x12\x1a\n" +
+	"\bcapacity\x18\x11 \x01(\x05R\bcapacity\x12)\n" +
+	"\x10occupancy_status\x18\x12 \x01(\tR\x0foccupancyStatus\x12!\n" +
+	"\toccupancy\x18\x13 \x01(\x05H\x00R\toccupancy\x88\x01\x01\x12\x1e\n" +
+	"\n" +
+	"unassigned\x18\x14 \x01(\bR\n" +
+	"unassigned\x12$\n" +
+	"\vage_seconds\x18\x15 \x01(\x01H\x01R\n" +
+	"ageSeconds\x88\x01\x01\x12\x14\n" +
+	"\x05stale\x18\x16 \x01(\bR\x05stale\x12.\n" +
+	"\x04etas\x18\x17 \x03(\v2\x1a.ma3tracker.ws.v1.StageETAR\x04etas\x12\x17\n" +
+	"\atrip_id\x18\x18 \x01(\x04R\x06tripId\x12\x18\n" +
+	"\amatched\x18\x19 \x01(\bR\amatched\x12&\n" +
+	"\fraw_latitude\x18\x1a \x01(\x01H\x02R\vrawLatitude\x88\x01\x01\x12(\n" +
+	"\rraw_longitude\x18\x1b \x01(\x01H\x03R\frawLongitude\x88\x01\x01B\f\n" +
+	"\n" +
+	"_occupancyB\x0e\n" +
+	"\f_age_secondsB\x0f\n" +
+	"\r_raw_latitudeB\x10\n" +
+	"\x0e_raw_longitude\"\xaf\x01\n" +
+	"\bStageETA\x12\x19\n" +
+	"\bstage_id\x18\x01 \x01(\x04R\astageId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x05R\x03seq\x12\x1d\n" +
+	"\n" +
+	"distance_m\x18\x04 \x01(\x01R\tdistanceM\x12\x1f\n" +
+	"\veta_seconds\x18\x05 \x01(\x01R\n" +
+	"etaSeconds\x12\"\n" +
+	"\rarrival_at_ms\x18\x06 \x01(\x03R\varrivalAtMs\"\x95\x01\n" +
+	"\bSnapshot\x126\n" +
+	"\bvehicles\x18\x01 \x03(\v2\x1a.ma3tracker.ws.v1.LocationR\bvehicles\x12.\n" +
+	"\x13stale_after_seconds\x18\x02 \x01(\x01R\x11staleAfterSeconds\x12!\n" +
+	"\ftimestamp_ms\x18\x03 \x01(\x03R\vtimestampMs\"\xfd\x01\n" +
+	"\tOccupancy\x12\x19\n" +
+	"\bsacco_id\x18\x01 \x01(\x04R\asaccoId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\x04R\tvehicleId\x12\x1b\n" +
+	"\tdriver_id\x18\x03 \x01(\x04R\bdriverId\x12\x1a\n" +
+	"\bcapacity\x18\x04 \x01(\x05R\bcapacity\x12)\n" +
+	"\x10occupancy_status\x18\x05 \x01(\tR\x0foccupancyStatus\x12!\n" +
+	"\toccupancy\x18\x06 \x01(\x05H\x00R\toccupancy\x88\x01\x01\x12!\n" +
+	"\ftimestamp_ms\x18\a \x01(\x03R\vtimestampMsB\f\n" +
+	"\n" +
+	"_occupancy\"\xb5\x03\n" +
+	"\x05Alert\x12\x12\n" +
+	"\x04kind\x18\x01 \x01(\tR\x04kind\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12\x19\n" +
+	"\bsacco_id\x18\x03 \x01(\x04R\asaccoId\x12!\n" +
+	"\fviolation_id\x18\x04 \x01(\x04R\vviolationId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x05 \x01(\x04R\tvehicleId\x12\x1b\n" +
+	"\tdriver_id\x18\x06 \x01(\x04R\bdriverId\x12\x14\n" +
+	"\x05speed\x18\a \x01(\x01R\x05speed\x12\x14\n" +
+	"\x05limit\x18\b \x01(\x01R\x05limit\x12\x1a\n" +
+	"\blatitude\x18\t \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\n" +
+	" \x01(\x01R\tlongitude\x12\"\n" +
+	"\rstarted_at_ms\x18\v \x01(\x03R\vstartedAtMs\x12!\n" +
+	"\ftimestamp_ms\x18\f \x01(\x03R\vtimestampMs\x12!\n" +
+	"\fdeviation_id\x18\r \x01(\x04R\vdeviationId\x12\x19\n" +
+	"\broute_id\x18\x0e \x01(\x04R\arouteId\x12\x1d\n" +
+	"\n" +
+	"distance_m\x18\x0f \x01(\x01R\tdistanceM\"\x8e\x03\n" +
+	"\n" +
+	"StageEvent\x12\x19\n" +
+	"\bsacco_id\x18\x01 \x01(\x04R\asaccoId\x12\x19\n" +
+	"\bevent_id\x18\x02 \x01(\x04R\aeventId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x03 \x01(\x04R\tvehicleId\x12\x1b\n" +
+	"\tdriver_id\x18\x04 \x01(\x04R\bdriverId\x12\x19\n" +
+	"\broute_id\x18\x05 \x01(\x04R\arouteId\x12\x19\n" +
+	"\bstage_id\x18\x06 \x01(\x04R\astageId\x12\x1d\n" +
+	"\n" +
+	"stage_name\x18\a \x01(\tR\tstageName\x12\x1b\n" +
+	"\tstage_seq\x18\b \x01(\x05R\bstageSeq\x12\x1a\n" +
+	"\blatitude\x18\t \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\n" +
+	" \x01(\x01R\tlongitude\x12\x1a\n" +
+	"\bdistance\x18\v \x01(\x01R\bdistance\x12#\n" +
+	"\rdwell_seconds\x18\f \x01(\x01R\fdwellSeconds\x12!\n" +
+	"\ftimestamp_ms\x18\r \x01(\x03R\vtimestampMs\"\xa2\x02\n" +
+	"\n" +
+	"WatchAlert\x12\x19\n" +
+	"\bwatch_id\x18\x01 \x01(\x04R\awatchId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\x04R\tvehicleId\x12\x1d\n" +
+	"\n" +
+	"vehicle_no\x18\x03 \x01(\tR\tvehicleNo\x12\x19\n" +
+	"\broute_id\x18\x04 \x01(\x04R\arouteId\x12\x19\n" +
+	"\bstage_id\x18\x05 \x01(\x04R\astageId\x12\x1d\n" +
+	"\n" +
+	"stage_name\x18\x06 \x01(\tR\tstageName\x12\x1f\n" +
+	"\veta_seconds\x18\a \x01(\x01R\n" +
+	"etaSeconds\x12\"\n" +
+	"\rarrival_at_ms\x18\b \x01(\x03R\varrivalAtMs\x12!\n" +
+	"\ftimestamp_ms\x18\t \x01(\x03R\vtimestampMs\"\xea\x04\n" +
+	"\x03SOS\x12\x19\n" +
+	"\bsacco_id\x18\x01 \x01(\x04R\asaccoId\x12\x15\n" +
+	"\x06sos_id\x18\x02 \x01(\x04R\x05sosId\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\tR\x05state\x12\x1a\n" +
+	"\bpriority\x18\x04 \x01(\tR\bpriority\x12\x12\n" +
+	"\x04kind\x18\x05 \x01(\tR\x04kind\x12\x12\n" +
+	"\x04note\x18\x06 \x01(\tR\x04note\x12\x1b\n" +
+	"\tdriver_id\x18\a \x01(\x04R\bdriverId\x12\x1f\n" +
+	"\vdriver_name\x18\b \x01(\tR\n" +
+	"driverName\x12!\n" +
+	"\fdriver_phone\x18\t \x01(\tR\vdriverPhone\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\n" +
+	" \x01(\x04R\tvehicleId\x12\x1d\n" +
+	"\n" +
+	"vehicle_no\x18\v \x01(\tR\tvehicleNo\x12\x19\n" +
+	"\broute_id\x18\f \x01(\x04R\arouteId\x12\x17\n" +
+	"\atrip_id\x18\r \x01(\x04R\x06tripId\x12\x1f\n" +
+	"\blatitude\x18\x0e \x01(\x01H\x00R\blatitude\x88\x01\x01\x12!\n" +
+	"\tlongitude\x18\x0f \x01(\x01H\x01R\tlongitude\x88\x01\x01\x12\x1a\n" +
+	"\baccuracy\x18\x10 \x01(\x01R\baccuracy\x12$\n" +
+	"\x0elocation_at_ms\x18\x11 \x01(\x03R\flocationAtMs\x12 \n" +
+	"\fraised_at_ms\x18\x12 \x01(\x03R\n" +
+	"raisedAtMs\x12\x1e\n" +
+	"\n" +
+	"resolution\x18\x13 \x01(\tR\n" +
+	"resolution\x12!\n" +
+	"\ftimestamp_ms\x18\x14 \x01(\x03R\vtimestampMsB\v\n" +
+	"\t_latitudeB\f\n" +
+	"\n" +
+	"_longitude\"C\n" +
+	"\bCoaching\x12\x1d\n" +
+	"\n" +
+	"event_json\x18\x01 \x01(\fR\teventJson\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"X\n" +
+	"\rDriverMessage\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x04R\tmessageId\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x12\n" +
+	"\x04body\x18\x03 \x01(\tR\x04body\"\xe4\x02\n" +
+	"\x03Ack\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x02 \x01(\tR\teventType\x12\x1a\n" +
+	"\bdistance\x18\x03 \x01(\x01R\bdistance\x12\x1b\n" +
+	"\tis_moving\x18\x04 \x01(\bR\bisMoving\x12!\n" +
+	"\ftimestamp_ms\x18\x05 \x01(\x03R\vtimestampMs\x12\x1f\n" +
+	"\vsequence_id\x18\x06 \x01(\x04R\n" +
+	"sequenceId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\a \x01(\x04R\tvehicleId\x12)\n" +
+	"\x10occupancy_status\x18\b \x01(\tR\x0foccupancyStatus\x12!\n" +
+	"\toccupancy\x18\t \x01(\x05H\x00R\toccupancy\x88\x01\x01\x12\x17\n" +
+	"\atrip_id\x18\n" +
+	" \x01(\x04R\x06tripId\x12\x15\n" +
+	"\x06sos_id\x18\v \x01(\x04R\x05sosIdB\f\n" +
+	"\n" +
+	"_occupancy\"\x1d\n" +
+	"\x05Error\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05errorB#Z!ma3_tracker/internal/wsproto/wsv1b\x06proto3"
+
+var (
+	file_ws_v1_messages_proto_rawDescOnce sync.Once
+	file_ws_v1_messages_proto_rawDescData []byte
+)
+
+func file_ws_v1_messages_proto_rawDescGZIP() []byte {
+	file_ws_v1_messages_proto_rawDescOnce.Do(func() {
+		file_ws_v1_messages_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ws_v1_messages_proto_rawDesc), len(file_ws_v1_messages_proto_rawDesc)))
+	})
+	return file_ws_v1_messages_proto_rawDescData
+}
+
+var file_ws_v1_messages_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_ws_v1_messages_proto_goTypes = []any{
+	(*Envelope)(nil),      // 0: ma3tracker.ws.v1.Envelope
+	(*Location)(nil),      // 1: ma3tracker.ws.v1.Location
+	(*StageETA)(nil),      // 2: ma3tracker.ws.v1.StageETA
+	(*Snapshot)(nil),      // 3: ma3tracker.ws.v1.Snapshot
+	(*Occupancy)(nil),     // 4: ma3tracker.ws.v1.Occupancy
+	(*Alert)(nil),         // 5: ma3tracker.ws.v1.Alert
+	(*StageEvent)(nil),    // 6: ma3tracker.ws.v1.StageEvent
+	(*WatchAlert)(nil),    // 7: ma3tracker.ws.v1.WatchAlert
+	(*SOS)(nil),           // 8: ma3tracker.ws.v1.SOS
+	(*Coaching)(nil),      // 9: ma3tracker.ws.v1.Coaching
+	(*DriverMessage)(nil), // 10: ma3tracker.ws.v1.DriverMessage
+	(*Ack)(nil),           // 11: ma3tracker.ws.v1.Ack
+	(*Error)(nil),         // 12: ma3tracker.ws.v1.Error
+}
+var file_ws_v1_messages_proto_depIdxs = []int32{
+	1,  // 0: ma3tracker.ws.v1.Envelope.location:type_name -> ma3tracker.ws.v1.Location
+	3,  // 1: ma3tracker.ws.v1.Envelope.snapshot:type_name -> ma3tracker.ws.v1.Snapshot
+	4,  // 2: ma3tracker.ws.v1.Envelope.occupancy:type_name -> ma3tracker.ws.v1.Occupancy
+	5,  // 3: ma3tracker.ws.v1.Envelope.alert:type_name -> ma3tracker.ws.v1.Alert
+	9,  // 4: ma3tracker.ws.v1.Envelope.coaching:type_name -> ma3tracker.ws.v1.Coaching
+	10, // 5: ma3tracker.ws.v1.Envelope.message:type_name -> ma3tracker.ws.v1.DriverMessage
+	11, // 6: ma3tracker.ws.v1.Envelope.ack:type_name -> ma3tracker.ws.v1.Ack
+	12, // 7: ma3tracker.ws.v1.Envelope.error:type_name -> ma3tracker.ws.v1.Error
+	6,  // 8: ma3tracker.ws.v1.Envelope.stage_arrival:type_name -> ma3tracker.ws.v1.StageEvent
+	6,  // 9: ma3tracker.ws.v1.Envelope.stage_departure:type_name -> ma3tracker.ws.v1.StageEvent
+	7,  // 10: ma3tracker.ws.v1.Envelope.watch_alert:type_name -> ma3tracker.ws.v1.WatchAlert
+	8,  // 11: ma3tracker.ws.v1.Envelope.sos:type_name -> ma3tracker.ws.v1.SOS
+	2,  // 12: ma3tracker.ws.v1.Location.etas:type_name -> ma3tracker.ws.v1.StageETA
+	1,  // 13: ma3tracker.ws.v1.Snapshot.vehicles:type_name -> ma3tracker.ws.v1.Location
+	14, // [14:14] is the sub-list for method output_type
+	14, // [14:14] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_ws_v1_messages_proto_init() }
+func file_ws_v1_messages_proto_init() {
+	if File_ws_v1_messages_proto != nil {
+		return
+	}
+	file_ws_v1_messages_proto_msgTypes[0].OneofWrappers = []any{
+		(*Envelope_Location)(nil),
+		(*Envelope_Snapshot)(nil),
+		(*Envelope_Occupancy)(nil),
+		(*Envelope_Alert)(nil),
+		(*Envelope_Coaching)(nil),
+		(*Envelope_Message)(nil),
+		(*Envelope_Ack)(nil),
+		(*Envelope_Error)(nil),
+		(*Envelope_StageArrival)(nil),
+		(*Envelope_StageDeparture)(nil),
+		(*Envelope_WatchAlert)(nil),
+		(*Envelope_Sos)(nil),
+	}
+	file_ws_v1_messages_proto_msgTypes[1].OneofWrappers = []any{}
+	file_ws_v1_messages_proto_msgTypes[4].OneofWrappers = []any{}
+	file_ws_v1_messages_proto_msgTypes[8].OneofWrappers = []any{}
+	file_ws_v1_messages_proto_msgTypes[11].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ws_v1_messages_proto_rawDesc), len(file_ws_v1_messages_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ws_v1_messages_proto_goTypes,
+		DependencyIndexes: file_ws_v1_messages_proto_depIdxs,
+		MessageInfos:      file_ws_v1_messages_proto_msgTypes,
+	}.Build()
+	File_ws_v1_messages_proto = out.File
+	file_ws_v1_messages_proto_goTypes = nil
+	file_ws_v1_messages_proto_depIdxs = nil
+}